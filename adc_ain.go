@@ -0,0 +1,74 @@
+package bbhw
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// SysfsADC of ReadAIN, opened on its first use
+var ain_adc_ = struct {
+	lock sync.Mutex
+	adc  *SysfsADC
+}{}
+
+// Returns the ADC channel (N of in_voltageN_raw, as used by SysfsADC) of an analog input of the current board
+// (see SetBoard), by its name, e.g. "AIN3", or its header pin, e.g. "P9_38" on a BeagleBone Black or "P1_25" on a
+// PocketBeagle. Names are case-insensitive, pins are accepted like by GPIONumberForPin.
+// Header pins which are not analog inputs return an error wrapping ErrNotSupported.
+func AINChannel(name string) (uint, error) {
+	board := currentBoard()
+	ain := strings.ToUpper(strings.TrimSpace(name))
+	if strings.HasPrefix(ain, "AIN") {
+		for _, a := range board.analog {
+			if a.name == ain {
+				return a.channel, nil
+			}
+		}
+		return 0, fmt.Errorf("%s is not on the header of the %s: %w", ain, board.name, ErrNotSupported)
+	}
+	p, err := board.lookupPin(name)
+	if err != nil {
+		return 0, err
+	}
+	for _, a := range board.analog {
+		if a.pin == p.name {
+			return a.channel, nil
+		}
+	}
+	what := p.function
+	if p.gpio >= 0 {
+		what = fmt.Sprintf("gpio%d", p.gpio)
+	}
+	return 0, fmt.Errorf("header pin %s is %s, not an analog input: %w", p.name, what, ErrNotSupported)
+}
+
+// Inverse of AINChannel, returns the name and header pin of an ADC channel, e.g. "AIN3" and "P9_38" for 3
+func PinForAIN(channel uint) (name, pin string, err error) {
+	board := currentBoard()
+	for _, a := range board.analog {
+		if a.channel == channel {
+			return a.name, a.pin, nil
+		}
+	}
+	return "", "", fmt.Errorf("ADC channel %d is not on the header of the %s", channel, board.name)
+}
+
+// Reads the volts of an analog input by name or header pin, see AINChannel, e.g. ReadAIN("P9_38").
+// The SysfsADC is opened on the first call and shared by the later ones, with the default reference, scale and calibration.
+func ReadAIN(name string) (float64, error) {
+	channel, err := AINChannel(name)
+	if err != nil {
+		return 0, err
+	}
+	ain_adc_.lock.Lock()
+	if ain_adc_.adc == nil {
+		if ain_adc_.adc, err = NewSysfsADC(); err != nil {
+			ain_adc_.lock.Unlock()
+			return 0, err
+		}
+	}
+	adc := ain_adc_.adc
+	ain_adc_.lock.Unlock()
+	return adc.ReadVoltage(channel)
+}
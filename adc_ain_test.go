@@ -0,0 +1,81 @@
+package bbhw
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_AINTables(t *testing.T) {
+	for _, board := range boards_ {
+		useBoard(t, board.name)
+		listed := make(map[string]bool)
+		for _, a := range board.analog {
+			for _, name := range []string{a.name, strings.ToLower(a.name), a.pin, strings.Replace(a.pin, "_", ".", 1)} {
+				if channel, err := AINChannel(name); err != nil || channel != a.channel {
+					t.Errorf("%s: AINChannel(%q) = %d, %v, expected %d", board.name, name, channel, err, a.channel)
+				}
+			}
+			if name, pin, err := PinForAIN(a.channel); err != nil || name != a.name || pin != a.pin {
+				t.Errorf("%s: PinForAIN(%d) = %s, %s, %v", board.name, a.channel, name, pin, err)
+			}
+			if a.name != "AIN"+string(rune('0'+a.channel)) {
+				t.Errorf("%s: %s is channel %d", board.name, a.name, a.channel)
+			}
+			// the pin table agrees, pins shared with a GPIO are listed as that
+			p, err := board.lookupPin(a.pin)
+			if err != nil || (p.gpio < 0 && p.function != "analog input "+a.name) {
+				t.Errorf("%s: %s of %s is %+v, %v in the pin table", board.name, a.pin, a.name, p, err)
+			}
+			listed[a.pin] = true
+		}
+		for _, p := range board.pins {
+			if strings.HasPrefix(p.function, "analog input") && !listed[p.name] {
+				t.Errorf("%s: %s (%s) missing from the analog pins", board.name, p.name, p.function)
+			}
+		}
+	}
+}
+
+func Test_AINChannelErrors(t *testing.T) {
+	useBoard(t, BOARD_BEAGLEBONE)
+	for name, why := range map[string]string{"P9_12": "gpio60", "P9_01": "GND", "P9_32": "VDD_ADC", "AIN7": "AIN7", "AIN12": "AIN12"} {
+		if _, err := AINChannel(name); !errors.Is(err, ErrNotSupported) || !strings.Contains(err.Error(), why) {
+			t.Errorf("AINChannel(%q): %v, expected ErrNotSupported mentioning %s", name, err, why)
+		}
+	}
+	if _, err := AINChannel("P10_01"); err == nil || !strings.Contains(err.Error(), "unknown") {
+		t.Errorf("unknown pin: %v", err)
+	}
+	if _, _, err := PinForAIN(7); err == nil {
+		t.Error("no error for AIN7")
+	}
+	useBoard(t, BOARD_POCKETBEAGLE)
+	if channel, err := AINChannel("AIN7"); err != nil || channel != 7 {
+		t.Errorf("PocketBeagle AIN7: %d, %v", channel, err)
+	}
+	if _, err := AINChannel("P9_38"); err == nil {
+		t.Error("no error for a BeagleBone pin on the PocketBeagle")
+	}
+}
+
+func Test_ReadAIN(t *testing.T) {
+	useBoard(t, BOARD_BEAGLEBONE)
+	useIIODir(t, filepath.Join("testdata", "iio-4.19"))
+	t.Cleanup(func() {
+		if ain_adc_.adc != nil {
+			ain_adc_.adc.Close()
+		}
+		ain_adc_.adc = nil
+	})
+	// channel 3 reads 4095, channel 2 2048 in the fixture
+	for name, expected := range map[string]float64{"AIN3": 4095 * 1.8 / 4096, "P9_37": 0.9} {
+		if v, err := ReadAIN(name); err != nil || v != expected {
+			t.Errorf("ReadAIN(%q) = %v, %v, expected %v", name, v, err, expected)
+		}
+	}
+	if _, err := ReadAIN("P9_12"); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("ReadAIN(P9_12): %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package bbhw
+
+import (
+	"errors"
+	"math"
+	"os"
+	"testing"
+)
+
+// raw values of channels 0 to 3 the ADCs under test are set up with, those of the 4.19 fixture
+var adc_conformance_values_ = []int{0, 1023, 2048, 4095}
+
+// behaviour every ADC implementation must show
+func checkADCBehaviour(t *testing.T, name string, adc ADC) {
+	for channel, expected := range adc_conformance_values_ {
+		if v, err := adc.ReadRaw(uint(channel)); err != nil || v != expected {
+			t.Errorf("%s: ReadRaw(%d) = %d, %v, expected %d", name, channel, v, err, expected)
+		}
+	}
+	if v, err := adc.ReadVoltage(2); err != nil || math.Abs(v-0.9) > 1e-9 {
+		t.Errorf("%s: ReadVoltage(2) = %v, %v", name, v, err)
+	}
+	if mv, err := adc.ReadMillivolts(1); err != nil || mv != 450 {
+		t.Errorf("%s: ReadMillivolts(1) = %d, %v", name, mv, err)
+	}
+	if v, err := adc.ReadFiltered(3, FilterOpts{Filter: FILTER_MEDIAN, Samples: 5}); err != nil || v != 4095 {
+		t.Errorf("%s: ReadFiltered(3) = %v, %v", name, v, err)
+	}
+	if s := adc.GetScale(2); s != (ADCScale{Scale: 1}) {
+		t.Errorf("%s: default scale %+v", name, s)
+	}
+	if err := adc.SetScale(2, ADCScale{Scale: 11}); err != nil {
+		t.Errorf("%s: SetScale: %v", name, err)
+	}
+	if mv, err := adc.ReadMillivolts(2); err != nil || mv != 9900 {
+		t.Errorf("%s: ReadMillivolts(2) = %d, %v with scale 11", name, mv, err)
+	}
+	if err := adc.SetScale(2, ADCScale{Scale: math.Inf(1)}); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("%s: SetScale(Inf) returned %v, expected ErrOutOfRange", name, err)
+	}
+	if _, err := adc.ReadFiltered(3, FilterOpts{}); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("%s: ReadFiltered without samples returned %v, expected ErrOutOfRange", name, err)
+	}
+	var aerr *ADCError
+	if _, err := adc.ReadRaw(8); !errors.As(err, &aerr) || aerr.Channel != 8 || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("%s: ReadRaw(8) returned %v, expected an ADCError of a missing channel", name, err)
+	}
+	adc.Close()
+	if _, err := adc.ReadRaw(0); !errors.As(err, &aerr) || !errors.Is(err, os.ErrClosed) {
+		t.Errorf("%s: ReadRaw after Close returned %v, expected os.ErrClosed", name, err)
+	}
+}
+
+func Test_ADCConformance(t *testing.T) {
+	t.Run("FakeADC", func(t *testing.T) {
+		adc := NewFakeADC()
+		for channel, v := range adc_conformance_values_ {
+			adc.SetValue(uint(channel), v)
+		}
+		checkADCBehaviour(t, "FakeADC", adc)
+	})
+	t.Run("SysfsADC", func(t *testing.T) {
+		checkADCBehaviour(t, "SysfsADC", newFixtureADC(t))
+	})
+}
@@ -2,45 +2,54 @@ package bbhw
 
 // SysFS managed ADCs ------------------------------------
 
-type FakeADC struct {
+// Fake of a BBBLegacyADC, FakeADC fakes a SysfsADC. It was named FakeADC, created by NewFakeADC(number),
+// before FakeADC became the fake of the IIO ADC.
+//
+// Deprecated: use FakeADC, see LegacyADC.
+type FakeLegacyADC struct {
 	Number uint
 	value  uint16
 	err    error
 }
 
-// Instantinate a new Fake ADC for Simulation
-func NewFakeADC(number uint) (adc *FakeADC, err error) {
-	adc = new(FakeADC)
+// Instantinate a new Fake legacy ADC for Simulation
+//
+// Deprecated: use NewFakeADC, see FakeLegacyADC.
+func NewFakeLegacyADC(number uint) (adc *FakeLegacyADC, err error) {
+	adc = new(FakeLegacyADC)
 	adc.Number = number
 	return adc, nil
 }
 
-func NewFakeADCOrPanic(number uint) (adc *FakeADC) {
-	adc, _ = NewFakeADC(number)
+// Wrapper around NewFakeLegacyADC. Does not return an error but panics instead. Useful to avoid multiple return values.
+//
+// Deprecated: use NewFakeADC, see FakeLegacyADC.
+func NewFakeLegacyADCOrPanic(number uint) (adc *FakeLegacyADC) {
+	adc, _ = NewFakeLegacyADC(number)
 	return
 }
 
-func (adc *FakeADC) ReadValue() (value uint16) {
+func (adc *FakeLegacyADC) ReadValue() (value uint16) {
 	if adc == nil {
 		panic("adc == nil")
 	}
 	return adc.value
 }
 
-func (adc *FakeADC) CheckErrorOccurred() error {
+func (adc *FakeLegacyADC) CheckErrorOccurred() error {
 	if adc == nil {
 		panic("adc == nil")
 	}
 	return adc.err
 }
 
-func (adc *FakeADC) ReadValueCheckError() (value uint16, err error) {
+func (adc *FakeLegacyADC) ReadValueCheckError() (value uint16, err error) {
 	value = adc.ReadValue()
 	err = adc.CheckErrorOccurred()
 	return
 }
 
-func (adc *FakeADC) SimulateValue(value uint16, err error) {
+func (adc *FakeLegacyADC) SimulateValue(value uint16, err error) {
 	adc.value = value
 	adc.err = err
 }
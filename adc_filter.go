@@ -0,0 +1,172 @@
+package bbhw
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Statistic ReadFiltered reduces its samples with
+type ADCFilter int
+
+const (
+	FILTER_MEAN         ADCFilter = iota // average of all samples
+	FILTER_MEDIAN                        // middle sample (average of the two middle ones for even counts), ignores single spikes
+	FILTER_TRIMMED_MEAN                  // average without the lowest and highest FilterOpts.Trim of the samples
+)
+
+func (f ADCFilter) String() string {
+	switch f {
+	case FILTER_MEAN:
+		return "mean"
+	case FILTER_MEDIAN:
+		return "median"
+	case FILTER_TRIMMED_MEAN:
+		return "trimmed mean"
+	default:
+		return fmt.Sprintf("ADCFilter(%d)", int(f))
+	}
+}
+
+// How ReadFiltered samples a channel
+type FilterOpts struct {
+	Filter  ADCFilter
+	Samples int           // raw reads, at least 1
+	Delay   time.Duration // between the reads, e.g. to spread them over a mains cycle
+	Trim    float64       // fraction dropped at either end for FILTER_TRIMMED_MEAN, 0 <= Trim < 0.5, e.g. 0.1
+}
+
+func (o FilterOpts) check() error {
+	if o.Samples < 1 || o.Delay < 0 || !(o.Trim >= 0 && o.Trim < 0.5) {
+		return fmt.Errorf("SysfsADC: %d samples, delay %v, trim %v: %w", o.Samples, o.Delay, o.Trim, ErrOutOfRange)
+	}
+	if o.Filter < FILTER_MEAN || o.Filter > FILTER_TRIMMED_MEAN {
+		return fmt.Errorf("SysfsADC: %v: %w", o.Filter, ErrNotSupported)
+	}
+	return nil
+}
+
+// Reads channel opts.Samples times, opts.Delay apart, and reduces the raw values with opts.Filter.
+// The result is in counts like ReadRaw, but with fractions and calibrated (see SetCalibration).
+func (adc *SysfsADC) ReadFiltered(channel uint, opts FilterOpts) (float64, error) {
+	v, err := readFiltered(adc.clock, func() (int, error) { return adc.ReadRaw(channel) }, opts)
+	if err != nil {
+		return 0, err
+	}
+	adc.lock.Lock()
+	defer adc.lock.Unlock()
+	// the calibration is linear with a positive gain, so it can be applied after any of the filters
+	c := adc.calibration(channel)
+	return v*c.Gain + c.Offset*adc_counts_/adc.reference, nil
+}
+
+// shared by SysfsADC and FakeADC
+func readFiltered(clock Clock, read func() (int, error), opts FilterOpts) (float64, error) {
+	if err := opts.check(); err != nil {
+		return 0, err
+	}
+	values := make([]float64, opts.Samples)
+	for i := range values {
+		if i > 0 && opts.Delay > 0 {
+			clock.Sleep(opts.Delay)
+		}
+		v, err := read()
+		if err != nil {
+			return 0, err
+		}
+		values[i] = float64(v)
+	}
+	return filterValues(values, opts.Filter, opts.Trim), nil
+}
+
+// pure, values are not modified, NaN for no values
+func filterValues(values []float64, f ADCFilter, trim float64) float64 {
+	if len(values) == 0 {
+		return math.NaN()
+	}
+	switch f {
+	case FILTER_MEDIAN:
+		return median(append([]float64(nil), values...))
+	case FILTER_TRIMMED_MEAN:
+		return trimmedMean(values, trim)
+	default:
+		return mean(values)
+	}
+}
+
+func mean(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// mean without floor(trim * len) values at either end, values are not modified
+func trimmedMean(values []float64, trim float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := int(trim * float64(len(sorted)))
+	if 2*n >= len(sorted) {
+		return median(sorted)
+	}
+	return mean(sorted[n : len(sorted)-n])
+}
+
+// Average of the last values added, e.g. to smooth the Samples of StartBufferedCapture.
+// Not safe for concurrent use.
+type MovingAverage struct {
+	window []float64
+	next   int // in window
+	n      int // values in window
+	sum    float64
+	adds   int // since sum was summed up again
+}
+
+// A MovingAverage over the last size values, panics if size < 1
+func NewMovingAverage(size int) *MovingAverage {
+	if size < 1 {
+		panic(errors.New("MovingAverage needs a size of at least 1"))
+	}
+	return &MovingAverage{window: make([]float64, size)}
+}
+
+// Adds v, dropping the oldest value once the window is full, and returns the new average
+func (m *MovingAverage) Add(v float64) float64 {
+	if m.n == len(m.window) {
+		m.sum -= m.window[m.next]
+	} else {
+		m.n++
+	}
+	m.window[m.next] = v
+	m.sum += v
+	m.next = (m.next + 1) % len(m.window)
+	// against rounding errors piling up in the running sum
+	if m.adds++; m.adds >= 1000*len(m.window) {
+		m.sum, m.adds = 0, 0
+		for _, w := range m.window[:m.n] {
+			m.sum += w
+		}
+	}
+	return m.Value()
+}
+
+// The average of the values in the window, NaN before the first Add
+func (m *MovingAverage) Value() float64 {
+	if m.n == 0 {
+		return math.NaN()
+	}
+	return m.sum / float64(m.n)
+}
+
+// Whether the window is full, before that the average is over fewer values
+func (m *MovingAverage) Full() bool {
+	return m.n == len(m.window)
+}
+
+// Empties the window
+func (m *MovingAverage) Reset() {
+	m.next, m.n, m.sum, m.adds = 0, 0, 0, 0
+}
@@ -0,0 +1,144 @@
+package bbhw
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_FilterValues(t *testing.T) {
+	values := []float64{12, 10, 11, 250, 9, 10, 0, 11, 10, 12}
+	for _, c := range []struct {
+		f        ADCFilter
+		trim     float64
+		expected float64
+	}{
+		{FILTER_MEAN, 0, 33.5},
+		{FILTER_MEDIAN, 0, 10.5},
+		{FILTER_TRIMMED_MEAN, 0.1, 10.625},   // without 0 and 250
+		{FILTER_TRIMMED_MEAN, 0.09, 33.5},    // floor(0.9), nothing trimmed
+		{FILTER_TRIMMED_MEAN, 0.2, 64.0 / 6}, // without 0, 9, 12 and 250
+		{FILTER_TRIMMED_MEAN, 0, 33.5},
+	} {
+		if v := filterValues(values, c.f, c.trim); math.Abs(v-c.expected) > 1e-9 {
+			t.Errorf("%v %v: %v, expected %v", c.f, c.trim, v, c.expected)
+		}
+	}
+	if values[0] != 12 || values[3] != 250 {
+		t.Errorf("values modified: %v", values)
+	}
+	if v := filterValues([]float64{7, 1, 4}, FILTER_MEDIAN, 0); v != 4 {
+		t.Errorf("odd median %v", v)
+	}
+	// too few values to trim falls back to the median
+	if v := filterValues([]float64{1, 2, 30}, FILTER_TRIMMED_MEAN, 0.49); v != 2 {
+		t.Errorf("trimming everything: %v", v)
+	}
+	for _, f := range []ADCFilter{FILTER_MEAN, FILTER_MEDIAN, FILTER_TRIMMED_MEAN} {
+		if v := filterValues(nil, f, 0.1); !math.IsNaN(v) {
+			t.Errorf("%v of nothing: %v", f, v)
+		}
+	}
+}
+
+func Test_MovingAverage(t *testing.T) {
+	m := NewMovingAverage(3)
+	if !math.IsNaN(m.Value()) || m.Full() {
+		t.Error("not empty")
+	}
+	for i, c := range []struct{ v, expected float64 }{{3, 3}, {6, 4.5}, {9, 6}, {0, 5}, {3, 4}} {
+		if avg := m.Add(c.v); avg != c.expected || m.Value() != avg {
+			t.Errorf("%d: Add(%v) = %v, expected %v", i, c.v, avg, c.expected)
+		}
+		if m.Full() != (i >= 2) {
+			t.Errorf("%d: Full %v", i, m.Full())
+		}
+	}
+	m.Reset()
+	if m.Add(1) != 1 || m.Full() {
+		t.Error("Reset did not empty it")
+	}
+	// the running sum does not drift
+	m = NewMovingAverage(4)
+	for i := 0; i < 100000; i++ {
+		m.Add(0.1 * float64(i%7))
+	}
+	var expected float64
+	for i := 100000 - 4; i < 100000; i++ {
+		expected += 0.1 * float64(i%7) / 4
+	}
+	if math.Abs(m.Value()-expected) > 1e-12 {
+		t.Errorf("%v, expected %v", m.Value(), expected)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic for size 0")
+		}
+	}()
+	NewMovingAverage(0)
+}
+
+func Test_SysfsADCReadFiltered(t *testing.T) {
+	adc := newFixtureADC(t)
+	for _, f := range []ADCFilter{FILTER_MEAN, FILTER_MEDIAN, FILTER_TRIMMED_MEAN} {
+		if v, err := adc.ReadFiltered(2, FilterOpts{Filter: f, Samples: 8, Trim: 0.25}); err != nil || v != 2048 {
+			t.Errorf("%v: %v, %v", f, v, err)
+		}
+	}
+	for _, opts := range []FilterOpts{{}, {Samples: 4, Delay: -1}, {Samples: 4, Trim: 0.5}, {Samples: 4, Trim: math.NaN()}} {
+		if _, err := adc.ReadFiltered(2, opts); !errors.Is(err, ErrOutOfRange) {
+			t.Errorf("%+v: %v", opts, err)
+		}
+	}
+	if _, err := adc.ReadFiltered(2, FilterOpts{Filter: 7, Samples: 1}); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("unknown filter: %v", err)
+	}
+	var aerr *ADCError
+	if _, err := adc.ReadFiltered(9, FilterOpts{Samples: 2}); !errors.As(err, &aerr) {
+		t.Errorf("missing channel: %v", err)
+	}
+}
+
+func Test_SysfsADCReadFilteredDelay(t *testing.T) {
+	dir := t.TempDir()
+	ddir := filepath.Join(dir, "iio:device0")
+	os.Mkdir(ddir, 0755)
+	os.WriteFile(filepath.Join(ddir, "name"), []byte("TI-am335x-adc\n"), 0644)
+	raw := filepath.Join(ddir, "in_voltage0_raw")
+	os.WriteFile(raw, []byte("10\n"), 0644)
+	useIIODir(t, dir)
+	clock := NewManualClock(time.Unix(1000, 0))
+	adc, err := NewSysfsADC(ADCWithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer adc.Close()
+
+	type result struct {
+		v   float64
+		err error
+	}
+	done := make(chan result, 1)
+	afterTimer(t, clock, func() {
+		go func() {
+			v, err := adc.ReadFiltered(0, FilterOpts{Filter: FILTER_MEDIAN, Samples: 3, Delay: 20 * time.Millisecond})
+			done <- result{v, err}
+		}()
+	})
+	os.WriteFile(raw, []byte("100\n"), 0644)
+	afterTimer(t, clock, func() { clock.Advance(20 * time.Millisecond) })
+	// a spike, dropped by the median
+	os.WriteFile(raw, []byte("4000\n"), 0644)
+	select {
+	case <-done:
+		t.Fatal("did not wait for the delay")
+	default:
+	}
+	clock.Advance(20 * time.Millisecond)
+	if r := <-done; r.err != nil || r.v != 100 {
+		t.Errorf("%v, %v", r.v, r.err)
+	}
+}
@@ -0,0 +1,236 @@
+package bbhw
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// where the IIO devices are, changed by tests to point to fixture trees
+var sysfs_iio_base_ = "/sys/bus/iio/devices"
+
+// name of the touchscreen/ADC subsystem of the AM335x, "TI-am335x-adc.0.auto" with 5.x kernels
+const am335x_adc_name_ = "TI-am335x-adc"
+
+// Error of a SysfsADC reading or opening a channel
+type ADCError struct {
+	Device  uint // N of iio:deviceN
+	Channel uint
+	Op      string
+	Err     error
+}
+
+func (e *ADCError) Error() string {
+	return fmt.Sprintf("iio:device%d/in_voltage%d_raw: %s: %v", e.Device, e.Channel, e.Op, e.Err)
+}
+
+func (e *ADCError) Unwrap() error { return e.Err }
+
+// Analog inputs implemented by SysfsADC and FakeADC, so controllers reading them can be tested without hardware.
+// LegacyADC is the interface of the 3.8 helper driver, see ToLegacyADC.
+type ADC interface {
+	ReadRaw(channel uint) (int, error)
+	ReadVoltage(channel uint) (float64, error)
+	ReadMillivolts(channel uint) (int, error)
+	ReadFiltered(channel uint, opts FilterOpts) (float64, error)
+	SetScale(channel uint, s ADCScale) error
+	GetScale(channel uint) ADCScale
+	Close()
+}
+
+var (
+	_ ADC = (*SysfsADC)(nil)
+	_ ADC = (*FakeADC)(nil)
+)
+
+// Option of NewSysfsADC
+type ADCOption func(*SysfsADC)
+
+// Reference voltage of the ADC (full scale of ReadVoltage), default 1.8V of the AM335x
+func ADCWithReference(volts float64) ADCOption {
+	return func(adc *SysfsADC) { adc.reference = volts }
+}
+
+// waits between the samples of ReadFiltered on c
+func ADCWithClock(c Clock) ADCOption {
+	return func(adc *SysfsADC) { adc.clock = c }
+}
+
+// The ADC of the AM335x through the IIO subsystem, AIN0 to AIN6 on the header of the BeagleBone
+// (AIN7 measures half the 1.8V supply). Safe for concurrent use.
+type SysfsADC struct {
+	Device       uint // N of iio:deviceN
+	dir          string
+	clock        Clock
+	lock         sync.Mutex // guards everything below
+	files        map[uint]*os.File
+	reference    float64
+	scales       map[uint]ADCScale    // channels without use the default
+	calibrations map[uint]Calibration // channels without are not calibrated
+	capture      *iioCapture          // running StartBufferedCapture
+}
+
+// Finds the IIO device of the AM335x ADC by its name, its number differs when other IIO devices
+// (e.g. an I2C sensor) probe first. Channels are opened on their first read.
+func NewSysfsADC(opts ...ADCOption) (*SysfsADC, error) {
+	adc := &SysfsADC{files: make(map[uint]*os.File), reference: adc_reference_default_, scales: make(map[uint]ADCScale),
+		calibrations: make(map[uint]Calibration)}
+	for _, opt := range opts {
+		opt(adc)
+	}
+	if err := checkADCReference(adc.reference); err != nil {
+		return nil, err
+	}
+	if adc.clock == nil {
+		adc.clock = defaultClock()
+	}
+	var err error
+	if adc.Device, adc.dir, err = findIIODevice(am335x_adc_name_); err != nil {
+		return nil, err
+	}
+	return adc, nil
+}
+
+// Wrapper around NewSysfsADC. Does not return an error but panics instead. Useful to avoid multiple return values.
+func NewSysfsADCOrPanic(opts ...ADCOption) *SysfsADC {
+	adc, err := NewSysfsADC(opts...)
+	if err != nil {
+		panic(err)
+	}
+	return adc
+}
+
+// number and directory of the first iio:deviceN whose name starts with name
+func findIIODevice(name string) (device uint, dir string, err error) {
+	dirs, err := filepath.Glob(filepath.Join(sysfs_iio_base_, "iio:device*"))
+	if err != nil {
+		return 0, "", err
+	}
+	type iioDevice struct {
+		n    uint
+		dir  string
+		name string
+	}
+	devices := make([]iioDevice, 0, len(dirs))
+	for _, d := range dirs {
+		n, err := strconv.ParseUint(strings.TrimPrefix(filepath.Base(d), "iio:device"), 10, 32)
+		if err != nil {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(d, "name"))
+		if err != nil {
+			continue
+		}
+		devices = append(devices, iioDevice{uint(n), d, strings.TrimSpace(string(b))})
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].n < devices[j].n })
+	present := make([]string, len(devices))
+	for i, d := range devices {
+		if strings.HasPrefix(d.name, name) {
+			return d.n, d.dir, nil
+		}
+		present[i] = fmt.Sprintf("iio:device%d (%s)", d.n, d.name)
+	}
+	found := "there are no IIO devices"
+	if len(present) > 0 {
+		found = "present are " + strings.Join(present, ", ")
+	}
+	return 0, "", fmt.Errorf("no %s in %s, ADC not enabled? Load the BB-ADC overlay, e.g. uboot_overlay_addr4=BB-ADC-00A0.dtbo in /boot/uEnv.txt (%s)",
+		name, sysfs_iio_base_, found)
+}
+
+// Starts a conversion of channel and returns its raw value, 0 to 4095 for the 12 bit ADC of the AM335x
+func (adc *SysfsADC) ReadRaw(channel uint) (int, error) {
+	f, err := adc.file(channel)
+	if err != nil {
+		return 0, err
+	}
+	var buf [32]byte
+	return adc.readRaw(f, channel, buf[:])
+}
+
+// reads the in_voltage<channel>_raw f into buf
+func (adc *SysfsADC) readRaw(f *os.File, channel uint, buf []byte) (int, error) {
+	n, err := f.ReadAt(buf, 0)
+	if n == 0 && err != nil && err != io.EOF {
+		return 0, &ADCError{adc.Device, channel, "read", err}
+	}
+	line := buf[:n]
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	line = bytes.TrimSpace(line)
+	v, ok := parseADCRaw(line)
+	if !ok {
+		return 0, &ADCError{adc.Device, channel, "read", fmt.Errorf("%q: %w", line, ErrInvalidAttribute)}
+	}
+	return v, nil
+}
+
+// a decimal number, without allocating like strconv.Atoi(string(b)) would
+func parseADCRaw(b []byte) (v int, ok bool) {
+	neg := len(b) > 0 && b[0] == '-'
+	if neg {
+		b = b[1:]
+	}
+	if len(b) == 0 || len(b) > 9 {
+		return 0, false
+	}
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		v = v*10 + int(c-'0')
+	}
+	if neg {
+		v = -v
+	}
+	return v, true
+}
+
+// the opened in_voltage<channel>_raw
+func (adc *SysfsADC) file(channel uint) (*os.File, error) {
+	adc.lock.Lock()
+	defer adc.lock.Unlock()
+	return adc.openFile(channel)
+}
+
+// file with lock held
+func (adc *SysfsADC) openFile(channel uint) (*os.File, error) {
+	if adc.files == nil {
+		return nil, &ADCError{adc.Device, channel, "open", os.ErrClosed}
+	}
+	if f := adc.files[channel]; f != nil {
+		return f, nil
+	}
+	f, err := os.Open(filepath.Join(adc.dir, fmt.Sprintf("in_voltage%d_raw", channel)))
+	if os.IsNotExist(err) {
+		return nil, &ADCError{adc.Device, channel, "open", fmt.Errorf("no such channel: %w", err)}
+	} else if err != nil {
+		return nil, &ADCError{adc.Device, channel, "open", err}
+	}
+	adc.files[channel] = f
+	return f, nil
+}
+
+// Stops a buffered capture and closes the channels, reading fails with os.ErrClosed afterwards
+func (adc *SysfsADC) Close() {
+	adc.lock.Lock()
+	capture := adc.capture
+	adc.lock.Unlock()
+	if capture != nil {
+		capture.stop()
+	}
+	adc.lock.Lock()
+	defer adc.lock.Unlock()
+	for _, f := range adc.files {
+		f.Close()
+	}
+	adc.files = nil
+}
@@ -0,0 +1,391 @@
+package bbhw
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// where the IIO character devices are, changed by tests
+var iio_dev_dir_ = "/dev"
+
+// length of the kernel buffer in scans at least, it holds 200ms of scans otherwise
+const iio_buffer_min_scans_ = 64
+
+// One scan of the channels of a buffered capture, see SysfsADC.StartBufferedCapture
+type Sample struct {
+	// kernel timestamp if the device has a timestamp channel, otherwise estimated from when the scans were read
+	Time      time.Time
+	Timestamp time.Duration // raw kernel timestamp, 0 without timestamp channel
+	Values    []int         // raw values in the order of the channels passed to StartBufferedCapture
+	// scans lost right before this one: dropped because samples was full, or missing from the kernel timestamps
+	Missed uint32
+	// the kernel buffer was full when this scan was read, scans may have been lost without timestamps telling
+	Overrun bool
+	Err     error // set on the last Sample if the capture ended on an error
+}
+
+// Format of a scan element as in scan_elements/*_type, e.g. le:u12/16>>0 or be:s24/32>>8
+type iioScanType struct {
+	big_endian bool
+	signed     bool
+	bits       uint // valid bits
+	storage    uint // bits taken in the scan
+	shift      uint
+}
+
+var iio_scan_type_re_ = regexp.MustCompile(`^(le|be):([su])(\d+)/(\d+)(?:X(\d+))?>>(\d+)$`)
+
+func parseIIOScanType(s string) (t iioScanType, err error) {
+	m := iio_scan_type_re_.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return t, fmt.Errorf("scan type %q: %w", s, ErrInvalidAttribute)
+	}
+	if m[5] != "" && m[5] != "1" {
+		return t, fmt.Errorf("scan type %q, repeated elements: %w", s, ErrNotSupported)
+	}
+	bits, _ := strconv.ParseUint(m[3], 10, 8)
+	storage, _ := strconv.ParseUint(m[4], 10, 8)
+	shift, _ := strconv.ParseUint(m[6], 10, 8)
+	t = iioScanType{big_endian: m[1] == "be", signed: m[2] == "s", bits: uint(bits), storage: uint(storage), shift: uint(shift)}
+	if (storage != 8 && storage != 16 && storage != 32 && storage != 64) || bits == 0 || bits+shift > storage {
+		return t, fmt.Errorf("scan type %q: %w", s, ErrInvalidAttribute)
+	}
+	return t, nil
+}
+
+// the value of the element stored in b, which holds storage bits
+func (t iioScanType) decode(b []byte) int64 {
+	var order binary.ByteOrder = binary.LittleEndian
+	if t.big_endian {
+		order = binary.BigEndian
+	}
+	var v uint64
+	switch t.storage {
+	case 8:
+		v = uint64(b[0])
+	case 16:
+		v = uint64(order.Uint16(b))
+	case 32:
+		v = uint64(order.Uint32(b))
+	default:
+		v = order.Uint64(b)
+	}
+	v >>= t.shift
+	if t.bits < 64 {
+		mask := uint64(1)<<t.bits - 1
+		v &= mask
+		if t.signed && v&(uint64(1)<<(t.bits-1)) != 0 {
+			v |= ^mask
+		}
+	}
+	return int64(v)
+}
+
+type iioScanElement struct {
+	typ    iioScanType
+	index  int // scan_elements/*_index, the order in the scan
+	value  int // index into Sample.Values, -1 for the timestamp
+	offset int // in the scan
+}
+
+// Where the enabled elements are in a scan: ordered by index, each aligned to its storage size,
+// the scan padded to a multiple of the largest one
+type iioScanLayout struct {
+	elements  []iioScanElement
+	size      int
+	timestamp int // of the timestamp in elements, -1 if none
+}
+
+func newIIOScanLayout(elements []iioScanElement) *iioScanLayout {
+	l := &iioScanLayout{elements: append([]iioScanElement(nil), elements...), timestamp: -1}
+	sort.Slice(l.elements, func(i, j int) bool { return l.elements[i].index < l.elements[j].index })
+	largest := 1
+	for i := range l.elements {
+		e := &l.elements[i]
+		n := int(e.typ.storage / 8)
+		if l.size%n != 0 {
+			l.size += n - l.size%n
+		}
+		e.offset = l.size
+		l.size += n
+		if n > largest {
+			largest = n
+		}
+		if e.value < 0 {
+			l.timestamp = i
+		}
+	}
+	if l.size%largest != 0 {
+		l.size += largest - l.size%largest
+	}
+	return l
+}
+
+// demultiplexes one scan into values, returns the timestamp (0 without)
+func (l *iioScanLayout) decode(scan []byte, values []int) (timestamp int64) {
+	for _, e := range l.elements {
+		v := e.typ.decode(scan[e.offset:])
+		if e.value < 0 {
+			timestamp = v
+		} else {
+			values[e.value] = int(v)
+		}
+	}
+	return timestamp
+}
+
+// sysfs attribute of the ADC, trimmed
+func (adc *SysfsADC) readAttr(name string) (string, error) {
+	b, err := os.ReadFile(filepath.Join(adc.dir, name))
+	return strings.TrimSpace(string(b)), err
+}
+
+func (adc *SysfsADC) writeAttr(name, value string) error {
+	f, err := os.OpenFile(filepath.Join(adc.dir, name), os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(value + "\n")
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// the scan element of the attributes <prefix>_index and _type in scan_elements
+func (adc *SysfsADC) scanElement(prefix string, value int) (e iioScanElement, err error) {
+	s, err := adc.readAttr(filepath.Join("scan_elements", prefix+"_index"))
+	if err != nil {
+		return e, err
+	}
+	if e.index, err = strconv.Atoi(s); err != nil {
+		return e, fmt.Errorf("%s_index %q: %w", prefix, s, ErrInvalidAttribute)
+	}
+	if s, err = adc.readAttr(filepath.Join("scan_elements", prefix+"_type")); err != nil {
+		return e, err
+	}
+	e.typ, err = parseIIOScanType(s)
+	e.value = value
+	return e, err
+}
+
+// Samples channels continuously through the IIO buffer and /dev/iio:deviceN, far faster and with less jitter
+// than ReadRaw. sampleRate (Hz) is written to sampling_frequency if the driver has one (the AM335x driver
+// has not, its rate is set in the device tree), it also dates the scans of devices without timestamp channel.
+// samples receives a Sample per scan from a goroutine, without blocking: scans samples has no room for are
+// dropped and counted in Missed of the next one, so give it a buffer. stop ends the capture, disables the
+// buffer and the channels and waits for the goroutine, so does Close. The driver fails ReadRaw while capturing.
+func (adc *SysfsADC) StartBufferedCapture(channels []uint, sampleRate int, samples chan<- Sample) (stop func(), err error) {
+	if len(channels) == 0 || sampleRate < 0 || samples == nil {
+		return nil, errors.New("SysfsADC: capture needs channels, samples and a sample rate >= 0")
+	}
+	adc.lock.Lock()
+	defer adc.lock.Unlock()
+	if adc.capture != nil {
+		return nil, errors.New("SysfsADC: already capturing")
+	}
+	if s, err := adc.readAttr("buffer/enable"); os.IsNotExist(err) {
+		return nil, fmt.Errorf("SysfsADC: iio:device%d has no buffer: %w", adc.Device, ErrNotSupported)
+	} else if err != nil {
+		return nil, fmt.Errorf("SysfsADC: %w", err)
+	} else if s != "0" {
+		return nil, fmt.Errorf("SysfsADC: buffer of iio:device%d in use", adc.Device)
+	}
+	c := &iioCapture{adc: adc, channels: append([]uint(nil), channels...), rate: sampleRate, samples: samples, quit: make(chan struct{}), stopped: make(chan struct{})}
+	elements := make([]iioScanElement, 0, len(channels)+1)
+	for i, channel := range channels {
+		for _, other := range channels[:i] {
+			if other == channel {
+				return nil, fmt.Errorf("SysfsADC: channel %d twice", channel)
+			}
+		}
+		e, err := adc.scanElement(fmt.Sprintf("in_voltage%d", channel), i)
+		if err != nil {
+			return nil, &ADCError{adc.Device, channel, "capture", err}
+		}
+		elements = append(elements, e)
+	}
+	// a timestamp channel if the driver has one
+	if _, err := os.Stat(filepath.Join(adc.dir, "scan_elements", "in_timestamp_en")); err == nil {
+		e, err := adc.scanElement("in_timestamp", -1)
+		if err != nil {
+			return nil, fmt.Errorf("SysfsADC: timestamp: %w", err)
+		}
+		elements = append(elements, e)
+	}
+	c.layout = newIIOScanLayout(elements)
+	c.buffer_length = iio_buffer_min_scans_
+	if sampleRate/5 > c.buffer_length {
+		c.buffer_length = sampleRate / 5
+	}
+	if err = c.configure(); err != nil {
+		c.unconfigure()
+		return nil, err
+	}
+	c.fd, err = unix.Open(filepath.Join(iio_dev_dir_, fmt.Sprintf("iio:device%d", adc.Device)), unix.O_RDONLY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		c.unconfigure()
+		return nil, fmt.Errorf("SysfsADC: %w", err)
+	}
+	var pipe [2]int
+	if err = unix.Pipe2(pipe[:], unix.O_CLOEXEC|unix.O_NONBLOCK); err != nil {
+		unix.Close(c.fd)
+		c.unconfigure()
+		return nil, err
+	}
+	c.stopr, c.stopw = pipe[0], pipe[1]
+	adc.capture = c
+	go c.run()
+	return c.stop, nil
+}
+
+type iioCapture struct {
+	adc           *SysfsADC
+	channels      []uint
+	rate          int
+	samples       chan<- Sample
+	layout        *iioScanLayout
+	buffer_length int
+	fd            int
+	stopr, stopw  int
+	stopping      bool          // guarded by adc.lock
+	quit          chan struct{} // closed by stop
+	stopped       chan struct{}
+	once          sync.Once
+}
+
+// enables the channels (disabling the others) and the buffer
+func (c *iioCapture) configure() error {
+	adc := c.adc
+	ens, _ := filepath.Glob(filepath.Join(adc.dir, "scan_elements", "*_en"))
+	for _, en := range ens {
+		if err := adc.writeAttr(filepath.Join("scan_elements", filepath.Base(en)), "0"); err != nil {
+			return fmt.Errorf("SysfsADC: %w", err)
+		}
+	}
+	for _, e := range c.layout.elements {
+		name := "in_timestamp_en"
+		if e.value >= 0 {
+			name = fmt.Sprintf("in_voltage%d_en", c.channels[e.value])
+		}
+		if err := adc.writeAttr(filepath.Join("scan_elements", name), "1"); err != nil {
+			return fmt.Errorf("SysfsADC: %w", err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(adc.dir, "sampling_frequency")); err == nil && c.rate > 0 {
+		if err = adc.writeAttr("sampling_frequency", strconv.Itoa(c.rate)); err != nil {
+			return fmt.Errorf("SysfsADC: sampling_frequency %d: %w", c.rate, err)
+		}
+	}
+	if err := adc.writeAttr("buffer/length", strconv.Itoa(c.buffer_length)); err != nil {
+		return fmt.Errorf("SysfsADC: %w", err)
+	}
+	if err := adc.writeAttr("buffer/enable", "1"); err != nil {
+		return fmt.Errorf("SysfsADC: enabling the buffer: %w", err)
+	}
+	return nil
+}
+
+// disables the buffer and the channels, best effort
+func (c *iioCapture) unconfigure() {
+	c.adc.writeAttr("buffer/enable", "0")
+	for _, e := range c.layout.elements {
+		name := "in_timestamp_en"
+		if e.value >= 0 {
+			name = fmt.Sprintf("in_voltage%d_en", c.channels[e.value])
+		}
+		c.adc.writeAttr(filepath.Join("scan_elements", name), "0")
+	}
+}
+
+func (c *iioCapture) stop() {
+	c.once.Do(func() {
+		c.adc.lock.Lock()
+		c.stopping = true
+		c.adc.lock.Unlock()
+		close(c.quit)
+		unix.Close(c.stopw)
+		<-c.stopped
+		unix.Close(c.stopr)
+		unix.Close(c.fd)
+		c.unconfigure()
+		c.adc.lock.Lock()
+		c.adc.capture = nil
+		c.adc.lock.Unlock()
+	})
+}
+
+func (c *iioCapture) run() {
+	defer close(c.stopped)
+	// reading as much as the kernel buffer holds tells it was full
+	buf := make([]byte, c.layout.size*c.buffer_length)
+	var period time.Duration
+	if c.rate > 0 {
+		period = time.Second / time.Duration(c.rate)
+	}
+	var carry int // bytes of an incomplete scan at the start of buf
+	var missed uint32
+	var last_ts int64
+	for {
+		n, ok := cdevPollRead(c.fd, c.stopr, -1, buf[carry:])
+		if !ok {
+			c.adc.lock.Lock()
+			stopping := c.stopping
+			c.adc.lock.Unlock()
+			if !stopping {
+				// not dropped, waits for room or stop
+				select {
+				case c.samples <- Sample{Time: time.Now(), Missed: missed, Err: fmt.Errorf("SysfsADC: capture of iio:device%d ended", c.adc.Device)}:
+				case <-c.quit:
+				}
+			}
+			return
+		}
+		read := time.Now()
+		n += carry
+		scans := n / c.layout.size
+		overrun := scans >= c.buffer_length
+		for i := 0; i < scans; i++ {
+			s := Sample{Values: make([]int, len(c.channels)), Missed: missed, Overrun: overrun && i == 0}
+			ts := c.layout.decode(buf[i*c.layout.size:], s.Values)
+			if c.layout.timestamp >= 0 {
+				s.Timestamp, s.Time = time.Duration(ts), time.Unix(0, ts)
+				if last_ts != 0 && period > 0 {
+					if gap := float64(ts-last_ts) / float64(period); gap > 1.5 {
+						s.Missed += uint32(math.Round(gap)) - 1
+					}
+				}
+				last_ts = ts
+			} else {
+				s.Time = read.Add(-time.Duration(scans-1-i) * period)
+			}
+			if c.deliver(s) {
+				missed = 0
+			} else {
+				missed = s.Missed + 1
+			}
+		}
+		carry = copy(buf, buf[scans*c.layout.size:n])
+	}
+}
+
+func (c *iioCapture) deliver(s Sample) bool {
+	select {
+	case c.samples <- s:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,263 @@
+package bbhw
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func Test_ParseIIOScanType(t *testing.T) {
+	for s, expected := range map[string]iioScanType{
+		"le:u12/16>>0":   {bits: 12, storage: 16},
+		"be:s14/16>>2\n": {big_endian: true, signed: true, bits: 14, storage: 16, shift: 2},
+		"le:s64/64>>0":   {signed: true, bits: 64, storage: 64},
+		"le:u24/32X1>>8": {bits: 24, storage: 32, shift: 8},
+	} {
+		if typ, err := parseIIOScanType(s); err != nil || typ != expected {
+			t.Errorf("%q: %+v, %v", s, typ, err)
+		}
+	}
+	for _, s := range []string{"", "le:u12/16", "xe:u12/16>>0", "le:u12/12>>0", "le:u12/16>>8", "le:u0/16>>0"} {
+		if _, err := parseIIOScanType(s); !errors.Is(err, ErrInvalidAttribute) {
+			t.Errorf("%q: %v", s, err)
+		}
+	}
+	if _, err := parseIIOScanType("le:u12/16X2>>0"); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("repeat: %v", err)
+	}
+}
+
+func mustIIOScanType(t *testing.T, s string) iioScanType {
+	typ, err := parseIIOScanType(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return typ
+}
+
+// decodes the captured scans of a fixture in testdata/iio-capture
+func decodeIIOFixture(t *testing.T, name string, l *iioScanLayout, nvalues int) (values [][]int, timestamps []int64) {
+	b, err := os.ReadFile(filepath.Join("testdata", "iio-capture", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b)%l.size != 0 {
+		t.Fatalf("%s: %d bytes are no multiple of scans of %d", name, len(b), l.size)
+	}
+	for ; len(b) > 0; b = b[l.size:] {
+		v := make([]int, nvalues)
+		timestamps = append(timestamps, l.decode(b, v))
+		values = append(values, v)
+	}
+	return values, timestamps
+}
+
+func Test_IIOScanDecode(t *testing.T) {
+	u12 := mustIIOScanType(t, "le:u12/16>>0")
+	ts := mustIIOScanType(t, "le:s64/64>>0")
+
+	// AM335x with channels 0, 2 and 5, passed as 5, 0, 2
+	l := newIIOScanLayout([]iioScanElement{{typ: u12, index: 5, value: 0}, {typ: u12, index: 0, value: 1}, {typ: u12, index: 2, value: 2}})
+	if l.size != 6 || l.timestamp != -1 {
+		t.Errorf("layout %+v", l)
+	}
+	values, _ := decodeIIOFixture(t, "am335x-3ch.bin", l, 3)
+	if expected := [][]int{{4095, 0, 2048}, {4094, 1, 2047}, {89, 1234, 567}, {3000, 4095, 0}}; !reflect.DeepEqual(values, expected) {
+		t.Errorf("am335x-3ch.bin: %v", values)
+	}
+
+	// the timestamp is aligned to 8 bytes
+	l = newIIOScanLayout([]iioScanElement{{typ: ts, index: 8, value: -1}, {typ: u12, index: 0, value: 0}, {typ: u12, index: 1, value: 1}})
+	if l.size != 16 || l.timestamp != 2 || l.elements[2].offset != 8 {
+		t.Errorf("layout %+v", l)
+	}
+	values, timestamps := decodeIIOFixture(t, "timestamp.bin", l, 2)
+	if expected := [][]int{{100, 200}, {101, 201}, {102, 202}, {104, 204}, {105, 205}}; !reflect.DeepEqual(values, expected) {
+		t.Errorf("timestamp.bin: %v", values)
+	}
+	for i, n := range []int64{0, 1, 2, 4, 5} {
+		if timestamps[i] != 1700000000000000000+n*1000000 {
+			t.Errorf("timestamp %d: %d", i, timestamps[i])
+		}
+	}
+
+	// big endian, shifted and signed with junk in the unused bits, padded to the 4 byte element
+	l = newIIOScanLayout([]iioScanElement{
+		{typ: mustIIOScanType(t, "be:s14/16>>2"), index: 0, value: 0},
+		{typ: mustIIOScanType(t, "le:s24/32>>0"), index: 1, value: 1},
+		{typ: mustIIOScanType(t, "le:u8/8>>0"), index: 2, value: 2},
+	})
+	if l.size != 12 || l.elements[1].offset != 4 || l.elements[2].offset != 8 {
+		t.Errorf("layout %+v", l)
+	}
+	values, _ = decodeIIOFixture(t, "mixed.bin", l, 3)
+	if expected := [][]int{{-1, -8388608, 255}, {8191, 8388607, 0}, {-8192, -1, 128}}; !reflect.DeepEqual(values, expected) {
+		t.Errorf("mixed.bin: %v", values)
+	}
+}
+
+// an AM335x with a buffer and optionally a timestamp channel in a temporary tree,
+// its /dev/iio:device0 is a FIFO the test writes scans to
+func useIIOCaptureTree(t *testing.T, timestamp bool) (adc *SysfsADC, attr func(string) string) {
+	dir := t.TempDir()
+	ddir := filepath.Join(dir, "iio:device0")
+	for _, d := range []string{"scan_elements", "buffer"} {
+		if err := os.MkdirAll(filepath.Join(ddir, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{"name": "TI-am335x-adc.0.auto", "buffer/enable": "0", "buffer/length": "0"}
+	for channel := 0; channel < 8; channel++ {
+		files[fmt.Sprintf("in_voltage%d_raw", channel)] = "0"
+		files[fmt.Sprintf("scan_elements/in_voltage%d_en", channel)] = "0"
+		files[fmt.Sprintf("scan_elements/in_voltage%d_index", channel)] = fmt.Sprint(channel)
+		files[fmt.Sprintf("scan_elements/in_voltage%d_type", channel)] = "le:u12/16>>0"
+	}
+	if timestamp {
+		files["scan_elements/in_timestamp_en"] = "0"
+		files["scan_elements/in_timestamp_index"] = "8"
+		files["scan_elements/in_timestamp_type"] = "le:s64/64>>0"
+	}
+	for name, content := range files {
+		os.WriteFile(filepath.Join(ddir, name), []byte(content+"\n"), 0644)
+	}
+	os.Mkdir(filepath.Join(dir, "dev"), 0755)
+	if err := unix.Mkfifo(filepath.Join(dir, "dev", "iio:device0"), 0644); err != nil {
+		t.Skip("no FIFOs:", err)
+	}
+	useIIODir(t, dir)
+	prev := iio_dev_dir_
+	iio_dev_dir_ = filepath.Join(dir, "dev")
+	t.Cleanup(func() { iio_dev_dir_ = prev })
+	adc = NewSysfsADCOrPanic()
+	t.Cleanup(adc.Close)
+	return adc, func(name string) string {
+		b, _ := os.ReadFile(filepath.Join(ddir, name))
+		return strings.TrimSpace(string(b))
+	}
+}
+
+func writeIIOScans(t *testing.T, w *os.File, fixture string) {
+	b, err := os.ReadFile(filepath.Join("testdata", "iio-capture", fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write(b); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func receiveSample(t *testing.T, samples <-chan Sample) Sample {
+	t.Helper()
+	select {
+	case s := <-samples:
+		return s
+	case <-time.After(5 * time.Second):
+		t.Fatal("no sample")
+		return Sample{}
+	}
+}
+
+func Test_SysfsADCBufferedCapture(t *testing.T) {
+	adc, attr := useIIOCaptureTree(t, true)
+	samples := make(chan Sample, 10)
+	stop, err := adc.StartBufferedCapture([]uint{1, 0}, 1000, samples)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]string{"buffer/enable": "1", "buffer/length": "200", "scan_elements/in_voltage0_en": "1",
+		"scan_elements/in_voltage1_en": "1", "scan_elements/in_voltage2_en": "0", "scan_elements/in_timestamp_en": "1"} {
+		if v := attr(name); v != expected {
+			t.Errorf("%s is %s, expected %s", name, v, expected)
+		}
+	}
+	if _, err = adc.StartBufferedCapture([]uint{2}, 1000, samples); err == nil {
+		t.Error("no error starting a second capture")
+	}
+	w, err := os.OpenFile(filepath.Join(iio_dev_dir_, "iio:device0"), os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeIIOScans(t, w, "timestamp.bin")
+	for i, n := range []int64{0, 1, 2, 4, 5} {
+		s := receiveSample(t, samples)
+		expected := Sample{Time: time.Unix(0, 1700000000000000000+n*1000000), Timestamp: time.Duration(1700000000000000000 + n*1000000),
+			Values: []int{200 + int(n), 100 + int(n)}}
+		if n == 4 {
+			expected.Missed = 1
+		}
+		if !reflect.DeepEqual(s, expected) {
+			t.Errorf("sample %d: %+v, expected %+v", i, s, expected)
+		}
+	}
+	// the device going away ends the capture
+	w.Close()
+	if s := receiveSample(t, samples); s.Err == nil || s.Values != nil {
+		t.Errorf("last sample %+v", s)
+	}
+	stop()
+	stop()
+	for _, name := range []string{"buffer/enable", "scan_elements/in_voltage0_en", "scan_elements/in_voltage1_en", "scan_elements/in_timestamp_en"} {
+		if v := attr(name); v != "0" {
+			t.Errorf("%s is %s after stop", name, v)
+		}
+	}
+}
+
+func Test_SysfsADCBufferedCaptureOverruns(t *testing.T) {
+	adc, _ := useIIOCaptureTree(t, false)
+	if _, err := adc.StartBufferedCapture([]uint{0, 8}, 1000, make(chan Sample)); err == nil {
+		t.Error("no error for channel 8")
+	}
+	if _, err := adc.StartBufferedCapture([]uint{0, 0}, 1000, make(chan Sample)); err == nil {
+		t.Error("no error for a channel twice")
+	}
+	samples := make(chan Sample, 2)
+	stop, err := adc.StartBufferedCapture([]uint{0, 2, 5}, 1000, samples)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	w, err := os.OpenFile(filepath.Join(iio_dev_dir_, "iio:device0"), os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	// the capture goroutine handles a write in one go, give it the time to
+	settle := func() { time.Sleep(100 * time.Millisecond) }
+	// 4 scans at once, 2 do not fit into samples
+	writeIIOScans(t, w, "am335x-3ch.bin")
+	settle()
+	first, second := receiveSample(t, samples), receiveSample(t, samples)
+	if !reflect.DeepEqual(first.Values, []int{0, 2048, 4095}) || !reflect.DeepEqual(second.Values, []int{1, 2047, 4094}) ||
+		first.Missed != 0 || first.Overrun || second.Timestamp != 0 {
+		t.Errorf("%+v %+v", first, second)
+	}
+	// dated back from the time read by the sample rate
+	if d := second.Time.Sub(first.Time); d != time.Millisecond {
+		t.Errorf("%v between the samples", d)
+	}
+	writeIIOScans(t, w, "am335x-3ch.bin")
+	settle()
+	if s := receiveSample(t, samples); s.Missed != 2 || s.Values[0] != 0 {
+		t.Errorf("after dropping: %+v", s)
+	}
+	receiveSample(t, samples)
+	// a full kernel buffer is reported, it holds 200ms
+	b, _ := os.ReadFile(filepath.Join("testdata", "iio-capture", "am335x-3ch.bin"))
+	w.Write([]byte(strings.Repeat(string(b[:6]), 200)))
+	settle()
+	if s := receiveSample(t, samples); !s.Overrun || s.Missed != 2 {
+		t.Errorf("no overrun: %+v", s)
+	}
+	if s := receiveSample(t, samples); s.Overrun {
+		t.Errorf("overrun on the second: %+v", s)
+	}
+}
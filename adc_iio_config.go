@@ -0,0 +1,202 @@
+package bbhw
+
+import (
+	"fmt"
+	"math"
+)
+
+// full scale of the AM335x ADC
+const (
+	adc_reference_default_ = 1.8 // V
+	adc_counts_            = 4096
+)
+
+// Maps the voltage at an ADC pin to the voltage of interest, e.g. Scale 11 for a 10k/1k divider
+// in front of the pin. The default is Scale 1, Offset 0.
+type ADCScale struct {
+	Scale  float64 `json:"scale"`
+	Offset float64 `json:"offset_v"` // added after scaling
+}
+
+var adc_scale_default_ = ADCScale{Scale: 1}
+
+// Corrects the voltage at an ADC pin for errors measured on a board, e.g. series resistance or the
+// tolerance of a divider: Gain * (raw * reference / 4096) + Offset. Applied before the ADCScale,
+// the default is Gain 1, Offset 0.
+type Calibration struct {
+	Gain   float64 `json:"gain"`
+	Offset float64 `json:"offset_v"`
+}
+
+var adc_calibration_default_ = Calibration{Gain: 1}
+
+func checkADCReference(volts float64) error {
+	if !(volts > 0) || math.IsInf(volts, 0) {
+		return fmt.Errorf("SysfsADC: reference %vV: %w", volts, ErrOutOfRange)
+	}
+	return nil
+}
+
+// a scale of 0 would map everything to Offset
+func checkADCScale(channel uint, s ADCScale) error {
+	if s.Scale == 0 || math.IsNaN(s.Scale) || math.IsInf(s.Scale, 0) || math.IsNaN(s.Offset) || math.IsInf(s.Offset, 0) {
+		return fmt.Errorf("SysfsADC: scale %v offset %vV of channel %d: %w", s.Scale, s.Offset, channel, ErrOutOfRange)
+	}
+	return nil
+}
+
+// a gain <= 0 would turn the readings upside down or to nothing
+func checkADCCalibration(channel uint, c Calibration) error {
+	if !(c.Gain > 0) || math.IsInf(c.Gain, 0) || math.IsNaN(c.Offset) || math.IsInf(c.Offset, 0) {
+		return fmt.Errorf("SysfsADC: calibration gain %v offset %vV of channel %d: %w", c.Gain, c.Offset, channel, ErrOutOfRange)
+	}
+	return nil
+}
+
+// Sets the calibration of channel for ReadVoltage, ReadMillivolts and ReadFiltered, at any time.
+// SetCalibration(channel, 1, 0) removes it.
+func (adc *SysfsADC) SetCalibration(channel uint, gain, offset float64) error {
+	c := Calibration{Gain: gain, Offset: offset}
+	if err := checkADCCalibration(channel, c); err != nil {
+		return err
+	}
+	adc.lock.Lock()
+	defer adc.lock.Unlock()
+	if c == adc_calibration_default_ {
+		delete(adc.calibrations, channel)
+	} else {
+		adc.calibrations[channel] = c
+	}
+	return nil
+}
+
+// The calibrated channels, a copy
+func (adc *SysfsADC) Calibrations() map[uint]Calibration {
+	adc.lock.Lock()
+	defer adc.lock.Unlock()
+	calibrations := make(map[uint]Calibration, len(adc.calibrations))
+	for channel, c := range adc.calibrations {
+		calibrations[channel] = c
+	}
+	return calibrations
+}
+
+// with lock held
+func (adc *SysfsADC) calibration(channel uint) Calibration {
+	if c, ok := adc.calibrations[channel]; ok {
+		return c
+	}
+	return adc_calibration_default_
+}
+
+// Sets the scale of channel for ReadVoltage and ReadMillivolts, at any time
+func (adc *SysfsADC) SetScale(channel uint, s ADCScale) error {
+	if err := checkADCScale(channel, s); err != nil {
+		return err
+	}
+	adc.lock.Lock()
+	defer adc.lock.Unlock()
+	if s == adc_scale_default_ {
+		delete(adc.scales, channel)
+	} else {
+		adc.scales[channel] = s
+	}
+	return nil
+}
+
+// The scale of channel, the default if none was set
+func (adc *SysfsADC) GetScale(channel uint) ADCScale {
+	adc.lock.Lock()
+	defer adc.lock.Unlock()
+	return adc.scale(channel)
+}
+
+// with lock held
+func (adc *SysfsADC) scale(channel uint) ADCScale {
+	if s, ok := adc.scales[channel]; ok {
+		return s
+	}
+	return adc_scale_default_
+}
+
+// Reads channel and converts it to volts: raw * reference / 4096, calibrated and scaled for the channel
+func (adc *SysfsADC) ReadVoltage(channel uint) (float64, error) {
+	raw, err := adc.ReadRaw(channel)
+	if err != nil {
+		return 0, err
+	}
+	adc.lock.Lock()
+	defer adc.lock.Unlock()
+	return adcVolts(raw, adc.reference, adc.calibration(channel), adc.scale(channel)), nil
+}
+
+// shared by SysfsADC and FakeADC
+func adcVolts(raw int, reference float64, c Calibration, s ADCScale) float64 {
+	pin := float64(raw)*reference/adc_counts_*c.Gain + c.Offset
+	return pin*s.Scale + s.Offset
+}
+
+// ReadVoltage in whole millivolts, rounded to the nearest
+func (adc *SysfsADC) ReadMillivolts(channel uint) (int, error) {
+	v, err := adc.ReadVoltage(channel)
+	return int(math.Round(v * 1000)), err
+}
+
+// Serializable configuration of a SysfsADC, see Snapshot and ApplyConfig
+type ADCConfig struct {
+	Device    uint              `json:"device"` // informational, the device number may differ after a reboot
+	Reference float64           `json:"reference_v"`
+	Scales    map[uint]ADCScale `json:"scales,omitempty"` // channels with another than the default scale
+	// calibrated channels, see SetCalibration
+	Calibrations map[uint]Calibration `json:"calibrations,omitempty"`
+}
+
+// The reference, the scales and the calibrations set, e.g. to store them and ApplyConfig them after a restart
+func (adc *SysfsADC) Snapshot() ADCConfig {
+	adc.lock.Lock()
+	defer adc.lock.Unlock()
+	cfg := ADCConfig{Device: adc.Device, Reference: adc.reference}
+	if len(adc.scales) > 0 {
+		cfg.Scales = make(map[uint]ADCScale, len(adc.scales))
+		for channel, s := range adc.scales {
+			cfg.Scales[channel] = s
+		}
+	}
+	if len(adc.calibrations) > 0 {
+		cfg.Calibrations = make(map[uint]Calibration, len(adc.calibrations))
+		for channel, c := range adc.calibrations {
+			cfg.Calibrations[channel] = c
+		}
+	}
+	return cfg
+}
+
+// Sets the reference, the scales and the calibrations of a configuration returned by Snapshot, channels missing
+// from it go back to the default scale and calibration. Validates everything before changing anything.
+func (adc *SysfsADC) ApplyConfig(cfg ADCConfig) error {
+	if err := checkADCReference(cfg.Reference); err != nil {
+		return err
+	}
+	scales := make(map[uint]ADCScale, len(cfg.Scales))
+	for channel, s := range cfg.Scales {
+		if err := checkADCScale(channel, s); err != nil {
+			return err
+		}
+		if s != adc_scale_default_ {
+			scales[channel] = s
+		}
+	}
+	calibrations := make(map[uint]Calibration, len(cfg.Calibrations))
+	for channel, c := range cfg.Calibrations {
+		if err := checkADCCalibration(channel, c); err != nil {
+			return err
+		}
+		if c != adc_calibration_default_ {
+			calibrations[channel] = c
+		}
+	}
+	adc.lock.Lock()
+	defer adc.lock.Unlock()
+	adc.reference, adc.scales, adc.calibrations = cfg.Reference, scales, calibrations
+	return nil
+}
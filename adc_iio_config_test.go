@@ -0,0 +1,189 @@
+package bbhw
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func newFixtureADC(t *testing.T, opts ...ADCOption) *SysfsADC {
+	useIIODir(t, filepath.Join("testdata", "iio-4.19"))
+	adc, err := NewSysfsADC(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(adc.Close)
+	return adc
+}
+
+func expectADCVoltage(t *testing.T, adc *SysfsADC, channel uint, volts float64, millivolts int) {
+	t.Helper()
+	if v, err := adc.ReadVoltage(channel); err != nil || math.Abs(v-volts) > 1e-9 {
+		t.Errorf("ReadVoltage(%d) = %v, %v, expected %v", channel, v, err, volts)
+	}
+	if mv, err := adc.ReadMillivolts(channel); err != nil || mv != millivolts {
+		t.Errorf("ReadMillivolts(%d) = %d, %v, expected %d", channel, mv, err, millivolts)
+	}
+}
+
+func Test_SysfsADCReadVoltage(t *testing.T) {
+	// raw values of the fixture: 0, 1023, 2048, 4095
+	adc := newFixtureADC(t)
+	expectADCVoltage(t, adc, 0, 0, 0)
+	expectADCVoltage(t, adc, 1, 0.449560546875, 450)
+	expectADCVoltage(t, adc, 2, 0.9, 900)
+	expectADCVoltage(t, adc, 3, 1.799560546875, 1800)
+	// a 10k/1k divider and a channel with an offset
+	if err := adc.SetScale(2, ADCScale{Scale: 11}); err != nil {
+		t.Fatal(err)
+	}
+	if err := adc.SetScale(1, ADCScale{Scale: 2, Offset: -0.1}); err != nil {
+		t.Fatal(err)
+	}
+	expectADCVoltage(t, adc, 2, 9.9, 9900)
+	expectADCVoltage(t, adc, 1, 0.79912109375, 799)
+	expectADCVoltage(t, adc, 3, 1.799560546875, 1800)
+	if s := adc.GetScale(0); s != (ADCScale{Scale: 1}) {
+		t.Errorf("default scale %+v", s)
+	}
+	if err := adc.SetScale(0, ADCScale{}); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("scale 0: %v", err)
+	}
+	if _, err := adc.ReadVoltage(9); err == nil {
+		t.Error("no error for a missing channel")
+	}
+
+	adc = newFixtureADC(t, ADCWithReference(1.65))
+	expectADCVoltage(t, adc, 2, 0.825, 825)
+	if _, err := NewSysfsADC(ADCWithReference(0)); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("reference 0: %v", err)
+	}
+}
+
+func Test_SysfsADCConfig(t *testing.T) {
+	adc := newFixtureADC(t, ADCWithReference(1.65))
+	adc.SetScale(1, ADCScale{Scale: 2, Offset: -0.1})
+	adc.SetScale(2, ADCScale{Scale: 11})
+	adc.SetScale(3, ADCScale{Scale: 3})
+	// back to the default, not part of the configuration any more
+	adc.SetScale(3, ADCScale{Scale: 1})
+	b, err := json.Marshal(adc.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); s != `{"device":0,"reference_v":1.65,"scales":{"1":{"scale":2,"offset_v":-0.1},"2":{"scale":11,"offset_v":0}}}` {
+		t.Error(s)
+	}
+	var cfg ADCConfig
+	if err = json.Unmarshal(b, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	restored := newFixtureADC(t)
+	restored.SetScale(0, ADCScale{Scale: 5})
+	if err = restored.ApplyConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(restored.Snapshot(), adc.Snapshot()) {
+		t.Errorf("%+v, expected %+v", restored.Snapshot(), adc.Snapshot())
+	}
+	expectADCVoltage(t, restored, 2, 9.075, 9075)
+	expectADCVoltage(t, restored, 0, 0, 0)
+
+	// nothing changes if a part is invalid
+	cfg.Scales[0] = ADCScale{Scale: math.NaN()}
+	if err = restored.ApplyConfig(cfg); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("NaN scale: %v", err)
+	}
+	if err = restored.ApplyConfig(ADCConfig{}); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("no reference: %v", err)
+	}
+	if !reflect.DeepEqual(restored.Snapshot(), adc.Snapshot()) {
+		t.Errorf("changed by invalid configurations: %+v", restored.Snapshot())
+	}
+}
+
+func Test_SysfsADCCalibration(t *testing.T) {
+	// raw 2048 of the fixture is 0.9V at the pin with the 1.8V reference
+	adc := newFixtureADC(t)
+	if err := adc.SetCalibration(2, 1.03, -0.01); err != nil {
+		t.Fatal(err)
+	}
+	expectADCVoltage(t, adc, 2, 0.917, 917)
+	// the divider scales the calibrated pin voltage
+	adc.SetScale(2, ADCScale{Scale: 11})
+	expectADCVoltage(t, adc, 2, 10.087, 10087)
+	expectADCVoltage(t, adc, 3, 1.799560546875, 1800)
+	// counts, calibrated the same way
+	adc.SetScale(2, ADCScale{Scale: 1})
+	if v, err := adc.ReadFiltered(2, FilterOpts{Samples: 3}); err != nil || math.Abs(v*1.8/4096-0.917) > 1e-12 {
+		t.Errorf("ReadFiltered %v, %v", v, err)
+	}
+	if v, err := adc.ReadRaw(2); err != nil || v != 2048 {
+		t.Errorf("ReadRaw is calibrated: %v, %v", v, err)
+	}
+
+	// the offset is in volts, the same with another reference
+	adc = newFixtureADC(t, ADCWithReference(1.65))
+	adc.SetCalibration(2, 1.03, -0.01)
+	expectADCVoltage(t, adc, 2, 0.83975, 840)
+	if v, err := adc.ReadFiltered(2, FilterOpts{Filter: FILTER_MEDIAN, Samples: 3}); err != nil || math.Abs(v*1.65/4096-0.83975) > 1e-12 {
+		t.Errorf("ReadFiltered %v, %v", v, err)
+	}
+
+	for _, c := range []Calibration{{Gain: 0}, {Gain: -1}, {Gain: math.Inf(1)}, {Gain: 1, Offset: math.NaN()}} {
+		if err := adc.SetCalibration(1, c.Gain, c.Offset); !errors.Is(err, ErrOutOfRange) {
+			t.Errorf("%+v: %v", c, err)
+		}
+	}
+	adc.SetCalibration(5, 0.98, 0)
+	calibrations := adc.Calibrations()
+	if !reflect.DeepEqual(calibrations, map[uint]Calibration{2: {1.03, -0.01}, 5: {0.98, 0}}) {
+		t.Errorf("%v", calibrations)
+	}
+	delete(calibrations, 2)
+	adc.SetCalibration(5, 1, 0)
+	if calibrations = adc.Calibrations(); !reflect.DeepEqual(calibrations, map[uint]Calibration{2: {1.03, -0.01}}) {
+		t.Errorf("after removing 5: %v", calibrations)
+	}
+}
+
+func Test_SysfsADCCalibrationConfig(t *testing.T) {
+	adc := newFixtureADC(t)
+	adc.SetCalibration(2, 1.02, -0.01)
+	adc.SetScale(2, ADCScale{Scale: 11})
+	b, err := json.Marshal(adc.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); s != `{"device":0,"reference_v":1.8,"scales":{"2":{"scale":11,"offset_v":0}},"calibrations":{"2":{"gain":1.02,"offset_v":-0.01}}}` {
+		t.Error(s)
+	}
+	var cfg ADCConfig
+	if err = json.Unmarshal(b, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	restored := newFixtureADC(t)
+	restored.SetCalibration(1, 2, 0)
+	if err = restored.ApplyConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(restored.Calibrations(), adc.Calibrations()) {
+		t.Errorf("%v", restored.Calibrations())
+	}
+	expectADCVoltage(t, restored, 2, 9.988, 9988)
+	expectADCVoltage(t, restored, 1, 0.449560546875, 450)
+
+	cfg.Calibrations[3] = Calibration{Gain: 0}
+	if err = restored.ApplyConfig(cfg); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("gain 0: %v", err)
+	}
+	// calibrations alone, as stored by an application
+	b, _ = json.Marshal(map[uint]Calibration{4: {Gain: 1.1, Offset: 0.002}})
+	var calibrations map[uint]Calibration
+	if err = json.Unmarshal(b, &calibrations); err != nil || calibrations[4] != (Calibration{1.1, 0.002}) {
+		t.Errorf("%s: %v, %v", b, calibrations, err)
+	}
+}
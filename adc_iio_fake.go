@@ -0,0 +1,326 @@
+package bbhw
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// channels of a FakeADC, like the AM335x ADC
+const fake_adc_channels_ = 8
+
+// One step of a time based FakeADC script: from At after the start of the script the channel reads Value
+type ADCScriptStep struct {
+	At    time.Duration
+	Value int
+}
+
+// Option of NewFakeADC
+type FakeADCOption func(*FakeADC)
+
+// Script times and the delays of ReadFiltered run on c
+func FakeADCWithClock(c Clock) FakeADCOption {
+	return func(adc *FakeADC) { adc.clock = c }
+}
+
+// Adds gaussian noise with a standard deviation of stddev counts to every read, drawn from a generator seeded with seed
+func FakeADCWithNoise(stddev float64, seed int64) FakeADCOption {
+	return func(adc *FakeADC) { adc.noise, adc.rand = stddev, rand.New(rand.NewSource(seed)) }
+}
+
+// Reference voltage of ReadVoltage, default 1.8V like SysfsADC
+func FakeADCWithReference(volts float64) FakeADCOption {
+	return func(adc *FakeADC) { adc.reference = volts }
+}
+
+type fakeADCChannel struct {
+	sequence []int // values of the next reads, the last one stays
+	script   []ADCScriptStep
+	start    time.Time // of script
+	reads    int
+}
+
+// Fake of a SysfsADC for testing controllers reading analog inputs: channels 0 to 7 read 0 until set with SetValue,
+// a per read SetSequence or a time based SetScript (see LoadScript for CSV files). Scales and ReadVoltage work like
+// those of SysfsADC, failures are injected with FailNext and SetFailureRate. Safe for concurrent use.
+type FakeADC struct {
+	Device    uint // shows up in the ADCErrors
+	clock     Clock
+	lock      sync.Mutex // guards everything below
+	channels  [fake_adc_channels_]fakeADCChannel
+	reference float64
+	scales    map[uint]ADCScale
+	noise     float64
+	rand      *rand.Rand
+	closed    bool
+	failures  fakeFailures
+}
+
+// Panics on an invalid reference
+func NewFakeADC(opts ...FakeADCOption) *FakeADC {
+	adc := &FakeADC{reference: adc_reference_default_, scales: make(map[uint]ADCScale)}
+	for i := range adc.channels {
+		adc.channels[i].sequence = []int{0}
+	}
+	for _, opt := range opts {
+		opt(adc)
+	}
+	if err := checkADCReference(adc.reference); err != nil {
+		panic(err)
+	}
+	if adc.clock == nil {
+		adc.clock = defaultClock()
+	}
+	return adc
+}
+
+// panics on values a 12 bit ADC can not return, they are a mistake in the test
+func checkFakeADCValue(channel uint, v int) {
+	if v < 0 || v >= adc_counts_ {
+		panic(fmt.Sprintf("FakeADC: value %d of channel %d outside of 0 to %d", v, channel, adc_counts_-1))
+	}
+}
+
+// the channel, panics for channels a SysfsADC does not have either
+func (adc *FakeADC) channel(channel uint) *fakeADCChannel {
+	if channel >= fake_adc_channels_ {
+		panic(fmt.Sprintf("FakeADC: no channel %d, only 0 to %d", channel, fake_adc_channels_-1))
+	}
+	return &adc.channels[channel]
+}
+
+// channel reads raw from now on
+func (adc *FakeADC) SetValue(channel uint, raw int) {
+	adc.SetSequence(channel, raw)
+}
+
+// Each read of channel returns the next of values, the last one stays
+func (adc *FakeADC) SetSequence(channel uint, values ...int) {
+	if len(values) == 0 {
+		panic("FakeADC: SetSequence without values")
+	}
+	for _, v := range values {
+		checkFakeADCValue(channel, v)
+	}
+	adc.lock.Lock()
+	defer adc.lock.Unlock()
+	c := adc.channel(channel)
+	c.sequence, c.script = append([]int(nil), values...), nil
+}
+
+// From now on channel reads the Value of the last step whose At has passed on the clock, the first step
+// also holds before its time
+func (adc *FakeADC) SetScript(channel uint, steps ...ADCScriptStep) {
+	if len(steps) == 0 {
+		panic("FakeADC: SetScript without steps")
+	}
+	for _, s := range steps {
+		checkFakeADCValue(channel, s.Value)
+	}
+	adc.lock.Lock()
+	defer adc.lock.Unlock()
+	adc.setScript(channel, steps, adc.clock.Now())
+}
+
+// the caller holds lock
+func (adc *FakeADC) setScript(channel uint, steps []ADCScriptStep, start time.Time) {
+	c := adc.channel(channel)
+	c.script, c.sequence, c.start = append([]ADCScriptStep(nil), steps...), nil, start
+	sort.SliceStable(c.script, func(i, j int) bool { return c.script[i].At < c.script[j].At })
+}
+
+// Reads a script of rows "time,channel,value", e.g. "1.5s,2,2048" (or seconds, "1.5"). A header row,
+// empty lines and lines starting with # are skipped. Returns the steps per channel, in the order of time.
+func ParseADCScript(r io.Reader) (map[uint][]ADCScriptStep, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = 3
+	cr.TrimLeadingSpace = true
+	steps := make(map[uint][]ADCScriptStep)
+	for row := 1; ; row++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("ADC script: %w", err)
+		}
+		at, err := parseScriptTime(record[0])
+		channel, cerr := strconv.ParseUint(strings.TrimSpace(record[1]), 10, 32)
+		value, verr := strconv.Atoi(strings.TrimSpace(record[2]))
+		if err != nil || cerr != nil || verr != nil {
+			if row == 1 {
+				continue // header
+			}
+			return nil, fmt.Errorf("ADC script: line %d: %q: %w", row, strings.Join(record, ","), ErrInvalidAttribute)
+		}
+		if channel >= fake_adc_channels_ || value < 0 || value >= adc_counts_ || at < 0 {
+			return nil, fmt.Errorf("ADC script: line %d: %q: %w", row, strings.Join(record, ","), ErrOutOfRange)
+		}
+		steps[uint(channel)] = append(steps[uint(channel)], ADCScriptStep{At: at, Value: value})
+	}
+	for _, s := range steps {
+		sort.SliceStable(s, func(i, j int) bool { return s[i].At < s[j].At })
+	}
+	return steps, nil
+}
+
+// a time.Duration or seconds
+func parseScriptTime(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, nil
+	}
+	secs, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(secs) || math.IsInf(secs, 0) {
+		return 0, ErrInvalidAttribute
+	}
+	return time.Duration(math.Round(secs * float64(time.Second))), nil
+}
+
+// SetScript for every channel in a script of ParseADCScript, all starting now. Other channels are unchanged.
+func (adc *FakeADC) LoadScript(r io.Reader) error {
+	steps, err := ParseADCScript(r)
+	if err != nil {
+		return err
+	}
+	adc.lock.Lock()
+	defer adc.lock.Unlock()
+	start := adc.clock.Now()
+	for channel, s := range steps {
+		adc.setScript(channel, s, start)
+	}
+	return nil
+}
+
+// The next read of channel returns err. Calling it several times makes that many reads fail, before
+// SetFailureRate applies.
+func (adc *FakeADC) FailNext(channel uint, err error) {
+	adc.failures.failNext(fmt.Sprint(channel), err)
+}
+
+// Each read of channel fails with err with the given probability (0 stops failing), see SetFailureSeed
+func (adc *FakeADC) SetFailureRate(channel uint, probability float64, err error) {
+	adc.failures.setRate(fmt.Sprint(channel), probability, err)
+}
+
+// Makes the failures of SetFailureRate reproducible, without a seed they are seeded from the current time
+func (adc *FakeADC) SetFailureSeed(seed int64) {
+	adc.failures.setSeed(seed)
+}
+
+// Successful reads of channel so far, e.g. to check a controller's sampling
+func (adc *FakeADC) Reads(channel uint) int {
+	adc.lock.Lock()
+	defer adc.lock.Unlock()
+	return adc.channel(channel).reads
+}
+
+// The current value of channel with noise, 0 to 4095 like SysfsADC.ReadRaw. Channels from 8 on fail
+// like missing ones of a SysfsADC.
+func (adc *FakeADC) ReadRaw(channel uint) (int, error) {
+	adc.lock.Lock()
+	defer adc.lock.Unlock()
+	if adc.closed {
+		return 0, &ADCError{adc.Device, channel, "open", os.ErrClosed}
+	}
+	if channel >= fake_adc_channels_ {
+		return 0, &ADCError{adc.Device, channel, "open", fmt.Errorf("no such channel: %w", os.ErrNotExist)}
+	}
+	if err := adc.failures.take(fmt.Sprint(channel)); err != nil {
+		return 0, &ADCError{adc.Device, channel, "read", err}
+	}
+	c := &adc.channels[channel]
+	var v int
+	if c.script != nil {
+		elapsed := adc.clock.Now().Sub(c.start)
+		v = c.script[0].Value
+		for _, s := range c.script {
+			if s.At > elapsed {
+				break
+			}
+			v = s.Value
+		}
+	} else {
+		v = c.sequence[0]
+		if len(c.sequence) > 1 {
+			c.sequence = c.sequence[1:]
+		}
+	}
+	if adc.noise > 0 {
+		v += int(math.Round(adc.rand.NormFloat64() * adc.noise))
+		if v < 0 {
+			v = 0
+		} else if v >= adc_counts_ {
+			v = adc_counts_ - 1
+		}
+	}
+	c.reads++
+	return v, nil
+}
+
+// Same as SysfsADC.ReadVoltage of an uncalibrated channel
+func (adc *FakeADC) ReadVoltage(channel uint) (float64, error) {
+	raw, err := adc.ReadRaw(channel)
+	if err != nil {
+		return 0, err
+	}
+	adc.lock.Lock()
+	defer adc.lock.Unlock()
+	return adcVolts(raw, adc.reference, adc_calibration_default_, adc.scale(channel)), nil
+}
+
+// Same as SysfsADC.ReadMillivolts
+func (adc *FakeADC) ReadMillivolts(channel uint) (int, error) {
+	v, err := adc.ReadVoltage(channel)
+	return int(math.Round(v * 1000)), err
+}
+
+// Same as SysfsADC.ReadFiltered, the delays run on the clock
+func (adc *FakeADC) ReadFiltered(channel uint, opts FilterOpts) (float64, error) {
+	return readFiltered(adc.clock, func() (int, error) { return adc.ReadRaw(channel) }, opts)
+}
+
+// Same as SysfsADC.SetScale
+func (adc *FakeADC) SetScale(channel uint, s ADCScale) error {
+	if err := checkADCScale(channel, s); err != nil {
+		return err
+	}
+	adc.lock.Lock()
+	defer adc.lock.Unlock()
+	if s == adc_scale_default_ {
+		delete(adc.scales, channel)
+	} else {
+		adc.scales[channel] = s
+	}
+	return nil
+}
+
+// Same as SysfsADC.GetScale
+func (adc *FakeADC) GetScale(channel uint) ADCScale {
+	adc.lock.Lock()
+	defer adc.lock.Unlock()
+	return adc.scale(channel)
+}
+
+// the caller holds lock
+func (adc *FakeADC) scale(channel uint) ADCScale {
+	if s, ok := adc.scales[channel]; ok {
+		return s
+	}
+	return adc_scale_default_
+}
+
+// Reads fail with os.ErrClosed afterwards
+func (adc *FakeADC) Close() {
+	adc.lock.Lock()
+	defer adc.lock.Unlock()
+	adc.closed = true
+}
@@ -0,0 +1,222 @@
+package bbhw
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func expectFakeADCReads(t *testing.T, adc *FakeADC, channel uint, expected ...int) {
+	t.Helper()
+	for i, e := range expected {
+		if v, err := adc.ReadRaw(channel); err != nil || v != e {
+			t.Errorf("read %d of channel %d: %d, %v, expected %d", i, channel, v, err, e)
+		}
+	}
+}
+
+func Test_FakeADCSequence(t *testing.T) {
+	adc := NewFakeADC()
+	expectFakeADCReads(t, adc, 5, 0, 0)
+	adc.SetSequence(5, 100, 200, 300)
+	expectFakeADCReads(t, adc, 5, 100, 200, 300, 300)
+	adc.SetValue(5, 42)
+	expectFakeADCReads(t, adc, 5, 42, 42)
+	if n := adc.Reads(5); n != 8 {
+		t.Errorf("%d reads", n)
+	}
+	for _, f := range []func(){func() { adc.SetValue(1, 4096) }, func() { adc.SetSequence(1) }, func() { adc.SetValue(8, 0) }} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("no panic")
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+func Test_FakeADCScript(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	adc := NewFakeADC(FakeADCWithClock(clock))
+	adc.SetScript(0, ADCScriptStep{At: time.Second, Value: 2000}, ADCScriptStep{At: 100 * time.Millisecond, Value: 1000})
+	// the first step holds before its time
+	expectFakeADCReads(t, adc, 0, 1000)
+	clock.Advance(999 * time.Millisecond)
+	expectFakeADCReads(t, adc, 0, 1000)
+	clock.Advance(time.Millisecond)
+	expectFakeADCReads(t, adc, 0, 2000)
+	clock.Advance(time.Hour)
+	expectFakeADCReads(t, adc, 0, 2000)
+}
+
+func Test_FakeADCNoise(t *testing.T) {
+	read := func(seed int64) []int {
+		adc := NewFakeADC(FakeADCWithNoise(10, seed))
+		adc.SetValue(0, 2000)
+		adc.SetValue(1, 4090)
+		values := make([]int, 1000)
+		for i := range values {
+			values[i], _ = adc.ReadRaw(0)
+			if v, _ := adc.ReadRaw(1); v > 4095 {
+				t.Fatalf("not clamped: %d", v)
+			}
+		}
+		return values
+	}
+	values := read(7)
+	if !reflect.DeepEqual(values, read(7)) {
+		t.Error("same seed, different noise")
+	}
+	if reflect.DeepEqual(values, read(8)) {
+		t.Error("different seeds, same noise")
+	}
+	floats := make([]float64, len(values))
+	var variance float64
+	for i, v := range values {
+		floats[i] = float64(v)
+		variance += (float64(v) - 2000) * (float64(v) - 2000) / float64(len(values))
+	}
+	if m := filterValues(floats, FILTER_MEAN, 0); math.Abs(m-2000) > 2 {
+		t.Errorf("mean %v", m)
+	}
+	if sd := math.Sqrt(variance); sd < 9 || sd > 11 {
+		t.Errorf("standard deviation %v", sd)
+	}
+}
+
+func Test_FakeADCFailures(t *testing.T) {
+	adc := NewFakeADC()
+	errBus := errors.New("bus error")
+	adc.FailNext(3, errBus)
+	adc.FailNext(3, errBus)
+	var aerr *ADCError
+	for i := 0; i < 2; i++ {
+		if _, err := adc.ReadVoltage(3); !errors.As(err, &aerr) || aerr.Channel != 3 || !errors.Is(err, errBus) {
+			t.Errorf("read %d: %v", i, err)
+		}
+	}
+	expectFakeADCReads(t, adc, 3, 0)
+	if n := adc.Reads(3); n != 1 {
+		t.Errorf("failed reads counted: %d", n)
+	}
+	adc.SetFailureSeed(1)
+	adc.SetFailureRate(2, 0.5, errBus)
+	failed := 0
+	for i := 0; i < 1000; i++ {
+		if _, err := adc.ReadRaw(2); err != nil {
+			failed++
+		}
+	}
+	if failed < 400 || failed > 600 {
+		t.Errorf("%d of 1000 reads failed", failed)
+	}
+	adc.SetFailureRate(2, 0, nil)
+	expectFakeADCReads(t, adc, 2, 0, 0)
+}
+
+const fake_adc_script_ = `time,channel,value
+# warming up
+0s, 0, 100
+0, 1, 4000
+1.5, 0, 300
+500ms, 0, 200
+
+2s, 1, 0
+`
+
+func Test_ParseADCScript(t *testing.T) {
+	steps, err := ParseADCScript(strings.NewReader(fake_adc_script_))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[uint][]ADCScriptStep{
+		0: {{0, 100}, {500 * time.Millisecond, 200}, {1500 * time.Millisecond, 300}},
+		1: {{0, 4000}, {2 * time.Second, 0}},
+	}
+	if !reflect.DeepEqual(steps, expected) {
+		t.Errorf("%v", steps)
+	}
+	for script, expected := range map[string]error{
+		"0,0,100\n1s,x,5\n": ErrInvalidAttribute,
+		"0,0,4096\n":        ErrOutOfRange,
+		"0,8,1\n":           ErrOutOfRange,
+		"-1s,0,1\n":         ErrOutOfRange,
+	} {
+		if _, err := ParseADCScript(strings.NewReader(script)); !errors.Is(err, expected) || !strings.Contains(err.Error(), "line") {
+			t.Errorf("%q: %v, expected %v", script, err, expected)
+		}
+	}
+	if _, err := ParseADCScript(strings.NewReader("0,0,100\n1s,0\n")); err == nil {
+		t.Error("no error for a missing column")
+	}
+	if steps, err := ParseADCScript(strings.NewReader("time,channel,value\n")); err != nil || len(steps) != 0 {
+		t.Errorf("only a header: %v, %v", steps, err)
+	}
+}
+
+func Test_FakeADCLoadScript(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	adc := NewFakeADC(FakeADCWithClock(clock))
+	adc.SetValue(2, 7)
+	if err := adc.LoadScript(strings.NewReader(fake_adc_script_)); err != nil {
+		t.Fatal(err)
+	}
+	for _, step := range []struct {
+		advance time.Duration
+		ch0     int
+		ch1     int
+	}{{0, 100, 4000}, {500 * time.Millisecond, 200, 4000}, {time.Second, 300, 4000}, {500 * time.Millisecond, 300, 0}} {
+		clock.Advance(step.advance)
+		expectFakeADCReads(t, adc, 0, step.ch0)
+		expectFakeADCReads(t, adc, 1, step.ch1)
+	}
+	// not in the script
+	expectFakeADCReads(t, adc, 2, 7)
+	if err := adc.LoadScript(strings.NewReader("0,0,1\n1s,0,x\n")); !errors.Is(err, ErrInvalidAttribute) {
+		t.Errorf("invalid script: %v", err)
+	}
+	expectFakeADCReads(t, adc, 0, 300)
+}
+
+func Test_FakeADCReadFilteredClock(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	adc := NewFakeADC(FakeADCWithClock(clock), FakeADCWithReference(3.3))
+	adc.SetScript(4, ADCScriptStep{0, 1000}, ADCScriptStep{10 * time.Millisecond, 3000})
+	done := make(chan float64, 1)
+	afterTimer(t, clock, func() {
+		go func() {
+			v, _ := adc.ReadFiltered(4, FilterOpts{Samples: 2, Delay: 10 * time.Millisecond})
+			done <- v
+		}()
+	})
+	clock.Advance(10 * time.Millisecond)
+	if v := <-done; v != 2000 {
+		t.Errorf("mean %v", v)
+	}
+	adc.SetValue(4, 2048)
+	if mv, err := adc.ReadMillivolts(4); err != nil || mv != 1650 {
+		t.Errorf("%d mV with 3.3V reference, %v", mv, err)
+	}
+}
+
+func Test_ToLegacyADC(t *testing.T) {
+	adc := NewFakeADC()
+	legacy := ToLegacyADC(adc, 3)
+	adc.SetValue(3, 2048)
+	if v, err := legacy.ReadValueCheckError(); err != nil || v != 900 {
+		t.Errorf("%d mV, %v", v, err)
+	}
+	failure := errors.New("read failed")
+	adc.FailNext(3, failure)
+	if v := legacy.ReadValue(); !errors.Is(legacy.CheckErrorOccurred(), failure) {
+		t.Errorf("failed read: %d, %v", v, legacy.CheckErrorOccurred())
+	}
+	if _, err := legacy.ReadValueCheckError(); err != nil {
+		t.Errorf("next read: %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package bbhw
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Returned by ReadAll if some channels could not be read, the others are in the returned map
+type ADCReadAllError struct {
+	Errors map[uint]error // per failed channel
+}
+
+func (e *ADCReadAllError) Error() string {
+	channels := make([]uint, 0, len(e.Errors))
+	for channel := range e.Errors {
+		channels = append(channels, channel)
+	}
+	sort.Slice(channels, func(i, j int) bool { return channels[i] < channels[j] })
+	msgs := make([]string, len(channels))
+	for i, channel := range channels {
+		msgs[i] = e.Errors[channel].Error()
+	}
+	return fmt.Sprintf("reading %d channels failed: %s", len(msgs), strings.Join(msgs, "; "))
+}
+
+// errors.Is and errors.As look at all the per-channel errors
+func (e *ADCReadAllError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// Reads the raw values of channels back to back: the files are opened together (and kept open like those of
+// ReadRaw), then read into one buffer, so the reads are as close in time as the sysfs interface allows.
+// A failing channel does not stop the others, the error is an *ADCReadAllError listing the failed ones.
+func (adc *SysfsADC) ReadAll(channels []uint) (map[uint]int, error) {
+	files := make([]*os.File, len(channels))
+	var errs map[uint]error // allocated on the first failure
+	fail := func(channel uint, err error) {
+		if errs == nil {
+			errs = make(map[uint]error)
+		}
+		errs[channel] = err
+	}
+	adc.lock.Lock()
+	for i, channel := range channels {
+		f, err := adc.openFile(channel)
+		if err != nil {
+			fail(channel, err)
+		}
+		files[i] = f
+	}
+	adc.lock.Unlock()
+	values := make(map[uint]int, len(channels))
+	var buf [32]byte
+	for i, channel := range channels {
+		if files[i] == nil {
+			continue
+		}
+		v, err := adc.readRaw(files[i], channel, buf[:])
+		if err != nil {
+			fail(channel, err)
+			continue
+		}
+		values[channel] = v
+	}
+	if len(errs) > 0 {
+		return values, &ADCReadAllError{errs}
+	}
+	return values, nil
+}
+
+// Like ReadAll, but takes one scan of channels through the IIO buffer, so all values are converted in the same
+// sequencer run of the ADC. Costs a StartBufferedCapture and its stop, fails with ErrNotSupported if the device has no buffer.
+func (adc *SysfsADC) ReadAllBuffered(channels []uint, timeout time.Duration) (map[uint]int, error) {
+	samples := make(chan Sample, 1)
+	stop, err := adc.StartBufferedCapture(channels, 0, samples)
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+	select {
+	case s := <-samples:
+		if s.Err != nil {
+			return nil, s.Err
+		}
+		values := make(map[uint]int, len(channels))
+		for i, channel := range channels {
+			values[channel] = s.Values[i]
+		}
+		return values, nil
+	case <-adc.clock.After(timeout):
+		return nil, fmt.Errorf("SysfsADC: no scan from the buffer within %v", timeout)
+	}
+}
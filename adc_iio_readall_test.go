@@ -0,0 +1,110 @@
+package bbhw
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var ain_channels_ = []uint{0, 1, 2, 3, 4, 5, 6}
+
+func Test_SysfsADCReadAll(t *testing.T) {
+	adc := newFixtureADC(t)
+	values, err := adc.ReadAll(ain_channels_)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[uint]int{0: 0, 1: 1023, 2: 2048, 3: 4095, 4: 17, 5: 3000, 6: 1500}; !reflect.DeepEqual(values, expected) {
+		t.Errorf("%v", values)
+	}
+	// the missing channels do not stop the others
+	values, err = adc.ReadAll([]uint{9, 2, 8})
+	var rerr *ADCReadAllError
+	if !errors.As(err, &rerr) || len(rerr.Errors) != 2 || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("%v", err)
+	}
+	if !reflect.DeepEqual(values, map[uint]int{2: 2048}) {
+		t.Errorf("%v", values)
+	}
+	if s := err.Error(); s != fmt.Sprintf("reading 2 channels failed: %v; %v", rerr.Errors[8], rerr.Errors[9]) {
+		t.Error(s)
+	}
+	if _, err = adc.ReadAllBuffered([]uint{0}, time.Second); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("ReadAllBuffered without buffer: %v", err)
+	}
+}
+
+func Test_SysfsADCReadAllBuffered(t *testing.T) {
+	adc, attr := useIIOCaptureTree(t, false)
+	type result struct {
+		values map[uint]int
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		values, err := adc.ReadAllBuffered([]uint{0, 2, 5}, 5*time.Second)
+		done <- result{values, err}
+	}()
+	// blocks until the capture opened the device
+	w, err := os.OpenFile(filepath.Join(iio_dev_dir_, "iio:device0"), os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	writeIIOScans(t, w, "am335x-3ch.bin")
+	r := <-done
+	if r.err != nil || !reflect.DeepEqual(r.values, map[uint]int{0: 0, 2: 2048, 5: 4095}) {
+		t.Errorf("%v, %v", r.values, r.err)
+	}
+	if v := attr("buffer/enable"); v != "0" {
+		t.Errorf("buffer/enable is %s afterwards", v)
+	}
+	if _, err = adc.ReadAllBuffered([]uint{1}, 10*time.Millisecond); err == nil {
+		t.Error("no error without a scan")
+	}
+}
+
+// opening, reading and closing the attribute every time
+func Benchmark_ADCNaiveReads(b *testing.B) {
+	dir := filepath.Join("testdata", "iio-4.19", "iio:device0")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, channel := range ain_channels_ {
+			if _, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("in_voltage%d_raw", channel))); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func Benchmark_SysfsADCReadRaw(b *testing.B) {
+	useIIODir(b, filepath.Join("testdata", "iio-4.19"))
+	adc := NewSysfsADCOrPanic()
+	defer adc.Close()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, channel := range ain_channels_ {
+			if _, err := adc.ReadRaw(channel); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func Benchmark_SysfsADCReadAll(b *testing.B) {
+	useIIODir(b, filepath.Join("testdata", "iio-4.19"))
+	adc := NewSysfsADCOrPanic()
+	defer adc.Close()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := adc.ReadAll(ain_channels_); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package bbhw
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// point SysfsADC to a fixture tree in testdata, or any other directory
+func useIIODir(t testing.TB, dir string) {
+	prev := sysfs_iio_base_
+	sysfs_iio_base_ = dir
+	t.Cleanup(func() { sysfs_iio_base_ = prev })
+}
+
+func Test_SysfsADCReadRaw(t *testing.T) {
+	values := []int{0, 1023, 2048, 4095, 17, 3000, 1500, 2250}
+	for dir, device := range map[string]uint{"iio-4.19": 0, "iio-5.10": 1} {
+		useIIODir(t, filepath.Join("testdata", dir))
+		adc, err := NewSysfsADC()
+		if err != nil {
+			t.Fatal(dir, err)
+		}
+		if adc.Device != device {
+			t.Errorf("%s: found iio:device%d", dir, adc.Device)
+		}
+		for channel := uint(0); channel < 8; channel++ {
+			expected := values[channel]
+			if device == 1 {
+				// the 5.10 fixture has them the other way round
+				expected = values[7-channel]
+			}
+			// twice, the second read uses the open file
+			for i := 0; i < 2; i++ {
+				if v, err := adc.ReadRaw(channel); err != nil || v != expected {
+					t.Errorf("%s: ReadRaw(%d) = %d, %v, expected %d", dir, channel, v, err, expected)
+				}
+			}
+		}
+		var aerr *ADCError
+		if _, err = adc.ReadRaw(8); !errors.As(err, &aerr) || aerr.Channel != 8 || !os.IsNotExist(errors.Unwrap(aerr.Err)) {
+			t.Errorf("%s: ReadRaw(8): %v", dir, err)
+		}
+		adc.Close()
+		if _, err = adc.ReadRaw(0); !errors.Is(err, os.ErrClosed) {
+			t.Errorf("%s: ReadRaw after Close: %v", dir, err)
+		}
+	}
+}
+
+func Test_SysfsADCParsing(t *testing.T) {
+	dir := t.TempDir()
+	ddir := filepath.Join(dir, "iio:device2")
+	os.Mkdir(ddir, 0755)
+	os.WriteFile(filepath.Join(ddir, "name"), []byte("TI-am335x-adc.0.auto\n"), 0644)
+	for file, content := range map[string]string{"in_voltage0_raw": " 42 \n", "in_voltage1_raw": "", "in_voltage2_raw": "4x\n"} {
+		os.WriteFile(filepath.Join(ddir, file), []byte(content), 0644)
+	}
+	useIIODir(t, dir)
+	adc := NewSysfsADCOrPanic()
+	defer adc.Close()
+	if v, err := adc.ReadRaw(0); err != nil || v != 42 {
+		t.Errorf("ReadRaw(0) = %d, %v", v, err)
+	}
+	for _, channel := range []uint{1, 2} {
+		if _, err := adc.ReadRaw(channel); !errors.Is(err, ErrInvalidAttribute) {
+			t.Errorf("ReadRaw(%d): %v", channel, err)
+		}
+	}
+}
+
+func Test_SysfsADCMissing(t *testing.T) {
+	// only an I2C sensor, the ADC overlay is not loaded
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "iio:device0"), 0755)
+	os.WriteFile(filepath.Join(dir, "iio:device0", "name"), []byte("bmp280\n"), 0644)
+	useIIODir(t, dir)
+	_, err := NewSysfsADC()
+	if err == nil {
+		t.Fatal("no error without the ADC")
+	}
+	for _, s := range []string{"TI-am335x-adc", "BB-ADC", "iio:device0 (bmp280)"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("error %q does not mention %s", err, s)
+		}
+	}
+	useIIODir(t, filepath.Join(dir, "missing"))
+	if _, err = NewSysfsADC(); err == nil || !strings.Contains(err.Error(), "no IIO devices") {
+		t.Errorf("without IIO: %v", err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("NewSysfsADCOrPanic did not panic")
+		}
+	}()
+	NewSysfsADCOrPanic()
+}
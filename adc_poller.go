@@ -0,0 +1,186 @@
+package bbhw
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// One poll of an ADCPoller
+type ADCUpdate struct {
+	Time   time.Time
+	Values map[uint]float64 // volts of the channels read, as ReadVoltage returns them, shared by the subscribers
+	Errors map[uint]error   // of the channels that failed, nil if none did
+}
+
+// Option of NewADCPoller
+type ADCPollerOption func(*ADCPoller)
+
+// polls on c
+func ADCPollerWithClock(c Clock) ADCPollerOption {
+	return func(p *ADCPoller) { p.clock = c }
+}
+
+// Logs the failed reads to l instead of the package Logger, see SetLogger
+func ADCPollerWithLogger(l Logger) ADCPollerOption {
+	return func(p *ADCPoller) { p.logger = l }
+}
+
+// Reads a set of channels of an ADC every interval on its own goroutine and publishes the values, e.g. for a
+// dashboard refreshing at 5 Hz, so the consumers share the reads instead of each doing their own. Latest has
+// the last values, Subscribe delivers every poll. A failed read is logged at LOG_WARN and polling goes on,
+// the channel keeps its last value in Latest and ConsecutiveErrors counts the polls failing in a row.
+type ADCPoller struct {
+	adc         ADC
+	channels    []uint
+	interval    time.Duration
+	clock       Clock
+	logger      Logger
+	lock        sync.Mutex // guards everything below
+	latest      map[uint]float64
+	errors      int // consecutive polls with a failed read
+	subscribers map[chan ADCUpdate]struct{}
+	stopping    bool
+	stop        chan struct{}
+	stopped     chan struct{}
+	once        sync.Once
+}
+
+// Reads channels right away and then every interval
+func NewADCPoller(adc ADC, channels []uint, interval time.Duration, opts ...ADCPollerOption) (*ADCPoller, error) {
+	if adc == nil {
+		panic("adc == nil")
+	}
+	if interval <= 0 || len(channels) == 0 {
+		return nil, fmt.Errorf("ADCPoller: interval %v with %d channels: %w", interval, len(channels), ErrOutOfRange)
+	}
+	p := &ADCPoller{adc: adc, channels: append([]uint(nil), channels...), interval: interval,
+		latest: make(map[uint]float64), subscribers: make(map[chan ADCUpdate]struct{}),
+		stop: make(chan struct{}), stopped: make(chan struct{})}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.clock == nil {
+		p.clock = defaultClock()
+	}
+	go p.run()
+	return p, nil
+}
+
+// A copy of the last value read of each channel, channels never read successfully are missing
+func (p *ADCPoller) Latest() map[uint]float64 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	latest := make(map[uint]float64, len(p.latest))
+	for channel, v := range p.latest {
+		latest[channel] = v
+	}
+	return latest
+}
+
+// Polls in a row in which a read failed, 0 after a poll without failures
+func (p *ADCPoller) ConsecutiveErrors() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.errors
+}
+
+// Delivers the update of every poll from now on. Up to buffer updates are queued (at least 1), then the oldest
+// ones are dropped, so a slow subscriber does not hold up the polling. cancel ends the subscription and closes
+// the channel, so does Stop.
+func (p *ADCPoller) Subscribe(buffer int) (updates <-chan ADCUpdate, cancel func()) {
+	if buffer < 1 {
+		buffer = 1
+	}
+	ch := make(chan ADCUpdate, buffer)
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.stopping {
+		close(ch)
+		return ch, func() {}
+	}
+	p.subscribers[ch] = struct{}{}
+	return ch, func() {
+		p.lock.Lock()
+		defer p.lock.Unlock()
+		if _, ok := p.subscribers[ch]; ok {
+			delete(p.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Stops polling, waits for a poll in progress and closes the channels of the subscribers. Latest keeps the last values.
+func (p *ADCPoller) Stop() {
+	p.once.Do(func() { close(p.stop) })
+	<-p.stopped
+}
+
+func (p *ADCPoller) run() {
+	defer close(p.stopped)
+	next := p.clock.Now()
+	for {
+		p.poll(next)
+		next = next.Add(p.interval)
+		select {
+		case <-p.stop:
+			p.lock.Lock()
+			defer p.lock.Unlock()
+			p.stopping = true
+			for ch := range p.subscribers {
+				delete(p.subscribers, ch)
+				close(ch)
+			}
+			return
+		case <-p.clock.After(next.Sub(p.clock.Now())):
+		}
+	}
+}
+
+func (p *ADCPoller) poll(now time.Time) {
+	update := ADCUpdate{Time: now, Values: make(map[uint]float64, len(p.channels))}
+	for _, channel := range p.channels {
+		v, err := p.adc.ReadVoltage(channel)
+		if err != nil {
+			if update.Errors == nil {
+				update.Errors = make(map[uint]error)
+			}
+			update.Errors[channel] = err
+			continue
+		}
+		update.Values[channel] = v
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for channel, v := range update.Values {
+		p.latest[channel] = v
+	}
+	if update.Errors == nil {
+		p.errors = 0
+	} else {
+		p.errors++
+		for _, channel := range p.channels {
+			if err, ok := update.Errors[channel]; ok {
+				loggerOr(p.logger).Log(LOG_WARN, "ADCPoller: read failed", "channel", channel, "error", err, "consecutive", p.errors)
+			}
+		}
+	}
+	for ch := range p.subscribers {
+		publishADCUpdate(ch, update)
+	}
+}
+
+// sends u to ch, dropping the oldest queued updates if it is full. The caller holds lock, so nobody else sends.
+func publishADCUpdate(ch chan ADCUpdate, u ADCUpdate) {
+	for {
+		select {
+		case ch <- u:
+			return
+		default:
+		}
+		select {
+		case <-ch:
+		default:
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package bbhw
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_ADCPoller(t *testing.T) {
+	start := time.Unix(1000, 0)
+	clock := NewManualClock(start)
+	// with a reference of 4096V a volt is a count
+	adc := NewFakeADC(FakeADCWithClock(clock), FakeADCWithReference(4096))
+	adc.SetSequence(0, 100, 200, 300)
+	adc.SetSequence(2, 1000, 2000)
+	var p *ADCPoller
+	var updates <-chan ADCUpdate
+	afterTimer(t, clock, func() {
+		var err error
+		if p, err = NewADCPoller(adc, []uint{0, 2}, 200*time.Millisecond, ADCPollerWithClock(clock)); err != nil {
+			t.Fatal(err)
+		}
+	})
+	defer p.Stop()
+	// the first poll ran before the subscription
+	if latest := p.Latest(); !reflect.DeepEqual(latest, map[uint]float64{0: 100, 2: 1000}) {
+		t.Errorf("latest %v", latest)
+	}
+	updates, cancel := p.Subscribe(4)
+	clock.Advance(199 * time.Millisecond)
+	if n := adc.Reads(0); n != 1 {
+		t.Errorf("%d reads before the interval", n)
+	}
+	afterTimer(t, clock, func() { clock.Advance(time.Millisecond) })
+	u := <-updates
+	if !u.Time.Equal(start.Add(200*time.Millisecond)) || !reflect.DeepEqual(u.Values, map[uint]float64{0: 200, 2: 2000}) || u.Errors != nil {
+		t.Errorf("update %+v", u)
+	}
+	afterTimer(t, clock, func() { clock.Advance(200 * time.Millisecond) })
+	if u := <-updates; !reflect.DeepEqual(u.Values, map[uint]float64{0: 300, 2: 2000}) {
+		t.Errorf("update %+v", u)
+	}
+	if n := adc.Reads(0); n != 3 {
+		t.Errorf("%d reads after 2 intervals", n)
+	}
+	// the returned map is a copy
+	p.Latest()[0] = -1
+	if v := p.Latest()[0]; v != 300 {
+		t.Errorf("latest %v", v)
+	}
+	cancel()
+	cancel()
+	if _, ok := <-updates; ok {
+		t.Error("update after cancel")
+	}
+}
+
+func Test_ADCPollerErrors(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	adc := NewFakeADC(FakeADCWithClock(clock), FakeADCWithReference(4096))
+	adc.SetSequence(1, 10, 20, 30, 40)
+	adc.SetValue(3, 7)
+	logger := new(recordingLogger)
+	errBus := errors.New("bus error")
+	adc.FailNext(1, errBus)
+	var p *ADCPoller
+	afterTimer(t, clock, func() {
+		p, _ = NewADCPoller(adc, []uint{1, 3}, time.Second, ADCPollerWithClock(clock), ADCPollerWithLogger(logger))
+	})
+	updates, _ := p.Subscribe(8)
+	// the channel without a value yet is missing
+	if latest := p.Latest(); !reflect.DeepEqual(latest, map[uint]float64{3: 7}) || p.ConsecutiveErrors() != 1 {
+		t.Errorf("latest %v, %d errors", latest, p.ConsecutiveErrors())
+	}
+	adc.FailNext(1, errBus)
+	afterTimer(t, clock, func() { clock.Advance(time.Second) })
+	u := <-updates
+	if !errors.Is(u.Errors[1], errBus) || len(u.Errors) != 1 || !reflect.DeepEqual(u.Values, map[uint]float64{3: 7}) {
+		t.Errorf("update %+v", u)
+	}
+	if n := p.ConsecutiveErrors(); n != 2 {
+		t.Errorf("%d consecutive errors", n)
+	}
+	if !logger.contains("ADCPoller: read failed [channel 1") || !logger.contains("consecutive 2") {
+		t.Errorf("logged %v", logger.lines)
+	}
+	// polling goes on and a good poll resets the counter
+	afterTimer(t, clock, func() { clock.Advance(time.Second) })
+	if u := <-updates; u.Errors != nil || u.Values[1] != 10 {
+		t.Errorf("update %+v", u)
+	}
+	if n := p.ConsecutiveErrors(); n != 0 {
+		t.Errorf("%d consecutive errors after a good poll", n)
+	}
+	adc.FailNext(1, errBus)
+	afterTimer(t, clock, func() { clock.Advance(time.Second) })
+	<-updates
+	p.Stop()
+	// the failed channel keeps its last value
+	if latest := p.Latest(); latest[1] != 10 || p.ConsecutiveErrors() != 1 {
+		t.Errorf("latest %v, %d errors", latest, p.ConsecutiveErrors())
+	}
+	if _, ok := <-updates; ok {
+		t.Error("subscription open after Stop")
+	}
+	clock.Advance(time.Hour)
+	if n := adc.Reads(3); n != 4 {
+		t.Errorf("%d reads after Stop", n)
+	}
+	p.Stop()
+	if updates, cancel := p.Subscribe(1); func() bool { _, ok := <-updates; return ok }() {
+		t.Error("subscription after Stop")
+	} else {
+		cancel()
+	}
+
+	if _, err := NewADCPoller(adc, nil, time.Second); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("no channels: %v", err)
+	}
+	if _, err := NewADCPoller(adc, []uint{0}, 0); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("interval 0: %v", err)
+	}
+}
+
+func Test_ADCPollerSlowSubscriber(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	adc := NewFakeADC(FakeADCWithClock(clock), FakeADCWithReference(4096))
+	adc.SetSequence(0, 1, 2, 3, 4, 5)
+	var p *ADCPoller
+	var updates <-chan ADCUpdate
+	afterTimer(t, clock, func() {
+		p, _ = NewADCPoller(adc, []uint{0}, time.Second, ADCPollerWithClock(clock))
+		updates, _ = p.Subscribe(2)
+	})
+	defer p.Stop()
+	for i := 0; i < 4; i++ {
+		afterTimer(t, clock, func() { clock.Advance(time.Second) })
+	}
+	// the oldest updates were dropped, the polling went on
+	for _, expected := range []float64{4, 5} {
+		if u := <-updates; u.Values[0] != expected {
+			t.Errorf("%v, expected %v", u.Values[0], expected)
+		}
+	}
+}
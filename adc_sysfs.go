@@ -8,17 +8,23 @@ import (
 	"strconv"
 )
 
-// SysFS managed ADCs ------------------------------------
+// ADC inputs of the helper driver of 3.8 kernels ------------------------------------
 
-type SysfsADC struct {
+// ADC input of the helper driver of 3.8 kernels, current kernels need SysfsADC.
+// It was named SysfsADC, created by NewSysfsADC(number), before SysfsADC moved to IIO.
+//
+// Deprecated: use SysfsADC, the helper driver only exists in 3.8 kernels.
+type BBBLegacyADC struct {
 	Number uint
 	fd     *os.File
 	err    error
 }
 
-// Instantinate a new ADC to read through sysfs. Takes ADC AIN numer (same as in sysfs)
-func NewSysfsADC(number uint) (adc *SysfsADC, err error) {
-	adc = new(SysfsADC)
+// Instantinate a new ADC to read through the helper driver of 3.8 kernels. Takes ADC AIN numer (same as in sysfs)
+//
+// Deprecated: use NewSysfsADC, see BBBLegacyADC.
+func NewBBBLegacyADC(number uint) (adc *BBBLegacyADC, err error) {
+	adc = new(BBBLegacyADC)
 	adc.Number = number
 	ain := fmt.Sprintf("AIN%d", number)
 
@@ -36,10 +42,12 @@ func NewSysfsADC(number uint) (adc *SysfsADC, err error) {
 	return adc, nil
 }
 
-// Wrapper around NewSysfsGPIO. Does not return an error but panics instead. Useful to avoid multiple return values.
+// Wrapper around NewBBBLegacyADC. Does not return an error but panics instead. Useful to avoid multiple return values.
 // This is the function with the same signature as all the other New*GPIO*s
-func NewSysfsADCOrPanic(number uint) (adc *SysfsADC) {
-	adc, err := NewSysfsADC(number)
+//
+// Deprecated: use NewSysfsADCOrPanic, see BBBLegacyADC.
+func NewBBBLegacyADCOrPanic(number uint) (adc *BBBLegacyADC) {
+	adc, err := NewBBBLegacyADC(number)
 	if err != nil {
 		panic(err)
 	}
@@ -48,7 +56,7 @@ func NewSysfsADCOrPanic(number uint) (adc *SysfsADC) {
 
 //returns raw SysFs Value.
 // In case of BeagleBoneBlack that means actual measured voltage in mV
-func (adc *SysfsADC) ReadValue() (value uint16) {
+func (adc *BBBLegacyADC) ReadValue() (value uint16) {
 	if adc == nil {
 		panic("adc == nil")
 	}
@@ -72,14 +80,14 @@ func (adc *SysfsADC) ReadValue() (value uint16) {
 	return uint16(value64)
 }
 
-func (adc *SysfsADC) CheckErrorOccurred() error {
+func (adc *BBBLegacyADC) CheckErrorOccurred() error {
 	if adc == nil {
 		panic("adc == nil")
 	}
 	return adc.err
 }
 
-func (adc *SysfsADC) ReadValueCheckError() (value uint16, err error) {
+func (adc *BBBLegacyADC) ReadValueCheckError() (value uint16, err error) {
 	value = adc.ReadValue()
 	err = adc.CheckErrorOccurred()
 	return
@@ -0,0 +1,197 @@
+package bbhw
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// A level an ADCWatcher watches Channel for. The value has to rise above Level + Hysteresis/2 to cross
+// rising and fall below Level - Hysteresis/2 to cross falling, values inside the band (edges included)
+// cross nothing, so a noisy value near Level does not chatter.
+type ADCThreshold struct {
+	Channel    uint
+	Level      float64 // volts as ReadVoltage returns them, the scale of the channel applies
+	Hysteresis float64 // width of the band around Level, >= 0
+	Edge       Edge    // crossings reported: RISING, FALLING or BOTH
+}
+
+func (th ADCThreshold) check() error {
+	if math.IsNaN(th.Level) || math.IsInf(th.Level, 0) || !(th.Hysteresis >= 0) || math.IsInf(th.Hysteresis, 0) {
+		return fmt.Errorf("ADCWatcher: level %vV, hysteresis %vV of channel %d: %w", th.Level, th.Hysteresis, th.Channel, ErrOutOfRange)
+	}
+	if th.Edge != RISING && th.Edge != FALLING && th.Edge != BOTH {
+		return fmt.Errorf("ADCWatcher: edge %v of channel %d: %w", th.Edge, th.Channel, ErrNotSupported)
+	}
+	return nil
+}
+
+// A crossing of an ADCThreshold, or a failed read if Err is set
+type ADCEvent struct {
+	Channel   uint
+	Value     float64      // volts that crossed
+	Threshold ADCThreshold // the one crossed
+	Edge      Edge         // RISING or FALLING
+	Time      time.Time
+	Err       error // the read of Channel failed, Value, Threshold and Edge are meaningless
+}
+
+// Option of NewADCWatcher
+type ADCWatcherOption func(*ADCWatcher)
+
+// polls on c
+func ADCWatcherWithClock(c Clock) ADCWatcherOption {
+	return func(w *ADCWatcher) { w.clock = c }
+}
+
+// calls fn for every event (on the goroutine of the ADCWatcher) instead of sending it to Events
+func ADCWatcherWithCallback(fn func(ADCEvent)) ADCWatcherOption {
+	return func(w *ADCWatcher) { w.callback = fn }
+}
+
+// events queued on Events before the oldest ones are dropped
+const adc_watcher_queue_ = 16
+
+// where the value of a threshold's channel is
+const (
+	adc_side_unread_ = iota
+	adc_side_band_   // inside the band since the first read
+	adc_side_below_
+	adc_side_above_
+)
+
+// Polls channels of an ADC and reports when their values cross thresholds, e.g. a 24V rail (read through
+// a divider, see SetScale) dropping below 21V:
+//
+//	NewADCWatcher(adc, 100*time.Millisecond, []ADCThreshold{{Channel: 0, Level: 21, Hysteresis: 0.5, Edge: FALLING}})
+type ADCWatcher struct {
+	adc        ADC
+	interval   time.Duration
+	thresholds []ADCThreshold
+	channels   []uint // of thresholds, each once
+	sides      []int  // of thresholds
+	clock      Clock
+	callback   func(ADCEvent)
+	events     chan ADCEvent
+	stop       chan struct{}
+	stopped    chan struct{}
+	once       sync.Once
+}
+
+// Reads the channels of thresholds every interval. The first value of a channel only tells on which side of
+// each threshold it starts, without event. Starting inside the band, leaving it to either side is reported.
+func NewADCWatcher(adc ADC, interval time.Duration, thresholds []ADCThreshold, opts ...ADCWatcherOption) (*ADCWatcher, error) {
+	if adc == nil {
+		panic("adc == nil")
+	}
+	if interval <= 0 || len(thresholds) == 0 {
+		return nil, fmt.Errorf("ADCWatcher: interval %v with %d thresholds: %w", interval, len(thresholds), ErrOutOfRange)
+	}
+	w := &ADCWatcher{adc: adc, interval: interval, thresholds: append([]ADCThreshold(nil), thresholds...),
+		sides: make([]int, len(thresholds)), events: make(chan ADCEvent, adc_watcher_queue_),
+		stop: make(chan struct{}), stopped: make(chan struct{})}
+	for _, opt := range opts {
+		opt(w)
+	}
+	if w.clock == nil {
+		w.clock = defaultClock()
+	}
+	seen := make(map[uint]bool)
+	for _, th := range w.thresholds {
+		if err := th.check(); err != nil {
+			return nil, err
+		}
+		if !seen[th.Channel] {
+			seen[th.Channel] = true
+			w.channels = append(w.channels, th.Channel)
+		}
+	}
+	go w.run()
+	return w, nil
+}
+
+// Events as they happen, unless ADCWatcherWithCallback is used. If nobody reads them the oldest ones are dropped.
+func (w *ADCWatcher) Events() <-chan ADCEvent {
+	return w.events
+}
+
+// Stops polling and waits for a poll in progress
+func (w *ADCWatcher) Close() {
+	w.once.Do(func() { close(w.stop) })
+	<-w.stopped
+}
+
+func (w *ADCWatcher) run() {
+	defer close(w.stopped)
+	next := w.clock.Now()
+	for {
+		w.poll(next)
+		next = next.Add(w.interval)
+		select {
+		case <-w.stop:
+			return
+		case <-w.clock.After(next.Sub(w.clock.Now())):
+		}
+	}
+}
+
+func (w *ADCWatcher) poll(now time.Time) {
+	for _, channel := range w.channels {
+		v, err := w.adc.ReadVoltage(channel)
+		if err != nil {
+			w.emit(ADCEvent{Channel: channel, Time: now, Err: err})
+			continue
+		}
+		for i, th := range w.thresholds {
+			if th.Channel == channel {
+				w.evaluate(i, v, now)
+			}
+		}
+	}
+}
+
+// moves threshold i to the side of v, reporting a crossing of it
+func (w *ADCWatcher) evaluate(i int, v float64, now time.Time) {
+	th := w.thresholds[i]
+	side := adc_side_band_
+	if v > th.Level+th.Hysteresis/2 {
+		side = adc_side_above_
+	} else if v < th.Level-th.Hysteresis/2 {
+		side = adc_side_below_
+	}
+	prev := w.sides[i]
+	if side == adc_side_band_ {
+		if prev == adc_side_unread_ {
+			w.sides[i] = side
+		}
+		return
+	}
+	w.sides[i] = side
+	if prev == adc_side_unread_ || prev == side {
+		return
+	}
+	if side == adc_side_above_ && th.Edge != FALLING {
+		w.emit(ADCEvent{Channel: th.Channel, Value: v, Threshold: th, Edge: RISING, Time: now})
+	} else if side == adc_side_below_ && th.Edge != RISING {
+		w.emit(ADCEvent{Channel: th.Channel, Value: v, Threshold: th, Edge: FALLING, Time: now})
+	}
+}
+
+func (w *ADCWatcher) emit(ev ADCEvent) {
+	if w.callback != nil {
+		w.callback(ev)
+		return
+	}
+	for {
+		select {
+		case w.events <- ev:
+			return
+		default:
+		}
+		select {
+		case <-w.events:
+		default:
+		}
+	}
+}
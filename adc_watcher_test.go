@@ -0,0 +1,106 @@
+package bbhw
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func expectADCEvents(t *testing.T, w *ADCWatcher, step int, expected []ADCEvent) {
+	t.Helper()
+	for _, e := range expected {
+		select {
+		case ev := <-w.Events():
+			if ev.Err != nil && e.Err != nil && errors.Is(ev.Err, e.Err) {
+				ev.Err = e.Err
+			}
+			if ev != e {
+				t.Errorf("step %d: %+v, expected %+v", step, ev, e)
+			}
+		default:
+			t.Errorf("step %d: no event, expected %+v", step, e)
+		}
+	}
+	select {
+	case ev := <-w.Events():
+		t.Errorf("step %d: unexpected %+v", step, ev)
+	default:
+	}
+}
+
+func Test_ADCWatcher(t *testing.T) {
+	start := time.Unix(1000, 0)
+	clock := NewManualClock(start)
+	// with a reference of 4096V a volt is a count, so the band edges are exact
+	adc := NewFakeADC(FakeADCWithClock(clock), FakeADCWithReference(4096))
+	mid := ADCThreshold{Channel: 0, Level: 2000, Hysteresis: 100, Edge: BOTH}
+	adc.SetSequence(0, 2000, 2050, 2051, 1950, 2000, 1949, 1900, 1950, 2050, 2051, 2100, 2100)
+	// a 24V rail through a divider, only drops below 21V are of interest
+	rail := ADCThreshold{Channel: 1, Level: 21, Hysteresis: 0.5, Edge: FALLING}
+	adc.SetScale(1, ADCScale{Scale: 0.01})
+	adc.SetSequence(1, 2400, 2400, 2200, 2090, 2090, 2070, 2070, 2200, 2000)
+	volts := func(raw int) float64 { return adcVolts(raw, 4096, adc_calibration_default_, ADCScale{Scale: 0.01}) }
+	errBus := errors.New("bus error")
+
+	var w *ADCWatcher
+	afterTimer(t, clock, func() {
+		var err error
+		if w, err = NewADCWatcher(adc, 100*time.Millisecond, []ADCThreshold{mid, rail}, ADCWatcherWithClock(clock)); err != nil {
+			t.Fatal(err)
+		}
+	})
+	defer w.Close()
+	at := func(step int) time.Time { return start.Add(time.Duration(step) * 100 * time.Millisecond) }
+	for step, expected := range [][]ADCEvent{
+		{}, // 2000 in the band, 24V above it, no events for the start
+		{}, // 2050 at the upper edge of the band
+		{{Channel: 0, Value: 2051, Threshold: mid, Edge: RISING, Time: at(2)}},
+		{}, // 1950 at the lower edge
+		{},
+		{{Channel: 0, Value: 1949, Threshold: mid, Edge: FALLING, Time: at(5)}, {Channel: 1, Value: volts(2070), Threshold: rail, Edge: FALLING, Time: at(5)}},
+		{},
+		{}, // 1950 back at the edge is no rising, 22V no reported rising
+		{{Channel: 1, Err: errBus, Time: at(8)}},
+		{{Channel: 0, Value: 2051, Threshold: mid, Edge: RISING, Time: at(9)}, {Channel: 1, Value: volts(2000), Threshold: rail, Edge: FALLING, Time: at(9)}},
+		{},
+	} {
+		if step == 8 {
+			adc.FailNext(1, errBus)
+		}
+		if step > 0 {
+			afterTimer(t, clock, func() { clock.Advance(100 * time.Millisecond) })
+		}
+		expectADCEvents(t, w, step, expected)
+	}
+}
+
+func Test_ADCWatcherCallback(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	adc := NewFakeADC(FakeADCWithClock(clock), FakeADCWithReference(4096))
+	adc.SetSequence(3, 100, 300, 100)
+	events := make(chan ADCEvent, 4)
+	var w *ADCWatcher
+	afterTimer(t, clock, func() {
+		w, _ = NewADCWatcher(adc, time.Second, []ADCThreshold{{Channel: 3, Level: 200, Edge: RISING}},
+			ADCWatcherWithClock(clock), ADCWatcherWithCallback(func(ev ADCEvent) { events <- ev }))
+	})
+	afterTimer(t, clock, func() { clock.Advance(time.Second) })
+	afterTimer(t, clock, func() { clock.Advance(time.Second) })
+	w.Close()
+	if len(events) != 1 || (<-events).Edge != RISING {
+		t.Error("expected one rising event")
+	}
+	if n := adc.Reads(3); n != 3 {
+		t.Errorf("%d reads after Close", n)
+	}
+	w.Close()
+
+	for _, th := range []ADCThreshold{{Hysteresis: -1, Edge: BOTH}, {Level: -1, Hysteresis: 0.5, Edge: NONE}} {
+		if _, err := NewADCWatcher(adc, time.Second, []ADCThreshold{th}); err == nil {
+			t.Errorf("no error for %+v", th)
+		}
+	}
+	if _, err := NewADCWatcher(adc, 0, []ADCThreshold{{Edge: BOTH}}); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("interval 0: %v", err)
+	}
+}
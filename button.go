@@ -0,0 +1,188 @@
+package bbhw
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// What a Button reports, see ButtonEvent
+type ButtonEventType int
+
+const (
+	BUTTON_PRESSED      ButtonEventType = iota // pressed, after debouncing
+	BUTTON_RELEASED                            // released, after every press
+	BUTTON_CLICKED                             // released before the long press threshold, follows BUTTON_RELEASED
+	BUTTON_LONG_PRESSED                        // still pressed after the long press threshold
+)
+
+func (t ButtonEventType) String() string {
+	switch t {
+	case BUTTON_PRESSED:
+		return "Pressed"
+	case BUTTON_RELEASED:
+		return "Released"
+	case BUTTON_CLICKED:
+		return "Clicked"
+	case BUTTON_LONG_PRESSED:
+		return "LongPressed"
+	default:
+		return fmt.Sprintf("ButtonEventType(%d)", int(t))
+	}
+}
+
+type ButtonEvent struct {
+	Type ButtonEventType
+	Time time.Time     // when the button settled (or the threshold passed for BUTTON_LONG_PRESSED)
+	Held time.Duration // how long it was pressed, zero for BUTTON_PRESSED
+}
+
+// Option of NewButton
+type ButtonOption func(*Button)
+
+// pressed reads low, e.g. a button to ground with a pull-up. Default is pressed reading high
+func ButtonWithActiveLow() ButtonOption {
+	return func(b *Button) { b.activelow = true }
+}
+
+// how long the input has to be stable to count, default 20ms
+func ButtonWithDebounce(d time.Duration) ButtonOption {
+	return func(b *Button) { b.debounce = d }
+}
+
+// how long a press lasts to be BUTTON_LONG_PRESSED instead of BUTTON_CLICKED, default 1s
+func ButtonWithLongPress(d time.Duration) ButtonOption {
+	return func(b *Button) { b.longpress = d }
+}
+
+// times debounce and long press on c
+func ButtonWithClock(c Clock) ButtonOption {
+	return func(b *Button) { b.clock = c }
+}
+
+// calls fn for every event (on the goroutine of the Button) instead of sending it to Events
+func ButtonWithCallback(fn func(ButtonEvent)) ButtonOption {
+	return func(b *Button) { b.callback = fn }
+}
+
+// events queued on Events before the oldest ones are dropped
+const button_queue_ = 16
+
+// Momentary push button on an edge capable input, debounced and classified into press, release, click and long press.
+type Button struct {
+	gpio      EdgeGPIO
+	activelow bool
+	debounce  time.Duration
+	longpress time.Duration
+	clock     Clock
+	callback  func(ButtonEvent)
+	edges     chan bool
+	events    chan ButtonEvent
+	stop      chan struct{}
+	closing   sync.Once
+}
+
+// Sets the edge of gpio to BOTH and watches it with SetEdgeCallback.
+// A button held down while constructing is taken as pressed, without an event,
+// its Held counts from the construction.
+func NewButton(gpio EdgeGPIO, opts ...ButtonOption) (*Button, error) {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	b := &Button{gpio: gpio, debounce: 20 * time.Millisecond, longpress: time.Second,
+		edges: make(chan bool, button_queue_), events: make(chan ButtonEvent, button_queue_), stop: make(chan struct{})}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.clock == nil {
+		b.clock = defaultClock()
+	}
+	if err := gpio.SetEdge(BOTH); err != nil {
+		return nil, err
+	}
+	state, err := gpio.GetState()
+	if err != nil {
+		return nil, err
+	}
+	if err = gpio.SetEdgeCallback(&b.edges, -1); err != nil {
+		return nil, err
+	}
+	go b.run(state != b.activelow, b.clock.Now())
+	return b, nil
+}
+
+// Events as they happen, unless ButtonWithCallback is used. If nobody reads them the oldest ones are dropped.
+func (b *Button) Events() <-chan ButtonEvent {
+	return b.events
+}
+
+// Stops reporting events and sets the edge of the GPIO to NONE, which ends the edge callback of a CdevGPIO
+// or FakeGPIO right away and that of a SysfsGPIO once the GPIO is closed. The GPIO stays open.
+func (b *Button) Close() {
+	b.closing.Do(func() {
+		close(b.stop)
+		b.gpio.SetEdge(NONE)
+	})
+}
+
+// since is the start of the current press, a button held down while constructing counts from then
+func (b *Button) run(pressed bool, since time.Time) {
+	defer func() {
+		// keep the edge callback of the gpio from blocking until the gpio is closed
+		for range b.edges {
+		}
+	}()
+	raw := pressed
+	var settled, long <-chan time.Time
+	for {
+		select {
+		case <-b.stop:
+			return
+		case state, ok := <-b.edges:
+			if !ok {
+				return
+			}
+			// (re)start debouncing, an edge while bouncing extends it
+			raw = state != b.activelow
+			settled = b.clock.After(b.debounce)
+		case now := <-settled:
+			settled = nil
+			if raw == pressed {
+				continue
+			}
+			if pressed = raw; pressed {
+				since = now
+				b.emit(ButtonEvent{Type: BUTTON_PRESSED, Time: now})
+				long = b.clock.After(b.longpress)
+				continue
+			}
+			held := now.Sub(since)
+			b.emit(ButtonEvent{Type: BUTTON_RELEASED, Time: now, Held: held})
+			if long != nil {
+				b.emit(ButtonEvent{Type: BUTTON_CLICKED, Time: now, Held: held})
+			}
+			long = nil
+		case now := <-long:
+			long = nil
+			b.emit(ButtonEvent{Type: BUTTON_LONG_PRESSED, Time: now, Held: now.Sub(since)})
+		}
+	}
+}
+
+func (b *Button) emit(ev ButtonEvent) {
+	if b.callback != nil {
+		b.callback(ev)
+		return
+	}
+	for {
+		select {
+		case b.events <- ev:
+			return
+		default:
+		}
+		select {
+		case <-b.events:
+		default:
+		}
+	}
+}
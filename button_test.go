@@ -0,0 +1,121 @@
+package bbhw
+
+import (
+	"testing"
+	"time"
+)
+
+func expectButtonEvents(t *testing.T, b *Button, types ...ButtonEventType) []ButtonEvent {
+	t.Helper()
+	var got []ButtonEvent
+	for _, want := range types {
+		select {
+		case ev := <-b.Events():
+			if ev.Type != want {
+				t.Fatalf("got %v, expected %v", ev.Type, want)
+			}
+			got = append(got, ev)
+		case <-time.After(time.Second):
+			t.Fatalf("no %v event", want)
+		}
+	}
+	select {
+	case ev := <-b.Events():
+		t.Fatalf("unexpected %v event", ev.Type)
+	default:
+	}
+	return got
+}
+
+func Test_Button(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	in := NewFakeGPIO(1, IN)
+	in.SetUndrivenLevel(true)
+	b, err := NewButton(in, ButtonWithActiveLow(), ButtonWithClock(clock),
+		ButtonWithDebounce(10*time.Millisecond), ButtonWithLongPress(500*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	defer in.Close()
+
+	// bouncing short press
+	for _, level := range []bool{false, true, false, true, false} {
+		afterTimer(t, clock, func() { in.FakeInput(level) })
+		clock.Advance(2 * time.Millisecond)
+	}
+	// settles, the long press timer starts
+	afterTimer(t, clock, func() { clock.Advance(10 * time.Millisecond) })
+	expectButtonEvents(t, b, BUTTON_PRESSED)
+	clock.Advance(100 * time.Millisecond)
+	afterTimer(t, clock, func() { in.FakeInput(true) })
+	clock.Advance(10 * time.Millisecond)
+	ev := expectButtonEvents(t, b, BUTTON_RELEASED, BUTTON_CLICKED)
+	if ev[1].Held != 112*time.Millisecond { // settled 10ms after the last bounce
+		t.Errorf("click held for %v", ev[1].Held)
+	}
+
+	// glitch shorter than the debounce time
+	afterTimer(t, clock, func() { in.FakeInput(false) })
+	clock.Advance(time.Millisecond)
+	afterTimer(t, clock, func() { in.FakeInput(true) })
+	clock.Advance(50 * time.Millisecond)
+	expectButtonEvents(t, b)
+
+	// hold
+	afterTimer(t, clock, func() { in.FakeInput(false) })
+	afterTimer(t, clock, func() { clock.Advance(10 * time.Millisecond) })
+	clock.Advance(time.Second)
+	expectButtonEvents(t, b, BUTTON_PRESSED, BUTTON_LONG_PRESSED)
+	afterTimer(t, clock, func() { in.FakeInput(true) })
+	clock.Advance(10 * time.Millisecond)
+	if ev = expectButtonEvents(t, b, BUTTON_RELEASED); ev[0].Held != time.Second+10*time.Millisecond {
+		t.Errorf("released after %v", ev[0].Held)
+	}
+}
+
+func Test_ButtonHeldWhileConstructing(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	in := NewFakeGPIO(1, IN)
+	in.FakeInput(true)
+	defer in.Close()
+	b, err := NewButton(in, ButtonWithClock(clock), ButtonWithDebounce(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	clock.Advance(200 * time.Millisecond)
+	afterTimer(t, clock, func() { in.FakeInput(false) })
+	clock.Advance(10 * time.Millisecond)
+	if ev := expectButtonEvents(t, b, BUTTON_RELEASED); ev[0].Held != 210*time.Millisecond {
+		t.Errorf("released after %v", ev[0].Held)
+	}
+}
+
+func Test_ButtonCallback(t *testing.T) {
+	in := NewFakeGPIO(1, IN)
+	got := make(chan ButtonEventType, 4)
+	b, err := NewButton(in, ButtonWithDebounce(time.Millisecond), ButtonWithCallback(func(ev ButtonEvent) { got <- ev.Type }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	in.FakeInput(true)
+	if ev := <-got; ev != BUTTON_PRESSED {
+		t.Errorf("callback got %v", ev)
+	}
+	b.Close()
+	b.Close()
+	in.FakeInput(false)
+	select {
+	case ev := <-got:
+		t.Errorf("callback got %v after Close", ev)
+	case <-time.After(20 * time.Millisecond):
+	}
+	// the edge callback ended with the GPIO still open, and so did the goroutine of the Button
+	for deadline := time.Now().Add(time.Second); goroutinesCreatedBy("NewButton") > 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Button goroutine still running after Close")
+		}
+	}
+	in.Close()
+}
@@ -0,0 +1,162 @@
+package bbhw
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// returned by Tone and on the done channel of PlaySequence if the sequence was stopped or replaced before it ended
+var ErrBuzzerStopped = errors.New("buzzer stopped")
+
+// One note of Buzzer.PlaySequence: Freq in Hz for Duration, Freq 0 is a rest
+type Note struct {
+	Freq     float64
+	Duration time.Duration
+}
+
+// Option of NewBuzzer
+type BuzzerOption func(*Buzzer)
+
+// times the notes on c
+func BuzzerWithClock(c Clock) BuzzerOption {
+	return func(b *Buzzer) { b.clock = c }
+}
+
+// Plays tones and melodies on a piezo buzzer driven by a PWM: each note at 50% duty, disabled between notes,
+// at the end and after any error. Notes are scheduled from the start of a sequence, so it does not drift.
+type Buzzer struct {
+	pwm     PWM
+	clock   Clock
+	lock    sync.Mutex // guards current and closed
+	current *buzzerPlay
+	closed  bool
+}
+
+type buzzerPlay struct {
+	cancel chan struct{}
+	exited chan struct{}
+}
+
+// pwm is disabled right away
+func NewBuzzer(pwm PWM, opts ...BuzzerOption) (*Buzzer, error) {
+	if pwm == nil {
+		panic("pwm == nil")
+	}
+	b := &Buzzer{pwm: pwm}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.clock == nil {
+		b.clock = defaultClock()
+	}
+	if err := pwm.Disable(); err != nil {
+		return nil, fmt.Errorf("Buzzer: %w", err)
+	}
+	return b, nil
+}
+
+// Plays freq for d and returns once it ended, replacing a playing sequence
+func (b *Buzzer) Tone(freq float64, d time.Duration) error {
+	return <-b.PlaySequence([]Note{{freq, d}})
+}
+
+// Plays notes on a goroutine, replacing a playing sequence. done receives nil once it ended,
+// ErrBuzzerStopped or the error of the PWM.
+func (b *Buzzer) PlaySequence(notes []Note) (done <-chan error) {
+	result := make(chan error, 1)
+	for i, n := range notes {
+		if n.Duration < 0 {
+			result <- fmt.Errorf("Buzzer: note %d with negative duration %v", i, n.Duration)
+			return result
+		}
+		if n.Freq != 0 {
+			if _, err := periodOfFrequency(n.Freq); err != nil {
+				result <- fmt.Errorf("Buzzer: note %d: %w", i, err)
+				return result
+			}
+		}
+	}
+	notes = append([]Note(nil), notes...)
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		result <- errors.New("Buzzer closed")
+		return result
+	}
+	b.stop()
+	p := &buzzerPlay{cancel: make(chan struct{}), exited: make(chan struct{})}
+	b.current = p
+	go func() {
+		defer close(p.exited)
+		result <- b.play(p, notes)
+	}()
+	return result
+}
+
+// Stops a playing sequence and waits until the PWM is disabled
+func (b *Buzzer) Stop() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.stop()
+}
+
+// Stops, PlaySequence fails from now on. The PWM belongs to the caller.
+func (b *Buzzer) Close() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.stop()
+	b.closed = true
+}
+
+// with lock held
+func (b *Buzzer) stop() {
+	if b.current == nil {
+		return
+	}
+	close(b.current.cancel)
+	<-b.current.exited
+	b.current = nil
+}
+
+func (b *Buzzer) play(p *buzzerPlay, notes []Note) (err error) {
+	defer func() {
+		// whatever went wrong, the buzzer must not keep sounding
+		if err != nil {
+			if derr := b.pwm.Disable(); derr != nil {
+				err = fmt.Errorf("%w, disabling failed too: %v", err, derr)
+			}
+		}
+	}()
+	next := b.clock.Now()
+	for _, n := range notes {
+		select {
+		case <-p.cancel:
+			return ErrBuzzerStopped
+		default:
+		}
+		if n.Freq != 0 {
+			if err = b.pwm.SetFrequency(n.Freq); err == nil {
+				if err = b.pwm.SetDutyFraction(0.5); err == nil {
+					err = b.pwm.Enable()
+				}
+			}
+			if err != nil {
+				return fmt.Errorf("Buzzer: %w", err)
+			}
+		}
+		next = next.Add(n.Duration)
+		select {
+		case <-p.cancel:
+			return ErrBuzzerStopped
+		case <-b.clock.After(next.Sub(b.clock.Now())):
+		}
+		if n.Freq != 0 {
+			if err = b.pwm.Disable(); err != nil {
+				return fmt.Errorf("Buzzer: %w", err)
+			}
+		}
+	}
+	return nil
+}
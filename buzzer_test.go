@@ -0,0 +1,142 @@
+package bbhw
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+type buzzerTone struct {
+	at   time.Duration // since the start
+	freq float64
+	dur  time.Duration
+}
+
+// the tones in the history of pwm, which has to end disabled
+func expectTones(t *testing.T, pwm *FakePWM, start time.Time, expected ...buzzerTone) {
+	t.Helper()
+	var tones []buzzerTone
+	for _, c := range pwm.History() {
+		if c.Enabled && (len(tones) == 0 || tones[len(tones)-1].dur != 0) {
+			if math.Abs(c.DutyFraction()-0.5) > 1e-6 {
+				t.Errorf("duty %v of period %v", c.Duty, c.Period)
+			}
+			tones = append(tones, buzzerTone{at: c.Time.Sub(start), freq: math.Round(1e9 / float64(c.Period))})
+		} else if !c.Enabled && len(tones) > 0 && tones[len(tones)-1].dur == 0 {
+			tones[len(tones)-1].dur = c.Time.Sub(start) - tones[len(tones)-1].at
+		}
+	}
+	if len(tones) != len(expected) {
+		t.Fatalf("tones %+v, expected %+v", tones, expected)
+	}
+	for i := range tones {
+		if tones[i] != expected[i] {
+			t.Errorf("tone %d %+v, expected %+v", i, tones[i], expected[i])
+		}
+	}
+	if _, _, enabled := pwm.Output(); enabled {
+		t.Error("PWM enabled at the end")
+	}
+}
+
+func Test_BuzzerPlaySequence(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	pwm := NewFakeNamedPWM("BUZZER")
+	pwm.SetClock(clock)
+	defer pwm.Close()
+	b, err := NewBuzzer(pwm, BuzzerWithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	pwm.EnableHistory(100)
+	start := clock.Now()
+	done := startPlay(t, clock, func() <-chan error {
+		return b.PlaySequence([]Note{{440, 100 * time.Millisecond}, {0, 50 * time.Millisecond}, {880, 100 * time.Millisecond},
+			{880, 200 * time.Millisecond}})
+	})
+	advanceSteps(t, clock, 100*time.Millisecond, 50*time.Millisecond, 100*time.Millisecond, 200*time.Millisecond)
+	if err := expectPlayResult(t, done); err != nil {
+		t.Fatal(err)
+	}
+	// the same frequency twice is two notes
+	expectTones(t, pwm, start, buzzerTone{0, 440, 100 * time.Millisecond}, buzzerTone{150 * time.Millisecond, 880, 100 * time.Millisecond},
+		buzzerTone{250 * time.Millisecond, 880, 200 * time.Millisecond})
+
+	pwm.EnableHistory(100)
+	start = clock.Now()
+	tone := make(chan error, 1)
+	afterTimer(t, clock, func() { go func() { tone <- b.Tone(2000, 30*time.Millisecond) }() })
+	clock.Advance(30 * time.Millisecond)
+	if err := expectPlayResult(t, tone); err != nil {
+		t.Fatal(err)
+	}
+	expectTones(t, pwm, start, buzzerTone{0, 2000, 30 * time.Millisecond})
+}
+
+func Test_BuzzerStopAndReplace(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	pwm := NewFakeNamedPWM("BUZZER")
+	pwm.SetClock(clock)
+	defer pwm.Close()
+	b, err := NewBuzzer(pwm, BuzzerWithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	pwm.EnableHistory(100)
+	start := clock.Now()
+	first := startPlay(t, clock, func() <-chan error { return b.PlaySequence([]Note{{1000, time.Second}}) })
+	clock.Advance(50 * time.Millisecond)
+	second := startPlay(t, clock, func() <-chan error { return b.PlaySequence([]Note{{2000, time.Second}}) })
+	if err := expectPlayResult(t, first); !errors.Is(err, ErrBuzzerStopped) {
+		t.Errorf("replaced sequence: %v", err)
+	}
+	clock.Advance(100 * time.Millisecond)
+	b.Stop()
+	if err := expectPlayResult(t, second); !errors.Is(err, ErrBuzzerStopped) {
+		t.Errorf("stopped sequence: %v", err)
+	}
+	expectTones(t, pwm, start, buzzerTone{0, 1000, 50 * time.Millisecond}, buzzerTone{50 * time.Millisecond, 2000, 100 * time.Millisecond})
+}
+
+func Test_BuzzerErrors(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	pwm := NewFakeNamedPWM("BUZZER")
+	pwm.SetClock(clock)
+	defer pwm.Close()
+	b, err := NewBuzzer(pwm, BuzzerWithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	pwm.EnableHistory(100)
+	failure := errors.New("write error")
+	pwm.FailNext("Enable", failure)
+	if err := <-b.PlaySequence([]Note{{440, time.Second}}); !errors.Is(err, failure) {
+		t.Errorf("failing Enable: %v", err)
+	}
+	// a failing Disable at the end of a note is retried
+	pwm.FailNext("Disable", failure)
+	done := startPlay(t, clock, func() <-chan error { return b.PlaySequence([]Note{{440, 10 * time.Millisecond}, {880, time.Second}}) })
+	clock.Advance(10 * time.Millisecond)
+	if err := expectPlayResult(t, done); !errors.Is(err, failure) {
+		t.Errorf("failing Disable: %v", err)
+	}
+	if _, _, enabled := pwm.Output(); enabled {
+		t.Error("PWM enabled after the errors")
+	}
+	for _, notes := range [][]Note{{{440, -time.Second}}, {{-1, time.Second}}, {{1e12, time.Second}}} {
+		if err := <-b.PlaySequence(notes); err == nil {
+			t.Errorf("%+v accepted", notes)
+		}
+	}
+	if err := <-b.PlaySequence(nil); err != nil {
+		t.Error("empty sequence:", err)
+	}
+	b.Close()
+	if err := b.Tone(440, time.Second); err == nil {
+		t.Error("no error after Close")
+	}
+}
@@ -0,0 +1,100 @@
+package bbhw
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// returned (wrapped in a *ClaimError) by constructors if the GPIO is already in use in this process,
+// see SetClaimRegistry. errors.Is(err, ErrAlreadyClaimed) also matches a *LineBusyError of the cdev backend.
+var ErrAlreadyClaimed = errors.New("GPIO already claimed")
+
+// Error returned if a GPIO was claimed a second time, errors.Is(err, ErrAlreadyClaimed) matches it
+type ClaimError struct {
+	Pin      string // e.g. "gpio44"
+	Claimant string // label of the first claimant, WithClaimLabel or file:line of the constructor call
+}
+
+func (e *ClaimError) Error() string {
+	return fmt.Sprintf("%s already claimed by %s", e.Pin, e.Claimant)
+}
+
+func (e *ClaimError) Is(target error) bool { return target == ErrAlreadyClaimed }
+
+type pinClaim struct {
+	claimant string // the first one
+	count    int
+}
+
+// process-wide registry of the GPIOs in use by SysfsGPIO, MMappedGPIO and HybridGPIO
+var claims_ = struct {
+	lock     sync.Mutex
+	disabled bool
+	pins     map[string]*pinClaim
+}{pins: make(map[string]*pinClaim)}
+
+// The registry of claimed GPIOs is enabled by default: constructing a second SysfsGPIO, MMappedGPIO or HybridGPIO
+// for the same GPIO number then fails with ErrAlreadyClaimed, until the first one is closed.
+// Programs which intentionally share pins can switch it off, or pass WithSharedOK to single constructors.
+// Cdev lines are always exclusive, the kernel refuses a second request (see LineBusyError).
+func SetClaimRegistry(enabled bool) {
+	claims_.lock.Lock()
+	defer claims_.lock.Unlock()
+	claims_.disabled = !enabled
+}
+
+// registers pin, returns the func to release the claim again (safe to call several times).
+// label empty means the caller outside of this package.
+func claimPin(pin, label string, shared bool) (release func(), err error) {
+	claims_.lock.Lock()
+	defer claims_.lock.Unlock()
+	if claims_.disabled {
+		return func() {}, nil
+	}
+	if label == "" {
+		label = claimCaller()
+	}
+	c := claims_.pins[pin]
+	if c != nil && !shared {
+		return nil, &ClaimError{Pin: pin, Claimant: c.claimant}
+	}
+	if c == nil {
+		c = &pinClaim{claimant: label}
+		claims_.pins[pin] = c
+	}
+	c.count++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			claims_.lock.Lock()
+			defer claims_.lock.Unlock()
+			if c.count--; c.count == 0 && claims_.pins[pin] == c {
+				delete(claims_.pins, pin)
+			}
+		})
+	}, nil
+}
+
+var bbhw_pkg_prefix_ = reflect.TypeOf(SysfsGPIO{}).PkgPath() + "."
+
+// file:line of the first caller outside of this package (tests of this package count as outside)
+func claimCaller() string {
+	pcs := make([]uintptr, 16)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		f, more := frames.Next()
+		if !strings.HasPrefix(f.Function, bbhw_pkg_prefix_) || strings.HasSuffix(f.File, "_test.go") {
+			return fmt.Sprintf("%s:%d", filepath.Base(f.File), f.Line)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+func gpioClaimName(number uint) string { return fmt.Sprintf("gpio%d", number) }
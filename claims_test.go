@@ -0,0 +1,107 @@
+package bbhw
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func Test_ClaimRegistry(t *testing.T) {
+	useFakeSysfsGPIOTree(t, 44)
+	first, err := NewSysfsGPIOWithOptions(44, WithClaimLabel("relay driver"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewSysfsGPIO(44, OUT)
+	var cerr *ClaimError
+	if !errors.Is(err, ErrAlreadyClaimed) || !errors.As(err, &cerr) || cerr.Claimant != "relay driver" || cerr.Pin != "gpio44" {
+		t.Fatalf("second claim: %v", err)
+	}
+	shared, err := NewSysfsGPIOWithOptions(44, WithSharedOK())
+	if err != nil {
+		t.Fatal("WithSharedOK:", err)
+	}
+	first.Close()
+	first.Close() // closing twice does not release the claim of shared
+	if _, err = NewSysfsGPIO(44, OUT); !errors.Is(err, ErrAlreadyClaimed) || !strings.Contains(err.Error(), "relay driver") {
+		t.Errorf("claim while shared is still open: %v", err)
+	}
+	shared.Close()
+	again, err := NewSysfsGPIO(44, OUT)
+	if err != nil {
+		t.Fatal("claim after Close:", err)
+	}
+	// without WithClaimLabel the claimant is the constructor call
+	if _, err = NewSysfsGPIO(44, OUT); err == nil || !strings.Contains(err.Error(), "claims_test.go:") {
+		t.Errorf("default label: %v", err)
+	}
+
+	SetClaimRegistry(false)
+	defer SetClaimRegistry(true)
+	unregistered, err := NewSysfsGPIO(44, OUT)
+	if err != nil {
+		t.Fatal("registry disabled:", err)
+	}
+	unregistered.Close()
+	again.Close()
+}
+
+func Test_ClaimRegistryMMapped(t *testing.T) {
+	useFakeSysfsGPIOTree(t, 67)
+	useFakeGPIORegisters(t)
+	first, err := NewMMappedGPIOOrError(67, OUT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewMMappedGPIOOrError(67, OUT); !errors.Is(err, ErrAlreadyClaimed) {
+		t.Errorf("second MMappedGPIO: %v", err)
+	}
+	gf := NewMMappedGPIOCollectionFactory()
+	if _, err = gf.NewMMappedGPIOOrError(67, OUT); !errors.Is(err, ErrAlreadyClaimed) {
+		t.Errorf("MMappedGPIOInCollection: %v", err)
+	}
+	if _, err = NewSysfsGPIO(67, OUT); !errors.Is(err, ErrAlreadyClaimed) {
+		t.Errorf("SysfsGPIO: %v", err)
+	}
+	first.Close()
+	pin, err := gf.NewMMappedGPIOOrError(67, OUT)
+	if err != nil {
+		t.Fatal("claim after Close:", err)
+	}
+	pin.Close()
+}
+
+func Test_ClaimRegistryConcurrent(t *testing.T) {
+	useFreshClaimRegistry(t)
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	won := 0
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := claimPin("gpio7", "", false); err == nil {
+				lock.Lock()
+				won++
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if won != 1 {
+		t.Errorf("%d goroutines claimed the same pin", won)
+	}
+}
+
+func Test_LineBusyIsAlreadyClaimed(t *testing.T) {
+	chip := NewFakeCdevChip(1)
+	gpio, err := chip.NewGPIO(0, IN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gpio.Close()
+	if _, err = chip.NewGPIO(0, IN); !errors.Is(err, ErrAlreadyClaimed) {
+		t.Errorf("second request of a cdev line: %v", err)
+	}
+}
@@ -0,0 +1,208 @@
+package bbhw
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Time source of the FakeGPIO timing features (PlayWaveform, SetBounce, delayed connections, History, edge callbacks)
+// and of the helpers Step and ApplySequence. See SetDefaultClock and FakeGPIO.SetClock.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	Sleep(d time.Duration)
+	NewTicker(d time.Duration) Ticker
+}
+
+// time.Ticker behind an interface, so a ManualClock can provide them
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (systemClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (systemClock) NewTicker(d time.Duration) Ticker       { return systemTicker{time.NewTicker(d)} }
+
+type systemTicker struct{ t *time.Ticker }
+
+func (t systemTicker) C() <-chan time.Time { return t.t.C }
+func (t systemTicker) Stop()               { t.t.Stop() }
+
+var default_clock_ = struct {
+	lock  sync.Mutex
+	clock Clock
+}{clock: systemClock{}}
+
+// Clock used by Step, ApplySequence and all FakeGPIOs without their own (FakeGPIO.SetClock). nil reverts to real time.
+// Devices timing something (Button, Sequencer, SoftPWM, ...) use it too unless given another by their WithClock option.
+func SetDefaultClock(c Clock) {
+	if c == nil {
+		c = systemClock{}
+	}
+	default_clock_.lock.Lock()
+	defer default_clock_.lock.Unlock()
+	default_clock_.clock = c
+}
+
+func defaultClock() Clock {
+	default_clock_.lock.Lock()
+	defer default_clock_.lock.Unlock()
+	return default_clock_.clock
+}
+
+// Clock which only moves on Advance, for deterministic and fast tests of timed behaviour.
+// Advance fires the due timers without waiting for anybody to react, so a test moves through timed behaviour
+// one step at a time: BlockUntil the goroutine under test has set its next timer, then Advance to it.
+type ManualClock struct {
+	lock    sync.Mutex
+	cond    *sync.Cond // broadcast whenever a timer is created or stopped
+	now     time.Time
+	timers  []*manualTimer
+	waiting int // incremented whenever a timer waiting for Advance is created
+}
+
+type manualTimer struct {
+	clock    *ManualClock
+	deadline time.Time
+	period   time.Duration // tickers only
+	c        chan time.Time
+	stopped  bool
+}
+
+func NewManualClock(start time.Time) *ManualClock {
+	c := &ManualClock{now: start}
+	c.cond = sync.NewCond(&c.lock)
+	return c
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+// fires once Advance reached now+d, immediately for d <= 0
+func (c *ManualClock) After(d time.Duration) <-chan time.Time {
+	return c.newTimer(d, 0).c
+}
+
+// blocks until Advance reached now+d
+func (c *ManualClock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+// ticks every d of virtual time, like time.Ticker ticks are dropped if nobody reads them
+func (c *ManualClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	return (*manualTicker)(c.newTimer(d, d))
+}
+
+func (c *ManualClock) newTimer(d, period time.Duration) *manualTimer {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	t := &manualTimer{clock: c, deadline: c.now.Add(d), period: period, c: make(chan time.Time, 1)}
+	if d <= 0 && period == 0 {
+		t.c <- c.now
+		return t
+	}
+	c.timers = append(c.timers, t)
+	c.waiting++
+	c.cond.Broadcast()
+	return t
+}
+
+type manualTicker manualTimer
+
+func (t *manualTicker) C() <-chan time.Time { return t.c }
+
+func (t *manualTicker) Stop() {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+	t.stopped = true
+	t.clock.cond.Broadcast()
+}
+
+// Timers and tickers waiting for Advance, timers which already fired and stopped tickers do not count
+func (c *ManualClock) Pending() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.pending()
+}
+
+// the caller holds lock
+func (c *ManualClock) pending() int {
+	n := 0
+	for _, t := range c.timers {
+		if !t.stopped {
+			n++
+		}
+	}
+	return n
+}
+
+// Blocks until at least n timers and tickers are pending, e.g. until the goroutine woken by the last Advance
+// has set its next timer. This is the hand-off between a test and the code under test, it does not time out.
+func (c *ManualClock) BlockUntil(n int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for c.pending() < n {
+		c.cond.Wait()
+	}
+}
+
+// Timers waiting for Advance created so far (those firing immediately do not count), for waiting until a call made one (see BlockUntil for waiting on the pending ones)
+func (c *ManualClock) Created() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.waiting
+}
+
+// Blocks until more than created timers were created in total, see Created
+func (c *ManualClock) BlockUntilCreated(created int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for c.waiting <= created {
+		c.cond.Wait()
+	}
+}
+
+// Moves the clock forward by d. Due timers and tickers fire in the order of their deadlines, each with its
+// deadline as the time sent; a ticker due several times fires once, the other ticks are dropped like those of
+// a time.Ticker nobody reads. Advance does not wait for the woken goroutines: timers they set in reaction are
+// relative to the new Now, so to run e.g. a waveform step by step, Advance by one step after each BlockUntil.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	end := c.now.Add(d)
+	sort.SliceStable(c.timers, func(i, j int) bool { return c.timers[i].deadline.Before(c.timers[j].deadline) })
+	kept := c.timers[:0]
+	for _, t := range c.timers {
+		if t.stopped {
+			continue
+		}
+		if t.deadline.After(end) {
+			kept = append(kept, t)
+			continue
+		}
+		select {
+		case t.c <- t.deadline:
+		default:
+		}
+		if t.period > 0 {
+			for !t.deadline.After(end) {
+				t.deadline = t.deadline.Add(t.period)
+			}
+			kept = append(kept, t)
+		}
+	}
+	c.timers = kept
+	c.now = end
+	c.cond.Broadcast()
+}
@@ -0,0 +1,200 @@
+package bbhw
+
+import (
+	"testing"
+	"time"
+)
+
+// does fn and waits until something reacted to it by creating a timer on clock
+func afterTimer(t *testing.T, clock *ManualClock, fn func()) {
+	t.Helper()
+	created := clock.Created()
+	fn()
+	clock.BlockUntilCreated(created)
+}
+
+// advances clock by each of steps in turn. Before each further step it waits for the timer set in reaction
+// to the previous one, the reaction to the last step may end whatever runs on clock.
+func advanceSteps(t *testing.T, clock *ManualClock, steps ...time.Duration) {
+	t.Helper()
+	for i, step := range steps {
+		if i == len(steps)-1 {
+			clock.Advance(step)
+			return
+		}
+		afterTimer(t, clock, func() { clock.Advance(step) })
+	}
+}
+
+// the earliest deadline of the timers pending on clock, if not after end
+func nextDeadline(clock *ManualClock, end time.Time) (next time.Time, found bool) {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+	next = end
+	for _, tm := range clock.timers {
+		if !tm.stopped && !tm.deadline.After(next) {
+			next, found = tm.deadline, true
+		}
+	}
+	return next, found
+}
+
+// advances clock by d one pending timer at a time, waiting after each for the timer set in reaction to it.
+// For goroutines setting their timers at varying intervals (noise, steps of a motor), all of which have to re-arm.
+func advanceTimerByTimer(t *testing.T, clock *ManualClock, d time.Duration) {
+	t.Helper()
+	end := clock.Now().Add(d)
+	for {
+		next, found := nextDeadline(clock, end)
+		if !found {
+			clock.Advance(end.Sub(clock.Now()))
+			return
+		}
+		afterTimer(t, clock, func() { clock.Advance(next.Sub(clock.Now())) })
+	}
+}
+
+// advances clock one pending timer at a time while running, waiting after each for the timer set in reaction
+// to it or for running to turn false, e.g. for a move of a motor which ends after its last timer
+func advanceWhile(t *testing.T, clock *ManualClock, running func() bool) {
+	t.Helper()
+	for running() {
+		next, found := nextDeadline(clock, clock.Now().Add(time.Hour))
+		if !found {
+			t.Fatal("running without a timer")
+		}
+		created := clock.Created()
+		clock.Advance(next.Sub(clock.Now()))
+		for deadline := time.Now().Add(time.Second); running() && clock.Created() == created; time.Sleep(time.Microsecond) {
+			if time.Now().After(deadline) {
+				t.Fatal("no reaction to the timer")
+			}
+		}
+	}
+}
+
+// n times step, for advanceSteps
+func repeatStep(step time.Duration, n int) []time.Duration {
+	steps := make([]time.Duration, n)
+	for i := range steps {
+		steps[i] = step
+	}
+	return steps
+}
+
+func Test_ManualClockLongWaveform(t *testing.T) {
+	start := time.Unix(1000, 0)
+	clock := NewManualClock(start)
+	in := NewFakeGPIO(1, IN)
+	in.SetClock(clock)
+	in.EnableHistory(100)
+	var steps []WaveStep
+	for i := 0; i < 20; i++ {
+		steps = append(steps, WaveStep{i%2 == 0, 500 * time.Millisecond})
+	}
+	var done <-chan struct{}
+	afterTimer(t, clock, func() {
+		var err error
+		if done, err = in.PlayWaveform(steps); err != nil {
+			t.Fatal(err)
+		}
+	})
+	real := time.Now()
+	advanceSteps(t, clock, repeatStep(500*time.Millisecond, 20)...)
+	<-done
+	if d := time.Since(real); d > time.Second {
+		t.Errorf("10s of virtual time took %v", d)
+	}
+	h := in.History()
+	if len(h) != 20 {
+		t.Fatalf("expected 20 transitions, got %d", len(h))
+	}
+	for i, tr := range h {
+		if want := start.Add(time.Duration(i) * 500 * time.Millisecond); !tr.Time.Equal(want) {
+			t.Errorf("transition %d at %v, expected %v", i, tr.Time.Sub(start), want.Sub(start))
+		}
+	}
+}
+
+func Test_ManualClockTicker(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0))
+	ticker := clock.NewTicker(time.Second)
+	for i := 1; i <= 3; i++ {
+		clock.Advance(time.Second)
+		if tick := <-ticker.C(); tick.Unix() != int64(i) {
+			t.Errorf("tick %d at %v", i, tick.Unix())
+		}
+	}
+	// like a time.Ticker nobody reads, the ticks in between are dropped
+	clock.Advance(3500 * time.Millisecond)
+	if tick := <-ticker.C(); tick.Unix() != 4 {
+		t.Errorf("first tick of a long Advance at %v", tick.Unix())
+	}
+	clock.Advance(500 * time.Millisecond)
+	if tick := <-ticker.C(); tick.Unix() != 7 {
+		t.Errorf("tick after a long Advance at %v", tick.Unix())
+	}
+	ticker.Stop()
+	clock.Advance(time.Second)
+	select {
+	case <-ticker.C():
+		t.Error("stopped ticker ticked")
+	default:
+	}
+	if n := clock.Pending(); n != 0 {
+		t.Errorf("%d pending after Stop", n)
+	}
+}
+
+func Test_ManualClockBlockUntil(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0))
+	woken := make(chan time.Time)
+	go func() {
+		for i := 0; i < 2; i++ {
+			woken <- <-clock.After(time.Second)
+		}
+	}()
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	if tick := <-woken; tick.Unix() != 1 {
+		t.Errorf("tick at %v", tick.Unix())
+	}
+	// the goroutine sets its next timer relative to the Now of the Advance
+	clock.BlockUntil(1)
+	clock.Advance(999 * time.Millisecond)
+	select {
+	case <-woken:
+		t.Error("woken early")
+	default:
+	}
+	clock.Advance(time.Millisecond)
+	if tick := <-woken; tick.Unix() != 2 {
+		t.Errorf("second tick at %v", tick.Unix())
+	}
+	if n := clock.Pending(); n != 0 {
+		t.Errorf("%d pending", n)
+	}
+}
+
+func Test_DefaultClockStep(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0))
+	SetDefaultClock(clock)
+	defer SetDefaultClock(nil)
+	out := NewFakeGPIO(1, OUT)
+	done := make(chan uint32)
+	go func() {
+		c, _ := Step(out, 3, time.Hour, nil)
+		done <- c
+	}()
+	for {
+		select {
+		case c := <-done:
+			if c != 3 {
+				t.Errorf("Step returned %d", c)
+			}
+			return
+		case <-time.After(time.Millisecond):
+			clock.Advance(time.Hour)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package bbhw
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Data of a sensor arrived, but does not add up. Reading again usually works.
+var ErrChecksum = errors.New("checksum mismatch")
+
+// A sensor did not answer in time or parts of its answer got lost. Reading again usually works.
+var ErrTimeout = errors.New("timeout")
+
+// The sensors speaking the DHT protocol
+type DHTModel int
+
+const (
+	DHT11 DHTModel = iota // 0-50°C in 1°C steps, newer ones with tenths
+	DHT22                 // DHT22, AM2302: -40-80°C in 0.1°C steps
+)
+
+// Option of NewDHTSensor
+type DHTOption func(*DHTSensor)
+
+// times the start pulse and the answer on c
+func DHTWithClock(c Clock) DHTOption {
+	return func(s *DHTSensor) { s.clock = c }
+}
+
+// how long the answer of the sensor may take, default 10ms. It needs about 5ms.
+func DHTWithTimeout(d time.Duration) DHTOption {
+	return func(s *DHTSensor) { s.timeout = d }
+}
+
+// high pulses of a DHT answer are 26-28µs for a 0 and 70µs for a 1
+const dht_bit_threshold_ = 50 * time.Microsecond
+
+// Temperature and humidity sensor DHT11 or DHT22 on one GPIO with a pull-up (most modules have one).
+// The 40 bits of the answer are told apart by the width of pulses of 27µs or 70µs, which needs the
+// kernel timestamps of CdevGPIO. SysfsGPIO only knows when it noticed an edge, mostly ending in ErrChecksum or ErrTimeout.
+// The sensors need a pause of 1s (DHT11) or 2s (DHT22) between reads.
+type DHTSensor struct {
+	gpio    EdgeEventGPIO
+	model   DHTModel
+	clock   Clock
+	timeout time.Duration
+	lock    sync.Mutex // one Read at a time
+
+	capture struct {
+		lock    sync.Mutex
+		running bool
+		events  []EdgeEvent
+	}
+}
+
+// Switches gpio to input and watches both edges from now on, it needs to be exclusive to the sensor
+func NewDHTSensor(gpio EdgeEventGPIO, model DHTModel, opts ...DHTOption) (*DHTSensor, error) {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	if model != DHT11 && model != DHT22 {
+		return nil, fmt.Errorf("DHTSensor: invalid model %d", int(model))
+	}
+	s := &DHTSensor{gpio: gpio, model: model, timeout: 10 * time.Millisecond}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.clock == nil {
+		s.clock = defaultClock()
+	}
+	if err := gpio.SetDirection(IN); err != nil {
+		return nil, err
+	}
+	if err := gpio.SetEdge(BOTH); err != nil {
+		return nil, err
+	}
+	events := make(chan EdgeEvent, 128)
+	if err := gpio.SetEdgeEventCallback(events, -1); err != nil {
+		return nil, err
+	}
+	go s.collect(events)
+	return s, nil
+}
+
+// ends once the edge callback of the GPIO does, i.e. with the GPIO
+func (s *DHTSensor) collect(events <-chan EdgeEvent) {
+	for ev := range events {
+		s.capture.lock.Lock()
+		if s.capture.running {
+			s.capture.events = append(s.capture.events, ev)
+		}
+		s.capture.lock.Unlock()
+	}
+}
+
+// Wakes the sensor with a low pulse and decodes its answer. Failures wrap ErrTimeout or ErrChecksum, try again then.
+func (s *DHTSensor) Read() (celsius, humidity float64, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	start := 20 * time.Millisecond
+	if s.model == DHT22 {
+		start = 1100 * time.Microsecond
+	}
+	// sysfs refuses to switch a GPIO with edge detection (an interrupt) to output
+	sysfs := s.gpio.Backend() == BACKEND_SYSFS
+	if sysfs {
+		if err = s.gpio.SetEdge(NONE); err != nil {
+			return 0, 0, err
+		}
+	}
+	if err = s.gpio.SetDirection(OUT); err == nil {
+		err = s.gpio.SetState(false)
+	}
+	if err != nil {
+		s.gpio.SetDirection(IN)
+		return 0, 0, fmt.Errorf("DHTSensor start pulse: %w", err)
+	}
+	s.clock.Sleep(start)
+	s.capture.lock.Lock()
+	s.capture.running, s.capture.events = true, nil
+	s.capture.lock.Unlock()
+	err = s.gpio.SetDirection(IN)
+	if err == nil && sysfs {
+		err = s.gpio.SetEdge(BOTH)
+	}
+	if err == nil {
+		s.clock.Sleep(s.timeout)
+	}
+	s.capture.lock.Lock()
+	events := s.capture.events
+	s.capture.running, s.capture.events = false, nil
+	s.capture.lock.Unlock()
+	if err != nil {
+		return 0, 0, fmt.Errorf("DHTSensor: %w", err)
+	}
+	data, err := decodeDHT(events)
+	if err != nil {
+		return 0, 0, err
+	}
+	celsius, humidity = s.model.convert(data)
+	return celsius, humidity, nil
+}
+
+// The 5 bytes of an answer from its edges: the last 40 high pulses are the bits, MSB first.
+// Edges of the start pulse, and the high pulse announcing the answer, come before them.
+func decodeDHT(events []EdgeEvent) (data [5]byte, err error) {
+	var widths []time.Duration
+	var rose time.Duration
+	high := false
+	for _, ev := range events {
+		if ev.Missed > 0 {
+			return data, fmt.Errorf("DHTSensor: %d edges missed: %w", ev.Missed, ErrTimeout)
+		}
+		t := ev.at()
+		if ev.Edge == RISING {
+			rose, high = t, true
+		} else if high {
+			widths, high = append(widths, t-rose), false
+		}
+	}
+	if len(widths) < 40 {
+		return data, fmt.Errorf("DHTSensor: %d of 40 bits received: %w", len(widths), ErrTimeout)
+	}
+	for i, width := range widths[len(widths)-40:] {
+		if width > dht_bit_threshold_ {
+			data[i/8] |= 0x80 >> uint(i%8)
+		}
+	}
+	if sum := data[0] + data[1] + data[2] + data[3]; sum != data[4] {
+		return data, fmt.Errorf("DHTSensor: data % x, checksum %#02x instead of %#02x: %w", data[:4], data[4], sum, ErrChecksum)
+	}
+	return data, nil
+}
+
+func (model DHTModel) convert(data [5]byte) (celsius, humidity float64) {
+	if model == DHT11 {
+		return float64(data[2]) + float64(data[3]&0x0f)/10, float64(data[0])
+	}
+	humidity = float64(uint16(data[0])<<8|uint16(data[1])) / 10
+	celsius = float64(uint16(data[2]&0x7f)<<8|uint16(data[3])) / 10
+	if data[2]&0x80 != 0 {
+		celsius = -celsius
+	}
+	return celsius, humidity
+}
+
+var (
+	_ EdgeEventGPIO = (*CdevGPIO)(nil)
+	_ EdgeEventGPIO = (*SysfsGPIO)(nil)
+	_ EdgeEventGPIO = (*FakeGPIO)(nil)
+)
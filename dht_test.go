@@ -0,0 +1,145 @@
+package bbhw
+
+import (
+	"bufio"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// edges recorded from a sensor, one "timestamp_ns rising|falling" per line
+func loadEdgeFixture(t *testing.T, fixture string) (events []EdgeEvent) {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		ns, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil || len(fields) != 2 {
+			t.Fatalf("%s: %q", fixture, line)
+		}
+		ev := EdgeEvent{Timestamp: time.Duration(ns), Edge: FALLING, Time: time.Unix(0, ns)}
+		if fields[1] == "rising" {
+			ev.Edge, ev.State = RISING, true
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
+func Test_DHTDecodeFixtures(t *testing.T) {
+	for _, c := range []struct {
+		fixture           string
+		model             DHTModel
+		celsius, humidity float64
+		err               error
+	}{
+		{"dht22-edges-23.4C-65.2RH", DHT22, 23.4, 65.2, nil},
+		{"dht22-edges-minus10.1C-45.0RH", DHT22, -10.1, 45, nil},
+		{"dht11-edges-24.3C-40RH", DHT11, 24.3, 40, nil},
+		{"dht22-edges-bitflip", DHT22, 0, 0, ErrChecksum},
+		{"dht22-edges-truncated", DHT22, 0, 0, ErrTimeout},
+	} {
+		data, err := decodeDHT(loadEdgeFixture(t, c.fixture))
+		if !errors.Is(err, c.err) {
+			t.Errorf("%s: %v, expected %v", c.fixture, err, c.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if celsius, humidity := c.model.convert(data); math.Abs(celsius-c.celsius) > 1e-9 || math.Abs(humidity-c.humidity) > 1e-9 {
+			t.Errorf("%s: %v°C %v%%, expected %v°C %v%%", c.fixture, celsius, humidity, c.celsius, c.humidity)
+		}
+	}
+	// an edge lost on the way invalidates the answer, even if the bits happen to add up
+	events := loadEdgeFixture(t, "dht22-edges-23.4C-65.2RH")
+	events[40].Missed = 1
+	if _, err := decodeDHT(events); !errors.Is(err, ErrTimeout) {
+		t.Errorf("missed edge: %v", err)
+	}
+}
+
+func Test_DHTSensorRead(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	gpio := NewFakeNamedGPIO("DHT", IN, nil)
+	gpio.SetClock(clock)
+	t.Cleanup(gpio.Close)
+	s, err := NewDHTSensor(gpio, DHT22, DHTWithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	type result struct {
+		celsius, humidity float64
+		err               error
+	}
+	results := make(chan result, 1)
+	afterTimer(t, clock, func() {
+		go func() {
+			var r result
+			r.celsius, r.humidity, r.err = s.Read()
+			results <- r
+		}()
+	})
+	if dir, _ := gpio.CheckDirection(); dir != OUT || GetStateOrPanic(gpio) {
+		t.Fatal("no start pulse")
+	}
+	// the end of the start pulse, then waiting for the answer
+	afterTimer(t, clock, func() { clock.Advance(1100 * time.Microsecond) })
+	if dir, _ := gpio.CheckDirection(); dir != IN {
+		t.Fatal("line not released after the start pulse")
+	}
+	// the sensor answers with the recorded edges. One at a time, as all of them would pass in no time of
+	// the ManualClock, faster than the edge callback delivers them.
+	events := loadEdgeFixture(t, "dht22-edges-23.4C-65.2RH")
+	for i, ev := range events {
+		if i > 0 {
+			clock.Advance(ev.Timestamp - events[i-1].Timestamp)
+		}
+		gpio.FakeInput(ev.State)
+		for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Microsecond) {
+			s.capture.lock.Lock()
+			captured := len(s.capture.events)
+			s.capture.lock.Unlock()
+			if captured == i+1 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("edge %d not captured", i)
+			}
+		}
+	}
+	clock.Advance(20 * time.Millisecond)
+	select {
+	case r := <-results:
+		if r.err != nil || math.Abs(r.celsius-23.4) > 1e-9 || math.Abs(r.humidity-65.2) > 1e-9 {
+			t.Errorf("Read() = %v°C %v%%, %v", r.celsius, r.humidity, r.err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Read did not return")
+	}
+	// nobody answering
+	afterTimer(t, clock, func() {
+		go func() {
+			_, _, err := s.Read()
+			results <- result{err: err}
+		}()
+	})
+	advanceSteps(t, clock, 20*time.Millisecond, 20*time.Millisecond)
+	if r := <-results; !errors.Is(r.err, ErrTimeout) {
+		t.Errorf("Read() without sensor: %v", r.err)
+	}
+}
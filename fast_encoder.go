@@ -0,0 +1,193 @@
+package bbhw
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// Option of NewFastEncoder
+type FastEncoderOption func(*FastEncoder)
+
+// samples every interval instead of as fast as possible, which keeps a CPU busy
+func FastEncoderWithInterval(interval time.Duration) FastEncoderOption {
+	return func(e *FastEncoder) { e.interval = interval }
+}
+
+// time over which Velocity and FastEncoderStats.SampleRate are averaged, default 100ms
+func FastEncoderWithWindow(window time.Duration) FastEncoderOption {
+	return func(e *FastEncoder) { e.window = window }
+}
+
+// times the samples on c
+func FastEncoderWithClock(c Clock) FastEncoderOption {
+	return func(e *FastEncoder) { e.clock = c }
+}
+
+// Counters of a FastEncoder since construction
+type FastEncoderStats struct {
+	Samples     uint64
+	Transitions uint64  // quarter steps decoded
+	Illegal     uint64  // samples with both A and B changed, i.e. quarter steps missed
+	ReadErrors  uint64  // failed ReadBank, the sample is skipped
+	SampleRate  float64 // samples per second over the last window
+}
+
+// Share of the transitions seen that were illegal. Anything above 0 means the encoder turned faster than
+// half the sample rate at times and Position lost up to 2 counts per illegal transition.
+func (s FastEncoderStats) ErrorRate() float64 {
+	if s.Transitions+s.Illegal == 0 {
+		return 0
+	}
+	return float64(s.Illegal) / float64(s.Transitions+s.Illegal)
+}
+
+// Quadrature decoder for fast encoders (e.g. on a spindle) sampling A and B together with GPIOBank.ReadBank
+// in a tight loop on its own goroutine, where edge callbacks of a RotaryEncoder could not keep up.
+// Position counts every quarter step (4 per cycle). Both inputs changing between two samples cannot be decoded,
+// it is counted as illegal in FastEncoderStats instead.
+type FastEncoder struct {
+	bank       GPIOBank
+	bankno     int
+	bita, bitb uint
+	interval   time.Duration
+	window     time.Duration
+	clock      Clock
+	stop       chan struct{}
+	done       chan struct{}
+	closing    uint32
+	// only used by the sampling goroutine
+	state       int // A<<1|B
+	moved       int64
+	windowStart time.Time
+	windowMoved int64
+	windowSeen  uint64
+	// read by the other methods
+	position    int64
+	velocity    uint64 // math.Float64bits, counts per second
+	sampleRate  uint64 // math.Float64bits
+	samples     uint64
+	transitions uint64
+	illegal     uint64
+	readErrors  uint64
+}
+
+// Decodes bits bita (A) and bitb (B) of bank, both have to be inputs.
+func NewFastEncoder(bank GPIOBank, bankno int, bita, bitb uint, opts ...FastEncoderOption) (*FastEncoder, error) {
+	if bank == nil {
+		panic("bank == nil")
+	}
+	e := &FastEncoder{bank: bank, bankno: bankno, bita: bita, bitb: bitb, window: 100 * time.Millisecond,
+		stop: make(chan struct{}), done: make(chan struct{})}
+	for _, opt := range opts {
+		opt(e)
+	}
+	if e.clock == nil {
+		e.clock = defaultClock()
+	}
+	if bita > 31 || bitb > 31 || bita == bitb {
+		return nil, fmt.Errorf("FastEncoder: invalid bits %d and %d", bita, bitb)
+	}
+	if e.interval < 0 || e.window <= 0 {
+		return nil, fmt.Errorf("FastEncoder: invalid interval %v or window %v", e.interval, e.window)
+	}
+	outputs, err := bank.BankDirection(bankno)
+	if err != nil {
+		return nil, err
+	}
+	if outputs := outputs & (1<<bita | 1<<bitb); outputs != 0 {
+		return nil, fmt.Errorf("FastEncoder: bank %d: %#08x are outputs", bankno, outputs)
+	}
+	value, err := bank.ReadBank(bankno)
+	if err != nil {
+		return nil, err
+	}
+	e.state = e.decodeState(value)
+	e.windowStart = e.clock.Now()
+	go e.run()
+	return e, nil
+}
+
+func (e *FastEncoder) decodeState(value uint32) int {
+	return int(value>>e.bita&1)<<1 | int(value>>e.bitb&1)
+}
+
+func (e *FastEncoder) run() {
+	defer close(e.done)
+	if e.interval == 0 {
+		for atomic.LoadUint32(&e.closing) == 0 {
+			e.sample(e.clock.Now())
+		}
+		return
+	}
+	next := e.clock.Now()
+	for {
+		next = next.Add(e.interval)
+		select {
+		case <-e.stop:
+			return
+		case <-e.clock.After(next.Sub(e.clock.Now())):
+		}
+		e.sample(e.clock.Now())
+	}
+}
+
+// reads and decodes one sample, only called by the sampling goroutine
+func (e *FastEncoder) sample(now time.Time) {
+	value, err := e.bank.ReadBank(e.bankno)
+	if err != nil {
+		atomic.AddUint64(&e.readErrors, 1)
+		return
+	}
+	samples := atomic.AddUint64(&e.samples, 1)
+	if state := e.decodeState(value); state != e.state {
+		if state^e.state == 3 {
+			atomic.AddUint64(&e.illegal, 1)
+		} else {
+			delta := int64(encoder_quarters_[e.state<<2|state])
+			e.moved += delta
+			atomic.AddInt64(&e.position, delta)
+			atomic.AddUint64(&e.transitions, 1)
+		}
+		e.state = state
+	}
+	if elapsed := now.Sub(e.windowStart); elapsed >= e.window {
+		atomic.StoreUint64(&e.velocity, math.Float64bits(float64(e.moved-e.windowMoved)/elapsed.Seconds()))
+		atomic.StoreUint64(&e.sampleRate, math.Float64bits(float64(samples-e.windowSeen)/elapsed.Seconds()))
+		e.windowStart, e.windowMoved, e.windowSeen = now, e.moved, samples
+	}
+}
+
+// quarter steps since construction or Reset, positive if A leads B
+func (e *FastEncoder) Position() int64 {
+	return atomic.LoadInt64(&e.position)
+}
+
+// Sets Position to 0, returns the one before
+func (e *FastEncoder) Reset() int64 {
+	return atomic.SwapInt64(&e.position, 0)
+}
+
+// quarter steps per second over the last window, 0 until the first window passed
+func (e *FastEncoder) Velocity() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&e.velocity))
+}
+
+func (e *FastEncoder) Stats() FastEncoderStats {
+	return FastEncoderStats{
+		Samples:     atomic.LoadUint64(&e.samples),
+		Transitions: atomic.LoadUint64(&e.transitions),
+		Illegal:     atomic.LoadUint64(&e.illegal),
+		ReadErrors:  atomic.LoadUint64(&e.readErrors),
+		SampleRate:  math.Float64frombits(atomic.LoadUint64(&e.sampleRate)),
+	}
+}
+
+// Stops sampling and waits for the goroutine to end, Position and Stats stay readable
+func (e *FastEncoder) Close() {
+	if atomic.CompareAndSwapUint32(&e.closing, 0, 1) {
+		close(e.stop)
+	}
+	<-e.done
+}
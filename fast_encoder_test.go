@@ -0,0 +1,144 @@
+package bbhw
+
+import (
+	"testing"
+	"time"
+)
+
+const (
+	fast_encoder_a_ = 4
+	fast_encoder_b_ = 5
+)
+
+// sets A and B from state A<<1|B
+func fakeEncoderState(bank *FakeGPIOBank, state int) {
+	bank.FakeInputBank(0, 1<<fast_encoder_a_|1<<fast_encoder_b_, uint32(state>>1)<<fast_encoder_a_|uint32(state&1)<<fast_encoder_b_)
+}
+
+// A leading B
+var quadrature_forward_ = []int{2, 3, 1, 0}
+
+func Test_FastEncoderDecode(t *testing.T) {
+	// the goroutine never samples, the test calls sample
+	clock := NewManualClock(time.Unix(1000, 0))
+	bank := NewFakeGPIOBank(1)
+	e, err := NewFastEncoder(bank, 0, fast_encoder_a_, fast_encoder_b_, FastEncoderWithInterval(time.Hour), FastEncoderWithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	for i := 0; i < 16; i++ {
+		fakeEncoderState(bank, quadrature_forward_[i%4])
+		e.sample(clock.Now())
+		e.sample(clock.Now())
+	}
+	if e.Position() != 16 {
+		t.Fatalf("Position() = %d after 4 cycles", e.Position())
+	}
+	for i := 7; i >= 0; i-- {
+		fakeEncoderState(bank, quadrature_forward_[(i+3)%4])
+		e.sample(clock.Now())
+	}
+	if e.Position() != 8 {
+		t.Fatalf("Position() = %d after 2 cycles back", e.Position())
+	}
+	// 00 -> 11, a quarter step in between was not sampled
+	fakeEncoderState(bank, 3)
+	e.sample(clock.Now())
+	stats := e.Stats()
+	if e.Position() != 8 || stats.Illegal != 1 || stats.Transitions != 24 || stats.Samples != 41 {
+		t.Errorf("after an illegal transition: position %d, %+v", e.Position(), stats)
+	}
+	if rate := stats.ErrorRate(); rate != 1.0/25 {
+		t.Errorf("ErrorRate() = %v", rate)
+	}
+	if e.Reset() != 8 || e.Position() != 0 {
+		t.Error("Reset")
+	}
+}
+
+func Test_FastEncoderVelocity(t *testing.T) {
+	// the goroutine never samples, the test calls sample
+	clock := NewManualClock(time.Unix(1000, 0))
+	bank := NewFakeGPIOBank(1)
+	e, err := NewFastEncoder(bank, 0, fast_encoder_a_, fast_encoder_b_, FastEncoderWithInterval(time.Hour), FastEncoderWithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	// a quarter step every 10ms, sampled every 10ms
+	for i := 0; i < 10; i++ {
+		clock.Advance(10 * time.Millisecond)
+		fakeEncoderState(bank, quadrature_forward_[i%4])
+		e.sample(clock.Now())
+	}
+	if v, rate := e.Velocity(), e.Stats().SampleRate; v != 100 || rate != 100 {
+		t.Errorf("Velocity() = %v, sample rate %v", v, rate)
+	}
+	// backwards, a quarter step every 5ms sampled every 1ms
+	for i := 1; i <= 100; i++ {
+		clock.Advance(time.Millisecond)
+		if i%5 == 0 {
+			fakeEncoderState(bank, quadrature_forward_[(29-i/5)%4])
+		}
+		e.sample(clock.Now())
+	}
+	if v, rate := e.Velocity(), e.Stats().SampleRate; v != -200 || rate != 1000 {
+		t.Errorf("backwards Velocity() = %v, sample rate %v", v, rate)
+	}
+}
+
+func Test_FastEncoderSampling(t *testing.T) {
+	// at an interval
+	clock := NewManualClock(time.Unix(1000, 0))
+	bank := NewFakeGPIOBank(1)
+	var e *FastEncoder
+	afterTimer(t, clock, func() {
+		var err error
+		if e, err = NewFastEncoder(bank, 0, fast_encoder_a_, fast_encoder_b_, FastEncoderWithInterval(time.Millisecond), FastEncoderWithClock(clock)); err != nil {
+			t.Fatal(err)
+		}
+	})
+	for i := 0; i < 8; i++ {
+		fakeEncoderState(bank, quadrature_forward_[i%4])
+		afterTimer(t, clock, func() { clock.Advance(time.Millisecond) })
+	}
+	e.Close()
+	if stats := e.Stats(); e.Position() != 8 || stats.Samples != 8 || stats.Illegal != 0 {
+		t.Errorf("sampled every ms: position %d, %+v", e.Position(), stats)
+	}
+	// as fast as possible
+	e, err := NewFastEncoder(bank, 0, fast_encoder_a_, fast_encoder_b_)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	for i := 0; i < 8; i++ {
+		fakeEncoderState(bank, quadrature_forward_[(10-i)%4])
+		for deadline := time.Now().Add(time.Second); e.Position() != int64(-i-1); time.Sleep(time.Microsecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("Position() = %d, expected %d", e.Position(), -i-1)
+			}
+		}
+	}
+	e.Close()
+	if stats := e.Stats(); stats.Illegal != 0 || stats.Samples < 8 {
+		t.Errorf("sampled as fast as possible: %+v", stats)
+	}
+}
+
+func Test_FastEncoderErrors(t *testing.T) {
+	bank := NewFakeGPIOBank(1)
+	bank.SetBankDirection(0, 1<<fast_encoder_b_)
+	if _, err := NewFastEncoder(bank, 0, fast_encoder_a_, fast_encoder_b_); err == nil {
+		t.Error("output accepted")
+	}
+	for _, bits := range [][2]uint{{3, 3}, {1, 32}} {
+		if _, err := NewFastEncoder(bank, 0, bits[0], bits[1]); err == nil {
+			t.Errorf("bits %v accepted", bits)
+		}
+	}
+	if _, err := NewFastEncoder(bank, 1, 0, 1); err == nil {
+		t.Error("missing bank accepted")
+	}
+}
@@ -0,0 +1,105 @@
+package bbhw
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Exposes GPIOs keyed by pin name with the methods gobot's gpio drivers (buttons, relays, LEDs, ...)
+// expect from their adaptor (gobot.Adaptor, gpio.DigitalReader and gpio.DigitalWriter),
+// so e.g. MMappedGPIOs can be used underneath existing gobot device drivers. Does not import gobot,
+// its interfaces are satisfied structurally.
+// Like other gobot adaptors, DigitalWrite switches an input to output.
+type GobotAdaptor struct {
+	name string
+	pins map[string]GPIO
+	lock sync.Mutex
+}
+
+// pins is copied, the adaptor owns the GPIOs afterwards (Finalize closes them)
+func NewGobotAdaptor(pins map[string]GPIO) *GobotAdaptor {
+	a := &GobotAdaptor{name: "bbhw", pins: make(map[string]GPIO, len(pins))}
+	for name, gpio := range pins {
+		a.pins[name] = gpio
+	}
+	return a
+}
+
+func (a *GobotAdaptor) Name() string {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.name
+}
+
+func (a *GobotAdaptor) SetName(name string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.name = name
+}
+
+// nothing to do, the GPIOs are already set up
+func (a *GobotAdaptor) Connect() error { return nil }
+
+// Closes all GPIOs
+func (a *GobotAdaptor) Finalize() error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	for _, gpio := range a.pins {
+		gpio.Close()
+	}
+	a.pins = map[string]GPIO{}
+	return nil
+}
+
+func (a *GobotAdaptor) pin(name string) (GPIO, error) {
+	gpio, ok := a.pins[name]
+	if !ok {
+		names := make([]string, 0, len(a.pins))
+		for n := range a.pins {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("%s: no pin %q, have %v", a.name, name, names)
+	}
+	return gpio, nil
+}
+
+// level 0 sets the pin to false, anything else to true
+func (a *GobotAdaptor) DigitalWrite(pin string, level byte) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	gpio, err := a.pin(pin)
+	if err != nil {
+		return err
+	}
+	if dir, err := gpio.CheckDirection(); err != nil {
+		return fmt.Errorf("%s: pin %q: %w", a.name, pin, err)
+	} else if dir != OUT {
+		if err = gpio.SetDirection(OUT); err != nil {
+			return fmt.Errorf("%s: pin %q: %w", a.name, pin, err)
+		}
+	}
+	if err = gpio.SetState(level != 0); err != nil {
+		return fmt.Errorf("%s: pin %q: %w", a.name, pin, err)
+	}
+	return nil
+}
+
+// returns 1 or 0
+func (a *GobotAdaptor) DigitalRead(pin string) (int, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	gpio, err := a.pin(pin)
+	if err != nil {
+		return 0, err
+	}
+	state, err := gpio.GetState()
+	if err != nil {
+		return 0, fmt.Errorf("%s: pin %q: %w", a.name, pin, err)
+	}
+	if state {
+		return 1, nil
+	}
+	return 0, nil
+}
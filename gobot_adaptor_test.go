@@ -0,0 +1,72 @@
+package bbhw
+
+import "testing"
+
+// what gobot's gpio drivers need from an adaptor
+type gobotDigitalAdaptor interface {
+	Name() string
+	SetName(string)
+	Connect() error
+	Finalize() error
+	DigitalRead(string) (int, error)
+	DigitalWrite(string, byte) error
+}
+
+// a driver written the way gobot's LedDriver and ButtonDriver are
+type gobotStyleRelay struct {
+	pin        string
+	connection gobotDigitalAdaptor
+	high       bool
+}
+
+func (r *gobotStyleRelay) Toggle() error {
+	level := byte(0)
+	if !r.high {
+		level = 1
+	}
+	if err := r.connection.DigitalWrite(r.pin, level); err != nil {
+		return err
+	}
+	r.high = !r.high
+	return nil
+}
+
+func Test_GobotAdaptor(t *testing.T) {
+	relay, button, probe := NewFakeNamedGPIO("relay", IN, nil), NewFakeNamedGPIO("button", IN, nil), NewFakeNamedGPIO("probe", IN, nil)
+	relay.ConnectTo(probe)
+	var a gobotDigitalAdaptor = NewGobotAdaptor(map[string]GPIO{"P8_12": relay, "P8_14": button})
+	if err := a.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	driver := &gobotStyleRelay{pin: "P8_12", connection: a}
+	for _, want := range []bool{true, false, true} {
+		if err := driver.Toggle(); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := probe.GetState(); got != want {
+			t.Errorf("relay pin is %v after Toggle, expected %v", got, want)
+		}
+	}
+	if dir, _ := relay.CheckDirection(); dir != OUT {
+		t.Error("DigitalWrite did not switch the input to output")
+	}
+
+	button.FakeInput(true)
+	if v, err := a.DigitalRead("P8_14"); err != nil || v != 1 {
+		t.Errorf("DigitalRead of pressed button = %d, %v", v, err)
+	}
+	button.FakeInput(false)
+	if v, err := a.DigitalRead("P8_14"); err != nil || v != 0 {
+		t.Errorf("DigitalRead of released button = %d, %v", v, err)
+	}
+	if _, err := a.DigitalRead("P9_99"); err == nil {
+		t.Error("DigitalRead of unknown pin succeeded")
+	}
+	if err := a.DigitalWrite("P9_99", 1); err == nil {
+		t.Error("DigitalWrite of unknown pin succeeded")
+	}
+	a.SetName("beaglebone")
+	if err := a.Finalize(); err != nil || a.Name() != "beaglebone" {
+		t.Errorf("Finalize() = %v, Name() = %q", err, a.Name())
+	}
+}
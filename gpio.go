@@ -3,7 +3,10 @@
 package bbhw
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"math"
 	"time"
 )
 
@@ -11,37 +14,258 @@ type GPIOControllablePin interface {
 	SetState(bool) error
 	SetStateNow(bool) error
 	GetState() (bool, error)
-	CheckDirection() (int, error)
+	CheckDirection() (Direction, error)
 	SetActiveLow(bool) error
 }
 
+// Common interface of the single pin GPIO implementations, as returned by NewBestGPIO
+type GPIO interface {
+	GPIOControllablePin
+	SetDirection(Direction) error
+	Close()
+	Backend() string // one of the BACKEND_* constants
+	Capabilities() GPIOCapabilities
+	Snapshot() PinSnapshot
+	// SetLogicalInvert inverts the meaning of SetState, GetState and edges in software, e.g. for loads
+	// behind an inverting transistor driver, without touching active_low (which MMappedGPIO does not even have in the kernel).
+	// Both inversions compose:
+	//
+	//	active_low  logical invert  SetState(true) drives
+	//	false       false           high
+	//	true        false           low
+	//	false       true            low
+	//	true        true            high
+	//
+	// Edges refer to the logical state: with a single inversion SetEdge(RISING) reports falling edges on the wire.
+	// Changing the inversion does not change what an output drives, only how it is interpreted.
+	SetLogicalInvert(bool) error
+}
+
+// A GPIO which can report edges on inputs (SysfsGPIO, CdevGPIO and HybridGPIO)
+type EdgeGPIO interface {
+	GPIO
+	SetEdge(Edge) error
+	GetEdge() (string, error)
+	SetEdgeCallback(*chan bool, int) error
+}
+
+// An EdgeGPIO delivering timestamped EdgeEvents (CdevGPIO, SysfsGPIO and FakeGPIO)
+type EdgeEventGPIO interface {
+	EdgeGPIO
+	SetEdgeEventCallback(chan<- EdgeEvent, int) error
+}
+
+// Everything of SysfsGPIO which does not need sysfs (i.e. all but its Number field),
+// implemented by FakeGPIO as well so tests can swap one for the other without type switches
+type SysfsCompatibleGPIO interface {
+	EdgeGPIO
+	SetEdgeEventCallback(chan<- EdgeEvent, int) error
+	SetBias(int) error
+	SetDriveMode(int) error
+	SetLogger(Logger)
+	GetStateCached(maxAge time.Duration) (bool, error)
+	ReOpen() error
+	Reinitialize() error
+	VerifyResponsive() error
+	Config() GPIOConfig
+	ApplyConfig(GPIOConfig) error
+}
+
+// Optional features of a GPIO implementation, see GPIO.Capabilities.
+// Methods for features not supported either do not exist or return ErrNotSupported
+type GPIOCapabilities struct {
+	ActiveLow      bool // SetActiveLow works
+	Bias           bool // SetBias
+	DriveMode      bool // SetDriveMode (open-drain / open-source)
+	Edges          bool // implements EdgeGPIO
+	EdgeTimestamps bool // EdgeEvent.Timestamp is a kernel timestamp
+}
+
+// Names of the GPIO implementations, returned by GPIO.Backend()
+const (
+	BACKEND_MMAPPED = "mmapped"
+	BACKEND_CDEV    = "cdev"
+	BACKEND_SYSFS   = "sysfs"
+	BACKEND_HYBRID  = "hybrid"
+	BACKEND_FAKE    = "fake"
+)
+
 type GPIOCollectionFactory interface {
 	EndTransactionApplySetStates()
 	BeginTransactionRecordSetStates()
-	NewGPIO(uint, int) GPIOControllablePinInCollection
+	NewGPIO(uint, Direction) GPIOControllablePinInCollection
 }
 
 type GPIOControllablePinInCollection interface {
 	SetState(bool) error
 	SetStateNow(bool) error
 	GetState() (bool, error)
-	CheckDirection() (int, error)
+	CheckDirection() (Direction, error)
 	SetActiveLow(bool) error
 	SetFutureState(state bool) error
 	GetFutureState() (state_known, state bool, err error)
 }
 
+// Direction of a GPIO. A type of its own, so an Edge can not be passed by accident.
+// Code keeping directions in int variables needs to convert them: Direction(d)
+type Direction int
+
 const (
-	IN = iota
+	IN Direction = iota
 	OUT
 )
 
-type ADC interface {
+func (d Direction) String() string {
+	switch d {
+	case IN:
+		return "in"
+	case OUT:
+		return "out"
+	}
+	return fmt.Sprintf("Direction(%d)", int(d))
+}
+
+// returns an error wrapping ErrInvalidDirection unless d is IN or OUT
+func validateDirection(d Direction) error {
+	if d != IN && d != OUT {
+		return fmt.Errorf("%d is neither IN nor OUT: %w", int(d), ErrInvalidDirection)
+	}
+	return nil
+}
+
+// returns an error wrapping ErrInvalidDirection unless gpio is an output
+func checkOutput(gpio GPIOControllablePin, user string) error {
+	dir, err := gpio.CheckDirection()
+	if err != nil {
+		return err
+	}
+	if dir != OUT {
+		return fmt.Errorf("%s needs an output: %w", user, ErrInvalidDirection)
+	}
+	return nil
+}
+
+// RISING and FALLING swapped if invert, for SetLogicalInvert
+func invertEdge(edge Edge, invert bool) Edge {
+	if invert && edge == RISING {
+		return FALLING
+	} else if invert && edge == FALLING {
+		return RISING
+	}
+	return edge
+}
+
+// Constants for internal pull-up/pull-down resistors (bias).
+// BIAS_AS_IS leaves the bias as configured by the kernel / device tree
+const (
+	BIAS_AS_IS = iota
+	PULLUP
+	PULLDOWN
+	BIAS_DISABLED
+)
+
+// Constants for output drive modes.
+// An OPEN_DRAIN output only actively drives low, an OPEN_SOURCE output only actively drives high,
+// otherwise the line is released and pulled to the level given by the bias / external resistors
+const (
+	PUSH_PULL = iota
+	OPEN_DRAIN
+	OPEN_SOURCE
+)
+
+// returned by backends which can not provide a feature, e.g. SetBias on SysfsGPIO
+var ErrNotSupported = errors.New("not supported by this GPIO backend")
+
+// returned (wrapped) by operations on a CdevGPIO after Close
+var ErrClosed = errors.New("GPIO closed")
+
+// returned by constructors and SetDirection for a direction other than IN or OUT
+var ErrInvalidDirection = errors.New("invalid direction")
+
+// returned (wrapped in a *GPIOError) if a sysfs attribute file holds garbage
+var ErrInvalidAttribute = errors.New("unexpected content")
+
+// Error of an operation on a GPIO, e.g. Op "write value" on Number 44.
+// Wraps the underlying error, so errors.Is(err, os.ErrPermission), errors.Is(err, os.ErrNotExist)
+// (e.g. GPIO not exported) or errors.Is(err, ErrInvalidAttribute) work.
+type GPIOError struct {
+	Number uint
+	Op     string
+	Err    error
+}
+
+func (e *GPIOError) Error() string { return fmt.Sprintf("gpio%d: %s: %v", e.Number, e.Op, e.Err) }
+
+func (e *GPIOError) Unwrap() error { return e.Err }
+
+// Edge reported by the edge callbacks of the sysfs and cdev backends
+type EdgeEvent struct {
+	State bool      // logical state after the edge
+	Edge  Edge      // RISING or FALLING
+	Time  time.Time // time the edge occured (cdev) or was noticed (sysfs)
+	// Raw kernel timestamp of the edge, see CdevGPIO.SetEdgeEventCallback for the clock used.
+	// Zero for backends without kernel timestamps (sysfs)
+	Timestamp time.Duration
+	// Sequence numbers assigned by the kernel (cdev only): Seqno counts events of the whole line request,
+	// LineSeqno events of this line
+	Seqno, LineSeqno uint32
+	// Number of events of this line lost (e.g. due to kernel buffer overflow) right before this one.
+	// Non-zero flags a gap, e.g. frequency counters should invalidate their current measurement
+	Missed uint32
+}
+
+// the kernel timestamp, or Time for backends without, to measure between events of one GPIO
+func (ev EdgeEvent) at() time.Duration {
+	if ev.Timestamp == 0 {
+		return time.Duration(ev.Time.UnixNano())
+	}
+	return ev.Timestamp
+}
+
+// ADC input of BBBLegacyADC and FakeLegacyADC, SysfsADC and FakeADC implement ADC.
+// It was named ADC before ADC became the interface of the IIO ADCs.
+//
+// Deprecated: use ADC, ToLegacyADC wraps one channel of it for code still taking a LegacyADC.
+type LegacyADC interface {
 	ReadValue() uint16
 	CheckErrorOccurred() error
 	ReadValueCheckError() (uint16, error)
 }
 
+type legacyADC struct {
+	adc     ADC
+	channel uint
+	err     error
+}
+
+// millivolts like the helper driver, clamped to uint16
+func (a *legacyADC) ReadValue() uint16 {
+	var mv int
+	mv, a.err = a.adc.ReadMillivolts(a.channel)
+	if mv < 0 {
+		return 0
+	} else if mv > math.MaxUint16 {
+		return math.MaxUint16
+	}
+	return uint16(mv)
+}
+
+func (a *legacyADC) CheckErrorOccurred() error { return a.err }
+
+func (a *legacyADC) ReadValueCheckError() (uint16, error) {
+	v := a.ReadValue()
+	return v, a.err
+}
+
+// Wraps channel of an ADC as LegacyADC for code still taking one. ReadValue returns millivolts, like BBBLegacyADC,
+// and CheckErrorOccurred the error of the last read.
+func ToLegacyADC(adc ADC, channel uint) LegacyADC {
+	if adc == nil {
+		panic("adc == nil")
+	}
+	return &legacyADC{adc: adc, channel: channel}
+}
+
 /// GPIOControllablePin Interface and Methods -----------------
 
 func GetStateOrPanic(gpio GPIOControllablePin) bool {
@@ -52,7 +276,7 @@ func GetStateOrPanic(gpio GPIOControllablePin) bool {
 	return r
 }
 
-func CheckDirectionOrPanic(gpio GPIOControllablePin) int {
+func CheckDirectionOrPanic(gpio GPIOControllablePin) Direction {
 	r, err := gpio.CheckDirection()
 	if err != nil {
 		panic(err)
@@ -81,7 +305,7 @@ func Step(gpio GPIOControllablePin, steps uint32, delay time.Duration, abortchec
 			log.Println("Step SetState Error:", err)
 			return
 		}
-		time.Sleep(delay)
+		defaultClock().Sleep(delay)
 		if c%2 == 0 && abortcheck != nil && abortcheck() {
 			break
 		}
@@ -0,0 +1,92 @@
+package bbhw
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors of the bank-wide operations, wrapped with bank and bits
+var (
+	ErrBankConflict  = errors.New("bits to be set and cleared at once")
+	ErrBankDirection = errors.New("bits are not outputs")
+)
+
+// Bank-wide access to the 32 GPIOs of a gpiochip at once, bit n of bank b being GPIO number b*32+n.
+// Implemented by MMappedGPIOCollectionFactory on the AM335x registers and by FakeGPIOBank for tests.
+// Values are electrical, SetActiveLow of single pins does not apply.
+type GPIOBank interface {
+	// levels of all bits, inputs as read and outputs as driven
+	ReadBank(bank int) (uint32, error)
+	// bits set are outputs
+	BankDirection(bank int) (outputs uint32, err error)
+	SetBankDirection(bank int, outputs uint32) error
+	// drives the bits in set high and those in clear low in the same instant, all of them must be outputs
+	SetClearBank(bank int, set, clear uint32) error
+}
+
+func checkSetClearBank(bank int, set, clear, outputs uint32) error {
+	if both := set & clear; both != 0 {
+		return fmt.Errorf("bank %d: %#08x: %w", bank, both, ErrBankConflict)
+	}
+	if inputs := (set | clear) &^ outputs; inputs != 0 {
+		return fmt.Errorf("bank %d: %#08x: %w", bank, inputs, ErrBankDirection)
+	}
+	return nil
+}
+
+func (gpiocf *MMappedGPIOCollectionFactory) bankRegisters(bank int) ([]uint32, error) {
+	mmapreg, err := getgpiommapOrError()
+	if err != nil {
+		return nil, err
+	}
+	if bank < 0 || bank >= len(mmapreg.memgpiochipreg32) {
+		return nil, fmt.Errorf("no gpio bank %d", bank)
+	}
+	return mmapreg.memgpiochipreg32[bank], nil
+}
+
+func (gpiocf *MMappedGPIOCollectionFactory) ReadBank(bank int) (uint32, error) {
+	regs, err := gpiocf.bankRegisters(bank)
+	if err != nil {
+		return 0, err
+	}
+	inputs := regs[intgpio_output_enabled_o32_]
+	return regs[intgpio_datain_o32_]&inputs | regs[intgpio_dataout_o32_]&^inputs, nil
+}
+
+func (gpiocf *MMappedGPIOCollectionFactory) BankDirection(bank int) (outputs uint32, err error) {
+	regs, err := gpiocf.bankRegisters(bank)
+	if err != nil {
+		return 0, err
+	}
+	return ^regs[intgpio_output_enabled_o32_], nil
+}
+
+// writes the output enable register, does not update /sys/class/gpio/gpioN/direction
+func (gpiocf *MMappedGPIOCollectionFactory) SetBankDirection(bank int, outputs uint32) error {
+	regs, err := gpiocf.bankRegisters(bank)
+	if err != nil {
+		return err
+	}
+	mmapreg := getgpiommap()
+	mmapreg.reglock.Lock()
+	defer mmapreg.reglock.Unlock()
+	regs[intgpio_output_enabled_o32_] = ^outputs
+	return nil
+}
+
+// Writes CLEARDATAOUT and SETDATAOUT of the bank, same as EndTransactionApplySetStates does
+func (gpiocf *MMappedGPIOCollectionFactory) SetClearBank(bank int, set, clear uint32) error {
+	regs, err := gpiocf.bankRegisters(bank)
+	if err != nil {
+		return err
+	}
+	if err = checkSetClearBank(bank, set, clear, ^regs[intgpio_output_enabled_o32_]); err != nil {
+		return err
+	}
+	regs[intgpio_cleardataout_o32_] = clear
+	regs[intgpio_setdataout_o32_] = set
+	return nil
+}
+
+var _ GPIOBank = (*MMappedGPIOCollectionFactory)(nil)
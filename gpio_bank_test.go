@@ -0,0 +1,99 @@
+package bbhw
+
+import (
+	"errors"
+	"testing"
+)
+
+// Behaviour every GPIOBank has to show. hardware is called after each write and emulates what the
+// SoC does on its own (nil for fakes), inject sets the levels seen at the input bits.
+func checkGPIOBankBehaviour(t *testing.T, banks GPIOBank, hardware func(), inject func(bank int, levels uint32)) {
+	t.Helper()
+	if hardware == nil {
+		hardware = func() {}
+	}
+	if _, err := banks.ReadBank(17); err == nil {
+		t.Error("ReadBank of a bank that does not exist should fail")
+	}
+	if err := banks.SetBankDirection(1, 0x0000ffff); err != nil {
+		t.Fatal(err)
+	}
+	hardware()
+	if outputs, _ := banks.BankDirection(1); outputs != 0x0000ffff {
+		t.Errorf("BankDirection returned %#x", outputs)
+	}
+	if err := banks.SetClearBank(1, 0x00000005, 0x0000000a); err != nil {
+		t.Fatal(err)
+	}
+	hardware()
+	inject(1, 0x80000000)
+	if v, _ := banks.ReadBank(1); v != 0x80000005 {
+		t.Errorf("ReadBank returned %#08x", v)
+	}
+	if err := banks.SetClearBank(1, 0x00000002, 0x00000001); err != nil {
+		t.Fatal(err)
+	}
+	hardware()
+	if v, _ := banks.ReadBank(1); v != 0x80000006 {
+		t.Errorf("ReadBank returned %#08x", v)
+	}
+	if err := banks.SetClearBank(1, 0x3, 0x2); !errors.Is(err, ErrBankConflict) {
+		t.Errorf("expected ErrBankConflict, got %v", err)
+	}
+	if err := banks.SetClearBank(1, 0x00010000, 0); !errors.Is(err, ErrBankDirection) {
+		t.Errorf("expected ErrBankDirection, got %v", err)
+	}
+	hardware()
+	if v, _ := banks.ReadBank(1); v != 0x80000006 {
+		t.Errorf("refused SetClearBank changed the bank to %#08x", v)
+	}
+}
+
+func Test_GPIOBankMMapped(t *testing.T) {
+	mmapreg := useFakeGPIORegisters(t)
+	for _, regs := range mmapreg.memgpiochipreg32 {
+		regs[intgpio_output_enabled_o32_] = 0xffffffff // reset value, all inputs
+	}
+	// what the GPIO module does with writes to SETDATAOUT and CLEARDATAOUT
+	hardware := func() {
+		for _, regs := range mmapreg.memgpiochipreg32 {
+			regs[intgpio_dataout_o32_] = regs[intgpio_dataout_o32_]&^regs[intgpio_cleardataout_o32_] | regs[intgpio_setdataout_o32_]
+			regs[intgpio_cleardataout_o32_], regs[intgpio_setdataout_o32_] = 0, 0
+		}
+	}
+	inject := func(bank int, levels uint32) {
+		mmapreg.memgpiochipreg32[bank][intgpio_datain_o32_] = levels
+	}
+	checkGPIOBankBehaviour(t, NewMMappedGPIOCollectionFactory(), hardware, inject)
+}
+
+func Test_GPIOBankFake(t *testing.T) {
+	fb := NewFakeGPIOBank(4)
+	checkGPIOBankBehaviour(t, fb, nil, func(bank int, levels uint32) { fb.FakeInputBank(bank, 0xffffffff, levels) })
+}
+
+func Test_FakeGPIOBankWiring(t *testing.T) {
+	fb := NewFakeGPIOBank(4)
+	fb.EnableHistory(10)
+	led := NewFakeGPIO(32+3, IN)
+	button := NewFakeGPIO(32+4, OUT)
+	fb.WireBit(1, 3, led)
+	fb.WireBit(1, 4, button)
+	fb.SetBankDirection(1, 1<<3)
+	fb.SetClearBank(1, 1<<3, 0)
+	if !GetStateOrPanic(led) {
+		t.Error("wired FakeGPIO should follow the output bit")
+	}
+	button.SetState(true)
+	if v, _ := fb.ReadBank(1); v != 1<<3|1<<4 {
+		t.Errorf("input bit should follow the wired FakeGPIO, bank reads %#08x", v)
+	}
+	fb.SetClearBank(1, 0, 1<<3)
+	if GetStateOrPanic(led) {
+		t.Error("wired FakeGPIO should follow the output bit")
+	}
+	h := fb.History()
+	if len(h) != 3 || h[0].Value != 1<<3 || h[2].Value != 1<<4 || h[2].Bank != 1 {
+		t.Errorf("unexpected History %+v", h)
+	}
+}
@@ -0,0 +1,173 @@
+package bbhw
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// SysfsGPIO backed by a temporary file instead of /sys/class/gpio/gpioN/value
+func newTempfileSysfsGPIO(b testing.TB) *SysfsGPIO {
+	fd, err := ioutil.TempFile("", "bbhw-bench-value")
+	if err != nil {
+		b.Fatal(err)
+	}
+	fd.WriteString("0\n")
+	b.Cleanup(func() { fd.Close(); os.Remove(fd.Name()) })
+	return &SysfsGPIO{Number: 0, fd: fd}
+}
+
+// replaces the memory mapped registers with plain byte slices
+func useFakeGPIORegisters(b testing.TB) *mappedRegisters {
+	prev := mmapped_gpio_register_
+	mmapreg := new(mappedRegisters)
+	mmapreg.memgpiochipreg = make([][]byte, 4)
+	mmapreg.memgpiochipreg32 = make([][]uint32, 4)
+	for i := range mmapreg.memgpiochipreg {
+		mmapreg.memgpiochipreg[i] = make([]byte, gpio_pagesize_)
+		mmapreg.memgpiochipreg32[i] = castByteSliceToUint32Slice(mmapreg.memgpiochipreg[i])
+	}
+	mmapped_gpio_register_ = mmapreg
+	b.Cleanup(func() { mmapped_gpio_register_ = prev })
+	return mmapreg
+}
+
+func newFakeRegisterMMappedGPIO(number uint) *MMappedGPIO {
+	gpio := new(MMappedGPIO)
+	gpio.chipid, gpio.gpioid = calcGPIOAddrFromLinuxGPIONum(number)
+	return gpio
+}
+
+func Benchmark_SysfsGPIOSetState(b *testing.B) {
+	gpio := newTempfileSysfsGPIO(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		gpio.SetState(i%2 == 0)
+	}
+}
+
+func Benchmark_SysfsGPIOGetState(b *testing.B) {
+	gpio := newTempfileSysfsGPIO(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := gpio.GetState(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func Benchmark_FakeGPIOSetState(b *testing.B) {
+	gpio := NewFakeGPIO(1, OUT)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		gpio.SetState(i%2 == 0)
+	}
+}
+
+func Benchmark_FakeGPIOGetState(b *testing.B) {
+	gpio := NewFakeGPIO(1, IN)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		gpio.GetState()
+	}
+}
+
+func Benchmark_MMappedGPIOToggle(b *testing.B) {
+	useFakeGPIORegisters(b)
+	gpio := newFakeRegisterMMappedGPIO(67)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		gpio.SetState(i%2 == 0)
+	}
+}
+
+func Benchmark_MMappedGPIOGetState(b *testing.B) {
+	useFakeGPIORegisters(b)
+	gpio := newFakeRegisterMMappedGPIO(67)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		gpio.GetState()
+	}
+}
+
+func Benchmark_MMappedGPIOCollectionApply(b *testing.B) {
+	useFakeGPIORegisters(b)
+	gpiocf := NewMMappedGPIOCollectionFactory()
+	gpio := new(MMappedGPIOInCollection)
+	gpio.chipid, gpio.gpioid = calcGPIOAddrFromLinuxGPIONum(67)
+	gpio.collection = gpiocf
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		gpiocf.BeginTransactionRecordSetStates()
+		gpio.SetState(i%2 == 0)
+		gpiocf.EndTransactionApplySetStates()
+	}
+}
+
+// FastEncoder whose goroutine never samples, the benchmark calls sample.
+// The reported samples/s are the upper limit of the sample rate, i.e. twice the highest quarter step rate.
+func benchmarkFastEncoderSample(b *testing.B, bank GPIOBank, turn func(i int)) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	e, err := NewFastEncoder(bank, 2, 2, 3, FastEncoderWithInterval(time.Hour), FastEncoderWithClock(clock))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(e.Close)
+	now := clock.Now()
+	b.ReportAllocs()
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		turn(i)
+		e.sample(now)
+	}
+	b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "samples/s")
+	if e.Stats().Illegal != 0 {
+		b.Error("illegal transitions")
+	}
+}
+
+func Benchmark_FastEncoderSampleMMapped(b *testing.B) {
+	regs := useFakeGPIORegisters(b).memgpiochipreg32[2]
+	regs[intgpio_output_enabled_o32_] = 0xffffffff
+	benchmarkFastEncoderSample(b, NewMMappedGPIOCollectionFactory(), func(i int) {
+		regs[intgpio_datain_o32_] = uint32(quadrature_forward_[i/2%4]) << 2
+	})
+}
+
+func Benchmark_FastEncoderSampleFakeBank(b *testing.B) {
+	bank := NewFakeGPIOBank(4)
+	benchmarkFastEncoderSample(b, bank, func(i int) {
+		if i%2 == 0 {
+			bank.FakeInputBank(2, 0b1100, uint32(quadrature_forward_[i/2%4])<<2)
+		}
+	})
+}
+
+func Test_GPIOHotPathsDoNotAllocate(t *testing.T) {
+	useFakeGPIORegisters(t)
+	sg := newTempfileSysfsGPIO(t)
+	fg := NewFakeGPIO(1, OUT)
+	fg.SetLogger(nopLogger{}) // not whatever FakeGPIODefaultLogTarget_ or the package Logger other tests left
+	mg := newFakeRegisterMMappedGPIO(67)
+	hotpaths := map[string]func(){
+		"SysfsGPIO.SetState":   func() { sg.SetState(true) },
+		"SysfsGPIO.GetState":   func() { sg.GetState() },
+		"FakeGPIO.SetState":    func() { fg.SetState(true) },
+		"MMappedGPIO.SetState": func() { mg.SetState(true) },
+		"MMappedGPIO.GetState": func() { mg.GetState() },
+	}
+	for name, f := range hotpaths {
+		if allocs := testing.AllocsPerRun(100, f); allocs > 0 {
+			t.Errorf("%s allocates %v times per call", name, allocs)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package bbhw
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Forces NewBestGPIO to use one backend (BACKEND_MMAPPED, BACKEND_CDEV or BACKEND_SYSFS), e.g. for debugging.
+// Empty means the environment variable BBHW_GPIO_BACKEND, if that is empty too NewBestGPIO chooses.
+var ForceGPIOBackend_ string
+
+var dev_mem_path_ = "/dev/mem"
+
+func forcedGPIOBackend() string {
+	if ForceGPIOBackend_ != "" {
+		return ForceGPIOBackend_
+	}
+	return os.Getenv("BBHW_GPIO_BACKEND")
+}
+
+// registers already mapped, or we are on an AM335x and may write /dev/mem
+func mmappedGPIOAvailable() bool {
+	if mmapped_gpio_register_ != nil {
+		return true
+	}
+	return unix.Access(dev_mem_path_, unix.W_OK) == nil && verifyAddrIsTIOmap4(omap4_gpio0_offset_)
+}
+
+// Instantinate a GPIO using the fastest backend available on this system.
+// Takes GPIO numer (same as in sysfs) and direction bbhw.IN or bbhw.OUT.
+// Prefers MMappedGPIO if /dev/mem is writable on an AM335x, then CdevGPIO if there are /dev/gpiochip*,
+// then SysfsGPIO. If a backend fails, the next one is tried.
+// Use Backend() to find out what was chosen and ForceGPIOBackend_ / BBHW_GPIO_BACKEND to override the choice.
+// Note that the backends differ in features, e.g. MMappedGPIO has no edge detection and SysfsGPIO no bias.
+func NewBestGPIO(number uint, direction Direction) (GPIO, error) {
+	if err := validateDirection(direction); err != nil {
+		return nil, err
+	}
+	candidates := []string{BACKEND_MMAPPED, BACKEND_CDEV, BACKEND_SYSFS}
+	if forced := forcedGPIOBackend(); forced != "" {
+		if forced != BACKEND_MMAPPED && forced != BACKEND_CDEV && forced != BACKEND_SYSFS {
+			return nil, fmt.Errorf("unknown GPIO backend %q forced, use %q, %q or %q", forced, BACKEND_MMAPPED, BACKEND_CDEV, BACKEND_SYSFS)
+		}
+		candidates = []string{forced}
+	}
+	var errs []string
+	for _, backend := range candidates {
+		var gpio GPIO
+		var err error
+		switch backend {
+		case BACKEND_MMAPPED:
+			if len(candidates) > 1 && !mmappedGPIOAvailable() {
+				continue
+			}
+			gpio, err = NewMMappedGPIOOrError(number, direction)
+		case BACKEND_CDEV:
+			if len(candidates) > 1 && len(cdevListChips()) == 0 {
+				continue
+			}
+			gpio, err = NewCdevGPIOGlobal(number, direction)
+		case BACKEND_SYSFS:
+			gpio, err = NewSysfsGPIO(number, direction)
+		}
+		if err == nil {
+			loggerOr(nil).Log(LOG_DEBUG, "using GPIO backend", "gpio", number, "backend", backend)
+			return gpio, nil
+		}
+		loggerOr(nil).Log(LOG_INFO, "GPIO backend failed, trying the next", "gpio", number, "backend", backend, "err", err)
+		errs = append(errs, backend+": "+err.Error())
+	}
+	return nil, fmt.Errorf("no usable GPIO backend for gpio%d (%s)", number, strings.Join(errs, "; "))
+}
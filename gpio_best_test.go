@@ -0,0 +1,53 @@
+package bbhw
+
+import "testing"
+
+func Test_NewBestGPIOPrefersMMapped(t *testing.T) {
+	useFakeSysfsGPIOTree(t, 67)
+	useFakeGPIORegisters(t)
+	gpio, err := NewBestGPIO(67, OUT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gpio.Backend() != BACKEND_MMAPPED {
+		t.Errorf("chose %s although registers are mapped", gpio.Backend())
+	}
+}
+
+func Test_NewBestGPIOFallsBackToSysfs(t *testing.T) {
+	useFakeSysfsGPIOTree(t, 67)
+	defer func(prev string) { cdev_dev_dir_ = prev }(cdev_dev_dir_)
+	cdev_dev_dir_ = t.TempDir()
+	if mmappedGPIOAvailable() {
+		t.Skip("running on a BeagleBone")
+	}
+	gpio, err := NewBestGPIO(67, IN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gpio.Close()
+	if gpio.Backend() != BACKEND_SYSFS {
+		t.Errorf("chose %s without /dev/mem and gpiochips", gpio.Backend())
+	}
+}
+
+func Test_NewBestGPIOForcedBackend(t *testing.T) {
+	useFakeSysfsGPIOTree(t, 67)
+	useFakeGPIORegisters(t)
+	defer func(prev string) { ForceGPIOBackend_ = prev }(ForceGPIOBackend_)
+	ForceGPIOBackend_ = BACKEND_SYSFS
+	gpio, err := NewBestGPIO(67, OUT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gpio.Backend() != BACKEND_SYSFS {
+		t.Errorf("ForceGPIOBackend_ ignored, chose %s", gpio.Backend())
+	}
+	gpio.Close()
+
+	ForceGPIOBackend_ = ""
+	t.Setenv("BBHW_GPIO_BACKEND", "bitbang")
+	if _, err := NewBestGPIO(67, OUT); err == nil {
+		t.Error("unknown backend in BBHW_GPIO_BACKEND accepted")
+	}
+}
@@ -0,0 +1,696 @@
+package bbhw
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Uses the GPIO character device (/dev/gpiochipN) interface provided by the linux kernel (v2 uAPI, linux >= 5.10).
+// Replacement for the deprecated sysfs interface, which is disabled on some newer kernels.
+// Falls back to the v1 uAPI on older kernels (linux >= 4.8), where debounce and SetEventClockRealtime
+// return ErrNotSupported, see UAPIVersion.
+type CdevGPIO struct {
+	dev           cdevChip
+	chip          string
+	offset        uint
+	dir           Direction
+	activelow     bool
+	invert        bool // see SetLogicalInvert, applied on top of what the kernel sees
+	state         bool // last state written to the kernel, used as initial value when the line gets re-requested
+	changed       lastChange
+	edge          Edge
+	bias          int
+	drive         int
+	realtime      bool
+	debounce      time.Duration
+	debounce_mode int
+	consumer      string
+	logger        Logger
+	missed        uint64          // accessed atomically
+	line          cdevLineRequest // nil while released
+	watcher       *cdevWatcher
+	lock          sync.Mutex
+}
+
+var cdev_dev_dir_ = "/dev"
+
+// Consumer label used for lines requested without CdevWithConsumer, shown by tools like gpioinfo.
+// Empty means the process name.
+var CdevDefaultConsumer_ string
+
+// returned (wrapped in a *LineBusyError) if a line is already requested by another consumer
+var ErrLineBusy = errors.New("GPIO line busy")
+
+// Error returned if requesting a line failed since it was in use, errors.Is(err, ErrLineBusy) matches it
+type LineBusyError struct {
+	Chip     string
+	Offset   uint
+	Consumer string // current consumer of the line as reported by the kernel, may be empty
+}
+
+func (e *LineBusyError) Error() string {
+	return fmt.Sprintf("line %d of %s is busy, used by %q", e.Offset, e.Chip, e.Consumer)
+}
+
+func (e *LineBusyError) Is(target error) bool {
+	return target == ErrLineBusy || target == ErrAlreadyClaimed
+}
+
+func cdevConsumer(consumer string) string {
+	if consumer == "" {
+		consumer = CdevDefaultConsumer_
+	}
+	if consumer == "" {
+		consumer = filepath.Base(os.Args[0])
+	}
+	return consumer
+}
+
+// Options for the NewCdevGPIO* constructors
+type CdevOption func(*CdevGPIO) error
+
+// Inverts SetState, GetState and edges in software on top of active_low, see invertEdge.
+// Does not change what an output drives. Reconfigures an input with edges, which ends any running edge callback.
+func (gpio *CdevGPIO) SetLogicalInvert(invert bool) error {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	gpio.lock.Lock()
+	defer gpio.lock.Unlock()
+	if gpio.line == nil {
+		return gpio.closedErr()
+	}
+	if invert == gpio.invert {
+		return nil
+	}
+	prev := gpio.invert
+	gpio.invert = invert
+	if gpio.dir == IN && gpio.edge != NONE {
+		return gpio.reconfigure(true, func() { gpio.invert = prev })
+	}
+	return nil
+}
+
+// Configure internal pull resistors: BIAS_AS_IS, PULLUP, PULLDOWN or BIAS_DISABLED
+func CdevWithBias(bias int) CdevOption {
+	return func(gpio *CdevGPIO) error {
+		if bias < BIAS_AS_IS || bias > BIAS_DISABLED {
+			return fmt.Errorf("invalid bias %d", bias)
+		}
+		gpio.bias = bias
+		return nil
+	}
+}
+
+// Path of the character device of gpiochip number chip, e.g. /dev/gpiochip0
+func CdevChipPath(chip uint) string {
+	return fmt.Sprintf("%s/gpiochip%d", cdev_dev_dir_, chip)
+}
+
+// Set the consumer label of the requested line, shown by tools like gpioinfo. Defaults to CdevDefaultConsumer_
+func CdevWithConsumer(consumer string) CdevOption {
+	return func(gpio *CdevGPIO) error {
+		gpio.consumer = consumer
+		return nil
+	}
+}
+
+// Configure output drive mode: PUSH_PULL, OPEN_DRAIN or OPEN_SOURCE
+func CdevWithDriveMode(mode int) CdevOption {
+	return func(gpio *CdevGPIO) error {
+		if mode < PUSH_PULL || mode > OPEN_SOURCE {
+			return fmt.Errorf("invalid drive mode %d", mode)
+		}
+		gpio.drive = mode
+		return nil
+	}
+}
+
+// Invert the logical state in software, see CdevGPIO.SetLogicalInvert
+func CdevWithLogicalInvert(invert bool) CdevOption {
+	return func(gpio *CdevGPIO) error {
+		gpio.invert = invert
+		return nil
+	}
+}
+
+// Log to l instead of the package Logger
+func CdevWithLogger(l Logger) CdevOption {
+	return func(gpio *CdevGPIO) error {
+		gpio.logger = l
+		return nil
+	}
+}
+
+// Instantinate a new GPIO to control through the GPIO character device.
+// Takes the gpiochip number, the line offset on that chip and direction bbhw.IN or bbhw.OUT
+func NewCdevGPIO(chip, offset uint, direction Direction, opts ...CdevOption) (gpio *CdevGPIO, err error) {
+	return NewCdevGPIOFromPath(CdevChipPath(chip), offset, direction, opts...)
+}
+
+// Same as NewCdevGPIO, but takes the path of the chip character device, e.g. /dev/gpiochip1
+func NewCdevGPIOFromPath(chippath string, offset uint, direction Direction, opts ...CdevOption) (gpio *CdevGPIO, err error) {
+	return newCdevGPIO(cdevChipDev(chippath), offset, direction, opts...)
+}
+
+func newCdevGPIO(dev cdevChip, offset uint, direction Direction, opts ...CdevOption) (gpio *CdevGPIO, err error) {
+	if err = validateDirection(direction); err != nil {
+		return nil, err
+	}
+	gpio = &CdevGPIO{dev: dev, chip: dev.name(), offset: offset, dir: direction, edge: NONE}
+	for _, opt := range opts {
+		if err = opt(gpio); err != nil {
+			return nil, err
+		}
+	}
+	gpio.lock.Lock()
+	defer gpio.lock.Unlock()
+	if err = gpio.request(); err != nil {
+		return nil, err
+	}
+	return gpio, nil
+}
+
+// Instantinate a new CdevGPIO from a global GPIO numer (same as in sysfs), see CdevChipForGlobalNumber.
+// Eases migrating code from NewSysfsGPIO.
+func NewCdevGPIOGlobal(number uint, direction Direction, opts ...CdevOption) (gpio *CdevGPIO, err error) {
+	chip, offset, err := CdevChipForGlobalNumber(number)
+	if err != nil {
+		return nil, err
+	}
+	return NewCdevGPIOFromPath(chip, offset, direction, opts...)
+}
+
+// Wrapper around NewCdevGPIOGlobal. Does not return an error but panics instead. Useful to avoid multiple return values.
+// This is the function with the same signature as all the other New*GPIO*s
+func NewCdevGPIOOrPanic(number uint, direction Direction) (gpio *CdevGPIO) {
+	gpio, err := NewCdevGPIOGlobal(number, direction)
+	if err != nil {
+		panic(err)
+	}
+	return gpio
+}
+
+// Reads name, label and number of lines of a gpiochip
+func cdevChipInfo(chippath string) (info gpiochipInfo, err error) {
+	chipfd, err := unix.Open(chippath, unix.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return info, &os.PathError{Op: "open", Path: chippath, Err: err}
+	}
+	defer unix.Close(chipfd)
+	if err = gpio_ioctl_(chipfd, gpio_get_chipinfo_ioctl_, unsafe.Pointer(&info)); err != nil {
+		return info, fmt.Errorf("GPIO_GET_CHIPINFO on %s: %w", chippath, err)
+	}
+	return info, nil
+}
+
+func (gpio *CdevGPIO) lineFlags() (flags uint64) {
+	if gpio.dir == OUT {
+		flags |= gpio_v2_line_flag_output_
+	} else {
+		flags |= gpio_v2_line_flag_input_
+	}
+	if gpio.activelow {
+		flags |= gpio_v2_line_flag_active_low_
+	}
+	if gpio.dir == OUT {
+		switch gpio.drive {
+		case OPEN_DRAIN:
+			flags |= gpio_v2_line_flag_open_drain_
+		case OPEN_SOURCE:
+			flags |= gpio_v2_line_flag_open_source_
+		}
+	}
+	switch gpio.bias {
+	case PULLUP:
+		flags |= gpio_v2_line_flag_bias_pull_up_
+	case PULLDOWN:
+		flags |= gpio_v2_line_flag_bias_pull_down_
+	case BIAS_DISABLED:
+		flags |= gpio_v2_line_flag_bias_disabled_
+	}
+	if gpio.dir == IN {
+		switch invertEdge(gpio.edge, gpio.invert) {
+		case RISING:
+			flags |= gpio_v2_line_flag_edge_rising_
+		case FALLING:
+			flags |= gpio_v2_line_flag_edge_falling_
+		case BOTH:
+			flags |= gpio_v2_line_flag_edge_rising_ | gpio_v2_line_flag_edge_falling_
+		}
+		if gpio.edge != NONE && gpio.realtime {
+			flags |= gpio_v2_line_flag_event_clock_realtime_
+		}
+	}
+	return
+}
+
+// configuration to request, without debounce
+func (gpio *CdevGPIO) lineConfig() cdevLineConfig {
+	cfg := cdevLineConfig{flags: gpio.lineFlags(), consumer: gpio.consumer}
+	if gpio.state {
+		cfg.values = 1
+	}
+	return cfg
+}
+
+// Applies the changed settings to the requested line, in place with GPIO_V2_LINE_SET_CONFIG so no other process
+// can grab the line in between. With the v1 uAPI it is re-requested instead, which ends any running edge callback.
+// If the kernel refuses the settings undo restores the previous ones and the line keeps its configuration.
+// restart ends a running edge callback, for settings it depends on (edge, invert, event clock, debounce).
+// gpio.lock must be held
+func (gpio *CdevGPIO) reconfigure(restart bool, undo func()) error {
+	if gpio.line == nil {
+		undo()
+		return gpio.closedErr()
+	}
+	cfg, mode := gpio.lineConfig(), DEBOUNCE_NONE
+	if gpio.debounce > 0 && gpio.dir == IN {
+		cfg.debounce, mode = gpio.debounce, DEBOUNCE_KERNEL
+	}
+	err := gpio.line.setConfig(cfg)
+	if mode == DEBOUNCE_KERNEL && errors.Is(err, unix.EINVAL) {
+		gpio.log(LOG_INFO, "kernel debounce not supported, debouncing in software", "debounce", gpio.debounce)
+		cfg.debounce, mode = 0, DEBOUNCE_SOFTWARE
+		err = gpio.line.setConfig(cfg)
+	}
+	if errors.Is(err, ErrNotSupported) {
+		return gpio.rerequest(undo)
+	}
+	if err != nil {
+		undo()
+		return fmt.Errorf("reconfiguring line %d of %s: %w", gpio.offset, gpio.chip, err)
+	}
+	gpio.debounce_mode = mode
+	if restart {
+		gpio.watcher.stop()
+		gpio.watcher = nil
+	}
+	return nil
+}
+
+// re-requests the line, with the previous settings if the kernel refuses the new ones. gpio.lock must be held
+func (gpio *CdevGPIO) rerequest(undo func()) error {
+	err := gpio.request()
+	if err == nil {
+		return nil
+	}
+	undo()
+	if rerr := gpio.request(); rerr != nil {
+		gpio.log(LOG_ERROR, "re-requesting line with the previous configuration failed, line released", "error", rerr)
+	}
+	return err
+}
+
+func (gpio *CdevGPIO) closedErr() error {
+	return fmt.Errorf("line %d of %s: %w", gpio.offset, gpio.chip, ErrClosed)
+}
+
+// (re-)request the line from the kernel. gpio.lock must be held
+func (gpio *CdevGPIO) request() (err error) {
+	gpio.release()
+	cfg := gpio.lineConfig()
+	gpio.debounce_mode = DEBOUNCE_NONE
+	if gpio.debounce > 0 && gpio.dir == IN {
+		cfg.debounce = gpio.debounce
+		gpio.line, err = gpio.dev.requestLines([]uint{gpio.offset}, cfg)
+		if err == nil {
+			gpio.debounce_mode = DEBOUNCE_KERNEL
+			return nil
+		} else if !errors.Is(err, unix.EINVAL) {
+			return err
+		}
+		// kernel refused the debounce attribute, debounce events ourselves
+		gpio.log(LOG_INFO, "kernel debounce not supported, debouncing in software", "debounce", gpio.debounce)
+		cfg.debounce = 0
+		gpio.debounce_mode = DEBOUNCE_SOFTWARE
+	}
+	gpio.line, err = gpio.dev.requestLines([]uint{gpio.offset}, cfg)
+	return err
+}
+
+// the kernel side of the GPIO character device, replaced by a FakeCdevChip in tests
+type cdevChip interface {
+	name() string
+	requestLines(offsets []uint, cfg cdevLineConfig) (cdevLineRequest, error)
+}
+
+// lines requested together, the ith requested line is bit i of mask and bits
+type cdevLineRequest interface {
+	uapi() int
+	getValues(mask uint64) (uint64, error)
+	setValues(mask, bits uint64) error
+	// changes flags and output values of all lines without releasing them,
+	// ErrNotSupported if the line has to be re-requested instead
+	setConfig(cfg cdevLineConfig) error
+	// returns a new fd to poll and read edge events from, in the format of uapi(). Closed by the caller.
+	eventFd() (int, error)
+	close()
+}
+
+// a real /dev/gpiochipN
+type cdevChipDev string
+
+func (path cdevChipDev) name() string { return string(path) }
+
+func (path cdevChipDev) requestLines(offsets []uint, cfg cdevLineConfig) (cdevLineRequest, error) {
+	fd, uapi, err := cdevRequestLines(string(path), offsets, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &cdevFdRequest{fd: fd, version: uapi, nlines: len(offsets)}, nil
+}
+
+type cdevFdRequest struct {
+	fd      int
+	version int
+	nlines  int
+}
+
+func (r *cdevFdRequest) uapi() int { return r.version }
+
+func (r *cdevFdRequest) getValues(mask uint64) (uint64, error) {
+	return cdevGetValues(r.fd, r.version, mask)
+}
+
+func (r *cdevFdRequest) setValues(mask, bits uint64) error {
+	return cdevSetValues(r.fd, r.version, mask, bits)
+}
+
+// GPIO_V2_LINE_SET_CONFIG_IOCTL. The v1 equivalent needs linux >= 5.5, so it is not worth the effort
+func (r *cdevFdRequest) setConfig(cfg cdevLineConfig) error {
+	if r.version == 1 {
+		return ErrNotSupported
+	}
+	lc := cfg.v2config(uint64(1)<<uint(r.nlines) - 1)
+	return gpio_ioctl_(r.fd, gpio_v2_line_set_config_ioctl_, unsafe.Pointer(&lc))
+}
+
+func (r *cdevFdRequest) eventFd() (int, error) { return unix.Dup(r.fd) }
+
+func (r *cdevFdRequest) close() { unix.Close(r.fd) }
+
+// configuration applied to all lines of a request
+type cdevLineConfig struct {
+	flags    uint64
+	values   uint64 // initial output states, bit i for offsets[i]
+	debounce time.Duration
+	consumer string
+}
+
+// Requests up to 64 lines of a chip with the same configuration.
+// Returns the line request fd and the uAPI version (1 or 2) it belongs to.
+func cdevRequestLines(chippath string, offsets []uint, cfg cdevLineConfig) (int, int, error) {
+	if len(offsets) == 0 || len(offsets) > gpio_v2_lines_max_ {
+		return -1, 0, fmt.Errorf("can request between 1 and %d lines, not %d", gpio_v2_lines_max_, len(offsets))
+	}
+	chipfd, err := unix.Open(chippath, unix.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, 0, &os.PathError{Op: "open", Path: chippath, Err: err}
+	}
+	defer unix.Close(chipfd)
+	var req gpioV2LineRequest
+	for i, offset := range offsets {
+		req.offsets[i] = uint32(offset)
+	}
+	req.num_lines = uint32(len(offsets))
+	setCString(req.consumer[:], cdevConsumer(cfg.consumer))
+	req.config = cfg.v2config(uint64(1)<<uint(len(offsets)) - 1)
+	if err = gpio_ioctl_(chipfd, gpio_v2_get_line_ioctl_, unsafe.Pointer(&req)); err != nil {
+		if err == unix.ENOTTY {
+			// linux < 5.10
+			loggerOr(nil).Log(LOG_DEBUG, "no v2 GPIO uAPI, falling back to v1", "chip", chippath)
+			fd, err := cdevRequestLinesV1(chipfd, chippath, offsets, cfg)
+			return fd, 1, err
+		}
+		if err == unix.EBUSY {
+			return -1, 0, cdevBusyError(chipfd, chippath, offsets)
+		}
+		return -1, 0, fmt.Errorf("requesting lines %v of %s: %w", offsets, chippath, err)
+	}
+	return int(req.fd), 2, nil
+}
+
+// finds out which of offsets is in use and by whom
+func cdevBusyError(chipfd int, chippath string, offsets []uint) error {
+	for _, offset := range offsets {
+		if info, err := cdevLineInfo(chipfd, offset); err == nil && info.flags&gpio_v2_line_flag_used_ != 0 {
+			return &LineBusyError{Chip: chippath, Offset: offset, Consumer: getCString(info.consumer[:])}
+		}
+	}
+	return &LineBusyError{Chip: chippath, Offset: offsets[0]}
+}
+
+func (cfg cdevLineConfig) v2config(mask uint64) (lc gpioV2LineConfig) {
+	lc.flags = cfg.flags
+	if cfg.flags&gpio_v2_line_flag_output_ != 0 && cfg.values != 0 {
+		attr := &lc.attrs[lc.num_attrs]
+		attr.attr.id = gpio_v2_line_attr_id_values_
+		attr.attr.value = cfg.values
+		attr.mask = mask
+		lc.num_attrs++
+	}
+	if cfg.debounce > 0 {
+		attr := &lc.attrs[lc.num_attrs]
+		attr.attr.id = gpio_v2_line_attr_id_debounce_
+		attr.attr.value = uint64(cfg.debounce / time.Microsecond)
+		attr.mask = mask
+		lc.num_attrs++
+	}
+	return
+}
+
+// reads the lines of a request selected by mask, bit i for the ith requested line
+func cdevGetValues(linefd, uapi int, mask uint64) (uint64, error) {
+	if uapi == 1 {
+		bits, err := cdevGetValuesV1(linefd)
+		return bits & mask, err
+	}
+	lv := gpioV2LineValues{mask: mask}
+	err := gpio_ioctl_(linefd, gpio_v2_line_get_values_ioctl_, unsafe.Pointer(&lv))
+	return lv.bits, err
+}
+
+// sets the lines of a request selected by mask. With the v1 uAPI mask must select all lines.
+func cdevSetValues(linefd, uapi int, mask, bits uint64) error {
+	if uapi == 1 {
+		return cdevSetValuesV1(linefd, bits&mask)
+	}
+	lv := gpioV2LineValues{mask: mask, bits: bits}
+	return gpio_ioctl_(linefd, gpio_v2_line_set_values_ioctl_, unsafe.Pointer(&lv))
+}
+
+func (gpio *CdevGPIO) release() {
+	gpio.watcher.stop()
+	gpio.watcher = nil
+	if gpio.line != nil {
+		gpio.line.close()
+		gpio.line = nil
+	}
+}
+
+func (gpio *CdevGPIO) CheckDirection() (direction Direction, err error) {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	gpio.lock.Lock()
+	defer gpio.lock.Unlock()
+	return gpio.dir, nil
+}
+
+// Changes direction bbhw.IN or bbhw.OUT. An output starts with the state last set.
+// Reconfigures the line without releasing it (GPIO_V2_LINE_SET_CONFIG), so no other process can grab it in between
+// and a running edge callback keeps on running (getting no events while the line is an output).
+// Fast enough for bit-banging bidirectional protocols. Re-requests the line with the v1 uAPI.
+func (gpio *CdevGPIO) SetDirection(direction Direction) error {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	if err := validateDirection(direction); err != nil {
+		return err
+	}
+	gpio.lock.Lock()
+	defer gpio.lock.Unlock()
+	prev := gpio.dir
+	gpio.dir = direction
+	return gpio.reconfigure(false, func() { gpio.dir = prev })
+}
+
+// this inverts the meaning of 0 and 1, handled by the kernel. Reconfigures the line, see SetDirection
+func (gpio *CdevGPIO) SetActiveLow(activelow bool) error {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	gpio.lock.Lock()
+	defer gpio.lock.Unlock()
+	prev := gpio.activelow
+	gpio.activelow = activelow
+	return gpio.reconfigure(false, func() { gpio.activelow = prev })
+}
+
+// Configure internal pull resistors: BIAS_AS_IS, PULLUP, PULLDOWN or BIAS_DISABLED.
+// Needs linux >= 5.5. Reconfigures the line, see SetDirection
+func (gpio *CdevGPIO) SetBias(bias int) error {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	gpio.lock.Lock()
+	defer gpio.lock.Unlock()
+	prev := gpio.bias
+	if err := CdevWithBias(bias)(gpio); err != nil {
+		return err
+	}
+	return gpio.reconfigure(false, func() { gpio.bias = prev })
+}
+
+// Configure output drive mode: PUSH_PULL, OPEN_DRAIN or OPEN_SOURCE.
+// Only has an effect on outputs. Reconfigures the line, see SetDirection
+func (gpio *CdevGPIO) SetDriveMode(mode int) error {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	gpio.lock.Lock()
+	defer gpio.lock.Unlock()
+	prev := gpio.drive
+	if err := CdevWithDriveMode(mode)(gpio); err != nil {
+		return err
+	}
+	return gpio.reconfigure(false, func() { gpio.drive = prev })
+}
+
+// Constants returned by DebounceMode
+const (
+	DEBOUNCE_NONE = iota
+	DEBOUNCE_KERNEL
+	DEBOUNCE_SOFTWARE
+)
+
+// Debounce edge events, i.e. only report an edge once the input has been stable for d.
+// Uses the kernels debounce (GPIO_V2_LINE_ATTR_ID_DEBOUNCE) which is handled in hardware if supported,
+// otherwise falls back to debouncing in the edge callback goroutine, see DebounceMode.
+// d == 0 disables debouncing. Only has an effect on inputs. Reconfigures the line, which ends any running edge callback.
+// Returns ErrNotSupported with the v1 uAPI.
+func (gpio *CdevGPIO) SetDebounce(d time.Duration) error {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	if d < 0 {
+		return fmt.Errorf("invalid debounce period %v", d)
+	}
+	gpio.lock.Lock()
+	defer gpio.lock.Unlock()
+	if gpio.line != nil && gpio.line.uapi() == 1 && d > 0 {
+		return fmt.Errorf("debounce needs the v2 GPIO uAPI (linux >= 5.10): %w", ErrNotSupported)
+	}
+	prev := gpio.debounce
+	gpio.debounce = d
+	return gpio.reconfigure(true, func() { gpio.debounce = prev })
+}
+
+// returns the version of the GPIO character device uAPI used for this line:
+// 2 (linux >= 5.10) or 1 (older kernels, fewer features). 0 after Close
+func (gpio *CdevGPIO) UAPIVersion() int {
+	gpio.lock.Lock()
+	defer gpio.lock.Unlock()
+	if gpio.line == nil {
+		return 0
+	}
+	return gpio.line.uapi()
+}
+
+// returns DEBOUNCE_NONE, DEBOUNCE_KERNEL or DEBOUNCE_SOFTWARE
+func (gpio *CdevGPIO) DebounceMode() int {
+	gpio.lock.Lock()
+	defer gpio.lock.Unlock()
+	return gpio.debounce_mode
+}
+
+func (gpio *CdevGPIO) GetState() (state bool, err error) {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	gpio.lock.Lock()
+	defer gpio.lock.Unlock()
+	if gpio.line == nil {
+		return false, gpio.closedErr()
+	}
+	bits, err := gpio.line.getValues(1)
+	if err != nil {
+		return false, fmt.Errorf("reading line %d of %s: %w", gpio.offset, gpio.chip, err)
+	}
+	state = (bits&1 == 1) != gpio.invert
+	gpio.changed.observe(state)
+	return state, nil
+}
+
+func (gpio *CdevGPIO) SetState(state bool) error {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	gpio.lock.Lock()
+	defer gpio.lock.Unlock()
+	if gpio.line == nil {
+		return gpio.closedErr()
+	}
+	var bits uint64
+	if state != gpio.invert {
+		bits = 1
+	}
+	if err := gpio.line.setValues(1, bits); err != nil {
+		return fmt.Errorf("writing line %d of %s: %w", gpio.offset, gpio.chip, err)
+	}
+	gpio.state = bits == 1
+	gpio.changed.observe(state)
+	return nil
+}
+
+func (gpio *CdevGPIO) SetStateNow(state bool) error { return gpio.SetState(state) }
+
+func (gpio *CdevGPIO) Backend() string { return BACKEND_CDEV }
+
+func (gpio *CdevGPIO) Capabilities() GPIOCapabilities {
+	return GPIOCapabilities{ActiveLow: true, Bias: true, DriveMode: true, Edges: true, EdgeTimestamps: true}
+}
+
+// Configuration from the cached settings plus a fresh read of the state.
+// LastChange is the last change seen by GetState or SetState
+func (gpio *CdevGPIO) Snapshot() PinSnapshot {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	state, err := gpio.GetState()
+	edge, _ := gpio.GetEdge()
+	gpio.lock.Lock()
+	defer gpio.lock.Unlock()
+	s := PinSnapshot{Number: gpio.offset, Chip: gpio.chip, Backend: BACKEND_CDEV, Direction: gpio.dir,
+		Edge: edge, ActiveLow: gpio.activelow, Inverted: gpio.invert, State: state, LastChange: gpio.changed.time}
+	s.setError(err)
+	return s
+}
+
+// Log to l instead of the package Logger, nil reverts to that
+func (gpio *CdevGPIO) SetLogger(l Logger) {
+	gpio.lock.Lock()
+	defer gpio.lock.Unlock()
+	gpio.logger = l
+}
+
+func (gpio *CdevGPIO) log(level int, msg string, kv ...interface{}) {
+	loggerOr(gpio.logger).Log(level, msg, append([]interface{}{"chip", gpio.chip, "offset", gpio.offset}, kv...)...)
+}
+
+// releases the line
+func (gpio *CdevGPIO) Close() {
+	gpio.lock.Lock()
+	defer gpio.lock.Unlock()
+	gpio.release()
+}
+
+var _ EdgeGPIO = (*CdevGPIO)(nil)
@@ -0,0 +1,261 @@
+package bbhw
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Set edge(s) bbhw.RISING, bbhw.FALLING, bbhw.BOTH or bbhw.NONE to be reported by SetEdgeCallback.
+// Only has an effect on inputs. Reconfigures the line, which ends any running edge callback.
+func (gpio *CdevGPIO) SetEdge(edge Edge) error {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	if edge < RISING || edge > NONE {
+		return errors.New("Edge value invalid")
+	}
+	gpio.lock.Lock()
+	defer gpio.lock.Unlock()
+	prev := gpio.edge
+	gpio.edge = edge
+	return gpio.reconfigure(true, func() { gpio.edge = prev })
+}
+
+// returns "none", "rising", "falling" or "both", same as SysfsGPIO.GetEdge
+func (gpio *CdevGPIO) GetEdge() (edge string, err error) {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	gpio.lock.Lock()
+	defer gpio.lock.Unlock()
+	return [...]string{"rising", "falling", "both", "none"}[gpio.edge], nil
+}
+
+// Request kernel timestamps from CLOCK_REALTIME instead of CLOCK_MONOTONIC (needs linux >= 5.11).
+// Reconfigures the line, which ends any running edge callback. Returns ErrNotSupported with the v1 uAPI.
+func (gpio *CdevGPIO) SetEventClockRealtime(realtime bool) error {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	gpio.lock.Lock()
+	defer gpio.lock.Unlock()
+	if gpio.line != nil && gpio.line.uapi() == 1 && realtime {
+		return fmt.Errorf("event clock selection needs the v2 GPIO uAPI (linux >= 5.11): %w", ErrNotSupported)
+	}
+	prev := gpio.realtime
+	gpio.realtime = realtime
+	return gpio.reconfigure(true, func() { gpio.realtime = prev })
+}
+
+// Monitor pin for the edges configured with SetEdge.
+// Sends the state after each edge to callback. Same semantics as SysfsGPIO.SetEdgeCallback,
+// except that a timeout without event just keeps on waiting. (negative value for infinite timeout)
+func (gpio *CdevGPIO) SetEdgeCallback(callback *chan bool, timeout int) error {
+	return gpio.watchEdges(timeout, func() { close(*callback) }, func(ev EdgeEvent) { *callback <- ev.State })
+}
+
+// Monitor pin for the edges configured with SetEdge and deliver EdgeEvents including the kernel timestamp.
+//
+// The clock used for EdgeEvent.Timestamp depends on the kernel:
+// the v2 uAPI (linux >= 5.10) uses CLOCK_MONOTONIC unless SetEventClockRealtime(true) was called (linux >= 5.11),
+// the v1 uAPI used CLOCK_REALTIME before linux 5.7 and CLOCK_MONOTONIC since.
+// EdgeEvent.Time is converted to wall clock time in all cases. The v1 uAPI provides no sequence numbers.
+//
+// The events channel is closed once the line is closed or reconfigured by SetEdge, SetDebounce, SetEventClockRealtime
+// or SetLogicalInvert (with the v1 uAPI also by SetDirection and the other setters, which re-request the line).
+// Keep reading events until then, the line is only fully released once the watcher exits.
+func (gpio *CdevGPIO) SetEdgeEventCallback(events chan<- EdgeEvent, timeout int) error {
+	return gpio.watchEdges(timeout, func() { close(events) }, func(ev EdgeEvent) { events <- ev })
+}
+
+// Number of edge events lost so far, e.g. because the consumer of SetEdgeEventCallback fell behind
+// and the kernel event buffer overflowed
+func (gpio *CdevGPIO) MissedEvents() uint64 {
+	return atomic.LoadUint64(&gpio.missed)
+}
+
+type cdevWatcher struct {
+	stopw int
+}
+
+// tells the watcher goroutine to exit, safe to call on nil
+func (w *cdevWatcher) stop() {
+	if w != nil {
+		unix.Close(w.stopw)
+	}
+}
+
+func (gpio *CdevGPIO) watchEdges(timeout int, done func(), deliver func(EdgeEvent)) error {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	gpio.lock.Lock()
+	defer gpio.lock.Unlock()
+	if gpio.line == nil {
+		return gpio.closedErr()
+	}
+	if gpio.edge == NONE || gpio.dir != IN {
+		return errors.New("Edge value is set to NONE")
+	}
+	if gpio.watcher != nil {
+		return errors.New("edge callback already running")
+	}
+	// the watcher gets its own fd, so it can never read from a reused fd number after Close
+	linefd, err := gpio.line.eventFd()
+	if err != nil {
+		return err
+	}
+	var pipe [2]int
+	if err = unix.Pipe2(pipe[:], unix.O_CLOEXEC|unix.O_NONBLOCK); err != nil {
+		unix.Close(linefd)
+		return err
+	}
+	gpio.watcher = &cdevWatcher{stopw: pipe[1]}
+	realtime, uapi, invert := gpio.realtime, gpio.line.uapi(), gpio.invert
+	var softdebounce time.Duration
+	if gpio.debounce_mode == DEBOUNCE_SOFTWARE {
+		softdebounce = gpio.debounce
+	}
+	go func() {
+		defer done()
+		defer unix.Close(linefd)
+		defer unix.Close(pipe[0])
+		cdevEventLoop(linefd, pipe[0], uapi, timeout, softdebounce, func(ev *gpioV2LineEvent, missed uint32) {
+			if missed > 0 {
+				atomic.AddUint64(&gpio.missed, uint64(missed))
+			}
+			if uapi == 1 {
+				realtime = cdevV1TimestampIsRealtime(ev.timestamp_ns)
+			}
+			e := cdevEdgeEvent(ev, realtime)
+			e.Missed = missed
+			if invert {
+				e.State = !e.State
+				e.Edge = invertEdge(e.Edge, true)
+			}
+			deliver(e)
+		})
+	}()
+	return nil
+}
+
+// waits up to timeout ms for fd to become readable and reads into buf.
+// returns n == 0 on timeout and ok == false once stopfd becomes readable / is closed or on errors
+func cdevPollRead(fd, stopfd int, timeout int, buf []byte) (n int, ok bool) {
+	for {
+		fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}, {Fd: int32(stopfd), Events: unix.POLLIN}}
+		nready, err := unix.Poll(fds, timeout)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil || fds[1].Revents != 0 {
+			return 0, false
+		}
+		if nready == 0 {
+			return 0, true
+		}
+		if fds[0].Revents&unix.POLLIN == 0 {
+			return 0, false // POLLERR, POLLHUP or POLLNVAL
+		}
+		n, err = unix.Read(fd, buf)
+		if err == unix.EAGAIN || err == unix.EINTR {
+			continue
+		}
+		if err != nil || n <= 0 {
+			return 0, false
+		}
+		return n, true
+	}
+}
+
+// reads packed gpio_v2_line_events (gpioevent_data with uapi 1) from linefd until stopfd becomes readable or closed
+// if debounce > 0, an event is only delivered once no further event arrived for debounce
+// and only if it differs from the last delivered one.
+// missed is the number of events lost before ev, detected by gaps in the per line sequence numbers
+// (events intentionally dropped by debouncing do not count)
+func cdevEventLoop(linefd, stopfd int, uapi int, timeout int, debounce time.Duration, deliver func(ev *gpioV2LineEvent, missed uint32)) {
+	evbuf := make([]gpioV2LineEvent, 16)
+	evsize := int(unsafe.Sizeof(evbuf[0]))
+	raw := unsafe.Slice((*byte)(unsafe.Pointer(&evbuf[0])), len(evbuf)*evsize)
+	var v1buf []gpioeventData
+	if uapi == 1 {
+		v1buf = make([]gpioeventData, len(evbuf))
+		evsize = int(unsafe.Sizeof(v1buf[0]))
+		raw = unsafe.Slice((*byte)(unsafe.Pointer(&v1buf[0])), len(v1buf)*evsize)
+	}
+	var pending gpioV2LineEvent
+	var lastid, lastseq, pendingmissed uint32
+	var deadline time.Time
+	haspending := false
+	for {
+		polltimeout := timeout
+		if haspending {
+			wait := int(time.Until(deadline)/time.Millisecond) + 1
+			if polltimeout < 0 || wait < polltimeout {
+				polltimeout = wait
+			}
+		}
+		nread, ok := cdevPollRead(linefd, stopfd, polltimeout, raw)
+		if !ok {
+			return
+		}
+		if nread == 0 {
+			if haspending && !time.Now().Before(deadline) {
+				haspending = false
+				if pending.id != lastid || pendingmissed > 0 {
+					lastid = pending.id
+					deliver(&pending, pendingmissed)
+					pendingmissed = 0
+				}
+			}
+			continue // timeout, keep on watching
+		}
+		// one read may return several events
+		for i := 0; i < nread/evsize; i++ {
+			if v1buf != nil {
+				evbuf[i] = gpioV2LineEvent{timestamp_ns: v1buf[i].timestamp, id: v1buf[i].id}
+			}
+			var missed uint32
+			if seq := evbuf[i].line_seqno; seq != lastseq+1 && seq > lastseq {
+				missed = seq - lastseq - 1
+			}
+			lastseq = evbuf[i].line_seqno
+			if debounce > 0 {
+				pending = evbuf[i]
+				pendingmissed += missed
+				haspending = true
+				deadline = time.Now().Add(debounce)
+			} else {
+				deliver(&evbuf[i], missed)
+			}
+		}
+	}
+}
+
+const (
+	gpio_v2_line_event_rising_edge_  = 1
+	gpio_v2_line_event_falling_edge_ = 2
+)
+
+func cdevEdgeEvent(ev *gpioV2LineEvent, realtime bool) EdgeEvent {
+	e := EdgeEvent{Timestamp: time.Duration(ev.timestamp_ns), Seqno: ev.seqno, LineSeqno: ev.line_seqno}
+	if ev.id == gpio_v2_line_event_rising_edge_ {
+		e.State = true
+		e.Edge = RISING
+	} else {
+		e.Edge = FALLING
+	}
+	if realtime {
+		e.Time = time.Unix(0, int64(ev.timestamp_ns))
+	} else {
+		var now unix.Timespec
+		unix.ClockGettime(unix.CLOCK_MONOTONIC, &now)
+		e.Time = time.Now().Add(e.Timestamp - time.Duration(now.Nano()))
+	}
+	return e
+}
@@ -0,0 +1,221 @@
+package bbhw
+
+import (
+	"fmt"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// In-memory stand-in for a /dev/gpiochipN, to unit test code written against CdevGPIO and CdevGPIOLines
+// without hardware, the same way FakeGPIO is used for GPIOControllablePin.
+// Remembers the configuration each line was requested with (see LineInfo), lets tests drive inputs
+// and inject edge events. Behaves like a v2 uAPI kernel, except that debouncing is accepted but not simulated.
+type FakeCdevChip struct {
+	label string
+	lines []fakeCdevLine
+	lock  sync.Mutex
+}
+
+type fakeCdevLine struct {
+	level bool           // physical level
+	info  gpioV2LineInfo // as reported by the kernel, flags and attrs of the current request
+	req   *fakeCdevRequest
+}
+
+type fakeCdevRequest struct {
+	chip        *FakeCdevChip
+	offsets     []uint
+	events      [2]int // pipe, injected events are written to events[1]
+	seqno       uint32
+	line_seqnos []uint32
+}
+
+// Instantinate a FakeCdevChip with lines lines, all inputs at low level
+func NewFakeCdevChip(lines int) *FakeCdevChip {
+	chip := &FakeCdevChip{label: fmt.Sprintf("FakeCdevChip(%d)", lines), lines: make([]fakeCdevLine, lines)}
+	for i := range chip.lines {
+		chip.lines[i].info.offset = uint32(i)
+		chip.lines[i].info.flags = gpio_v2_line_flag_input_
+	}
+	return chip
+}
+
+// Request line offset of the fake chip, same as NewCdevGPIO does for a real chip
+func (chip *FakeCdevChip) NewGPIO(offset uint, direction Direction, opts ...CdevOption) (*CdevGPIO, error) {
+	return newCdevGPIO(chip, offset, direction, opts...)
+}
+
+// Request several lines of the fake chip, same as NewCdevGPIOLines does for a real chip
+func (chip *FakeCdevChip) NewGPIOLines(offsets []uint, direction Direction, consumer string) (*CdevGPIOLines, error) {
+	return newCdevGPIOLines(chip, offsets, direction, consumer)
+}
+
+// Current configuration of a line, e.g. to assert on the requested Bias, DriveMode or Debounce
+func (chip *FakeCdevChip) LineInfo(offset uint) LineInfo {
+	chip.lock.Lock()
+	defer chip.lock.Unlock()
+	return decodeLineInfo(&chip.lines[offset].info)
+}
+
+// Physical level of a line, i.e. what an output drives (ignoring active low)
+func (chip *FakeCdevChip) Level(offset uint) bool {
+	chip.lock.Lock()
+	defer chip.lock.Unlock()
+	return chip.lines[offset].level
+}
+
+// Externally drive line offset to the physical level rising ? high : low
+// and emit an edge event, if the line is requested as input with a matching edge.
+// Events are dropped (and show up in CdevGPIO.MissedEvents) if nobody reads them, like the kernel does.
+func (chip *FakeCdevChip) InjectEdge(offset uint, rising bool) error {
+	chip.lock.Lock()
+	defer chip.lock.Unlock()
+	if offset >= uint(len(chip.lines)) {
+		return fmt.Errorf("%s has no line %d", chip.label, offset)
+	}
+	line := &chip.lines[offset]
+	if line.info.flags&gpio_v2_line_flag_output_ != 0 {
+		return fmt.Errorf("line %d of %s is an output", offset, chip.label)
+	}
+	line.level = rising
+	if line.req == nil {
+		return nil
+	}
+	// edges refer to the logical value
+	logical := rising != (line.info.flags&gpio_v2_line_flag_active_low_ != 0)
+	ev := gpioV2LineEvent{offset: uint32(offset)}
+	if logical {
+		if line.info.flags&gpio_v2_line_flag_edge_rising_ == 0 {
+			return nil
+		}
+		ev.id = gpio_v2_line_event_rising_edge_
+	} else {
+		if line.info.flags&gpio_v2_line_flag_edge_falling_ == 0 {
+			return nil
+		}
+		ev.id = gpio_v2_line_event_falling_edge_
+	}
+	line.req.emit(&ev, line.info.flags&gpio_v2_line_flag_event_clock_realtime_ != 0)
+	return nil
+}
+
+func (req *fakeCdevRequest) emit(ev *gpioV2LineEvent, realtime bool) {
+	if realtime {
+		ev.timestamp_ns = uint64(time.Now().UnixNano())
+	} else {
+		var now unix.Timespec
+		unix.ClockGettime(unix.CLOCK_MONOTONIC, &now)
+		ev.timestamp_ns = uint64(now.Nano())
+	}
+	req.seqno++
+	ev.seqno = req.seqno
+	for i, offset := range req.offsets {
+		if uint32(offset) == ev.offset {
+			req.line_seqnos[i]++
+			ev.line_seqno = req.line_seqnos[i]
+		}
+	}
+	// non-blocking, a full pipe loses the event like an overflowing kernel fifo
+	unix.Write(req.events[1], unsafe.Slice((*byte)(unsafe.Pointer(ev)), unsafe.Sizeof(*ev)))
+}
+
+func (chip *FakeCdevChip) name() string { return chip.label }
+
+func (chip *FakeCdevChip) requestLines(offsets []uint, cfg cdevLineConfig) (cdevLineRequest, error) {
+	chip.lock.Lock()
+	defer chip.lock.Unlock()
+	if len(offsets) == 0 || len(offsets) > gpio_v2_lines_max_ {
+		return nil, fmt.Errorf("can request between 1 and %d lines, not %d", gpio_v2_lines_max_, len(offsets))
+	}
+	for _, offset := range offsets {
+		if offset >= uint(len(chip.lines)) {
+			return nil, fmt.Errorf("requesting lines %v of %s: %w", offsets, chip.label, unix.EINVAL)
+		}
+		if line := &chip.lines[offset]; line.req != nil {
+			return nil, &LineBusyError{Chip: chip.label, Offset: offset, Consumer: getCString(line.info.consumer[:])}
+		}
+	}
+	req := &fakeCdevRequest{chip: chip, offsets: append([]uint(nil), offsets...), line_seqnos: make([]uint32, len(offsets))}
+	if err := unix.Pipe2(req.events[:], unix.O_CLOEXEC|unix.O_NONBLOCK); err != nil {
+		return nil, err
+	}
+	for _, offset := range offsets {
+		chip.lines[offset].req = req
+		setCString(chip.lines[offset].info.consumer[:], cdevConsumer(cfg.consumer))
+	}
+	req.configure(cfg)
+	return req, nil
+}
+
+// chip.lock must be held
+func (req *fakeCdevRequest) configure(cfg cdevLineConfig) {
+	for i, offset := range req.offsets {
+		line := &req.chip.lines[offset]
+		line.info.flags = cfg.flags | gpio_v2_line_flag_used_
+		line.info.num_attrs = 0
+		if cfg.debounce > 0 {
+			line.info.attrs[0] = gpioV2LineAttribute{id: gpio_v2_line_attr_id_debounce_, value: uint64(cfg.debounce / time.Microsecond)}
+			line.info.num_attrs = 1
+		}
+		if cfg.flags&gpio_v2_line_flag_output_ != 0 {
+			line.level = (cfg.values>>uint(i)&1 == 1) != (cfg.flags&gpio_v2_line_flag_active_low_ != 0)
+		}
+	}
+}
+
+func (req *fakeCdevRequest) setConfig(cfg cdevLineConfig) error {
+	req.chip.lock.Lock()
+	defer req.chip.lock.Unlock()
+	req.configure(cfg)
+	return nil
+}
+
+func (req *fakeCdevRequest) uapi() int { return 2 }
+
+func (req *fakeCdevRequest) getValues(mask uint64) (bits uint64, err error) {
+	req.chip.lock.Lock()
+	defer req.chip.lock.Unlock()
+	for i, offset := range req.offsets {
+		line := &req.chip.lines[offset]
+		if mask&(1<<uint(i)) != 0 && line.level != (line.info.flags&gpio_v2_line_flag_active_low_ != 0) {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
+
+func (req *fakeCdevRequest) setValues(mask, bits uint64) error {
+	req.chip.lock.Lock()
+	defer req.chip.lock.Unlock()
+	for i, offset := range req.offsets {
+		line := &req.chip.lines[offset]
+		if mask&(1<<uint(i)) == 0 {
+			continue
+		}
+		if line.info.flags&gpio_v2_line_flag_output_ == 0 {
+			return unix.EPERM // as the kernel does for inputs
+		}
+		line.level = (bits>>uint(i)&1 == 1) != (line.info.flags&gpio_v2_line_flag_active_low_ != 0)
+	}
+	return nil
+}
+
+func (req *fakeCdevRequest) eventFd() (int, error) { return unix.Dup(req.events[0]) }
+
+func (req *fakeCdevRequest) close() {
+	req.chip.lock.Lock()
+	defer req.chip.lock.Unlock()
+	for _, offset := range req.offsets {
+		line := &req.chip.lines[offset]
+		line.req = nil
+		line.info.flags &^= gpio_v2_line_flag_used_
+		setCString(line.info.consumer[:], "")
+	}
+	unix.Close(req.events[0])
+	unix.Close(req.events[1])
+}
+
+var _ cdevChip = (*FakeCdevChip)(nil)
@@ -0,0 +1,212 @@
+package bbhw
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func Test_FakeCdevChipRecordsRequestedConfig(t *testing.T) {
+	chip := NewFakeCdevChip(4)
+	in, err := chip.NewGPIO(1, IN, CdevWithBias(PULLUP), CdevWithConsumer("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	if err := in.SetDebounce(5 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	info := chip.LineInfo(1)
+	if !info.Used || info.Consumer != "test" || info.Direction != IN || info.Bias != PULLUP || info.Debounce != 5*time.Millisecond {
+		t.Errorf("wrong line info %+v", info)
+	}
+	if in.DebounceMode() != DEBOUNCE_KERNEL {
+		t.Error("fake chip did not accept kernel debounce")
+	}
+	if _, err := chip.NewGPIO(1, OUT); !errors.Is(err, ErrLineBusy) {
+		t.Error("requesting a used line did not fail with ErrLineBusy:", err)
+	}
+
+	out, err := chip.NewGPIO(2, OUT, CdevWithDriveMode(OPEN_DRAIN))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info := chip.LineInfo(2); info.Direction != OUT || info.DriveMode != OPEN_DRAIN {
+		t.Errorf("wrong line info %+v", info)
+	}
+	out.SetActiveLow(true)
+	out.SetState(true)
+	if chip.Level(2) {
+		t.Error("active low output drives high")
+	}
+	out.Close()
+	if chip.LineInfo(2).Used {
+		t.Error("line still used after Close")
+	}
+}
+
+func Test_FakeCdevChipInjectEdge(t *testing.T) {
+	chip := NewFakeCdevChip(2)
+	in, err := chip.NewGPIO(0, IN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	in.SetEdge(RISING)
+	events := make(chan EdgeEvent, 4)
+	if err := in.SetEdgeEventCallback(events, -1); err != nil {
+		t.Fatal(err)
+	}
+	chip.InjectEdge(0, true)
+	chip.InjectEdge(0, false) // not requested, no event
+	chip.InjectEdge(0, true)
+	for i := uint32(1); i <= 2; i++ {
+		select {
+		case ev := <-events:
+			if ev.Edge != RISING || !ev.State || ev.LineSeqno != i || ev.Missed != 0 {
+				t.Errorf("wrong event %+v", ev)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("injected edge not delivered")
+		}
+	}
+	if !GetStateOrPanic(in) {
+		t.Error("GetState does not follow injected level")
+	}
+	if err := chip.InjectEdge(5, true); err == nil {
+		t.Error("InjectEdge accepted nonexisting line")
+	}
+}
+
+func Test_FakeCdevChipLines(t *testing.T) {
+	chip := NewFakeCdevChip(8)
+	lines, err := chip.NewGPIOLines([]uint{3, 5, 6}, OUT, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lines.Close()
+	lines.SetAll([]bool{true, false, true})
+	if !chip.Level(3) || chip.Level(5) || !chip.Level(6) {
+		t.Error("SetAll did not set the levels")
+	}
+	if values, err := lines.GetAll(); err != nil || !values[0] || values[1] || !values[2] {
+		t.Error("GetAll() != SetAll()", values, err)
+	}
+}
+
+func Test_CdevGPIOSetDirectionKeepsRequest(t *testing.T) {
+	chip := NewFakeCdevChip(1)
+	gpio, err := chip.NewGPIO(0, OUT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gpio.Close()
+	gpio.SetState(true) // remembered for the next switch to OUT
+	gpio.SetDirection(IN)
+	gpio.SetEdge(BOTH)
+	events := make(chan EdgeEvent, 4)
+	if err := gpio.SetEdgeEventCallback(events, -1); err != nil {
+		t.Fatal(err)
+	}
+	req := gpio.line
+	if err := gpio.SetDirection(OUT); err != nil {
+		t.Fatal(err)
+	}
+	if info := chip.LineInfo(0); info.Direction != OUT || info.Edge != NONE || !chip.Level(0) {
+		t.Errorf("wrong configuration after SetDirection(OUT): %+v", info)
+	}
+	if err := gpio.SetDirection(IN); err != nil {
+		t.Fatal(err)
+	}
+	if gpio.line != req {
+		t.Error("SetDirection re-requested the line")
+	}
+	chip.InjectEdge(0, false)
+	select {
+	case ev, ok := <-events:
+		if !ok || ev.Edge != FALLING {
+			t.Errorf("edge callback did not survive SetDirection: %+v %v", ev, ok)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no edge event after SetDirection")
+	}
+}
+
+func Benchmark_CdevGPIOSetDirection(b *testing.B) {
+	gpio, err := NewFakeCdevChip(1).NewGPIO(0, OUT)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer gpio.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		gpio.SetDirection(Direction(i & 1))
+	}
+}
+
+// a FakeCdevChip whose kernel refuses every reconfiguration, like an older kernel rejecting a flag
+type refusingCdevChip struct{ *FakeCdevChip }
+
+type refusingCdevRequest struct{ cdevLineRequest }
+
+func (chip refusingCdevChip) requestLines(offsets []uint, cfg cdevLineConfig) (cdevLineRequest, error) {
+	req, err := chip.FakeCdevChip.requestLines(offsets, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return refusingCdevRequest{req}, nil
+}
+
+func (req refusingCdevRequest) setConfig(cfg cdevLineConfig) error { return unix.EINVAL }
+
+func Test_CdevGPIOFailedReconfigureKeepsLine(t *testing.T) {
+	chip := NewFakeCdevChip(1)
+	gpio, err := newCdevGPIO(refusingCdevChip{chip}, 0, IN, CdevWithBias(PULLDOWN))
+	if err != nil {
+		t.Fatal(err)
+	}
+	setters := map[string]func() error{
+		"SetDirection":          func() error { return gpio.SetDirection(OUT) },
+		"SetActiveLow":          func() error { return gpio.SetActiveLow(true) },
+		"SetBias":               func() error { return gpio.SetBias(PULLUP) },
+		"SetDriveMode":          func() error { return gpio.SetDriveMode(OPEN_DRAIN) },
+		"SetEdge":               func() error { return gpio.SetEdge(BOTH) },
+		"SetEventClockRealtime": func() error { return gpio.SetEventClockRealtime(true) },
+	}
+	for name, set := range setters {
+		if err := set(); !errors.Is(err, unix.EINVAL) {
+			t.Errorf("%s: %v", name, err)
+		}
+		info := chip.LineInfo(0)
+		if !info.Used || info.Direction != IN || info.ActiveLow || info.Bias != PULLDOWN || info.Edge != NONE {
+			t.Errorf("line changed by failed %s: %+v", name, info)
+		}
+		if d := CheckDirectionOrPanic(gpio); d != IN {
+			t.Errorf("direction %v after failed %s", d, name)
+		}
+		if _, err := gpio.GetState(); err != nil {
+			t.Errorf("GetState after failed %s: %v", name, err)
+		}
+	}
+	if edge, _ := gpio.GetEdge(); edge != "none" {
+		t.Errorf("edge %s after failed SetEdge", edge)
+	}
+
+	gpio.Close()
+	for name, set := range setters {
+		if err := set(); !errors.Is(err, ErrClosed) {
+			t.Errorf("%s after Close: %v", name, err)
+		}
+	}
+	if err := gpio.SetDebounce(time.Millisecond); !errors.Is(err, ErrClosed) {
+		t.Errorf("SetDebounce after Close: %v", err)
+	}
+	if err := gpio.SetLogicalInvert(true); !errors.Is(err, ErrClosed) {
+		t.Errorf("SetLogicalInvert after Close: %v", err)
+	}
+	if chip.LineInfo(0).Used {
+		t.Error("line requested again after Close")
+	}
+}
@@ -0,0 +1,155 @@
+package bbhw
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Kinds of LineInfoEvent
+const (
+	LINE_REQUESTED = 1 + iota
+	LINE_RELEASED
+	LINE_CONFIG_CHANGED
+)
+
+// Configuration of a line as reported by the kernel
+type LineInfo struct {
+	Offset    uint
+	Name      string
+	Consumer  string
+	Used      bool
+	Direction Direction
+	ActiveLow bool
+	Bias      int
+	DriveMode int
+	Edge      Edge
+	Debounce  time.Duration
+	Flags     uint64 // raw GPIO_V2_LINE_FLAG_* bits
+}
+
+// Change of a watched line, see WatchLineInfo
+type LineInfoEvent struct {
+	Kind      int // LINE_REQUESTED, LINE_RELEASED or LINE_CONFIG_CHANGED
+	Time      time.Time
+	Timestamp time.Duration // raw kernel timestamp, CLOCK_MONOTONIC
+	LineInfo
+}
+
+func decodeLineInfo(info *gpioV2LineInfo) (li LineInfo) {
+	li.Offset = uint(info.offset)
+	li.Name = getCString(info.name[:])
+	li.Consumer = getCString(info.consumer[:])
+	li.Flags = info.flags
+	li.Used = info.flags&gpio_v2_line_flag_used_ != 0
+	li.ActiveLow = info.flags&gpio_v2_line_flag_active_low_ != 0
+	li.Direction = IN
+	if info.flags&gpio_v2_line_flag_output_ != 0 {
+		li.Direction = OUT
+	}
+	switch {
+	case info.flags&gpio_v2_line_flag_bias_pull_up_ != 0:
+		li.Bias = PULLUP
+	case info.flags&gpio_v2_line_flag_bias_pull_down_ != 0:
+		li.Bias = PULLDOWN
+	case info.flags&gpio_v2_line_flag_bias_disabled_ != 0:
+		li.Bias = BIAS_DISABLED
+	}
+	switch {
+	case info.flags&gpio_v2_line_flag_open_drain_ != 0:
+		li.DriveMode = OPEN_DRAIN
+	case info.flags&gpio_v2_line_flag_open_source_ != 0:
+		li.DriveMode = OPEN_SOURCE
+	}
+	rising, falling := info.flags&gpio_v2_line_flag_edge_rising_ != 0, info.flags&gpio_v2_line_flag_edge_falling_ != 0
+	switch {
+	case rising && falling:
+		li.Edge = BOTH
+	case rising:
+		li.Edge = RISING
+	case falling:
+		li.Edge = FALLING
+	default:
+		li.Edge = NONE
+	}
+	for _, attr := range info.attrs[:info.num_attrs] {
+		if attr.id == gpio_v2_line_attr_id_debounce_ {
+			li.Debounce = time.Duration(attr.value) * time.Microsecond
+		}
+	}
+	return
+}
+
+// Returns the current configuration of line offset of chip chippath
+func GetLineInfo(chippath string, offset uint) (LineInfo, error) {
+	chipfd, err := unix.Open(chippath, unix.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return LineInfo{}, &os.PathError{Op: "open", Path: chippath, Err: err}
+	}
+	defer unix.Close(chipfd)
+	info, err := cdevLineInfo(chipfd, offset)
+	if err != nil {
+		return LineInfo{}, fmt.Errorf("GPIO_V2_GET_LINEINFO on %s line %d: %w", chippath, offset, err)
+	}
+	return decodeLineInfo(&info), nil
+}
+
+// Watch lines offsets of chip chippath for being requested, released or reconfigured by anyone (e.g. gpioset or config-pin).
+// Events are sent to ch, which is closed once stop is called (more calls do nothing). Sending blocks, so keep reading ch.
+func WatchLineInfo(chippath string, offsets []uint, ch chan<- LineInfoEvent) (stop func(), err error) {
+	chipfd, err := unix.Open(chippath, unix.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: chippath, Err: err}
+	}
+	for _, offset := range offsets {
+		info := gpioV2LineInfo{offset: uint32(offset)}
+		if err = gpio_ioctl_(chipfd, gpio_v2_get_lineinfo_watch_ioctl_, unsafe.Pointer(&info)); err != nil {
+			unix.Close(chipfd)
+			if err == unix.ENOTTY {
+				err = ErrNotSupported
+			}
+			return nil, fmt.Errorf("GPIO_V2_GET_LINEINFO_WATCH on %s line %d: %w", chippath, offset, err)
+		}
+	}
+	var pipe [2]int
+	if err = unix.Pipe2(pipe[:], unix.O_CLOEXEC|unix.O_NONBLOCK); err != nil {
+		unix.Close(chipfd)
+		return nil, err
+	}
+	offsets = append([]uint(nil), offsets...)
+	go func() {
+		defer close(ch)
+		defer unix.Close(chipfd)
+		defer unix.Close(pipe[0])
+		cdevLineInfoLoop(chipfd, pipe[0], func(ev LineInfoEvent) { ch <- ev })
+		for _, offset := range offsets {
+			o := uint32(offset)
+			gpio_ioctl_(chipfd, gpio_get_lineinfo_unwatch_ioctl_, unsafe.Pointer(&o))
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { unix.Close(pipe[1]) }) }, nil
+}
+
+func cdevLineInfoLoop(chipfd, stopfd int, deliver func(LineInfoEvent)) {
+	evbuf := make([]gpioV2LineInfoChanged, 8)
+	evsize := int(unsafe.Sizeof(evbuf[0]))
+	raw := unsafe.Slice((*byte)(unsafe.Pointer(&evbuf[0])), len(evbuf)*evsize)
+	for {
+		nread, ok := cdevPollRead(chipfd, stopfd, -1, raw)
+		if !ok {
+			return
+		}
+		for i := 0; i < nread/evsize; i++ {
+			ev := LineInfoEvent{Kind: int(evbuf[i].event_type), Timestamp: time.Duration(evbuf[i].timestamp_ns), LineInfo: decodeLineInfo(&evbuf[i].info)}
+			var now unix.Timespec
+			unix.ClockGettime(unix.CLOCK_MONOTONIC, &now)
+			ev.Time = time.Now().Add(ev.Timestamp - time.Duration(now.Nano()))
+			deliver(ev)
+		}
+	}
+}
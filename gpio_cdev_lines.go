@@ -0,0 +1,119 @@
+package bbhw
+
+import (
+	"fmt"
+	"sync"
+)
+
+// A set of lines which are read or written all at once
+type GPIOLines interface {
+	SetAll(values []bool) error
+	GetAll() ([]bool, error)
+	Close()
+}
+
+// Up to 64 lines of one gpiochip, requested together through the GPIO character device.
+// SetAll and GetAll each are a single ioctl, so all lines change (or are sampled) at the same time.
+// Useful for parallel busses.
+type CdevGPIOLines struct {
+	chip    string
+	offsets []uint
+	dir     Direction
+	line    cdevLineRequest
+	lock    sync.Mutex
+}
+
+// Request lines offsets of chip chippath (e.g. /dev/gpiochip1) all with direction bbhw.IN or bbhw.OUT.
+// consumer labels the lines (see CdevWithConsumer), empty means CdevDefaultConsumer_
+func NewCdevGPIOLines(chippath string, offsets []uint, direction Direction, consumer string) (lines *CdevGPIOLines, err error) {
+	return newCdevGPIOLines(cdevChipDev(chippath), offsets, direction, consumer)
+}
+
+func newCdevGPIOLines(dev cdevChip, offsets []uint, direction Direction, consumer string) (lines *CdevGPIOLines, err error) {
+	if err = validateDirection(direction); err != nil {
+		return nil, err
+	}
+	var flags uint64 = gpio_v2_line_flag_input_
+	if direction == OUT {
+		flags = gpio_v2_line_flag_output_
+	}
+	lines = &CdevGPIOLines{chip: dev.name(), offsets: append([]uint(nil), offsets...), dir: direction}
+	lines.line, err = dev.requestLines(offsets, cdevLineConfig{flags: flags, consumer: consumer})
+	if err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+func (lines *CdevGPIOLines) mask() uint64 {
+	return 1<<uint(len(lines.offsets)) - 1
+}
+
+// values[i] is the new state of line offsets[i]. Only works on outputs.
+func (lines *CdevGPIOLines) SetAll(values []bool) error {
+	if lines == nil {
+		panic("lines == nil")
+	}
+	if len(values) != len(lines.offsets) {
+		return fmt.Errorf("SetAll needs %d values, got %d", len(lines.offsets), len(values))
+	}
+	if lines.dir != OUT {
+		return fmt.Errorf("lines %v of %s are not outputs", lines.offsets, lines.chip)
+	}
+	var bits uint64
+	for i, v := range values {
+		if v {
+			bits |= 1 << uint(i)
+		}
+	}
+	lines.lock.Lock()
+	defer lines.lock.Unlock()
+	if lines.line == nil {
+		return fmt.Errorf("lines %v of %s are closed", lines.offsets, lines.chip)
+	}
+	if err := lines.line.setValues(lines.mask(), bits); err != nil {
+		return fmt.Errorf("writing lines %v of %s: %w", lines.offsets, lines.chip, err)
+	}
+	return nil
+}
+
+// returns the states of all lines, in the order of offsets
+func (lines *CdevGPIOLines) GetAll() ([]bool, error) {
+	if lines == nil {
+		panic("lines == nil")
+	}
+	lines.lock.Lock()
+	defer lines.lock.Unlock()
+	if lines.line == nil {
+		return nil, fmt.Errorf("lines %v of %s are closed", lines.offsets, lines.chip)
+	}
+	bits, err := lines.line.getValues(lines.mask())
+	if err != nil {
+		return nil, fmt.Errorf("reading lines %v of %s: %w", lines.offsets, lines.chip, err)
+	}
+	values := make([]bool, len(lines.offsets))
+	for i := range values {
+		values[i] = bits&(1<<uint(i)) != 0
+	}
+	return values, nil
+}
+
+// version of the GPIO character device uAPI used, see CdevGPIO.UAPIVersion
+func (lines *CdevGPIOLines) UAPIVersion() int {
+	lines.lock.Lock()
+	defer lines.lock.Unlock()
+	if lines.line == nil {
+		return 0
+	}
+	return lines.line.uapi()
+}
+
+// releases all lines
+func (lines *CdevGPIOLines) Close() {
+	lines.lock.Lock()
+	defer lines.lock.Unlock()
+	if lines.line != nil {
+		lines.line.close()
+		lines.line = nil
+	}
+}
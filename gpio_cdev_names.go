@@ -0,0 +1,214 @@
+package bbhw
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// A line found by FindAllGPIOLinesByName
+type GPIOLineMatch struct {
+	Chip   string // path of the chip, e.g. /dev/gpiochip1
+	Offset uint
+}
+
+// all /dev/gpiochipN, sorted by N
+func cdevListChips() []string {
+	chips, _ := filepath.Glob(cdev_dev_dir_ + "/gpiochip*")
+	num := func(path string) int {
+		n, _ := strconv.Atoi(strings.TrimPrefix(filepath.Base(path), "gpiochip"))
+		return n
+	}
+	sort.Slice(chips, func(i, j int) bool { return num(chips[i]) < num(chips[j]) })
+	return chips
+}
+
+func cdevLineInfo(chipfd int, offset uint) (info gpioV2LineInfo, err error) {
+	info.offset = uint32(offset)
+	err = gpio_ioctl_(chipfd, gpio_v2_get_lineinfo_ioctl_, unsafe.Pointer(&info))
+	if err == unix.ENOTTY {
+		return cdevLineInfoV1(chipfd, offset)
+	}
+	return
+}
+
+// calls f for every line of every chip until f returns false
+func cdevForEachLine(f func(chip string, info *gpioV2LineInfo) bool) error {
+	chips := cdevListChips()
+	if len(chips) == 0 {
+		return fmt.Errorf("no gpiochip character devices found in %s", cdev_dev_dir_)
+	}
+	for _, chip := range chips {
+		chipinfo, err := cdevChipInfo(chip)
+		if err != nil {
+			return err
+		}
+		chipfd, err := unix.Open(chip, unix.O_RDWR|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return err
+		}
+		for offset := uint(0); offset < uint(chipinfo.lines); offset++ {
+			info, err := cdevLineInfo(chipfd, offset)
+			if err != nil {
+				unix.Close(chipfd)
+				return fmt.Errorf("GPIO_V2_GET_LINEINFO on %s line %d: %w", chip, offset, err)
+			}
+			if !f(chip, &info) {
+				unix.Close(chipfd)
+				return nil
+			}
+		}
+		unix.Close(chipfd)
+	}
+	return nil
+}
+
+// Maps a global (sysfs) GPIO number to chip and line offset.
+// Uses base, ngpio and label of /sys/class/gpio/gpiochip* if present, otherwise
+// assumes chips are numbered consecutively starting at 0 in the order of /dev/gpiochipN (as on the AM335x).
+func CdevChipForGlobalNumber(number uint) (chip string, offset uint, err error) {
+	chips := cdevListChips()
+	if len(chips) == 0 {
+		return "", 0, fmt.Errorf("no gpiochip character devices found in %s", cdev_dev_dir_)
+	}
+	sysfschips, _ := filepath.Glob(sysfs_gpio_base_ + "/gpiochip*")
+	for _, sysfschip := range sysfschips {
+		base, err1 := readSysfsUint(sysfschip + "/base")
+		ngpio, err2 := readSysfsUint(sysfschip + "/ngpio")
+		label, err3 := ioutil.ReadFile(sysfschip + "/label")
+		if err1 != nil || err2 != nil || err3 != nil || number < base || number >= base+ngpio {
+			continue
+		}
+		for _, chip := range chips {
+			info, err := cdevChipInfo(chip)
+			if err == nil && getCString(info.label[:]) == strings.TrimSpace(string(label)) && uint(info.lines) == ngpio {
+				return chip, number - base, nil
+			}
+		}
+	}
+	base := uint(0)
+	for _, chip := range chips {
+		info, err := cdevChipInfo(chip)
+		if err != nil {
+			return "", 0, err
+		}
+		if number < base+uint(info.lines) {
+			return chip, number - base, nil
+		}
+		base += uint(info.lines)
+	}
+	return "", 0, fmt.Errorf("no gpiochip provides global GPIO number %d", number)
+}
+
+func readSysfsUint(filename string) (uint, error) {
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseUint(strings.TrimSpace(string(buf)), 10, 32)
+	return uint(v), err
+}
+
+// Returns the first line named name (as assigned by the device tree, e.g. "P8_07" or "user-led-0") of all gpiochips.
+// If no line matches, the error lists similarly named lines.
+func FindGPIOLineByName(name string) (chip string, offset uint, err error) {
+	matches, err := findGPIOLinesByName(name, true)
+	if err != nil {
+		return "", 0, err
+	}
+	return matches[0].Chip, matches[0].Offset, nil
+}
+
+// Same as FindGPIOLineByName but returns all lines named name
+func FindAllGPIOLinesByName(name string) (matches []GPIOLineMatch, err error) {
+	return findGPIOLinesByName(name, false)
+}
+
+func findGPIOLinesByName(name string, firstonly bool) (matches []GPIOLineMatch, err error) {
+	if name == "" {
+		return nil, errors.New("empty GPIO line name, unnamed lines are not looked up")
+	}
+	var similar []string
+	err = cdevForEachLine(func(chip string, info *gpioV2LineInfo) bool {
+		linename := getCString(info.name[:])
+		if linename == name {
+			matches = append(matches, GPIOLineMatch{Chip: chip, Offset: uint(info.offset)})
+			return !firstonly
+		}
+		if linename != "" && namesAreSimilar(name, linename) {
+			similar = append(similar, linename)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		if len(similar) > 0 {
+			return nil, fmt.Errorf("no GPIO line named %q, similar names: %s", name, strings.Join(similar, ", "))
+		}
+		return nil, fmt.Errorf("no GPIO line named %q", name)
+	}
+	return matches, nil
+}
+
+// names shorter than this (after normalizing) are only similar to themselves, "P8" is contained in
+// or two edits from almost any header pin
+const line_name_similar_min_ = 3
+
+// case insensitive, ignoring "-", "_" and "." or, for names of at least line_name_similar_min_ characters,
+// one containing the other or at most two edits apart
+func namesAreSimilar(a, b string) bool {
+	normalize := strings.NewReplacer("-", "", "_", "", ".", "", " ", "")
+	na, nb := strings.ToLower(normalize.Replace(a)), strings.ToLower(normalize.Replace(b))
+	if na == nb {
+		return true
+	}
+	if len(na) < line_name_similar_min_ || len(nb) < line_name_similar_min_ {
+		return false
+	}
+	return strings.Contains(nb, na) || strings.Contains(na, nb) || editDistance(na, nb) <= 2
+}
+
+// Levenshtein distance
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// Instantinate a new CdevGPIO by the name of the line, see FindGPIOLineByName
+func NewCdevGPIOByName(name string, direction Direction, opts ...CdevOption) (gpio *CdevGPIO, err error) {
+	chip, offset, err := FindGPIOLineByName(name)
+	if err != nil {
+		return nil, err
+	}
+	return NewCdevGPIOFromPath(chip, offset, direction, opts...)
+}
@@ -0,0 +1,510 @@
+package bbhw
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+func Test_CdevUAPIStructSizes(t *testing.T) {
+	sizes := []struct {
+		name       string
+		got, linux uintptr
+	}{
+		{"gpiochip_info", unsafe.Sizeof(gpiochipInfo{}), 68},
+		{"gpio_v2_line_values", unsafe.Sizeof(gpioV2LineValues{}), 16},
+		{"gpio_v2_line_attribute", unsafe.Sizeof(gpioV2LineAttribute{}), 16},
+		{"gpio_v2_line_config", unsafe.Sizeof(gpioV2LineConfig{}), 272},
+		{"gpio_v2_line_request", unsafe.Sizeof(gpioV2LineRequest{}), 592},
+		{"gpio_v2_line_info", unsafe.Sizeof(gpioV2LineInfo{}), 256},
+		{"gpio_v2_line_event", unsafe.Sizeof(gpioV2LineEvent{}), 48},
+		{"gpio_v2_line_info_changed", unsafe.Sizeof(gpioV2LineInfoChanged{}), 288},
+	}
+	for _, s := range sizes {
+		if s.got != s.linux {
+			t.Errorf("sizeof(struct %s) is %d, kernel expects %d", s.name, s.got, s.linux)
+		}
+	}
+	if gpio_v2_get_line_ioctl_ != 0xC250B407 {
+		t.Errorf("GPIO_V2_GET_LINE_IOCTL is %#x", gpio_v2_get_line_ioctl_)
+	}
+}
+
+// returns the path of a chip provided by the gpio-sim kernel module, or skips the test
+func findGPIOSimChip(t testing.TB) string {
+	chips, _ := filepath.Glob(cdev_dev_dir_ + "/gpiochip*")
+	for _, chip := range chips {
+		info, err := cdevChipInfo(chip)
+		if err == nil && strings.HasPrefix(getCString(info.label[:]), "gpio-sim") && info.lines >= 2 {
+			return chip
+		}
+	}
+	t.Skip("no gpio-sim chip available")
+	return ""
+}
+
+func Test_CdevGPIOOnGPIOSim(t *testing.T) {
+	chip := findGPIOSimChip(t)
+	out, err := NewCdevGPIOFromPath(chip, 0, OUT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	for _, state := range []bool{true, false} {
+		if err := out.SetState(state); err != nil {
+			t.Fatal(err)
+		}
+		if GetStateOrPanic(out) != state {
+			t.Error("GetState() != SetState()")
+		}
+	}
+	if err := out.SetDirection(IN); err != nil {
+		t.Fatal(err)
+	}
+	if CheckDirectionOrPanic(out) != IN {
+		t.Error("SetDirection(IN) failed")
+	}
+}
+
+func Test_CdevEventLoopPackedEvents(t *testing.T) {
+	var p, stop [2]int
+	if err := unix.Pipe2(p[:], unix.O_CLOEXEC); err != nil {
+		t.Fatal(err)
+	}
+	if err := unix.Pipe2(stop[:], unix.O_CLOEXEC); err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close(p[0])
+	defer unix.Close(p[1])
+	defer unix.Close(stop[0])
+	// three events in a single write, the loop must read them in one go and deliver all of them
+	evs := []gpioV2LineEvent{
+		{timestamp_ns: 1000, id: gpio_v2_line_event_rising_edge_, offset: 3, seqno: 1, line_seqno: 1},
+		{timestamp_ns: 2000, id: gpio_v2_line_event_falling_edge_, offset: 3, seqno: 2, line_seqno: 2},
+		{timestamp_ns: 3000, id: gpio_v2_line_event_rising_edge_, offset: 3, seqno: 5, line_seqno: 5},
+	}
+	unix.Write(p[1], unsafe.Slice((*byte)(unsafe.Pointer(&evs[0])), len(evs)*int(unsafe.Sizeof(evs[0]))))
+	got := make(chan EdgeEvent, 10)
+	done := make(chan struct{})
+	go func() {
+		cdevEventLoop(p[0], stop[0], 2, 10, 0, func(ev *gpioV2LineEvent, missed uint32) {
+			e := cdevEdgeEvent(ev, true)
+			e.Missed = missed
+			got <- e
+		})
+		close(done)
+	}()
+	for i, want := range []struct {
+		edge   Edge
+		state  bool
+		ts     time.Duration
+		missed uint32
+	}{{RISING, true, 1000, 0}, {FALLING, false, 2000, 0}, {RISING, true, 3000, 2}} {
+		select {
+		case ev := <-got:
+			if ev.Edge != want.edge || ev.State != want.state || ev.Timestamp != want.ts || ev.Time.UnixNano() != int64(want.ts) || ev.Missed != want.missed {
+				t.Errorf("event %d: got %+v", i, ev)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %d not delivered", i)
+		}
+	}
+	unix.Close(stop[1])
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("event loop did not stop")
+	}
+}
+
+func Test_CdevGPIOLinesOnGPIOSim(t *testing.T) {
+	chip := findGPIOSimChip(t)
+	lines, err := NewCdevGPIOLines(chip, []uint{0, 1}, OUT, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lines.Close()
+	var _ GPIOLines = lines
+	if err := lines.SetAll([]bool{true, false}); err != nil {
+		t.Fatal(err)
+	}
+	if values, err := lines.GetAll(); err != nil || !values[0] || values[1] {
+		t.Error("GetAll() != SetAll()", values, err)
+	}
+	if err := lines.SetAll([]bool{true}); err == nil {
+		t.Error("SetAll accepted wrong number of values")
+	}
+}
+
+func Test_CdevGPIOBiasOnGPIOSim(t *testing.T) {
+	chip := findGPIOSimChip(t)
+	// gpio-sim inputs follow the requested bias
+	in, err := NewCdevGPIOFromPath(chip, 1, IN, CdevWithBias(PULLUP))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	if GetStateOrPanic(in) != true {
+		t.Error("input with PULLUP reads low")
+	}
+	if err := in.SetBias(PULLDOWN); err != nil {
+		t.Fatal(err)
+	}
+	if GetStateOrPanic(in) != false {
+		t.Error("input with PULLDOWN reads high")
+	}
+}
+
+func Test_CdevEventLoopSoftwareDebounce(t *testing.T) {
+	var p, stop [2]int
+	unix.Pipe2(p[:], unix.O_CLOEXEC)
+	unix.Pipe2(stop[:], unix.O_CLOEXEC)
+	defer unix.Close(p[0])
+	defer unix.Close(p[1])
+	defer unix.Close(stop[0])
+	got := make(chan EdgeEvent, 10)
+	go cdevEventLoop(p[0], stop[0], 2, -1, 20*time.Millisecond, func(ev *gpioV2LineEvent, missed uint32) {
+		if missed > 0 {
+			t.Error("debounced events counted as missed")
+		}
+		got <- cdevEdgeEvent(ev, true)
+	})
+	ids := []uint32{gpio_v2_line_event_rising_edge_, gpio_v2_line_event_falling_edge_}
+	for i := 0; i < 7; i++ {
+		ev := gpioV2LineEvent{timestamp_ns: uint64(i), id: ids[i%2], line_seqno: uint32(i + 1)}
+		unix.Write(p[1], unsafe.Slice((*byte)(unsafe.Pointer(&ev)), unsafe.Sizeof(ev)))
+		time.Sleep(2 * time.Millisecond)
+	}
+	select {
+	case ev := <-got:
+		if ev.Edge != RISING || ev.Timestamp != 6 {
+			t.Error("wrong settled event", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no settled event")
+	}
+	select {
+	case ev := <-got:
+		t.Error("bouncing stimulus produced more than one event", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+	unix.Close(stop[1])
+}
+
+// drives a gpio-sim input line by setting the simulated pull
+func gpioSimPull(t *testing.T, chip string, offset uint, high bool) {
+	matches, _ := filepath.Glob(fmt.Sprintf("/sys/devices/platform/gpio-sim.*/%s/sim_gpio%d/pull", filepath.Base(chip), offset))
+	if len(matches) == 0 {
+		t.Skip("gpio-sim pull attribute not found")
+	}
+	pull := "pull-down"
+	if high {
+		pull = "pull-up"
+	}
+	if err := ioutil.WriteFile(matches[0], []byte(pull), 0644); err != nil {
+		t.Skip("can not write gpio-sim pull attribute:", err)
+	}
+}
+
+func Test_CdevGPIODebounceOnGPIOSim(t *testing.T) {
+	chip := findGPIOSimChip(t)
+	in, err := NewCdevGPIOFromPath(chip, 1, IN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	gpioSimPull(t, chip, 1, false)
+	in.SetEdge(BOTH)
+	if err := in.SetDebounce(10 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan EdgeEvent, 10)
+	if err := in.SetEdgeEventCallback(events, -1); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 6; i++ {
+		gpioSimPull(t, chip, 1, i%2 == 0)
+		time.Sleep(time.Millisecond)
+	}
+	gpioSimPull(t, chip, 1, true)
+	time.Sleep(50 * time.Millisecond)
+	if n := len(events); n != 1 {
+		t.Errorf("bouncing stimulus produced %d events with %v debounce", n, in.DebounceMode())
+	}
+}
+
+func Test_GPIOLineNamesAreSimilar(t *testing.T) {
+	for _, c := range []struct {
+		a, b    string
+		similar bool
+	}{
+		{"P8_07", "P8_07", true},
+		{"p8.07", "P8_07", true},
+		{"P8_7", "P8_07", true},
+		{"user-led-0", "usr_led0", true},
+		{"P8_07", "P9_42", false},
+		{"heater", "P8_07", false},
+		{"P8", "P8_07", false},
+		{"p-8", "P8", true},
+		{"a", "b", false},
+	} {
+		if namesAreSimilar(c.a, c.b) != c.similar {
+			t.Errorf("namesAreSimilar(%q, %q) != %v", c.a, c.b, c.similar)
+		}
+	}
+	if _, _, err := FindGPIOLineByName(""); err == nil {
+		t.Error("empty name looked up")
+	}
+}
+
+func Test_CdevGPIOBusyReportsConsumer(t *testing.T) {
+	chip := findGPIOSimChip(t)
+	first, err := NewCdevGPIOFromPath(chip, 0, OUT, CdevWithConsumer("first-daemon"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	_, err = NewCdevGPIOFromPath(chip, 0, OUT)
+	var busy *LineBusyError
+	if !errors.Is(err, ErrLineBusy) || !errors.As(err, &busy) {
+		t.Fatal("expected ErrLineBusy, got", err)
+	}
+	if busy.Consumer != "first-daemon" {
+		t.Errorf("busy error reports consumer %q", busy.Consumer)
+	}
+}
+
+func Test_CdevConsumerDefault(t *testing.T) {
+	defer func(prev string) { CdevDefaultConsumer_ = prev }(CdevDefaultConsumer_)
+	if cdevConsumer("") != filepath.Base(os.Args[0]) {
+		t.Error("default consumer is not the process name")
+	}
+	CdevDefaultConsumer_ = "mydaemon"
+	if cdevConsumer("") != "mydaemon" || cdevConsumer("other") != "other" {
+		t.Error("CdevDefaultConsumer_ not honored")
+	}
+}
+
+func Test_WatchLineInfoOnGPIOSim(t *testing.T) {
+	chip := findGPIOSimChip(t)
+	events := make(chan LineInfoEvent, 10)
+	stop, err := WatchLineInfo(chip, []uint{0}, events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	thief, err := NewCdevGPIOFromPath(chip, 0, OUT, CdevWithConsumer("thief"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	thief.Close()
+	for _, kind := range []int{LINE_REQUESTED, LINE_RELEASED} {
+		select {
+		case ev := <-events:
+			if ev.Kind != kind || ev.Offset != 0 {
+				t.Errorf("expected event kind %d, got %+v", kind, ev)
+			}
+			if kind == LINE_REQUESTED && (ev.Consumer != "thief" || ev.Direction != OUT) {
+				t.Errorf("wrong line info in %+v", ev)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no event of kind %d", kind)
+		}
+	}
+	stop()
+	stop() // the write end of the stop pipe is not closed again, its number may have been reused
+	for range events {
+	}
+}
+
+// answers the ioctls of a single line chip, as a kernel with the given uAPI version would.
+// line request fds are dups of the read end of events, edge events are written to events[1]
+type mockCdevChip struct {
+	uapi   int
+	flags  uint64 // v2 flags of the last request, translated back for v1
+	values uint64
+	events [2]int
+}
+
+func (m *mockCdevChip) ioctl(fd int, req uintptr, arg unsafe.Pointer) error {
+	switch req {
+	case gpio_v2_get_line_ioctl_:
+		if m.uapi == 1 {
+			return unix.ENOTTY
+		}
+		r := (*gpioV2LineRequest)(arg)
+		m.flags = r.config.flags
+		r.fd = m.linefd()
+	case gpio_get_linehandle_ioctl_:
+		r := (*gpiohandleRequest)(arg)
+		m.flags = m.v2flags(r.flags)
+		r.fd = m.linefd()
+	case gpio_get_lineevent_ioctl_:
+		r := (*gpioeventRequest)(arg)
+		m.flags = m.v2flags(r.handleflags)
+		if r.eventflags&gpioevent_request_rising_edge_ != 0 {
+			m.flags |= gpio_v2_line_flag_edge_rising_
+		}
+		if r.eventflags&gpioevent_request_falling_edge_ != 0 {
+			m.flags |= gpio_v2_line_flag_edge_falling_
+		}
+		r.fd = m.linefd()
+	case gpio_v2_line_set_config_ioctl_:
+		m.flags = (*gpioV2LineConfig)(arg).flags
+	case gpio_v2_line_get_values_ioctl_:
+		(*gpioV2LineValues)(arg).bits = m.values
+	case gpio_v2_line_set_values_ioctl_:
+		m.values = (*gpioV2LineValues)(arg).bits
+	case gpiohandle_get_line_values_ioctl_:
+		(*gpiohandleData)(arg).values[0] = uint8(m.values)
+	case gpiohandle_set_line_values_ioctl_:
+		m.values = uint64((*gpiohandleData)(arg).values[0])
+	default:
+		return unix.ENOTTY
+	}
+	return nil
+}
+
+func (m *mockCdevChip) linefd() int32 {
+	fd, _ := unix.Dup(m.events[0])
+	return int32(fd)
+}
+
+func (m *mockCdevChip) v2flags(v1 uint32) (flags uint64) {
+	for _, f := range cdev_v1_handle_flags_ {
+		if v1&f.v1 != 0 {
+			flags |= f.v2
+		}
+	}
+	return
+}
+
+// writes a rising edge event in the format of the uAPI version
+func (m *mockCdevChip) rising(ts uint64) {
+	if m.uapi == 1 {
+		ev := gpioeventData{timestamp: ts, id: gpio_v2_line_event_rising_edge_}
+		unix.Write(m.events[1], unsafe.Slice((*byte)(unsafe.Pointer(&ev)), unsafe.Sizeof(ev)))
+	} else {
+		ev := gpioV2LineEvent{timestamp_ns: ts, id: gpio_v2_line_event_rising_edge_, line_seqno: 1}
+		unix.Write(m.events[1], unsafe.Slice((*byte)(unsafe.Pointer(&ev)), unsafe.Sizeof(ev)))
+	}
+}
+
+func Test_CdevV1StructSizes(t *testing.T) {
+	for _, s := range []struct {
+		name       string
+		got, linux uintptr
+	}{
+		{"gpiohandle_request", unsafe.Sizeof(gpiohandleRequest{}), 364},
+		{"gpiohandle_data", unsafe.Sizeof(gpiohandleData{}), 64},
+		{"gpioevent_request", unsafe.Sizeof(gpioeventRequest{}), 48},
+		{"gpioevent_data", unsafe.Sizeof(gpioeventData{}), 16},
+		{"gpioline_info", unsafe.Sizeof(gpiolineInfo{}), 72},
+	} {
+		if s.got != s.linux {
+			t.Errorf("sizeof(struct %s) is %d, kernel expects %d", s.name, s.got, s.linux)
+		}
+	}
+	if gpio_get_linehandle_ioctl_ != 0xC16CB403 {
+		t.Errorf("GPIO_GET_LINEHANDLE_IOCTL is %#x", gpio_get_linehandle_ioctl_)
+	}
+}
+
+func Test_CdevGPIOUAPIFallback(t *testing.T) {
+	chip, err := ioutil.TempFile("", "gpiochip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chip.Close()
+	defer os.Remove(chip.Name())
+	defer func() { gpio_ioctl_ = gpioIoctl }()
+	for _, uapi := range []int{1, 2} {
+		m := &mockCdevChip{uapi: uapi}
+		if err := unix.Pipe2(m.events[:], unix.O_CLOEXEC|unix.O_NONBLOCK); err != nil {
+			t.Fatal(err)
+		}
+		gpio_ioctl_ = m.ioctl
+		gpio, err := NewCdevGPIOFromPath(chip.Name(), 0, OUT, CdevWithBias(PULLUP), CdevWithDriveMode(OPEN_DRAIN))
+		if err != nil {
+			t.Fatal(uapi, err)
+		}
+		if gpio.UAPIVersion() != uapi {
+			t.Errorf("UAPIVersion() = %d, expected %d", gpio.UAPIVersion(), uapi)
+		}
+		if want := uint64(gpio_v2_line_flag_output_ | gpio_v2_line_flag_bias_pull_up_ | gpio_v2_line_flag_open_drain_); m.flags != want {
+			t.Errorf("uapi %d: requested flags %#x, expected %#x", uapi, m.flags, want)
+		}
+		if err := gpio.SetState(true); err != nil || m.values != 1 || !GetStateOrPanic(gpio) {
+			t.Errorf("uapi %d: SetState(true) failed: %v", uapi, err)
+		}
+		err = gpio.SetDebounce(time.Millisecond)
+		if supported := err == nil; supported != (uapi == 2) {
+			t.Errorf("uapi %d: SetDebounce returned %v", uapi, err)
+		}
+		if uapi == 1 && !errors.Is(err, ErrNotSupported) {
+			t.Error("SetDebounce on v1 does not return ErrNotSupported:", err)
+		}
+		if err := gpio.SetDirection(IN); err != nil {
+			t.Fatal(uapi, err)
+		}
+		if err := gpio.SetEdge(RISING); err != nil {
+			t.Fatal(uapi, err)
+		}
+		if m.flags&(gpio_v2_line_flag_input_|gpio_v2_line_flag_edge_rising_) != gpio_v2_line_flag_input_|gpio_v2_line_flag_edge_rising_ {
+			t.Errorf("uapi %d: edge request has flags %#x", uapi, m.flags)
+		}
+		events := make(chan EdgeEvent, 1)
+		if err := gpio.SetEdgeEventCallback(events, -1); err != nil {
+			t.Fatal(uapi, err)
+		}
+		m.rising(1000)
+		select {
+		case ev := <-events:
+			if ev.Edge != RISING || !ev.State || ev.Timestamp != 1000 {
+				t.Errorf("uapi %d: got %+v", uapi, ev)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("uapi %d: no edge event", uapi)
+		}
+		gpio.Close()
+		for range events {
+		}
+		unix.Close(m.events[0])
+		unix.Close(m.events[1])
+	}
+}
+
+// compare with Benchmark_CdevGPIOReRequestOnGPIOSim, which shows the cost of releasing and requesting the line
+func Benchmark_CdevGPIOSetDirectionOnGPIOSim(b *testing.B) {
+	gpio, err := NewCdevGPIOFromPath(findGPIOSimChip(b), 0, OUT)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer gpio.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		gpio.SetDirection(Direction(i & 1))
+	}
+}
+
+func Benchmark_CdevGPIOReRequestOnGPIOSim(b *testing.B) {
+	gpio, err := NewCdevGPIOFromPath(findGPIOSimChip(b), 0, OUT)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer gpio.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		gpio.lock.Lock()
+		gpio.dir = Direction(i & 1)
+		gpio.request()
+		gpio.lock.Unlock()
+	}
+}
@@ -0,0 +1,149 @@
+package bbhw
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+/// Definitions from linux/gpio.h (GPIO character device uAPI)
+/// golang.org/x/sys/unix does not (yet) provide these
+
+const (
+	gpio_max_name_size_            = 32
+	gpio_v2_lines_max_             = 64
+	gpio_v2_line_num_attrs_max_    = 10
+	gpio_v2_line_attr_id_flags_    = 1
+	gpio_v2_line_attr_id_values_   = 2
+	gpio_v2_line_attr_id_debounce_ = 3
+)
+
+const (
+	gpio_v2_line_flag_used_                 = 1 << 0
+	gpio_v2_line_flag_active_low_           = 1 << 1
+	gpio_v2_line_flag_input_                = 1 << 2
+	gpio_v2_line_flag_output_               = 1 << 3
+	gpio_v2_line_flag_edge_rising_          = 1 << 4
+	gpio_v2_line_flag_edge_falling_         = 1 << 5
+	gpio_v2_line_flag_open_drain_           = 1 << 6
+	gpio_v2_line_flag_open_source_          = 1 << 7
+	gpio_v2_line_flag_bias_pull_up_         = 1 << 8
+	gpio_v2_line_flag_bias_pull_down_       = 1 << 9
+	gpio_v2_line_flag_bias_disabled_        = 1 << 10
+	gpio_v2_line_flag_event_clock_realtime_ = 1 << 11
+)
+
+type gpiochipInfo struct {
+	name  [gpio_max_name_size_]byte
+	label [gpio_max_name_size_]byte
+	lines uint32
+}
+
+type gpioV2LineValues struct {
+	bits uint64
+	mask uint64
+}
+
+// the kernel declares a union of flags, values and debounce_period_us; we use the widest member
+type gpioV2LineAttribute struct {
+	id      uint32
+	padding uint32
+	value   uint64
+}
+
+type gpioV2LineConfigAttribute struct {
+	attr gpioV2LineAttribute
+	mask uint64
+}
+
+type gpioV2LineConfig struct {
+	flags     uint64
+	num_attrs uint32
+	padding   [5]uint32
+	attrs     [gpio_v2_line_num_attrs_max_]gpioV2LineConfigAttribute
+}
+
+type gpioV2LineRequest struct {
+	offsets           [gpio_v2_lines_max_]uint32
+	consumer          [gpio_max_name_size_]byte
+	config            gpioV2LineConfig
+	num_lines         uint32
+	event_buffer_size uint32
+	padding           [5]uint32
+	fd                int32
+}
+
+type gpioV2LineInfo struct {
+	name      [gpio_max_name_size_]byte
+	consumer  [gpio_max_name_size_]byte
+	offset    uint32
+	num_attrs uint32
+	flags     uint64
+	attrs     [gpio_v2_line_num_attrs_max_]gpioV2LineAttribute
+	padding   [4]uint32
+}
+
+type gpioV2LineEvent struct {
+	timestamp_ns uint64
+	id           uint32
+	offset       uint32
+	seqno        uint32
+	line_seqno   uint32
+	padding      [6]uint32
+}
+
+type gpioV2LineInfoChanged struct {
+	info         gpioV2LineInfo
+	timestamp_ns uint64
+	event_type   uint32
+	padding      [5]uint32
+}
+
+// _IOC encoding as used by arm and x86 (asm-generic/ioctl.h)
+func gpioIOC(dir, nr, size uintptr) uintptr {
+	return dir<<30 | size<<16 | 0xB4<<8 | nr
+}
+
+const (
+	ioc_read_      = 2
+	ioc_readwrite_ = 3
+)
+
+var (
+	gpio_get_chipinfo_ioctl_          = gpioIOC(ioc_read_, 0x01, unsafe.Sizeof(gpiochipInfo{}))
+	gpio_v2_get_lineinfo_ioctl_       = gpioIOC(ioc_readwrite_, 0x05, unsafe.Sizeof(gpioV2LineInfo{}))
+	gpio_v2_get_lineinfo_watch_ioctl_ = gpioIOC(ioc_readwrite_, 0x06, unsafe.Sizeof(gpioV2LineInfo{}))
+	gpio_get_lineinfo_unwatch_ioctl_  = gpioIOC(ioc_readwrite_, 0x0C, 4)
+	gpio_v2_get_line_ioctl_           = gpioIOC(ioc_readwrite_, 0x07, unsafe.Sizeof(gpioV2LineRequest{}))
+	gpio_v2_line_set_config_ioctl_    = gpioIOC(ioc_readwrite_, 0x0D, unsafe.Sizeof(gpioV2LineConfig{}))
+	gpio_v2_line_get_values_ioctl_    = gpioIOC(ioc_readwrite_, 0x0E, unsafe.Sizeof(gpioV2LineValues{}))
+	gpio_v2_line_set_values_ioctl_    = gpioIOC(ioc_readwrite_, 0x0F, unsafe.Sizeof(gpioV2LineValues{}))
+)
+
+// all cdev ioctls go through here, replaced by tests
+var gpio_ioctl_ = gpioIoctl
+
+func gpioIoctl(fd int, req uintptr, arg unsafe.Pointer) error {
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), req, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// copy s into a zero terminated C char array
+func setCString(dst []byte, s string) {
+	n := copy(dst[:len(dst)-1], s)
+	for i := n; i < len(dst); i++ {
+		dst[i] = 0
+	}
+}
+
+func getCString(src []byte) string {
+	for i, c := range src {
+		if c == 0 {
+			return string(src[:i])
+		}
+	}
+	return string(src)
+}
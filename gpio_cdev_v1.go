@@ -0,0 +1,212 @@
+package bbhw
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+/// Definitions of the deprecated v1 GPIO character device uAPI (linux 4.8 - 5.9) from linux/gpio.h
+/// Used as fallback if the kernel does not know the v2 ioctls (ENOTTY)
+
+const (
+	gpiohandles_max_ = 64
+)
+
+const (
+	gpiohandle_request_input_        = 1 << 0
+	gpiohandle_request_output_       = 1 << 1
+	gpiohandle_request_active_low_   = 1 << 2
+	gpiohandle_request_open_drain_   = 1 << 3
+	gpiohandle_request_open_source_  = 1 << 4
+	gpiohandle_request_bias_pull_up_ = 1 << 5
+	gpiohandle_request_pull_down_    = 1 << 6
+	gpiohandle_request_bias_disable_ = 1 << 7
+)
+
+const (
+	gpioevent_request_rising_edge_  = 1 << 0
+	gpioevent_request_falling_edge_ = 1 << 1
+)
+
+const (
+	gpioline_flag_kernel_ = 1 << 0
+	gpioline_flag_is_out_ = 1 << 1
+)
+
+type gpiohandleRequest struct {
+	lineoffsets    [gpiohandles_max_]uint32
+	flags          uint32
+	default_values [gpiohandles_max_]uint8
+	consumer_label [gpio_max_name_size_]byte
+	lines          uint32
+	fd             int32
+}
+
+type gpiohandleData struct {
+	values [gpiohandles_max_]uint8
+}
+
+type gpioeventRequest struct {
+	lineoffset     uint32
+	handleflags    uint32
+	eventflags     uint32
+	consumer_label [gpio_max_name_size_]byte
+	fd             int32
+}
+
+type gpioeventData struct {
+	timestamp uint64
+	id        uint32
+	padding   uint32
+}
+
+type gpiolineInfo struct {
+	line_offset uint32
+	flags       uint32
+	name        [gpio_max_name_size_]byte
+	consumer    [gpio_max_name_size_]byte
+}
+
+var (
+	gpio_get_lineinfo_ioctl_          = gpioIOC(ioc_readwrite_, 0x02, unsafe.Sizeof(gpiolineInfo{}))
+	gpio_get_linehandle_ioctl_        = gpioIOC(ioc_readwrite_, 0x03, unsafe.Sizeof(gpiohandleRequest{}))
+	gpio_get_lineevent_ioctl_         = gpioIOC(ioc_readwrite_, 0x04, unsafe.Sizeof(gpioeventRequest{}))
+	gpiohandle_get_line_values_ioctl_ = gpioIOC(ioc_readwrite_, 0x08, unsafe.Sizeof(gpiohandleData{}))
+	gpiohandle_set_line_values_ioctl_ = gpioIOC(ioc_readwrite_, 0x09, unsafe.Sizeof(gpiohandleData{}))
+)
+
+// v2 line flags and their v1 handle flag counterparts
+var cdev_v1_handle_flags_ = [...]struct {
+	v2 uint64
+	v1 uint32
+}{
+	{gpio_v2_line_flag_input_, gpiohandle_request_input_},
+	{gpio_v2_line_flag_output_, gpiohandle_request_output_},
+	{gpio_v2_line_flag_active_low_, gpiohandle_request_active_low_},
+	{gpio_v2_line_flag_open_drain_, gpiohandle_request_open_drain_},
+	{gpio_v2_line_flag_open_source_, gpiohandle_request_open_source_},
+	{gpio_v2_line_flag_bias_pull_up_, gpiohandle_request_bias_pull_up_},
+	{gpio_v2_line_flag_bias_pull_down_, gpiohandle_request_pull_down_},
+	{gpio_v2_line_flag_bias_disabled_, gpiohandle_request_bias_disable_},
+}
+
+func cdevV1HandleFlags(flags uint64) (hf uint32) {
+	for _, f := range cdev_v1_handle_flags_ {
+		if flags&f.v2 != 0 {
+			hf |= f.v1
+		}
+	}
+	return
+}
+
+func cdevV1EventFlags(flags uint64) (ef uint32) {
+	if flags&gpio_v2_line_flag_edge_rising_ != 0 {
+		ef |= gpioevent_request_rising_edge_
+	}
+	if flags&gpio_v2_line_flag_edge_falling_ != 0 {
+		ef |= gpioevent_request_falling_edge_
+	}
+	return
+}
+
+// v1 counterpart of cdevRequestLines. Edges are only supported on single lines, which then can not be outputs.
+func cdevRequestLinesV1(chipfd int, chippath string, offsets []uint, cfg cdevLineConfig) (int, error) {
+	if cfg.debounce > 0 || cfg.flags&gpio_v2_line_flag_event_clock_realtime_ != 0 {
+		return -1, fmt.Errorf("debounce and event clock selection need the v2 GPIO uAPI (linux >= 5.10): %w", ErrNotSupported)
+	}
+	consumer := cdevConsumer(cfg.consumer)
+	var err error
+	var fd int32
+	if eventflags := cdevV1EventFlags(cfg.flags); eventflags != 0 {
+		if len(offsets) != 1 {
+			return -1, fmt.Errorf("edge detection on several lines at once needs the v2 GPIO uAPI (linux >= 5.10): %w", ErrNotSupported)
+		}
+		req := gpioeventRequest{lineoffset: uint32(offsets[0]), handleflags: cdevV1HandleFlags(cfg.flags), eventflags: eventflags}
+		setCString(req.consumer_label[:], consumer)
+		err = gpio_ioctl_(chipfd, gpio_get_lineevent_ioctl_, unsafe.Pointer(&req))
+		fd = req.fd
+	} else {
+		var req gpiohandleRequest
+		for i, offset := range offsets {
+			req.lineoffsets[i] = uint32(offset)
+			req.default_values[i] = uint8(cfg.values >> uint(i) & 1)
+		}
+		req.lines = uint32(len(offsets))
+		req.flags = cdevV1HandleFlags(cfg.flags)
+		setCString(req.consumer_label[:], consumer)
+		err = gpio_ioctl_(chipfd, gpio_get_linehandle_ioctl_, unsafe.Pointer(&req))
+		fd = req.fd
+	}
+	if err == unix.EBUSY {
+		return -1, cdevBusyError(chipfd, chippath, offsets)
+	} else if err != nil {
+		return -1, fmt.Errorf("requesting lines %v of %s: %w", offsets, chippath, err)
+	}
+	return int(fd), nil
+}
+
+// v1 has no mask, always reads all requested lines
+func cdevGetValuesV1(linefd int) (bits uint64, err error) {
+	var data gpiohandleData
+	if err = gpio_ioctl_(linefd, gpiohandle_get_line_values_ioctl_, unsafe.Pointer(&data)); err != nil {
+		return 0, err
+	}
+	for i, v := range data.values {
+		if v != 0 {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
+
+// v1 has no mask, always sets all requested lines
+func cdevSetValuesV1(linefd int, bits uint64) error {
+	var data gpiohandleData
+	for i := range data.values {
+		data.values[i] = uint8(bits >> uint(i) & 1)
+	}
+	return gpio_ioctl_(linefd, gpiohandle_set_line_values_ioctl_, unsafe.Pointer(&data))
+}
+
+// GPIO_GET_LINEINFO_IOCTL, translated into a gpio_v2_line_info
+func cdevLineInfoV1(chipfd int, offset uint) (info gpioV2LineInfo, err error) {
+	v1 := gpiolineInfo{line_offset: uint32(offset)}
+	if err = gpio_ioctl_(chipfd, gpio_get_lineinfo_ioctl_, unsafe.Pointer(&v1)); err != nil {
+		return
+	}
+	info.name = v1.name
+	info.consumer = v1.consumer
+	info.offset = v1.line_offset
+	if v1.flags&gpioline_flag_kernel_ != 0 {
+		info.flags |= gpio_v2_line_flag_used_
+	}
+	if v1.flags&gpioline_flag_is_out_ != 0 {
+		info.flags |= gpio_v2_line_flag_output_
+	} else {
+		info.flags |= gpio_v2_line_flag_input_
+	}
+	// the remaining v1 line flags use the same bits as the v1 handle flags
+	for _, f := range cdev_v1_handle_flags_[2:] {
+		if v1.flags&f.v1 != 0 {
+			info.flags |= f.v2
+		}
+	}
+	return
+}
+
+// v1 event timestamps are CLOCK_REALTIME before linux 5.7 and CLOCK_MONOTONIC since,
+// guess which one by looking which clock is closer
+func cdevV1TimestampIsRealtime(ts uint64) bool {
+	var mono unix.Timespec
+	unix.ClockGettime(unix.CLOCK_MONOTONIC, &mono)
+	dist := func(a, b int64) int64 {
+		if a > b {
+			return a - b
+		}
+		return b - a
+	}
+	return dist(int64(ts), time.Now().UnixNano()) < dist(int64(ts), mono.Nano())
+}
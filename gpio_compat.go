@@ -0,0 +1,177 @@
+package bbhw
+
+// The interfaces as they were before Direction and Edge got types of their own, with directions and edges as plain int.
+// FromLegacy* wraps an implementation written against them so it can be used where the typed interfaces are expected,
+// ToLegacy* does the opposite for code still holding the old interfaces.
+//
+// Deprecated: use GPIOControllablePin with Direction and Edge, the Legacy* interfaces only exist to ease porting.
+type LegacyGPIOControllablePin interface {
+	SetState(bool) error
+	SetStateNow(bool) error
+	GetState() (bool, error)
+	CheckDirection() (int, error)
+	SetActiveLow(bool) error
+}
+
+// Deprecated: use GPIO, see LegacyGPIOControllablePin
+type LegacyGPIO interface {
+	LegacyGPIOControllablePin
+	SetDirection(int) error
+	Close()
+	Backend() string
+	Capabilities() GPIOCapabilities
+	Snapshot() PinSnapshot
+	SetLogicalInvert(bool) error
+}
+
+// Deprecated: use EdgeGPIO, see LegacyGPIOControllablePin
+type LegacyEdgeGPIO interface {
+	LegacyGPIO
+	SetEdge(int) error
+	GetEdge() (string, error)
+	SetEdgeCallback(*chan bool, int) error
+}
+
+// Deprecated: use GPIOCollectionFactory, see LegacyGPIOControllablePin
+type LegacyGPIOCollectionFactory interface {
+	EndTransactionApplySetStates()
+	BeginTransactionRecordSetStates()
+	NewGPIO(uint, int) LegacyGPIOControllablePinInCollection
+}
+
+// Deprecated: use GPIOControllablePinInCollection, see LegacyGPIOControllablePin
+type LegacyGPIOControllablePinInCollection interface {
+	SetState(bool) error
+	SetStateNow(bool) error
+	GetState() (bool, error)
+	CheckDirection() (int, error)
+	SetActiveLow(bool) error
+	SetFutureState(state bool) error
+	GetFutureState() (state_known, state bool, err error)
+}
+
+// ----------- old implementations behind the typed interfaces ----------------
+
+type legacyPin struct{ LegacyGPIOControllablePin }
+
+func (p legacyPin) CheckDirection() (Direction, error) {
+	d, err := p.LegacyGPIOControllablePin.CheckDirection()
+	return Direction(d), err
+}
+
+func FromLegacyPin(p LegacyGPIOControllablePin) GPIOControllablePin {
+	if p == nil {
+		panic("gpio == nil")
+	}
+	return legacyPin{p}
+}
+
+type legacyGPIO struct{ LegacyGPIO }
+
+func (g legacyGPIO) CheckDirection() (Direction, error) {
+	d, err := g.LegacyGPIO.CheckDirection()
+	return Direction(d), err
+}
+
+func (g legacyGPIO) SetDirection(d Direction) error { return g.LegacyGPIO.SetDirection(int(d)) }
+
+func FromLegacyGPIO(g LegacyGPIO) GPIO {
+	if g == nil {
+		panic("gpio == nil")
+	}
+	return legacyGPIO{g}
+}
+
+type legacyEdgeGPIO struct{ LegacyEdgeGPIO }
+
+func (g legacyEdgeGPIO) CheckDirection() (Direction, error) {
+	d, err := g.LegacyEdgeGPIO.CheckDirection()
+	return Direction(d), err
+}
+
+func (g legacyEdgeGPIO) SetDirection(d Direction) error { return g.LegacyEdgeGPIO.SetDirection(int(d)) }
+
+func (g legacyEdgeGPIO) SetEdge(e Edge) error { return g.LegacyEdgeGPIO.SetEdge(int(e)) }
+
+func FromLegacyEdgeGPIO(g LegacyEdgeGPIO) EdgeGPIO {
+	if g == nil {
+		panic("gpio == nil")
+	}
+	return legacyEdgeGPIO{g}
+}
+
+type legacyPinInCollection struct {
+	LegacyGPIOControllablePinInCollection
+}
+
+func (p legacyPinInCollection) CheckDirection() (Direction, error) {
+	d, err := p.LegacyGPIOControllablePinInCollection.CheckDirection()
+	return Direction(d), err
+}
+
+type legacyCollectionFactory struct{ LegacyGPIOCollectionFactory }
+
+func (f legacyCollectionFactory) NewGPIO(number uint, d Direction) GPIOControllablePinInCollection {
+	return legacyPinInCollection{f.LegacyGPIOCollectionFactory.NewGPIO(number, int(d))}
+}
+
+func FromLegacyGPIOCollectionFactory(f LegacyGPIOCollectionFactory) GPIOCollectionFactory {
+	if f == nil {
+		panic("gpiocf == nil")
+	}
+	return legacyCollectionFactory{f}
+}
+
+// ----------- typed implementations behind the old interfaces ----------------
+
+type intPin struct{ GPIOControllablePin }
+
+func (p intPin) CheckDirection() (int, error) {
+	d, err := p.GPIOControllablePin.CheckDirection()
+	return int(d), err
+}
+
+func ToLegacyPin(p GPIOControllablePin) LegacyGPIOControllablePin {
+	if p == nil {
+		panic("gpio == nil")
+	}
+	return intPin{p}
+}
+
+type intGPIO struct{ GPIO }
+
+func (g intGPIO) CheckDirection() (int, error) {
+	d, err := g.GPIO.CheckDirection()
+	return int(d), err
+}
+
+func (g intGPIO) SetDirection(d int) error { return g.GPIO.SetDirection(Direction(d)) }
+
+func ToLegacyGPIO(g GPIO) LegacyGPIO {
+	if g == nil {
+		panic("gpio == nil")
+	}
+	return intGPIO{g}
+}
+
+type intEdgeGPIO struct{ EdgeGPIO }
+
+func (g intEdgeGPIO) CheckDirection() (int, error) {
+	d, err := g.EdgeGPIO.CheckDirection()
+	return int(d), err
+}
+
+func (g intEdgeGPIO) SetDirection(d int) error { return g.EdgeGPIO.SetDirection(Direction(d)) }
+
+func (g intEdgeGPIO) SetEdge(e int) error { return g.EdgeGPIO.SetEdge(Edge(e)) }
+
+func ToLegacyEdgeGPIO(g EdgeGPIO) LegacyEdgeGPIO {
+	if g == nil {
+		panic("gpio == nil")
+	}
+	return intEdgeGPIO{g}
+}
+
+var _ EdgeGPIO = legacyEdgeGPIO{}
+var _ GPIOCollectionFactory = legacyCollectionFactory{}
+var _ LegacyEdgeGPIO = intEdgeGPIO{}
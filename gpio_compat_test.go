@@ -0,0 +1,76 @@
+package bbhw
+
+import "testing"
+
+// an EdgeGPIO written before Direction and Edge had types
+type oldStyleGPIO struct {
+	*FakeGPIO
+}
+
+func (g oldStyleGPIO) CheckDirection() (int, error) {
+	d, err := g.FakeGPIO.CheckDirection()
+	return int(d), err
+}
+
+func (g oldStyleGPIO) SetDirection(d int) error { return g.FakeGPIO.SetDirection(Direction(d)) }
+
+func (g oldStyleGPIO) SetEdge(e int) error { return g.FakeGPIO.SetEdge(Edge(e)) }
+
+func Test_LegacyGPIOShims(t *testing.T) {
+	fake := NewFakeGPIO(1, IN)
+	defer fake.Close()
+	var gpio EdgeGPIO = FromLegacyEdgeGPIO(oldStyleGPIO{fake})
+	if err := gpio.SetDirection(OUT); err != nil {
+		t.Fatal(err)
+	}
+	if d := CheckDirectionOrPanic(gpio); d != OUT {
+		t.Errorf("direction %v after SetDirection(OUT)", d)
+	}
+	if err := gpio.SetDirection(IN); err != nil {
+		t.Fatal(err)
+	}
+	if err := gpio.SetEdge(RISING); err != nil {
+		t.Fatal(err)
+	}
+	if edge, _ := fake.GetEdge(); edge != "rising" {
+		t.Errorf("edge %s after SetEdge(RISING)", edge)
+	}
+
+	var old LegacyEdgeGPIO = ToLegacyEdgeGPIO(fake)
+	dir := 1
+	if err := old.SetDirection(dir); err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := old.CheckDirection(); d != dir {
+		t.Errorf("direction %d, expected %d", d, dir)
+	}
+	if d, _ := fake.CheckDirection(); d != OUT {
+		t.Errorf("FakeGPIO direction %v", d)
+	}
+	if err := old.SetDirection(7); err == nil {
+		t.Error("invalid direction accepted")
+	}
+}
+
+func Test_LegacyGPIOCollectionFactoryShim(t *testing.T) {
+	cf := FromLegacyGPIOCollectionFactory(oldStyleCollection{NewFakeGPIOCollectionFactory()})
+	pin := cf.NewGPIO(3, OUT)
+	if d, err := pin.CheckDirection(); err != nil || d != OUT {
+		t.Errorf("direction %v, %v", d, err)
+	}
+}
+
+type oldStyleCollection struct{ *FakeGPIOCollectionFactory }
+
+func (c oldStyleCollection) NewGPIO(number uint, d int) LegacyGPIOControllablePinInCollection {
+	return oldStylePinInCollection{c.FakeGPIOCollectionFactory.NewGPIO(number, Direction(d))}
+}
+
+type oldStylePinInCollection struct {
+	GPIOControllablePinInCollection
+}
+
+func (p oldStylePinInCollection) CheckDirection() (int, error) {
+	d, err := p.GPIOControllablePinInCollection.CheckDirection()
+	return int(d), err
+}
@@ -0,0 +1,311 @@
+package bbhw
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// creates a fake /sys/class/gpio tree with export file and gpioN directories for numbers
+// the attribute files are plain files, so there is no kernel behaviour (e.g. active_low) behind them
+func useFakeSysfsGPIOTree(t testing.TB, numbers ...uint) string {
+	dir := t.TempDir()
+	ioutil.WriteFile(filepath.Join(dir, "export"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "unexport"), nil, 0644)
+	for _, n := range numbers {
+		gdir := filepath.Join(dir, fmt.Sprintf("gpio%d", n))
+		os.Mkdir(gdir, 0755)
+		for attr, value := range map[string]string{"direction": "in\n", "value": "0\n", "edge": "none\n", "active_low": "0\n"} {
+			ioutil.WriteFile(filepath.Join(gdir, attr), []byte(value), 0644)
+		}
+	}
+	prev := sysfs_gpio_base_
+	sysfs_gpio_base_ = dir
+	t.Cleanup(func() { sysfs_gpio_base_ = prev })
+	useFreshClaimRegistry(t)
+	return dir
+}
+
+// a new system has no pins claimed yet
+func useFreshClaimRegistry(t testing.TB) {
+	claims_.lock.Lock()
+	prev := claims_.pins
+	claims_.pins = make(map[string]*pinClaim)
+	claims_.lock.Unlock()
+	t.Cleanup(func() {
+		claims_.lock.Lock()
+		claims_.pins = prev
+		claims_.lock.Unlock()
+	})
+}
+
+// behaviour every GPIOControllablePin implementation must show, gpio must be an output
+func checkGPIOControllablePinBehaviour(t *testing.T, name string, gpio GPIOControllablePin) {
+	if dir, err := gpio.CheckDirection(); err != nil || dir != OUT {
+		t.Errorf("%s: CheckDirection() = %v, %v; expected OUT", name, dir, err)
+	}
+	for _, state := range []bool{true, false, true, false} {
+		if err := gpio.SetState(state); err != nil {
+			t.Errorf("%s: SetState(%v): %v", name, state, err)
+		}
+		if got, err := gpio.GetState(); err != nil || got != state {
+			t.Errorf("%s: GetState() = %v, %v after SetState(%v)", name, got, err, state)
+		}
+		if err := gpio.SetStateNow(!state); err != nil {
+			t.Errorf("%s: SetStateNow(%v): %v", name, !state, err)
+		}
+		if got, err := gpio.GetState(); err != nil || got != !state {
+			t.Errorf("%s: GetState() = %v, %v after SetStateNow(%v)", name, got, err, !state)
+		}
+	}
+}
+
+// behaviour of the GPIO interface on top of checkGPIOControllablePinBehaviour, gpio must be an output
+func checkGPIOBehaviour(t *testing.T, name string, gpio GPIO) {
+	checkGPIOControllablePinBehaviour(t, name, gpio)
+	if gpio.Backend() == "" {
+		t.Errorf("%s: Backend() is empty", name)
+	}
+	caps := gpio.Capabilities()
+	if _, ok := gpio.(EdgeGPIO); ok != caps.Edges {
+		t.Errorf("%s: Capabilities().Edges is %v, but EdgeGPIO implemented is %v", name, caps.Edges, ok)
+	}
+	if b, ok := gpio.(interface{ SetBias(int) error }); ok {
+		if err := b.SetBias(PULLUP); (err == nil) != caps.Bias || (err != nil && !errors.Is(err, ErrNotSupported)) {
+			t.Errorf("%s: SetBias returned %v with Capabilities().Bias %v", name, err, caps.Bias)
+		}
+	} else if caps.Bias {
+		t.Errorf("%s: Capabilities().Bias without SetBias", name)
+	}
+	for _, dir := range []Direction{IN, OUT} {
+		if err := gpio.SetDirection(dir); err != nil {
+			t.Errorf("%s: SetDirection(%d): %v", name, dir, err)
+		}
+		if got, err := gpio.CheckDirection(); err != nil || got != dir {
+			t.Errorf("%s: CheckDirection() = %v, %v after SetDirection(%d)", name, got, err, dir)
+		}
+	}
+	state, _ := gpio.GetState()
+	if s := gpio.Snapshot(); s.Backend != gpio.Backend() || s.Direction != OUT || s.State != state || s.Error != "" {
+		t.Errorf("%s: Snapshot() = %+v, expected an output in state %v", name, s, state)
+	}
+	if err := gpio.SetLogicalInvert(true); err != nil {
+		t.Errorf("%s: SetLogicalInvert(true): %v", name, err)
+	}
+	gpio.SetState(true)
+	if got, err := gpio.GetState(); err != nil || !got || !gpio.Snapshot().Inverted {
+		t.Errorf("%s: GetState() = %v, %v after SetState(true) inverted", name, got, err)
+	}
+	// the output keeps on driving what it did
+	gpio.SetLogicalInvert(false)
+	if got, err := gpio.GetState(); err != nil || got {
+		t.Errorf("%s: GetState() = %v, %v after SetLogicalInvert(false)", name, got, err)
+	}
+	if edgegpio, ok := gpio.(EdgeGPIO); ok {
+		checkEdgeGPIOBehaviour(t, name, edgegpio)
+	}
+	gpio.Close()
+}
+
+func checkEdgeGPIOBehaviour(t *testing.T, name string, gpio EdgeGPIO) {
+	if err := gpio.SetDirection(IN); err != nil {
+		t.Errorf("%s: SetDirection(IN): %v", name, err)
+	}
+	for edge, str := range []string{"rising", "falling", "both", "none"} {
+		if err := gpio.SetEdge(Edge(edge)); err != nil {
+			t.Errorf("%s: SetEdge(%s): %v", name, str, err)
+		}
+		if got, err := gpio.GetEdge(); err != nil || got != str {
+			t.Errorf("%s: GetEdge() = %q, %v after SetEdge(%s)", name, got, err, str)
+		}
+	}
+	if err := gpio.SetEdge(NONE + 1); err == nil {
+		t.Errorf("%s: SetEdge accepted invalid edge", name)
+	}
+	ch := make(chan bool)
+	if err := gpio.SetEdgeCallback(&ch, 0); err == nil {
+		t.Errorf("%s: SetEdgeCallback accepted edge NONE", name)
+	}
+}
+
+func Test_GPIOConformance(t *testing.T) {
+	checkGPIOBehaviour(t, "FakeGPIO", NewFakeGPIO(1, OUT))
+
+	useFakeSysfsGPIOTree(t, 67)
+	sg, err := NewSysfsGPIO(67, OUT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGPIOBehaviour(t, "SysfsGPIO", sg)
+
+	cg, err := NewFakeCdevChip(1).NewGPIO(0, OUT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGPIOBehaviour(t, "CdevGPIO on FakeCdevChip", cg)
+
+	if verifyAddrIsTIOmap4(omap4_gpio0_offset_) {
+		checkGPIOBehaviour(t, "MMappedGPIO", NewMMappedGPIO(67, OUT))
+		checkGPIOBehaviour(t, "HybridGPIO", NewHybridGPIOOrPanic(67, OUT))
+	} else {
+		t.Logf("MMappedGPIO and HybridGPIO only work on BeagleBone")
+	}
+}
+
+func Test_CdevGPIOConformance(t *testing.T) {
+	chip := findGPIOSimChip(t)
+	gpio, err := NewCdevGPIOFromPath(chip, 0, OUT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGPIOBehaviour(t, "CdevGPIO", gpio)
+}
+
+func Test_InvalidDirection(t *testing.T) {
+	useFakeSysfsGPIOTree(t, 44, 45)
+	sg, err := NewSysfsGPIO(45, IN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chip := NewFakeCdevChip(2)
+	cg, err := chip.NewGPIO(1, IN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hg, err := NewHybridGPIOFromPins(sg, &MMappedGPIO{chipid: 1, gpioid: 13})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []Direction{OUT + 1, IN - 1, 3} {
+		for _, c := range []struct {
+			name string
+			try  func() error
+		}{
+			{"NewSysfsGPIO", func() error { _, err := NewSysfsGPIO(44, dir); return err }},
+			{"SysfsGPIO.SetDirection", func() error { return sg.SetDirection(dir) }},
+			{"NewFakeGPIOOrError", func() error { _, err := NewFakeGPIOOrError(1, dir); return err }},
+			{"FakeGPIO.SetDirection", func() error { return NewFakeGPIO(1, IN).SetDirection(dir) }},
+			{"NewFakePinGroup", func() error {
+				_, err := NewFakePinGroup(map[string]uint{"a": 1}, map[string]Direction{"a": dir})
+				return err
+			}},
+			{"FakeCdevChip.NewGPIO", func() error { _, err := chip.NewGPIO(0, dir); return err }},
+			{"FakeCdevChip.NewGPIOLines", func() error { _, err := chip.NewGPIOLines([]uint{0}, dir, ""); return err }},
+			{"CdevGPIO.SetDirection", func() error { return cg.SetDirection(dir) }},
+			{"MMappedGPIO.SetDirection", func() error { return new(MMappedGPIO).SetDirection(dir) }},
+			{"HybridGPIO.SetDirection", func() error { return hg.SetDirection(dir) }},
+			{"NewBestGPIO", func() error { _, err := NewBestGPIO(44, dir); return err }},
+		} {
+			err := c.try()
+			if !errors.Is(err, ErrInvalidDirection) {
+				t.Errorf("%s(%d) = %v, expected ErrInvalidDirection", c.name, dir, err)
+			} else if !strings.Contains(err.Error(), fmt.Sprint(int(dir))) {
+				t.Errorf("%s(%d): %q does not name the direction", c.name, dir, err)
+			}
+		}
+	}
+	// nothing was changed by the rejected calls
+	if d, err := sg.CheckDirection(); err != nil || d != IN {
+		t.Errorf("SysfsGPIO direction %v, %v after invalid SetDirection", d, err)
+	}
+	if d, _ := cg.CheckDirection(); d != IN {
+		t.Errorf("CdevGPIO direction %v after invalid SetDirection", d)
+	}
+	// the constructors without an error make an input
+	var buf bytes.Buffer
+	fg := NewFakeNamedGPIO("F", 7, log.New(&buf, "", 0))
+	if d, _ := fg.CheckDirection(); d != IN || !strings.Contains(buf.String(), "using IN") {
+		t.Errorf("NewFakeNamedGPIO(7): direction %v, logged %q", d, buf.String())
+	}
+	if err := fg.FakeInput(true); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_LogicalInvertTruthTable(t *testing.T) {
+	chip := NewFakeCdevChip(1)
+	for _, c := range []struct {
+		activelow, invert, high bool
+	}{
+		{false, false, true},
+		{true, false, false},
+		{false, true, false},
+		{true, true, true},
+	} {
+		out, in := NewFakeGPIO(1, OUT), NewFakeGPIO(2, IN)
+		out.ConnectTo(in)
+		out.SetActiveLow(c.activelow)
+		out.SetLogicalInvert(c.invert)
+		out.SetState(true)
+		if high, _ := in.GetState(); high != c.high {
+			t.Errorf("FakeGPIO active_low %v, inverted %v: SetState(true) drives high %v", c.activelow, c.invert, high)
+		}
+
+		cg, err := chip.NewGPIO(0, OUT, CdevWithLogicalInvert(c.invert))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cg.SetActiveLow(c.activelow)
+		cg.SetState(true)
+		if high := chip.Level(0); high != c.high {
+			t.Errorf("CdevGPIO active_low %v, inverted %v: SetState(true) drives high %v", c.activelow, c.invert, high)
+		}
+		if state, err := cg.GetState(); err != nil || !state {
+			t.Errorf("CdevGPIO active_low %v, inverted %v: GetState() = %v, %v", c.activelow, c.invert, state, err)
+		}
+		cg.Close()
+	}
+}
+
+func Test_LogicalInvertEdges(t *testing.T) {
+	chip := NewFakeCdevChip(1)
+	cg, err := chip.NewGPIO(0, IN, CdevWithLogicalInvert(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cg.Close()
+	cg.SetEdge(RISING)
+	if info := chip.LineInfo(0); info.Edge != FALLING {
+		t.Errorf("inverted SetEdge(RISING) requested %v edges", info.Edge)
+	}
+	events := make(chan EdgeEvent, 4)
+	if err := cg.SetEdgeEventCallback(events, -1); err != nil {
+		t.Fatal(err)
+	}
+	chip.InjectEdge(0, true)
+	chip.InjectEdge(0, false)
+	select {
+	case ev := <-events:
+		if ev.Edge != RISING || !ev.State {
+			t.Errorf("falling edge on the wire reported as %+v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event")
+	}
+
+	dir := useFakeSysfsGPIOTree(t, 45)
+	sg, err := NewSysfsGPIOWithOptions(45, WithDirection(IN), WithEdge(RISING))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sg.Close()
+	if err = sg.SetLogicalInvert(true); err != nil {
+		t.Fatal(err)
+	}
+	if got := readSysfsAttr(t, dir, 45, "edge"); got != "falling" {
+		t.Errorf("edge %q in sysfs after SetLogicalInvert(true), expected falling", got)
+	}
+	if got, _ := sg.GetEdge(); got != "rising" {
+		t.Errorf("GetEdge() = %q after SetLogicalInvert(true)", got)
+	}
+	if state, _ := sg.GetState(); !state {
+		t.Error("low input not read as true when inverted")
+	}
+}
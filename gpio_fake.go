@@ -5,17 +5,38 @@ package bbhw
 import (
 	"fmt"
 	"log"
+	"sync"
+	"time"
 )
 
 // Use FakeGPIO for testing and debugging.
 // Does not actually toogle GPIOs and works even on your normal computer.
 type FakeGPIO struct {
 	name        string
-	dir         int
+	number      uint
+	lock        sync.Mutex // guards the fields from dir to logger, waveforms and connections change them concurrently
+	dir         Direction
 	value       bool
+	driven      bool // false until something drives an input, GetState then returns the level given by bias
+	released    bool // open-drain/open-source output currently not driving
 	activelow   bool
-	logTarget   *log.Logger
+	invert      bool // see SetLogicalInvert
+	bias        int
+	drive       int
+	logger      Logger // nil: FakeGPIODefaultLogTarget_ or the package Logger
 	connectedTo []*FakeGPIO
+	changed     lastChange
+	edges       fakeEdges
+	history     fakeHistory
+	waveform    fakeWaveform
+	bounce      fakeBounce
+	connections fakeConnections // made with ConnectToVia
+	net         *FakeNet
+	failures    fakeFailures
+	callbacks   fakeCallbacks // see OnChange
+	latency     fakeLatency
+	drivers     fakeDrivers // outputs connected to this input, see SetCombineMode
+	noise       fakeNoise
 }
 
 type FakeGPIONullWriter struct{}
@@ -32,50 +53,202 @@ func init() {
 
 // same signature as all the other New*GPIO implementations.
 // logs to FakeGPIODefaultLogTarget_ which is an exported field and thus you can set it to point to the log.Logger of your choice
-func NewFakeGPIO(gpionum uint, direction int) (gpio *FakeGPIO) {
+func NewFakeGPIO(gpionum uint, direction Direction) (gpio *FakeGPIO) {
 	return NewFakeNamedGPIO(fmt.Sprintf("FakeGPIO(%d)", gpionum), direction, nil)
 }
 
+// same signature as NewSysfsGPIO, but fails with ErrInvalidDirection for a direction other than IN or OUT,
+// for which NewFakeGPIO logs a warning and makes an input
+func NewFakeGPIOOrError(gpionum uint, direction Direction) (gpio *FakeGPIO, err error) {
+	if err = validateDirection(direction); err != nil {
+		return nil, err
+	}
+	return NewFakeGPIO(gpionum, direction), nil
+}
+
 // slightly more fancy FakeGPIO for debugging.
 // takes a name for easy recognition in debugging output and an optional logger (or nil) of your choice,
-// thus you could route debug output of different GPIOs to different destinations
-func NewFakeNamedGPIO(name string, direction int, logTarget *log.Logger) (gpio *FakeGPIO) {
-	gpio = &FakeGPIO{name: name, dir: direction, value: false, logTarget: logTarget}
+// thus you could route debug output of different GPIOs to different destinations.
+// A direction other than IN or OUT is logged as a warning and makes an input, see NewFakeGPIOOrError.
+func NewFakeNamedGPIO(name string, direction Direction, logTarget *log.Logger) (gpio *FakeGPIO) {
+	gpio = &FakeGPIO{name: name, number: fakeGPIONumber(name), dir: direction, value: false, logger: fakeGPIOLogger(logTarget)}
+	gpio.edges.edge = NONE
+	if err := validateDirection(direction); err != nil {
+		loggerOr(gpio.logger).Log(LOG_WARN, "FakeGPIO: "+err.Error()+", using IN", "gpio", name)
+		gpio.dir = IN
+	}
 	return
 }
 
-func (gpio *FakeGPIO) CheckDirection() (direction int, err error) {
-	return gpio.dir, nil
+func fakeGPIOLogger(logTarget *log.Logger) Logger {
+	if logTarget == nil {
+		return nil
+	}
+	return NewStdLogger(logTarget)
+}
+
+// Send the debug output of this pin to l instead
+func (gpio *FakeGPIO) SetLogger(l Logger) {
+	gpio.lock.Lock()
+	defer gpio.lock.Unlock()
+	gpio.logger = l
+}
+
+func (gpio *FakeGPIO) CheckDirection() (direction Direction, err error) {
+	return gpio.direction(), nil
 }
 
-func (gpio *FakeGPIO) SetDirection(direction int) error {
-	if !(direction == IN || direction == OUT) {
-		panic("direction neither IN nor OUT")
+func (gpio *FakeGPIO) direction() Direction {
+	gpio.lock.Lock()
+	defer gpio.lock.Unlock()
+	return gpio.dir
+}
+
+func (gpio *FakeGPIO) SetDirection(direction Direction) error {
+	if err := gpio.injectedFailure("SetDirection"); err != nil {
+		return err
 	}
+	if err := validateDirection(direction); err != nil {
+		return fmt.Errorf("%s: %w", gpio.name, err)
+	}
+	gpio.lock.Lock()
 	gpio.dir = direction
+	gpio.lock.Unlock()
+	if gpio.net != nil {
+		gpio.net.resolve()
+	}
 	return nil
 }
 
 func (gpio *FakeGPIO) GetState() (state bool, err error) {
-	return gpio.activelow != gpio.value, nil
+	gpio.operationLatency()
+	if err = gpio.injectedFailure("GetState"); err != nil {
+		return false, err
+	}
+	return gpio.logicalState(), nil
+}
+
+func (gpio *FakeGPIO) logicalState() bool {
+	gpio.lock.Lock()
+	defer gpio.lock.Unlock()
+	return gpio.inverted() != gpio.electrical()
+}
+
+// active low and logical inversion combined, gpio.lock held
+func (gpio *FakeGPIO) inverted() bool { return gpio.activelow != gpio.invert }
+
+// virtual electrical state: the driven value, or for undriven inputs the level given by the bias
+func (gpio *FakeGPIO) electricalValue() bool {
+	gpio.lock.Lock()
+	defer gpio.lock.Unlock()
+	return gpio.electrical()
+}
+
+// electricalValue with gpio.lock held
+func (gpio *FakeGPIO) electrical() bool {
+	if (gpio.dir == IN && !gpio.driven) || (gpio.dir == OUT && gpio.released) {
+		return gpio.bias == PULLUP
+	}
+	return gpio.value
+}
+
+// Stores the bias, which determines the state of an input as long as nothing has driven it
+// (via FakeInput or a connected output). PULLUP reads high, anything else low.
+func (gpio *FakeGPIO) SetBias(bias int) error {
+	if bias < BIAS_AS_IS || bias > BIAS_DISABLED {
+		return fmt.Errorf("invalid bias %d", bias)
+	}
+	gpio.lock.Lock()
+	gpio.bias = bias
+	gpio.lock.Unlock()
+	return nil
+}
+
+func (gpio *FakeGPIO) GetBias() int {
+	gpio.lock.Lock()
+	defer gpio.lock.Unlock()
+	return gpio.bias
+}
+
+// Electrical level an input reads while nothing drives it: before the first FakeInput,
+// and after a connected output or FakeNet stopped driving it. Same as SetBias(PULLUP) or SetBias(PULLDOWN),
+// without either an undriven input reads low.
+func (gpio *FakeGPIO) SetUndrivenLevel(level bool) {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	gpio.lock.Lock()
+	gpio.bias = PULLDOWN
+	if level {
+		gpio.bias = PULLUP
+	}
+	gpio.lock.Unlock()
+	gpio.observeState(TRANSITION_CONFIG)
+}
+
+// Models OPEN_DRAIN and OPEN_SOURCE outputs: an open-drain output writing 1 (or open-source writing 0)
+// releases the line, which then reads the level given by the bias and leaves connected inputs undriven.
+func (gpio *FakeGPIO) SetDriveMode(mode int) error {
+	if mode < PUSH_PULL || mode > OPEN_SOURCE {
+		return fmt.Errorf("invalid drive mode %d", mode)
+	}
+	gpio.lock.Lock()
+	gpio.drive = mode
+	gpio.lock.Unlock()
+	return nil
+}
+
+// a connected output stopped driving this input
+func (gpio *FakeGPIO) fakeRelease() {
+	gpio.lock.Lock()
+	if gpio.dir != IN {
+		gpio.lock.Unlock()
+		return
+	}
+	gpio.driven = false
+	gpio.lock.Unlock()
+	gpio.log("input released")
+	gpio.observeState(TRANSITION_CONNECTED)
 }
 
 func (gpio *FakeGPIO) SetState(state bool) error {
 	if gpio == nil {
 		panic("gpio == nil")
 	}
+	requested := gpio.operationLatency()
+	if err := gpio.injectedFailure("SetState"); err != nil {
+		return err
+	}
+	gpio.lock.Lock()
 	if gpio.dir == OUT {
-		gpio.value = gpio.activelow != state
-		gpio.log("set to virtual electrical state >%+v<", gpio.value)
+		value := gpio.inverted() != state
+		released := (gpio.drive == OPEN_DRAIN && value) || (gpio.drive == OPEN_SOURCE && !value)
+		gpio.value, gpio.released = value, released
+		gpio.lock.Unlock()
+		if released {
+			gpio.log("released, virtual electrical state is pulled level >%+v<", gpio.electricalValue())
+		} else {
+			gpio.log("set to virtual electrical state >%+v<", value)
+		}
 		if gpio.connectedTo != nil {
 			for _, othergpio := range gpio.connectedTo {
 				if othergpio == nil {
 					continue
 				}
-				othergpio.FakeInput(gpio.value)
+				if released {
+					othergpio.releaseFrom(gpio)
+				} else {
+					othergpio.driveFrom(gpio, value)
+				}
 			}
 		}
+		gpio.propagateVia()
+		if gpio.net != nil {
+			gpio.net.resolve()
+		}
+		gpio.observeStateRequested(TRANSITION_SETSTATE, requested)
 	} else {
+		gpio.lock.Unlock()
 		panic("tried to set state on IN gpio")
 	}
 	return nil
@@ -90,18 +263,101 @@ func (gpio *FakeGPIO) SetActiveLow(activelow bool) error {
 	if err != nil {
 		return err
 	}
+	gpio.lock.Lock()
 	gpio.activelow = activelow
+	gpio.lock.Unlock()
 	return gpio.SetState(prev_state)
 }
 
+// Inverts SetState and GetState the same way the other backends do, so tests can assert on the logical state
+// (e.g. "relay energized") regardless of the wiring polarity. Does not change the virtual electrical state.
+func (gpio *FakeGPIO) SetLogicalInvert(invert bool) error {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	gpio.lock.Lock()
+	gpio.invert = invert
+	gpio.lock.Unlock()
+	gpio.observeState(TRANSITION_CONFIG)
+	return nil
+}
+
+// same as SysfsGPIO.VerifyResponsive, a FakeGPIO is always responsive
+func (gpio *FakeGPIO) VerifyResponsive() error {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	return nil
+}
+
 func (gpio *FakeGPIO) SetStateNow(state bool) error { return gpio.SetState(state) }
 
+func (gpio *FakeGPIO) Backend() string { return BACKEND_FAKE }
+
+func (gpio *FakeGPIO) Capabilities() GPIOCapabilities {
+	return GPIOCapabilities{ActiveLow: true, Bias: true, DriveMode: true, Edges: true}
+}
+
+func (gpio *FakeGPIO) observeState(source TransitionSource) {
+	gpio.observeStateRequested(source, time.Time{})
+}
+
+// requested is when the operation causing the change was called, zero if just now
+func (gpio *FakeGPIO) observeStateRequested(source TransitionSource, requested time.Time) {
+	state := gpio.logicalState()
+	gpio.changed.observe(state)
+	now := gpio.now()
+	if requested.IsZero() {
+		requested = now
+	}
+	gpio.history.record(requested, now, state, source)
+	gpio.detectEdge(state)
+	gpio.notifyChange(state)
+}
+
+// Includes the names of the connected pins, so test dumps are self-describing
+func (gpio *FakeGPIO) Snapshot() PinSnapshot {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	state := gpio.logicalState()
+	edge, _ := gpio.GetEdge()
+	activelow, invert := gpio.polarity()
+	s := PinSnapshot{Number: gpio.number, Name: gpio.name, Backend: BACKEND_FAKE, Direction: gpio.direction(), Edge: edge,
+		ActiveLow: activelow, Inverted: invert, State: state, LastChange: gpio.changed.time}
+	for _, othergpio := range gpio.connectedTo {
+		if othergpio != nil {
+			s.ConnectedTo = append(s.ConnectedTo, othergpio.name)
+		}
+	}
+	s.ConnectedTo = append(s.ConnectedTo, gpio.connectedViaNames()...)
+	return s
+}
+
 func (gpio *FakeGPIO) Close() {
+	gpio.stopWaveform()
+	gpio.stopNoise()
+	gpio.stopConnections()
+	if gpio.net != nil {
+		gpio.net.Detach(gpio)
+	}
+	gpio.stopEdgeWatchers()
 	gpio = nil
 }
 
 func (gpio *FakeGPIO) ConnectTo(conn ...*FakeGPIO) {
+	for _, othergpio := range gpio.connectedTo {
+		if othergpio != nil {
+			othergpio.removeDriver(gpio)
+		}
+	}
 	gpio.connectedTo = conn
+	value, released := gpio.output()
+	for _, othergpio := range conn {
+		if othergpio != nil && gpio.direction() == OUT && !released {
+			othergpio.addDriver(gpio, value)
+		}
+	}
 	if gpio.connectedTo != nil {
 		var gpionames string
 		for _, othergpio := range gpio.connectedTo {
@@ -109,12 +365,12 @@ func (gpio *FakeGPIO) ConnectTo(conn ...*FakeGPIO) {
 				continue
 			}
 			dir := "IN"
-			if othergpio.dir == OUT {
+			if othergpio.direction() == OUT {
 				dir = "OUT"
 			}
 			gpionames += " " + othergpio.name + "(" + dir + ")"
 		}
-		gpio.log("now connected to" + gpionames)
+		gpio.log("now connected to%s", gpionames)
 	}
 
 }
@@ -123,24 +379,68 @@ func (gpio *FakeGPIO) FakeInput(state bool) error {
 	if gpio == nil {
 		panic("gpio == nil")
 	}
-	if gpio.dir == IN {
+	return gpio.fakeInput(state, TRANSITION_FAKEINPUT)
+}
+
+func (gpio *FakeGPIO) fakeInput(state bool, source TransitionSource) error {
+	if gpio.direction() == IN {
+		if source == TRANSITION_FAKEINPUT && state != gpio.electricalValue() {
+			gpio.bounceBefore(state)
+		}
+		if source != TRANSITION_NOISE {
+			gpio.noise.countScripted()
+		}
 		gpio.log("faking input >%+v<", state)
-		gpio.value = state
+		gpio.drivenTo(state)
+		gpio.observeState(source)
 	} else {
 		panic("tried to fake input for output gpio")
 	}
 	return nil
 }
 
-func (gpio *FakeGPIO) log(fmt string, attr ...interface{}) {
-	logT := gpio.logTarget
-	if logT == nil {
-		logT = FakeGPIODefaultLogTarget_
+// what an input is driven to
+func (gpio *FakeGPIO) drivenTo(level bool) {
+	gpio.lock.Lock()
+	defer gpio.lock.Unlock()
+	gpio.value = level
+	gpio.driven = true
+}
+
+// see SetActiveLow and SetLogicalInvert
+func (gpio *FakeGPIO) polarity() (activelow, invert bool) {
+	gpio.lock.Lock()
+	defer gpio.lock.Unlock()
+	return gpio.activelow, gpio.invert
+}
+
+// driven value and whether an open-drain/open-source output released the line
+func (gpio *FakeGPIO) output() (value, released bool) {
+	gpio.lock.Lock()
+	defer gpio.lock.Unlock()
+	return gpio.value, gpio.released
+}
+
+func (gpio *FakeGPIO) log(format string, attr ...interface{}) {
+	gpio.lock.Lock()
+	l := gpio.logger
+	gpio.lock.Unlock()
+	if l == nil && FakeGPIODefaultLogTarget_ != nil {
+		if _, discard := FakeGPIODefaultLogTarget_.Writer().(*FakeGPIONullWriter); !discard {
+			l = NewStdLogger(FakeGPIODefaultLogTarget_)
+		}
+	}
+	l = loggerOr(l)
+	if _, discard := l.(nopLogger); discard {
+		// don't bother formatting output nobody will see
+		return
 	}
 	dir := "IN"
-	if gpio.dir == OUT {
+	if gpio.direction() == OUT {
 		dir = "OUT"
 	}
-	logT.Printf("FakeGPIO %s(%s): "+fmt, append([]interface{}{gpio.name, dir}, attr...)...)
+	l.Log(LOG_DEBUG, "FakeGPIO: "+fmt.Sprintf(format, attr...), "gpio", gpio.name, "direction", dir)
 
 }
+
+var _ GPIO = (*FakeGPIO)(nil)
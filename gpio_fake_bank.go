@@ -0,0 +1,207 @@
+package bbhw
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Change of the level of a FakeGPIOBank, recorded after EnableHistory
+type BankChange struct {
+	Time  time.Time
+	Bank  int
+	Value uint32 // levels after the change, as returned by ReadBank
+}
+
+type fakeBank struct {
+	outputs uint32 // direction, 1 = output
+	driven  uint32 // levels of the outputs
+	levels  uint32 // levels at the inputs
+	wires   map[uint]*FakeGPIO
+}
+
+// Fake counterpart of the bank-wide operations of MMappedGPIOCollectionFactory (GPIOBank), a uint32 per bank.
+// All bits start as inputs reading low, like the AM335x after reset.
+// Single bits can be wired to FakeGPIOs (WireBit), so code using the bank and code using single pins can be tested together.
+type FakeGPIOBank struct {
+	banks   []fakeBank
+	history []BankChange
+	limit   int // history capacity, 0 while not recording
+	clock   Clock
+	lock    sync.Mutex
+}
+
+// nbanks is 4 for the AM335x
+func NewFakeGPIOBank(nbanks int) *FakeGPIOBank {
+	return &FakeGPIOBank{banks: make([]fakeBank, nbanks)}
+}
+
+func (fb *FakeGPIOBank) bank(bank int) (*fakeBank, error) {
+	if bank < 0 || bank >= len(fb.banks) {
+		return nil, fmt.Errorf("no gpio bank %d", bank)
+	}
+	return &fb.banks[bank], nil
+}
+
+func (b *fakeBank) value() uint32 {
+	return b.driven&b.outputs | b.levels&^b.outputs
+}
+
+func (fb *FakeGPIOBank) ReadBank(bank int) (uint32, error) {
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+	b, err := fb.bank(bank)
+	if err != nil {
+		return 0, err
+	}
+	return b.value(), nil
+}
+
+func (fb *FakeGPIOBank) BankDirection(bank int) (outputs uint32, err error) {
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+	b, err := fb.bank(bank)
+	if err != nil {
+		return 0, err
+	}
+	return b.outputs, nil
+}
+
+func (fb *FakeGPIOBank) SetBankDirection(bank int, outputs uint32) error {
+	return fb.change(bank, func(b *fakeBank) error {
+		b.outputs = outputs
+		return nil
+	})
+}
+
+func (fb *FakeGPIOBank) SetClearBank(bank int, set, clear uint32) error {
+	return fb.change(bank, func(b *fakeBank) error {
+		if err := checkSetClearBank(bank, set, clear, b.outputs); err != nil {
+			return err
+		}
+		b.driven = b.driven&^clear | set
+		return nil
+	})
+}
+
+// Sets the levels of the input bits in mask, like FakeGPIO.FakeInput does for a single input
+func (fb *FakeGPIOBank) FakeInputBank(bank int, mask, levels uint32) error {
+	return fb.change(bank, func(b *fakeBank) error {
+		b.levels = b.levels&^mask | levels&mask
+		return nil
+	})
+}
+
+// applies fn to the bank, records the change and passes it on to the wired FakeGPIOs
+func (fb *FakeGPIOBank) change(bank int, fn func(b *fakeBank) error) error {
+	fb.lock.Lock()
+	b, err := fb.bank(bank)
+	if err != nil {
+		fb.lock.Unlock()
+		return err
+	}
+	before, outputs := b.value(), b.outputs
+	if err = fn(b); err != nil {
+		fb.lock.Unlock()
+		return err
+	}
+	after := b.value()
+	if after != before && fb.limit > 0 {
+		if len(fb.history) == fb.limit {
+			fb.history = fb.history[1:]
+		}
+		fb.history = append(fb.history, BankChange{Time: fb.now(), Bank: bank, Value: after})
+	}
+	var drive []func()
+	for bit, gpio := range b.wires {
+		mask := uint32(1) << bit
+		if b.outputs&mask != 0 && ((after^before)|(b.outputs^outputs))&mask != 0 {
+			gpio, level := gpio, after&mask != 0
+			drive = append(drive, func() {
+				if gpio.direction() == IN {
+					gpio.fakeInput(level, TRANSITION_CONNECTED)
+				}
+			})
+		}
+	}
+	fb.lock.Unlock()
+	for _, fn := range drive {
+		fn()
+	}
+	return nil
+}
+
+func (fb *FakeGPIOBank) now() time.Time {
+	if fb.clock == nil {
+		return defaultClock().Now()
+	}
+	return fb.clock.Now()
+}
+
+// Wires bit of bank to gpio: while the bit is an output it drives gpio (if that is an input),
+// while it is an input it reads the state of gpio (electrical, i.e. ignoring SetActiveLow of gpio).
+func (fb *FakeGPIOBank) WireBit(bank int, bit uint, gpio *FakeGPIO) error {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	if bit > 31 {
+		return fmt.Errorf("bank %d has no bit %d", bank, bit)
+	}
+	fb.lock.Lock()
+	b, err := fb.bank(bank)
+	if err == nil {
+		if b.wires == nil {
+			b.wires = make(map[uint]*FakeGPIO)
+		}
+		b.wires[bit] = gpio
+	}
+	fb.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	mask := uint32(1) << bit
+	follow := func(bool) {
+		fb.lock.Lock()
+		wired := fb.banks[bank].wires[bit] == gpio
+		fb.lock.Unlock()
+		if wired {
+			fb.FakeInputBank(bank, mask, boolToUint32(gpio.electricalValue())<<bit)
+		}
+	}
+	gpio.OnChange(follow)
+	follow(false)
+	return nil
+}
+
+// Use c for the timestamps of History, nil reverts to the default clock, see SetDefaultClock
+func (fb *FakeGPIOBank) SetClock(c Clock) {
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+	fb.clock = c
+}
+
+// Start recording the changes of all banks, keeping the newest capacity ones. capacity < 1 stops recording.
+func (fb *FakeGPIOBank) EnableHistory(capacity int) {
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+	fb.history, fb.limit = nil, capacity
+	if capacity < 0 {
+		fb.limit = 0
+	}
+}
+
+// recorded changes, oldest first
+func (fb *FakeGPIOBank) History() []BankChange {
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+	return append([]BankChange(nil), fb.history...)
+}
+
+func boolToUint32(b bool) uint32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+var _ GPIOBank = (*FakeGPIOBank)(nil)
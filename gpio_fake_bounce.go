@@ -0,0 +1,78 @@
+package bbhw
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Contact bounce of a FakeGPIO input, see SetBounce.
+// Either Count or Duration select how long the contacts bounce, both zero disables bouncing.
+type BounceParams struct {
+	Count       int           // bounces (back and forth) before the input settles
+	Duration    time.Duration // if Count is 0: keep bouncing for this long
+	MinInterval time.Duration // time between two toggles, chosen randomly from [MinInterval, MaxInterval]
+	MaxInterval time.Duration
+	Seed        int64 // makes the intervals reproducible, 0 seeds from the current time
+}
+
+type fakeBounce struct {
+	lock   sync.Mutex
+	params BounceParams
+	rand   *rand.Rand
+}
+
+// Makes every FakeInput which changes the input bounce first: the new state and the old one alternate
+// params.Count times (or for params.Duration) before the new state settles. The toggles are visible to
+// GetState, History (as TRANSITION_BOUNCE) and edge callbacks like the final transition.
+// FakeInput blocks until the input settled, on the clock given to SetClock.
+// Inputs driven by a connected output don't bounce. BounceParams{} disables bouncing again.
+func (gpio *FakeGPIO) SetBounce(params BounceParams) error {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	if params.Count < 0 || params.Duration < 0 || params.MinInterval < 0 || params.MaxInterval < params.MinInterval {
+		return errors.New(gpio.name + ": invalid BounceParams")
+	}
+	if (params.Count > 0 || params.Duration > 0) && params.MaxInterval == 0 {
+		return errors.New(gpio.name + ": bouncing needs a MaxInterval > 0")
+	}
+	seed := params.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	gpio.bounce.lock.Lock()
+	defer gpio.bounce.lock.Unlock()
+	gpio.bounce.params = params
+	gpio.bounce.rand = rand.New(rand.NewSource(seed))
+	return nil
+}
+
+func (b *fakeBounce) interval() time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	p := b.params
+	return p.MinInterval + time.Duration(b.rand.Int63n(int64(p.MaxInterval-p.MinInterval)+1))
+}
+
+// toggles between state and the current value as configured by SetBounce, leaves the input at the old value
+func (gpio *FakeGPIO) bounceBefore(state bool) {
+	gpio.bounce.lock.Lock()
+	p := gpio.bounce.params
+	gpio.bounce.lock.Unlock()
+	if p.Count == 0 && p.Duration == 0 {
+		return
+	}
+	old := gpio.electricalValue()
+	clock := gpio.clock()
+	start := clock.Now()
+	for i := 0; (p.Count > 0 && i < p.Count) || (p.Count == 0 && clock.Now().Sub(start) < p.Duration); i++ {
+		for _, v := range []bool{state, old} {
+			gpio.log("bouncing >%+v<", v)
+			gpio.drivenTo(v)
+			gpio.observeState(TRANSITION_BOUNCE)
+			<-clock.After(gpio.bounce.interval())
+		}
+	}
+}
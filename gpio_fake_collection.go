@@ -59,8 +59,9 @@ func (gpiocf *FakeGPIOCollectionFactory) BeginTransactionRecordSetStates() {
 // slightly more fancy FakeGPIO for debugging.
 // takes a name for easy recognition in debugging output and an optional logger (or nil) of your choice,
 // thus you could route debug output of different GPIOs to different destinations
-func (gpiocf *FakeGPIOCollectionFactory) NewFakeNamedGPIO(name string, direction int, logTarget *log.Logger) (gpio *FakeGPIOInCollection) {
-	gpio = &FakeGPIOInCollection{FakeGPIO: FakeGPIO{name: name, dir: direction, value: false, logTarget: logTarget}, collection: gpiocf}
+func (gpiocf *FakeGPIOCollectionFactory) NewFakeNamedGPIO(name string, direction Direction, logTarget *log.Logger) (gpio *FakeGPIOInCollection) {
+	gpio = &FakeGPIOInCollection{FakeGPIO: FakeGPIO{name: name, number: fakeGPIONumber(name), dir: direction, value: false, logger: fakeGPIOLogger(logTarget)}, collection: gpiocf}
+	gpio.edges.edge = NONE
 	gpiocf.lock.Lock()
 	gpiocf.collection = append(gpiocf.collection, gpio)
 	gpiocf.lock.Unlock()
@@ -69,11 +70,11 @@ func (gpiocf *FakeGPIOCollectionFactory) NewFakeNamedGPIO(name string, direction
 
 // Same as FakeGPIO but part of a FakeGPIOCollectionFactory
 // unfortunately, can't rename this function as it would not be readily interchangeable anymore
-func (gpiocf *FakeGPIOCollectionFactory) NewFakeGPIO(number uint, direction int) (gpio *FakeGPIOInCollection) {
+func (gpiocf *FakeGPIOCollectionFactory) NewFakeGPIO(number uint, direction Direction) (gpio *FakeGPIOInCollection) {
 	return gpiocf.NewFakeNamedGPIO(fmt.Sprintf("FakeGPIOInCollection(%d,%+v)", number, gpiocf), direction, FakeGPIODefaultLogTarget_)
 }
 
-func (gpiocf *FakeGPIOCollectionFactory) NewGPIO(number uint, direction int) GPIOControllablePinInCollection {
+func (gpiocf *FakeGPIOCollectionFactory) NewGPIO(number uint, direction Direction) GPIOControllablePinInCollection {
 	return gpiocf.NewFakeGPIO(number, direction)
 }
 
@@ -0,0 +1,114 @@
+package bbhw
+
+import (
+	"fmt"
+	"sync"
+)
+
+// How an input connected to several outputs combines their levels, see SetCombineMode
+type CombineMode int
+
+const (
+	COMBINE_LAST_WRITE_WINS CombineMode = iota // the output which changed last sets the input
+	COMBINE_OR                                 // high if any output drives high, like a wired-OR
+	COMBINE_AND                                // low if any output drives low, like a wired-AND interrupt line
+)
+
+func (m CombineMode) String() string {
+	switch m {
+	case COMBINE_LAST_WRITE_WINS:
+		return "LastWriteWins"
+	case COMBINE_OR:
+		return "OR"
+	case COMBINE_AND:
+		return "AND"
+	default:
+		return fmt.Sprintf("CombineMode(%d)", int(m))
+	}
+}
+
+// outputs currently driving an input and their levels
+type fakeDrivers struct {
+	lock   sync.Mutex
+	mode   CombineMode
+	levels map[interface{}]bool // keyed by the driving *FakeGPIO, or the *fakeConnection of ConnectToVia
+}
+
+// Selects how the input combines the outputs connected to it (ConnectTo or ConnectToVia).
+// With COMBINE_OR or COMBINE_AND the input is evaluated over all outputs driving it whenever one of them changes,
+// released open-drain outputs don't count. The default COMBINE_LAST_WRITE_WINS keeps the level last driven.
+func (gpio *FakeGPIO) SetCombineMode(mode CombineMode) error {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	if mode < COMBINE_LAST_WRITE_WINS || mode > COMBINE_AND {
+		return fmt.Errorf("%s: invalid %v", gpio.name, mode)
+	}
+	d := &gpio.drivers
+	d.lock.Lock()
+	d.mode = mode
+	d.lock.Unlock()
+	return nil
+}
+
+// registers driver as driving gpio without changing the input, called by ConnectTo
+func (gpio *FakeGPIO) addDriver(driver interface{}, level bool) {
+	d := &gpio.drivers
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.levels == nil {
+		d.levels = make(map[interface{}]bool)
+	}
+	d.levels[driver] = level
+}
+
+func (gpio *FakeGPIO) removeDriver(driver interface{}) {
+	d := &gpio.drivers
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	delete(d.levels, driver)
+}
+
+// driver drives level onto the input gpio
+func (gpio *FakeGPIO) driveFrom(driver interface{}, level bool) {
+	gpio.addDriver(driver, level)
+	if combined, ok := gpio.combinedLevel(); ok {
+		level = combined
+	}
+	gpio.fakeInput(level, TRANSITION_CONNECTED)
+}
+
+// driver stopped driving the input gpio, e.g. a released open-drain output
+func (gpio *FakeGPIO) releaseFrom(driver interface{}) {
+	gpio.removeDriver(driver)
+	d := &gpio.drivers
+	d.lock.Lock()
+	remaining := len(d.levels)
+	d.lock.Unlock()
+	if combined, ok := gpio.combinedLevel(); ok && remaining > 0 {
+		gpio.fakeInput(combined, TRANSITION_CONNECTED)
+		return
+	}
+	gpio.fakeRelease()
+}
+
+// level of all drivers combined, ok is false for COMBINE_LAST_WRITE_WINS
+func (gpio *FakeGPIO) combinedLevel() (level bool, ok bool) {
+	d := &gpio.drivers
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	switch d.mode {
+	case COMBINE_OR:
+		for _, l := range d.levels {
+			level = level || l
+		}
+		return level, true
+	case COMBINE_AND:
+		level = true
+		for _, l := range d.levels {
+			level = level && l
+		}
+		return level, true
+	}
+	return false, false
+}
@@ -0,0 +1,142 @@
+package bbhw
+
+import (
+	"sync"
+	"time"
+)
+
+// Option of a connection made with ConnectToVia
+type ConnOption func(*fakeConnection)
+
+// the connection inverts, like an inverter or an optocoupler pulling the input low
+func Invert() ConnOption {
+	return func(c *fakeConnection) { c.invert = true }
+}
+
+// the target sees changes only after d (propagation delay), timed by the clock of the output, see SetClock
+func Delay(d time.Duration) ConnOption {
+	return func(c *fakeConnection) { c.delay = d }
+}
+
+type fakeConnection struct {
+	target *FakeGPIO
+	invert bool
+	delay  time.Duration
+	queue  chan fakeSignal // only for delayed connections
+}
+
+// what arrives at the target of a connection
+type fakeSignal struct {
+	due     time.Time
+	value   bool
+	release bool
+}
+
+type fakeConnections struct {
+	lock sync.Mutex
+	list []*fakeConnection
+	stop chan struct{} // closed by Close, ends the goroutines of delayed connections
+}
+
+// changes queued on a delayed connection before SetState blocks
+const fake_conn_queue_ = 1024
+
+// Like ConnectTo, but for a single target reached through something else than a plain wire, e.g.
+//
+//	out.ConnectToVia(in, bbhw.Invert(), bbhw.Delay(20*time.Microsecond))
+//
+// Adds to the connections made so far, ConnectTo does not remove it.
+// An inverting connection drives the target even while an open-drain output is released,
+// with the inverted level given by the bias of the output.
+func (gpio *FakeGPIO) ConnectToVia(target *FakeGPIO, opts ...ConnOption) {
+	if gpio == nil || target == nil {
+		panic("gpio == nil")
+	}
+	c := &fakeConnection{target: target}
+	for _, opt := range opts {
+		opt(c)
+	}
+	cs := &gpio.connections
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	if c.delay > 0 {
+		if cs.stop == nil {
+			cs.stop = make(chan struct{})
+		}
+		c.queue = make(chan fakeSignal, fake_conn_queue_)
+		go gpio.delayConnection(c, cs.stop)
+	}
+	cs.list = append(cs.list, c)
+	gpio.log("now connected to %s (invert: %v, delay: %v)", target.name, c.invert, c.delay)
+}
+
+// called by SetState
+func (gpio *FakeGPIO) propagateVia() {
+	cs := &gpio.connections
+	cs.lock.Lock()
+	list := cs.list
+	cs.lock.Unlock()
+	for _, c := range list {
+		value, released := gpio.output()
+		s := fakeSignal{value: value, release: released}
+		if c.invert {
+			s = fakeSignal{value: !gpio.electricalValue()}
+		}
+		if c.queue == nil {
+			c.deliver(s)
+			continue
+		}
+		s.due = gpio.now().Add(c.delay)
+		c.queue <- s
+	}
+}
+
+func (c *fakeConnection) deliver(s fakeSignal) {
+	if s.release {
+		c.target.releaseFrom(c)
+	} else {
+		c.target.driveFrom(c, s.value)
+	}
+}
+
+func (gpio *FakeGPIO) delayConnection(c *fakeConnection, stop chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case s := <-c.queue:
+			clock := gpio.clock()
+			select {
+			case <-stop:
+				return
+			case <-clock.After(s.due.Sub(clock.Now())):
+			}
+			c.deliver(s)
+		}
+	}
+}
+
+// ends delayed connections, changes still in transit are lost
+func (gpio *FakeGPIO) stopConnections() {
+	cs := &gpio.connections
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	if cs.stop != nil {
+		close(cs.stop)
+	}
+	for _, c := range cs.list {
+		c.target.removeDriver(c)
+	}
+	cs.stop = nil
+	cs.list = nil
+}
+
+func (gpio *FakeGPIO) connectedViaNames() (names []string) {
+	cs := &gpio.connections
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	for _, c := range cs.list {
+		names = append(names, c.target.name)
+	}
+	return names
+}
@@ -0,0 +1,148 @@
+package bbhw
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// edge detection of a FakeGPIO (input), fed by observeState
+type fakeEdges struct {
+	lock     sync.Mutex
+	edge     Edge
+	state    bool // logical state last seen, to detect edges
+	watchers []*fakeEdgeWatcher
+}
+
+type fakeEdgeWatcher struct {
+	events chan EdgeEvent
+	stop   chan struct{}
+	missed uint32 // dropped since the last queued edge, guarded by fakeEdges.lock
+}
+
+// edges queued per watcher before further ones are dropped, like a slow reader would miss interrupts
+const fake_edge_queue_ = 64
+
+// Set edge(s) bbhw.RISING, bbhw.FALLING, bbhw.BOTH or bbhw.NONE to be reported by SetEdgeCallback.
+// Changes the edges reported by already running callbacks as well, NONE ends them like on a CdevGPIO.
+func (gpio *FakeGPIO) SetEdge(edge Edge) error {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	if err := gpio.injectedFailure("SetEdge"); err != nil {
+		return err
+	}
+	if edge < RISING || edge > NONE {
+		return errors.New("Edge value invalid")
+	}
+	gpio.edges.lock.Lock()
+	gpio.edges.edge = edge
+	gpio.edges.lock.Unlock()
+	if edge == NONE {
+		gpio.stopEdgeWatchers()
+	}
+	return nil
+}
+
+// returns "none", "rising", "falling" or "both", same as SysfsGPIO.GetEdge
+func (gpio *FakeGPIO) GetEdge() (string, error) {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	gpio.edges.lock.Lock()
+	defer gpio.edges.lock.Unlock()
+	return gpio.edges.edge.String(), nil
+}
+
+// Sends the state after each edge configured with SetEdge, caused by FakeInput or a connected output, to callback.
+// Same semantics as SysfsGPIO.SetEdgeCallback: if no edge occured within timeout ms (negative for infinite),
+// the current state is sent and watching goes on. Close ends watching and closes the channel.
+func (gpio *FakeGPIO) SetEdgeCallback(callback *chan bool, timeout int) error {
+	return gpio.watchEdges(timeout, func() { close(*callback) }, func(ev EdgeEvent) { *callback <- ev.State })
+}
+
+// Same as SetEdgeCallback but delivers EdgeEvents, Time is the time of FakeInput.
+// Missed counts the edges dropped right before an event, like CdevGPIO does.
+func (gpio *FakeGPIO) SetEdgeEventCallback(events chan<- EdgeEvent, timeout int) error {
+	return gpio.watchEdges(timeout, func() { close(events) }, func(ev EdgeEvent) { events <- ev })
+}
+
+func (gpio *FakeGPIO) watchEdges(timeout int, done func(), deliver func(EdgeEvent)) error {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	gpio.edges.lock.Lock()
+	defer gpio.edges.lock.Unlock()
+	if gpio.edges.edge == NONE {
+		return errors.New("Edge value is set to NONE")
+	}
+	w := &fakeEdgeWatcher{events: make(chan EdgeEvent, fake_edge_queue_), stop: make(chan struct{})}
+	if len(gpio.edges.watchers) == 0 {
+		gpio.edges.state = gpio.logicalState()
+	}
+	gpio.edges.watchers = append(gpio.edges.watchers, w)
+	state := gpio.edges.state
+	clock := gpio.clock()
+	go func() {
+		defer done()
+		for {
+			var timer <-chan time.Time
+			if timeout >= 0 {
+				timer = clock.After(time.Duration(timeout) * time.Millisecond)
+			}
+			select {
+			case <-w.stop:
+				return
+			case ev := <-w.events:
+				state = ev.State
+				deliver(ev)
+			case now := <-timer:
+				ev := EdgeEvent{State: state, Edge: FALLING, Time: now}
+				if state {
+					ev.Edge = RISING
+				}
+				deliver(ev)
+			}
+		}
+	}()
+	return nil
+}
+
+// called with the new logical state whenever it might have changed
+func (gpio *FakeGPIO) detectEdge(state bool) {
+	gpio.edges.lock.Lock()
+	defer gpio.edges.lock.Unlock()
+	if len(gpio.edges.watchers) == 0 || state == gpio.edges.state {
+		return
+	}
+	gpio.edges.state = state
+	ev := EdgeEvent{State: state, Edge: FALLING, Time: gpio.now()}
+	if state {
+		ev.Edge = RISING
+	}
+	if gpio.edges.edge != BOTH && gpio.edges.edge != ev.Edge {
+		return
+	}
+	for _, w := range gpio.edges.watchers {
+		ev.Missed = w.missed
+		select {
+		case w.events <- ev:
+			w.missed = 0
+		default:
+			w.missed++
+			gpio.log("edge dropped, callback too slow")
+		}
+	}
+}
+
+// ends all edge callbacks
+func (gpio *FakeGPIO) stopEdgeWatchers() {
+	gpio.edges.lock.Lock()
+	defer gpio.edges.lock.Unlock()
+	for _, w := range gpio.edges.watchers {
+		close(w.stop)
+	}
+	gpio.edges.watchers = nil
+}
+
+var _ EdgeGPIO = (*FakeGPIO)(nil)
@@ -0,0 +1,114 @@
+package bbhw
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// operations of a FakeGPIO which FailNext and SetFailureRate can make fail
+var fake_failure_ops_ = map[string]bool{"SetState": true, "GetState": true, "SetDirection": true, "SetEdge": true,
+	"ReOpen": true, "Reinitialize": true}
+
+type fakeFailureRate struct {
+	probability float64
+	err         error
+}
+
+type fakeFailures struct {
+	lock  sync.Mutex
+	next  map[string][]error
+	rates map[string]fakeFailureRate
+	rand  *rand.Rand
+}
+
+func checkFakeFailureOp(op string) {
+	if !fake_failure_ops_[op] {
+		panic(fmt.Sprintf("FakeGPIO: can not inject failures into %q, only SetState, GetState, SetDirection, SetEdge, ReOpen or Reinitialize", op))
+	}
+}
+
+// The next call of op ("SetState", "GetState", "SetDirection", "SetEdge", "ReOpen" or "Reinitialize")
+// returns err instead of doing anything.
+// Calling it several times makes that many calls fail, before SetFailureRate applies.
+func (gpio *FakeGPIO) FailNext(op string, err error) {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	checkFakeFailureOp(op)
+	gpio.failures.failNext(op, err)
+}
+
+// Each call of op fails with err with the given probability (0 stops failing), see SetFailureSeed
+func (gpio *FakeGPIO) SetFailureRate(op string, probability float64, err error) {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	checkFakeFailureOp(op)
+	gpio.failures.setRate(op, probability, err)
+}
+
+// Makes the failures of SetFailureRate reproducible, without a seed they are seeded from the current time
+func (gpio *FakeGPIO) SetFailureSeed(seed int64) {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	gpio.failures.setSeed(seed)
+}
+
+// returns the error to inject into op, if any. Injected errors are logged and recorded in the History.
+func (gpio *FakeGPIO) injectedFailure(op string) error {
+	err := gpio.failures.take(op)
+	if err == nil {
+		return nil
+	}
+	err = fmt.Errorf("%s: %s: %w", gpio.name, op, err)
+	gpio.log("injected failure: %v", err)
+	gpio.history.recordFailure(gpio.now(), gpio.logicalState(), err)
+	return err
+}
+
+func (f *fakeFailures) failNext(op string, err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.next == nil {
+		f.next = make(map[string][]error)
+	}
+	f.next[op] = append(f.next[op], err)
+}
+
+func (f *fakeFailures) setRate(op string, probability float64, err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.rates == nil {
+		f.rates = make(map[string]fakeFailureRate)
+	}
+	f.rates[op] = fakeFailureRate{probability, err}
+}
+
+func (f *fakeFailures) setSeed(seed int64) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.rand = rand.New(rand.NewSource(seed))
+}
+
+// the error queued by failNext or drawn by setRate for op, nil if op should succeed
+func (f *fakeFailures) take(op string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if queued := f.next[op]; len(queued) > 0 {
+		var err error
+		err, f.next[op] = queued[0], queued[1:]
+		return err
+	}
+	if rate, ok := f.rates[op]; ok && rate.probability > 0 {
+		if f.rand == nil {
+			f.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+		}
+		if f.rand.Float64() < rate.probability {
+			return rate.err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package bbhw
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// What caused a Transition of a FakeGPIO
+type TransitionSource int
+
+const (
+	TRANSITION_SETSTATE  TransitionSource = iota // SetState (or SetActiveLow) on an output
+	TRANSITION_FAKEINPUT                         // FakeInput on an input
+	TRANSITION_CONNECTED                         // a connected output driving or releasing an input
+	TRANSITION_CONFIG                            // SetLogicalInvert or SetUndrivenLevel
+	TRANSITION_BOUNCE                            // contact bounce preceding a FakeInput, see SetBounce
+	TRANSITION_FAILURE                           // no transition but an injected failure, see FailNext
+	TRANSITION_NOISE                             // a glitch, see SetNoise
+)
+
+func (s TransitionSource) String() string {
+	switch s {
+	case TRANSITION_SETSTATE:
+		return "SetState"
+	case TRANSITION_FAKEINPUT:
+		return "FakeInput"
+	case TRANSITION_CONNECTED:
+		return "connected"
+	case TRANSITION_CONFIG:
+		return "config"
+	case TRANSITION_BOUNCE:
+		return "bounce"
+	case TRANSITION_FAILURE:
+		return "failure"
+	case TRANSITION_NOISE:
+		return "noise"
+	default:
+		return fmt.Sprintf("TransitionSource(%d)", int(s))
+	}
+}
+
+// Change of the logical state of a FakeGPIO, recorded after EnableHistory
+type Transition struct {
+	Time      time.Time
+	Requested time.Time // when the SetState causing it was called, before Time by SetOperationLatency
+	State     bool
+	Source    TransitionSource
+	Err       error // only for TRANSITION_FAILURE, State is then the unchanged state
+}
+
+// bounded record, the oldest entries are overwritten. Shared by the histories of the fakes
+type fakeRing struct {
+	items []interface{} // nil while disabled
+	next  int
+	full  bool
+}
+
+// discards everything, capacity < 1 disables recording
+func (r *fakeRing) reset(capacity int) {
+	r.items, r.next, r.full = nil, 0, false
+	if capacity > 0 {
+		r.items = make([]interface{}, capacity)
+	}
+}
+
+func (r *fakeRing) push(v interface{}) {
+	if r.items == nil {
+		return
+	}
+	r.items[r.next] = v
+	if r.next++; r.next == len(r.items) {
+		r.next, r.full = 0, true
+	}
+}
+
+// oldest first
+func (r *fakeRing) all() []interface{} {
+	if !r.full {
+		return append([]interface{}(nil), r.items[:r.next]...)
+	}
+	return append(append([]interface{}(nil), r.items[r.next:]...), r.items[:r.next]...)
+}
+
+// bounded record of transitions
+type fakeHistory struct {
+	lock  sync.Mutex
+	ring  fakeRing // of Transition
+	state bool     // logical state before the newest transition
+}
+
+func (h *fakeHistory) record(requested, now time.Time, state bool, source TransitionSource) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.ring.items == nil || state == h.state {
+		return
+	}
+	h.state = state
+	h.ring.push(Transition{Time: now, Requested: requested, State: state, Source: source})
+}
+
+func (h *fakeHistory) enabled() bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.ring.items != nil
+}
+
+func (h *fakeHistory) recordFailure(now time.Time, state bool, err error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.ring.push(Transition{Time: now, Requested: now, State: state, Source: TRANSITION_FAILURE, Err: err})
+}
+
+// Start recording changes of the logical state, keeping the newest capacity ones.
+// Discards what was recorded so far, capacity < 1 stops recording.
+// Only changes are recorded, e.g. SetState(true) on a high output is not.
+func (gpio *FakeGPIO) EnableHistory(capacity int) {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	state := gpio.logicalState()
+	h := &gpio.history
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.ring.reset(capacity)
+	h.state = state
+}
+
+// recorded transitions, oldest first
+func (gpio *FakeGPIO) History() []Transition {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	h := &gpio.history
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	items := h.ring.all()
+	history := make([]Transition, len(items))
+	for i, v := range items {
+		history[i] = v.(Transition)
+	}
+	return history
+}
+
+// Fails t unless the transitions recorded in History are exactly these states (injected failures are skipped), e.g.
+//
+//	relay.AssertSequence(t, true, false)
+func (gpio *FakeGPIO) AssertSequence(t testing.TB, states ...bool) {
+	t.Helper()
+	var history []Transition
+	for _, tr := range gpio.History() {
+		if tr.Source != TRANSITION_FAILURE {
+			history = append(history, tr)
+		}
+	}
+	ok := len(history) == len(states)
+	for i := 0; ok && i < len(states); i++ {
+		ok = history[i].State == states[i]
+	}
+	if ok {
+		return
+	}
+	got := make([]string, len(history))
+	for i, tr := range history {
+		got[i] = fmt.Sprintf("%v(%v)", tr.State, tr.Source)
+	}
+	t.Errorf("%s: expected transitions %v, got %v", gpio.name, states, got)
+}
+
+// Time from the i-th to the j-th recorded transition, indices as in History (panics if out of range)
+func (gpio *FakeGPIO) TimeBetween(i, j int) time.Duration {
+	history := gpio.History()
+	return history[j].Time.Sub(history[i].Time)
+}
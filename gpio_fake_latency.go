@@ -0,0 +1,59 @@
+package bbhw
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+type fakeLatency struct {
+	lock    sync.Mutex
+	latency time.Duration
+	jitter  time.Duration
+	rand    *rand.Rand
+}
+
+// Makes GetState and SetState block for d before they take effect, like a GPIO behind an I2C expander does.
+// Blocks on the clock given to SetClock, so with a ManualClock tests stay fast.
+// History records when a SetState was called (Transition.Requested) and when it took effect (Transition.Time).
+// 0 disables the latency again.
+func (gpio *FakeGPIO) SetOperationLatency(d time.Duration) {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	gpio.latency.lock.Lock()
+	defer gpio.latency.lock.Unlock()
+	gpio.latency.latency = d
+}
+
+// Adds a random [0, jitter] to every SetOperationLatency. seed makes it reproducible, 0 seeds from the current time
+func (gpio *FakeGPIO) SetOperationJitter(jitter time.Duration, seed int64) {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	gpio.latency.lock.Lock()
+	defer gpio.latency.lock.Unlock()
+	gpio.latency.jitter = jitter
+	gpio.latency.rand = rand.New(rand.NewSource(seed))
+}
+
+// blocks for the configured latency, returns when it was called or zero without latency
+func (gpio *FakeGPIO) operationLatency() (requested time.Time) {
+	l := &gpio.latency
+	l.lock.Lock()
+	d := l.latency
+	if d > 0 && l.jitter > 0 {
+		d += time.Duration(l.rand.Int63n(int64(l.jitter) + 1))
+	}
+	l.lock.Unlock()
+	if d <= 0 {
+		return time.Time{}
+	}
+	clock := gpio.clock()
+	requested = clock.Now()
+	clock.Sleep(d)
+	return requested
+}
@@ -0,0 +1,157 @@
+package bbhw
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Two or more outputs on a FakeNet driving different levels at the same time
+type NetConflict struct {
+	Time time.Time
+	High []string // names of the outputs driving high
+	Low  []string
+}
+
+func (c NetConflict) String() string {
+	return fmt.Sprintf("%v driving high against %v driving low", c.High, c.Low)
+}
+
+// Node of a virtual circuit several FakeGPIOs are attached to, unlike ConnectTo also with more than one output:
+// outputs drive the net (a new output drives low), inputs read it. Released open-drain (or open-source) outputs don't drive,
+// if no output drives the net it is at the level of its pull resistor (SetPull) or, without one,
+// the attached inputs read the level given by their own bias.
+// If attached outputs drive conflicting levels, the inputs read low and the conflict is recorded (see Conflicts),
+// or, after SetPanicOnConflict(true), the FakeGPIO causing it panics.
+type FakeNet struct {
+	name      string
+	pins      []*FakeGPIO
+	pull      int
+	panics    bool
+	conflict  bool // currently in conflict
+	conflicts []NetConflict
+	lock      sync.Mutex
+}
+
+func NewFakeNet(name string) *FakeNet {
+	return &FakeNet{name: name, pull: BIAS_DISABLED}
+}
+
+// Attaches pins to the net, a FakeGPIO can be attached to only one net (the last one)
+func (net *FakeNet) Attach(pins ...*FakeGPIO) {
+	for _, gpio := range pins {
+		if gpio == nil {
+			panic("gpio == nil")
+		}
+		if gpio.net != nil && gpio.net != net {
+			gpio.net.Detach(gpio)
+		}
+		gpio.net = net
+	}
+	net.lock.Lock()
+	net.pins = append(net.pins, pins...)
+	net.lock.Unlock()
+	net.resolve()
+}
+
+// Removes gpio from the net, e.g. a connector being unplugged
+func (net *FakeNet) Detach(gpio *FakeGPIO) {
+	net.lock.Lock()
+	for i, p := range net.pins {
+		if p == gpio {
+			net.pins = append(net.pins[:i:i], net.pins[i+1:]...)
+			break
+		}
+	}
+	net.lock.Unlock()
+	if gpio.net == net {
+		gpio.net = nil
+	}
+	net.resolve()
+}
+
+// Pull resistor on the net: PULLUP, PULLDOWN, or BIAS_DISABLED (the default) for none
+func (net *FakeNet) SetPull(bias int) error {
+	if bias != PULLUP && bias != PULLDOWN && bias != BIAS_DISABLED {
+		return fmt.Errorf("%s: invalid pull %d", net.name, bias)
+	}
+	net.lock.Lock()
+	net.pull = bias
+	net.lock.Unlock()
+	net.resolve()
+	return nil
+}
+
+// panic instead of only recording conflicts
+func (net *FakeNet) SetPanicOnConflict(panics bool) {
+	net.lock.Lock()
+	defer net.lock.Unlock()
+	net.panics = panics
+}
+
+// Conflicts recorded so far, one each time the net went into conflict
+func (net *FakeNet) Conflicts() []NetConflict {
+	net.lock.Lock()
+	defer net.lock.Unlock()
+	return append([]NetConflict(nil), net.conflicts...)
+}
+
+// Resulting level of the net, driven is false if neither an output nor the pull resistor determine it
+func (net *FakeNet) Level() (level bool, driven bool) {
+	net.lock.Lock()
+	defer net.lock.Unlock()
+	level, driven, _ = net.level()
+	return level, driven
+}
+
+func (net *FakeNet) level() (level, driven bool, conflict *NetConflict) {
+	var high, low []string
+	for _, gpio := range net.pins {
+		value, released := gpio.output()
+		if gpio.direction() != OUT || released {
+			continue
+		}
+		if value {
+			high = append(high, gpio.name)
+		} else {
+			low = append(low, gpio.name)
+		}
+	}
+	switch {
+	case len(high) > 0 && len(low) > 0:
+		return false, true, &NetConflict{High: high, Low: low}
+	case len(high) > 0:
+		return true, true, nil
+	case len(low) > 0:
+		return false, true, nil
+	}
+	return net.pull == PULLUP, net.pull != BIAS_DISABLED, nil
+}
+
+// recomputes the level and passes it on to the attached inputs, called whenever an attached output changed
+func (net *FakeNet) resolve() {
+	net.lock.Lock()
+	level, driven, conflict := net.level()
+	entered := conflict != nil && !net.conflict
+	net.conflict = conflict != nil
+	if entered {
+		conflict.Time = net.pins[0].now()
+		net.conflicts = append(net.conflicts, *conflict)
+	}
+	panics := net.panics
+	pins := append([]*FakeGPIO(nil), net.pins...)
+	net.lock.Unlock()
+	if entered && panics {
+		panic(fmt.Sprintf("FakeNet %s: %v", net.name, conflict))
+	}
+	for _, gpio := range pins {
+		if gpio.direction() != IN {
+			continue
+		}
+		if driven {
+			gpio.fakeInput(level, TRANSITION_CONNECTED)
+		} else {
+			gpio.fakeRelease()
+		}
+	}
+}
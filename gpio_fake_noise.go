@@ -0,0 +1,141 @@
+package bbhw
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Glitches superimposed on a FakeGPIO input, see SetNoise
+type NoiseParams struct {
+	MinWidth time.Duration // width of a glitch, chosen randomly from [MinWidth, MaxWidth]
+	MaxWidth time.Duration
+	Rate     float64 // glitches per second on average, 0 disables the noise
+	Seed     int64   // makes the glitches reproducible, 0 seeds from the current time
+}
+
+type fakeNoise struct {
+	lock     sync.Mutex
+	stop     chan struct{} // nil unless injecting
+	done     chan struct{} // closed when the injecting goroutine returned
+	scripted uint64        // FakeInputs not caused by the noise, a glitch ending after one does not restore the level
+}
+
+// Superimposes short glitches onto the input: at random times (Rate per second on average) the input toggles
+// and returns to its level after MinWidth to MaxWidth, through FakeInput like a waveform (recorded as TRANSITION_NOISE).
+// A FakeInput, waveform step or connected output changing the input during a glitch wins.
+// Timed by the clock given to SetClock before. Stops on Close or with NoiseParams{}. See also NoiseEdgeDistribution.
+func (gpio *FakeGPIO) SetNoise(params NoiseParams) error {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	if params.Rate < 0 || params.MinWidth < 0 || params.MaxWidth < params.MinWidth {
+		return errors.New(gpio.name + ": invalid NoiseParams")
+	}
+	if params.Rate > 0 && params.MaxWidth == 0 {
+		return errors.New(gpio.name + ": noise needs a MaxWidth > 0")
+	}
+	gpio.stopNoise()
+	if params.Rate == 0 {
+		return nil
+	}
+	if gpio.direction() != IN {
+		return errors.New(gpio.name + ": SetNoise on output")
+	}
+	seed := params.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	n := &gpio.noise
+	n.lock.Lock()
+	n.stop, n.done = stop, done
+	n.lock.Unlock()
+	r, clock := rand.New(rand.NewSource(seed)), gpio.clock()
+	// the first glitch is scheduled right away, so a ManualClock advanced next sees it
+	go gpio.injectNoise(params, r, clock, clock.After(noiseGap(params, r)), stop, done)
+	return nil
+}
+
+// time until the next glitch, exponentially distributed
+func noiseGap(p NoiseParams, r *rand.Rand) time.Duration {
+	return time.Duration(r.ExpFloat64() / p.Rate * float64(time.Second))
+}
+
+func (gpio *FakeGPIO) injectNoise(p NoiseParams, r *rand.Rand, clock Clock, next <-chan time.Time, stop, done chan struct{}) {
+	defer close(done)
+	w := &gpio.waveform // serializes with PlayWaveform
+	for {
+		width := p.MinWidth + time.Duration(r.Int63n(int64(p.MaxWidth-p.MinWidth)+1))
+		select {
+		case <-stop:
+			return
+		case <-next:
+		}
+		w.lock.Lock()
+		level, scripted := gpio.electricalValue(), gpio.noise.scriptedInputs()
+		gpio.fakeInput(!level, TRANSITION_NOISE)
+		w.lock.Unlock()
+		stopped := false
+		select {
+		case <-stop:
+			stopped = true
+		case <-clock.After(width):
+		}
+		w.lock.Lock()
+		if gpio.noise.scriptedInputs() == scripted {
+			gpio.fakeInput(level, TRANSITION_NOISE)
+		}
+		w.lock.Unlock()
+		if stopped {
+			return
+		}
+		next = clock.After(noiseGap(p, r))
+	}
+}
+
+func (n *fakeNoise) scriptedInputs() uint64 {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return n.scripted
+}
+
+// called by fakeInput for everything but the noise itself
+func (n *fakeNoise) countScripted() {
+	n.lock.Lock()
+	n.scripted++
+	n.lock.Unlock()
+}
+
+// stops the noise and waits for its goroutine, which sets no timers afterwards
+func (gpio *FakeGPIO) stopNoise() {
+	n := &gpio.noise
+	n.lock.Lock()
+	stop, done := n.stop, n.done
+	n.stop, n.done = nil, nil
+	n.lock.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// Robustness check of edge handling code against noise: for each of the seeds 1 to seeds
+// handler gets a new input with clock (nil for the default clock) and noise made with params,
+// it e.g. plays a waveform, counts the presses its debouncer saw and returns that count.
+// Returns how many runs counted how many edges, a correct debouncer has all runs at the same count.
+func NoiseEdgeDistribution(seeds int, params NoiseParams, clock Clock, handler func(in *FakeGPIO) int) (map[int]int, error) {
+	dist := make(map[int]int)
+	for seed := 1; seed <= seeds; seed++ {
+		in := NewFakeNamedGPIO("noisy input", IN, nil)
+		in.SetClock(clock)
+		params.Seed = int64(seed)
+		if err := in.SetNoise(params); err != nil {
+			return nil, err
+		}
+		dist[handler(in)]++
+		in.Close()
+	}
+	return dist, nil
+}
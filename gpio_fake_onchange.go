@@ -0,0 +1,67 @@
+package bbhw
+
+import "sync"
+
+type fakeCallback struct {
+	fn      func(state bool)
+	removed bool
+}
+
+type fakeCallbacks struct {
+	lock  sync.Mutex
+	list  []*fakeCallback
+	state bool // logical state last reported
+}
+
+// Calls fn with the new logical state whenever it changes (SetState, FakeInput, a connected output, ...),
+// synchronously before the call causing the change returns. Several callbacks are called in registration order.
+// No lock is held while fn runs, so it may use the pin (and remove, the returned func, is safe to call from fn).
+// But fn changing the state of the same pin recurses into the callbacks, which is up to fn to bound.
+// Example, a shift register model clocking in data on rising edges:
+//
+//	clk.OnChange(func(high bool) { if high { reg = reg<<1 | bit(data) } })
+func (gpio *FakeGPIO) OnChange(fn func(state bool)) (remove func()) {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	cb := &fakeCallback{fn: fn}
+	cs := &gpio.callbacks
+	cs.lock.Lock()
+	if len(cs.list) == 0 {
+		cs.state = gpio.logicalState()
+	}
+	cs.list = append(cs.list, cb)
+	cs.lock.Unlock()
+	return func() {
+		cs.lock.Lock()
+		defer cs.lock.Unlock()
+		cb.removed = true
+		for i, c := range cs.list {
+			if c == cb {
+				cs.list = append(cs.list[:i:i], cs.list[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// called by observeState
+func (gpio *FakeGPIO) notifyChange(state bool) {
+	cs := &gpio.callbacks
+	cs.lock.Lock()
+	if len(cs.list) == 0 || state == cs.state {
+		cs.lock.Unlock()
+		return
+	}
+	cs.state = state
+	list := cs.list
+	cs.lock.Unlock()
+	for _, cb := range list {
+		cs.lock.Lock()
+		removed := cb.removed
+		cs.lock.Unlock()
+		if !removed {
+			cb.fn(state)
+		}
+	}
+}
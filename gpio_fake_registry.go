@@ -0,0 +1,106 @@
+package bbhw
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// FakeGPIOs of a test fixture by name, so simulated peripherals can look up "heater_enable"
+// instead of getting every pin passed in. Optional, FakeGPIOs work the same without it.
+type FakeGPIORegistry struct {
+	pins  map[string]*FakeGPIO
+	order []string // creation order, used by DumpVCD
+	lock  sync.Mutex
+}
+
+func NewFakeGPIORegistry() *FakeGPIORegistry {
+	return &FakeGPIORegistry{pins: make(map[string]*FakeGPIO)}
+}
+
+// New FakeGPIO named name (see NewFakeNamedGPIO). Panics if the name is taken, fixtures are expected to be fixed
+func (r *FakeGPIORegistry) Create(name string, dir Direction) *FakeGPIO {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, taken := r.pins[name]; taken {
+		panic(fmt.Sprintf("FakeGPIORegistry: %q created twice", name))
+	}
+	gpio := NewFakeNamedGPIO(name, dir, nil)
+	r.pins[name] = gpio
+	r.order = append(r.order, name)
+	return gpio
+}
+
+// Panics if there is no FakeGPIO named name, so a typo fails the test right away. See Lookup
+func (r *FakeGPIORegistry) Get(name string) *FakeGPIO {
+	gpio, ok := r.Lookup(name)
+	if !ok {
+		panic(fmt.Sprintf("FakeGPIORegistry: no %q", name))
+	}
+	return gpio
+}
+
+func (r *FakeGPIORegistry) Lookup(name string) (gpio *FakeGPIO, ok bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	gpio, ok = r.pins[name]
+	return
+}
+
+// Connects the output of a and b to the input, in addition to what it is already connected to (see ConnectTo).
+// Fails unless exactly one of them is an output.
+func (r *FakeGPIORegistry) ConnectWire(a, b string) error {
+	out, in := r.Get(a), r.Get(b)
+	if out.direction() == in.direction() {
+		return fmt.Errorf("FakeGPIORegistry: can not wire %q to %q, one has to be an output and one an input", a, b)
+	}
+	if in.direction() == OUT {
+		out, in = in, out
+	}
+	out.ConnectTo(append(out.connectedTo, in)...)
+	return nil
+}
+
+// Logical states of all FakeGPIOs by name
+func (r *FakeGPIORegistry) DumpStates() map[string]bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	states := make(map[string]bool, len(r.pins))
+	for name, gpio := range r.pins {
+		states[name] = gpio.logicalState()
+	}
+	return states
+}
+
+// EnableHistory on all FakeGPIOs created so far
+func (r *FakeGPIORegistry) EnableHistory(capacity int) {
+	for _, gpio := range r.all() {
+		gpio.EnableHistory(capacity)
+	}
+}
+
+// DumpVCD of all FakeGPIOs in the order they were created, see EnableHistory
+func (r *FakeGPIORegistry) DumpVCD(w io.Writer) error {
+	return DumpVCD(w, r.all()...)
+}
+
+// Closes all FakeGPIOs and empties the registry
+func (r *FakeGPIORegistry) CloseAll() {
+	pins := r.all()
+	r.lock.Lock()
+	r.pins, r.order = make(map[string]*FakeGPIO), nil
+	r.lock.Unlock()
+	for _, gpio := range pins {
+		gpio.Close()
+	}
+}
+
+func (r *FakeGPIORegistry) all() []*FakeGPIO {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	pins := make([]*FakeGPIO, len(r.order))
+	for i, name := range r.order {
+		pins[i] = r.pins[name]
+	}
+	return pins
+}
@@ -0,0 +1,97 @@
+package bbhw
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// number at the end of a name like "FakeGPIO(44)" or "gpio44", 0 if there is none
+func fakeGPIONumber(name string) uint {
+	name = strings.TrimSuffix(name, ")")
+	i := len(name)
+	for i > 0 && name[i-1] >= '0' && name[i-1] <= '9' {
+		i--
+	}
+	n, _ := strconv.ParseUint(name[i:], 10, 32)
+	return uint(n)
+}
+
+// the GPIO number given to NewFakeGPIO, parsed from the name given to NewFakeNamedGPIO or set by SetNumber
+func (gpio *FakeGPIO) Number() uint {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	return gpio.number
+}
+
+func (gpio *FakeGPIO) SetNumber(number uint) {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	gpio.number = number
+}
+
+// same as GetState, a FakeGPIO has nothing to cache
+func (gpio *FakeGPIO) GetStateCached(maxAge time.Duration) (state bool, err error) {
+	return gpio.GetState()
+}
+
+// does nothing unless a failure was injected, see FailNext
+func (gpio *FakeGPIO) ReOpen() error {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	return gpio.injectedFailure("ReOpen")
+}
+
+// does nothing unless a failure was injected, see FailNext
+func (gpio *FakeGPIO) Reinitialize() error {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	return gpio.injectedFailure("Reinitialize")
+}
+
+// same as SysfsGPIO.Config, Number is that of Number()
+func (gpio *FakeGPIO) Config() GPIOConfig {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	gpio.edges.lock.Lock()
+	edge := gpio.edges.edge
+	gpio.edges.lock.Unlock()
+	activelow, invert := gpio.polarity()
+	return GPIOConfig{Number: gpio.number, Direction: gpio.direction(), Edge: edge, ActiveLow: activelow,
+		Invert: invert, State: gpio.logicalState()}
+}
+
+// same as SysfsGPIO.ApplyConfig
+func (gpio *FakeGPIO) ApplyConfig(cfg GPIOConfig) error {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	if cfg.Number != gpio.number {
+		return fmt.Errorf("config of gpio%d applied to %s", cfg.Number, gpio.name)
+	}
+	if cfg.Edge < RISING || cfg.Edge > NONE {
+		return fmt.Errorf("%s: invalid edge %d", gpio.name, cfg.Edge)
+	}
+	if err := gpio.SetDirection(cfg.Direction); err != nil {
+		return err
+	}
+	gpio.lock.Lock()
+	gpio.invert, gpio.activelow = cfg.Invert, cfg.ActiveLow
+	gpio.lock.Unlock()
+	if cfg.Direction == OUT {
+		if err := gpio.SetState(cfg.State); err != nil {
+			return err
+		}
+	} else {
+		gpio.observeState(TRANSITION_CONFIG)
+	}
+	return gpio.SetEdge(cfg.Edge)
+}
+
+var _ SysfsCompatibleGPIO = (*FakeGPIO)(nil)
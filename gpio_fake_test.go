@@ -0,0 +1,769 @@
+package bbhw
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_FakeGPIOBias(t *testing.T) {
+	in := NewFakeGPIO(1, IN)
+	if err := in.SetBias(PULLUP); err != nil {
+		t.Fatal(err)
+	}
+	if GetStateOrPanic(in) != true {
+		t.Error("undriven input with PULLUP should read high")
+	}
+	in.FakeInput(false)
+	if GetStateOrPanic(in) != false {
+		t.Error("driven input should ignore bias")
+	}
+	pd := NewFakeGPIO(2, IN)
+	pd.SetBias(PULLDOWN)
+	if GetStateOrPanic(pd) != false {
+		t.Error("undriven input with PULLDOWN should read low")
+	}
+	if pd.SetBias(42) == nil {
+		t.Error("invalid bias accepted")
+	}
+}
+
+func Test_FakeGPIOOpenDrain(t *testing.T) {
+	out := NewFakeGPIO(1, OUT)
+	in := NewFakeGPIO(2, IN)
+	out.ConnectTo(in)
+	in.SetBias(PULLUP)
+	if err := out.SetDriveMode(OPEN_DRAIN); err != nil {
+		t.Fatal(err)
+	}
+	out.SetState(false)
+	if GetStateOrPanic(in) != false {
+		t.Error("open-drain output does not drive low")
+	}
+	out.SetState(true)
+	if GetStateOrPanic(in) != true {
+		t.Error("released open-drain line is not pulled up")
+	}
+	in.SetBias(PULLDOWN)
+	if GetStateOrPanic(in) != false {
+		t.Error("open-drain output writing 1 must not drive high")
+	}
+	if GetStateOrPanic(out) != false {
+		t.Error("released open-drain output without pull-up reads high")
+	}
+}
+
+func Test_FakeGPIOEdgeCallback(t *testing.T) {
+	button := NewFakeGPIO(1, IN)
+	ch := make(chan bool)
+	if err := button.SetEdgeCallback(&ch, -1); err == nil {
+		t.Fatal("SetEdgeCallback without edge should fail")
+	}
+	if err := button.SetEdge(FALLING); err != nil {
+		t.Fatal(err)
+	}
+	if edge, _ := button.GetEdge(); edge != "falling" {
+		t.Fatalf("GetEdge returned %q", edge)
+	}
+	if err := button.SetEdgeCallback(&ch, -1); err != nil {
+		t.Fatal(err)
+	}
+	button.FakeInput(true) // rising, filtered
+	button.FakeInput(true) // no edge at all
+	button.FakeInput(false)
+	if state := <-ch; state != false {
+		t.Error("expected falling edge")
+	}
+	button.SetEdge(BOTH)
+	button.FakeInput(true)
+	if state := <-ch; state != true {
+		t.Error("expected rising edge")
+	}
+	select {
+	case state := <-ch:
+		t.Errorf("unexpected event %v", state)
+	case <-time.After(20 * time.Millisecond):
+	}
+	button.Close()
+	if _, ok := <-ch; ok {
+		t.Error("channel should be closed by Close")
+	}
+}
+
+func Test_FakeGPIOEdgeFromConnectedOutput(t *testing.T) {
+	out := NewFakeGPIO(1, OUT)
+	in := NewFakeGPIO(2, IN)
+	out.ConnectTo(in)
+	events := make(chan EdgeEvent)
+	in.SetEdge(RISING)
+	if err := in.SetEdgeEventCallback(events, -1); err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	out.SetState(true)
+	if ev := <-events; !ev.State || ev.Edge != RISING {
+		t.Errorf("unexpected event %+v", ev)
+	}
+}
+
+func Test_FakeGPIOEdgeTimeout(t *testing.T) {
+	in := NewFakeGPIO(1, IN)
+	in.FakeInput(true)
+	in.SetEdge(BOTH)
+	ch := make(chan bool)
+	if err := in.SetEdgeCallback(&ch, 5); err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	if state := <-ch; state != true {
+		t.Error("timeout should deliver the current state")
+	}
+	in.FakeInput(false)
+	for state := range ch {
+		if !state {
+			return
+		}
+	}
+	t.Error("watcher ended after timeout")
+}
+
+func Test_FakeGPIOHistory(t *testing.T) {
+	out := NewFakeGPIO(1, OUT)
+	in := NewFakeGPIO(2, IN)
+	out.ConnectTo(in)
+	out.EnableHistory(3)
+	in.EnableHistory(10)
+	out.SetState(true)
+	out.SetState(true) // no transition
+	time.Sleep(2 * time.Millisecond)
+	out.SetState(false)
+	in.FakeInput(true)
+	out.AssertSequence(t, true, false)
+	in.AssertSequence(t, true, false, true)
+	if d := out.TimeBetween(0, 1); d < 2*time.Millisecond {
+		t.Errorf("TimeBetween returned %v", d)
+	}
+	h := in.History()
+	if h[0].Source != TRANSITION_CONNECTED || h[2].Source != TRANSITION_FAKEINPUT {
+		t.Errorf("unexpected sources %v", h)
+	}
+	for _, state := range []bool{true, false, true} {
+		out.SetState(state)
+	}
+	// capacity 3: the oldest two transitions got dropped
+	out.AssertSequence(t, true, false, true)
+}
+
+func Test_FakeGPIOPlayWaveform(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	in := NewFakeGPIO(1, IN)
+	in.SetClock(clock)
+	in.EnableHistory(10)
+	in.SetEdge(BOTH)
+	events := make(chan EdgeEvent)
+	if err := in.SetEdgeEventCallback(events, -1); err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	done, err := in.PlayWaveform([]WaveStep{{true, 5 * time.Millisecond}, {false, 2 * time.Millisecond}, {true, 50 * time.Millisecond}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := in.PlayWaveform([]WaveStep{{false, 0}}); err == nil {
+		t.Error("second waveform should be refused while playing")
+	}
+	for _, step := range []struct {
+		state bool
+		wait  time.Duration
+	}{{true, 5 * time.Millisecond}, {false, 2 * time.Millisecond}, {true, 50 * time.Millisecond}} {
+		if ev := <-events; ev.State != step.state {
+			t.Fatalf("expected %v, got %+v", step.state, ev)
+		}
+		clock.Advance(step.wait)
+	}
+	<-done
+	in.AssertSequence(t, true, false, true)
+	if d := in.TimeBetween(0, 1); d != 5*time.Millisecond {
+		t.Errorf("TimeBetween(0, 1) = %v", d)
+	}
+	if d := in.TimeBetween(1, 2); d != 2*time.Millisecond {
+		t.Errorf("TimeBetween(1, 2) = %v", d)
+	}
+
+	if _, err := NewFakeGPIO(2, OUT).PlayWaveform([]WaveStep{{true, 0}}); err == nil {
+		t.Error("PlayWaveform on output should fail")
+	}
+}
+
+func Test_FakeGPIOPlayWaveformClose(t *testing.T) {
+	in := NewFakeGPIO(1, IN)
+	in.EnableHistory(10)
+	done, err := in.PlayWaveform([]WaveStep{{true, time.Hour}, {false, 0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for len(in.History()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	in.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("playback did not stop on Close")
+	}
+	in.AssertSequence(t, true)
+}
+
+// what a debouncer with the given settle time reports for a series of edge events
+func debouncedEvents(events []EdgeEvent, settle time.Duration) (settled []EdgeEvent) {
+	for i, ev := range events {
+		if i == len(events)-1 || events[i+1].Time.Sub(ev.Time) >= settle {
+			settled = append(settled, ev)
+		}
+	}
+	return settled
+}
+
+func Test_FakeGPIOBounce(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	in := NewFakeGPIO(1, IN)
+	in.SetClock(clock)
+	in.SetEdge(BOTH)
+	if err := in.SetBounce(BounceParams{Count: 5, MinInterval: time.Millisecond, MaxInterval: 100 * time.Microsecond}); err == nil {
+		t.Error("MinInterval > MaxInterval should be refused")
+	}
+	if err := in.SetBounce(BounceParams{Count: 5, MinInterval: 100 * time.Microsecond, MaxInterval: 500 * time.Microsecond, Seed: 1}); err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan EdgeEvent, 100)
+	if err := in.SetEdgeEventCallback(ch, -1); err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	settled := make(chan struct{})
+	go func() {
+		in.FakeInput(true)
+		close(settled)
+	}()
+	for done := false; !done; {
+		select {
+		case <-settled:
+			done = true
+		case <-time.After(50 * time.Microsecond):
+			clock.Advance(100 * time.Microsecond)
+		}
+	}
+	var events []EdgeEvent
+	for len(events) < 11 {
+		select {
+		case ev := <-ch:
+			events = append(events, ev)
+		case <-time.After(time.Second):
+			t.Fatalf("naive edge counter saw only %d edges", len(events))
+		}
+	}
+	if deb := debouncedEvents(events, 2*time.Millisecond); len(deb) != 1 || deb[0].State != true {
+		t.Errorf("debouncer should see exactly one settled rising edge, got %+v", deb)
+	}
+
+	in.SetBounce(BounceParams{})
+	in.EnableHistory(10)
+	in.FakeInput(false)
+	in.AssertSequence(t, false)
+}
+
+func Test_FakeGPIOConnectToVia(t *testing.T) {
+	out := NewFakeGPIO(1, OUT)
+	plain := NewFakeGPIO(2, IN)
+	inverted := NewFakeGPIO(3, IN)
+	out.ConnectTo(plain)
+	out.ConnectToVia(inverted, Invert())
+	out.SetState(true)
+	if !GetStateOrPanic(plain) || GetStateOrPanic(inverted) {
+		t.Error("inverted connection should flip the observed state")
+	}
+	out.SetState(false)
+	if GetStateOrPanic(plain) || !GetStateOrPanic(inverted) {
+		t.Error("inverted connection should flip the observed state")
+	}
+	if s := out.Snapshot(); len(s.ConnectedTo) != 2 {
+		t.Errorf("Snapshot lists %v", s.ConnectedTo)
+	}
+
+	clock := NewManualClock(time.Unix(1000, 0))
+	delayed := NewFakeGPIO(4, IN)
+	delayed.SetClock(clock)
+	out.SetClock(clock)
+	out.ConnectToVia(delayed, Delay(10*time.Millisecond))
+	defer out.Close()
+	delayed.SetEdge(RISING)
+	events := make(chan EdgeEvent, 1)
+	if err := delayed.SetEdgeEventCallback(events, -1); err != nil {
+		t.Fatal(err)
+	}
+	defer delayed.Close()
+	out.SetState(true)
+	for i := 0; i < 9; i++ {
+		clock.Advance(time.Millisecond)
+		select {
+		case ev := <-events:
+			t.Fatalf("edge arrived %v after SetState, before the delay", ev.Time.Sub(time.Unix(1000, 0)))
+		case <-time.After(time.Millisecond):
+		}
+	}
+	for done := false; !done; {
+		select {
+		case ev := <-events:
+			if d := ev.Time.Sub(time.Unix(1000, 0)); d != 10*time.Millisecond || !ev.State {
+				t.Errorf("delayed edge %+v after %v", ev, d)
+			}
+			done = true
+		case <-time.After(time.Millisecond):
+			clock.Advance(time.Millisecond)
+			if clock.Now().Sub(time.Unix(1000, 0)) > time.Second {
+				t.Fatal("delayed edge never arrived")
+			}
+		}
+	}
+}
+
+func Test_FakeNet(t *testing.T) {
+	a := NewFakeGPIO(1, OUT)
+	b := NewFakeGPIO(2, OUT)
+	in := NewFakeGPIO(3, IN)
+	net := NewFakeNet("SDA")
+	net.Attach(a, in)
+	a.SetState(true)
+	if !GetStateOrPanic(in) {
+		t.Error("input should read the level of the only driver")
+	}
+	b.SetState(true)
+	net.Attach(b)
+	if len(net.Conflicts()) != 0 {
+		t.Error("same level is no conflict")
+	}
+	b.SetState(false)
+	b.SetState(false)
+	if c := net.Conflicts(); len(c) != 1 || c[0].High[0] != a.name || c[0].Low[0] != b.name {
+		t.Errorf("expected one conflict, got %v", c)
+	}
+	net.SetPanicOnConflict(true)
+	a.SetState(false)
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("conflict should panic")
+			}
+		}()
+		a.SetState(true)
+	}()
+}
+
+func Test_FakeNetOpenDrain(t *testing.T) {
+	a := NewFakeGPIO(1, OUT)
+	b := NewFakeGPIO(2, OUT)
+	in := NewFakeGPIO(3, IN)
+	a.SetDriveMode(OPEN_DRAIN)
+	b.SetDriveMode(OPEN_DRAIN)
+	net := NewFakeNet("SCL")
+	net.SetPanicOnConflict(true)
+	if err := net.SetPull(PULLUP); err != nil {
+		t.Fatal(err)
+	}
+	net.Attach(a, b, in)
+	a.SetState(true)
+	b.SetState(true)
+	if !GetStateOrPanic(in) {
+		t.Error("released open-drain net should be pulled up")
+	}
+	b.SetState(false)
+	if GetStateOrPanic(in) {
+		t.Error("one open-drain output pulling low should win without conflict")
+	}
+	if level, driven := net.Level(); level || !driven {
+		t.Error("Level should be driven low")
+	}
+	b.SetState(true)
+	net.SetPull(BIAS_DISABLED)
+	if _, driven := net.Level(); driven {
+		t.Error("net without pull resistor and drivers should float")
+	}
+}
+
+func Test_FakeGPIOUndrivenLevel(t *testing.T) {
+	in := NewFakeGPIO(1, IN)
+	if GetStateOrPanic(in) {
+		t.Error("undriven input should read low by default")
+	}
+	in.SetUndrivenLevel(true)
+	if !GetStateOrPanic(in) {
+		t.Error("undriven input should read the undriven level")
+	}
+	out := NewFakeGPIO(2, OUT)
+	net := NewFakeNet("button")
+	net.Attach(out, in)
+	if GetStateOrPanic(in) {
+		t.Error("input should read the output driving low")
+	}
+	out.SetDirection(IN)
+	if !GetStateOrPanic(in) {
+		t.Error("input should return to the pull level once the net is not driven anymore")
+	}
+}
+
+func Test_FakeGPIOFailureInjection(t *testing.T) {
+	out := NewFakeGPIO(1, OUT)
+	out.EnableHistory(10)
+	errBus := errors.New("bus error")
+	out.FailNext("SetState", errBus)
+	if err := out.SetState(true); !errors.Is(err, errBus) {
+		t.Errorf("expected injected error, got %v", err)
+	}
+	if GetStateOrPanic(out) {
+		t.Error("failed SetState changed the state")
+	}
+	if err := out.SetState(true); err != nil {
+		t.Error("only the next call should fail:", err)
+	}
+	out.FailNext("GetState", errBus)
+	if _, err := out.GetState(); !errors.Is(err, errBus) {
+		t.Errorf("expected injected error, got %v", err)
+	}
+	out.FailNext("SetDirection", errBus)
+	if err := out.SetDirection(IN); !errors.Is(err, errBus) {
+		t.Errorf("expected injected error, got %v", err)
+	}
+	out.FailNext("SetEdge", errBus)
+	if err := out.SetEdge(RISING); !errors.Is(err, errBus) {
+		t.Errorf("expected injected error, got %v", err)
+	}
+	h := out.History()
+	if len(h) != 5 || h[0].Source != TRANSITION_FAILURE || !errors.Is(h[0].Err, errBus) {
+		t.Errorf("injected failures missing in History: %v", h)
+	}
+	out.AssertSequence(t, true)
+
+	failures := func(seed int64) (n []int) {
+		gpio := NewFakeGPIO(2, IN)
+		gpio.SetFailureSeed(seed)
+		gpio.SetFailureRate("GetState", 0.3, errBus)
+		for i := 0; i < 100; i++ {
+			if _, err := gpio.GetState(); err != nil {
+				n = append(n, i)
+			}
+		}
+		return n
+	}
+	a, b := failures(42), failures(42)
+	if len(a) < 10 || len(a) > 60 || fmt.Sprint(a) != fmt.Sprint(b) {
+		t.Errorf("seeded failures not reproducible or implausible: %v vs %v", a, b)
+	}
+}
+
+func Test_FakeGPIOSysfsParity(t *testing.T) {
+	gpio := NewFakeGPIO(44, OUT)
+	if gpio.Number() != 44 || NewFakeNamedGPIO("gpio7", IN, nil).Number() != 7 {
+		t.Error("Number not parsed from the name")
+	}
+	if err := gpio.ReOpen(); err != nil {
+		t.Error(err)
+	}
+	errGone := errors.New("gone")
+	gpio.FailNext("ReOpen", errGone)
+	if err := gpio.ReOpen(); !errors.Is(err, errGone) {
+		t.Errorf("expected injected error, got %v", err)
+	}
+	var sysfslike SysfsCompatibleGPIO = gpio
+	sysfslike.SetActiveLow(true)
+	sysfslike.SetState(true)
+	cfg := sysfslike.Config()
+	if cfg != (GPIOConfig{Number: 44, Direction: OUT, Edge: NONE, ActiveLow: true, State: true}) {
+		t.Errorf("unexpected Config %+v", cfg)
+	}
+	other := NewFakeGPIO(1, IN)
+	if err := other.ApplyConfig(cfg); err == nil {
+		t.Error("config of another number should be refused")
+	}
+	other.SetNumber(44)
+	if err := other.ApplyConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if got := other.Config(); got != cfg {
+		t.Errorf("ApplyConfig(%+v) resulted in %+v", cfg, got)
+	}
+	if s := other.Snapshot(); s.Number != 44 || s.Edge != "none" {
+		t.Errorf("unexpected Snapshot %+v", s)
+	}
+}
+
+func Test_DumpVCD(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	step := NewFakeNamedGPIO("STEP", OUT, nil)
+	dir := NewFakeNamedGPIO("DIR", OUT, nil)
+	var buf bytes.Buffer
+	if err := DumpVCD(&buf, step, dir); err == nil || !strings.Contains(err.Error(), "STEP") {
+		t.Errorf("pins without history should fail, got %v", err)
+	}
+	for _, gpio := range []*FakeGPIO{step, dir} {
+		gpio.SetClock(clock)
+		gpio.EnableHistory(10)
+	}
+	dir.SetState(true)
+	clock.Advance(time.Microsecond)
+	step.SetState(true)
+	clock.Advance(2 * time.Microsecond)
+	step.SetState(false)
+	if err := DumpVCD(&buf, step, dir); err != nil {
+		t.Fatal(err)
+	}
+	want := "$var wire 1 ! STEP $end\n$var wire 1 \" DIR $end\n$upscope $end\n$enddefinitions $end\n" +
+		"#0\n$dumpvars\n0!\n0\"\n$end\n1\"\n#1000\n1!\n#3000\n0!\n"
+	if !strings.HasSuffix(buf.String(), want) {
+		t.Errorf("unexpected VCD:\n%s", buf.String())
+	}
+}
+
+func Test_FakeGPIOOnChange(t *testing.T) {
+	clk := NewFakeNamedGPIO("CLK", OUT, nil)
+	data := NewFakeNamedGPIO("DATA", OUT, nil)
+	// shift register model clocking in DATA on rising edges of CLK
+	var reg byte
+	var calls []string
+	clk.OnChange(func(high bool) {
+		if high {
+			reg <<= 1
+			if GetStateOrPanic(data) {
+				reg |= 1
+			}
+		}
+	})
+	clk.OnChange(func(high bool) { calls = append(calls, "second") })
+	for i := 7; i >= 0; i-- {
+		data.SetState(0xA5&(1<<uint(i)) != 0)
+		clk.SetState(true)
+		clk.SetState(true) // no change, no callback
+		clk.SetState(false)
+	}
+	if reg != 0xA5 {
+		t.Errorf("shift register model clocked in %#x", reg)
+	}
+	if len(calls) != 16 {
+		t.Errorf("second callback called %d times", len(calls))
+	}
+
+	in := NewFakeGPIO(1, IN)
+	n := 0
+	var remove func()
+	remove = in.OnChange(func(bool) {
+		if n++; n == 3 {
+			remove()
+		}
+	})
+	for i := 0; i < 10; i++ {
+		in.FakeInput(i%2 == 0)
+	}
+	if n != 3 {
+		t.Errorf("callback removing itself called %d times", n)
+	}
+}
+
+func Test_FakeGPIOOperationLatency(t *testing.T) {
+	start := time.Unix(1000, 0)
+	clock := NewManualClock(start)
+	out := NewFakeGPIO(1, OUT)
+	out.SetClock(clock)
+	out.EnableHistory(10)
+	out.SetOperationLatency(5 * time.Millisecond)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		out.SetState(true)
+		out.GetState()
+		out.SetState(false)
+		out.SetOperationJitter(2*time.Millisecond, 1)
+		out.SetState(true)
+	}()
+	clock.BlockUntil(1)
+	advanceSteps(t, clock, 5*time.Millisecond, 5*time.Millisecond, 5*time.Millisecond, 7*time.Millisecond)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("operations still blocked after their latencies")
+	}
+	h := out.History()
+	if len(h) != 3 {
+		t.Fatalf("expected 3 transitions, got %v", h)
+	}
+	for i, want := range []time.Duration{0, 10 * time.Millisecond} {
+		if !h[i].Requested.Equal(start.Add(want)) || !h[i].Time.Equal(start.Add(want+5*time.Millisecond)) {
+			t.Errorf("transition %d requested at %v, done at %v", i, h[i].Requested.Sub(start), h[i].Time.Sub(start))
+		}
+	}
+	if d := h[2].Time.Sub(h[2].Requested); d < 5*time.Millisecond || d > 7*time.Millisecond {
+		t.Errorf("latency with jitter %v", d)
+	}
+}
+
+func Test_FakeGPIORegistry(t *testing.T) {
+	r := NewFakeGPIORegistry()
+	r.Create("heater_enable", OUT)
+	r.Create("heater_sense", IN)
+	r.Create("fan_enable", OUT)
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("creating heater_enable twice did not panic")
+			}
+		}()
+		r.Create("heater_enable", IN)
+	}()
+	if err := r.ConnectWire("heater_sense", "heater_enable"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ConnectWire("fan_enable", "heater_enable"); err == nil {
+		t.Error("wiring two outputs succeeded")
+	}
+	r.EnableHistory(10)
+	r.Get("heater_enable").SetState(true)
+	if states := r.DumpStates(); !states["heater_enable"] || !states["heater_sense"] || states["fan_enable"] || len(states) != 3 {
+		t.Errorf("DumpStates() = %v", states)
+	}
+	var buf bytes.Buffer
+	if err := r.DumpVCD(&buf); err != nil || !strings.Contains(buf.String(), "$var wire 1 \" heater_sense $end") {
+		t.Errorf("DumpVCD() = %v:\n%s", err, buf.String())
+	}
+	r.CloseAll()
+	if _, ok := r.Lookup("heater_enable"); ok {
+		t.Error("heater_enable still registered after CloseAll")
+	}
+}
+
+func Test_FakeGPIOCombineMode(t *testing.T) {
+	for _, tc := range []struct {
+		mode CombineMode
+		// input after each of the drivers a, b, c went high, then after a went low again
+		want []bool
+	}{
+		{COMBINE_LAST_WRITE_WINS, []bool{true, true, true, false}},
+		{COMBINE_OR, []bool{true, true, true, true}},
+		{COMBINE_AND, []bool{false, false, true, false}},
+	} {
+		in := NewFakeNamedGPIO("INT", IN, nil)
+		if err := in.SetCombineMode(tc.mode); err != nil {
+			t.Fatal(err)
+		}
+		var drivers []*FakeGPIO
+		for _, name := range []string{"a", "b", "c"} {
+			out := NewFakeNamedGPIO(name, OUT, nil)
+			out.ConnectTo(in)
+			drivers = append(drivers, out)
+		}
+		var got []bool
+		for _, out := range drivers {
+			out.SetState(true)
+			got = append(got, GetStateOrPanic(in))
+		}
+		drivers[0].SetState(false)
+		got = append(got, GetStateOrPanic(in))
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("%v: input read %v, expected %v", tc.mode, got, tc.want)
+		}
+	}
+	// released open-drain outputs don't take part
+	in := NewFakeGPIO(1, IN)
+	in.SetCombineMode(COMBINE_AND)
+	od := NewFakeGPIO(2, OUT)
+	od.SetDriveMode(OPEN_DRAIN)
+	low := NewFakeGPIO(3, OUT)
+	od.ConnectTo(in)
+	low.ConnectTo(in)
+	od.SetState(true)
+	if GetStateOrPanic(in) {
+		t.Error("wired-AND high while one output drives low")
+	}
+	low.SetState(true)
+	if !GetStateOrPanic(in) {
+		t.Error("wired-AND low with the open-drain output released")
+	}
+	if err := in.SetCombineMode(CombineMode(7)); err == nil {
+		t.Error("invalid CombineMode accepted")
+	}
+}
+
+func Test_FakeGPIONoise(t *testing.T) {
+	params := NoiseParams{MinWidth: 10 * time.Microsecond, MaxWidth: 50 * time.Microsecond, Rate: 1000}
+	glitches := func(seed int64) []Transition {
+		clock := NewManualClock(time.Unix(1000, 0))
+		in := NewFakeGPIO(1, IN)
+		in.SetClock(clock)
+		in.EnableHistory(1000)
+		params.Seed = seed
+		if err := in.SetNoise(params); err != nil {
+			t.Fatal(err)
+		}
+		defer in.Close()
+		clock.BlockUntil(1)
+		advanceTimerByTimer(t, clock, 100*time.Millisecond)
+		in.SetNoise(NoiseParams{})
+		if GetStateOrPanic(in) {
+			t.Error("input not back low after the noise")
+		}
+		return in.History()
+	}
+	h := glitches(1)
+	if len(h) < 100 || len(h)%2 != 0 {
+		t.Fatalf("%d transitions in 100ms of noise at 1000 glitches/s", len(h))
+	}
+	for i := 0; i < len(h); i += 2 {
+		if w := h[i+1].Time.Sub(h[i].Time); !h[i].State || h[i].Source != TRANSITION_NOISE || w < params.MinWidth || w > params.MaxWidth {
+			t.Fatalf("glitch %d: %v for %v", i/2, h[i], w)
+		}
+	}
+	if again := glitches(1); fmt.Sprint(again) != fmt.Sprint(h) {
+		t.Error("same seed, different noise")
+	}
+	if err := NewFakeGPIO(2, OUT).SetNoise(params); err == nil {
+		t.Error("SetNoise on output succeeded")
+	}
+}
+
+func Test_NoiseEdgeDistribution(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	// a clean 20ms press with noise, counting all rising edges or those to a level held for 1ms
+	press := func(debounced bool) func(in *FakeGPIO) int {
+		return func(in *FakeGPIO) int {
+			in.EnableHistory(1000)
+			advanceTimerByTimer(t, clock, 10*time.Millisecond)
+			in.FakeInput(true)
+			advanceTimerByTimer(t, clock, 20*time.Millisecond)
+			in.FakeInput(false)
+			advanceTimerByTimer(t, clock, 10*time.Millisecond)
+			in.SetNoise(NoiseParams{})
+			clock.Advance(time.Second) // the timer the noise left behind, not to be waited for by the next run
+			n, stable, h := 0, false, in.History()
+			for i, tr := range h {
+				if debounced && (i+1 == len(h) || h[i+1].Time.Sub(tr.Time) < time.Millisecond || tr.State == stable) {
+					continue
+				}
+				if stable = tr.State; tr.State {
+					n++
+				}
+			}
+			return n
+		}
+	}
+	params := NoiseParams{MinWidth: 10 * time.Microsecond, MaxWidth: 100 * time.Microsecond, Rate: 200}
+	if dist, err := NoiseEdgeDistribution(5, params, clock, press(true)); err != nil || dist[1] != 5 {
+		t.Errorf("debounced handler: %v, %v", dist, err)
+	}
+	dist, err := NoiseEdgeDistribution(5, params, clock, press(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dist[1] == 5 {
+		t.Errorf("naive handler never saw a glitch: %v", dist)
+	}
+}
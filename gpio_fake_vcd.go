@@ -0,0 +1,89 @@
+package bbhw
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Writes the History of pins as Value Change Dump, e.g. to look at a failed test in GTKWave:
+//
+//	f, _ := os.Create("test.vcd")
+//	bbhw.DumpVCD(f, step, dir, enable)
+//
+// Signals are named after the pins, time 0 is the earliest recorded transition, the timescale is 1ns.
+// Injected failures are left out. All pins need EnableHistory, otherwise nothing is written.
+func DumpVCD(w io.Writer, pins ...*FakeGPIO) error {
+	type change struct {
+		t     time.Time
+		id    string
+		state bool
+	}
+	var changes []change
+	initial := make([]bool, len(pins))
+	for i, gpio := range pins {
+		if gpio == nil {
+			panic("gpio == nil")
+		}
+		if !gpio.history.enabled() {
+			return fmt.Errorf("DumpVCD: %s: no history recorded, see EnableHistory", gpio.name)
+		}
+		initial[i] = gpio.logicalState()
+		first := true
+		for _, tr := range gpio.History() {
+			if tr.Source == TRANSITION_FAILURE {
+				continue
+			}
+			if first {
+				initial[i], first = !tr.State, false
+			}
+			changes = append(changes, change{tr.Time, vcdIdentifier(i), tr.State})
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].t.Before(changes[j].t) })
+
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "$version go-bbhw FakeGPIO $end\n$timescale 1ns $end\n$scope module bbhw $end\n")
+	for i, gpio := range pins {
+		fmt.Fprintf(b, "$var wire 1 %s %s $end\n", vcdIdentifier(i), strings.Join(strings.Fields(gpio.name), "_"))
+	}
+	fmt.Fprintf(b, "$upscope $end\n$enddefinitions $end\n#0\n$dumpvars\n")
+	for i := range pins {
+		fmt.Fprintf(b, "%s%s\n", vcdValue(initial[i]), vcdIdentifier(i))
+	}
+	fmt.Fprintf(b, "$end\n")
+	var t0 time.Time
+	if len(changes) > 0 {
+		t0 = changes[0].t
+	}
+	var last time.Duration // #0 already written
+	for _, c := range changes {
+		if ts := c.t.Sub(t0); ts != last {
+			fmt.Fprintf(b, "#%d\n", ts.Nanoseconds())
+			last = ts
+		}
+		fmt.Fprintf(b, "%s%s\n", vcdValue(c.state), c.id)
+	}
+	return b.Flush()
+}
+
+// short identifier code of the i-th signal, made of the printable characters '!' to '~'
+func vcdIdentifier(i int) string {
+	id := ""
+	for {
+		id += string(rune('!' + i%94))
+		if i /= 94; i == 0 {
+			return id
+		}
+	}
+}
+
+func vcdValue(state bool) string {
+	if state {
+		return "1"
+	}
+	return "0"
+}
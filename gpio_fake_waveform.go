@@ -0,0 +1,117 @@
+package bbhw
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Use c for PlayWaveform, SetBounce, delayed connections and the timestamps and timeouts of History and
+// edge callbacks. nil reverts to the default clock, see SetDefaultClock.
+func (gpio *FakeGPIO) SetClock(c Clock) {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	gpio.waveform.clock_lock.Lock()
+	defer gpio.waveform.clock_lock.Unlock()
+	gpio.waveform.clock = c
+}
+
+func (gpio *FakeGPIO) now() time.Time {
+	return gpio.clock().Now()
+}
+
+func (gpio *FakeGPIO) clock() Clock {
+	gpio.waveform.clock_lock.Lock()
+	defer gpio.waveform.clock_lock.Unlock()
+	if gpio.waveform.clock == nil {
+		return defaultClock()
+	}
+	return gpio.waveform.clock
+}
+
+// One step of a waveform fed to a FakeGPIO input: State is held for Hold before the next step
+type WaveStep struct {
+	State bool
+	Hold  time.Duration
+}
+
+type fakeWaveform struct {
+	lock       sync.Mutex    // held around each FakeInput of the waveform
+	stop       chan struct{} // nil unless playing
+	clock_lock sync.Mutex
+	clock      Clock
+}
+
+// Feeds steps to FakeInput on a goroutine, e.g. a bouncing button press:
+//
+//	in.PlayWaveform([]bbhw.WaveStep{{true, 5 * time.Millisecond}, {false, 2 * time.Millisecond}, {true, 50 * time.Millisecond}})
+//
+// done is closed after the Hold of the last step, or when the FakeGPIO is closed.
+// Steps are scheduled relative to the start, a late step does not delay the following ones.
+// Only one waveform can play at a time, the FakeGPIO must be an input.
+func (gpio *FakeGPIO) PlayWaveform(steps []WaveStep) (done <-chan struct{}, err error) {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	if gpio.direction() != IN {
+		return nil, fmt.Errorf("%s: PlayWaveform on output", gpio.name)
+	}
+	for i, step := range steps {
+		if step.Hold < 0 {
+			return nil, fmt.Errorf("%s: step %d: negative hold %v", gpio.name, i, step.Hold)
+		}
+	}
+	clock := gpio.clock()
+	w := &gpio.waveform
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.stop != nil {
+		return nil, errors.New(gpio.name + ": waveform already playing")
+	}
+	stop := make(chan struct{})
+	w.stop = stop
+	finished := make(chan struct{})
+	steps = append([]WaveStep(nil), steps...)
+	go func() {
+		defer close(finished)
+		defer func() {
+			w.lock.Lock()
+			if w.stop == stop {
+				w.stop = nil
+			}
+			w.lock.Unlock()
+		}()
+		next := clock.Now()
+		for _, step := range steps {
+			w.lock.Lock()
+			select {
+			case <-stop:
+				w.lock.Unlock()
+				return
+			default:
+			}
+			gpio.fakeInput(step.State, TRANSITION_FAKEINPUT)
+			w.lock.Unlock()
+			next = next.Add(step.Hold)
+			select {
+			case <-stop:
+				return
+			case <-clock.After(next.Sub(clock.Now())):
+			}
+		}
+	}()
+	return finished, nil
+}
+
+// stops a playing waveform, no FakeInput happens after it returned
+func (gpio *FakeGPIO) stopWaveform() {
+	w := &gpio.waveform
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.stop != nil {
+		close(w.stop)
+		w.stop = nil
+	}
+}
@@ -0,0 +1,128 @@
+package bbhw
+
+import "fmt"
+
+// Combines a SysfsGPIO and a MMappedGPIO referring to the same physical line.
+// Get/SetState go through the (fast) memory mapped registers,
+// while edge detection and SetEdgeCallback use the sysfs value file and poll.
+// Only works on AM335x and address compatible SoCs
+type HybridGPIO struct {
+	sysfs   *SysfsGPIO
+	mmapped *MMappedGPIO
+}
+
+// Instantinate a new HybridGPIO. Takes GPIO numer (same as in sysfs) and direction bbhw.IN or bbhw.OUT
+func NewHybridGPIO(number uint, direction Direction) (gpio *HybridGPIO, err error) {
+	sg, err := NewSysfsGPIO(number, direction)
+	if err != nil {
+		return nil, err
+	}
+	mg := new(MMappedGPIO)
+	mg.chipid, mg.gpioid = calcGPIOAddrFromLinuxGPIONum(number)
+	gpio, err = NewHybridGPIOFromPins(sg, mg)
+	if err != nil {
+		sg.Close()
+		return nil, err
+	}
+	return gpio, nil
+}
+
+// Wrapper around NewHybridGPIO. Does not return an error but panics instead. Useful to avoid multiple return values.
+func NewHybridGPIOOrPanic(number uint, direction Direction) (gpio *HybridGPIO) {
+	gpio, err := NewHybridGPIO(number, direction)
+	if err != nil {
+		panic(err)
+	}
+	return gpio
+}
+
+// Combine an already existing SysfsGPIO and MMappedGPIO.
+// Fails if both do not refer to the very same physical line, i.e. if bank*32+offset != sysfs number
+func NewHybridGPIOFromPins(sysfs *SysfsGPIO, mmapped *MMappedGPIO) (gpio *HybridGPIO, err error) {
+	if sysfs == nil || mmapped == nil {
+		return nil, fmt.Errorf("HybridGPIO needs both a SysfsGPIO and a MMappedGPIO")
+	}
+	if mmapnum := uint(mmapped.chipid)*32 + mmapped.gpioid; mmapnum != sysfs.Number {
+		return nil, fmt.Errorf("HybridGPIO: sysfs gpio%d and mmapped gpio%d[%d] (=gpio%d) are not the same line", sysfs.Number, mmapped.chipid, mmapped.gpioid, mmapnum)
+	}
+	return &HybridGPIO{sysfs: sysfs, mmapped: mmapped}, nil
+}
+
+func (gpio *HybridGPIO) SetState(state bool) error {
+	return gpio.mmapped.SetState(state)
+}
+
+func (gpio *HybridGPIO) SetStateNow(state bool) error { return gpio.SetState(state) }
+
+func (gpio *HybridGPIO) Backend() string { return BACKEND_HYBRID }
+
+func (gpio *HybridGPIO) Capabilities() GPIOCapabilities {
+	return GPIOCapabilities{ActiveLow: true, Edges: true}
+}
+
+func (gpio *HybridGPIO) GetState() (bool, error) {
+	return gpio.mmapped.GetState()
+}
+
+func (gpio *HybridGPIO) CheckDirection() (Direction, error) {
+	return gpio.mmapped.CheckDirection()
+}
+
+// sets the direction through sysfs, as well as in the output enable register,
+// so CheckDirection (which reads the register) agrees immediately
+func (gpio *HybridGPIO) SetDirection(direction Direction) error {
+	if err := gpio.sysfs.SetDirection(direction); err != nil {
+		return err
+	}
+	return gpio.mmapped.SetDirection(direction)
+}
+
+// sets active_low in sysfs, so that edge callbacks report the same states as GetState,
+// as well as the inversion on the mmapped side
+func (gpio *HybridGPIO) SetActiveLow(activelow bool) error {
+	if err := gpio.sysfs.SetActiveLow(activelow); err != nil {
+		return err
+	}
+	return gpio.mmapped.SetActiveLow(activelow)
+}
+
+// inverts in software on both sides, so edge callbacks report the same states as GetState
+func (gpio *HybridGPIO) SetLogicalInvert(invert bool) error {
+	if err := gpio.sysfs.SetLogicalInvert(invert); err != nil {
+		return err
+	}
+	return gpio.mmapped.SetLogicalInvert(invert)
+}
+
+func (gpio *HybridGPIO) SetEdge(edge Edge) error {
+	return gpio.sysfs.SetEdge(edge)
+}
+
+func (gpio *HybridGPIO) GetEdge() (string, error) {
+	return gpio.sysfs.GetEdge()
+}
+
+// Monitor pin through sysfs using Unix Poll with a specified timeout (negative value for infinite timeout)
+func (gpio *HybridGPIO) SetEdgeCallback(callback *chan bool, timeout int) error {
+	return gpio.sysfs.SetEdgeCallback(callback, timeout)
+}
+
+// Direction and state as seen through the registers, edge and active_low from sysfs.
+// LastChange is not tracked, as states are set through the registers
+func (gpio *HybridGPIO) Snapshot() PinSnapshot {
+	s := gpio.mmapped.Snapshot()
+	s.Backend = BACKEND_HYBRID
+	s.Edge, _ = gpio.sysfs.GetEdge()
+	var err error
+	s.ActiveLow, err = gpio.sysfs.getActiveLow()
+	s.setError(err)
+	return s
+}
+
+// closes the sysfs filedescriptor, the gpio remains exported
+func (gpio *HybridGPIO) Close() {
+	gpio.sysfs.Close()
+	gpio.mmapped.Close()
+}
+
+var _ EdgeGPIO = (*HybridGPIO)(nil)
@@ -0,0 +1,83 @@
+package bbhw
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_HybridGPIOSameLine(t *testing.T) {
+	sg := &SysfsGPIO{Number: 67}
+	mg := new(MMappedGPIO)
+	mg.chipid, mg.gpioid = calcGPIOAddrFromLinuxGPIONum(67)
+	if _, err := NewHybridGPIOFromPins(sg, mg); err != nil {
+		t.Error("same line rejected:", err)
+	}
+	mg.gpioid = 4
+	if _, err := NewHybridGPIOFromPins(sg, mg); err == nil {
+		t.Error("gpio67 and gpio2[4] should not be accepted as the same line")
+	} else if msg := err.Error(); !strings.Contains(msg, "sysfs gpio67") || !strings.Contains(msg, "gpio2[4] (=gpio68)") {
+		t.Errorf("mismatch error %q does not name both lines", msg)
+	}
+	if _, err := NewHybridGPIOFromPins(nil, mg); err == nil {
+		t.Error("nil SysfsGPIO accepted")
+	}
+}
+
+// gpio45 is bank 1, bit 13: bit 5 of the second byte of each register
+func Test_HybridGPIOStateThroughRegistersEdgesThroughSysfs(t *testing.T) {
+	tree, _ := useFakeSysfsKernel(t, 45)
+	mmapreg := useFakeGPIORegisters(t)
+	regs := mmapreg.memgpiochipreg[1]
+	gpio, err := NewHybridGPIO(45, OUT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gpio.Close()
+
+	if err = gpio.SetState(true); err != nil {
+		t.Fatal(err)
+	}
+	if regs[intgpio_setdataout_+1] != 1<<5 {
+		t.Errorf("SetState(true) wrote %#x to SETDATAOUT", regs[intgpio_setdataout_+1])
+	}
+	if tree.Level(45) {
+		t.Error("SetState went through sysfs")
+	}
+
+	if err = gpio.SetDirection(IN); err != nil {
+		t.Fatal(err)
+	}
+	if regs[intgpio_output_enabled_+1]&(1<<5) == 0 {
+		t.Error("SetDirection(IN) did not set the output enable register")
+	}
+	regs[intgpio_datain_+1] |= 1 << 5
+	if state, _ := gpio.GetState(); !state {
+		t.Error("GetState did not read DATAIN")
+	}
+	regs[intgpio_datain_+1] &^= 1 << 5
+
+	if err = gpio.SetEdge(RISING); err != nil {
+		t.Fatal(err)
+	}
+	if edge, _ := gpio.GetEdge(); edge != "rising" {
+		t.Errorf("GetEdge() = %q", edge)
+	}
+	events := make(chan bool, 4)
+	if err = gpio.SetEdgeCallback(&events, -1); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond) // until it polls
+	tree.InjectInput(45, true)
+	select {
+	case state := <-events:
+		if !state {
+			t.Errorf("rising edge delivered %v", state)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no edge delivered through sysfs")
+	}
+	if state, _ := gpio.GetState(); state {
+		t.Error("GetState read the sysfs value instead of DATAIN")
+	}
+}
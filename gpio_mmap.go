@@ -10,6 +10,8 @@ type MMappedGPIO struct {
 	chipid    int
 	gpioid    uint
 	activelow bool
+	invert    bool // see SetLogicalInvert
+	unclaim   func()
 }
 
 /// Fast MemoryMapped GPIO Stuff -----------------------------------------
@@ -19,16 +21,31 @@ type MMappedGPIO struct {
 // Only works on AM335x and address compatible SoCs
 //
 // See http://kilobaser.com/blog/2014-07-15-beaglebone-black-gpios#1gpiopin regarding the numbering of GPIO pins.
-func NewMMappedGPIO(number uint, direction int) (gpio *MMappedGPIO) {
-	//Set direction and export GPIO via sysfs
-	NewSysfsGPIOOrPanic(number, direction).Close()
-	gpio = new(MMappedGPIO)
+//
+// Panics if the GPIO can not be exported or is already claimed, see NewMMappedGPIOOrError.
+func NewMMappedGPIO(number uint, direction Direction) (gpio *MMappedGPIO) {
+	gpio, err := NewMMappedGPIOOrError(number, direction)
+	if err != nil {
+		panic(err)
+	}
+	return gpio
+}
 
+// Same as NewMMappedGPIO, but returns errors instead of panicking,
+// e.g. ErrAlreadyClaimed if the GPIO number is already in use by this process
+func NewMMappedGPIOOrError(number uint, direction Direction) (gpio *MMappedGPIO, err error) {
+	if _, err = getgpiommapOrError(); err != nil {
+		return nil, err
+	}
+	gpio = new(MMappedGPIO)
+	if err = gpio.exportAndClaim(number, direction); err != nil {
+		return nil, err
+	}
 	gpio.chipid, gpio.gpioid = calcGPIOAddrFromLinuxGPIONum(number)
-	return gpio
+	return gpio, nil
 }
 
-func (gpio *MMappedGPIO) CheckDirection() (direction int, err error) {
+func (gpio *MMappedGPIO) CheckDirection() (direction Direction, err error) {
 	mmapreg := getgpiommap()
 	input_enabled := mmapreg.memgpiochipreg[gpio.chipid][intgpio_output_enabled_+(gpio.gpioid/8)]&(1<<(gpio.gpioid%8)) > 0
 	if input_enabled {
@@ -38,6 +55,23 @@ func (gpio *MMappedGPIO) CheckDirection() (direction int, err error) {
 	}
 }
 
+// Changes direction bbhw.IN or bbhw.OUT by writing the output enable register.
+// Does not update /sys/class/gpio/gpioN/direction
+func (gpio *MMappedGPIO) SetDirection(direction Direction) error {
+	if err := validateDirection(direction); err != nil {
+		return err
+	}
+	mmapreg := getgpiommap()
+	mmapreg.reglock.Lock()
+	defer mmapreg.reglock.Unlock()
+	if direction == IN {
+		mmapreg.memgpiochipreg[gpio.chipid][intgpio_output_enabled_+(gpio.gpioid/8)] |= 1 << (gpio.gpioid % 8)
+	} else {
+		mmapreg.memgpiochipreg[gpio.chipid][intgpio_output_enabled_+(gpio.gpioid/8)] &^= 1 << (gpio.gpioid % 8)
+	}
+	return nil
+}
+
 func (gpio *MMappedGPIO) SetDebounce(enable_debounce bool) error {
 	mmapreg := getgpiommap()
 	if dir, err := gpio.CheckDirection(); dir != IN || err != nil {
@@ -62,7 +96,7 @@ func (gpio *MMappedGPIO) SetDebounce(enable_debounce bool) error {
 // in this case: reboot
 func (gpio *MMappedGPIO) SetState(state bool) error {
 	mmapreg := getgpiommap()
-	if state != gpio.activelow {
+	if state != gpio.inverted() {
 		mmapreg.memgpiochipreg[gpio.chipid][intgpio_setdataout_+(gpio.gpioid/8)] = 1 << (gpio.gpioid % 8)
 	} else {
 		mmapreg.memgpiochipreg[gpio.chipid][intgpio_cleardataout_+(gpio.gpioid/8)] = 1 << (gpio.gpioid % 8)
@@ -78,6 +112,12 @@ func (gpio *MMappedGPIO) SetState(state bool) error {
 
 func (gpio *MMappedGPIO) SetStateNow(state bool) error { return gpio.SetState(state) }
 
+func (gpio *MMappedGPIO) Backend() string { return BACKEND_MMAPPED }
+
+func (gpio *MMappedGPIO) Capabilities() GPIOCapabilities {
+	return GPIOCapabilities{ActiveLow: true}
+}
+
 //this inverts the meaning of 0 and 1
 //just like in SysFS, this has an immediate effect on the physical output
 func (gpio *MMappedGPIO) SetActiveLow(activelow bool) error {
@@ -92,6 +132,18 @@ func (gpio *MMappedGPIO) SetActiveLow(activelow bool) error {
 	return gpio.SetState(prev_state)
 }
 
+// Inverts SetState and GetState on top of SetActiveLow. Unlike SetActiveLow, does not change the output
+func (gpio *MMappedGPIO) SetLogicalInvert(invert bool) error {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	gpio.invert = invert
+	return nil
+}
+
+// active low and logical inversion combined
+func (gpio *MMappedGPIO) inverted() bool { return gpio.activelow != gpio.invert }
+
 // returns true if pin is HIGH and false if pin is LOW i.e. HIGH/LOW signal on input pin
 // note that SetActiveLow inverts return value
 // internal note: in contrast to SysFS we need to query two different registers depending on the pin direction
@@ -103,11 +155,45 @@ func (gpio *MMappedGPIO) GetState() (state bool, err error) {
 	} else {
 		register = intgpio_dataout_ // if DIRECTION==OUT
 	}
-	state = gpio.activelow != (mmapreg.memgpiochipreg[gpio.chipid][register+(gpio.gpioid/8)]&(1<<(gpio.gpioid%8)) > 0)
+	state = gpio.inverted() != (mmapreg.memgpiochipreg[gpio.chipid][register+(gpio.gpioid/8)]&(1<<(gpio.gpioid%8)) > 0)
+	return
+}
+
+// Reads direction and state from the registers. LastChange is not tracked, to keep SetState fast
+func (gpio *MMappedGPIO) Snapshot() PinSnapshot {
+	s := PinSnapshot{Number: uint(gpio.chipid)*32 + gpio.gpioid, Backend: BACKEND_MMAPPED, ActiveLow: gpio.activelow, Inverted: gpio.invert}
+	s.Direction, _ = gpio.CheckDirection()
+	s.State, _ = gpio.GetState()
+	return s
+}
+
+// registers the GPIO number, see SetClaimRegistry
+func (gpio *MMappedGPIO) claim(number uint) (err error) {
+	gpio.unclaim, err = claimPin(gpioClaimName(number), "", false)
 	return
 }
 
-// not really necessary, but nice to keep same interface as SysfsGPIO
+// claims the GPIO number, then sets direction and exports the GPIO via sysfs.
+// The sysfs side shares our claim, so nobody else can sneak in between.
+func (gpio *MMappedGPIO) exportAndClaim(number uint, direction Direction) error {
+	if err := gpio.claim(number); err != nil {
+		return err
+	}
+	sg, err := NewSysfsGPIOWithOptions(number, WithDirection(direction), WithSharedOK())
+	if err != nil {
+		gpio.unclaim()
+		return err
+	}
+	sg.Close()
+	return nil
+}
+
+// releases the claim of the GPIO number, otherwise not really necessary, but nice to keep same interface as SysfsGPIO
 func (gpio *MMappedGPIO) Close() {
+	if gpio.unclaim != nil {
+		gpio.unclaim()
+	}
 	gpio = nil
 }
+
+var _ GPIO = (*MMappedGPIO)(nil)
@@ -65,15 +65,26 @@ func (gpiocf *MMappedGPIOCollectionFactory) BeginTransactionRecordSetStates() {
 }
 
 // Same as NewMMappedGPIO but part of a MMappedGPIOCollectionFactory
-func (gpiocf *MMappedGPIOCollectionFactory) NewMMappedGPIO(number uint, direction int) (gpio *MMappedGPIOInCollection) {
-	NewSysfsGPIOOrPanic(number, direction).Close()
+func (gpiocf *MMappedGPIOCollectionFactory) NewMMappedGPIO(number uint, direction Direction) (gpio *MMappedGPIOInCollection) {
+	gpio, err := gpiocf.NewMMappedGPIOOrError(number, direction)
+	if err != nil {
+		panic(err)
+	}
+	return gpio
+}
+
+// Same as NewMMappedGPIO, but returns errors instead of panicking, e.g. ErrAlreadyClaimed
+func (gpiocf *MMappedGPIOCollectionFactory) NewMMappedGPIOOrError(number uint, direction Direction) (gpio *MMappedGPIOInCollection, err error) {
 	gpio = new(MMappedGPIOInCollection)
+	if err = gpio.exportAndClaim(number, direction); err != nil {
+		return nil, err
+	}
 	gpio.chipid, gpio.gpioid = calcGPIOAddrFromLinuxGPIONum(number)
 	gpio.collection = gpiocf
-	return gpio
+	return gpio, nil
 }
 
-func (gpiocf *MMappedGPIOCollectionFactory) NewGPIO(number uint, direction int) GPIOControllablePinInCollection {
+func (gpiocf *MMappedGPIOCollectionFactory) NewGPIO(number uint, direction Direction) GPIOControllablePinInCollection {
 	return gpiocf.NewMMappedGPIO(number, direction)
 }
 
@@ -86,7 +97,7 @@ func (gpio *MMappedGPIOInCollection) SetStateNow(state bool) error {
 func (gpio *MMappedGPIOInCollection) SetFutureState(state bool) error {
 	gpio.collection.lock.Lock()
 	defer gpio.collection.lock.Unlock()
-	if gpio.activelow != state {
+	if gpio.inverted() != state {
 		gpio.collection.gpios_to_set[gpio.chipid] |= uint32(1 << gpio.gpioid)
 		gpio.collection.gpios_to_clear[gpio.chipid] &= ^uint32(1 << gpio.gpioid)
 	} else {
@@ -109,7 +120,7 @@ func (gpio *MMappedGPIOInCollection) GetFutureState() (state_known, state bool,
 	if !state_known {
 		state_known = gpio.collection.gpios_to_clear[gpio.chipid]&uint32(1<<gpio.gpioid) > 0
 	}
-	state = state != gpio.activelow
+	state = state != gpio.inverted()
 	return
 }
 
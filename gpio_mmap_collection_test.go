@@ -135,6 +135,9 @@ func Test_MMapGpioFromCollectionVersusSysfsGPIO(t *testing.T) {
 	}
 	// fg := NewMMappedGPIO(67, OUT)
 	// sg := NewSysfsGPIOOrPanic(67, OUT)
+	// a MMappedGPIO and a MMappedGPIOInCollection on the same pin on purpose
+	SetClaimRegistry(false)
+	defer SetClaimRegistry(true)
 	checkSysfsVersusMMapGPIOFromCollection(2, t)
 	checkSysfsVersusMMapGPIOFromCollection(3, t)
 	checkSysfsVersusMMapGPIOFromCollection(4, t)
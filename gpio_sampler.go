@@ -0,0 +1,200 @@
+package bbhw
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Transition of a pin observed by a Sampler.
+// Err is set (and State meaningless) if GetState failed during that tick.
+type PinTransition struct {
+	GPIO  GPIOControllablePin
+	State bool
+	Time  time.Time
+	Err   error
+}
+
+type sampledPin struct {
+	gpio   GPIOControllablePin
+	state  bool
+	events chan PinTransition
+}
+
+// Software polls many pins (e.g. mmapped inputs, which have no edge interrupts) using one shared ticker
+// and one goroutine, instead of one goroutine per pin.
+// Pins can be registered and unregistered while the Sampler is running.
+// The Sampler never blocks on a slow consumer: if a pins event channel is full, the oldest event is dropped.
+type Sampler struct {
+	pins     []*sampledPin
+	clock    Clock
+	ticker   Ticker
+	reset    chan struct{} // the ticker was replaced by SetInterval
+	interval time.Duration
+	stop     chan struct{}
+	stopped  bool
+	lock     sync.Mutex
+}
+
+// Option of NewSampler
+type SamplerOption func(*Sampler)
+
+// ticks on c, e.g. a ManualClock in tests
+func SamplerWithClock(c Clock) SamplerOption {
+	return func(s *Sampler) { s.clock = c }
+}
+
+// Create and start a Sampler visiting all registered pins every interval, which has to be positive
+func NewSampler(interval time.Duration, opts ...SamplerOption) (*Sampler, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("Sampler: interval %v: %w", interval, ErrOutOfRange)
+	}
+	s := &Sampler{interval: interval, stop: make(chan struct{}), reset: make(chan struct{}, 1)}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.clock == nil {
+		s.clock = defaultClock()
+	}
+	s.ticker = s.clock.NewTicker(interval)
+	go s.run()
+	return s, nil
+}
+
+// Wrapper around NewSampler. Does not return an error but panics instead. Useful to avoid multiple return values.
+func NewSamplerOrPanic(interval time.Duration, opts ...SamplerOption) *Sampler {
+	s, err := NewSampler(interval, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func (s *Sampler) run() {
+	for {
+		s.lock.Lock()
+		ticks := s.ticker.C()
+		s.lock.Unlock()
+		select {
+		case <-s.stop:
+			return
+		case <-s.reset:
+		case now := <-ticks:
+			s.sample(now)
+		}
+	}
+}
+
+func (s *Sampler) sample(now time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, p := range s.pins {
+		state, err := p.gpio.GetState()
+		if err != nil {
+			p.deliver(PinTransition{GPIO: p.gpio, Time: now, Err: err})
+			continue
+		}
+		if state != p.state {
+			p.state = state
+			p.deliver(PinTransition{GPIO: p.gpio, State: state, Time: now})
+		}
+	}
+}
+
+// non-blocking send, drops the oldest queued event if the channel is full
+func (p *sampledPin) deliver(ev PinTransition) {
+	for {
+		select {
+		case p.events <- ev:
+			return
+		default:
+		}
+		select {
+		case <-p.events:
+		default:
+		}
+	}
+}
+
+// Register a pin. Returns the channel on which transitions of that pin are delivered.
+// buffersize is the number of events queued before the oldest ones get dropped (minimum 1).
+func (s *Sampler) Register(gpio GPIOControllablePin, buffersize int) (<-chan PinTransition, error) {
+	if gpio == nil {
+		return nil, fmt.Errorf("Sampler: gpio is nil")
+	}
+	if buffersize < 1 {
+		buffersize = 1
+	}
+	state, err := gpio.GetState()
+	if err != nil {
+		return nil, err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stopped {
+		return nil, fmt.Errorf("Sampler already stopped")
+	}
+	for _, p := range s.pins {
+		if p.gpio == gpio {
+			return nil, fmt.Errorf("Sampler: gpio already registered")
+		}
+	}
+	p := &sampledPin{gpio: gpio, state: state, events: make(chan PinTransition, buffersize)}
+	s.pins = append(s.pins, p)
+	return p.events, nil
+}
+
+// Stop sampling a pin and close its event channel
+func (s *Sampler) Unregister(gpio GPIOControllablePin) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for i, p := range s.pins {
+		if p.gpio == gpio {
+			close(p.events)
+			s.pins = append(s.pins[:i], s.pins[i+1:]...)
+			return
+		}
+	}
+}
+
+// Change the sampling interval while running, intervals <= 0 fail with ErrOutOfRange
+func (s *Sampler) SetInterval(interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("Sampler: interval %v: %w", interval, ErrOutOfRange)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stopped {
+		return nil
+	}
+	s.interval = interval
+	s.ticker.Stop()
+	s.ticker = s.clock.NewTicker(interval)
+	select {
+	case s.reset <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (s *Sampler) GetInterval() time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.interval
+}
+
+// Stop the sampler goroutine and close all event channels
+func (s *Sampler) Stop() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stopped {
+		return
+	}
+	s.ticker.Stop()
+	close(s.stop)
+	s.stopped = true
+	for _, p := range s.pins {
+		close(p.events)
+	}
+	s.pins = nil
+}
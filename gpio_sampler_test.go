@@ -0,0 +1,115 @@
+package bbhw
+
+import (
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// number of goroutines started by fn, e.g. "NewSampler", unlike runtime.NumGoroutine not counting those of other tests
+func goroutinesCreatedBy(fn string) int {
+	buf := make([]byte, 1<<20)
+	buf = buf[:runtime.Stack(buf, true)]
+	n := 0
+	for _, line := range strings.Split(string(buf), "\n") {
+		if strings.HasPrefix(line, "created by ") && strings.Contains(line, "bbhw."+fn+" ") {
+			n++
+		}
+	}
+	return n
+}
+
+func Test_SamplerOneGoroutineFor32Pins(t *testing.T) {
+	s := NewSamplerOrPanic(time.Millisecond)
+	defer s.Stop()
+	pins := make([]*FakeGPIO, 32)
+	events := make([]<-chan PinTransition, 32)
+	for i := range pins {
+		pins[i] = NewFakeGPIO(uint(i), IN)
+		var err error
+		if events[i], err = s.Register(pins[i], 4); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := goroutinesCreatedBy("NewSampler"); n != 1 {
+		t.Errorf("Sampler uses %d goroutines for 32 pins, expected 1", n)
+	}
+	for i, p := range pins {
+		if i%2 == 0 {
+			p.FakeInput(true)
+		}
+	}
+	for i := range pins {
+		if i%2 != 0 {
+			continue
+		}
+		select {
+		case ev := <-events[i]:
+			if ev.State != true || ev.GPIO != pins[i] || ev.Err != nil {
+				t.Errorf("pin %d: wrong event %+v", i, ev)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("pin %d: no transition event", i)
+		}
+	}
+	for i := range pins {
+		select {
+		case ev := <-events[i]:
+			t.Errorf("pin %d: unexpected event %+v", i, ev)
+		default:
+		}
+	}
+}
+
+func Test_SamplerDropsOldest(t *testing.T) {
+	s := NewSamplerOrPanic(time.Hour)
+	defer s.Stop()
+	p := NewFakeGPIO(1, IN)
+	ev, _ := s.Register(p, 2)
+	for _, state := range []bool{true, false, true} {
+		p.FakeInput(state)
+		s.sample(time.Now())
+	}
+	if e := <-ev; e.State != false {
+		t.Error("oldest event not dropped")
+	}
+	if e := <-ev; e.State != true {
+		t.Error("newest event missing")
+	}
+	s.Unregister(p)
+	if _, ok := <-ev; ok {
+		t.Error("event channel not closed by Unregister")
+	}
+	s.SetInterval(time.Millisecond)
+	if s.GetInterval() != time.Millisecond {
+		t.Error("SetInterval did not work")
+	}
+	if err := s.SetInterval(0); !errors.Is(err, ErrOutOfRange) || s.GetInterval() != time.Millisecond {
+		t.Errorf("SetInterval(0): %v", err)
+	}
+	if _, err := NewSampler(-time.Millisecond); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("NewSampler(-1ms): %v", err)
+	}
+}
+
+func Test_SamplerWithClock(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	s := NewSamplerOrPanic(10*time.Millisecond, SamplerWithClock(clock))
+	defer s.Stop()
+	p := NewFakeGPIO(1, IN)
+	ev, _ := s.Register(p, 4)
+	p.FakeInput(true)
+	clock.Advance(10 * time.Millisecond)
+	if e := <-ev; e.State != true || !e.Time.Equal(time.Unix(1000, 0).Add(10*time.Millisecond)) {
+		t.Errorf("wrong event %+v", e)
+	}
+	s.SetInterval(20 * time.Millisecond)
+	p.FakeInput(false)
+	clock.Advance(10 * time.Millisecond)
+	clock.Advance(10 * time.Millisecond)
+	if e := <-ev; e.State != false || !e.Time.Equal(time.Unix(1000, 0).Add(30*time.Millisecond)) {
+		t.Errorf("wrong event %+v after SetInterval", e)
+	}
+}
@@ -0,0 +1,57 @@
+package bbhw
+
+import (
+	"fmt"
+	"time"
+)
+
+// One step of a pin sequence: set GPIO to State, then wait SettleDelay before the next step
+type PinStep struct {
+	GPIO        GPIOControllablePin
+	State       bool
+	SettleDelay time.Duration
+}
+
+// Applies steps strictly in order, waiting each steps SettleDelay after its SetState.
+// Aborts on the first error and returns it (annotated with the index of the failed step).
+//
+// Example: raise ENABLE only after DIR and STEP are at defined levels
+//
+//	ApplySequence([]PinStep{{dir, true, 0}, {step, false, time.Millisecond}, {enable, true, 0}})
+func ApplySequence(steps []PinStep) error {
+	return ApplySequenceWithRollback(steps, nil)
+}
+
+// Same as ApplySequence, but runs the rollback sequence if any step fails.
+// The rollback sequence is run to the end even if some of its steps fail.
+// The returned error contains both the original error and any rollback errors.
+func ApplySequenceWithRollback(steps, rollback []PinStep) error {
+	for i, step := range steps {
+		if err := applyPinStep(step); err != nil {
+			err = fmt.Errorf("sequence step %d: %w", i, err)
+			if rollback == nil {
+				return err
+			}
+			for j, rstep := range rollback {
+				if rerr := applyPinStep(rstep); rerr != nil {
+					err = fmt.Errorf("%w (rollback step %d: %v)", err, j, rerr)
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func applyPinStep(step PinStep) error {
+	if step.GPIO == nil {
+		return fmt.Errorf("PinStep without GPIO")
+	}
+	if err := step.GPIO.SetState(step.State); err != nil {
+		return err
+	}
+	if step.SettleDelay > 0 {
+		defaultClock().Sleep(step.SettleDelay)
+	}
+	return nil
+}
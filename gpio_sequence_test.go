@@ -0,0 +1,62 @@
+package bbhw
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// wraps FakeGPIO and records SetState calls in a shared log
+type recordingGPIO struct {
+	*FakeGPIO
+	name string
+	log  *[]string
+	at   *[]time.Time
+	fail error
+}
+
+func (r *recordingGPIO) SetState(state bool) error {
+	if r.fail != nil {
+		return r.fail
+	}
+	*r.log = append(*r.log, fmt.Sprintf("%s=%v", r.name, state))
+	*r.at = append(*r.at, time.Now())
+	return r.FakeGPIO.SetState(state)
+}
+
+func Test_ApplySequence(t *testing.T) {
+	var log []string
+	var at []time.Time
+	dir := &recordingGPIO{NewFakeGPIO(1, OUT), "dir", &log, &at, nil}
+	step := &recordingGPIO{NewFakeGPIO(2, OUT), "step", &log, &at, nil}
+	enable := &recordingGPIO{NewFakeGPIO(3, OUT), "enable", &log, &at, nil}
+	err := ApplySequence([]PinStep{{dir, true, 0}, {step, false, 20 * time.Millisecond}, {enable, true, 0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(log) != "[dir=true step=false enable=true]" {
+		t.Error("wrong order of operations:", log)
+	}
+	if at[2].Sub(at[1]) < 20*time.Millisecond {
+		t.Error("SettleDelay not respected")
+	}
+	if GetStateOrPanic(enable) != true {
+		t.Error("enable not set")
+	}
+}
+
+func Test_ApplySequenceRollback(t *testing.T) {
+	var log []string
+	var at []time.Time
+	failure := errors.New("broken pin")
+	dir := &recordingGPIO{NewFakeGPIO(1, OUT), "dir", &log, &at, nil}
+	enable := &recordingGPIO{NewFakeGPIO(3, OUT), "enable", &log, &at, failure}
+	err := ApplySequenceWithRollback([]PinStep{{dir, true, 0}, {enable, true, 0}, {dir, false, 0}}, []PinStep{{dir, false, 0}})
+	if !errors.Is(err, failure) {
+		t.Fatal("expected step error, got", err)
+	}
+	if fmt.Sprint(log) != "[dir=true dir=false]" {
+		t.Error("sequence not aborted or rollback not run:", log)
+	}
+}
@@ -6,7 +6,11 @@ import (
 	"errors"
 	"fmt"
 	"golang.org/x/sys/unix"
+	"io/ioutil"
 	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Uses the /sys/class/gpio/**/* file-interface provided by the linux kernel.
@@ -14,43 +18,122 @@ import (
 type SysfsGPIO struct {
 	Number uint
 	fd     *os.File
+	cache  sysfsGPIOStateCache
+	logger Logger
+	invert bool // see SetLogicalInvert
+	// releases the claim of the GPIO number, nil if not constructed by NewSysfsGPIO*
+	unclaim func()
+	// configuration set through this SysfsGPIO, re-applied by Reinitialize. Guarded by cache.lock
+	commanded sysfsGPIOOptions
+	// read buffer of getState, a local one escapes to the heap with the race detector
+	buf [16]byte
 }
 
+// last state read or written, used by GetStateCached
+type sysfsGPIOStateCache struct {
+	lock    sync.Mutex
+	valid   bool
+	state   bool
+	time    time.Time
+	changed lastChange
+}
+
+// base directory of the sysfs gpio interface, changed by tests to point to a fake tree
+var sysfs_gpio_base_ = "/sys/class/gpio"
+
+// kernel side of the sysfs interface, emulated by FakeSysfsGPIOTree. Not set on real systems
+type sysfsKernel interface {
+	// error the kernel returns for what was just written to f
+	written(f *os.File) error
+	poll(fds []unix.PollFd, timeout int) (int, error)
+}
+
+type sysfsKernelBox struct{ sysfsKernel }
+
+var sysfs_kernel_ atomic.Value // sysfsKernelBox
+
+// err of a write to f, or the error the emulated kernel returns for it
+func sysfsWritten(f *os.File, err error) error {
+	if err != nil {
+		return err
+	}
+	if k, _ := sysfs_kernel_.Load().(sysfsKernelBox); k.sysfsKernel != nil {
+		return k.written(f)
+	}
+	return nil
+}
+
+func sysfsPoll(fds []unix.PollFd, timeout int) (int, error) {
+	if k, _ := sysfs_kernel_.Load().(sysfsKernelBox); k.sysfsKernel != nil {
+		return k.poll(fds, timeout)
+	}
+	return unix.Poll(fds, timeout)
+}
+
+// Log to l instead of the package Logger, nil reverts to that. See also WithLogger
+func (gpio *SysfsGPIO) SetLogger(l Logger) {
+	gpio.logger = l
+}
+
+func (gpio *SysfsGPIO) log(level int, msg string, kv ...interface{}) {
+	loggerOr(gpio.logger).Log(level, msg, append([]interface{}{"gpio", gpio.Number}, kv...)...)
+}
+
+// nil if err is nil, otherwise err wrapped in a *GPIOError
+func (gpio *SysfsGPIO) wrapErr(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &GPIOError{Number: gpio.Number, Op: op, Err: err}
+}
+
+// path of attribute file of this gpio, or of the gpioN directory itself if attr is empty
+func (gpio *SysfsGPIO) sysfsPath(attr string) string {
+	if attr == "" {
+		return fmt.Sprintf("%s/gpio%d", sysfs_gpio_base_, gpio.Number)
+	}
+	return fmt.Sprintf("%s/gpio%d/%s", sysfs_gpio_base_, gpio.Number, attr)
+}
+
+// Edges reported by edge callbacks, see SetEdge
+type Edge int
+
 // Constants for GPIO edge callbacks through sysfs.
 const (
-	RISING = iota
+	RISING Edge = iota
 	FALLING
 	BOTH
 	NONE
 )
 
+// "rising", "falling", "both" or "none", same as the sysfs edge attribute
+func (e Edge) String() string {
+	switch e {
+	case RISING:
+		return "rising"
+	case FALLING:
+		return "falling"
+	case BOTH:
+		return "both"
+	case NONE:
+		return "none"
+	}
+	return fmt.Sprintf("Edge(%d)", int(e))
+}
+
 // SysFS managed GPIO ------------------------------------
 
 // Instantinate a new GPIO to control through sysfs. Takes GPIO numer (same as in sysfs) and direction bbhw.IN or bbhw.OUT
 //
 // See http://kilobaser.com/blog/2014-07-15-beaglebone-black-gpios#1gpiopin regarding the numbering of GPIO pins.
-func NewSysfsGPIO(number uint, direction int) (gpio *SysfsGPIO, err error) {
-	gpio = new(SysfsGPIO)
-	gpio.Number = number
-
-	if err := gpio.enable_export(); err != nil {
-		return nil, err
-	}
-	err = gpio.SetDirection(direction)
-	if err != nil {
-		return nil, err
-	}
-	//check if file really exists and open for OUT
-	gpio.fd, err = os.OpenFile(fmt.Sprintf("/sys/class/gpio/gpio%d/value", gpio.Number), os.O_RDWR|os.O_SYNC, 0666)
-	if err != nil {
-		return nil, err
-	}
-	return gpio, nil
+// See NewSysfsGPIOWithOptions for more control.
+func NewSysfsGPIO(number uint, direction Direction) (gpio *SysfsGPIO, err error) {
+	return NewSysfsGPIOWithOptions(number, WithDirection(direction))
 }
 
 // Wrapper around NewSysfsGPIO. Does not return an error but panics instead. Useful to avoid multiple return values.
 // This is the function with the same signature as all the other New*GPIO*s
-func NewSysfsGPIOOrPanic(number uint, direction int) (gpio *SysfsGPIO) {
+func NewSysfsGPIOOrPanic(number uint, direction Direction) (gpio *SysfsGPIO) {
 	gpio, err := NewSysfsGPIO(number, direction)
 	if err != nil {
 		panic(err)
@@ -62,36 +145,90 @@ func (gpio *SysfsGPIO) ReOpen() (err error) {
 	if gpio == nil || gpio.fd == nil {
 		return fmt.Errorf("gpio is nil")
 	}
+	gpio.cache.lock.Lock()
+	readonly := gpio.commanded.readonly
+	gpio.cache.lock.Unlock()
 	prevfd := gpio.fd
-	gpio.fd, err = os.OpenFile(gpio.fd.Name(), os.O_RDWR|os.O_SYNC, 0666)
+	gpio.fd, err = os.OpenFile(gpio.fd.Name(), valueFileFlags(readonly), 0666)
 	if err != nil {
-		return
+		gpio.fd = prevfd
+		return gpio.wrapErr("reopen value", err)
 	}
 	prevfd.Close()
+	gpio.log(LOG_INFO, "reopened value file")
+	return nil
+}
+
+// Recovers a GPIO whose gpioN directory vanished, e.g. because of a device tree overlay reload
+// or another process unexporting it, where ReOpen can not help.
+// Exports again, re-applies active_low, direction and edge as set through this SysfsGPIO (or its options),
+// restores the last state set on outputs and reopens the value file.
+// Attributes never set through this SysfsGPIO are left at the kernel defaults.
+func (gpio *SysfsGPIO) Reinitialize() error {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	gpio.cache.lock.Lock()
+	o := gpio.commanded
+	gpio.cache.lock.Unlock()
+	o.attach = false
+	if !o.direction_set || o.direction != OUT {
+		o.state_set = false
+	}
+	if err := gpio.setup(&o); err != nil {
+		return err
+	}
+	gpio.invalidateCache()
+	gpio.log(LOG_INFO, "reinitialized")
 	return nil
 }
 
+// called after reading or writing the value file failed with err, true if the caller should retry.
+// Depending on WithAutoReOpen / WithAutoReinitialize reopens the value file or reinitializes the GPIO.
+func (gpio *SysfsGPIO) recoverValueFile(err error) bool {
+	gpio.cache.lock.Lock()
+	reopen, reinit := gpio.commanded.auto_reopen, gpio.commanded.auto_reinit
+	gpio.cache.lock.Unlock()
+	if !reopen {
+		return false
+	}
+	gpio.log(LOG_WARN, "value file failed, recovering", "err", err)
+	if _, staterr := os.Stat(gpio.sysfsPath("")); staterr == nil && gpio.ReOpen() == nil {
+		return true
+	}
+	if !reinit {
+		return false
+	}
+	if rerr := gpio.Reinitialize(); rerr != nil {
+		gpio.log(LOG_ERROR, "reinitialize failed", "err", rerr)
+		return false
+	}
+	return true
+}
+
 func (gpio *SysfsGPIO) enable_export() error {
 	if gpio == nil {
 		panic("gpio == nil")
 	}
-	_, err := os.Stat(fmt.Sprintf("/sys/class/gpio/gpio%d", gpio.Number))
+	_, err := os.Stat(gpio.sysfsPath(""))
 	if err == nil {
 		// already exported
 		return nil
 	} else if err != nil && !os.IsNotExist(err) {
 		// some other error
-		return err
+		return gpio.wrapErr("export", err)
 	}
-	fd, err := os.OpenFile("/sys/class/gpio/export", os.O_WRONLY|os.O_SYNC, 0666)
+	gpio.log(LOG_DEBUG, "exporting")
+	fd, err := os.OpenFile(sysfs_gpio_base_+"/export", os.O_WRONLY|os.O_SYNC, 0666)
 	if err != nil {
-		return err
+		return gpio.wrapErr("export", err)
 	}
+	defer fd.Close()
 	_, err = fmt.Fprintf(fd, "%d\n", gpio.Number)
-	return err
+	return gpio.wrapErr("export", sysfsWritten(fd, err))
 }
 
-func (gpio *SysfsGPIO) CheckDirection() (direction int, err error) {
+func (gpio *SysfsGPIO) CheckDirection() (direction Direction, err error) {
 	var df *os.File
 	var n int
 	err = nil
@@ -99,9 +236,10 @@ func (gpio *SysfsGPIO) CheckDirection() (direction int, err error) {
 	if gpio == nil {
 		panic("gpio == nil")
 	}
-	filename := fmt.Sprintf("/sys/class/gpio/gpio%d/direction", gpio.Number)
+	filename := gpio.sysfsPath("direction")
 	df, err = os.OpenFile(filename, os.O_RDONLY|os.O_SYNC, 0666)
 	if err != nil {
+		err = gpio.wrapErr("read direction", err)
 		return
 	}
 	defer df.Close()
@@ -109,10 +247,11 @@ func (gpio *SysfsGPIO) CheckDirection() (direction int, err error) {
 	df.Seek(0, 0)
 	n, err = df.Read(buf) //go knows how long our buf is, right ??
 	if err != nil {
+		err = gpio.wrapErr("read direction", err)
 		return
 	}
 	if n == 0 {
-		err = errors.New("wtf ?")
+		err = gpio.wrapErr("read direction", fmt.Errorf("empty file: %w", ErrInvalidAttribute))
 		return
 	}
 	if string(buf)[0:2] == "in" {
@@ -120,7 +259,7 @@ func (gpio *SysfsGPIO) CheckDirection() (direction int, err error) {
 	} else if string(buf)[0:3] == "out" {
 		direction = OUT
 	} else {
-		err = fmt.Errorf("direction '%s' is neither in nor out !!!", buf)
+		err = gpio.wrapErr("read direction", fmt.Errorf("%q is neither in nor out: %w", buf[:n], ErrInvalidAttribute))
 	}
 	return
 }
@@ -133,9 +272,10 @@ func (gpio *SysfsGPIO) GetEdge() (edge string, err error) {
 	if gpio == nil {
 		panic("gpio == nil")
 	}
-	filename := fmt.Sprintf("/sys/class/gpio/gpio%d/edge", gpio.Number)
+	filename := gpio.sysfsPath("edge")
 	df, err = os.OpenFile(filename, os.O_RDONLY|os.O_SYNC, 0666)
 	if err != nil {
+		err = gpio.wrapErr("read edge", err)
 		return
 	}
 	defer df.Close()
@@ -143,40 +283,51 @@ func (gpio *SysfsGPIO) GetEdge() (edge string, err error) {
 	df.Seek(0, 0)
 	n, err = df.Read(buf) //go knows how long our buf is, right ??
 	if err != nil {
+		err = gpio.wrapErr("read edge", err)
 		return
 	}
 	if n == 0 {
-		err = errors.New("Edge file is empty")
+		err = gpio.wrapErr("read edge", fmt.Errorf("empty file: %w", ErrInvalidAttribute))
+		return
 	}
 	if string(buf)[0:4] == "none" {
 		edge = "none"
 	} else if string(buf)[0:4] == "both" {
 		edge = "both"
 	} else if string(buf)[0:6] == "rising" {
-		edge = "rising"
+		edge = invertEdge(RISING, gpio.invert).String()
 	} else if string(buf)[0:7] == "falling" {
-		edge = "falling"
+		edge = invertEdge(FALLING, gpio.invert).String()
 	} else {
-		err = errors.New("Invalid edge state")
+		err = gpio.wrapErr("read edge", fmt.Errorf("%q is no edge: %w", buf[:n], ErrInvalidAttribute))
 	}
 	return
 }
 
-func (gpio *SysfsGPIO) SetDirection(direction int) error {
+func (gpio *SysfsGPIO) SetDirection(direction Direction) error {
 	if gpio == nil {
 		panic("gpio == nil")
 	}
-	df, err := os.OpenFile(fmt.Sprintf("/sys/class/gpio/gpio%d/direction", gpio.Number),
+	if err := validateDirection(direction); err != nil {
+		return gpio.wrapErr("set direction", err)
+	}
+	df, err := os.OpenFile(gpio.sysfsPath("direction"),
 		os.O_WRONLY|os.O_SYNC, 0666)
 	if err != nil {
-		return err
+		return gpio.wrapErr("set direction", err)
 	}
 	defer df.Close()
 	if direction == OUT {
-		fmt.Fprintln(df, "out")
+		_, err = fmt.Fprintln(df, "out")
 	} else {
-		fmt.Fprintln(df, "in")
+		_, err = fmt.Fprintln(df, "in")
+	}
+	err = sysfsWritten(df, err)
+	gpio.invalidateCache()
+	if err != nil {
+		return gpio.wrapErr("set direction", err)
 	}
+	gpio.remember(WithDirection(direction))
 	return nil
 }
 
@@ -185,46 +336,115 @@ func (gpio *SysfsGPIO) SetActiveLow(activelow bool) error {
 	if gpio == nil {
 		panic("gpio == nil")
 	}
-	df, err := os.OpenFile(fmt.Sprintf("/sys/class/gpio/gpio%d/active_low", gpio.Number),
+	df, err := os.OpenFile(gpio.sysfsPath("active_low"),
 		os.O_WRONLY|os.O_SYNC, 0666)
 	if err != nil {
-		return err
+		return gpio.wrapErr("set active_low", err)
 	}
 	defer df.Close()
 	if activelow {
-		fmt.Fprintln(df, "1")
+		_, err = fmt.Fprintln(df, "1")
 	} else {
-		fmt.Fprintln(df, "0")
+		_, err = fmt.Fprintln(df, "0")
+	}
+	err = sysfsWritten(df, err)
+	gpio.invalidateCache()
+	if err != nil {
+		return gpio.wrapErr("set active_low", err)
 	}
+	gpio.remember(WithActiveLow(activelow))
 	return nil
 }
 
-func (gpio *SysfsGPIO) SetEdge(edge int) error {
+// Inverts SetState, GetState and edges in software on top of active_low, see invertEdge.
+// An edge set to RISING or FALLING is swapped in the kernel, so it keeps referring to the logical state.
+// Set it before starting edge callbacks.
+func (gpio *SysfsGPIO) SetLogicalInvert(invert bool) error {
 	if gpio == nil {
 		panic("gpio == nil")
 	}
-	df, err := os.OpenFile(fmt.Sprintf("/sys/class/gpio/gpio%d/edge", gpio.Number),
-		os.O_WRONLY|os.O_SYNC, 0666)
+	if invert == gpio.invert {
+		return nil
+	}
+	edge, err := gpio.GetEdge() // logical, still with the previous inversion
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil // no edge file, nothing to swap
+	} else if err == nil && edge == "rising" {
+		err = gpio.setEdge(RISING, invert)
+	} else if err == nil && edge == "falling" {
+		err = gpio.setEdge(FALLING, invert)
+	}
 	if err != nil {
 		return err
 	}
+	gpio.invert = invert
+	gpio.invalidateCache()
+	return nil
+}
+
+func (gpio *SysfsGPIO) SetEdge(edge Edge) error {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	if edge < RISING || edge > NONE {
+		return errors.New("Edge value invalid")
+	}
+	return gpio.setEdge(edge, gpio.invert)
+}
+
+// writes the logical edge as the kernel sees it with invert, which SetLogicalInvert sets only afterwards
+func (gpio *SysfsGPIO) setEdge(edge Edge, invert bool) error {
+	df, err := os.OpenFile(gpio.sysfsPath("edge"),
+		os.O_WRONLY|os.O_SYNC, 0666)
+	if err != nil {
+		return gpio.wrapErr("set edge", err)
+	}
 	defer df.Close()
-	if edge == RISING {
-		fmt.Fprintln(df, "rising")
-	} else if edge == FALLING {
-		fmt.Fprintln(df, "falling")
+	if kedge := invertEdge(edge, invert); kedge == RISING {
+		_, err = fmt.Fprintln(df, "rising")
+	} else if kedge == FALLING {
+		_, err = fmt.Fprintln(df, "falling")
 	} else if edge == BOTH {
-		fmt.Fprintln(df, "both")
-	} else if edge == NONE {
-		fmt.Fprintln(df, "none")
+		_, err = fmt.Fprintln(df, "both")
 	} else {
-		return errors.New("Edge value invalid")
+		_, err = fmt.Fprintln(df, "none")
 	}
+	if err = sysfsWritten(df, err); err != nil {
+		return gpio.wrapErr("set edge", err)
+	}
+	gpio.remember(WithEdge(edge))
 	return nil
 }
 
+// The sysfs interface provides no way to enable the SoC pull resistors,
+// use a device tree overlay or the cdev backend instead. Always returns ErrNotSupported
+func (gpio *SysfsGPIO) SetBias(bias int) error {
+	return ErrNotSupported
+}
+
+// The sysfs interface has no open-drain / open-source support. Always returns ErrNotSupported
+func (gpio *SysfsGPIO) SetDriveMode(mode int) error {
+	return ErrNotSupported
+}
+
 // Monitor pin using Unix Poll with a specified timeout (negative value for infinite timeout)
 func (gpio *SysfsGPIO) SetEdgeCallback(callback *chan bool, timeout int) error {
+	return gpio.watchEdges(timeout, func() { close(*callback) }, func(state bool) { *callback <- state })
+}
+
+// Same as SetEdgeCallback but delivers EdgeEvents.
+// Time is taken when poll returns, since sysfs does not provide kernel timestamps.
+func (gpio *SysfsGPIO) SetEdgeEventCallback(events chan<- EdgeEvent, timeout int) error {
+	return gpio.watchEdges(timeout, func() { close(events) }, func(state bool) {
+		ev := EdgeEvent{State: state, Edge: FALLING, Time: time.Now()}
+		if state {
+			ev.Edge = RISING
+		}
+		events <- ev
+	})
+}
+
+func (gpio *SysfsGPIO) watchEdges(timeout int, done func(), deliver func(bool)) error {
 	if gpio == nil {
 		panic("gpio == nil")
 	}
@@ -236,14 +456,19 @@ func (gpio *SysfsGPIO) SetEdgeCallback(callback *chan bool, timeout int) error {
 		err = errors.New("Edge value is set to NONE")
 		return err
 	}
+	// Fd() races with Close, it is only taken again after GetState reopened the value file
+	f, fd := gpio.fd, int32(gpio.fd.Fd())
 	go func() {
-		defer close(*callback)
+		defer done()
 
 		for {
 			//First do a dummy read before we poll
 			gpio.GetState()
-			fds := []unix.PollFd{{Fd: int32(gpio.fd.Fd()), Events: unix.POLLPRI}}
-			_, err := unix.Poll(fds, timeout)
+			if gpio.fd != f {
+				f, fd = gpio.fd, int32(gpio.fd.Fd())
+			}
+			fds := []unix.PollFd{{Fd: fd, Events: unix.POLLPRI}}
+			_, err := sysfsPoll(fds, timeout)
 			if err != nil {
 				break
 			}
@@ -251,16 +476,25 @@ func (gpio *SysfsGPIO) SetEdgeCallback(callback *chan bool, timeout int) error {
 			if err != nil {
 				break
 			}
-			*callback <- state
+			deliver(state)
 		}
 	}()
 	return nil
 }
 
+// With WithAutoReOpen or WithAutoReinitialize a failing read is retried once after recovering
 func (gpio *SysfsGPIO) GetState() (state bool, err error) {
 	if gpio == nil {
 		panic("gpio == nil")
 	}
+	state, err = gpio.getState()
+	if err != nil && gpio.recoverValueFile(err) {
+		state, err = gpio.getState()
+	}
+	return
+}
+
+func (gpio *SysfsGPIO) getState() (state bool, err error) {
 	var n int
 	if gpio.fd == nil {
 		panic("gpio.fd == nil")
@@ -270,41 +504,133 @@ func (gpio *SysfsGPIO) GetState() (state bool, err error) {
 	// if err = gpio.ReOpen(); err != nil {
 	// 	return
 	// }
-	buf := make([]byte, 16)
+	buf := gpio.buf[:]
 	n, err = gpio.fd.Read(buf) //go knows how long our buffer is, right ??
 	if err != nil {
+		err = gpio.wrapErr("read value", err)
 		return
 	}
 	if n != 2 {
-		err = errors.New("wtf ?")
+		err = gpio.wrapErr("read value", fmt.Errorf("%q: %w", string(buf[:n]), ErrInvalidAttribute))
 		return
 	}
-	if buf[0] == '1' {
-		state = true
-	} else {
-		state = false
-	}
+	state = (buf[0] == '1') != gpio.invert
+	gpio.updateCache(state)
 	return
 }
 
+// Returns the last state read or written, if it is not older than maxAge.
+// Otherwise reads the state and refreshes the cache. maxAge == 0 always reads.
+// Note that edge callbacks (SetEdgeCallback) keep the cache warm.
+func (gpio *SysfsGPIO) GetStateCached(maxAge time.Duration) (state bool, err error) {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	if maxAge > 0 {
+		gpio.cache.lock.Lock()
+		if gpio.cache.valid && time.Since(gpio.cache.time) <= maxAge {
+			state = gpio.cache.state
+			gpio.cache.lock.Unlock()
+			return state, nil
+		}
+		gpio.cache.lock.Unlock()
+	}
+	return gpio.GetState()
+}
+
+func (gpio *SysfsGPIO) updateCache(state bool) {
+	gpio.cache.lock.Lock()
+	gpio.cache.valid = true
+	gpio.cache.state = state
+	gpio.cache.time = time.Now()
+	gpio.cache.changed.observe(state)
+	gpio.cache.lock.Unlock()
+}
+
+func (gpio *SysfsGPIO) invalidateCache() {
+	gpio.cache.lock.Lock()
+	gpio.cache.valid = false
+	gpio.cache.lock.Unlock()
+}
+
+// preallocated buffers, so SetState does not allocate or format
+var (
+	sysfs_value_high_ = []byte("1\n")
+	sysfs_value_low_  = []byte("0\n")
+)
+
+// With WithAutoReOpen or WithAutoReinitialize a failing write is retried once after recovering
 func (gpio *SysfsGPIO) SetState(state bool) error {
 	if gpio == nil || gpio.fd == nil {
 		panic("gpio == nil")
 	}
-	v := "0"
-	if state {
-		v = "1"
+	v := sysfs_value_low_
+	if state != gpio.invert {
+		v = sysfs_value_high_
+	}
+	gpio.cache.lock.Lock()
+	gpio.commanded.state, gpio.commanded.state_set = state, true
+	gpio.cache.lock.Unlock()
+	_, err := gpio.fd.WriteAt(v, 0)
+	err = sysfsWritten(gpio.fd, err)
+	if err != nil && gpio.recoverValueFile(err) {
+		_, err = gpio.fd.WriteAt(v, 0)
+		err = sysfsWritten(gpio.fd, err)
+	}
+	if err != nil {
+		gpio.invalidateCache()
+		return gpio.wrapErr("write value", err)
 	}
-	gpio.fd.Truncate(0)
-	_, err := fmt.Fprintln(gpio.fd, v)
-	return err
+	gpio.updateCache(state)
+	return nil
 }
 
 func (gpio *SysfsGPIO) SetStateNow(state bool) error { return gpio.SetState(state) }
 
-//closes filedescriptor
+func (gpio *SysfsGPIO) Backend() string { return BACKEND_SYSFS }
+
+func (gpio *SysfsGPIO) Capabilities() GPIOCapabilities {
+	return GPIOCapabilities{ActiveLow: true, Edges: true}
+}
+
+// Reads direction, edge, active_low and the current state.
+// LastChange is the last change seen by GetState, SetState or an edge callback
+func (gpio *SysfsGPIO) Snapshot() PinSnapshot {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	s := PinSnapshot{Number: gpio.Number, Backend: BACKEND_SYSFS, Inverted: gpio.invert}
+	var err error
+	s.Direction, err = gpio.CheckDirection()
+	s.setError(err)
+	s.Edge, _ = gpio.GetEdge() // not every GPIO can generate interrupts and has an edge file
+	s.ActiveLow, err = gpio.getActiveLow()
+	s.setError(err)
+	s.State, err = gpio.GetState()
+	s.setError(err)
+	gpio.cache.lock.Lock()
+	s.LastChange = gpio.cache.changed.time
+	gpio.cache.lock.Unlock()
+	return s
+}
+
+func (gpio *SysfsGPIO) getActiveLow() (bool, error) {
+	buf, err := ioutil.ReadFile(gpio.sysfsPath("active_low"))
+	if err != nil {
+		return false, gpio.wrapErr("read active_low", err)
+	}
+	return len(buf) > 0 && buf[0] == '1', nil
+}
+
+//closes filedescriptor and releases the claim of the GPIO number (see SetClaimRegistry)
 //does NOT unexport gpio, since gpio_mmap_collection and gpio_mmap depend on the gpio remaining exported and the gpiobank activated
 func (gpio *SysfsGPIO) Close() {
+	if gpio.unclaim != nil {
+		gpio.unclaim()
+	}
 	gpio.fd.Close()
 	gpio = nil
 }
+
+var _ EdgeGPIO = (*SysfsGPIO)(nil)
+var _ SysfsCompatibleGPIO = (*SysfsGPIO)(nil)
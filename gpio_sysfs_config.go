@@ -0,0 +1,232 @@
+package bbhw
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// how long RestorePins waits for udev to make freshly exported pins accessible
+var restore_export_wait_ = time.Second
+
+// Serializable configuration of a SysfsGPIO, see SysfsGPIO.Config and RestorePins
+type GPIOConfig struct {
+	Number    uint      `json:"number"`
+	Direction Direction `json:"direction"` // IN or OUT
+	Edge      Edge      `json:"edge"`      // RISING, FALLING, BOTH or NONE
+	ActiveLow bool      `json:"active_low"`
+	Invert    bool      `json:"logical_invert,omitempty"` // see SetLogicalInvert, State and Edge are logical
+	State     bool      `json:"state"`                    // last output state, only used for outputs
+}
+
+// Writes "in" or "out", so saved GPIOConfigs stay readable
+func (d Direction) MarshalJSON() ([]byte, error) {
+	if err := validateDirection(d); err != nil {
+		return nil, err
+	}
+	return json.Marshal(d.String())
+}
+
+// Reads "in" or "out", as well as the plain numbers written before Direction was marshalled as string
+func (d *Direction) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		var n int
+		if json.Unmarshal(data, &n) != nil {
+			return fmt.Errorf("direction %s: %w", data, ErrInvalidDirection)
+		}
+		*d = Direction(n)
+		return validateDirection(*d)
+	}
+	for _, dir := range []Direction{IN, OUT} {
+		if name == dir.String() {
+			*d = dir
+			return nil
+		}
+	}
+	return fmt.Errorf("direction %q is neither in nor out: %w", name, ErrInvalidDirection)
+}
+
+// Writes the name of the sysfs edge attribute, "rising", "falling", "both" or "none"
+func (e Edge) MarshalJSON() ([]byte, error) {
+	if e < RISING || e > NONE {
+		return nil, fmt.Errorf("invalid edge %d", int(e))
+	}
+	return json.Marshal(e.String())
+}
+
+// Reads the names written by MarshalJSON, as well as the plain numbers written before
+func (e *Edge) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		var n int
+		if json.Unmarshal(data, &n) != nil || n < int(RISING) || n > int(NONE) {
+			return fmt.Errorf("invalid edge %s", data)
+		}
+		*e = Edge(n)
+		return nil
+	}
+	for edge := RISING; edge <= NONE; edge++ {
+		if name == edge.String() {
+			*e = edge
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid edge %q", name)
+}
+
+// Current configuration, read from the attribute files. State is the last state written or read if known.
+// Attributes which can not be read keep their defaults (IN, NONE, not active low).
+func (gpio *SysfsGPIO) Config() GPIOConfig {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	cfg := GPIOConfig{Number: gpio.Number, Edge: NONE, Invert: gpio.invert}
+	if dir, err := gpio.CheckDirection(); err == nil {
+		cfg.Direction = dir
+	}
+	if edge, err := gpio.GetEdge(); err == nil {
+		for e := RISING; e <= NONE; e++ {
+			if e.String() == edge {
+				cfg.Edge = e
+			}
+		}
+	}
+	cfg.ActiveLow, _ = gpio.getActiveLow()
+	gpio.cache.lock.Lock()
+	valid := gpio.cache.valid
+	cfg.State = gpio.cache.state
+	gpio.cache.lock.Unlock()
+	if !valid {
+		cfg.State, _ = gpio.GetState()
+	}
+	return cfg
+}
+
+// Re-applies a configuration returned by Config, e.g. after a device tree overlay reload.
+// Outputs are switched on with cfg.State at once, without a glitch. Applying the same configuration again changes nothing.
+func (gpio *SysfsGPIO) ApplyConfig(cfg GPIOConfig) error {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	if cfg.Number != gpio.Number {
+		return fmt.Errorf("config of gpio%d applied to gpio%d", cfg.Number, gpio.Number)
+	}
+	if cfg.Edge < RISING || cfg.Edge > NONE {
+		return fmt.Errorf("gpio%d: invalid edge %d", gpio.Number, cfg.Edge)
+	}
+	if err := gpio.SetLogicalInvert(cfg.Invert); err != nil {
+		return err
+	}
+	if err := gpio.SetActiveLow(cfg.ActiveLow); err != nil {
+		return err
+	}
+	var err error
+	if cfg.Direction == OUT {
+		if err = gpio.setDirectionOutput(cfg.State != cfg.ActiveLow != cfg.Invert); err == nil {
+			gpio.updateCache(cfg.State)
+			gpio.remember(WithInitialState(cfg.State))
+		}
+	} else {
+		err = gpio.SetDirection(IN)
+	}
+	if err != nil {
+		return err
+	}
+	// GPIOs without interrupt have no edge file, fine as long as none is wanted
+	if edge, err := gpio.GetEdge(); (err != nil && cfg.Edge == NONE) || edge == cfg.Edge.String() {
+		return nil
+	}
+	return gpio.SetEdge(cfg.Edge)
+}
+
+// Returned by RestorePins if some pins could not be restored
+type RestorePinsError struct {
+	Errors []error // same index as the configs passed to RestorePins, nil for pins restored fine
+}
+
+func (e *RestorePinsError) Error() string {
+	var msgs []string
+	for _, err := range e.Errors {
+		if err != nil {
+			msgs = append(msgs, err.Error())
+		}
+	}
+	return fmt.Sprintf("restoring %d of %d pins failed: %s", len(msgs), len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// errors.Is and errors.As look at all the per-pin errors
+func (e *RestorePinsError) Unwrap() []error {
+	var errs []error
+	for _, err := range e.Errors {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// pins returned by RestorePins and not closed yet, reconfigured by the next RestorePins instead of claimed again
+var restored_pins_ = struct {
+	lock sync.Mutex
+	pins map[uint]*SysfsGPIO
+}{pins: make(map[uint]*SysfsGPIO)}
+
+// Exports (if necessary) and reconfigures a whole set of pins saved with SysfsGPIO.Config,
+// e.g. after a watchdog restart. Failing pins do not stop the others from being restored:
+// the returned GPIOs (all *SysfsGPIO) have the same index as configs, nil for failed ones,
+// which are listed in the returned *RestorePinsError. Restoring the same configs again is harmless,
+// pins still open from an earlier RestorePins are reconfigured and returned again.
+func RestorePins(configs []GPIOConfig) ([]GPIO, error) {
+	gpios := make([]GPIO, len(configs))
+	errs := make([]error, len(configs))
+	failed := false
+	for i, cfg := range configs {
+		gpio, err := restorePin(cfg)
+		if err != nil {
+			errs[i] = err
+			failed = true
+			continue
+		}
+		gpios[i] = gpio
+	}
+	if failed {
+		return gpios, &RestorePinsError{Errors: errs}
+	}
+	return gpios, nil
+}
+
+func restorePin(cfg GPIOConfig) (*SysfsGPIO, error) {
+	restored_pins_.lock.Lock()
+	gpio := restored_pins_.pins[cfg.Number]
+	restored_pins_.lock.Unlock()
+	if gpio != nil {
+		if err := gpio.ApplyConfig(cfg); err != nil {
+			return nil, err
+		}
+		return gpio, nil
+	}
+	gpio, err := NewSysfsGPIOWithOptions(cfg.Number, WithExportWaitTimeout(restore_export_wait_))
+	if err != nil {
+		return nil, err
+	}
+	if err = gpio.ApplyConfig(cfg); err != nil {
+		gpio.Close()
+		return nil, err
+	}
+	unclaim := gpio.unclaim
+	gpio.unclaim = func() {
+		restored_pins_.lock.Lock()
+		if restored_pins_.pins[cfg.Number] == gpio {
+			delete(restored_pins_.pins, cfg.Number)
+		}
+		restored_pins_.lock.Unlock()
+		unclaim()
+	}
+	restored_pins_.lock.Lock()
+	restored_pins_.pins[cfg.Number] = gpio
+	restored_pins_.lock.Unlock()
+	return gpio, nil
+}
@@ -0,0 +1,159 @@
+package bbhw
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// the kernel reads back "out" after "high" or "low" was written to direction, the fake tree needs help with that
+func settleFakeSysfsDirection(t *testing.T, dir string, number uint) {
+	if d := readSysfsAttr(t, dir, number, "direction"); d == "high" || d == "low" {
+		os.WriteFile(fmt.Sprintf("%s/gpio%d/direction", dir, number), []byte("out\n"), 0644)
+	}
+}
+
+func Test_SysfsGPIOConfigRoundtrip(t *testing.T) {
+	dir := useFakeSysfsGPIOTree(t, 44)
+	gpio, err := NewSysfsGPIOWithOptions(44, WithAttach(), WithActiveLow(true), WithDirection(OUT), WithInitialState(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gpio.Close()
+	settleFakeSysfsDirection(t, dir, 44)
+	gpio.SetState(true)
+	cfg := gpio.Config()
+	if cfg != (GPIOConfig{Number: 44, Direction: OUT, Edge: NONE, ActiveLow: true, State: true}) {
+		t.Errorf("Config() = %+v", cfg)
+	}
+	// overlay reload resets everything
+	for attr, value := range map[string]string{"direction": "in\n", "active_low": "0\n", "edge": "both\n"} {
+		os.WriteFile(dir+"/gpio44/"+attr, []byte(value), 0644)
+	}
+	for i := 0; i < 2; i++ {
+		if err := gpio.ApplyConfig(cfg); err != nil {
+			t.Fatal(err)
+		}
+		// state true of an active low output is the physical level low
+		if got := readSysfsAttr(t, dir, 44, "direction"); got != "low" {
+			t.Errorf("direction = %q", got)
+		}
+		settleFakeSysfsDirection(t, dir, 44)
+		if got := readSysfsAttr(t, dir, 44, "active_low"); got != "1" {
+			t.Errorf("active_low = %q", got)
+		}
+		if got := readSysfsAttr(t, dir, 44, "edge"); got != "none" {
+			t.Errorf("edge = %q", got)
+		}
+	}
+	if err := gpio.ApplyConfig(GPIOConfig{Number: 45}); err == nil {
+		t.Error("config of another pin applied")
+	}
+}
+
+func Test_GPIOConfigJSON(t *testing.T) {
+	cfg := GPIOConfig{Number: 44, Direction: OUT, Edge: FALLING, ActiveLow: true, State: true}
+	buf, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"number":44,"direction":"out","edge":"falling","active_low":true,"state":true}`; string(buf) != want {
+		t.Errorf("marshalled %s, expected %s", buf, want)
+	}
+	var got GPIOConfig
+	if err = json.Unmarshal(buf, &got); err != nil || got != cfg {
+		t.Errorf("unmarshalled %+v, %v", got, err)
+	}
+	// configs saved while Direction and Edge were marshalled as numbers
+	if err = json.Unmarshal([]byte(`{"number":44,"direction":1,"edge":1}`), &got); err != nil || got.Direction != OUT || got.Edge != FALLING {
+		t.Errorf("numeric config unmarshalled to %+v, %v", got, err)
+	}
+	for _, invalid := range []string{`{"direction":"sideways"}`, `{"direction":7}`, `{"edge":"up"}`, `{"edge":9}`} {
+		if err = json.Unmarshal([]byte(invalid), &got); err == nil {
+			t.Errorf("%s accepted", invalid)
+		}
+	}
+	if _, err = json.Marshal(GPIOConfig{Direction: 7}); !errors.Is(err, ErrInvalidDirection) {
+		t.Errorf("invalid direction marshalled: %v", err)
+	}
+}
+
+func Test_RestorePins(t *testing.T) {
+	dir := useFakeSysfsGPIOTree(t, 44, 46)
+	saved := restore_export_wait_
+	restore_export_wait_ = 0
+	t.Cleanup(func() { restore_export_wait_ = saved })
+	configs := []GPIOConfig{
+		{Number: 44, Direction: OUT, Edge: NONE, State: true},
+		{Number: 45, Direction: IN, Edge: BOTH}, // export does nothing in the fake tree
+		{Number: 46, Direction: IN, Edge: RISING},
+	}
+	for i := 0; i < 2; i++ {
+		gpios, err := RestorePins(configs)
+		var rerr *RestorePinsError
+		if !errors.As(err, &rerr) || rerr.Errors[0] != nil || rerr.Errors[1] == nil || rerr.Errors[2] != nil {
+			t.Fatalf("expected only gpio45 to fail, got %v", err)
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Error("per-pin errors are not unwrapped:", err)
+		}
+		if gpios[0] == nil || gpios[1] != nil || gpios[2] == nil {
+			t.Fatalf("unexpected GPIOs %v", gpios)
+		}
+		if got := readSysfsAttr(t, dir, 44, "direction"); got != "high" {
+			t.Errorf("gpio44 direction = %q", got)
+		}
+		settleFakeSysfsDirection(t, dir, 44)
+		for j, gpio := range []GPIO{gpios[0], gpios[2]} {
+			cfg := configs[2*j]
+			if got := gpio.(*SysfsGPIO).Config(); got != cfg {
+				t.Errorf("restored %+v, expected %+v", got, cfg)
+			}
+			gpio.Close()
+		}
+	}
+}
+
+func Test_RestorePinsWhileOpen(t *testing.T) {
+	useFakeSysfsGPIOTree(t, 44, 46)
+	saved := restore_export_wait_
+	restore_export_wait_ = 0
+	t.Cleanup(func() { restore_export_wait_ = saved })
+	configs := []GPIOConfig{{Number: 44, Direction: IN, Edge: NONE}, {Number: 46, Direction: IN, Edge: RISING}}
+	first, err := RestorePins(configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configs[1].Edge = FALLING
+	second, err := RestorePins(configs)
+	if err != nil {
+		t.Fatal("restoring pins still open from the first RestorePins:", err)
+	}
+	if second[0] != first[0] || second[1] != first[1] {
+		t.Error("open pins not reused")
+	}
+	if got := second[1].(*SysfsGPIO).Config(); got != configs[1] {
+		t.Errorf("reused pin not reconfigured: %+v", got)
+	}
+	// somebody else still can not claim them
+	if _, err := NewSysfsGPIOWithOptions(44, WithAttach()); !errors.Is(err, ErrAlreadyClaimed) {
+		t.Error("restored pin not claimed:", err)
+	}
+	for _, gpio := range second {
+		gpio.Close()
+	}
+	third, err := RestorePins(configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, gpio := range third {
+			gpio.Close()
+		}
+	}()
+	if third[0] == first[0] {
+		t.Error("closed pin returned again")
+	}
+}
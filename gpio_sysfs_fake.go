@@ -0,0 +1,395 @@
+package bbhw
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Emulates the kernel side of /sys/class/gpio in a directory, to integration test SysfsGPIO
+// (and the sysfs part of HybridGPIO) without hardware. From NewFakeSysfsGPIOTree until Close all SysfsGPIOs
+// of the process use it. Like the kernel:
+//   - writing a number to export creates gpioN with direction in, value 0, edge none and active_low 0,
+//     unknown numbers fail with EINVAL, exported ones with EBUSY. unexport removes it again.
+//   - writing direction resets value: out and low drive low, high drives high. It then reads out.
+//   - direction and edge only accept their tokens (EINVAL), outputs can not have an edge and vice versa (EIO),
+//     writing value of an input fails with EPERM.
+//   - value files of an unexported gpio are stale, reads return EOF and writes ENODEV.
+//   - InjectInput changes the level of an input and wakes up SetEdgeCallback if the edge matches.
+//
+// Errors are only returned for writes through SysfsGPIO, anything else writing the files directly goes unnoticed.
+type FakeSysfsGPIOTree struct {
+	dir         string
+	lines       map[uint]*fakeSysfsLine
+	any         bool             // lines are created on export
+	polls       map[int32]uint64 // events seen by each polled fd
+	closed      chan struct{}
+	prev_base   string
+	prev_kernel sysfsKernelBox
+	lock        sync.Mutex
+}
+
+type fakeSysfsLine struct {
+	exported  bool
+	output    bool
+	driven    bool // physical level of an output
+	input     bool // physical level injected, seen while an input
+	activelow bool
+	edge      Edge
+	events    uint64        // edges so far, see poll
+	wake      chan struct{} // closed and replaced on every event
+}
+
+// how often a poll waiting for an edge checks whether its fd was closed
+const fake_sysfs_poll_recheck_ = 10 * time.Millisecond
+
+// Creates export and unexport in dir and points the sysfs code of this package there.
+// numbers are the GPIOs the emulated kernel has, none means any.
+func NewFakeSysfsGPIOTree(dir string, numbers ...uint) (*FakeSysfsGPIOTree, error) {
+	for _, name := range []string{"export", "unexport"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			return nil, err
+		}
+	}
+	tree := &FakeSysfsGPIOTree{dir: dir, lines: make(map[uint]*fakeSysfsLine), any: len(numbers) == 0,
+		polls: make(map[int32]uint64), closed: make(chan struct{})}
+	for _, n := range numbers {
+		tree.lines[n] = newFakeSysfsLine()
+	}
+	tree.prev_base = sysfs_gpio_base_
+	tree.prev_kernel, _ = sysfs_kernel_.Load().(sysfsKernelBox)
+	sysfs_gpio_base_ = dir
+	sysfs_kernel_.Store(sysfsKernelBox{tree})
+	return tree, nil
+}
+
+func newFakeSysfsLine() *fakeSysfsLine {
+	return &fakeSysfsLine{edge: NONE, wake: make(chan struct{})}
+}
+
+// Points the sysfs code back to where it was before, edge callbacks still polling end.
+// The directory is left as it is.
+func (tree *FakeSysfsGPIOTree) Close() {
+	tree.lock.Lock()
+	defer tree.lock.Unlock()
+	select {
+	case <-tree.closed:
+		return
+	default:
+	}
+	close(tree.closed)
+	sysfs_gpio_base_ = tree.prev_base
+	sysfs_kernel_.Store(tree.prev_kernel)
+}
+
+// Exports number, as if another process wrote it to export
+func (tree *FakeSysfsGPIOTree) Export(number uint) error {
+	tree.lock.Lock()
+	defer tree.lock.Unlock()
+	return tree.errno(filepath.Join(tree.dir, "export"), tree.export(number))
+}
+
+// Unexports number, as if another process (or a device tree overlay reload) did
+func (tree *FakeSysfsGPIOTree) Unexport(number uint) error {
+	tree.lock.Lock()
+	defer tree.lock.Unlock()
+	return tree.errno(filepath.Join(tree.dir, "unexport"), tree.unexport(number))
+}
+
+// Drives the input number to the physical level, waking up edge callbacks waiting for it.
+// The level is kept while number is an output and seen once it is an input again.
+func (tree *FakeSysfsGPIOTree) InjectInput(number uint, level bool) error {
+	tree.lock.Lock()
+	defer tree.lock.Unlock()
+	line := tree.line(number, true)
+	if line == nil {
+		return fmt.Errorf("FakeSysfsGPIOTree has no gpio %d", number)
+	}
+	before := line.logical()
+	line.input = level
+	if line.output || !line.exported || line.logical() == before {
+		return nil
+	}
+	if now := line.logical(); line.edge == BOTH || line.edge == RISING && now || line.edge == FALLING && !now {
+		line.event()
+	}
+	return tree.sync(number, "value")
+}
+
+// Physical level of number, what an output drives or what was injected into an input
+func (tree *FakeSysfsGPIOTree) Level(number uint) bool {
+	tree.lock.Lock()
+	defer tree.lock.Unlock()
+	if line := tree.line(number, false); line != nil {
+		return line.level()
+	}
+	return false
+}
+
+func (line *fakeSysfsLine) level() bool {
+	if line.output {
+		return line.driven
+	}
+	return line.input
+}
+
+// content of the value file
+func (line *fakeSysfsLine) logical() bool {
+	return line.level() != line.activelow
+}
+
+func (line *fakeSysfsLine) event() {
+	line.events++
+	close(line.wake)
+	line.wake = make(chan struct{})
+}
+
+// line of number, nil if the kernel has no such gpio. create adds it if any number goes
+func (tree *FakeSysfsGPIOTree) line(number uint, create bool) *fakeSysfsLine {
+	line := tree.lines[number]
+	if line == nil && create && tree.any {
+		line = newFakeSysfsLine()
+		tree.lines[number] = line
+	}
+	return line
+}
+
+func (tree *FakeSysfsGPIOTree) gpioDir(number uint) string {
+	return filepath.Join(tree.dir, fmt.Sprintf("gpio%d", number))
+}
+
+func (tree *FakeSysfsGPIOTree) export(number uint) unix.Errno {
+	line := tree.line(number, true)
+	if line == nil {
+		return unix.EINVAL
+	}
+	if line.exported {
+		return unix.EBUSY
+	}
+	if err := os.Mkdir(tree.gpioDir(number), 0755); err != nil && !os.IsExist(err) {
+		return unix.EIO
+	}
+	line.exported = true
+	if tree.sync(number, "direction", "value", "edge", "active_low") != nil {
+		return unix.EIO
+	}
+	return 0
+}
+
+func (tree *FakeSysfsGPIOTree) unexport(number uint) unix.Errno {
+	line := tree.line(number, false)
+	if line == nil || !line.exported {
+		return unix.EINVAL
+	}
+	// open value files read EOF from now on
+	os.Truncate(filepath.Join(tree.gpioDir(number), "value"), 0)
+	os.RemoveAll(tree.gpioDir(number))
+	line.exported, line.activelow, line.edge = false, false, NONE
+	line.event() // kernfs wakes up pollers of removed files
+	return 0
+}
+
+// as returned by a write to path
+func (tree *FakeSysfsGPIOTree) errno(path string, errno unix.Errno) error {
+	if errno == 0 {
+		return nil
+	}
+	return &os.PathError{Op: "write", Path: path, Err: errno}
+}
+
+// rewrites the attribute files of number from the state of the line
+func (tree *FakeSysfsGPIOTree) sync(number uint, attrs ...string) error {
+	line := tree.lines[number]
+	for _, attr := range attrs {
+		path := filepath.Join(tree.gpioDir(number), attr)
+		var content string
+		switch attr {
+		case "direction":
+			content = "in\n"
+			if line.output {
+				content = "out\n"
+			}
+		case "edge":
+			content = line.edge.String() + "\n"
+		case "active_low":
+			content = fmt.Sprintf("%d\n", boolToUint32(line.activelow))
+		case "value":
+			// in place, open value files have to see it
+			f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0644)
+			if err != nil {
+				return err
+			}
+			_, err = f.WriteAt([]byte(fmt.Sprintf("%d\n", boolToUint32(line.logical()))), 0)
+			f.Close()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		// replaced at once, so nobody reads a half written file
+		if err := os.WriteFile(path+".tmp", []byte(content), 0644); err != nil {
+			return err
+		}
+		if err := os.Rename(path+".tmp", path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gpio number and attribute of path, ok is false if it is not an attribute file in the tree
+func (tree *FakeSysfsGPIOTree) attribute(path string) (number uint, attr string, ok bool) {
+	rel, err := filepath.Rel(tree.dir, path)
+	if err != nil {
+		return 0, "", false
+	}
+	parts := strings.Split(rel, string(filepath.Separator))
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "gpio") {
+		return 0, "", false
+	}
+	n, err := strconv.ParseUint(strings.TrimPrefix(parts[0], "gpio"), 10, 32)
+	if err != nil {
+		return 0, "", false
+	}
+	return uint(n), parts[1], true
+}
+
+func (tree *FakeSysfsGPIOTree) written(f *os.File) error {
+	buf, _ := os.ReadFile(f.Name())
+	// files are not truncated by SysfsGPIO, what was written is the first line
+	token := strings.TrimSpace(strings.SplitN(string(buf), "\n", 2)[0])
+	tree.lock.Lock()
+	defer tree.lock.Unlock()
+	select {
+	case <-tree.closed:
+		return nil
+	default:
+	}
+	if rel, _ := filepath.Rel(tree.dir, f.Name()); rel == "export" || rel == "unexport" {
+		os.Truncate(f.Name(), 0)
+		n, err := strconv.ParseUint(token, 10, 32)
+		if err != nil {
+			return tree.errno(f.Name(), unix.EINVAL)
+		}
+		if rel == "export" {
+			return tree.errno(f.Name(), tree.export(uint(n)))
+		}
+		return tree.errno(f.Name(), tree.unexport(uint(n)))
+	}
+	number, attr, ok := tree.attribute(f.Name())
+	if !ok {
+		return nil
+	}
+	line := tree.line(number, false)
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if current, err := os.Stat(f.Name()); line == nil || !line.exported || err != nil || !os.SameFile(fi, current) {
+		f.Truncate(0) // the stale file keeps reading EOF
+		return tree.errno(f.Name(), unix.ENODEV)
+	}
+	errno := line.write(attr, token)
+	if err := tree.sync(number, attr, "value"); err != nil {
+		return err
+	}
+	return tree.errno(f.Name(), errno)
+}
+
+// applies token written to attr, the way gpiolib-sysfs does
+func (line *fakeSysfsLine) write(attr, token string) unix.Errno {
+	switch attr {
+	case "direction":
+		if token != "in" && token != "out" && token != "low" && token != "high" {
+			return unix.EINVAL
+		}
+		if token == "in" {
+			line.output = false
+			return 0
+		}
+		if line.edge != NONE {
+			return unix.EIO
+		}
+		line.output, line.driven = true, token == "high"
+	case "edge":
+		edge, ok := map[string]Edge{"none": NONE, "rising": RISING, "falling": FALLING, "both": BOTH}[token]
+		if !ok {
+			return unix.EINVAL
+		}
+		if line.output && edge != NONE {
+			return unix.EIO
+		}
+		line.edge = edge
+	case "active_low":
+		v, err := strconv.Atoi(token)
+		if err != nil {
+			return unix.EINVAL
+		}
+		line.activelow = v != 0
+	case "value":
+		if !line.output {
+			return unix.EPERM
+		}
+		v, err := strconv.Atoi(token)
+		if err != nil {
+			return unix.EINVAL
+		}
+		line.driven = (v != 0) != line.activelow
+	default:
+		return unix.EACCES
+	}
+	return 0
+}
+
+// Poll of the value file of SysfsGPIO.SetEdgeCallback: ready once an edge happened since the previous poll of the fd
+func (tree *FakeSysfsGPIOTree) poll(fds []unix.PollFd, timeout int) (int, error) {
+	var expired <-chan time.Time
+	if timeout >= 0 {
+		expired = time.After(time.Duration(timeout) * time.Millisecond)
+	}
+	pfd := &fds[0] // SysfsGPIO polls one value file at a time
+	for {
+		tree.lock.Lock()
+		path, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", pfd.Fd))
+		if err != nil {
+			tree.lock.Unlock()
+			pfd.Revents = unix.POLLNVAL
+			return 1, nil
+		}
+		// a removed file shows up as "value (deleted)"
+		number, attr, ok := tree.attribute(path)
+		line := tree.line(number, false)
+		if !ok || attr != "value" || line == nil {
+			tree.lock.Unlock()
+			pfd.Revents = unix.POLLPRI | unix.POLLERR
+			return 1, nil
+		}
+		seen, known := tree.polls[pfd.Fd]
+		if known && line.events > seen {
+			tree.polls[pfd.Fd] = line.events
+			tree.lock.Unlock()
+			pfd.Revents = unix.POLLPRI | unix.POLLERR
+			return 1, nil
+		}
+		tree.polls[pfd.Fd] = line.events
+		wake := line.wake
+		tree.lock.Unlock()
+		select {
+		case <-wake:
+		case <-time.After(fake_sysfs_poll_recheck_):
+		case <-expired:
+			pfd.Revents = 0
+			return 0, nil
+		case <-tree.closed:
+			return 0, unix.EBADF
+		}
+	}
+}
+
+var _ sysfsKernel = (*FakeSysfsGPIOTree)(nil)
@@ -0,0 +1,177 @@
+package bbhw
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func useFakeSysfsKernel(t *testing.T, numbers ...uint) (*FakeSysfsGPIOTree, string) {
+	dir := t.TempDir()
+	tree, err := NewFakeSysfsGPIOTree(dir, numbers...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(tree.Close)
+	useFreshClaimRegistry(t)
+	return tree, dir
+}
+
+func Test_FakeSysfsGPIOTreeExport(t *testing.T) {
+	tree, dir := useFakeSysfsKernel(t, 44, 45)
+	gpio, err := NewSysfsGPIO(45, IN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gpio.Close()
+	for attr, value := range map[string]string{"direction": "in", "value": "0", "edge": "none", "active_low": "0"} {
+		if got := readSysfsAttr(t, dir, 45, attr); got != value {
+			t.Errorf("%s = %q after export, expected %q", attr, got, value)
+		}
+	}
+	if err = tree.Export(45); !errors.Is(err, unix.EBUSY) {
+		t.Errorf("exporting twice: %v", err)
+	}
+	if _, err = NewSysfsGPIO(46, IN); !errors.Is(err, unix.EINVAL) {
+		t.Errorf("exporting unknown gpio46: %v", err)
+	}
+}
+
+func Test_FakeSysfsGPIOTreeDirectionResetsValue(t *testing.T) {
+	tree, dir := useFakeSysfsKernel(t)
+	gpio, err := NewSysfsGPIOWithOptions(44, WithDirection(OUT), WithInitialState(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gpio.Close()
+	if d := readSysfsAttr(t, dir, 44, "direction"); d != "out" || !tree.Level(44) {
+		t.Errorf("direction %q, level %v after WithInitialState(true)", d, tree.Level(44))
+	}
+	if err = gpio.SetDirection(OUT); err != nil {
+		t.Fatal(err)
+	}
+	if state, err := gpio.GetState(); err != nil || state || tree.Level(44) {
+		t.Errorf("GetState() = %v, %v, level %v after writing out", state, err, tree.Level(44))
+	}
+	// active_low inverts the value file, not the level
+	if err = gpio.SetActiveLow(true); err != nil {
+		t.Fatal(err)
+	}
+	if v := readSysfsAttr(t, dir, 44, "value"); v != "1" || tree.Level(44) {
+		t.Errorf("value %q, level %v after SetActiveLow(true)", v, tree.Level(44))
+	}
+	if err = gpio.SetState(true); err != nil || tree.Level(44) {
+		t.Errorf("SetState(true) = %v, level %v on active low output", err, tree.Level(44))
+	}
+}
+
+func Test_FakeSysfsGPIOTreeRejects(t *testing.T) {
+	_, dir := useFakeSysfsKernel(t)
+	in, err := NewSysfsGPIOWithOptions(44, WithDirection(IN), WithEdge(BOTH))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	if err = in.SetState(true); !errors.Is(err, unix.EPERM) {
+		t.Errorf("SetState on input: %v", err)
+	}
+	if err = in.SetDirection(OUT); !errors.Is(err, unix.EIO) {
+		t.Errorf("SetDirection(OUT) with edge both: %v", err)
+	}
+	out, err := NewSysfsGPIO(45, OUT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	if err = out.SetEdge(RISING); !errors.Is(err, unix.EIO) {
+		t.Errorf("SetEdge on output: %v", err)
+	}
+	// SysfsGPIO never writes an invalid token, so write one directly
+	f, err := os.OpenFile(dir+"/gpio45/direction", os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	_, err = f.WriteString("sideways\n")
+	if err = sysfsWritten(f, err); !errors.Is(err, unix.EINVAL) {
+		t.Errorf("writing sideways to direction: %v", err)
+	}
+	if d := readSysfsAttr(t, dir, 45, "direction"); d != "out" {
+		t.Errorf("direction %q after invalid write", d)
+	}
+}
+
+func Test_FakeSysfsGPIOTreeEdgeCallback(t *testing.T) {
+	tree, _ := useFakeSysfsKernel(t)
+	gpio, err := NewSysfsGPIOWithOptions(45, WithDirection(IN), WithActiveLow(true), WithEdge(RISING))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan bool, 4)
+	if err = gpio.SetEdgeCallback(&events, -1); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond) // until it polls
+	// active low: falling level is the rising edge
+	tree.InjectInput(45, true)
+	tree.InjectInput(45, false)
+	select {
+	case state := <-events:
+		if !state {
+			t.Errorf("rising edge delivered %v", state)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no edge delivered")
+	}
+	select {
+	case state := <-events:
+		t.Errorf("unexpected edge %v", state)
+	case <-time.After(50 * time.Millisecond):
+	}
+	gpio.Close()
+	select {
+	case _, ok := <-events:
+		for ok {
+			_, ok = <-events
+		}
+	case <-time.After(time.Second):
+		t.Error("callback not ended by Close")
+	}
+}
+
+func Test_FakeSysfsGPIOTreeRecovery(t *testing.T) {
+	tree, dir := useFakeSysfsKernel(t)
+	plain, err := NewSysfsGPIO(44, OUT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Close()
+	gpio, err := NewSysfsGPIOWithOptions(45, WithDirection(OUT), WithAutoReinitialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gpio.Close()
+	tree.Unexport(44)
+	tree.Unexport(45)
+	if err = plain.VerifyResponsive(); !errors.Is(err, ErrUnexported) {
+		t.Errorf("VerifyResponsive() = %v after unexport", err)
+	}
+	if err = plain.SetState(true); !errors.Is(err, unix.ENODEV) {
+		t.Errorf("SetState on stale value file: %v", err)
+	}
+	if _, err = plain.GetState(); err == nil {
+		t.Error("GetState on stale value file succeeded")
+	}
+	if err = gpio.SetState(true); err != nil {
+		t.Fatal("SetState did not recover:", err)
+	}
+	if d := readSysfsAttr(t, dir, 45, "direction"); d != "out" || !tree.Level(45) {
+		t.Errorf("direction %q, level %v after recovery", d, tree.Level(45))
+	}
+	if err = gpio.VerifyResponsive(); err != nil {
+		t.Error(err)
+	}
+}
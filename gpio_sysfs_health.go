@@ -0,0 +1,99 @@
+package bbhw
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Causes of a failed VerifyResponsive, wrapped in a *GPIOError
+var (
+	ErrUnexported       = errors.New("gpio not exported")
+	ErrPermissionLost   = errors.New("permission lost")
+	ErrReadbackMismatch = errors.New("readback mismatch")
+)
+
+// Self-test that the GPIO is still controllable, without visibly toggling the load.
+// Meant to be called periodically, e.g. by a watchdog which calls Reinitialize if it fails.
+// Outputs get the last state set written again and read back, for inputs the value file is read.
+// Direction and edge are compared with what was set through this SysfsGPIO (if anything),
+// and unless WithReadOnly the direction file must still be writable.
+// Errors wrap ErrUnexported, ErrPermissionLost or ErrReadbackMismatch, except for other I/O errors.
+func (gpio *SysfsGPIO) VerifyResponsive() error {
+	if gpio == nil || gpio.fd == nil {
+		panic("gpio == nil")
+	}
+	if _, err := os.Stat(gpio.sysfsPath("")); err != nil {
+		return gpio.verifyErr("stat", err)
+	}
+	gpio.cache.lock.Lock()
+	o := gpio.commanded
+	gpio.cache.lock.Unlock()
+	if !o.readonly {
+		df, err := os.OpenFile(gpio.sysfsPath("direction"), os.O_WRONLY, 0666)
+		if err != nil {
+			return gpio.verifyErr("open direction", err)
+		}
+		df.Close()
+	}
+	dir, err := gpio.CheckDirection()
+	if err != nil {
+		return gpio.verifyErr("", err)
+	}
+	if o.direction_set && dir != o.direction {
+		return gpio.wrapErr("verify direction", fmt.Errorf("is %v, was set to %v: %w", dir, o.direction, ErrReadbackMismatch))
+	}
+	if dir == IN || o.readonly {
+		if _, err = gpio.getState(); err != nil {
+			return gpio.verifyErr("", err)
+		}
+		if !o.edge_set {
+			return nil
+		}
+		edge, err := gpio.GetEdge()
+		if err != nil {
+			return gpio.verifyErr("", err)
+		}
+		if edge != o.edge.String() {
+			return gpio.wrapErr("verify edge", fmt.Errorf("is %s, was set to %v: %w", edge, o.edge, ErrReadbackMismatch))
+		}
+		return nil
+	}
+	state := o.state
+	if !o.state_set {
+		if state, err = gpio.getState(); err != nil {
+			return gpio.verifyErr("", err)
+		}
+	}
+	v := sysfs_value_low_
+	if state != gpio.invert {
+		v = sysfs_value_high_
+	}
+	_, err = gpio.fd.WriteAt(v, 0)
+	if err = sysfsWritten(gpio.fd, err); err != nil {
+		return gpio.verifyErr("write value", err)
+	}
+	readback, err := gpio.getState()
+	if err != nil {
+		return gpio.verifyErr("", err)
+	}
+	if readback != state {
+		return gpio.wrapErr("verify value", fmt.Errorf("wrote %v, read back %v: %w", state, readback, ErrReadbackMismatch))
+	}
+	return nil
+}
+
+// err as returned by VerifyResponsive: classified as ErrUnexported or ErrPermissionLost if possible.
+// op is taken from err if it already is a *GPIOError
+func (gpio *SysfsGPIO) verifyErr(op string, err error) error {
+	var gerr *GPIOError
+	if errors.As(err, &gerr) {
+		op, err = gerr.Op, gerr.Err
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		err = fmt.Errorf("%w: %w", ErrUnexported, err)
+	} else if errors.Is(err, os.ErrPermission) {
+		err = fmt.Errorf("%w: %w", ErrPermissionLost, err)
+	}
+	return gpio.wrapErr("verify "+op, err)
+}
@@ -0,0 +1,61 @@
+package bbhw
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_SysfsGPIOVerifyResponsive(t *testing.T) {
+	dir := useFakeSysfsGPIOTree(t, 44, 45)
+	out, err := NewSysfsGPIO(44, OUT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	in, err := NewSysfsGPIOWithOptions(45, WithDirection(IN), WithEdge(BOTH))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	out.SetState(true)
+	// another process switched it off behind our back, verifying rewrites the state we set
+	os.WriteFile(filepath.Join(dir, "gpio44", "value"), []byte("0\n"), 0644)
+	if err = out.VerifyResponsive(); err != nil {
+		t.Error("healthy output:", err)
+	}
+	if got := readSysfsAttr(t, dir, 44, "value"); got != "1" {
+		t.Errorf("value %q after VerifyResponsive, expected the state set to be rewritten", got)
+	}
+	if err = in.VerifyResponsive(); err != nil {
+		t.Error("healthy input:", err)
+	}
+	if err = NewFakeGPIO(1, OUT).VerifyResponsive(); err != nil {
+		t.Error("FakeGPIO:", err)
+	}
+
+	var gerr *GPIOError
+	os.WriteFile(filepath.Join(dir, "gpio45", "edge"), []byte("none\n"), 0644)
+	if err = in.VerifyResponsive(); !errors.Is(err, ErrReadbackMismatch) || !errors.As(err, &gerr) || gerr.Op != "verify edge" {
+		t.Errorf("edge changed: %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "gpio44", "direction"), []byte("in\n"), 0644)
+	if err = out.VerifyResponsive(); !errors.Is(err, ErrReadbackMismatch) {
+		t.Errorf("direction changed: %v", err)
+	}
+
+	os.RemoveAll(filepath.Join(dir, "gpio44"))
+	if err = out.VerifyResponsive(); !errors.Is(err, ErrUnexported) || !errors.Is(err, os.ErrNotExist) || !errors.As(err, &gerr) || gerr.Number != 44 {
+		t.Errorf("unexported: %v", err)
+	}
+
+	if os.Geteuid() == 0 {
+		t.Skip("file modes do not restrict root")
+	}
+	os.WriteFile(filepath.Join(dir, "gpio45", "edge"), []byte("both\n"), 0644)
+	os.Chmod(filepath.Join(dir, "gpio45", "direction"), 0444)
+	if err = in.VerifyResponsive(); !errors.Is(err, ErrPermissionLost) || !errors.Is(err, os.ErrPermission) {
+		t.Errorf("direction not writable: %v", err)
+	}
+}
@@ -0,0 +1,314 @@
+package bbhw
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Options for NewSysfsGPIOWithOptions
+type GPIOOption func(*sysfsGPIOOptions) error
+
+type sysfsGPIOOptions struct {
+	direction     Direction
+	direction_set bool
+	state         bool
+	state_set     bool
+	activelow     bool
+	activelow_set bool
+	edge          Edge
+	edge_set      bool
+	export_wait   time.Duration
+	attach        bool
+	readonly      bool
+	pinmux_check  bool
+	logger        Logger
+	invert        bool
+	auto_reopen   bool
+	auto_reinit   bool
+	shared        bool
+	claim_label   string
+}
+
+// Set direction bbhw.IN or bbhw.OUT. Without this option the direction is left as it is.
+func WithDirection(direction Direction) GPIOOption {
+	return func(o *sysfsGPIOOptions) error {
+		if err := validateDirection(direction); err != nil {
+			return err
+		}
+		o.direction, o.direction_set = direction, true
+		return nil
+	}
+}
+
+// Initial state of an output, set glitch-free together with the direction. Needs WithDirection(OUT)
+func WithInitialState(state bool) GPIOOption {
+	return func(o *sysfsGPIOOptions) error {
+		o.state, o.state_set = state, true
+		return nil
+	}
+}
+
+// Set active_low before anything else, so WithInitialState already refers to the inverted logic
+func WithActiveLow(activelow bool) GPIOOption {
+	return func(o *sysfsGPIOOptions) error {
+		o.activelow, o.activelow_set = activelow, true
+		return nil
+	}
+}
+
+// Set edge bbhw.RISING, bbhw.FALLING, bbhw.BOTH or bbhw.NONE, see SetEdgeCallback
+func WithEdge(edge Edge) GPIOOption {
+	return func(o *sysfsGPIOOptions) error {
+		if edge < RISING || edge > NONE {
+			return fmt.Errorf("invalid edge %d", edge)
+		}
+		o.edge, o.edge_set = edge, true
+		return nil
+	}
+}
+
+// After exporting, wait up to timeout for the attribute files to become accessible.
+// Needed for non-root users, as udev changes the permissions only after the gpioN directory appeared.
+func WithExportWaitTimeout(timeout time.Duration) GPIOOption {
+	return func(o *sysfsGPIOOptions) error {
+		o.export_wait = timeout
+		return nil
+	}
+}
+
+// Attach to an already exported GPIO instead of exporting it, fails if the GPIO is not exported
+func WithAttach() GPIOOption {
+	return func(o *sysfsGPIOOptions) error {
+		o.attach = true
+		return nil
+	}
+}
+
+// Open the value file read-only, e.g. to monitor a GPIO owned by another process. SetState will fail.
+func WithReadOnly() GPIOOption {
+	return func(o *sysfsGPIOOptions) error {
+		o.readonly = true
+		return nil
+	}
+}
+
+// Fail with ErrPinNotGPIO unless the header pin of the GPIO is muxed as GPIO (see CheckPinmux),
+// instead of a GPIO which happily accepts SetState but does not move the pin.
+func WithPinmuxCheck() GPIOOption {
+	return func(o *sysfsGPIOOptions) error {
+		o.pinmux_check = true
+		return nil
+	}
+}
+
+// Log to l instead of the package Logger, including the export
+func WithLogger(l Logger) GPIOOption {
+	return func(o *sysfsGPIOOptions) error {
+		o.logger = l
+		return nil
+	}
+}
+
+// Allow this GPIO to be used by several SysfsGPIOs (or MMappedGPIOs) of this process, see SetClaimRegistry
+func WithSharedOK() GPIOOption {
+	return func(o *sysfsGPIOOptions) error {
+		o.shared = true
+		return nil
+	}
+}
+
+// Label reported by ErrAlreadyClaimed if somebody else tries to use the GPIO.
+// Defaults to file:line of the constructor call.
+func WithClaimLabel(label string) GPIOOption {
+	return func(o *sysfsGPIOOptions) error {
+		o.claim_label = label
+		return nil
+	}
+}
+
+// Invert the logical state in software, see SysfsGPIO.SetLogicalInvert. Applied before everything else
+func WithLogicalInvert(invert bool) GPIOOption {
+	return func(o *sysfsGPIOOptions) error {
+		o.invert = invert
+		return nil
+	}
+}
+
+// If reading or writing the value file fails, ReOpen it and retry once, see SysfsGPIO.GetState and SetState
+func WithAutoReOpen() GPIOOption {
+	return func(o *sysfsGPIOOptions) error {
+		o.auto_reopen = true
+		return nil
+	}
+}
+
+// Same as WithAutoReOpen, but if the value file can not be reopened because the gpioN directory is gone
+// (e.g. unexported by another process), escalate to Reinitialize
+func WithAutoReinitialize() GPIOOption {
+	return func(o *sysfsGPIOOptions) error {
+		o.auto_reopen, o.auto_reinit = true, true
+		return nil
+	}
+}
+
+// Instantinate a new GPIO to control through sysfs. Takes GPIO numer (same as in sysfs) and any number of options.
+// Regardless of their order, options are applied in this order:
+// WithPinmuxCheck, claiming the GPIO (see SetClaimRegistry), export (unless WithAttach), wait for the attribute files (WithExportWaitTimeout), WithActiveLow,
+// WithDirection together with WithInitialState, WithEdge and finally opening the value file (WithReadOnly).
+func NewSysfsGPIOWithOptions(number uint, opts ...GPIOOption) (gpio *SysfsGPIO, err error) {
+	var o sysfsGPIOOptions
+	for _, opt := range opts {
+		if err = opt(&o); err != nil {
+			return nil, err
+		}
+	}
+	if o.state_set && !(o.direction_set && o.direction == OUT) {
+		return nil, fmt.Errorf("WithInitialState needs WithDirection(OUT)")
+	}
+	if o.pinmux_check {
+		if err = checkPinmuxIsGPIO(number); err != nil {
+			return nil, err
+		}
+	}
+	unclaim, err := claimPin(gpioClaimName(number), o.claim_label, o.shared)
+	if err != nil {
+		return nil, err
+	}
+	gpio = new(SysfsGPIO)
+	gpio.Number = number
+	gpio.logger = o.logger
+	gpio.invert = o.invert
+	gpio.unclaim = unclaim
+	if err = gpio.setup(&o); err != nil {
+		unclaim()
+		return nil, err
+	}
+	return gpio, nil
+}
+
+// exports, configures and opens the value file as given by o, shared by NewSysfsGPIOWithOptions and Reinitialize.
+// gpio.fd is only replaced on success.
+func (gpio *SysfsGPIO) setup(o *sysfsGPIOOptions) (err error) {
+	if o.attach {
+		if _, err = os.Stat(gpio.sysfsPath("")); err != nil {
+			return gpio.wrapErr("attach", err)
+		}
+	} else if err = gpio.enable_export(); err != nil {
+		return err
+	}
+	if err = gpio.waitForAttributes(o.export_wait, o.readonly); err != nil {
+		return err
+	}
+	if o.activelow_set {
+		if err = gpio.SetActiveLow(o.activelow); err != nil {
+			return err
+		}
+	}
+	if o.direction_set {
+		if o.state_set {
+			err = gpio.setDirectionOutput(o.state != o.activelow != gpio.invert)
+		} else {
+			err = gpio.SetDirection(o.direction)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if o.edge_set {
+		if err = gpio.SetEdge(o.edge); err != nil {
+			return err
+		}
+	}
+	//check if file really exists and open for OUT
+	fd, err := os.OpenFile(gpio.sysfsPath("value"), valueFileFlags(o.readonly), 0666)
+	if err != nil {
+		return gpio.wrapErr("open value", err)
+	}
+	prevfd := gpio.fd
+	gpio.fd = fd
+	if prevfd != nil {
+		prevfd.Close()
+	}
+	gpio.cache.lock.Lock()
+	gpio.commanded = *o
+	gpio.cache.lock.Unlock()
+	return nil
+}
+
+func valueFileFlags(readonly bool) int {
+	if readonly {
+		return os.O_RDONLY | os.O_SYNC
+	}
+	return os.O_RDWR | os.O_SYNC
+}
+
+// remember opt as commanded, so Reinitialize re-applies it
+func (gpio *SysfsGPIO) remember(opt GPIOOption) {
+	gpio.cache.lock.Lock()
+	opt(&gpio.commanded)
+	gpio.cache.lock.Unlock()
+}
+
+// retries until direction (or value if readonly) can be opened for writing, or timeout passed
+func (gpio *SysfsGPIO) waitForAttributes(timeout time.Duration, readonly bool) error {
+	attr, flags := "direction", os.O_WRONLY
+	if readonly {
+		attr, flags = "value", os.O_RDONLY
+	}
+	start := time.Now()
+	deadline := start.Add(timeout)
+	for retries := 0; ; retries++ {
+		f, err := os.OpenFile(gpio.sysfsPath(attr), flags, 0666)
+		if err == nil {
+			f.Close()
+			if retries > 0 {
+				gpio.log(LOG_DEBUG, "attributes accessible", "attr", attr, "retries", retries, "waited", time.Since(start))
+			}
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			if timeout == 0 {
+				return nil // not waiting, the next step reports the error
+			}
+			return gpio.wrapErr(fmt.Sprintf("wait %v for %s", timeout, attr), err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// switches to output with the given physical level at once, avoiding a glitch
+func (gpio *SysfsGPIO) setDirectionOutput(high bool) error {
+	df, err := os.OpenFile(gpio.sysfsPath("direction"), os.O_WRONLY|os.O_SYNC, 0666)
+	if err != nil {
+		return gpio.wrapErr("set direction", err)
+	}
+	defer df.Close()
+	if high {
+		_, err = fmt.Fprintln(df, "high")
+	} else {
+		_, err = fmt.Fprintln(df, "low")
+	}
+	err = sysfsWritten(df, err)
+	gpio.invalidateCache()
+	if err != nil {
+		return gpio.wrapErr("set direction", err)
+	}
+	gpio.remember(WithDirection(OUT))
+	return nil
+}
+
+func checkPinmuxIsGPIO(number uint) error {
+	pin, err := PinForGPIO(number)
+	if err != nil {
+		return err
+	}
+	info, err := CheckPinmux(pin)
+	if err != nil {
+		return err
+	}
+	if !info.IsGPIO {
+		return fmt.Errorf("%s (gpio%d) is %s, try config-pin %s gpio: %w", pin, number, info.describe(), pin, ErrPinNotGPIO)
+	}
+	return nil
+}
@@ -0,0 +1,339 @@
+package bbhw
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_SysfsGPIOGetStateCached(t *testing.T) {
+	gpio := newTempfileSysfsGPIO(t)
+	if err := gpio.SetState(true); err != nil {
+		t.Fatal(err)
+	}
+	// change value behind the back of the cache
+	gpio.fd.WriteAt([]byte("0\n"), 0)
+	if state, _ := gpio.GetStateCached(time.Hour); state != true {
+		t.Error("GetStateCached did not return state written by SetState")
+	}
+	if state, _ := gpio.GetStateCached(0); state != false {
+		t.Error("GetStateCached(0) did not read fresh value")
+	}
+	gpio.fd.WriteAt([]byte("1\n"), 0)
+	time.Sleep(2 * time.Millisecond)
+	if state, _ := gpio.GetStateCached(time.Millisecond); state != true {
+		t.Error("GetStateCached did not refresh expired value")
+	}
+}
+
+func Test_SysfsGPIOSetBiasNotSupported(t *testing.T) {
+	gpio := newTempfileSysfsGPIO(t)
+	if err := gpio.SetBias(PULLUP); err != ErrNotSupported {
+		t.Error("SetBias on sysfs should return ErrNotSupported, got", err)
+	}
+}
+
+func readSysfsAttr(t *testing.T, dir string, number uint, attr string) string {
+	b, err := ioutil.ReadFile(filepath.Join(dir, fmt.Sprintf("gpio%d", number), attr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func Test_SysfsGPIOWithOptions(t *testing.T) {
+	dir := useFakeSysfsGPIOTree(t, 20, 21, 22, 23)
+
+	gpio, err := NewSysfsGPIOWithOptions(20, WithDirection(OUT))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gpio.Close()
+	if readSysfsAttr(t, dir, 20, "direction") != "out" {
+		t.Error("WithDirection(OUT) not applied")
+	}
+
+	// active low is applied first, the initial state is logical
+	gpio, err = NewSysfsGPIOWithOptions(21, WithInitialState(true), WithDirection(OUT), WithActiveLow(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gpio.Close()
+	if readSysfsAttr(t, dir, 21, "active_low") != "1" || readSysfsAttr(t, dir, 21, "direction") != "low" {
+		t.Error("WithActiveLow/WithInitialState not applied glitch-free")
+	}
+	if _, err := NewSysfsGPIOWithOptions(21, WithInitialState(true)); err == nil {
+		t.Error("WithInitialState accepted without WithDirection(OUT)")
+	}
+
+	gpio, err = NewSysfsGPIOWithOptions(22, WithDirection(IN), WithEdge(FALLING))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gpio.Close()
+	if readSysfsAttr(t, dir, 22, "edge") != "falling" {
+		t.Error("WithEdge not applied")
+	}
+	if _, err := NewSysfsGPIOWithOptions(22, WithEdge(7)); err == nil {
+		t.Error("WithEdge accepted invalid edge")
+	}
+
+	gpio, err = NewSysfsGPIOWithOptions(23, WithReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gpio.SetState(true); err == nil {
+		t.Error("SetState succeeded with WithReadOnly")
+	}
+	gpio.Close()
+	if readSysfsAttr(t, dir, 23, "direction") != "in" {
+		t.Error("direction changed without WithDirection")
+	}
+}
+
+func Test_SysfsGPIOWithAttach(t *testing.T) {
+	useFakeSysfsGPIOTree(t, 30)
+	gpio, err := NewSysfsGPIOWithOptions(30, WithAttach())
+	if err != nil {
+		t.Fatal(err)
+	}
+	gpio.Close()
+	if _, err := NewSysfsGPIOWithOptions(31, WithAttach()); !errors.Is(err, os.ErrNotExist) {
+		t.Error("attaching to a not exported gpio did not fail with ErrNotExist:", err)
+	}
+}
+
+func Test_SysfsGPIOWithExportWaitTimeout(t *testing.T) {
+	dir := useFakeSysfsGPIOTree(t)
+	// like udev, make the attributes appear some time after the export
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		gdir := filepath.Join(dir, "gpio40")
+		os.Mkdir(gdir, 0755)
+		ioutil.WriteFile(filepath.Join(gdir, "value"), []byte("0\n"), 0644)
+		ioutil.WriteFile(filepath.Join(gdir, "direction"), []byte("in\n"), 0644)
+	}()
+	if _, err := NewSysfsGPIOWithOptions(40, WithAttach(), WithExportWaitTimeout(time.Second)); err == nil {
+		t.Error("WithAttach did not fail before the gpio appeared")
+	}
+	gpio, err := NewSysfsGPIOWithOptions(40, WithDirection(OUT), WithExportWaitTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gpio.Close()
+	if _, err := NewSysfsGPIOWithOptions(41, WithExportWaitTimeout(20*time.Millisecond)); err == nil {
+		t.Error("WithExportWaitTimeout did not time out")
+	}
+}
+
+// unexports number in the fake tree by removing its gpioN directory. Like the kernel, writing number
+// to export afterwards recreates the directory with the default attributes.
+func unexportFakeSysfsGPIO(t *testing.T, dir string, number uint) {
+	gdir := filepath.Join(dir, fmt.Sprintf("gpio%d", number))
+	if err := os.RemoveAll(gdir); err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "export"), nil, 0644)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	t.Cleanup(func() { close(stop); <-done })
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(5 * time.Millisecond):
+			}
+			if b, _ := ioutil.ReadFile(filepath.Join(dir, "export")); strings.TrimSpace(string(b)) == fmt.Sprint(number) {
+				os.Mkdir(gdir, 0755)
+				for attr, value := range map[string]string{"value": "0\n", "edge": "none\n", "active_low": "0\n", "direction": "in\n"} {
+					ioutil.WriteFile(filepath.Join(gdir, attr), []byte(value), 0644)
+				}
+				return
+			}
+		}
+	}()
+}
+
+func Test_SysfsGPIOReinitialize(t *testing.T) {
+	dir := useFakeSysfsGPIOTree(t, 44, 45)
+	out, err := NewSysfsGPIOWithOptions(44, WithActiveLow(true), WithDirection(OUT), WithExportWaitTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	in, err := NewSysfsGPIOWithOptions(45, WithExportWaitTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	if err = in.SetEdge(BOTH); err != nil {
+		t.Fatal(err)
+	}
+	if err = out.SetState(true); err != nil {
+		t.Fatal(err)
+	}
+
+	unexportFakeSysfsGPIO(t, dir, 44)
+	unexportFakeSysfsGPIO(t, dir, 45)
+	if err = out.ReOpen(); err == nil {
+		t.Error("ReOpen succeeded without gpio44 directory")
+	}
+	if err = out.Reinitialize(); err != nil {
+		t.Fatal(err)
+	}
+	if err = in.Reinitialize(); err != nil {
+		t.Fatal(err)
+	}
+	// logical true on an active low output is driving low
+	if got := readSysfsAttr(t, dir, 44, "active_low"); got != "1" {
+		t.Errorf("active_low %q after Reinitialize", got)
+	}
+	if got := readSysfsAttr(t, dir, 44, "direction"); got != "low" {
+		t.Errorf("direction %q after Reinitialize, expected output driving low", got)
+	}
+	if got := readSysfsAttr(t, dir, 45, "edge"); got != "both" {
+		t.Errorf("edge %q after Reinitialize", got)
+	}
+	if got := readSysfsAttr(t, dir, 45, "direction"); got != "in" {
+		t.Errorf("direction of input %q after Reinitialize", got)
+	}
+	// the value file is the new one
+	if err = out.SetState(true); err != nil {
+		t.Fatal(err)
+	}
+	if got := readSysfsAttr(t, dir, 44, "value"); got != "1" {
+		t.Errorf("value %q after SetState on reinitialized gpio", got)
+	}
+}
+
+func Test_SysfsGPIOAutoReinitialize(t *testing.T) {
+	dir := useFakeSysfsGPIOTree(t, 44)
+	plain, err := NewSysfsGPIO(44, OUT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gpio, err := NewSysfsGPIOWithOptions(44, WithDirection(OUT), WithInitialState(true), WithAutoReinitialize(), WithExportWaitTimeout(time.Second), WithSharedOK())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gpio.Close()
+	unexportFakeSysfsGPIO(t, dir, 44)
+	// a stale value file of an unexported gpio fails with ENODEV, a closed one will do
+	plain.fd.Close()
+	gpio.fd.Close()
+	if err = plain.SetState(false); err == nil {
+		t.Error("SetState on stale fd succeeded without WithAutoReinitialize")
+	}
+	if _, err = os.Stat(filepath.Join(dir, "gpio44")); err == nil {
+		t.Fatal("gpio44 reappeared without export")
+	}
+	if err = gpio.SetState(false); err != nil {
+		t.Fatal("SetState did not recover:", err)
+	}
+	// restored as output with the state which failed to be set
+	if got := readSysfsAttr(t, dir, 44, "direction"); got != "low" {
+		t.Errorf("direction %q after recovery, expected output driving low", got)
+	}
+	if got := readSysfsAttr(t, dir, 44, "value"); got != "0" {
+		t.Errorf("value %q after recovered SetState(false)", got)
+	}
+	gpio.fd.Close()
+	if state, err := gpio.GetState(); err != nil || state {
+		t.Errorf("GetState() = %v, %v after ReOpen", state, err)
+	}
+}
+
+func Test_SysfsGPIOErrorsWrapOSErrors(t *testing.T) {
+	dir := useFakeSysfsGPIOTree(t, 44, 45)
+	var gerr *GPIOError
+
+	_, err := NewSysfsGPIOWithOptions(50, WithAttach())
+	if !errors.Is(err, os.ErrNotExist) || !errors.As(err, &gerr) || gerr.Number != 50 || gerr.Op != "attach" {
+		t.Errorf("not exported gpio: %v", err)
+	}
+	// the fake export file does not create gpio51
+	_, err = NewSysfsGPIO(51, OUT)
+	if !errors.Is(err, os.ErrNotExist) || !errors.As(err, &gerr) || gerr.Number != 51 {
+		t.Errorf("export without gpio dir appearing: %v", err)
+	}
+
+	os.WriteFile(filepath.Join(dir, "gpio45", "direction"), []byte("sideways\n"), 0644)
+	gpio, err := NewSysfsGPIOWithOptions(45, WithAttach())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gpio.Close()
+	if _, err = gpio.CheckDirection(); !errors.Is(err, ErrInvalidAttribute) || !errors.As(err, &gerr) || gerr.Op != "read direction" {
+		t.Errorf("garbage direction: %v", err)
+	}
+
+	if os.Geteuid() == 0 {
+		t.Skip("file modes do not restrict root")
+	}
+	os.Chmod(filepath.Join(dir, "gpio44", "value"), 0444)
+	os.Chmod(filepath.Join(dir, "gpio44", "direction"), 0444)
+	_, err = NewSysfsGPIOWithOptions(44, WithAttach())
+	if !errors.Is(err, os.ErrPermission) || !errors.As(err, &gerr) || gerr.Number != 44 || gerr.Op != "open value" {
+		t.Errorf("read-only value: %v", err)
+	}
+	gpio, err = NewSysfsGPIOWithOptions(44, WithAttach(), WithReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gpio.Close()
+	if err = gpio.SetDirection(OUT); !errors.Is(err, os.ErrPermission) || !errors.As(err, &gerr) || gerr.Op != "set direction" {
+		t.Errorf("read-only direction: %v", err)
+	}
+}
+
+func Test_DirectionAndEdgeString(t *testing.T) {
+	for _, c := range []struct {
+		got, want string
+	}{
+		{IN.String(), "in"},
+		{OUT.String(), "out"},
+		{Direction(3).String(), "Direction(3)"},
+		{RISING.String(), "rising"},
+		{FALLING.String(), "falling"},
+		{BOTH.String(), "both"},
+		{NONE.String(), "none"},
+		{Edge(7).String(), "Edge(7)"},
+		{fmt.Sprint(OUT), "out"},
+	} {
+		if c.got != c.want {
+			t.Errorf("got %q, want %q", c.got, c.want)
+		}
+	}
+}
+
+func Test_SysfsGPIOLogicalInvertEdgeErrors(t *testing.T) {
+	dir := useFakeSysfsGPIOTree(t, 46)
+	gpio, err := NewSysfsGPIOWithOptions(46, WithDirection(IN))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gpio.Close()
+	// without an edge file there is nothing to swap
+	os.Remove(filepath.Join(dir, "gpio46", "edge"))
+	if err = gpio.SetLogicalInvert(true); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ := gpio.GetState(); !state {
+		t.Error("low input not read as true when inverted")
+	}
+	// an edge file which cannot be parsed keeps the inversion
+	ioutil.WriteFile(filepath.Join(dir, "gpio46", "edge"), []byte("sideways\n"), 0644)
+	if err = gpio.SetLogicalInvert(false); !errors.Is(err, ErrInvalidAttribute) {
+		t.Errorf("SetLogicalInvert(false) with an invalid edge file: %v", err)
+	}
+	if state, _ := gpio.GetState(); !state {
+		t.Error("inversion dropped although the edge could not be swapped")
+	}
+}
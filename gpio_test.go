@@ -244,6 +244,8 @@ func Test_FakeGPIO(t *testing.T) {
 	f2 := NewFakeGPIO(2, IN)
 	//next line should not generate output
 	f2.FakeInput(false)
+	prev := FakeGPIODefaultLogTarget_
+	t.Cleanup(func() { FakeGPIODefaultLogTarget_ = prev })
 	FakeGPIODefaultLogTarget_ = logger
 	//now this should write output
 	f2.FakeInput(true)
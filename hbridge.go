@@ -0,0 +1,211 @@
+package bbhw
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// What a HBridge does with the motor
+type HBridgeState int
+
+const (
+	HBRIDGE_COAST   HBridgeState = iota // all off, the motor runs down freely
+	HBRIDGE_FORWARD                     // side A high, side B low
+	HBRIDGE_REVERSE                     // side B high, side A low
+	HBRIDGE_BRAKE                       // both motor terminals low, shorting the motor
+)
+
+func (s HBridgeState) String() string {
+	switch s {
+	case HBRIDGE_COAST:
+		return "coast"
+	case HBRIDGE_FORWARD:
+		return "forward"
+	case HBRIDGE_REVERSE:
+		return "reverse"
+	case HBRIDGE_BRAKE:
+		return "brake"
+	default:
+		return fmt.Sprintf("HBridgeState(%d)", int(s))
+	}
+}
+
+// Option of NewHBridge and NewDiscreteHBridge
+type HBridgeOption func(*HBridge)
+
+// how long all drives stay off before one of them turns on again after another turned off, default 1ms.
+// Covers the switching times of the transistors and lets the current of the motor decay before reversing.
+func HBridgeWithDeadTime(d time.Duration) HBridgeOption {
+	return func(h *HBridge) { h.deadtime = d }
+}
+
+// Enable input of the driver (e.g. ENA of a L298N) as PWM with the given period, its duty sets the speed.
+// Disabled to coast, full on to brake.
+func HBridgeWithPWM(pwm PWMPin, period time.Duration) HBridgeOption {
+	return func(h *HBridge) { h.pwm, h.period = pwm, period }
+}
+
+// times the dead-time on c
+func HBridgeWithClock(c Clock) HBridgeOption {
+	return func(h *HBridge) { h.clock = c }
+}
+
+// DC motor on a H-bridge, which must never drive both transistors of one side at once (shoot-through).
+// Turns drives off before it turns others on, with at least the dead-time in between, whatever the sequence of calls.
+// A SetState error leaves all drives off (as far as the GPIOs still work) and the bridge coasting.
+type HBridge struct {
+	drives   []GPIOControllablePin
+	levels   [4][]bool // by HBridgeState
+	pwm      PWMPin
+	period   time.Duration
+	deadtime time.Duration
+	clock    Clock
+	lock     sync.Mutex // guards everything below
+	on       []bool     // levels of drives
+	off      time.Time  // when the last drive turned off
+	state    HBridgeState
+}
+
+// Bridge with one input per side, high driving the side high and low pulling it low, both high is never driven.
+// Brake needs HBridgeWithPWM. Both pins have to be outputs, they are driven low.
+func NewHBridge(a, b GPIOControllablePin, opts ...HBridgeOption) (*HBridge, error) {
+	return newHBridge([]GPIOControllablePin{a, b}, [4][]bool{
+		HBRIDGE_COAST:   {false, false},
+		HBRIDGE_FORWARD: {true, false},
+		HBRIDGE_REVERSE: {false, true},
+		HBRIDGE_BRAKE:   {false, false},
+	}, opts)
+}
+
+// Bridge of four transistors driven directly, high switching them on: highA and lowA must never be on at once,
+// neither highB and lowB. Brakes on both low sides. All pins have to be outputs, they are driven low.
+func NewDiscreteHBridge(highA, lowA, highB, lowB GPIOControllablePin, opts ...HBridgeOption) (*HBridge, error) {
+	return newHBridge([]GPIOControllablePin{highA, lowA, highB, lowB}, [4][]bool{
+		HBRIDGE_COAST:   {false, false, false, false},
+		HBRIDGE_FORWARD: {true, false, false, true},
+		HBRIDGE_REVERSE: {false, true, true, false},
+		HBRIDGE_BRAKE:   {false, true, false, true},
+	}, opts)
+}
+
+func newHBridge(drives []GPIOControllablePin, levels [4][]bool, opts []HBridgeOption) (*HBridge, error) {
+	for _, pin := range drives {
+		if pin == nil {
+			panic("gpio == nil")
+		}
+	}
+	h := &HBridge{drives: drives, levels: levels, deadtime: time.Millisecond, on: make([]bool, len(drives))}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.clock == nil {
+		h.clock = defaultClock()
+	}
+	if h.deadtime < 0 || (h.pwm != nil && h.period <= 0) {
+		return nil, fmt.Errorf("HBridge: invalid dead-time %v or PWM period %v", h.deadtime, h.period)
+	}
+	for _, pin := range drives {
+		if err := checkOutput(pin, "HBridge"); err != nil {
+			return nil, err
+		}
+	}
+	if h.pwm != nil {
+		h.pwm.DisablePWM()
+	}
+	for _, pin := range drives {
+		if err := pin.SetState(false); err != nil {
+			h.safe()
+			return nil, err
+		}
+	}
+	h.off = h.clock.Now()
+	return h, nil
+}
+
+// Drives the motor forward at speed between 0.0 and 1.0, only 1.0 without HBridgeWithPWM
+func (h *HBridge) Forward(speed float64) error {
+	return h.set(HBRIDGE_FORWARD, speed)
+}
+
+// Drives the motor backwards at speed between 0.0 and 1.0, only 1.0 without HBridgeWithPWM
+func (h *HBridge) Reverse(speed float64) error {
+	return h.set(HBRIDGE_REVERSE, speed)
+}
+
+// Turns all drives off, the motor runs down freely
+func (h *HBridge) Coast() error {
+	return h.set(HBRIDGE_COAST, 0)
+}
+
+// Shorts the motor through the low sides, stopping it quickly. Needs HBridgeWithPWM on NewHBridge.
+func (h *HBridge) Brake() error {
+	if h.pwm == nil && len(h.drives) == 2 {
+		return fmt.Errorf("HBridge: brake without enable PWM: %w", ErrNotSupported)
+	}
+	return h.set(HBRIDGE_BRAKE, 1)
+}
+
+// What the bridge does at the moment, HBRIDGE_COAST after an error
+func (h *HBridge) State() HBridgeState {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.state
+}
+
+// Coasts. The GPIOs and the PWM stay open, they belong to the caller.
+func (h *HBridge) Close() {
+	h.Coast()
+}
+
+func (h *HBridge) set(state HBridgeState, speed float64) error {
+	if !(speed >= 0 && speed <= 1) {
+		return fmt.Errorf("HBridge: speed %v not within 0 to 1: %w", speed, ErrOutOfRange)
+	}
+	if h.pwm == nil && state != HBRIDGE_COAST && speed != 1 {
+		return fmt.Errorf("HBridge: speed %v without PWM: %w", speed, ErrNotSupported)
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	levels := h.levels[state]
+	if h.pwm != nil && state == HBRIDGE_COAST {
+		h.pwm.DisablePWM()
+	}
+	// off first, then on after the dead-time
+	for _, turnOn := range []bool{false, true} {
+		for i, pin := range h.drives {
+			if levels[i] != turnOn || h.on[i] == turnOn {
+				continue
+			}
+			if wait := h.off.Add(h.deadtime).Sub(h.clock.Now()); turnOn && wait > 0 {
+				h.clock.Sleep(wait)
+			}
+			if err := pin.SetState(turnOn); err != nil {
+				h.safe()
+				return fmt.Errorf("HBridge: %s: %w", state, err)
+			}
+			h.on[i] = turnOn
+			if !turnOn {
+				h.off = h.clock.Now()
+			}
+		}
+	}
+	if h.pwm != nil && state != HBRIDGE_COAST {
+		h.pwm.SetPWM(h.period, time.Duration(float64(h.period)*speed))
+	}
+	h.state = state
+	return nil
+}
+
+// all off, as far as possible
+func (h *HBridge) safe() {
+	if h.pwm != nil {
+		h.pwm.DisablePWM()
+	}
+	for i, pin := range h.drives {
+		pin.SetState(false)
+		h.on[i] = false
+	}
+	h.off = h.clock.Now()
+	h.state = HBRIDGE_COAST
+}
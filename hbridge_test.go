@@ -0,0 +1,171 @@
+package bbhw
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+type hbridgeTransition struct {
+	Transition
+	drive int
+}
+
+// transitions of all drives merged by time. The order at one instant is lost, so tests make their calls at different times,
+// then drives turning on at the same instant as others turn off came after them
+func hbridgeHistory(drives []*FakeGPIO) (merged []hbridgeTransition) {
+	for i, gpio := range drives {
+		for _, tr := range gpio.History() {
+			merged = append(merged, hbridgeTransition{tr, i})
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		if !merged[i].Time.Equal(merged[j].Time) {
+			return merged[i].Time.Before(merged[j].Time)
+		}
+		return !merged[i].State && merged[j].State
+	})
+	return merged
+}
+
+// replays the history of the drives: no forbidden pair is ever on at once, and no drive turns on
+// less than deadtime after another one turned off
+func checkHBridgeHistory(t *testing.T, drives []*FakeGPIO, forbidden [][2]int, deadtime time.Duration) {
+	t.Helper()
+	on := make([]bool, len(drives))
+	var off time.Time
+	for _, tr := range hbridgeHistory(drives) {
+		on[tr.drive] = tr.State
+		if !tr.State {
+			off = tr.Time
+			continue
+		}
+		if !off.IsZero() && tr.Time.Sub(off) < deadtime {
+			t.Fatalf("drive %d on %v after the last drive turned off", tr.drive, tr.Time.Sub(off))
+		}
+		for _, pair := range forbidden {
+			if on[pair[0]] && on[pair[1]] {
+				t.Fatalf("drives %d and %d on at once at %v", pair[0], pair[1], tr.Time)
+			}
+		}
+	}
+}
+
+func newFakeHBridgeDrives(t *testing.T, clock Clock, n int) (drives []*FakeGPIO, pins []GPIOControllablePin) {
+	for i := 0; i < n; i++ {
+		gpio := NewFakeGPIO(uint(i), OUT)
+		gpio.SetClock(clock)
+		gpio.EnableHistory(10000)
+		t.Cleanup(gpio.Close)
+		drives, pins = append(drives, gpio), append(pins, gpio)
+	}
+	return
+}
+
+func Test_HBridgeDeadTime(t *testing.T) {
+	clock := skipClock{NewManualClock(time.Unix(1000, 0))}
+	drives, pins := newFakeHBridgeDrives(t, clock, 2)
+	pwm := NewFakePWMOrPanic("P9_14")
+	h, err := NewHBridge(pins[0], pins[1], HBridgeWithClock(clock), HBridgeWithDeadTime(2*time.Millisecond), HBridgeWithPWM(pwm, 50*time.Microsecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = h.Forward(0.5); err != nil {
+		t.Fatal(err)
+	}
+	if _, duty := pwm.GetPWM(); duty != 25*time.Microsecond || !GetStateOrPanic(drives[0]) || h.State() != HBRIDGE_FORWARD {
+		t.Errorf("forward at half speed: duty %v, state %v", duty, h.State())
+	}
+	clock.Advance(time.Millisecond)
+	start := clock.Now()
+	if err = h.Reverse(1); err != nil {
+		t.Fatal(err)
+	}
+	history := hbridgeHistory(drives)
+	if len(history) != 3 || history[1].drive != 0 || history[1].State || history[2].drive != 1 || history[2].Time.Sub(start) != 2*time.Millisecond {
+		t.Errorf("reversing: %+v", history)
+	}
+	clock.Advance(time.Millisecond)
+	if err = h.Brake(); err != nil || GetStateOrPanic(drives[1]) {
+		t.Errorf("Brake: %v", err)
+	}
+	if _, duty := pwm.GetPWM(); duty != 50*time.Microsecond {
+		t.Errorf("braking with duty %v", duty)
+	}
+	clock.Advance(time.Millisecond)
+	h.Close()
+	if _, duty := pwm.GetPWM(); duty != 0 || h.State() != HBRIDGE_COAST {
+		t.Errorf("after Close: duty %v, state %v", duty, h.State())
+	}
+	checkHBridgeHistory(t, drives, [][2]int{{0, 1}}, 2*time.Millisecond)
+}
+
+func Test_HBridgeRandomSequences(t *testing.T) {
+	clock := skipClock{NewManualClock(time.Unix(1000, 0))}
+	drives, pins := newFakeHBridgeDrives(t, clock, 4)
+	h, err := NewDiscreteHBridge(pins[0], pins[1], pins[2], pins[3], HBridgeWithClock(clock), HBridgeWithDeadTime(100*time.Microsecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := []func() error{
+		func() error { return h.Forward(1) },
+		func() error { return h.Reverse(1) },
+		h.Brake,
+		h.Coast,
+	}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		if err := calls[r.Intn(len(calls))](); err != nil {
+			t.Fatal(err)
+		}
+		// often right away (but at a new instant, see hbridgeHistory), sometimes after the dead-time passed
+		wait := time.Microsecond
+		if r.Intn(2) == 0 {
+			wait = time.Duration(1+r.Intn(200)) * time.Microsecond
+		}
+		clock.Advance(wait)
+	}
+	checkHBridgeHistory(t, drives, [][2]int{{0, 1}, {2, 3}}, 100*time.Microsecond)
+	if len(hbridgeHistory(drives)) < 1000 {
+		t.Errorf("only %d transitions", len(hbridgeHistory(drives)))
+	}
+}
+
+func Test_HBridgeErrors(t *testing.T) {
+	clock := skipClock{NewManualClock(time.Unix(1000, 0))}
+	drives, pins := newFakeHBridgeDrives(t, clock, 4)
+	h, _ := NewDiscreteHBridge(pins[0], pins[1], pins[2], pins[3], HBridgeWithClock(clock))
+	if err := h.Forward(0.5); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("half speed without PWM: %v", err)
+	}
+	if err := h.Forward(1); err != nil {
+		t.Fatal(err)
+	}
+	// the low side of A fails turning on while reversing
+	drives[1].FailNext("SetState", errors.New("gone"))
+	if err := h.Reverse(1); err == nil {
+		t.Fatal("SetState error not returned")
+	}
+	for i, gpio := range drives {
+		if GetStateOrPanic(gpio) {
+			t.Errorf("drive %d still on after the error", i)
+		}
+	}
+	if h.State() != HBRIDGE_COAST {
+		t.Errorf("state %v after the error", h.State())
+	}
+	two, _ := NewHBridge(pins[0], pins[2], HBridgeWithClock(clock))
+	if err := two.Brake(); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("Brake without PWM: %v", err)
+	}
+	if err := two.Reverse(2); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("speed 2: %v", err)
+	}
+	in := NewFakeGPIO(9, IN)
+	t.Cleanup(in.Close)
+	if _, err := NewHBridge(pins[0], in); !errors.Is(err, ErrInvalidDirection) {
+		t.Errorf("input as drive: %v", err)
+	}
+}
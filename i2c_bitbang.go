@@ -0,0 +1,314 @@
+package bbhw
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// errors.Is(err, ErrI2CNack) matches any *I2CNackError
+var ErrI2CNack = errors.New("I2C NACK")
+
+// Returned if a device holds SCL low (clock stretching) for longer than I2CWithStretchTimeout, or SDA is stuck low
+var ErrI2CBusStuck = errors.New("I2C bus stuck")
+
+// A device did not acknowledge a byte, errors.Is(err, ErrI2CNack) matches it
+type I2CNackError struct {
+	Addr uint8
+	Byte int // index of the byte in the transfer, 0 is the address, i.e. no device answered
+}
+
+func (e *I2CNackError) Error() string {
+	if e.Byte == 0 {
+		return fmt.Sprintf("I2C: no device at address %#02x", e.Addr)
+	}
+	return fmt.Sprintf("I2C: device %#02x did not acknowledge byte %d", e.Addr, e.Byte)
+}
+
+func (e *I2CNackError) Is(target error) bool { return target == ErrI2CNack }
+
+// Option of NewBitbangI2C
+type BitbangI2COption func(*BitbangI2C)
+
+// Waits d after every edge. Default 5µs, i.e. at most 100kHz. Best effort, the pauses may be a lot longer.
+func I2CWithClockDelay(d time.Duration) BitbangI2COption {
+	return func(i *BitbangI2C) { i.delay = d }
+}
+
+// how long a device may stretch the clock by holding SCL low, default 10ms
+func I2CWithStretchTimeout(d time.Duration) BitbangI2COption {
+	return func(i *BitbangI2C) { i.stretch = d }
+}
+
+// I2C master on two GPIOs with open-drain emulation: a line is driven low as output and released as input,
+// the pull-up resistors of the bus pull it high. Supports 7 bit addresses, repeated starts and clock stretching.
+type BitbangI2C struct {
+	sda, scl i2cLine
+	delay    time.Duration
+	stretch  time.Duration
+	lock     sync.Mutex // one transfer at a time
+}
+
+// open-drain emulation on one GPIO
+type i2cLine struct {
+	gpio GPIO
+}
+
+func (l *i2cLine) release() error {
+	return l.gpio.SetDirection(IN)
+}
+
+// SysfsGPIO and MMappedGPIO switch to output low already, others may drive the level of the input for a moment
+func (l *i2cLine) pull() error {
+	if err := l.gpio.SetDirection(OUT); err != nil {
+		return err
+	}
+	return l.gpio.SetState(false)
+}
+
+func (l *i2cLine) set(high bool) error {
+	if high {
+		return l.release()
+	}
+	return l.pull()
+}
+
+// Releases both lines. Both need external pull-up resistors (typically 4.7kΩ), the internal ones are too weak.
+func NewBitbangI2C(sda, scl GPIO, opts ...BitbangI2COption) (*BitbangI2C, error) {
+	if sda == nil || scl == nil {
+		panic("gpio == nil")
+	}
+	i := &BitbangI2C{sda: i2cLine{gpio: sda}, scl: i2cLine{gpio: scl}, delay: 5 * time.Microsecond, stretch: 10 * time.Millisecond}
+	for _, opt := range opts {
+		opt(i)
+	}
+	if err := i.scl.release(); err != nil {
+		return nil, err
+	}
+	return i, i.sda.release()
+}
+
+// Writes data to the register reg of the device at addr, i.e. reg followed by data in one transfer.
+func (i *BitbangI2C) WriteRegister(addr, reg uint8, data []byte) error {
+	return i.Write(addr, append([]byte{reg}, data...))
+}
+
+// Reads n bytes starting at the register reg of the device at addr: writes reg, then reads after a repeated start.
+func (i *BitbangI2C) ReadRegister(addr, reg uint8, n int) ([]byte, error) {
+	return i.transfer(addr, []byte{reg}, n)
+}
+
+// Writes data to the device at addr
+func (i *BitbangI2C) Write(addr uint8, data []byte) error {
+	_, err := i.transfer(addr, data, 0)
+	return err
+}
+
+// Reads n bytes from the device at addr
+func (i *BitbangI2C) Read(addr uint8, n int) ([]byte, error) {
+	return i.transfer(addr, nil, n)
+}
+
+// writes tx (if any), then reads n bytes (if any) after a (repeated) start
+func (i *BitbangI2C) transfer(addr uint8, tx []byte, n int) (rx []byte, err error) {
+	if addr > 0x7f {
+		return nil, fmt.Errorf("I2C: address %#x has more than 7 bits", addr)
+	}
+	if n < 0 {
+		return nil, fmt.Errorf("I2C: reading %d bytes", n)
+	}
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	defer func() {
+		if stoperr := i.stop(); err == nil {
+			err = stoperr
+		}
+		if err != nil {
+			rx = nil
+		}
+	}()
+	if len(tx) > 0 || n == 0 {
+		if err = i.start(); err != nil {
+			return
+		}
+		if err = i.writeByte(addr<<1, addr, 0); err != nil {
+			return
+		}
+		for j, b := range tx {
+			if err = i.writeByte(b, addr, j+1); err != nil {
+				return
+			}
+		}
+	}
+	if n == 0 {
+		return
+	}
+	if err = i.start(); err != nil {
+		return
+	}
+	if err = i.writeByte(addr<<1|1, addr, 0); err != nil {
+		return
+	}
+	rx = make([]byte, n)
+	for j := range rx {
+		// the master acknowledges all bytes but the last
+		if rx[j], err = i.readByte(j < n-1); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Frees a bus a device holds SDA low on, e.g. after the master was interrupted in the middle of a read:
+// clocks up to 9 pulses until SDA is released, then sends a stop. Fails with ErrI2CBusStuck if SDA stays low.
+func (i *BitbangI2C) RecoverBus() error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if err := i.sda.release(); err != nil {
+		return err
+	}
+	for pulse := 0; pulse < 9; pulse++ {
+		high, err := i.sda.gpio.GetState()
+		if err != nil {
+			return err
+		}
+		if high {
+			break
+		}
+		if err = i.clockPulse(); err != nil {
+			return err
+		}
+	}
+	if err := i.stop(); err != nil {
+		return err
+	}
+	if high, err := i.sda.gpio.GetState(); err != nil || !high {
+		return fmt.Errorf("I2C: SDA still low after 9 clock pulses: %w", ErrI2CBusStuck)
+	}
+	return nil
+}
+
+// (repeated) start: SDA falls while SCL is high
+func (i *BitbangI2C) start() error {
+	if err := i.sda.release(); err != nil {
+		return err
+	}
+	if err := i.releaseSCL(); err != nil {
+		return err
+	}
+	if err := i.sda.pull(); err != nil {
+		return err
+	}
+	i.pause()
+	return i.pullSCL()
+}
+
+// SDA rises while SCL is high
+func (i *BitbangI2C) stop() error {
+	if err := i.sda.pull(); err != nil {
+		return err
+	}
+	i.pause()
+	if err := i.releaseSCL(); err != nil {
+		return err
+	}
+	err := i.sda.release()
+	i.pause()
+	return err
+}
+
+// releases SCL and waits until it is high, devices may hold it low to stretch the clock
+func (i *BitbangI2C) releaseSCL() error {
+	if err := i.scl.release(); err != nil {
+		return err
+	}
+	for deadline := time.Now().Add(i.stretch); ; {
+		high, err := i.scl.gpio.GetState()
+		if err != nil {
+			return err
+		}
+		if high {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("I2C: SCL held low for more than %v: %w", i.stretch, ErrI2CBusStuck)
+		}
+		time.Sleep(time.Microsecond)
+	}
+	i.pause()
+	return nil
+}
+
+func (i *BitbangI2C) pullSCL() error {
+	err := i.scl.pull()
+	i.pause()
+	return err
+}
+
+func (i *BitbangI2C) clockPulse() error {
+	if err := i.releaseSCL(); err != nil {
+		return err
+	}
+	return i.pullSCL()
+}
+
+// writes a bit while SCL is low and clocks it
+func (i *BitbangI2C) writeBit(bit bool) error {
+	if err := i.sda.set(bit); err != nil {
+		return err
+	}
+	return i.clockPulse()
+}
+
+// releases SDA and samples it while SCL is high
+func (i *BitbangI2C) readBit() (bool, error) {
+	if err := i.sda.release(); err != nil {
+		return false, err
+	}
+	if err := i.releaseSCL(); err != nil {
+		return false, err
+	}
+	bit, err := i.sda.gpio.GetState()
+	if err != nil {
+		return false, err
+	}
+	return bit, i.pullSCL()
+}
+
+// sends b MSB first and checks the acknowledge of the device, index is the I2CNackError.Byte
+func (i *BitbangI2C) writeByte(b, addr uint8, index int) error {
+	for bit := 7; bit >= 0; bit-- {
+		if err := i.writeBit(b&(1<<uint(bit)) != 0); err != nil {
+			return err
+		}
+	}
+	nack, err := i.readBit()
+	if err != nil {
+		return err
+	}
+	if nack {
+		return &I2CNackError{Addr: addr, Byte: index}
+	}
+	return nil
+}
+
+func (i *BitbangI2C) readByte(ack bool) (b uint8, err error) {
+	for bit := 0; bit < 8; bit++ {
+		high, err := i.readBit()
+		if err != nil {
+			return 0, err
+		}
+		b <<= 1
+		if high {
+			b |= 1
+		}
+	}
+	return b, i.writeBit(!ack)
+}
+
+func (i *BitbangI2C) pause() {
+	if i.delay > 0 {
+		time.Sleep(i.delay)
+	}
+}
@@ -0,0 +1,215 @@
+package bbhw
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+// model of an I2C device with 256 byte registers on a FakeNet bus, the first byte written sets the register pointer
+type fakeI2CDevice struct {
+	addr     uint8
+	regs     [256]byte
+	pointer  uint8
+	sda, scl *FakeGPIO // listening
+	sdaOut   *FakeGPIO // open drain
+	sclOut   *FakeGPIO // open drain, for clock stretching
+	stretch  time.Duration
+	phase    int // one of the fake_i2c_* below
+	bits     int
+	shift    uint8
+	bytes    int  // received since the start, the first is the address
+	read     bool // addressed for reading
+}
+
+const (
+	fake_i2c_idle   = iota // waiting for a start
+	fake_i2c_recv          // receiving address or data
+	fake_i2c_ackout        // acknowledging a byte
+	fake_i2c_send          // sending a byte
+	fake_i2c_ackin         // master acknowledging a byte
+)
+
+func newFakeI2CBus(t *testing.T, addr uint8) (sda, scl *FakeGPIO, dev *fakeI2CDevice) {
+	sdanet, sclnet := NewFakeNet("SDA"), NewFakeNet("SCL")
+	sdanet.SetPull(PULLUP)
+	sclnet.SetPull(PULLUP)
+	sda, scl = NewFakeNamedGPIO("SDA", IN, nil), NewFakeNamedGPIO("SCL", IN, nil)
+	dev = &fakeI2CDevice{addr: addr, sda: NewFakeNamedGPIO("SDA_dev", IN, nil), scl: NewFakeNamedGPIO("SCL_dev", IN, nil),
+		sdaOut: NewFakeNamedGPIO("SDA_drv", OUT, nil), sclOut: NewFakeNamedGPIO("SCL_drv", OUT, nil)}
+	for _, gpio := range []*FakeGPIO{dev.sdaOut, dev.sclOut} {
+		gpio.SetDriveMode(OPEN_DRAIN)
+		gpio.SetState(true)
+	}
+	sdanet.Attach(sda, dev.sda, dev.sdaOut)
+	sclnet.Attach(scl, dev.scl, dev.sclOut)
+	for _, gpio := range []*FakeGPIO{sda, scl, dev.sda, dev.scl, dev.sdaOut, dev.sclOut} {
+		t.Cleanup(gpio.Close)
+	}
+	dev.sda.OnChange(func(high bool) {
+		if !GetStateOrPanic(dev.scl) {
+			return
+		}
+		if high { // stop
+			dev.phase = fake_i2c_idle
+		} else { // (repeated) start
+			dev.phase, dev.bits, dev.bytes, dev.read = fake_i2c_recv, 0, 0, false
+		}
+	})
+	dev.scl.OnChange(func(high bool) {
+		if high {
+			dev.rising()
+		} else {
+			dev.falling()
+		}
+	})
+	return
+}
+
+func (dev *fakeI2CDevice) drive(bit bool) {
+	dev.sdaOut.SetState(bit)
+}
+
+func (dev *fakeI2CDevice) rising() {
+	switch dev.phase {
+	case fake_i2c_recv:
+		dev.shift = dev.shift<<1 | uint8(boolToUint32(GetStateOrPanic(dev.sda)))
+		dev.bits++
+	case fake_i2c_send:
+		dev.bits++
+	case fake_i2c_ackin:
+		if GetStateOrPanic(dev.sda) { // NACK, done
+			dev.phase = fake_i2c_idle
+		}
+	}
+}
+
+func (dev *fakeI2CDevice) falling() {
+	switch dev.phase {
+	case fake_i2c_recv:
+		if dev.bits < 8 {
+			return
+		}
+		switch {
+		case dev.bytes == 0 && dev.shift>>1 != dev.addr:
+			dev.phase = fake_i2c_idle // somebody else
+			return
+		case dev.bytes == 0:
+			dev.read = dev.shift&1 != 0
+		case dev.bytes == 1:
+			dev.pointer = dev.shift
+		default:
+			dev.regs[dev.pointer] = dev.shift
+			dev.pointer++
+		}
+		dev.bytes++
+		dev.drive(false)
+		dev.phase = fake_i2c_ackout
+		if dev.stretch > 0 {
+			dev.sclOut.SetState(false)
+			go func() {
+				time.Sleep(dev.stretch)
+				dev.sclOut.SetState(true)
+			}()
+		}
+	case fake_i2c_ackout:
+		dev.bits = 0
+		if dev.read {
+			dev.send()
+		} else {
+			dev.drive(true)
+			dev.phase = fake_i2c_recv
+		}
+	case fake_i2c_send:
+		if dev.bits == 8 {
+			dev.drive(true)
+			dev.phase = fake_i2c_ackin
+			return
+		}
+		dev.drive(dev.shift&(0x80>>uint(dev.bits)) != 0)
+	case fake_i2c_ackin:
+		dev.send()
+	}
+}
+
+// starts sending the register at the pointer, the MSB right away
+func (dev *fakeI2CDevice) send() {
+	dev.shift = dev.regs[dev.pointer]
+	dev.pointer++
+	dev.drive(dev.shift&0x80 != 0)
+	dev.phase, dev.bits = fake_i2c_send, 0
+}
+
+func Test_BitbangI2CRegisters(t *testing.T) {
+	sda, scl, dev := newFakeI2CBus(t, 0x48)
+	i2c, err := NewBitbangI2C(sda, scl, I2CWithClockDelay(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = i2c.WriteRegister(0x48, 0x10, []byte{0xde, 0xad, 0xbe}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dev.regs[0x10:0x13], []byte{0xde, 0xad, 0xbe}) {
+		t.Errorf("registers %x", dev.regs[0x10:0x13])
+	}
+	dev.regs[0x20], dev.regs[0x21] = 0x5a, 0x81
+	if rx, err := i2c.ReadRegister(0x48, 0x20, 2); err != nil || !bytes.Equal(rx, []byte{0x5a, 0x81}) {
+		t.Errorf("ReadRegister = %x, %v", rx, err)
+	}
+	// reading on from the pointer
+	if rx, err := i2c.Read(0x48, 1); err != nil || rx[0] != 0 || dev.pointer != 0x23 {
+		t.Errorf("Read = %x, %v, pointer %#x", rx, err, dev.pointer)
+	}
+	if !GetStateOrPanic(sda) || !GetStateOrPanic(scl) {
+		t.Error("bus not released after the transfers")
+	}
+}
+
+func Test_BitbangI2CNack(t *testing.T) {
+	sda, scl, _ := newFakeI2CBus(t, 0x48)
+	i2c, _ := NewBitbangI2C(sda, scl, I2CWithClockDelay(0))
+	_, err := i2c.ReadRegister(0x49, 0, 1)
+	var nack *I2CNackError
+	if !errors.Is(err, ErrI2CNack) || !errors.As(err, &nack) || nack.Addr != 0x49 || nack.Byte != 0 {
+		t.Errorf("ReadRegister from nobody: %v", err)
+	}
+	if err = i2c.Write(0x80, nil); err == nil {
+		t.Error("8 bit address accepted")
+	}
+}
+
+func Test_BitbangI2CClockStretching(t *testing.T) {
+	sda, scl, dev := newFakeI2CBus(t, 0x48)
+	dev.stretch = 2 * time.Millisecond
+	i2c, _ := NewBitbangI2C(sda, scl, I2CWithClockDelay(0))
+	if err := i2c.WriteRegister(0x48, 0x01, []byte{0x42}); err != nil || dev.regs[1] != 0x42 {
+		t.Errorf("WriteRegister with clock stretching: %v", err)
+	}
+	dev.stretch = time.Second
+	i2c, _ = NewBitbangI2C(sda, scl, I2CWithClockDelay(0), I2CWithStretchTimeout(time.Millisecond))
+	if err := i2c.WriteRegister(0x48, 0x01, []byte{0x42}); !errors.Is(err, ErrI2CBusStuck) {
+		t.Errorf("SCL held low: %v", err)
+	}
+}
+
+func Test_BitbangI2CRecoverBus(t *testing.T) {
+	sda, scl, dev := newFakeI2CBus(t, 0x48)
+	i2c, _ := NewBitbangI2C(sda, scl, I2CWithClockDelay(0))
+	// the master went away in the middle of reading a zero
+	dev.send()
+	if GetStateOrPanic(sda) {
+		t.Fatal("device does not hold SDA")
+	}
+	if err := i2c.RecoverBus(); err != nil {
+		t.Fatal(err)
+	}
+	dev.regs[7] = 0x77
+	if rx, err := i2c.ReadRegister(0x48, 7, 1); err != nil || rx[0] != 0x77 {
+		t.Errorf("ReadRegister after recovery = %x, %v", rx, err)
+	}
+	dev.drive(false)
+	if err := i2c.RecoverBus(); !errors.Is(err, ErrI2CBusStuck) {
+		t.Errorf("RecoverBus with SDA shorted to ground: %v", err)
+	}
+}
@@ -0,0 +1,222 @@
+package bbhw
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// instructions of the HD44780, see its datasheet
+const (
+	hd44780_clear_        = 0x01
+	hd44780_entry_mode_   = 0x04 // | 0x02 increment
+	hd44780_display_      = 0x08 // | 0x04 display on, 0x02 cursor, 0x01 blink
+	hd44780_function_set_ = 0x20 // | 0x10 8 bit, 0x08 two lines
+	hd44780_set_cgram_    = 0x40
+	hd44780_set_ddram_    = 0x80
+)
+
+// execution times at 270kHz, clear and home take a lot longer than the rest
+const (
+	hd44780_exec_time_   = 37 * time.Microsecond
+	hd44780_clear_time_  = 1520 * time.Microsecond
+	hd44780_enable_time_ = time.Microsecond // E high, the datasheet wants 450ns
+)
+
+// Option of NewHD44780
+type HD44780Option func(*HD44780)
+
+// columns and rows of the display, default 16x2. Up to 40x2 or 20x4.
+func HD44780WithSize(cols, rows int) HD44780Option {
+	return func(l *HD44780) { l.cols, l.rows = cols, rows }
+}
+
+// GPIO switching the backlight (e.g. through a transistor), on while high. See SetBacklight
+func HD44780WithBacklight(gpio GPIOControllablePin) HD44780Option {
+	return func(l *HD44780) { l.backlight = gpio }
+}
+
+// times the waits of the controller on c
+func HD44780WithClock(c Clock) HD44780Option {
+	return func(l *HD44780) { l.clock = c }
+}
+
+// RS and D4 to D7 come from cf, their SetStates of a nibble are recorded and applied at once,
+// so the data lines do not skew (on MMappedGPIOs a single register write)
+func HD44780WithCollection(cf GPIOCollectionFactory) HD44780Option {
+	return func(l *HD44780) { l.collection = cf }
+}
+
+// Character LCD with a HD44780 (or compatible, e.g. ST7066) controller in 4 bit mode on six output GPIOs,
+// R/W tied to ground. Without the busy flag each instruction waits for its worst-case execution time.
+type HD44780 struct {
+	rs, e      GPIOControllablePin
+	data       [4]GPIOControllablePin // D4 to D7
+	backlight  GPIOControllablePin
+	collection GPIOCollectionFactory
+	clock      Clock
+	cols, rows int
+	lock       sync.Mutex // one instruction at a time
+}
+
+// data are D4 to D7 of the display, all pins have to be outputs. Sets E low, call Init before anything else.
+func NewHD44780(rs, e GPIOControllablePin, data [4]GPIOControllablePin, opts ...HD44780Option) (*HD44780, error) {
+	if rs == nil || e == nil {
+		panic("gpio == nil")
+	}
+	l := &HD44780{rs: rs, e: e, data: data, cols: 16, rows: 2}
+	for _, opt := range opts {
+		opt(l)
+	}
+	if l.clock == nil {
+		l.clock = defaultClock()
+	}
+	if l.cols < 1 || l.rows < 1 || l.rows > 4 || l.cols*l.rows > 80 || (l.rows > 2 && l.cols > 20) {
+		return nil, fmt.Errorf("HD44780: invalid size %dx%d", l.cols, l.rows)
+	}
+	pins := append([]GPIOControllablePin{rs, e}, data[:]...)
+	if l.backlight != nil {
+		pins = append(pins, l.backlight)
+	}
+	for _, pin := range pins {
+		if pin == nil {
+			panic("gpio == nil")
+		}
+		if err := checkOutput(pin, "HD44780"); err != nil {
+			return nil, err
+		}
+	}
+	return l, e.SetState(false)
+}
+
+// Switches the controller to 4 bit mode with the initialization by instruction of the datasheet, which works
+// whatever state it is in, then clears the display and turns it on without cursor. Waits 50ms for the power to settle first.
+func (l *HD44780) Init() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.clock.Sleep(50 * time.Millisecond)
+	// three times 8 bit mode, since the controller might be anywhere in between 8 bit and the second nibble in 4 bit mode
+	for _, wait := range []time.Duration{4100 * time.Microsecond, 100 * time.Microsecond, hd44780_exec_time_} {
+		if err := l.writeNibble(false, (hd44780_function_set_|0x10)>>4, wait); err != nil {
+			return err
+		}
+	}
+	if err := l.writeNibble(false, hd44780_function_set_>>4, hd44780_exec_time_); err != nil {
+		return err
+	}
+	functionset := uint8(hd44780_function_set_)
+	if l.rows > 1 {
+		functionset |= 0x08
+	}
+	for _, cmd := range []uint8{functionset, hd44780_display_, hd44780_clear_, hd44780_entry_mode_ | 0x02, hd44780_display_ | 0x04} {
+		if err := l.command(cmd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Blanks the display and moves the cursor to 0,0
+func (l *HD44780) Clear() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.command(hd44780_clear_)
+}
+
+// Moves the cursor to column col of row. Outside of the display returns ErrOutOfRange.
+func (l *HD44780) SetCursor(col, row int) error {
+	if col < 0 || col >= l.cols || row < 0 || row >= l.rows {
+		return fmt.Errorf("HD44780: cursor %d,%d outside of %dx%d: %w", col, row, l.cols, l.rows, ErrOutOfRange)
+	}
+	// rows 2 and 3 of four line displays continue rows 0 and 1
+	offset := []int{0x00, 0x40, l.cols, 0x40 + l.cols}[row]
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.command(hd44780_set_ddram_ | uint8(offset+col))
+}
+
+// Writes the bytes of s at the cursor, which moves on (but does not wrap to the next row). The character ROM
+// matches ASCII from 0x20 to 0x7d, "\x00" to "\x07" are the characters of CreateChar.
+func (l *HD44780) Print(s string) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for i := 0; i < len(s); i++ {
+		if err := l.write(true, s[i], hd44780_exec_time_); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Defines the custom character location (0 to 7) from 8 rows of 5 pixels, bit 4 being the leftmost.
+// Moves the cursor to 0,0, since the controller would write into the character memory otherwise.
+func (l *HD44780) CreateChar(location uint8, bitmap [8]byte) error {
+	if location > 7 {
+		return fmt.Errorf("HD44780: custom character %d: %w", location, ErrOutOfRange)
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if err := l.command(hd44780_set_cgram_ | location<<3); err != nil {
+		return err
+	}
+	for _, row := range bitmap {
+		if err := l.write(true, row&0x1f, hd44780_exec_time_); err != nil {
+			return err
+		}
+	}
+	return l.command(hd44780_set_ddram_)
+}
+
+// Switches the pin of HD44780WithBacklight, ErrNotSupported without one
+func (l *HD44780) SetBacklight(on bool) error {
+	if l.backlight == nil {
+		return fmt.Errorf("HD44780 backlight: %w", ErrNotSupported)
+	}
+	return l.backlight.SetState(on)
+}
+
+func (l *HD44780) command(cmd uint8) error {
+	wait := hd44780_exec_time_
+	if cmd == hd44780_clear_ {
+		wait = hd44780_clear_time_
+	}
+	return l.write(false, cmd, wait)
+}
+
+// high nibble first, then waits the execution time
+func (l *HD44780) write(rs bool, b uint8, wait time.Duration) error {
+	if err := l.writeNibble(rs, b>>4, 0); err != nil {
+		return err
+	}
+	return l.writeNibble(rs, b&0x0f, wait)
+}
+
+// sets RS and the data lines, then latches them on the falling edge of E
+func (l *HD44780) writeNibble(rs bool, nibble uint8, wait time.Duration) error {
+	if l.collection != nil {
+		l.collection.BeginTransactionRecordSetStates()
+	}
+	err := l.rs.SetState(rs)
+	for i, pin := range l.data {
+		if err == nil {
+			err = pin.SetState(nibble&(1<<uint(i)) != 0)
+		}
+	}
+	if l.collection != nil {
+		l.collection.EndTransactionApplySetStates()
+	}
+	if err != nil {
+		return fmt.Errorf("HD44780: %w", err)
+	}
+	if err = l.e.SetState(true); err != nil {
+		return fmt.Errorf("HD44780 E: %w", err)
+	}
+	l.clock.Sleep(hd44780_enable_time_)
+	if err = l.e.SetState(false); err != nil {
+		return fmt.Errorf("HD44780 E: %w", err)
+	}
+	if wait > 0 {
+		l.clock.Sleep(wait)
+	}
+	return nil
+}
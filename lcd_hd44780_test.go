@@ -0,0 +1,191 @@
+package bbhw
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ManualClock whose Sleep moves it on instead of blocking, so the waits of the controller take no real time
+type skipClock struct{ *ManualClock }
+
+func (c skipClock) Sleep(d time.Duration) { c.Advance(d) }
+
+// records the nibbles a HD44780 latches on the falling edges of E, as "RS nibble" with the virtual time since the previous one
+type fakeHD44780 struct {
+	trace []string
+	gaps  []time.Duration
+}
+
+func newFakeHD44780(t *testing.T, clock Clock, rs, e GPIO, data [4]GPIO) *fakeHD44780 {
+	lcd := &fakeHD44780{}
+	pins := make([]*FakeGPIO, 6)
+	for i, out := range append([]GPIO{rs, e}, data[:]...) {
+		pins[i] = NewFakeNamedGPIO(fmt.Sprintf("LCD%d", i), IN, nil)
+		t.Cleanup(pins[i].Close)
+		switch out := out.(type) {
+		case *FakeGPIO:
+			out.ConnectTo(pins[i])
+		case *FakeGPIOInCollection:
+			out.ConnectTo(pins[i])
+		}
+	}
+	last := clock.Now()
+	pins[1].OnChange(func(high bool) {
+		if high {
+			return
+		}
+		var nibble uint8
+		for i, pin := range pins[2:] {
+			nibble |= uint8(boolToUint32(GetStateOrPanic(pin))) << uint(i)
+		}
+		lcd.trace = append(lcd.trace, fmt.Sprintf("%d %x", boolToUint32(GetStateOrPanic(pins[0])), nibble))
+		lcd.gaps = append(lcd.gaps, clock.Now().Sub(last))
+		last = clock.Now()
+	})
+	return lcd
+}
+
+func newFakeLCDPins(t *testing.T) (rs, e *FakeGPIO, data [4]GPIOControllablePin, dataGPIOs [4]GPIO) {
+	rs, e = NewFakeNamedGPIO("RS", OUT, nil), NewFakeNamedGPIO("E", OUT, nil)
+	t.Cleanup(rs.Close)
+	t.Cleanup(e.Close)
+	for i := range data {
+		gpio := NewFakeNamedGPIO(fmt.Sprintf("D%d", i+4), OUT, nil)
+		t.Cleanup(gpio.Close)
+		data[i], dataGPIOs[i] = gpio, gpio
+	}
+	return
+}
+
+func Test_HD44780InitAndPrint(t *testing.T) {
+	clock := skipClock{NewManualClock(time.Unix(0, 0))}
+	rs, e, data, dataGPIOs := newFakeLCDPins(t)
+	lcd := newFakeHD44780(t, clock, rs, e, dataGPIOs)
+	l, err := NewHD44780(rs, e, data, HD44780WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = l.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err = l.Print("Hi"); err != nil {
+		t.Fatal(err)
+	}
+	golden := []string{
+		"0 3", "0 3", "0 3", "0 2", // into 4 bit mode
+		"0 2", "0 8", // function set, two lines
+		"0 0", "0 8", // display off
+		"0 0", "0 1", // clear
+		"0 0", "0 6", // entry mode, increment
+		"0 0", "0 c", // display on
+		"1 4", "1 8", // H
+		"1 6", "1 9", // i
+	}
+	if strings.Join(lcd.trace, ",") != strings.Join(golden, ",") {
+		t.Fatalf("nibbles\n%v\nexpected\n%v", lcd.trace, golden)
+	}
+	// the wait before each nibble
+	for i, min := range map[int]time.Duration{0: 50 * time.Millisecond, 1: 4100 * time.Microsecond, 2: 100 * time.Microsecond, 10: 1520 * time.Microsecond, 14: 37 * time.Microsecond} {
+		if lcd.gaps[i] < min {
+			t.Errorf("nibble %d %v after the previous one, expected at least %v", i, lcd.gaps[i], min)
+		}
+	}
+}
+
+func Test_HD44780CursorAndCustomCharacters(t *testing.T) {
+	clock := skipClock{NewManualClock(time.Unix(0, 0))}
+	rs, e, data, dataGPIOs := newFakeLCDPins(t)
+	lcd := newFakeHD44780(t, clock, rs, e, dataGPIOs)
+	l, _ := NewHD44780(rs, e, data, HD44780WithClock(clock), HD44780WithSize(20, 4))
+	if err := l.SetCursor(3, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.CreateChar(1, [8]byte{0x0e, 0x11, 0x11, 0x11, 0x1f, 0x1b, 0x1b, 0xff}); err != nil {
+		t.Fatal(err)
+	}
+	golden := []string{
+		"0 9", "0 7", // DDRAM 0x14+3
+		"0 4", "0 8", // CGRAM 1<<3
+		"1 0", "1 e", "1 1", "1 1", "1 1", "1 1", "1 1", "1 1",
+		"1 1", "1 f", "1 1", "1 b", "1 1", "1 b", "1 1", "1 f", // masked to 5 pixels
+		"0 8", "0 0", // back to DDRAM 0
+	}
+	if strings.Join(lcd.trace, ",") != strings.Join(golden, ",") {
+		t.Errorf("nibbles\n%v\nexpected\n%v", lcd.trace, golden)
+	}
+	if err := l.SetCursor(20, 0); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("SetCursor(20, 0) on 20x4: %v", err)
+	}
+	if err := l.CreateChar(8, [8]byte{}); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("CreateChar(8): %v", err)
+	}
+	if err := l.SetBacklight(true); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("SetBacklight without pin: %v", err)
+	}
+}
+
+// counts the transactions, i.e. the nibbles applied at once
+type countingCollection struct {
+	*FakeGPIOCollectionFactory
+	transactions int
+}
+
+func (c *countingCollection) EndTransactionApplySetStates() {
+	c.transactions++
+	c.FakeGPIOCollectionFactory.EndTransactionApplySetStates()
+}
+
+func Test_HD44780Collection(t *testing.T) {
+	clock := skipClock{NewManualClock(time.Unix(0, 0))}
+	cf := &countingCollection{FakeGPIOCollectionFactory: NewFakeGPIOCollectionFactory()}
+	rs, e := cf.NewFakeNamedGPIO("RS", OUT, nil), NewFakeNamedGPIO("E", OUT, nil)
+	backlight := NewFakeNamedGPIO("BL", OUT, nil)
+	var data [4]GPIOControllablePin
+	var dataGPIOs [4]GPIO
+	for i := range data {
+		gpio := cf.NewFakeNamedGPIO(fmt.Sprintf("D%d", i+4), OUT, nil)
+		t.Cleanup(gpio.Close)
+		data[i], dataGPIOs[i] = gpio, gpio
+	}
+	for _, gpio := range []GPIO{rs, e, backlight} {
+		t.Cleanup(gpio.Close)
+	}
+	lcd := newFakeHD44780(t, clock, rs, e, dataGPIOs)
+	l, err := NewHD44780(rs, e, data, HD44780WithClock(clock), HD44780WithCollection(cf), HD44780WithBacklight(backlight))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = l.Print("?"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(lcd.trace, ",") != "1 3,1 f" || cf.transactions != 2 {
+		t.Errorf("nibbles %v in %d transactions", lcd.trace, cf.transactions)
+	}
+	if err = l.SetBacklight(true); err != nil || !GetStateOrPanic(backlight) {
+		t.Errorf("SetBacklight(true): %v", err)
+	}
+}
+
+func Test_HD44780Errors(t *testing.T) {
+	rs, e, data, _ := newFakeLCDPins(t)
+	if _, err := NewHD44780(rs, e, data, HD44780WithSize(40, 4)); err == nil {
+		t.Error("40x4 accepted, that needs two controllers")
+	}
+	in := NewFakeNamedGPIO("D7", IN, nil)
+	t.Cleanup(in.Close)
+	data[3] = in
+	if _, err := NewHD44780(rs, e, data); !errors.Is(err, ErrInvalidDirection) {
+		t.Errorf("input as D7: %v", err)
+	}
+	out := NewFakeNamedGPIO("D7", OUT, nil)
+	t.Cleanup(out.Close)
+	data[3] = out
+	l, _ := NewHD44780(rs, e, data, HD44780WithClock(skipClock{NewManualClock(time.Unix(0, 0))}))
+	e.FailNext("SetState", errors.New("gone"))
+	if err := l.Print("x"); err == nil {
+		t.Error("SetState error of E not returned")
+	}
+}
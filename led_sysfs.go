@@ -0,0 +1,254 @@
+package bbhw
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// base directory of the sysfs LED class, changed by tests to point to a fixture tree
+var sysfs_leds_base_ = "/sys/class/leds"
+
+// Names of the four user LEDs of the BeagleBone and the PocketBeagle, next to the reset button
+const (
+	LED_USR0 = "beaglebone:green:usr0" // heartbeat by default
+	LED_USR1 = "beaglebone:green:usr1" // mmc0 (SD card) activity
+	LED_USR2 = "beaglebone:green:usr2" // CPU activity
+	LED_USR3 = "beaglebone:green:usr3" // mmc1 (eMMC) activity
+)
+
+// Error of an operation on a SysfsLED, e.g. Op "set trigger".
+// Wraps the underlying error, so errors.Is(err, ErrNotSupported) matches an unknown trigger.
+type LEDError struct {
+	Name string
+	Op   string
+	Err  error
+}
+
+func (e *LEDError) Error() string {
+	return fmt.Sprintf("leds/%s: %s: %v", e.Name, e.Op, e.Err)
+}
+
+func (e *LEDError) Unwrap() error { return e.Err }
+
+// Lists the names of the LEDs in /sys/class/leds, sorted, e.g. the user LEDs and gpio-leds of overlays.
+// No /sys/class/leds at all is no error but no LEDs.
+func ListLEDs() ([]string, error) {
+	entries, err := os.ReadDir(sysfs_leds_base_)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Option of NewSysfsLED
+type LEDOption func(*SysfsLED)
+
+// Logs the trigger changes to l instead of the package Logger, see SetLogger
+func LEDWithLogger(l Logger) LEDOption {
+	return func(led *SysfsLED) { led.logger = l }
+}
+
+// how long SetTimerTrigger and Oneshot wait for the parameter files of the trigger
+const led_trigger_wait_default_ = time.Second
+
+// Wait up to timeout (default 1s) for the parameter files of a trigger to become writable after selecting it,
+// see SetTimerTrigger. 0 does not wait at all.
+func LEDWithTriggerWaitTimeout(timeout time.Duration) LEDOption {
+	return func(led *SysfsLED) { led.trigger_wait = timeout }
+}
+
+// An LED of /sys/class/leds. The kernel drives it by a trigger (e.g. heartbeat) or, with the trigger "none",
+// by the brightness written to it. Safe for concurrent use.
+type SysfsLED struct {
+	Name         string
+	max          int // max_brightness
+	logger       Logger
+	trigger_wait time.Duration
+	lock         sync.Mutex // orders the trigger switch before the writes following it
+}
+
+// Instantinate an LED by its name in /sys/class/leds, e.g. LED_USR0, see ListLEDs
+func NewSysfsLED(name string, opts ...LEDOption) (*SysfsLED, error) {
+	led := &SysfsLED{Name: name, trigger_wait: led_trigger_wait_default_}
+	for _, opt := range opts {
+		opt(led)
+	}
+	b, err := os.ReadFile(led.path("max_brightness"))
+	if err != nil {
+		return nil, led.wrapErr("open", err)
+	}
+	line := strings.TrimSpace(string(b))
+	if led.max, err = strconv.Atoi(line); err != nil || led.max < 1 {
+		return nil, led.wrapErr("read max_brightness", fmt.Errorf("%q: %w", line, ErrInvalidAttribute))
+	}
+	return led, nil
+}
+
+// Wrapper around NewSysfsLED. Does not return an error but panics instead. Useful to avoid multiple return values.
+func NewSysfsLEDOrPanic(name string, opts ...LEDOption) *SysfsLED {
+	led, err := NewSysfsLED(name, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return led
+}
+
+func (led *SysfsLED) path(attr string) string {
+	return filepath.Join(sysfs_leds_base_, led.Name, attr)
+}
+
+// nil if err is nil, otherwise err wrapped in a *LEDError
+func (led *SysfsLED) wrapErr(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &LEDError{Name: led.Name, Op: op, Err: err}
+}
+
+func (led *SysfsLED) log(level int, msg string, kv ...interface{}) {
+	loggerOr(led.logger).Log(level, "SysfsLED: "+msg, append([]interface{}{"led", led.Name}, kv...)...)
+}
+
+func (led *SysfsLED) write(attr, value, op string) error {
+	f, err := os.OpenFile(led.path(attr), os.O_WRONLY|os.O_TRUNC|os.O_SYNC, 0666)
+	if err != nil {
+		return led.wrapErr(op, err)
+	}
+	defer f.Close()
+	_, err = fmt.Fprintln(f, value)
+	return led.wrapErr(op, sysfsWritten(f, err))
+}
+
+// Highest brightness of the LED, 1 for plain GPIO LEDs like the user LEDs
+func (led *SysfsLED) MaxBrightness() int {
+	return led.max
+}
+
+// Brightness as read from sysfs. While a trigger runs it is what the trigger set last.
+func (led *SysfsLED) Brightness() (int, error) {
+	b, err := os.ReadFile(led.path("brightness"))
+	if err != nil {
+		return 0, led.wrapErr("read brightness", err)
+	}
+	line := strings.TrimSpace(string(b))
+	v, err := strconv.Atoi(line)
+	if err != nil {
+		return 0, led.wrapErr("read brightness", fmt.Errorf("%q: %w", line, ErrInvalidAttribute))
+	}
+	return v, nil
+}
+
+// Sets the brightness, 0 (off) to MaxBrightness. A running trigger is switched to "none" first,
+// otherwise it would override the brightness.
+func (led *SysfsLED) SetBrightness(v int) error {
+	if v < 0 || v > led.max {
+		return led.wrapErr("set brightness", fmt.Errorf("%d not in 0 to %d: %w", v, led.max, ErrOutOfRange))
+	}
+	led.lock.Lock()
+	defer led.lock.Unlock()
+	_, current, err := led.triggers()
+	if err != nil {
+		return err
+	}
+	if current != "none" {
+		led.log(LOG_DEBUG, "trigger switched off for the brightness", "trigger", current)
+		if err = led.write("trigger", "none", "set trigger"); err != nil {
+			return err
+		}
+	}
+	return led.write("brightness", strconv.Itoa(v), "set brightness")
+}
+
+// Full brightness, see SetBrightness
+func (led *SysfsLED) On() error {
+	return led.SetBrightness(led.max)
+}
+
+// Brightness 0, see SetBrightness
+func (led *SysfsLED) Off() error {
+	return led.SetBrightness(0)
+}
+
+// The triggers the kernel offers for the LED and the one selected, "none" if the brightness is set directly
+func (led *SysfsLED) Triggers() (available []string, current string, err error) {
+	return led.triggers()
+}
+
+// The selected trigger, see Triggers
+func (led *SysfsLED) Trigger() (string, error) {
+	_, current, err := led.triggers()
+	return current, err
+}
+
+func (led *SysfsLED) triggers() (available []string, current string, err error) {
+	b, err := os.ReadFile(led.path("trigger"))
+	if err != nil {
+		return nil, "", led.wrapErr("read trigger", err)
+	}
+	available, current, err = parseLEDTriggers(string(b))
+	return available, current, led.wrapErr("read trigger", err)
+}
+
+// Splits the content of a trigger file, e.g. "none timer [heartbeat] mmc0", into the triggers and the one in brackets
+func parseLEDTriggers(s string) (available []string, current string, err error) {
+	fields := strings.Fields(s)
+	available = make([]string, len(fields))
+	for i, f := range fields {
+		if len(f) > 2 && f[0] == '[' && f[len(f)-1] == ']' {
+			f = f[1 : len(f)-1]
+			if current != "" {
+				return nil, "", fmt.Errorf("%q and %q selected: %w", current, f, ErrInvalidAttribute)
+			}
+			current = f
+		}
+		available[i] = f
+	}
+	if current == "" {
+		return nil, "", fmt.Errorf("%q without a selected trigger: %w", strings.TrimSpace(s), ErrInvalidAttribute)
+	}
+	return available, current, nil
+}
+
+// Selects a trigger, e.g. "heartbeat" to give the LED back to the kernel or "none" to keep the brightness.
+// Triggers the kernel does not offer for the LED (see Triggers) return an error wrapping ErrNotSupported.
+func (led *SysfsLED) SetTrigger(trigger string) error {
+	led.lock.Lock()
+	defer led.lock.Unlock()
+	return led.setTrigger(trigger, "")
+}
+
+// selects trigger, an error for a missing one names its kernel module if known. The caller holds lock.
+func (led *SysfsLED) setTrigger(trigger, module string) error {
+	available, current, err := led.triggers()
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, t := range available {
+		found = found || t == trigger
+	}
+	if !found && module != "" {
+		return led.wrapErr("set trigger", fmt.Errorf("no %q trigger, is the kernel module %s loaded? Available are %s: %w",
+			trigger, module, strings.Join(available, " "), ErrNotSupported))
+	} else if !found {
+		return led.wrapErr("set trigger", fmt.Errorf("%q, available are %s: %w", trigger, strings.Join(available, " "), ErrNotSupported))
+	}
+	if trigger == current {
+		return nil
+	}
+	led.log(LOG_DEBUG, "set trigger", "trigger", trigger, "was", current)
+	return led.write("trigger", trigger, "set trigger")
+}
@@ -0,0 +1,163 @@
+package bbhw
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func useLEDClassDir(t *testing.T, dir string) {
+	prev := sysfs_leds_base_
+	sysfs_leds_base_ = dir
+	t.Cleanup(func() { sysfs_leds_base_ = prev })
+}
+
+// a writable copy of the user LEDs of the 5.10 fixture. Written files keep what was written,
+// unlike the trigger file of the kernel, see setLEDAttr.
+func useWritableLEDTree(t *testing.T) string {
+	dir := t.TempDir()
+	for _, name := range []string{LED_USR0, LED_USR1, LED_USR2, LED_USR3} {
+		os.Mkdir(filepath.Join(dir, name), 0755)
+		for _, attr := range []string{"brightness", "max_brightness", "trigger"} {
+			b, err := ioutil.ReadFile(filepath.Join("testdata", "leds-5.10", name, attr))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ioutil.WriteFile(filepath.Join(dir, name, attr), b, 0644)
+		}
+	}
+	useLEDClassDir(t, dir)
+	return dir
+}
+
+func readLEDAttr(t *testing.T, dir, name, attr string) string {
+	b, err := ioutil.ReadFile(filepath.Join(dir, name, attr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func setLEDAttr(dir, name, attr, value string) {
+	ioutil.WriteFile(filepath.Join(dir, name, attr), []byte(value+"\n"), 0644)
+}
+
+func Test_ParseLEDTriggers(t *testing.T) {
+	for s, expected := range map[string]struct {
+		available []string
+		current   string
+	}{
+		"[none] timer heartbeat\n":     {[]string{"none", "timer", "heartbeat"}, "none"},
+		"none timer [heartbeat] mmc0 ": {[]string{"none", "timer", "heartbeat", "mmc0"}, "heartbeat"},
+		"[none]":                       {[]string{"none"}, "none"},
+	} {
+		available, current, err := parseLEDTriggers(s)
+		if err != nil || current != expected.current || !reflect.DeepEqual(available, expected.available) {
+			t.Errorf("%q: %v, %q, %v", s, available, current, err)
+		}
+	}
+	for _, s := range []string{"", "none timer\n", "[none] [timer]", "none [] timer"} {
+		if _, _, err := parseLEDTriggers(s); !errors.Is(err, ErrInvalidAttribute) {
+			t.Errorf("%q: %v", s, err)
+		}
+	}
+}
+
+func Test_ListLEDs(t *testing.T) {
+	useLEDClassDir(t, filepath.Join("testdata", "leds-5.10"))
+	if names, err := ListLEDs(); err != nil || !reflect.DeepEqual(names, []string{LED_USR0, LED_USR1, LED_USR2, LED_USR3}) {
+		t.Errorf("%v, %v", names, err)
+	}
+	useLEDClassDir(t, filepath.Join("testdata", "no-such-dir"))
+	if names, err := ListLEDs(); err != nil || len(names) != 0 {
+		t.Errorf("without /sys/class/leds: %v, %v", names, err)
+	}
+}
+
+func Test_SysfsLEDFixture(t *testing.T) {
+	useLEDClassDir(t, filepath.Join("testdata", "leds-5.10"))
+	for name, trigger := range map[string]string{LED_USR0: "heartbeat", LED_USR1: "mmc0", LED_USR2: "cpu0", LED_USR3: "mmc1"} {
+		led, err := NewSysfsLED(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if led.MaxBrightness() != 1 {
+			t.Errorf("%s: max brightness %d", name, led.MaxBrightness())
+		}
+		available, current, err := led.Triggers()
+		if err != nil || current != trigger || len(available) != 36 || available[0] != "none" || available[17] != "timer" {
+			t.Errorf("%s: %v, %q, %v", name, available, current, err)
+		}
+	}
+	led := NewSysfsLEDOrPanic(LED_USR0)
+	if v, err := led.Brightness(); err != nil || v != 1 {
+		t.Errorf("brightness %d, %v", v, err)
+	}
+	var lerr *LEDError
+	if _, err := NewSysfsLED("beaglebone:green:usr4"); !errors.As(err, &lerr) || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing LED: %v", err)
+	}
+}
+
+func Test_SysfsLEDSetBrightness(t *testing.T) {
+	dir := useWritableLEDTree(t)
+	logger := new(recordingLogger)
+	led, err := NewSysfsLED(LED_USR0, LEDWithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = led.Off(); err != nil {
+		t.Fatal(err)
+	}
+	if trigger, brightness := readLEDAttr(t, dir, LED_USR0, "trigger"), readLEDAttr(t, dir, LED_USR0, "brightness"); trigger != "none" || brightness != "0" {
+		t.Errorf("after Off: trigger %q, brightness %q", trigger, brightness)
+	}
+	if !logger.contains("SysfsLED: trigger switched off for the brightness [led beaglebone:green:usr0 trigger heartbeat]") {
+		t.Errorf("logged %v", logger.lines)
+	}
+	// like the kernel, which lists all triggers again. Without a trigger nothing is written to it.
+	setLEDAttr(dir, LED_USR0, "trigger", "[none] timer heartbeat")
+	if err = led.On(); err != nil {
+		t.Fatal(err)
+	}
+	if trigger, brightness := readLEDAttr(t, dir, LED_USR0, "trigger"), readLEDAttr(t, dir, LED_USR0, "brightness"); trigger != "[none] timer heartbeat" || brightness != "1" {
+		t.Errorf("after On: trigger %q, brightness %q", trigger, brightness)
+	}
+	for _, v := range []int{-1, 2} {
+		if err = led.SetBrightness(v); !errors.Is(err, ErrOutOfRange) {
+			t.Errorf("brightness %d: %v", v, err)
+		}
+	}
+	setLEDAttr(dir, LED_USR0, "trigger", "none timer heartbeat")
+	if err = led.On(); !errors.Is(err, ErrInvalidAttribute) {
+		t.Errorf("trigger file without selection: %v", err)
+	}
+}
+
+func Test_SysfsLEDSetTrigger(t *testing.T) {
+	dir := useWritableLEDTree(t)
+	led := NewSysfsLEDOrPanic(LED_USR1)
+	if err := led.SetTrigger("timer"); err != nil {
+		t.Fatal(err)
+	}
+	if trigger := readLEDAttr(t, dir, LED_USR1, "trigger"); trigger != "timer" {
+		t.Errorf("trigger %q", trigger)
+	}
+	setLEDAttr(dir, LED_USR1, "trigger", "none [timer] heartbeat")
+	err := led.SetTrigger("blink")
+	var lerr *LEDError
+	if !errors.As(err, &lerr) || lerr.Op != "set trigger" || !errors.Is(err, ErrNotSupported) || !strings.Contains(err.Error(), "none timer heartbeat") {
+		t.Errorf("unknown trigger: %v", err)
+	}
+	// selected already, not written again
+	if err = led.SetTrigger("timer"); err != nil || readLEDAttr(t, dir, LED_USR1, "trigger") != "none [timer] heartbeat" {
+		t.Errorf("same trigger: %v", err)
+	}
+	if trigger, err := led.Trigger(); err != nil || trigger != "timer" {
+		t.Errorf("Trigger() = %q, %v", trigger, err)
+	}
+}
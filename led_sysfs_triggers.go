@@ -0,0 +1,72 @@
+package bbhw
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Blinks the LED with the timer trigger (kernel module ledtrig-timer): on for on, off for off, in whole milliseconds.
+// The delay files only appear once the trigger is selected, they are waited for (see LEDWithTriggerWaitTimeout).
+func (led *SysfsLED) SetTimerTrigger(on, off time.Duration) error {
+	if on < 0 || off < 0 {
+		return led.wrapErr("set timer trigger", fmt.Errorf("on %v, off %v: %w", on, off, ErrOutOfRange))
+	}
+	led.lock.Lock()
+	defer led.lock.Unlock()
+	if err := led.selectTriggerWithParams("timer", "ledtrig-timer", "delay_on", "delay_off"); err != nil {
+		return err
+	}
+	if err := led.write("delay_on", strconv.FormatInt(on.Milliseconds(), 10), "set delay_on"); err != nil {
+		return err
+	}
+	return led.write("delay_off", strconv.FormatInt(off.Milliseconds(), 10), "set delay_off")
+}
+
+// Lights the LED once for duration (whole milliseconds) with the oneshot trigger (kernel module ledtrig-oneshot),
+// or darkens it once if invert, in which case it stays lit between shots. Calls while a shot and the delay_off
+// after it run are ignored by the kernel. Waits for the parameter files like SetTimerTrigger.
+func (led *SysfsLED) Oneshot(duration time.Duration, invert bool) error {
+	if duration <= 0 {
+		return led.wrapErr("oneshot", fmt.Errorf("duration %v: %w", duration, ErrOutOfRange))
+	}
+	led.lock.Lock()
+	defer led.lock.Unlock()
+	if err := led.selectTriggerWithParams("oneshot", "ledtrig-oneshot", "delay_on", "invert", "shot"); err != nil {
+		return err
+	}
+	inv := "0"
+	if invert {
+		inv = "1"
+	}
+	if err := led.write("invert", inv, "set invert"); err != nil {
+		return err
+	}
+	if err := led.write("delay_on", strconv.FormatInt(duration.Milliseconds(), 10), "set delay_on"); err != nil {
+		return err
+	}
+	return led.write("shot", "1", "shot")
+}
+
+// selects trigger and waits for its parameter files, the caller holds lock
+func (led *SysfsLED) selectTriggerWithParams(trigger, module string, params ...string) error {
+	if err := led.setTrigger(trigger, module); err != nil {
+		return err
+	}
+	paths := make([]string, len(params))
+	for i, p := range params {
+		paths[i] = led.path(p)
+	}
+	start := time.Now()
+	retries, err := waitWritable(led.trigger_wait, paths...)
+	if err == nil {
+		if retries > 0 {
+			led.log(LOG_DEBUG, "trigger parameters accessible", "trigger", trigger, "retries", retries, "waited", time.Since(start))
+		}
+		return nil
+	}
+	if led.trigger_wait == 0 {
+		return nil // not waiting, writing them reports the error
+	}
+	return led.wrapErr(fmt.Sprintf("wait %v for the parameters of trigger %s", led.trigger_wait, trigger), err)
+}
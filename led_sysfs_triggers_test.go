@@ -0,0 +1,109 @@
+package bbhw
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// like the kernel and udev, makes the parameter files of trigger appear some time after it is selected for the LED
+func emulateLEDTrigger(t *testing.T, dir, name, trigger string, delay time.Duration, params ...string) {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	t.Cleanup(func() {
+		close(stop)
+		<-done
+	})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Millisecond):
+			}
+			if b, _ := ioutil.ReadFile(filepath.Join(dir, name, "trigger")); strings.TrimSpace(string(b)) == trigger {
+				break
+			}
+		}
+		time.Sleep(delay)
+		for _, p := range params {
+			ioutil.WriteFile(filepath.Join(dir, name, p), []byte("0\n"), 0644)
+		}
+	}()
+}
+
+func Test_SysfsLEDTimerTrigger(t *testing.T) {
+	dir := useWritableLEDTree(t)
+	emulateLEDTrigger(t, dir, LED_USR0, "timer", 30*time.Millisecond, "delay_on", "delay_off")
+	logger := new(recordingLogger)
+	led := NewSysfsLEDOrPanic(LED_USR0, LEDWithLogger(logger))
+	if err := led.SetTimerTrigger(100*time.Millisecond, 900*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	for attr, expected := range map[string]string{"trigger": "timer", "delay_on": "100", "delay_off": "900"} {
+		if v := readLEDAttr(t, dir, LED_USR0, attr); v != expected {
+			t.Errorf("%s = %q, expected %q", attr, v, expected)
+		}
+	}
+	if !logger.contains("SysfsLED: trigger parameters accessible [led beaglebone:green:usr0 trigger timer retries") {
+		t.Errorf("logged %v", logger.lines)
+	}
+	// selected already, the parameters are there
+	setLEDAttr(dir, LED_USR0, "trigger", "none [timer] heartbeat")
+	if err := led.SetTimerTrigger(time.Second, 0); err != nil || readLEDAttr(t, dir, LED_USR0, "delay_on") != "1000" {
+		t.Errorf("timer trigger selected already: %v", err)
+	}
+	if err := led.SetTimerTrigger(-time.Millisecond, 0); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("negative delay: %v", err)
+	}
+}
+
+func Test_SysfsLEDOneshot(t *testing.T) {
+	dir := useWritableLEDTree(t)
+	emulateLEDTrigger(t, dir, LED_USR3, "oneshot", 20*time.Millisecond, "delay_on", "delay_off", "invert", "shot")
+	led := NewSysfsLEDOrPanic(LED_USR3)
+	if err := led.Oneshot(50*time.Millisecond, true); err != nil {
+		t.Fatal(err)
+	}
+	for attr, expected := range map[string]string{"trigger": "oneshot", "delay_on": "50", "invert": "1", "shot": "1"} {
+		if v := readLEDAttr(t, dir, LED_USR3, attr); v != expected {
+			t.Errorf("%s = %q, expected %q", attr, v, expected)
+		}
+	}
+	if err := led.Oneshot(0, false); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("no duration: %v", err)
+	}
+}
+
+func Test_SysfsLEDTriggerErrors(t *testing.T) {
+	dir := useWritableLEDTree(t)
+	// the parameter files never appear
+	led := NewSysfsLEDOrPanic(LED_USR2, LEDWithTriggerWaitTimeout(20*time.Millisecond))
+	err := led.SetTimerTrigger(time.Second, time.Second)
+	if !errors.Is(err, os.ErrNotExist) || !strings.Contains(err.Error(), "wait 20ms for the parameters of trigger timer") {
+		t.Errorf("parameters missing: %v", err)
+	}
+	led = NewSysfsLEDOrPanic(LED_USR1, LEDWithTriggerWaitTimeout(0))
+	var lerr *LEDError
+	if err = led.Oneshot(time.Second, false); !errors.As(err, &lerr) || lerr.Op != "set invert" || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("parameters missing without waiting: %v", err)
+	}
+	// a kernel without the trigger modules
+	setLEDAttr(dir, LED_USR1, "trigger", "[none] heartbeat mmc0")
+	for module, set := range map[string]func() error{
+		"ledtrig-timer":   func() error { return led.SetTimerTrigger(time.Second, time.Second) },
+		"ledtrig-oneshot": func() error { return led.Oneshot(time.Second, false) },
+	} {
+		if err = set(); !errors.Is(err, ErrNotSupported) || !strings.Contains(err.Error(), module) {
+			t.Errorf("without %s: %v", module, err)
+		}
+	}
+	if trigger := readLEDAttr(t, dir, LED_USR1, "trigger"); trigger != "[none] heartbeat mmc0" {
+		t.Errorf("trigger written: %q", trigger)
+	}
+}
@@ -0,0 +1,79 @@
+package bbhw
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+// Levels passed to Logger.Log
+const (
+	LOG_DEBUG = iota
+	LOG_INFO
+	LOG_WARN
+	LOG_ERROR
+)
+
+// Receives what the package has to say, e.g. export retries, ReOpen recoveries or backend fallbacks.
+// kv are alternating keys (strings) and values, which map directly onto log/slog attributes or logrus fields.
+type Logger interface {
+	Log(level int, msg string, kv ...interface{})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Log(int, string, ...interface{}) {}
+
+type loggerBox struct{ Logger }
+
+var logger_ atomic.Value
+
+func init() {
+	logger_.Store(loggerBox{nopLogger{}})
+}
+
+// Set the Logger used by the whole package, nil (the default) discards everything.
+// Pins given their own Logger (SetLogger, WithLogger, CdevWithLogger) use that instead.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = nopLogger{}
+	}
+	logger_.Store(loggerBox{l})
+}
+
+// l if set, otherwise the package Logger
+func loggerOr(l Logger) Logger {
+	if l != nil {
+		return l
+	}
+	return logger_.Load().(loggerBox).Logger
+}
+
+type stdLogger struct {
+	l *log.Logger
+}
+
+// Adapter writing "msg key=value ..." lines to a *log.Logger, WARN and ERROR messages prefixed as such
+func NewStdLogger(l *log.Logger) Logger {
+	return stdLogger{l}
+}
+
+func (s stdLogger) Log(level int, msg string, kv ...interface{}) {
+	var b strings.Builder
+	switch level {
+	case LOG_WARN:
+		b.WriteString("WARN ")
+	case LOG_ERROR:
+		b.WriteString("ERROR ")
+	}
+	b.WriteString(msg)
+	for i := 0; i < len(kv); i += 2 {
+		if i+1 < len(kv) {
+			fmt.Fprintf(&b, " %v=%v", kv[i], kv[i+1])
+		} else {
+			fmt.Fprintf(&b, " %v", kv[i])
+		}
+	}
+	s.l.Print(b.String())
+}
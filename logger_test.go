@@ -0,0 +1,84 @@
+package bbhw
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type recordingLogger struct {
+	lines []string
+	lock  sync.Mutex
+}
+
+func (r *recordingLogger) Log(level int, msg string, kv ...interface{}) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.lines = append(r.lines, fmt.Sprintf("%d %s %v", level, msg, kv))
+}
+
+func (r *recordingLogger) contains(s string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, line := range r.lines {
+		if strings.Contains(line, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func useLogger(t *testing.T, l Logger) {
+	SetLogger(l)
+	t.Cleanup(func() { SetLogger(nil) })
+}
+
+func Test_LoggerGlobalAndPerPin(t *testing.T) {
+	global := new(recordingLogger)
+	useLogger(t, global)
+	useFakeSysfsGPIOTree(t, 44)
+	gpio, err := NewSysfsGPIOWithOptions(44, WithAttach())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gpio.Close()
+	if err = gpio.ReOpen(); err != nil {
+		t.Fatal(err)
+	}
+	if !global.contains("reopened value file [gpio 44]") {
+		t.Error("ReOpen not logged to the package Logger:", global.lines)
+	}
+	pin := new(recordingLogger)
+	gpio.SetLogger(pin)
+	gpio.ReOpen()
+	if len(global.lines) != 1 || !pin.contains("reopened") {
+		t.Errorf("per-pin Logger ignored, global %v, pin %v", global.lines, pin.lines)
+	}
+	_, err = NewSysfsGPIOWithOptions(45, WithLogger(pin))
+	if err == nil || !pin.contains("exporting [gpio 45]") {
+		t.Error("export not logged to WithLogger:", err, pin.lines)
+	}
+}
+
+func Test_StdLoggerAdapter(t *testing.T) {
+	var buf bytes.Buffer
+	NewStdLogger(log.New(&buf, "", 0)).Log(LOG_WARN, "backend failed", "gpio", 44, "err", "boom")
+	if got := buf.String(); got != "WARN backend failed gpio=44 err=boom\n" {
+		t.Errorf("got %q", got)
+	}
+	buf.Reset()
+	gpio := NewFakeNamedGPIO("led", OUT, log.New(&buf, "", 0))
+	gpio.SetState(true)
+	if got := buf.String(); got != "FakeGPIO: set to virtual electrical state >true< gpio=led direction=OUT\n" {
+		t.Errorf("FakeGPIO logged %q", got)
+	}
+	rec := new(recordingLogger)
+	gpio.SetLogger(rec)
+	gpio.SetState(false)
+	if !rec.contains("led") || strings.Count(buf.String(), "\n") != 1 {
+		t.Error("FakeGPIO.SetLogger ignored:", rec.lines)
+	}
+}
@@ -3,7 +3,6 @@ package bbhw
 import (
 	"fmt"
 	"os"
-	"reflect"
 	"sync"
 	"syscall"
 	"unsafe"
@@ -65,19 +64,11 @@ func verifyAddrIsTIOmap4(addr uint) bool {
 //warning: you must keep the []byte array/slice around
 //so that the []uint32 data will not be garbage collected
 func castByteSliceToUint32Slice(raw []byte) []uint32 {
-	rawlen := len(raw)
-	// Copy the slice header
-	header := *(*reflect.SliceHeader)(unsafe.Pointer(&raw))
-
-	// The length and capacity of the slice are different.
-	header.Len /= BYTES_IN_UINT32
-	header.Cap /= BYTES_IN_UINT32
-
-	// Convert slice header to an []int32
-	if rawlen != len(raw) {
-		panic("NO we did NOT want to change the []byte slice, just create a []uint32 slice pointing to the same data")
+	if len(raw) < BYTES_IN_UINT32 {
+		return nil
 	}
-	return *(*[]uint32)(unsafe.Pointer(&header))
+	// create a []uint32 slice pointing to the same data, without copying it
+	return unsafe.Slice((*uint32)(unsafe.Pointer(&raw[0])), len(raw)/BYTES_IN_UINT32)
 }
 
 func newGPIORegMMap() (mmapreg *mappedRegisters, err error) {
@@ -158,14 +149,22 @@ func (mmapreg *mappedRegisters) setDebounceTime(gpiochip int, dbt byte) error {
 }
 
 func getgpiommap() *mappedRegisters {
+	mmapreg, err := getgpiommapOrError()
+	if err != nil {
+		panic(err)
+	}
+	return mmapreg
+}
+
+func getgpiommapOrError() (*mappedRegisters, error) {
 	if mmapped_gpio_register_ == nil {
 		var err error
 		mmapped_gpio_register_, err = newGPIORegMMap()
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
 	}
-	return mmapped_gpio_register_
+	return mmapped_gpio_register_, nil
 }
 
 //careful with this function! never call it
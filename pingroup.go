@@ -0,0 +1,93 @@
+package bbhw
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Named pins constructed together, e.g. from name→number pairs of a config file.
+// Created by NewSysfsPinGroup, or NewFakePinGroup to test the wiring code of an application unchanged.
+type PinGroup struct {
+	pins map[string]GPIO
+}
+
+// Exports and opens all pins with the direction of the same name.
+// On failure, the pins already opened are closed again and the error names the failing pin.
+func NewSysfsPinGroup(pins map[string]uint, directions map[string]Direction) (*PinGroup, error) {
+	return newPinGroup(pins, directions, func(name string, number uint, direction Direction) (GPIO, error) {
+		return NewSysfsGPIO(number, direction)
+	})
+}
+
+// Same as NewSysfsPinGroup, but made of FakeGPIOs named like the pins
+func NewFakePinGroup(pins map[string]uint, directions map[string]Direction) (*PinGroup, error) {
+	return newPinGroup(pins, directions, func(name string, number uint, direction Direction) (GPIO, error) {
+		if err := validateDirection(direction); err != nil {
+			return nil, err
+		}
+		return NewFakeNamedGPIO(name, direction, nil), nil
+	})
+}
+
+func newPinGroup(pins map[string]uint, directions map[string]Direction, newgpio func(string, uint, Direction) (GPIO, error)) (*PinGroup, error) {
+	group := &PinGroup{pins: make(map[string]GPIO, len(pins))}
+	for _, name := range sortedPinNames(pins) {
+		direction, ok := directions[name]
+		if !ok {
+			group.CloseAll()
+			return nil, fmt.Errorf("pin %q: no direction given", name)
+		}
+		gpio, err := newgpio(name, pins[name], direction)
+		if err != nil {
+			group.CloseAll()
+			return nil, fmt.Errorf("pin %q (gpio%d): %w", name, pins[name], err)
+		}
+		group.pins[name] = gpio
+	}
+	return group, nil
+}
+
+func sortedPinNames(pins map[string]uint) []string {
+	names := make([]string, 0, len(pins))
+	for name := range pins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// The pin called name, nil if there is none
+func (group *PinGroup) Get(name string) GPIO {
+	return group.pins[name]
+}
+
+// Names of all pins, sorted
+func (group *PinGroup) Names() []string {
+	names := make([]string, 0, len(group.pins))
+	for name := range group.pins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Snapshots of all pins by name. Snapshots without a name get the one of the pin in the group
+func (group *PinGroup) SnapshotAll() map[string]PinSnapshot {
+	snapshots := make(map[string]PinSnapshot, len(group.pins))
+	for name, gpio := range group.pins {
+		s := gpio.Snapshot()
+		if s.Name == "" {
+			s.Name = name
+		}
+		snapshots[name] = s
+	}
+	return snapshots
+}
+
+// Closes all pins, the group is empty afterwards
+func (group *PinGroup) CloseAll() {
+	for name, gpio := range group.pins {
+		gpio.Close()
+		delete(group.pins, name)
+	}
+}
@@ -0,0 +1,48 @@
+package bbhw
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_FakePinGroup(t *testing.T) {
+	group, err := NewFakePinGroup(map[string]uint{"led": 44, "button": 45}, map[string]Direction{"led": OUT, "button": IN})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := group.Names(); len(names) != 2 || names[0] != "button" || names[1] != "led" {
+		t.Error("Names() =", names)
+	}
+	group.Get("led").SetState(true)
+	snapshots := group.SnapshotAll()
+	if s := snapshots["led"]; s.Name != "led" || s.Direction != OUT || !s.State {
+		t.Errorf("led snapshot %+v", s)
+	}
+	if group.Get("fan") != nil {
+		t.Error("unknown pin is not nil")
+	}
+	group.CloseAll()
+	if len(group.Names()) != 0 {
+		t.Error("CloseAll left pins behind")
+	}
+	if _, err = NewFakePinGroup(map[string]uint{"led": 44}, nil); err == nil || !strings.Contains(err.Error(), `"led"`) {
+		t.Error("missing direction not reported:", err)
+	}
+}
+
+func Test_SysfsPinGroupClosesOnFailure(t *testing.T) {
+	useFakeSysfsGPIOTree(t, 44, 45)
+	group, err := NewSysfsPinGroup(map[string]uint{"led": 44, "button": 45}, map[string]Direction{"led": OUT, "button": IN})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := group.SnapshotAll()["button"]; s.Name != "button" || s.Number != 45 || s.Backend != BACKEND_SYSFS {
+		t.Errorf("button snapshot %+v", s)
+	}
+	group.CloseAll()
+	// "a" is opened first, "b" fails since the fake tree has no gpio46
+	_, err = NewSysfsPinGroup(map[string]uint{"a": 44, "b": 46}, map[string]Direction{"a": OUT, "b": OUT})
+	if err == nil || !strings.Contains(err.Error(), `pin "b" (gpio46)`) {
+		t.Error("failing pin not named:", err)
+	}
+}
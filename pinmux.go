@@ -0,0 +1,152 @@
+package bbhw
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// returned (wrapped) by NewSysfsGPIOWithOptions(WithPinmuxCheck()) for pins muxed to other functions
+var ErrPinNotGPIO = errors.New("pin is not in gpio mode")
+
+var (
+	debugfs_pinctrl_dir_ = "/sys/kernel/debug/pinctrl"
+	ocp_pinmux_dir_      = "/sys/devices/platform/ocp"
+)
+
+// Which function currently owns a header pin, see CheckPinmux
+type PinmuxInfo struct {
+	Pin       string // header pin, e.g. P8_12
+	Pad       int    // pin number of the pin controller, -1 if unknown
+	MuxOwner  string // device which claimed the pin mux, e.g. ocp:P8_12_pinmux or mmc1, "" if unclaimed
+	GPIOOwner string // GPIO claiming the pin, "" if unclaimed
+	Function  string // pinmux helper state (e.g. gpio, gpio_pu, pwm) or pinctrl function
+	IsGPIO    bool   // the pin is muxed as GPIO
+}
+
+// AM335x pin controller pads (conf register offset from 0x800, divided by 4) by GPIO number
+var am335x_pads_ = map[int]int{
+	2: 84, 3: 85, 4: 86, 5: 87, 7: 89, 8: 52, 9: 53, 10: 54, 11: 55, 12: 94, 13: 95, 14: 96, 15: 97,
+	19: 108, 20: 109, 22: 8, 23: 9, 26: 10, 27: 11, 30: 28, 31: 29,
+	32: 0, 33: 1, 34: 2, 35: 3, 36: 4, 37: 5, 38: 6, 39: 7, 40: 90, 41: 91, 42: 92, 43: 93,
+	44: 12, 45: 13, 46: 14, 47: 15, 48: 16, 49: 17, 50: 18, 51: 19, 52: 20,
+	57: 25, 58: 26, 59: 27, 60: 30, 61: 31, 62: 32, 63: 33, 64: 34, 65: 35,
+	66: 36, 67: 37, 68: 38, 69: 39, 70: 40, 71: 41, 72: 42, 73: 43, 74: 44, 75: 45, 76: 46, 77: 47,
+	78: 48, 79: 49, 80: 50, 81: 51, 86: 56, 87: 57, 88: 58, 89: 59,
+	110: 100, 111: 101, 112: 102, 113: 103, 114: 104, 115: 105, 116: 106, 117: 107,
+}
+
+// Reports which function currently owns a header pin of the current board (see SetBoard).
+// Uses the state file of the ocp pinmux helper (cape-universal) if present,
+// otherwise /sys/kernel/debug/pinctrl/*/pinmux-pins, which needs debugfs and root.
+// Helps with "SetState succeeds but the pin does not move".
+func CheckPinmux(pin string) (PinmuxInfo, error) {
+	board := currentBoard()
+	p, err := board.lookupPin(pin)
+	if err != nil {
+		return PinmuxInfo{}, err
+	}
+	if p.gpio < 0 {
+		return PinmuxInfo{}, fmt.Errorf("header pin %s is %s, not a GPIO", p.name, p.function)
+	}
+	info := PinmuxInfo{Pin: p.name, Pad: -1}
+	if pad, ok := am335x_pads_[p.gpio]; ok && board.name != BOARD_BEAGLEBONE_AI {
+		info.Pad = pad
+	}
+	helper := "ocp:" + p.name + "_pinmux"
+	if state, err := ioutil.ReadFile(filepath.Join(ocp_pinmux_dir_, helper, "state")); err == nil {
+		info.MuxOwner = helper
+		info.Function = strings.TrimSpace(string(state))
+		info.IsGPIO = info.isGPIOState()
+		return info, nil
+	}
+	if info.Pad < 0 {
+		return info, fmt.Errorf("no pinmux helper for %s and pads of %s unknown: %w", p.name, board.name, ErrNotSupported)
+	}
+	files, _ := filepath.Glob(filepath.Join(debugfs_pinctrl_dir_, "44e10800.*", "pinmux-pins"))
+	err = os.ErrNotExist
+	for _, file := range files {
+		var data []byte
+		if data, err = ioutil.ReadFile(file); err != nil {
+			continue
+		}
+		if parsePinmuxPins(data, &info) {
+			return info, nil
+		}
+		err = fmt.Errorf("pin %d not listed in %s", info.Pad, file)
+	}
+	return info, fmt.Errorf("can not determine the pinmux of %s (debugfs mounted? running as root?): %w", p.name, err)
+}
+
+// Finds info.Pad in the contents of a pinmux-pins file and fills in the owners.
+// Lines look like this (the pin name differs between 4.x and 5.x kernels):
+//
+//	pin 12 (44e10830.0): ocp:P8_12_pinmux (GPIO UNCLAIMED) function pinmux_P8_12_default_pin group pinmux_P8_12_default_pin
+//	pin 12 (PIN12): (MUX UNCLAIMED) 44e07000.gpio:44
+//
+// strict pin controllers print a single owner, "GPIO <owner>" or "UNCLAIMED" instead.
+func parsePinmuxPins(data []byte, info *PinmuxInfo) bool {
+	prefix := fmt.Sprintf("pin %d (", info.Pad)
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+		i := strings.Index(line, "): ")
+		if i < 0 {
+			return false
+		}
+		rest := line[i+3:]
+		if f := strings.Index(rest, " function "); f >= 0 {
+			if fields := strings.Fields(rest[f:]); len(fields) >= 2 {
+				info.Function = fields[1]
+			}
+			rest = rest[:f]
+		}
+		rest = strings.TrimSuffix(strings.TrimSpace(rest), " (HOG)")
+		rest = strings.NewReplacer("(MUX UNCLAIMED)", "-", "(GPIO UNCLAIMED)", "-").Replace(rest)
+		switch fields := strings.Fields(rest); {
+		case len(fields) == 2 && fields[0] == "GPIO":
+			info.GPIOOwner = fields[1]
+		case len(fields) == 2:
+			info.MuxOwner, info.GPIOOwner = fields[0], fields[1]
+		case len(fields) == 1 && fields[0] != "UNCLAIMED":
+			info.MuxOwner = fields[0]
+		}
+		if info.MuxOwner == "-" {
+			info.MuxOwner = ""
+		}
+		if info.GPIOOwner == "-" {
+			info.GPIOOwner = ""
+		}
+		// pinmux helper functions are named pinmux_P8_12_<state>_pin
+		if strings.HasSuffix(info.MuxOwner, "_pinmux") {
+			info.Function = strings.TrimSuffix(strings.TrimPrefix(info.Function, "pinmux_"+info.Pin+"_"), "_pin")
+		}
+		info.IsGPIO = info.GPIOOwner != "" || info.isGPIOState()
+		return true
+	}
+	return false
+}
+
+// the default state of the cape-universal pinmux helpers is gpio as well
+func (info *PinmuxInfo) isGPIOState() bool {
+	if info.MuxOwner == "" {
+		return false
+	}
+	return strings.Contains(info.Function, "gpio") || (strings.HasSuffix(info.MuxOwner, "_pinmux") && info.Function == "default")
+}
+
+// human readable owner, for error messages
+func (info PinmuxInfo) describe() string {
+	switch {
+	case info.MuxOwner == "":
+		return "not claimed by any driver, its mux mode is unknown"
+	case info.Function != "":
+		return fmt.Sprintf("muxed by %s to %s", info.MuxOwner, info.Function)
+	default:
+		return "muxed by " + info.MuxOwner
+	}
+}
@@ -0,0 +1,99 @@
+package bbhw
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// points CheckPinmux at a debugfs containing fixture and an ocp dir without pinmux helpers, returns the latter
+func usePinmuxFixture(t *testing.T, fixture string) string {
+	t.Helper()
+	data, err := ioutil.ReadFile(filepath.Join("testdata", fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	debugfs, ocp := t.TempDir(), t.TempDir()
+	os.Mkdir(filepath.Join(debugfs, "44e10800.pinmux"), 0755)
+	if err = ioutil.WriteFile(filepath.Join(debugfs, "44e10800.pinmux", "pinmux-pins"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	saved_debugfs, saved_ocp := debugfs_pinctrl_dir_, ocp_pinmux_dir_
+	debugfs_pinctrl_dir_, ocp_pinmux_dir_ = debugfs, ocp
+	t.Cleanup(func() { debugfs_pinctrl_dir_, ocp_pinmux_dir_ = saved_debugfs, saved_ocp })
+	return ocp
+}
+
+func Test_CheckPinmuxFixtures(t *testing.T) {
+	useBoard(t, BOARD_BEAGLEBONE)
+	for _, tc := range []struct {
+		fixture, pin        string
+		mux, gpio, function string
+		isgpio              bool
+	}{
+		{"pinmux-pins-4.14", "P8_12", "ocp:P8_12_pinmux", "", "gpio_pu", true},
+		{"pinmux-pins-4.14", "P8_13", "ocp:P8_13_pinmux", "", "default", true},
+		{"pinmux-pins-4.14", "P8_19", "ocp:P8_19_pinmux", "", "pwm", false},
+		{"pinmux-pins-4.14", "P8_03", "mmc1", "", "pinmux_emmc_pins", false},
+		{"pinmux-pins-4.14", "P8_11", "", "", "", false},
+		{"pinmux-pins-4.14", "P8_16", "", "gpio-32-63:46", "", true},
+		{"pinmux-pins-5.10", "P8_12", "ocp:P8_12_pinmux", "4804c000.gpio:44", "default", true},
+		{"pinmux-pins-5.10", "P8_19", "ocp:P8_19_pinmux", "", "pwm", false},
+		{"pinmux-pins-5.10", "P8_25", "481d8000.mmc", "", "pinmux_emmc_pins", false},
+		{"pinmux-pins-5.10", "P8_11", "", "", "", false},
+		{"pinmux-pins-5.10", "P8_16", "", "4804c000.gpio:46", "", true},
+		{"pinmux-pins-5.10", "P8_27", "0-0070", "", "nxp_hdmi_bonelt_pins", false},
+	} {
+		usePinmuxFixture(t, tc.fixture)
+		info, err := CheckPinmux(tc.pin)
+		if err != nil {
+			t.Errorf("%s %s: %v", tc.fixture, tc.pin, err)
+			continue
+		}
+		if info.MuxOwner != tc.mux || info.GPIOOwner != tc.gpio || info.Function != tc.function || info.IsGPIO != tc.isgpio {
+			t.Errorf("%s %s: got %+v", tc.fixture, tc.pin, info)
+		}
+	}
+	usePinmuxFixture(t, "pinmux-pins-5.10")
+	if _, err := CheckPinmux("P8_26"); err == nil {
+		t.Error("pin missing from pinmux-pins did not fail")
+	}
+	if _, err := CheckPinmux("P9_01"); err == nil {
+		t.Error("GND has a pinmux")
+	}
+}
+
+func Test_CheckPinmuxHelperState(t *testing.T) {
+	useBoard(t, BOARD_BEAGLEBONE_AI)
+	ocp := usePinmuxFixture(t, "pinmux-pins-4.14")
+	if _, err := CheckPinmux("P8_12"); !errors.Is(err, ErrNotSupported) {
+		t.Error("BeagleBone AI without pinmux helper:", err)
+	}
+	os.Mkdir(filepath.Join(ocp, "ocp:P8_12_pinmux"), 0755)
+	ioutil.WriteFile(filepath.Join(ocp, "ocp:P8_12_pinmux", "state"), []byte("gpio_pd\n"), 0644)
+	info, err := CheckPinmux("p8.12")
+	if err != nil || !info.IsGPIO || info.Function != "gpio_pd" || info.Pad != -1 {
+		t.Errorf("CheckPinmux = %+v, %v", info, err)
+	}
+}
+
+func Test_SysfsGPIOWithPinmuxCheck(t *testing.T) {
+	useBoard(t, BOARD_BEAGLEBONE)
+	usePinmuxFixture(t, "pinmux-pins-4.14")
+	useFakeSysfsGPIOTree(t, 44, 60)
+	gpio, err := NewSysfsGPIOWithOptions(44, WithAttach(), WithPinmuxCheck())
+	if err != nil {
+		t.Fatal(err)
+	}
+	gpio.Close()
+	// P8_19 is muxed to pwm
+	if _, err = NewSysfsGPIOWithOptions(22, WithAttach(), WithPinmuxCheck()); !errors.Is(err, ErrPinNotGPIO) {
+		t.Error("expected ErrPinNotGPIO, got", err)
+	}
+	// P9_12 is not listed in the fixture
+	if _, err = NewSysfsGPIOWithOptions(60, WithAttach(), WithPinmuxCheck()); err == nil {
+		t.Error("unknown pinmux did not fail")
+	}
+}
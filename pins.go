@@ -0,0 +1,167 @@
+package bbhw
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Boards known to SetBoard
+const (
+	BOARD_BEAGLEBONE    = "beaglebone" // Black and Green
+	BOARD_POCKETBEAGLE  = "pocketbeagle"
+	BOARD_BEAGLEBONE_AI = "beaglebone-ai"
+)
+
+// A pin of an expansion header
+type headerPin struct {
+	name     string // canonical name, e.g. P8_07
+	gpio     int    // sysfs GPIO number, -1 if the pin is not GPIO capable
+	function string // what the pin is if it is not a GPIO, e.g. GND or AIN0
+	conflict string // function the pin is muxed to by default, preventing GPIO use
+}
+
+// An analog input on an expansion header
+type analogPin struct {
+	name    string // e.g. AIN3
+	pin     string // canonical header pin name, e.g. P9_38
+	channel uint   // N of in_voltageN_raw
+}
+
+type boardPins struct {
+	name   string
+	model  string // substring of the device tree model identifying the board
+	pins   []headerPin
+	analog []analogPin
+}
+
+// most specific model first, "BeagleBone AI" also contains "BeagleBone"
+var boards_ = []boardPins{
+	{BOARD_BEAGLEBONE_AI, "BeagleBone AI", bbai_pins_, bbai_analog_pins_},
+	{BOARD_POCKETBEAGLE, "PocketBeagle", pocketbeagle_pins_, pocketbeagle_analog_pins_},
+	{BOARD_BEAGLEBONE, "BeagleBone", bbb_pins_, bbb_analog_pins_},
+}
+
+var device_tree_model_path_ = "/proc/device-tree/model"
+
+var (
+	board_      *boardPins // nil until detected or set
+	board_lock_ sync.Mutex
+)
+
+// Board from the device tree model, BOARD_BEAGLEBONE if that is unknown or not readable
+func detectBoard() *boardPins {
+	model, err := ioutil.ReadFile(device_tree_model_path_)
+	if err == nil {
+		for i := range boards_ {
+			if strings.Contains(string(model), boards_[i].model) {
+				return &boards_[i]
+			}
+		}
+	}
+	return &boards_[len(boards_)-1]
+}
+
+func currentBoard() *boardPins {
+	board_lock_.Lock()
+	defer board_lock_.Unlock()
+	if board_ == nil {
+		board_ = detectBoard()
+	}
+	return board_
+}
+
+// Select the pin table used by GPIONumberForPin and friends, one of the BOARD_* constants.
+// By default the board is detected from /proc/device-tree/model, SetBoard("") goes back to that.
+func SetBoard(board string) error {
+	board_lock_.Lock()
+	defer board_lock_.Unlock()
+	if board == "" {
+		board_ = nil
+		return nil
+	}
+	names := make([]string, len(boards_))
+	for i := range boards_ {
+		if strings.EqualFold(board, boards_[i].name) {
+			board_ = &boards_[i]
+			return nil
+		}
+		names[i] = boards_[i].name
+	}
+	return fmt.Errorf("unknown board %q, supported are: %s", board, strings.Join(names, ", "))
+}
+
+// Name of the board whose pin table is in use
+func Board() string {
+	return currentBoard().name
+}
+
+var pin_name_re_ = regexp.MustCompile(`^(P\d+)[_.\-]?0*(\d+)$`)
+
+// "p8.7", "P8-07" or "P8_07" become "P8_07"
+func normalizePinName(pin string) (string, bool) {
+	m := pin_name_re_.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(pin)))
+	if m == nil {
+		return "", false
+	}
+	n, _ := strconv.Atoi(m[2])
+	return fmt.Sprintf("%s_%02d", m[1], n), true
+}
+
+func (board *boardPins) lookupPin(pin string) (headerPin, error) {
+	name, ok := normalizePinName(pin)
+	if ok {
+		for _, p := range board.pins {
+			if p.name == name {
+				return p, nil
+			}
+		}
+	}
+	return headerPin{}, fmt.Errorf("unknown header pin %q on %s, expected something like %s", pin, board.name, board.pins[len(board.pins)/2].name)
+}
+
+// Returns the GPIO number (as used by NewSysfsGPIO and friends) of a header pin of the current board (see SetBoard),
+// e.g. 44 for "P8_12" on a BeagleBone Black.
+// Case-insensitive, accepts "P8_12", "P8.12", "P8-12" and "P8_7" for "P8_07".
+// Pins which are not GPIO capable (power, ground, analog inputs) return an error.
+func GPIONumberForPin(pin string) (uint, error) {
+	p, err := currentBoard().lookupPin(pin)
+	if err != nil {
+		return 0, err
+	}
+	if p.gpio < 0 {
+		return 0, fmt.Errorf("header pin %s is %s, not a GPIO", p.name, p.function)
+	}
+	return uint(p.gpio), nil
+}
+
+// Inverse of GPIONumberForPin, returns the header pin a GPIO is routed to, e.g. "P8_12" for 44
+func PinForGPIO(number uint) (string, error) {
+	board := currentBoard()
+	for _, p := range board.pins {
+		if p.gpio == int(number) {
+			return p.name, nil
+		}
+	}
+	return "", fmt.Errorf("gpio%d is not routed to a header pin on %s", number, board.name)
+}
+
+// Instantinate a new SysfsGPIO by header pin name, e.g. "P8_12", see GPIONumberForPin.
+// For pins used by other functions by default (eMMC, HDMI), failures mention that.
+func NewSysfsGPIOForPin(pin string, direction Direction) (*SysfsGPIO, error) {
+	number, err := GPIONumberForPin(pin)
+	if err != nil {
+		return nil, err
+	}
+	gpio, err := NewSysfsGPIO(number, direction)
+	if err != nil {
+		if p, _ := currentBoard().lookupPin(pin); p.conflict != "" {
+			return nil, fmt.Errorf("%s (gpio%d) is used by %s by default, disable that (e.g. in /boot/uEnv.txt) to use it as GPIO: %w", p.name, number, p.conflict, err)
+		}
+		return nil, err
+	}
+	return gpio, nil
+}
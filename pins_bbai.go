@@ -0,0 +1,110 @@
+package bbhw
+
+// P8 and P9 headers of the BeagleBone AI (AM5729, GPIO number = (bank-1)*32 + bit).
+// Several header pins are wired to two SoC balls, listed is the GPIO of the ball muxed to the header by default.
+var bbai_pins_ = []headerPin{
+	{"P8_01", -1, "GND", ""},
+	{"P8_02", -1, "GND", ""},
+	{"P8_03", 24, "", ""},
+	{"P8_04", 25, "", ""},
+	{"P8_05", 193, "", ""},
+	{"P8_06", 194, "", ""},
+	{"P8_07", 165, "", ""},
+	{"P8_08", 166, "", ""},
+	{"P8_09", 178, "", ""},
+	{"P8_10", 164, "", ""},
+	{"P8_11", 75, "", ""},
+	{"P8_12", 74, "", ""},
+	{"P8_13", 107, "", ""},
+	{"P8_14", 109, "", ""},
+	{"P8_15", 99, "", ""},
+	{"P8_16", 125, "", ""},
+	{"P8_17", 242, "", ""},
+	{"P8_18", 105, "", ""},
+	{"P8_19", 106, "", ""},
+	{"P8_20", 190, "", ""},
+	{"P8_21", 189, "", ""},
+	{"P8_22", 23, "", ""},
+	{"P8_23", 22, "", ""},
+	{"P8_24", 192, "", ""},
+	{"P8_25", 191, "", ""},
+	{"P8_26", 124, "", ""},
+	{"P8_27", 119, "", ""},
+	{"P8_28", 115, "", ""},
+	{"P8_29", 118, "", ""},
+	{"P8_30", 116, "", ""},
+	{"P8_31", 238, "", ""},
+	{"P8_32", 239, "", ""},
+	{"P8_33", 237, "", ""},
+	{"P8_34", 235, "", ""},
+	{"P8_35", 236, "", ""},
+	{"P8_36", 234, "", ""},
+	{"P8_37", 232, "", ""},
+	{"P8_38", 233, "", ""},
+	{"P8_39", 230, "", ""},
+	{"P8_40", 231, "", ""},
+	{"P8_41", 228, "", ""},
+	{"P8_42", 229, "", ""},
+	{"P8_43", 226, "", ""},
+	{"P8_44", 227, "", ""},
+	{"P8_45", 224, "", ""},
+	{"P8_46", 225, "", ""},
+
+	{"P9_01", -1, "GND", ""},
+	{"P9_02", -1, "GND", ""},
+	{"P9_03", -1, "DC_3.3V", ""},
+	{"P9_04", -1, "DC_3.3V", ""},
+	{"P9_05", -1, "VDD_5V", ""},
+	{"P9_06", -1, "VDD_5V", ""},
+	{"P9_07", -1, "SYS_5V", ""},
+	{"P9_08", -1, "SYS_5V", ""},
+	{"P9_09", -1, "PWR_BUT", ""},
+	{"P9_10", -1, "SYS_RESETN", ""},
+	{"P9_11", 241, "", ""},
+	{"P9_12", 128, "", ""},
+	{"P9_13", 172, "", ""},
+	{"P9_14", 121, "", ""},
+	{"P9_15", 76, "", ""},
+	{"P9_16", 122, "", ""},
+	{"P9_17", 209, "", ""},
+	{"P9_18", 208, "", ""},
+	{"P9_19", 195, "", ""},
+	{"P9_20", 196, "", ""},
+	{"P9_21", 67, "", ""},
+	{"P9_22", 179, "", ""},
+	{"P9_23", 203, "", ""},
+	{"P9_24", 175, "", ""},
+	{"P9_25", 177, "", ""},
+	{"P9_26", 174, "", ""},
+	{"P9_27", 111, "", ""},
+	{"P9_28", 113, "", ""},
+	{"P9_29", 139, "", ""},
+	{"P9_30", 140, "", ""},
+	{"P9_31", 138, "", ""},
+	{"P9_32", -1, "VDD_ADC", ""},
+	{"P9_33", -1, "analog input AIN4", ""},
+	{"P9_34", -1, "GNDA_ADC", ""},
+	{"P9_35", -1, "analog input AIN6", ""},
+	{"P9_36", -1, "analog input AIN5", ""},
+	{"P9_37", -1, "analog input AIN2", ""},
+	{"P9_38", -1, "analog input AIN3", ""},
+	{"P9_39", -1, "analog input AIN0", ""},
+	{"P9_40", -1, "analog input AIN1", ""},
+	{"P9_41", 180, "", ""},
+	{"P9_42", 114, "", ""},
+	{"P9_43", -1, "GND", ""},
+	{"P9_44", -1, "GND", ""},
+	{"P9_45", -1, "GND", ""},
+	{"P9_46", -1, "GND", ""},
+}
+
+// same header positions as on the BeagleBone Black
+var bbai_analog_pins_ = []analogPin{
+	{"AIN0", "P9_39", 0},
+	{"AIN1", "P9_40", 1},
+	{"AIN2", "P9_37", 2},
+	{"AIN3", "P9_38", 3},
+	{"AIN4", "P9_33", 4},
+	{"AIN5", "P9_36", 5},
+	{"AIN6", "P9_35", 6},
+}
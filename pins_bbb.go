@@ -0,0 +1,109 @@
+package bbhw
+
+// P8 and P9 headers of the BeagleBone Black and Green
+var bbb_pins_ = []headerPin{
+	{"P8_01", -1, "GND", ""},
+	{"P8_02", -1, "GND", ""},
+	{"P8_03", 38, "", "eMMC"},
+	{"P8_04", 39, "", "eMMC"},
+	{"P8_05", 34, "", "eMMC"},
+	{"P8_06", 35, "", "eMMC"},
+	{"P8_07", 66, "", ""},
+	{"P8_08", 67, "", ""},
+	{"P8_09", 69, "", ""},
+	{"P8_10", 68, "", ""},
+	{"P8_11", 45, "", ""},
+	{"P8_12", 44, "", ""},
+	{"P8_13", 23, "", ""},
+	{"P8_14", 26, "", ""},
+	{"P8_15", 47, "", ""},
+	{"P8_16", 46, "", ""},
+	{"P8_17", 27, "", ""},
+	{"P8_18", 65, "", ""},
+	{"P8_19", 22, "", ""},
+	{"P8_20", 63, "", "eMMC"},
+	{"P8_21", 62, "", "eMMC"},
+	{"P8_22", 37, "", "eMMC"},
+	{"P8_23", 36, "", "eMMC"},
+	{"P8_24", 33, "", "eMMC"},
+	{"P8_25", 32, "", "eMMC"},
+	{"P8_26", 61, "", ""},
+	{"P8_27", 86, "", "HDMI"},
+	{"P8_28", 88, "", "HDMI"},
+	{"P8_29", 87, "", "HDMI"},
+	{"P8_30", 89, "", "HDMI"},
+	{"P8_31", 10, "", "HDMI"},
+	{"P8_32", 11, "", "HDMI"},
+	{"P8_33", 9, "", "HDMI"},
+	{"P8_34", 81, "", "HDMI"},
+	{"P8_35", 8, "", "HDMI"},
+	{"P8_36", 80, "", "HDMI"},
+	{"P8_37", 78, "", "HDMI"},
+	{"P8_38", 79, "", "HDMI"},
+	{"P8_39", 76, "", "HDMI"},
+	{"P8_40", 77, "", "HDMI"},
+	{"P8_41", 74, "", "HDMI"},
+	{"P8_42", 75, "", "HDMI"},
+	{"P8_43", 72, "", "HDMI"},
+	{"P8_44", 73, "", "HDMI"},
+	{"P8_45", 70, "", "HDMI"},
+	{"P8_46", 71, "", "HDMI"},
+
+	{"P9_01", -1, "GND", ""},
+	{"P9_02", -1, "GND", ""},
+	{"P9_03", -1, "DC_3.3V", ""},
+	{"P9_04", -1, "DC_3.3V", ""},
+	{"P9_05", -1, "VDD_5V", ""},
+	{"P9_06", -1, "VDD_5V", ""},
+	{"P9_07", -1, "SYS_5V", ""},
+	{"P9_08", -1, "SYS_5V", ""},
+	{"P9_09", -1, "PWR_BUT", ""},
+	{"P9_10", -1, "SYS_RESETN", ""},
+	{"P9_11", 30, "", ""},
+	{"P9_12", 60, "", ""},
+	{"P9_13", 31, "", ""},
+	{"P9_14", 50, "", ""},
+	{"P9_15", 48, "", ""},
+	{"P9_16", 51, "", ""},
+	{"P9_17", 5, "", ""},
+	{"P9_18", 4, "", ""},
+	{"P9_19", 13, "", "I2C2 (cape EEPROMs)"},
+	{"P9_20", 12, "", "I2C2 (cape EEPROMs)"},
+	{"P9_21", 3, "", ""},
+	{"P9_22", 2, "", ""},
+	{"P9_23", 49, "", ""},
+	{"P9_24", 15, "", ""},
+	{"P9_25", 117, "", "HDMI audio (McASP0)"},
+	{"P9_26", 14, "", ""},
+	{"P9_27", 115, "", ""},
+	{"P9_28", 113, "", "HDMI audio (McASP0)"},
+	{"P9_29", 111, "", "HDMI audio (McASP0)"},
+	{"P9_30", 112, "", ""},
+	{"P9_31", 110, "", "HDMI audio (McASP0)"},
+	{"P9_32", -1, "VDD_ADC", ""},
+	{"P9_33", -1, "analog input AIN4", ""},
+	{"P9_34", -1, "GNDA_ADC", ""},
+	{"P9_35", -1, "analog input AIN6", ""},
+	{"P9_36", -1, "analog input AIN5", ""},
+	{"P9_37", -1, "analog input AIN2", ""},
+	{"P9_38", -1, "analog input AIN3", ""},
+	{"P9_39", -1, "analog input AIN0", ""},
+	{"P9_40", -1, "analog input AIN1", ""},
+	{"P9_41", 20, "", ""}, // also connected to gpio116
+	{"P9_42", 7, "", ""},  // also connected to gpio114
+	{"P9_43", -1, "GND", ""},
+	{"P9_44", -1, "GND", ""},
+	{"P9_45", -1, "GND", ""},
+	{"P9_46", -1, "GND", ""},
+}
+
+// AIN7 is not on the header, it measures half the 1.8V supply of the ADC
+var bbb_analog_pins_ = []analogPin{
+	{"AIN0", "P9_39", 0},
+	{"AIN1", "P9_40", 1},
+	{"AIN2", "P9_37", 2},
+	{"AIN3", "P9_38", 3},
+	{"AIN4", "P9_33", 4},
+	{"AIN5", "P9_36", 5},
+	{"AIN6", "P9_35", 6},
+}
@@ -0,0 +1,90 @@
+package bbhw
+
+// P1 and P2 headers of the PocketBeagle (AM335x, same GPIO numbering as the BeagleBone Black)
+var pocketbeagle_pins_ = []headerPin{
+	{"P1_01", -1, "VIN-AC", ""},
+	{"P1_02", 87, "", ""}, // shared with AIN6 (3.3V)
+	{"P1_03", -1, "USB1 VBUS OUT", ""},
+	{"P1_04", 89, "", ""},
+	{"P1_05", -1, "USB1 VBUS IN", ""},
+	{"P1_06", 5, "", ""},
+	{"P1_07", -1, "VIN-USB", ""},
+	{"P1_08", 2, "", ""},
+	{"P1_09", -1, "USB1 DN", ""},
+	{"P1_10", 3, "", ""},
+	{"P1_11", -1, "USB1 DP", ""},
+	{"P1_12", 4, "", ""},
+	{"P1_13", -1, "USB1 ID", ""},
+	{"P1_14", -1, "VOUT-3.3V", ""},
+	{"P1_15", -1, "GND", ""},
+	{"P1_16", -1, "GND", ""},
+	{"P1_17", -1, "VREFN", ""},
+	{"P1_18", -1, "VREFP", ""},
+	{"P1_19", -1, "analog input AIN0", ""},
+	{"P1_20", 20, "", ""},
+	{"P1_21", -1, "analog input AIN1", ""},
+	{"P1_22", -1, "GND", ""},
+	{"P1_23", -1, "analog input AIN2", ""},
+	{"P1_24", -1, "VOUT-5V", ""},
+	{"P1_25", -1, "analog input AIN3", ""},
+	{"P1_26", 12, "", ""},
+	{"P1_27", -1, "analog input AIN4", ""},
+	{"P1_28", 13, "", ""},
+	{"P1_29", 117, "", ""},
+	{"P1_30", 43, "", "UART0 (serial console)"},
+	{"P1_31", 114, "", ""},
+	{"P1_32", 42, "", "UART0 (serial console)"},
+	{"P1_33", 111, "", ""},
+	{"P1_34", 26, "", ""},
+	{"P1_35", 88, "", ""},
+	{"P1_36", 110, "", ""},
+
+	{"P2_01", 50, "", ""},
+	{"P2_02", 59, "", ""},
+	{"P2_03", 23, "", ""},
+	{"P2_04", 58, "", ""},
+	{"P2_05", 30, "", ""},
+	{"P2_06", 57, "", ""},
+	{"P2_07", 31, "", ""},
+	{"P2_08", 60, "", ""},
+	{"P2_09", 15, "", ""},
+	{"P2_10", 52, "", ""},
+	{"P2_11", 14, "", ""},
+	{"P2_12", -1, "PWR BUT", ""},
+	{"P2_13", -1, "VOUT-5V", ""},
+	{"P2_14", -1, "BAT-VIN", ""},
+	{"P2_15", -1, "GND", ""},
+	{"P2_16", -1, "BAT-TEMP", ""},
+	{"P2_17", 65, "", ""},
+	{"P2_18", 47, "", ""},
+	{"P2_19", 27, "", ""},
+	{"P2_20", 64, "", ""},
+	{"P2_21", -1, "GND", ""},
+	{"P2_22", 46, "", ""},
+	{"P2_23", -1, "VOUT-3.3V", ""},
+	{"P2_24", 44, "", ""},
+	{"P2_25", 41, "", ""},
+	{"P2_26", -1, "RESET#", ""},
+	{"P2_27", 40, "", ""},
+	{"P2_28", 116, "", ""},
+	{"P2_29", 7, "", ""},
+	{"P2_30", 113, "", ""},
+	{"P2_31", 19, "", ""},
+	{"P2_32", 112, "", ""},
+	{"P2_33", 45, "", ""},
+	{"P2_34", 115, "", ""},
+	{"P2_35", 86, "", ""}, // shared with AIN5 (3.3V)
+	{"P2_36", -1, "analog input AIN7", ""},
+}
+
+// AIN5 and AIN6 are shared with GPIOs and take 3.3V through a divider, the others take 1.8V
+var pocketbeagle_analog_pins_ = []analogPin{
+	{"AIN0", "P1_19", 0},
+	{"AIN1", "P1_21", 1},
+	{"AIN2", "P1_23", 2},
+	{"AIN3", "P1_25", 3},
+	{"AIN4", "P1_27", 4},
+	{"AIN5", "P2_35", 5},
+	{"AIN6", "P1_02", 6},
+	{"AIN7", "P2_36", 7},
+}
@@ -0,0 +1,137 @@
+package bbhw
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_GPIONumberForPin(t *testing.T) {
+	useBoard(t, BOARD_BEAGLEBONE)
+	for _, name := range []string{"P8_12", "p8_12", "P8.12", "P8-12", " p8.12 "} {
+		if n, err := GPIONumberForPin(name); err != nil || n != 44 {
+			t.Errorf("GPIONumberForPin(%q) = %d, %v", name, n, err)
+		}
+	}
+	if n, err := GPIONumberForPin("P8_7"); err != nil || n != 66 {
+		t.Errorf("GPIONumberForPin(P8_7) = %d, %v", n, err)
+	}
+	for name, why := range map[string]string{"P9_01": "GND", "P9_39": "AIN0", "P9_05": "VDD_5V", "P10_01": "unknown", "GPIO44": "unknown"} {
+		if _, err := GPIONumberForPin(name); err == nil || !strings.Contains(err.Error(), why) {
+			t.Errorf("GPIONumberForPin(%q) returned %v, expected an error mentioning %s", name, err, why)
+		}
+	}
+}
+
+// select board for the duration of the test
+func useBoard(t *testing.T, board string) {
+	t.Helper()
+	board_lock_.Lock()
+	saved := board_
+	board_lock_.Unlock()
+	if err := SetBoard(board); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		board_lock_.Lock()
+		board_ = saved
+		board_lock_.Unlock()
+	})
+}
+
+func Test_PinTables(t *testing.T) {
+	sizes := map[string]int{BOARD_BEAGLEBONE: 92, BOARD_POCKETBEAGLE: 72, BOARD_BEAGLEBONE_AI: 92}
+	for _, board := range boards_ {
+		useBoard(t, board.name)
+		if len(board.pins) != sizes[board.name] {
+			t.Errorf("%s has %d header pins, table has %d", board.name, sizes[board.name], len(board.pins))
+		}
+		names := make(map[string]bool)
+		gpios := make(map[int]string)
+		for _, p := range board.pins {
+			if name, ok := normalizePinName(p.name); !ok || name != p.name {
+				t.Errorf("%s: pin name %s is not canonical", board.name, p.name)
+			}
+			if names[p.name] {
+				t.Errorf("%s: pin %s listed twice", board.name, p.name)
+			}
+			names[p.name] = true
+			if p.gpio < 0 {
+				if _, err := GPIONumberForPin(p.name); err == nil || p.function == "" {
+					t.Errorf("%s: %s is no GPIO but has a number or no function", board.name, p.name)
+				}
+				continue
+			}
+			if other, dup := gpios[p.gpio]; dup {
+				t.Errorf("%s: gpio%d on %s and %s", board.name, p.gpio, other, p.name)
+			}
+			gpios[p.gpio] = p.name
+			n, err := GPIONumberForPin(p.name)
+			if err != nil || n != uint(p.gpio) {
+				t.Errorf("%s: GPIONumberForPin(%s) = %d, %v", board.name, p.name, n, err)
+			}
+			if name, err := PinForGPIO(n); err != nil || name != p.name {
+				t.Errorf("%s: PinForGPIO(%d) = %s, %v", board.name, n, name, err)
+			}
+		}
+	}
+}
+
+func Test_SetBoard(t *testing.T) {
+	useBoard(t, "PocketBeagle")
+	if Board() != BOARD_POCKETBEAGLE {
+		t.Error("SetBoard is not case-insensitive:", Board())
+	}
+	if n, err := GPIONumberForPin("P2.24"); err != nil || n != 44 {
+		t.Errorf("GPIONumberForPin(P2.24) = %d, %v", n, err)
+	}
+	if _, err := GPIONumberForPin("P8_12"); err == nil {
+		t.Error("PocketBeagle has no P8 header")
+	}
+	err := SetBoard("raspberrypi")
+	if err == nil || !strings.Contains(err.Error(), BOARD_BEAGLEBONE_AI) {
+		t.Error("unknown board error does not list the supported ones:", err)
+	}
+	if Board() != BOARD_POCKETBEAGLE {
+		t.Error("failed SetBoard changed the board")
+	}
+	useBoard(t, BOARD_BEAGLEBONE_AI)
+	if n, err := GPIONumberForPin("P8_12"); err != nil || n != 74 {
+		t.Errorf("GPIONumberForPin(P8_12) on BeagleBone AI = %d, %v", n, err)
+	}
+}
+
+func Test_DetectBoard(t *testing.T) {
+	saved := device_tree_model_path_
+	t.Cleanup(func() { device_tree_model_path_ = saved })
+	device_tree_model_path_ = filepath.Join(t.TempDir(), "model")
+	for model, board := range map[string]string{
+		"TI AM335x BeagleBone Black\x00":    BOARD_BEAGLEBONE,
+		"TI AM335x BeagleBone Green\x00":    BOARD_BEAGLEBONE,
+		"TI AM335x PocketBeagle\x00":        BOARD_POCKETBEAGLE,
+		"BeagleBoard.org BeagleBone AI\x00": BOARD_BEAGLEBONE_AI,
+		"Raspberry Pi 4 Model B\x00":        BOARD_BEAGLEBONE,
+	} {
+		if err := ioutil.WriteFile(device_tree_model_path_, []byte(model), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if got := detectBoard().name; got != board {
+			t.Errorf("model %q detected as %s, expected %s", model, got, board)
+		}
+	}
+}
+
+func Test_NewSysfsGPIOForPinMentionsConflict(t *testing.T) {
+	useBoard(t, BOARD_BEAGLEBONE)
+	useFakeSysfsGPIOTree(t) // nothing exported, export does not work
+	if _, err := NewSysfsGPIOForPin("P8_03", OUT); err == nil || !strings.Contains(err.Error(), "eMMC") {
+		t.Error("error does not mention eMMC:", err)
+	}
+	useFakeSysfsGPIOTree(t, 44)
+	gpio, err := NewSysfsGPIOForPin("P8_12", OUT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gpio.Close()
+}
@@ -0,0 +1,223 @@
+package bbhw
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// Option of NewPulseCounter
+type PulseCounterOption func(*PulseCounter)
+
+// edge counted as pulse, default RISING. BOTH counts two per pulse.
+func PulseCounterWithEdge(edge Edge) PulseCounterOption {
+	return func(c *PulseCounter) { c.edge = edge }
+}
+
+// Polls the pin with s instead of using edge events, for pins without edge support (e.g. mmapped).
+// Each level has to last one interval of s to be seen, so at most 1/(2*interval) pulses per second
+// are counted, e.g. 500Hz with a 1ms Sampler. Faster pulses get lost without notice.
+func PulseCounterWithSampler(s *Sampler) PulseCounterOption {
+	return func(c *PulseCounter) { c.sampler = s }
+}
+
+// times of the latest n pulses are kept for Rate, default 4096. Windows holding more pulses report NaN.
+func PulseCounterWithBuffer(n int) PulseCounterOption {
+	return func(c *PulseCounter) { c.times = make([]time.Time, n) }
+}
+
+// Rate measures up to Now of c.
+// Has to be the clock of the edge event times, i.e. of a FakeGPIO or the Sampler ticks.
+func PulseCounterWithClock(clk Clock) PulseCounterOption {
+	return func(c *PulseCounter) { c.clock = clk }
+}
+
+// edge events or sampled transitions queued before the kernel or the Sampler drop them
+const pulse_counter_queue_ = 1024
+
+// Counts pulses on an input, e.g. of a flow meter or a tachometer, from edge events or with a Sampler.
+// Lost edges are known from EdgeEvent.Missed (CdevGPIO and FakeGPIO), Rate reports NaN for windows reaching
+// back to a loss instead of a rate too low. SysfsGPIO has no such indication.
+type PulseCounter struct {
+	gpio    GPIOControllablePin
+	edge    Edge
+	sampler *Sampler
+	clock   Clock
+	stop    chan struct{}
+	lock    sync.Mutex // guards everything below
+	count   uint64
+	times   []time.Time // ring of the latest pulses
+	next    int         // index in times of the next pulse
+	stored  int
+	since   time.Time // construction or Reset
+	missed  uint64
+	lost    time.Time // latest loss of edges
+}
+
+// Sets the edge of gpio (unless using PulseCounterWithSampler) and counts from now on
+func NewPulseCounter(gpio GPIOControllablePin, opts ...PulseCounterOption) (*PulseCounter, error) {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	c := &PulseCounter{gpio: gpio, edge: RISING, stop: make(chan struct{})}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.edge != RISING && c.edge != FALLING && c.edge != BOTH {
+		return nil, errors.New("PulseCounter: edge has to be RISING, FALLING or BOTH")
+	}
+	if c.times == nil {
+		c.times = make([]time.Time, 4096)
+	}
+	if len(c.times) < 1 {
+		return nil, errors.New("PulseCounter: buffer for less than one pulse")
+	}
+	if c.clock == nil {
+		c.clock = defaultClock()
+	}
+	c.since = c.clock.Now()
+	if c.sampler != nil {
+		return c, c.watchSampled()
+	}
+	edgegpio, ok := gpio.(EdgeEventGPIO)
+	if !ok {
+		return nil, errors.New("PulseCounter: gpio needs edge events, otherwise use PulseCounterWithSampler")
+	}
+	return c, c.watchEdges(edgegpio)
+}
+
+func (c *PulseCounter) watchEdges(gpio EdgeEventGPIO) error {
+	if err := gpio.SetEdge(c.edge); err != nil {
+		return err
+	}
+	events := make(chan EdgeEvent, pulse_counter_queue_)
+	if err := gpio.SetEdgeEventCallback(events, -1); err != nil {
+		return err
+	}
+	go func() {
+		// keep the edge callback from blocking until the gpio is closed
+		defer func() {
+			go func() {
+				for range events {
+				}
+			}()
+		}()
+		for {
+			select {
+			case <-c.stop:
+				return
+			case ev, ok := <-events:
+				if !ok {
+					return
+				}
+				if ev.Missed > 0 {
+					c.lose(uint64(ev.Missed), ev.Time)
+				}
+				if c.edge == BOTH || ev.Edge == c.edge {
+					c.pulse(ev.Time)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func (c *PulseCounter) watchSampled() error {
+	transitions, err := c.sampler.Register(c.gpio, pulse_counter_queue_)
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer c.sampler.Unregister(c.gpio)
+		for {
+			select {
+			case <-c.stop:
+				return
+			case tr, ok := <-transitions:
+				if !ok {
+					return
+				}
+				if tr.Err != nil {
+					c.lose(0, tr.Time)
+				} else if c.edge == BOTH || tr.State == (c.edge == RISING) {
+					c.pulse(tr.Time)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func (c *PulseCounter) pulse(t time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.count++
+	c.times[c.next] = t
+	c.next = (c.next + 1) % len(c.times)
+	if c.stored < len(c.times) {
+		c.stored++
+	}
+}
+
+// n edges (unknown for 0) got lost before t
+func (c *PulseCounter) lose(n uint64, t time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.missed += n
+	c.lost = t
+}
+
+// Pulses since construction or Reset. Wraps around after 2^64, the difference of two Counts as uint64 stays right.
+func (c *PulseCounter) Count() uint64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.count
+}
+
+// Pulses per second within the last window. NaN if that is unknown: edges got lost within it, it reaches
+// back before construction or Reset, or it held more pulses than PulseCounterWithBuffer keeps.
+func (c *PulseCounter) Rate(window time.Duration) float64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	from := c.clock.Now().Add(-window)
+	if window <= 0 || from.Before(c.since) || (!c.lost.IsZero() && !c.lost.Before(from)) {
+		return math.NaN()
+	}
+	n := 0
+	for ; n < c.stored; n++ {
+		if c.times[(c.next-1-n+len(c.times))%len(c.times)].Before(from) {
+			return float64(n) / window.Seconds()
+		}
+	}
+	if c.stored == len(c.times) {
+		return math.NaN()
+	}
+	return float64(n) / window.Seconds()
+}
+
+// Edges known to be lost since construction or Reset. Failed GetStates of a Sampler did not lose a known number.
+func (c *PulseCounter) Missed() uint64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.missed
+}
+
+// Starts counting from 0 again, returns the Count till now. No pulse goes uncounted in between.
+func (c *PulseCounter) Reset() uint64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	count := c.count
+	c.count, c.next, c.stored, c.missed, c.lost = 0, 0, 0, 0, time.Time{}
+	c.since = c.clock.Now()
+	return count
+}
+
+// Stops counting and unregisters from the Sampler. The edge callback ends once the gpio is closed.
+func (c *PulseCounter) Close() {
+	select {
+	case <-c.stop:
+	default:
+		close(c.stop)
+	}
+}
@@ -0,0 +1,155 @@
+package bbhw
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func waitPulseCount(t *testing.T, c *PulseCounter, n uint64) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); c.Count()+c.Missed() != n; time.Sleep(time.Microsecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("counted %d and missed %d of %d pulses", c.Count(), c.Missed(), n)
+		}
+	}
+}
+
+func newFakePulseInput(t *testing.T, clock Clock) *FakeGPIO {
+	gpio := NewFakeNamedGPIO("FLOW", IN, nil)
+	gpio.SetClock(clock)
+	t.Cleanup(gpio.Close)
+	return gpio
+}
+
+func Test_PulseCounterRate(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	gpio := newFakePulseInput(t, clock)
+	c, err := NewPulseCounter(gpio, PulseCounterWithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	small, _ := NewPulseCounter(gpio, PulseCounterWithClock(clock), PulseCounterWithBuffer(200))
+	t.Cleanup(small.Close)
+	// 1s at 1kHz, rising every ms from now on
+	var steps []WaveStep
+	for i := 0; i < 1000; i++ {
+		steps = append(steps, WaveStep{true, 500 * time.Microsecond}, WaveStep{false, 500 * time.Microsecond})
+	}
+	afterTimer(t, clock, func() { gpio.PlayWaveform(steps) })
+	for n := uint64(1); n <= 1000; n++ {
+		waitPulseCount(t, c, n)
+		waitPulseCount(t, small, n)
+		afterTimer(t, clock, func() { clock.Advance(500 * time.Microsecond) })
+		if n < 1000 {
+			afterTimer(t, clock, func() { clock.Advance(500 * time.Microsecond) })
+		} else {
+			clock.Advance(500 * time.Microsecond) // the end of the waveform
+		}
+	}
+	if c.Count() != 1000 {
+		t.Errorf("Count() = %d", c.Count())
+	}
+	for _, window := range []time.Duration{time.Second, 500 * time.Millisecond, 100 * time.Millisecond} {
+		if rate := c.Rate(window); rate != 1000 {
+			t.Errorf("Rate(%v) = %v", window, rate)
+		}
+	}
+	if rate := c.Rate(2 * time.Second); !math.IsNaN(rate) {
+		t.Errorf("Rate of a window reaching back before construction: %v", rate)
+	}
+	if rate := small.Rate(100 * time.Millisecond); rate != 1000 {
+		t.Errorf("Rate(100ms) with a buffer of 200 = %v", rate)
+	}
+	if rate := small.Rate(500 * time.Millisecond); !math.IsNaN(rate) {
+		t.Errorf("Rate of 500 pulses with a buffer of 200: %v", rate)
+	}
+	// silence
+	clock.Advance(time.Second)
+	if rate := c.Rate(500 * time.Millisecond); rate != 0 {
+		t.Errorf("Rate(500ms) after the pulses = %v", rate)
+	}
+	if n := c.Reset(); n != 1000 || c.Count() != 0 || !math.IsNaN(c.Rate(time.Millisecond)) {
+		t.Errorf("Reset() = %d, then Count() %d, Rate(1ms) %v", n, c.Count(), c.Rate(time.Millisecond))
+	}
+}
+
+func Test_PulseCounterMissed(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	gpio := newFakePulseInput(t, clock)
+	c, err := NewPulseCounter(gpio, PulseCounterWithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	clock.Advance(2 * time.Second)
+	// the counter stalls while 2000 pulses come by, more than all queues on the way hold
+	c.lock.Lock()
+	for i := 0; i < 2000; i++ {
+		gpio.FakeInput(true)
+		gpio.FakeInput(false)
+	}
+	c.lock.Unlock()
+	// the next edge that makes it tells about the lost ones
+	for sent, deadline := uint64(2000), time.Now().Add(time.Second); c.Count()+c.Missed() != sent; sent++ {
+		if time.Now().After(deadline) {
+			t.Fatalf("counted %d and missed %d of %d pulses", c.Count(), c.Missed(), sent)
+		}
+		gpio.FakeInput(true)
+		gpio.FakeInput(false)
+		time.Sleep(time.Millisecond)
+	}
+	if c.Missed() == 0 {
+		t.Fatal("no edges missed")
+	}
+	if rate := c.Rate(time.Second); !math.IsNaN(rate) {
+		t.Errorf("Rate of a window with lost edges: %v", rate)
+	}
+	clock.Advance(2 * time.Second)
+	if rate := c.Rate(time.Second); rate != 0 {
+		t.Errorf("Rate of a window after the loss: %v", rate)
+	}
+}
+
+func Test_PulseCounterSampler(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	s := NewSamplerOrPanic(time.Hour)
+	t.Cleanup(s.Stop)
+	gpio := newFakePulseInput(t, clock)
+	c, err := NewPulseCounter(gpio, PulseCounterWithSampler(s), PulseCounterWithClock(clock), PulseCounterWithEdge(FALLING))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	// 500Hz sampled every ms, as fast as it gets
+	for i := 0; i < 200; i++ {
+		gpio.FakeInput(i%2 == 0)
+		s.sample(clock.Now())
+		clock.Advance(time.Millisecond)
+	}
+	waitPulseCount(t, c, 100)
+	if rate := c.Rate(100 * time.Millisecond); rate != 500 {
+		t.Errorf("Rate(100ms) = %v", rate)
+	}
+	// a pulse between two ticks never shows
+	gpio.FakeInput(true)
+	gpio.FakeInput(false)
+	clock.Advance(time.Millisecond)
+	s.sample(clock.Now())
+	gpio.FailNext("GetState", errors.New("gone"))
+	clock.Advance(time.Millisecond)
+	s.sample(clock.Now())
+	for deadline := time.Now().Add(time.Second); !math.IsNaN(c.Rate(100 * time.Millisecond)); time.Sleep(time.Microsecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Rate not NaN after a failed GetState")
+		}
+	}
+	if c.Count() != 100 {
+		t.Errorf("Count() = %d", c.Count())
+	}
+	if _, err := NewPulseCounter(NewFakeGPIO(2, IN), PulseCounterWithEdge(NONE)); err == nil {
+		t.Error("edge NONE accepted")
+	}
+}
@@ -0,0 +1,166 @@
+package bbhw
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Pulse widths measured by a PulseWidthMeter, averaged over the periods of its window
+type PulseWidth struct {
+	High, Low, Period time.Duration
+	Duty              float64   // High / Period
+	Samples           int       // periods averaged, less than the window at first
+	Time              time.Time // of the rising edge ending the latest period
+}
+
+// Option of NewPulseWidthMeter
+type PulseWidthOption func(*PulseWidthMeter)
+
+// number of periods averaged, default 8
+func PulseWidthWithWindow(n int) PulseWidthOption {
+	return func(m *PulseWidthMeter) { m.window = make([]pulseSample, n) }
+}
+
+// results queued on Results before the oldest ones are dropped
+const pulse_width_queue_ = 64
+
+type pulseSample struct {
+	high, period time.Duration
+}
+
+// Measures high time, low time, period and duty of a signal encoding a value in its duty cycle,
+// e.g. anemometers or PWM output temperature sensors, from the timestamps of both edges.
+// A period is measured from rising edge to rising edge. Periods with lost edges (EdgeEvent.Missed, or
+// two edges of the same direction in a row) are left out, the others in the window still count.
+// A constant level yields no results, check PulseWidth.Time for a signal that stopped.
+type PulseWidthMeter struct {
+	results chan PulseWidth
+	stop    chan struct{}
+	// only used by the watching goroutine
+	rose, fell       time.Duration
+	hasRise, hasFall bool
+	window           []pulseSample // ring of the latest periods
+	next, stored     int
+	lock             sync.Mutex // guards latest
+	latest           PulseWidth
+	seen             uint64 // edges processed, for tests
+}
+
+// Switches gpio to input and watches both edges from now on, it needs to be exclusive to the meter
+func NewPulseWidthMeter(gpio EdgeEventGPIO, opts ...PulseWidthOption) (*PulseWidthMeter, error) {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	m := &PulseWidthMeter{results: make(chan PulseWidth, pulse_width_queue_), stop: make(chan struct{})}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.window == nil {
+		m.window = make([]pulseSample, 8)
+	}
+	if len(m.window) < 1 {
+		return nil, errors.New("PulseWidthMeter: window of less than one period")
+	}
+	if err := gpio.SetDirection(IN); err != nil {
+		return nil, err
+	}
+	if err := gpio.SetEdge(BOTH); err != nil {
+		return nil, err
+	}
+	events := make(chan EdgeEvent, pulse_width_queue_)
+	if err := gpio.SetEdgeEventCallback(events, -1); err != nil {
+		return nil, err
+	}
+	go func() {
+		// keep the edge callback from blocking until the gpio is closed
+		defer func() {
+			go func() {
+				for range events {
+				}
+			}()
+		}()
+		for {
+			select {
+			case <-m.stop:
+				return
+			case ev, ok := <-events:
+				if !ok {
+					return
+				}
+				m.observe(ev)
+			}
+		}
+	}()
+	return m, nil
+}
+
+// only called by the watching goroutine
+func (m *PulseWidthMeter) observe(ev EdgeEvent) {
+	defer atomic.AddUint64(&m.seen, 1)
+	if ev.Missed > 0 {
+		m.hasRise, m.hasFall = false, false
+	}
+	t := ev.at()
+	if ev.Edge == FALLING {
+		// a second falling edge lost the rising one in between
+		m.fell, m.hasFall, m.hasRise = t, true, m.hasRise && !m.hasFall
+		return
+	}
+	if m.hasRise && m.hasFall && m.rose < m.fell && m.fell < t {
+		m.add(pulseSample{high: m.fell - m.rose, period: t - m.rose}, ev.Time)
+	}
+	m.rose, m.hasRise, m.hasFall = t, true, false
+}
+
+func (m *PulseWidthMeter) add(s pulseSample, at time.Time) {
+	m.window[m.next] = s
+	m.next = (m.next + 1) % len(m.window)
+	if m.stored < len(m.window) {
+		m.stored++
+	}
+	var high, period time.Duration
+	for _, s := range m.window[:m.stored] {
+		high += s.high
+		period += s.period
+	}
+	n := time.Duration(m.stored)
+	result := PulseWidth{High: high / n, Low: (period - high) / n, Period: period / n,
+		Duty: float64(high) / float64(period), Samples: m.stored, Time: at}
+	m.lock.Lock()
+	m.latest = result
+	m.lock.Unlock()
+	for {
+		select {
+		case m.results <- result:
+			return
+		default:
+		}
+		select {
+		case <-m.results:
+		default:
+		}
+	}
+}
+
+// The result of the latest period, ok is false before the first one
+func (m *PulseWidthMeter) Latest() (pw PulseWidth, ok bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.latest, m.latest.Samples > 0
+}
+
+// A result after each period. If nobody reads them the oldest ones are dropped, Latest stays current.
+func (m *PulseWidthMeter) Results() <-chan PulseWidth {
+	return m.results
+}
+
+// Stops measuring. The edge callback ends once the gpio is closed.
+func (m *PulseWidthMeter) Close() {
+	select {
+	case <-m.stop:
+	default:
+		close(m.stop)
+	}
+}
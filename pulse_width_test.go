@@ -0,0 +1,122 @@
+package bbhw
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func expectPulseWidth(t *testing.T, pw PulseWidth, high, period, tolerance time.Duration) {
+	t.Helper()
+	within := func(d, expected time.Duration) bool { return d >= expected-tolerance && d <= expected+tolerance }
+	duty := float64(high) / float64(period)
+	if !within(pw.High, high) || !within(pw.Low, period-high) || !within(pw.Period, period) ||
+		pw.Duty < duty-float64(2*tolerance)/float64(period) || pw.Duty > duty+float64(2*tolerance)/float64(period) {
+		t.Errorf("%+v, expected high %v of %v", pw, high, period)
+	}
+}
+
+func Test_PulseWidthMeterFixture(t *testing.T) {
+	gpio := NewFakeNamedGPIO("PWM", IN, nil)
+	t.Cleanup(gpio.Close)
+	m, err := NewPulseWidthMeter(gpio, PulseWidthWithWindow(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Close()
+	events := loadEdgeFixture(t, "pwm-edges-400Hz-30pct")
+	for _, ev := range events {
+		m.observe(ev)
+	}
+	// 30 periods, the one with the lost falling edge left out
+	var results []PulseWidth
+	for len(m.Results()) > 0 {
+		results = append(results, <-m.Results())
+	}
+	if len(results) != 29 {
+		t.Fatalf("%d results", len(results))
+	}
+	for i, pw := range results {
+		if expected := i + 1; expected > 4 && pw.Samples != 4 || expected <= 4 && pw.Samples != expected {
+			t.Errorf("result %d averaged %d periods", i, pw.Samples)
+		}
+		// timestamps of 1µs resolution
+		expectPulseWidth(t, pw, 750200*time.Nanosecond, 2500400*time.Nanosecond, time.Microsecond)
+	}
+	if pw, ok := m.Latest(); !ok || pw != results[28] {
+		t.Errorf("Latest() = %+v, %v", pw, ok)
+	}
+	// an edge lost before the next rising one invalidates that period
+	last := events[len(events)-1]
+	fall := EdgeEvent{Edge: FALLING, Timestamp: last.Timestamp + 750*time.Microsecond}
+	rise := EdgeEvent{Edge: RISING, State: true, Timestamp: last.Timestamp + 2500*time.Microsecond, Missed: 2}
+	m.observe(fall)
+	m.observe(rise)
+	if len(m.Results()) != 0 {
+		t.Errorf("period with missed edges measured: %+v", <-m.Results())
+	}
+}
+
+func Test_PulseWidthMeterPlayback(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	gpio := NewFakeNamedGPIO("PWM", IN, nil)
+	gpio.SetClock(clock)
+	t.Cleanup(gpio.Close)
+	m, err := NewPulseWidthMeter(gpio)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(m.Close)
+	if _, ok := m.Latest(); ok {
+		t.Error("result before the first period")
+	}
+	// 1kHz at 25%
+	var steps []WaveStep
+	for i := 0; i < 20; i++ {
+		steps = append(steps, WaveStep{true, 250 * time.Microsecond}, WaveStep{false, 750 * time.Microsecond})
+	}
+	processed := func(n uint64) {
+		for deadline := time.Now().Add(time.Second); atomic.LoadUint64(&m.seen) != n; time.Sleep(time.Microsecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("%d of %d edges processed", atomic.LoadUint64(&m.seen), n)
+			}
+		}
+	}
+	// step by step, after the edges processed before plus those of steps so far
+	play := func(steps []WaveStep, before uint64) {
+		var played <-chan struct{}
+		afterTimer(t, clock, func() { played, _ = gpio.PlayWaveform(steps) })
+		for i, step := range steps {
+			processed(before + uint64(i+1))
+			if i == len(steps)-1 {
+				clock.Advance(step.Hold)
+			} else {
+				afterTimer(t, clock, func() { clock.Advance(step.Hold) })
+			}
+		}
+		<-played
+	}
+	play(steps, 0)
+	// 19 periods between the 20 rising edges
+	for i := 0; i < 19; i++ {
+		pw := <-m.Results()
+		expectPulseWidth(t, pw, 250*time.Microsecond, time.Millisecond, 0)
+		if i >= 7 && pw.Samples != 8 {
+			t.Errorf("result %d averaged %d periods", i, pw.Samples)
+		}
+	}
+	if pw, ok := m.Latest(); !ok || !pw.Time.Equal(time.Unix(1000, 19e6)) {
+		t.Errorf("Latest() = %+v, %v", pw, ok)
+	}
+	// a duty change takes a window to show fully
+	steps = nil
+	for i := 0; i < 9; i++ {
+		steps = append(steps, WaveStep{true, 500 * time.Microsecond}, WaveStep{false, 500 * time.Microsecond})
+	}
+	play(steps, 40)
+	var pw PulseWidth
+	for len(m.Results()) > 0 {
+		pw = <-m.Results()
+	}
+	expectPulseWidth(t, pw, 500*time.Microsecond, time.Millisecond, 0)
+}
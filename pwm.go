@@ -1,6 +1,10 @@
 package bbhw
 
-import "time"
+import (
+	"fmt"
+	"math"
+	"time"
+)
 
 // PWM Pin Interface
 
@@ -12,6 +16,92 @@ type PWMPin interface {
 	Close()
 }
 
+// PWM output implemented by SysfsPWM, FakePWM and SoftPWM, the way GPIOControllablePin is for GPIOs.
+// Controllers taking a PWM work with hardware channels, software PWM on a GPIO and the fake in tests alike.
+// ToLegacyPWM makes one a PWMPin for code not converted yet.
+type PWM interface {
+	SetFrequency(hz float64) error
+	SetDutyFraction(fraction float64) error
+	SetPolarity(inverted bool) error
+	Enable() error
+	Disable() error
+	Close()
+}
+
+var (
+	_ PWM = (*SysfsPWM)(nil)
+	_ PWM = (*FakePWM)(nil)
+	_ PWM = (*SoftPWM)(nil)
+)
+
+type legacyPWM struct{ PWM }
+
+func (p legacyPWM) SetPolarity(inverted bool) {
+	p.PWM.SetPolarity(inverted)
+}
+
+// like the PWMPins: ignored if duty > period, otherwise set and enabled
+func (p legacyPWM) SetPWM(period, duty time.Duration) {
+	switch pwm := p.PWM.(type) {
+	case interface {
+		SetPWM(time.Duration, time.Duration)
+	}:
+		pwm.SetPWM(period, duty)
+		return
+	case interface {
+		SetPeriod(time.Duration) error
+		SetDutyNanoseconds(uint64) error
+	}:
+		if duty > period || period <= 0 || duty < 0 || pwm.SetPeriod(period) != nil || pwm.SetDutyNanoseconds(uint64(duty)) != nil {
+			return
+		}
+	default:
+		if duty > period || period <= 0 || duty < 0 || pwm.SetFrequency(float64(time.Second)/float64(period)) != nil ||
+			pwm.SetDutyFraction(float64(duty)/float64(period)) != nil {
+			return
+		}
+	}
+	p.PWM.Enable()
+}
+
+// zero if the PWM can not tell
+func (p legacyPWM) GetPWM() (period, duty time.Duration) {
+	switch pwm := p.PWM.(type) {
+	case interface {
+		GetPWM() (time.Duration, time.Duration)
+	}:
+		return pwm.GetPWM()
+	case interface {
+		GetFrequency() (float64, error)
+		GetDutyFraction() (float64, error)
+	}:
+		hz, err := pwm.GetFrequency()
+		if err != nil || hz == 0 {
+			return 0, 0
+		}
+		fraction, err := pwm.GetDutyFraction()
+		if err != nil {
+			return 0, 0
+		}
+		period = time.Duration(math.Round(float64(time.Second) / hz))
+		return period, time.Duration(math.Round(float64(period) * fraction))
+	}
+	return 0, 0
+}
+
+func (p legacyPWM) DisablePWM() {
+	p.PWM.Disable()
+}
+
+// Wraps a PWM as PWMPin for code still taking one, e.g. NewServo(ToLegacyPWM(softpwm)). Errors are dropped,
+// as PWMPin has no way to return them.
+func ToLegacyPWM(p PWM) PWMPin {
+	if p == nil {
+		panic("pwm == nil")
+	}
+	return legacyPWM{p}
+}
+
 /// --- Interface Functions
 
 func SetStepperRPM(pwm PWMPin, rpm, stepsperrot float64) {
@@ -54,3 +144,33 @@ func SetDuty(pwm PWMPin, fraction float64) {
 	period, _ := pwm.GetPWM()
 	pwm.SetPWM(time.Duration(period), time.Duration(float64(period.Nanoseconds())*fraction)*time.Nanosecond)
 }
+
+// Error of an operation on a sysfs PWM channel, e.g. Op "set period" on pwmchip0/pwm1.
+// Wraps the underlying error like GPIOError, so errors.Is(err, os.ErrNotExist) (e.g. chip not present),
+// errors.Is(err, ErrOutOfRange) or errors.Is(err, ErrInvalidAttribute) work.
+type PWMError struct {
+	Chip    uint
+	Channel uint
+	Op      string
+	Err     error
+}
+
+func (e *PWMError) Error() string {
+	return fmt.Sprintf("pwmchip%d/pwm%d: %s: %v", e.Chip, e.Channel, e.Op, e.Err)
+}
+
+func (e *PWMError) Unwrap() error { return e.Err }
+
+// Returned (wrapped in a *PWMError) for a frequency or duty fraction a PWM can not generate.
+// errors.Is(err, ErrOutOfRange) matches it.
+type PWMRangeError struct {
+	Quantity  string  // "frequency" or "duty fraction"
+	Requested float64 // what was asked for
+	Nearest   float64 // the closest value possible
+}
+
+func (e *PWMRangeError) Error() string {
+	return fmt.Sprintf("%s %v out of range, nearest possible is %v", e.Quantity, e.Requested, e.Nearest)
+}
+
+func (e *PWMRangeError) Is(target error) bool { return target == ErrOutOfRange }
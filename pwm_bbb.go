@@ -0,0 +1,116 @@
+package bbhw
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// PWM module output routed to a header pin of the BeagleBone Black
+type bbbPWMOutput struct {
+	pin     string // e.g. P9_14
+	output  string // e.g. ehrpwm1A
+	address string // of the PWM device, its directory below ocp is named <address>.pwm or similar
+	channel uint
+	overlay string // device tree overlay enabling the module
+}
+
+// eHRPWMs have channels A (0) and B (1), each on two header pins. The directory names of the devices
+// changed between kernels, their addresses did not.
+var bbb_pwm_outputs_ = []bbbPWMOutput{
+	{"P9_22", "ehrpwm0A", "48300200", 0, "BB-PWM0"},
+	{"P9_31", "ehrpwm0A", "48300200", 0, "BB-PWM0"},
+	{"P9_21", "ehrpwm0B", "48300200", 1, "BB-PWM0"},
+	{"P9_29", "ehrpwm0B", "48300200", 1, "BB-PWM0"},
+	{"P9_14", "ehrpwm1A", "48302200", 0, "BB-PWM1"},
+	{"P8_36", "ehrpwm1A", "48302200", 0, "BB-PWM1"},
+	{"P9_16", "ehrpwm1B", "48302200", 1, "BB-PWM1"},
+	{"P8_34", "ehrpwm1B", "48302200", 1, "BB-PWM1"},
+	{"P8_19", "ehrpwm2A", "48304200", 0, "BB-PWM2"},
+	{"P8_45", "ehrpwm2A", "48304200", 0, "BB-PWM2"},
+	{"P8_13", "ehrpwm2B", "48304200", 1, "BB-PWM2"},
+	{"P8_46", "ehrpwm2B", "48304200", 1, "BB-PWM2"},
+	{"P9_42", "ecap0", "48300100", 0, "cape-universal"},
+	{"P9_28", "ecap2", "48304100", 0, "cape-universal"},
+}
+
+// BeagleBone PWM module of a device named <address>.pwm or similar, e.g. ehrpwm1 for 48302200.pwm
+func bbbPWMModule(device string) string {
+	for _, o := range bbb_pwm_outputs_ {
+		if strings.HasPrefix(device, o.address+".") {
+			return strings.TrimRight(o.output, "AB") // ehrpwm1A -> ehrpwm1, ecaps have one output
+		}
+	}
+	return ""
+}
+
+func lookupBBBPWMOutput(pin string) (bbbPWMOutput, error) {
+	if board := currentBoard(); board.name != BOARD_BEAGLEBONE {
+		return bbbPWMOutput{}, fmt.Errorf("NewBBBPWM only knows the pins of the BeagleBone Black, not of %s", board.name)
+	}
+	name, ok := normalizePinName(pin)
+	if ok {
+		for _, o := range bbb_pwm_outputs_ {
+			if o.pin == name {
+				return o, nil
+			}
+		}
+	}
+	pins := make([]string, len(bbb_pwm_outputs_))
+	for i, o := range bbb_pwm_outputs_ {
+		pins[i] = o.pin
+	}
+	return bbbPWMOutput{}, fmt.Errorf("header pin %q has no PWM, PWM pins are %s", pin, strings.Join(pins, ", "))
+}
+
+// Resolves a header pin of the BeagleBone Black to its pwmchip and channel, see NewBBBPWM
+func BBBPWMChannel(pin string) (chip, channel uint, err error) {
+	o, err := lookupBBBPWMOutput(pin)
+	if err != nil {
+		return 0, 0, err
+	}
+	chips, err := ListPWMChips()
+	if err != nil {
+		return 0, 0, err
+	}
+	// the device is .../48302200.pwm with 4.x and 5.x kernels, possibly below a <address>.target-module or epwmss
+	present := make([]string, 0, len(chips))
+	for _, c := range chips {
+		if strings.HasPrefix(filepath.Base(c.Device), o.address+".") {
+			return c.Chip, o.channel, nil
+		}
+		if c.Module != "" {
+			present = append(present, fmt.Sprintf("pwmchip%d (%s)", c.Chip, c.Module))
+		} else {
+			present = append(present, fmt.Sprintf("pwmchip%d", c.Chip))
+		}
+	}
+	found := "there are no pwmchips"
+	if len(present) > 0 {
+		found = "present are " + strings.Join(present, ", ")
+	}
+	return 0, 0, fmt.Errorf("%s needs %s but the pwmchip of %s is not present, overlay %s not loaded? (%s)",
+		o.pin, o.output, o.address, o.overlay, found)
+}
+
+// Instantinate a SysfsPWM by header pin name of the BeagleBone Black, e.g. "P9_14".
+// The pwmchip numbers differ between kernels, so the pwmchip of the PWM module of the pin is looked up at runtime.
+// The pin needs to be muxed as PWM, e.g. by config-pin P9_14 pwm or an overlay.
+// It used to return the *BBPWMPin of the 3.8 pwm_test driver, which NewBBBLegacyPWM returns now.
+// ToLegacyPWM(pwm) makes the SysfsPWM a PWMPin for code written against that.
+func NewBBBPWM(pin string, opts ...PWMOption) (*SysfsPWM, error) {
+	chip, channel, err := BBBPWMChannel(pin)
+	if err != nil {
+		return nil, err
+	}
+	return NewSysfsPWM(chip, channel, opts...)
+}
+
+// Wrapper around NewBBBPWM. Does not return an error but panics instead. Useful to avoid multiple return values.
+func NewBBBPWMOrPanic(pin string, opts ...PWMOption) *SysfsPWM {
+	pwm, err := NewBBBPWM(pin, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return pwm
+}
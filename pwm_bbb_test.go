@@ -0,0 +1,106 @@
+package bbhw
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// point ListPWMChips and NewBBBPWM to the class directory of a fixture tree in testdata, whose pwmchips
+// are symlinks into its devices directory like in /sys
+func usePWMClassDir(t *testing.T, dir string) {
+	prev := sysfs_pwm_base_
+	sysfs_pwm_base_ = filepath.Join("testdata", dir, "class")
+	t.Cleanup(func() { sysfs_pwm_base_ = prev })
+}
+
+func Test_BBBPWMChannel(t *testing.T) {
+	useBoard(t, BOARD_BEAGLEBONE)
+	type chipChannel struct{ chip, channel uint }
+	for dir, expected := range map[string]map[string]chipChannel{
+		"pwm-4.19": {"P9_22": {1, 0}, "P9.21": {1, 1}, "P9_14": {4, 0}, "p8_34": {4, 1}, "P8_13": {7, 1}, "P9_42": {0, 0}, "P9_28": {6, 0}},
+		"pwm-5.10": {"P9_31": {3, 0}, "P9_29": {3, 1}, "P8-36": {5, 0}, "P9_16": {5, 1}, "P9_42": {0, 0}, "P9_28": {2, 0}},
+	} {
+		usePWMClassDir(t, dir)
+		for pin, e := range expected {
+			chip, channel, err := BBBPWMChannel(pin)
+			if err != nil || chip != e.chip || channel != e.channel {
+				t.Errorf("%s: BBBPWMChannel(%q) = %d, %d, %v, expected %d, %d", dir, pin, chip, channel, err, e.chip, e.channel)
+			}
+		}
+	}
+}
+
+func Test_BBBPWMChannelErrors(t *testing.T) {
+	useBoard(t, BOARD_BEAGLEBONE)
+	usePWMClassDir(t, "pwm-5.10")
+	// ehrpwm2 is not enabled in the 5.10 fixture
+	_, _, err := BBBPWMChannel("P8_19")
+	if err == nil {
+		t.Fatal("no error without the pwmchip of ehrpwm2")
+	}
+	for _, s := range []string{"P8_19", "ehrpwm2A", "48304200", "BB-PWM2", "pwmchip3 (ehrpwm0)", "pwmchip2 (ecap2)"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("error %q does not mention %s", err, s)
+		}
+	}
+	for _, pin := range []string{"P9_12", "P9_39", "GPIO44"} {
+		if _, _, err := BBBPWMChannel(pin); err == nil || !strings.Contains(err.Error(), "P9_14") {
+			t.Errorf("BBBPWMChannel(%q) = %v, expected an error listing the PWM pins", pin, err)
+		}
+	}
+	useBoard(t, BOARD_POCKETBEAGLE)
+	if _, _, err := BBBPWMChannel("P9_14"); err == nil {
+		t.Error("no error on the PocketBeagle")
+	}
+}
+
+func Test_NewBBBPWM(t *testing.T) {
+	useBoard(t, BOARD_BEAGLEBONE)
+	tree, _ := useFakeSysfsPWMTree(t)
+	if err := tree.AddChipAt(1, 2, filepath.Join(t.TempDir(), "48300200.pwm")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.AddChipAt(4, 2, filepath.Join(t.TempDir(), "48302200.pwm")); err != nil {
+		t.Fatal(err)
+	}
+	pwm, err := NewBBBPWM("P9_16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pwm.Close()
+	if err = pwm.SetFrequency(1000); err != nil {
+		t.Fatal(err)
+	}
+	if period, _, _ := tree.Output(4, 1); period != 1000000 {
+		t.Errorf("period of pwmchip4/pwm1 is %d", period)
+	}
+}
+
+// BeagleBoard.org 4.14 and 4.19 kernels name the channels pwm-<chip>:<channel>
+func Test_SysfsPWMChannelNameWithChip(t *testing.T) {
+	dir := t.TempDir()
+	cdir := filepath.Join(dir, "pwmchip4", "pwm-4:1")
+	os.MkdirAll(cdir, 0755)
+	ioutil.WriteFile(filepath.Join(dir, "pwmchip4", "export"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(cdir, "period"), []byte("0\n"), 0644)
+	ioutil.WriteFile(filepath.Join(cdir, "duty_cycle"), []byte("0\n"), 0644)
+	prev := sysfs_pwm_base_
+	sysfs_pwm_base_ = dir
+	t.Cleanup(func() { sysfs_pwm_base_ = prev })
+	useFreshClaimRegistry(t)
+	pwm, err := NewSysfsPWM(4, 1, PWMWithExportWaitTimeout(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pwm.Close()
+	if err = pwm.SetPeriod(time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(cdir, "period")); strings.TrimSpace(string(b)) != "1000000" {
+		t.Errorf("period is %q", b)
+	}
+}
@@ -0,0 +1,88 @@
+package bbhw
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A pwmchip in /sys/class/pwm as reported by ListPWMChips
+type PWMChipInfo struct {
+	Chip     uint   `json:"chip"`
+	NPWM     uint   `json:"npwm"`     // number of channels
+	Exported []uint `json:"exported"` // channels exported by anyone, ascending
+	// parent device, e.g. /sys/devices/platform/ocp/48302000.epwmss/48302200.pwm. Empty if pwmchipN is no symlink.
+	Device string `json:"device,omitempty"`
+	// PWM module of the BeagleBone the device is, e.g. ehrpwm1 or ecap2, empty for other devices
+	Module string `json:"module,omitempty"`
+}
+
+// Lists the pwmchips the kernel exposes, ordered by number. No /sys/class/pwm at all is no error but no chips.
+func ListPWMChips() ([]PWMChipInfo, error) {
+	paths, err := filepath.Glob(filepath.Join(sysfs_pwm_base_, "pwmchip*"))
+	if err != nil {
+		return nil, err
+	}
+	chips := make([]PWMChipInfo, 0, len(paths))
+	for _, path := range paths {
+		n, err := strconv.ParseUint(strings.TrimPrefix(filepath.Base(path), "pwmchip"), 10, 32)
+		if err != nil {
+			continue
+		}
+		info, err := readPWMChipInfo(uint(n), path)
+		if err != nil {
+			return nil, err
+		}
+		chips = append(chips, info)
+	}
+	sort.Slice(chips, func(i, j int) bool { return chips[i].Chip < chips[j].Chip })
+	return chips, nil
+}
+
+func readPWMChipInfo(chip uint, path string) (info PWMChipInfo, err error) {
+	info = PWMChipInfo{Chip: chip, Exported: []uint{}}
+	b, err := os.ReadFile(filepath.Join(path, "npwm"))
+	if err != nil {
+		return info, err
+	}
+	npwm, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 32)
+	if err != nil {
+		return info, fmt.Errorf("pwmchip%d: npwm %q: %w", chip, strings.TrimSpace(string(b)), ErrInvalidAttribute)
+	}
+	info.NPWM = uint(npwm)
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return info, err
+	}
+	// pwmM, or pwm-N:M with BeagleBoard.org 4.14 and 4.19 kernels
+	with_chip := fmt.Sprintf("pwm-%d:", chip)
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, with_chip) {
+			name = name[len(with_chip):]
+		} else if strings.HasPrefix(name, "pwm") {
+			name = name[len("pwm"):]
+		} else {
+			continue
+		}
+		if channel, err := strconv.ParseUint(name, 10, 32); err == nil && e.IsDir() {
+			info.Exported = append(info.Exported, uint(channel))
+		}
+	}
+	sort.Slice(info.Exported, func(i, j int) bool { return info.Exported[i] < info.Exported[j] })
+	// /sys/class/pwm/pwmchipN -> ../../devices/.../<device>/pwm/pwmchipN
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			device := filepath.Dir(resolved)
+			if filepath.Base(device) == "pwm" {
+				device = filepath.Dir(device)
+			}
+			info.Device = device
+			info.Module = bbbPWMModule(filepath.Base(device))
+		}
+	}
+	return info, nil
+}
@@ -0,0 +1,100 @@
+package bbhw
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_ListPWMChips(t *testing.T) {
+	type chip struct {
+		npwm     uint
+		exported []uint
+		device   string // below devices/platform/ocp
+		module   string
+	}
+	for dir, expected := range map[string]map[uint]chip{
+		"pwm-4.19": {
+			0: {1, []uint{}, "48300000.epwmss/48300100.ecap", "ecap0"},
+			1: {2, []uint{}, "48300000.epwmss/48300200.pwm", "ehrpwm0"},
+			4: {2, []uint{0}, "48302000.epwmss/48302200.pwm", "ehrpwm1"},
+			6: {1, []uint{}, "48304000.epwmss/48304100.ecap", "ecap2"},
+			7: {2, []uint{}, "48304000.epwmss/48304200.pwm", "ehrpwm2"},
+		},
+		"pwm-5.10": {
+			0: {1, []uint{}, "48300000.target-module/48300000.epwmss/48300100.pwm", "ecap0"},
+			2: {1, []uint{}, "48304000.target-module/48304000.epwmss/48304100.pwm", "ecap2"},
+			3: {2, []uint{1}, "48300000.target-module/48300000.epwmss/48300200.pwm", "ehrpwm0"},
+			5: {2, []uint{}, "48302000.target-module/48302000.epwmss/48302200.pwm", "ehrpwm1"},
+		},
+	} {
+		usePWMClassDir(t, dir)
+		chips, err := ListPWMChips()
+		if err != nil {
+			t.Fatal(dir, err)
+		}
+		if len(chips) != len(expected) {
+			t.Fatalf("%s: %d chips, expected %d: %+v", dir, len(chips), len(expected), chips)
+		}
+		for i, c := range chips {
+			if i > 0 && chips[i-1].Chip >= c.Chip {
+				t.Errorf("%s: pwmchip%d listed after pwmchip%d", dir, c.Chip, chips[i-1].Chip)
+			}
+			e, ok := expected[c.Chip]
+			device := filepath.Join("testdata", dir, "devices", "platform", "ocp", filepath.FromSlash(e.device))
+			if !ok || c.NPWM != e.npwm || !reflect.DeepEqual(c.Exported, e.exported) || c.Device != device || c.Module != e.module {
+				t.Errorf("%s: %+v, expected %+v", dir, c, e)
+			}
+		}
+	}
+}
+
+func Test_ListPWMChipsJSON(t *testing.T) {
+	usePWMClassDir(t, "pwm-5.10")
+	chips, err := ListPWMChips()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(chips[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); !strings.HasPrefix(s, `{"chip":0,"npwm":1,"exported":[],"device":"testdata/`) || !strings.HasSuffix(s, `,"module":"ecap0"}`) {
+		t.Error(s)
+	}
+	var back PWMChipInfo
+	if err = json.Unmarshal(b, &back); err != nil || !reflect.DeepEqual(back, chips[0]) {
+		t.Errorf("%+v, %v", back, err)
+	}
+}
+
+func Test_ListPWMChipsFakeTree(t *testing.T) {
+	tree, err := NewFakeSysfsPWMTree(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+	chips, err := ListPWMChips()
+	if err != nil || len(chips) != 0 {
+		t.Fatalf("empty tree: %+v, %v", chips, err)
+	}
+	tree.AddChip(2, 1)
+	device := filepath.Join(t.TempDir(), "48304200.pwm")
+	tree.AddChipAt(0, 2, device)
+	if err = tree.Export(0, 1); err != nil {
+		t.Fatal(err)
+	}
+	chips, err = ListPWMChips()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []PWMChipInfo{
+		{Chip: 0, NPWM: 2, Exported: []uint{1}, Device: device, Module: "ehrpwm2"},
+		{Chip: 2, NPWM: 1, Exported: []uint{}},
+	}
+	if !reflect.DeepEqual(chips, expected) {
+		t.Errorf("%+v, expected %+v", chips, expected)
+	}
+}
@@ -0,0 +1,90 @@
+package bbhw
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// behaviour every PWM implementation must show
+func checkPWMBehaviour(t *testing.T, name string, pwm PWM) {
+	getters, _ := pwm.(interface {
+		GetFrequency() (float64, error)
+		GetDutyFraction() (float64, error)
+	})
+	if getters == nil {
+		t.Fatalf("%s: no GetFrequency and GetDutyFraction", name)
+	}
+	if err := pwm.SetFrequency(1000); err != nil {
+		t.Errorf("%s: SetFrequency(1000): %v", name, err)
+	}
+	if err := pwm.SetDutyFraction(0.25); err != nil {
+		t.Errorf("%s: SetDutyFraction(0.25): %v", name, err)
+	}
+	if err := pwm.Enable(); err != nil {
+		t.Errorf("%s: Enable(): %v", name, err)
+	}
+	// the duty fraction is kept across frequency changes
+	if err := pwm.SetFrequency(200); err != nil {
+		t.Errorf("%s: SetFrequency(200): %v", name, err)
+	}
+	if hz, err := getters.GetFrequency(); err != nil || math.Abs(hz-200) > 1e-6 {
+		t.Errorf("%s: GetFrequency() = %v, %v after SetFrequency(200)", name, hz, err)
+	}
+	if f, err := getters.GetDutyFraction(); err != nil || math.Abs(f-0.25) > 1e-6 {
+		t.Errorf("%s: GetDutyFraction() = %v, %v after SetFrequency(200)", name, f, err)
+	}
+	for _, fraction := range []float64{-0.1, 1.1, math.NaN()} {
+		if err := pwm.SetDutyFraction(fraction); !errors.Is(err, ErrOutOfRange) {
+			t.Errorf("%s: SetDutyFraction(%v) returned %v, expected ErrOutOfRange", name, fraction, err)
+		}
+	}
+	for _, inverted := range []bool{true, false} {
+		if err := pwm.SetPolarity(inverted); err != nil {
+			t.Errorf("%s: SetPolarity(%v) while enabled: %v", name, inverted, err)
+		}
+	}
+	if err := pwm.Disable(); err != nil {
+		t.Errorf("%s: Disable(): %v", name, err)
+	}
+	// legacy view
+	legacy := ToLegacyPWM(pwm)
+	legacy.SetPWM(2*time.Millisecond, 500*time.Microsecond)
+	if period, duty := legacy.GetPWM(); period != 2*time.Millisecond || duty != 500*time.Microsecond {
+		t.Errorf("%s: GetPWM() = %v, %v through ToLegacyPWM", name, period, duty)
+	}
+	legacy.DisablePWM()
+	pwm.Close()
+}
+
+func Test_PWMConformance(t *testing.T) {
+	t.Run("FakePWM", func(t *testing.T) {
+		checkPWMBehaviour(t, "FakePWM", NewFakeNamedPWM("PWM"))
+	})
+	t.Run("SysfsPWM", func(t *testing.T) {
+		useFakeSysfsPWMTree(t)
+		checkPWMBehaviour(t, "SysfsPWM", NewSysfsPWMOrPanic(0, 1))
+	})
+	t.Run("SoftPWM", func(t *testing.T) {
+		gpio := NewFakeGPIO(1, OUT)
+		defer gpio.Close()
+		p, err := NewSoftPWM(gpio, SoftPWMWithClock(NewManualClock(time.Unix(1000, 0))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p.Close()
+		checkPWMBehaviour(t, "SoftPWM", p)
+	})
+}
+
+func Test_NewBBBPWMOrPanic(t *testing.T) {
+	useBoard(t, BOARD_BEAGLEBONE)
+	useFakeSysfsPWMTree(t)
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic without the pwmchip of ehrpwm2")
+		}
+	}()
+	NewBBBPWMOrPanic("P8_19")
+}
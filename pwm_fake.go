@@ -1,6 +1,10 @@
 package bbhw
 
-import "time"
+import (
+	"fmt"
+	"sync"
+	"time"
+)
 
 // Fake PWM for Testing
 
@@ -11,7 +15,7 @@ type FakePWMPin struct {
 	polarity bool
 }
 
-// Example: StepperPWM, err = NewBBBPWM("P9_16")
+// Example: StepperPWM, err = NewFakePWM("P9_16")
 func NewFakePWM(name string) (pwm *FakePWMPin, err error) {
 	pwm = new(FakePWMPin)
 	pwm.name = name
@@ -50,3 +54,228 @@ func (pwm *FakePWMPin) GetPWM() (period, duty time.Duration) {
 func (pwm *FakePWMPin) Close() {
 	pwm = nil
 }
+
+// Fake of a SysfsPWM channel for testing controllers: keeps period, duty and enable like the kernel does
+// (including rejecting a duty longer than the period), records changes after EnableHistory and fails on
+// request, see FailNext. Safe for concurrent use.
+type FakePWM struct {
+	name     string
+	lock     sync.Mutex // guards everything below
+	period   time.Duration
+	duty     time.Duration
+	enabled  bool
+	inverted bool
+	fraction float64 // of SetDutyFraction, kept across SetFrequency
+	clock    Clock   // nil: the default clock
+	logger   Logger
+	history  pwmHistory
+	failures fakeFailures
+	ramp     pwmRamp
+}
+
+// The name shows up in errors, logs and DumpPWMVCD. Starts disabled without a period, like a freshly exported channel.
+func NewFakeNamedPWM(name string) *FakePWM {
+	return &FakePWM{name: name}
+}
+
+// Use c for the timestamps of History, nil reverts to the default clock, see SetDefaultClock
+func (pwm *FakePWM) SetClock(c Clock) {
+	pwm.lock.Lock()
+	defer pwm.lock.Unlock()
+	pwm.clock = c
+}
+
+// Log every change to l instead of the package Logger
+func (pwm *FakePWM) SetLogger(l Logger) {
+	pwm.lock.Lock()
+	defer pwm.lock.Unlock()
+	pwm.logger = l
+}
+
+// the caller holds lock
+func (pwm *FakePWM) now() time.Time {
+	if pwm.clock == nil {
+		return defaultClock().Now()
+	}
+	return pwm.clock.Now()
+}
+
+// records and logs the settings after op, the caller holds lock
+func (pwm *FakePWM) changed(op string) {
+	pwm.history.record(PWMChange{Time: pwm.now(), Period: pwm.period, Duty: pwm.duty, Enabled: pwm.enabled, Inverted: pwm.inverted, Op: op})
+	loggerOr(pwm.logger).Log(LOG_DEBUG, "FakePWM: "+op, "pwm", pwm.name, "period", pwm.period, "duty", pwm.duty, "enabled", pwm.enabled, "inverted", pwm.inverted)
+}
+
+// the error to inject into op, if any, recorded in the History. The caller holds lock
+func (pwm *FakePWM) injectedFailure(op string) error {
+	err := pwm.failures.take(op)
+	if err == nil {
+		return nil
+	}
+	err = fmt.Errorf("%s: %s: %w", pwm.name, op, err)
+	loggerOr(pwm.logger).Log(LOG_DEBUG, "FakePWM: injected failure", "pwm", pwm.name, "err", err)
+	pwm.history.record(PWMChange{Time: pwm.now(), Period: pwm.period, Duty: pwm.duty, Enabled: pwm.enabled, Inverted: pwm.inverted, Op: op, Err: err})
+	return err
+}
+
+// Keeps the duty, shortened to period if longer, like SysfsPWM.SetPeriod
+func (pwm *FakePWM) SetPeriod(period time.Duration) error {
+	pwm.lock.Lock()
+	defer pwm.lock.Unlock()
+	if err := pwm.injectedFailure("SetPeriod"); err != nil {
+		return err
+	}
+	if period <= 0 {
+		return fmt.Errorf("%s: set period %v: %w", pwm.name, period, ErrOutOfRange)
+	}
+	pwm.period = period
+	if pwm.duty > period {
+		pwm.duty = period
+	}
+	pwm.fraction = float64(pwm.duty) / float64(period)
+	pwm.changed("SetPeriod")
+	return nil
+}
+
+// Fails with ErrOutOfRange without a period or if longer, like SysfsPWM.SetDutyNanoseconds
+func (pwm *FakePWM) SetDutyNanoseconds(duty uint64) error {
+	pwm.lock.Lock()
+	defer pwm.lock.Unlock()
+	if err := pwm.injectedFailure("SetDutyNanoseconds"); err != nil {
+		return err
+	}
+	if pwm.period == 0 || time.Duration(duty) > pwm.period {
+		return fmt.Errorf("%s: set duty %dns without or longer than period %v: %w", pwm.name, duty, pwm.period, ErrOutOfRange)
+	}
+	pwm.duty = time.Duration(duty)
+	pwm.fraction = float64(pwm.duty) / float64(pwm.period)
+	pwm.changed("SetDutyNanoseconds")
+	return nil
+}
+
+// Same rounding, range and kept duty fraction as SysfsPWM.SetFrequency
+func (pwm *FakePWM) SetFrequency(hz float64) error {
+	pwm.lock.Lock()
+	defer pwm.lock.Unlock()
+	if err := pwm.injectedFailure("SetFrequency"); err != nil {
+		return err
+	}
+	period, err := periodOfFrequency(hz)
+	if err != nil {
+		return fmt.Errorf("%s: set frequency: %w", pwm.name, err)
+	}
+	pwm.period = time.Duration(period)
+	pwm.duty = time.Duration(fractionOf(period, pwm.fraction))
+	pwm.changed("SetFrequency")
+	return nil
+}
+
+// Same as SysfsPWM.SetDutyFraction, without a period the fraction is only remembered
+func (pwm *FakePWM) SetDutyFraction(fraction float64) error {
+	pwm.lock.Lock()
+	defer pwm.lock.Unlock()
+	if err := pwm.injectedFailure("SetDutyFraction"); err != nil {
+		return err
+	}
+	if err := checkDutyFraction(fraction); err != nil {
+		return fmt.Errorf("%s: set duty fraction: %w", pwm.name, err)
+	}
+	pwm.fraction = fraction
+	if pwm.period == 0 {
+		return nil
+	}
+	pwm.duty = time.Duration(fractionOf(uint64(pwm.period), fraction))
+	pwm.changed("SetDutyFraction")
+	return nil
+}
+
+// 1/period, 0 without a period
+func (pwm *FakePWM) GetFrequency() (float64, error) {
+	pwm.lock.Lock()
+	defer pwm.lock.Unlock()
+	if pwm.period == 0 {
+		return 0, nil
+	}
+	return float64(time.Second) / float64(pwm.period), nil
+}
+
+// duty / period, 0 without a period
+func (pwm *FakePWM) GetDutyFraction() (float64, error) {
+	pwm.lock.Lock()
+	defer pwm.lock.Unlock()
+	if pwm.period == 0 {
+		return 0, nil
+	}
+	return float64(pwm.duty) / float64(pwm.period), nil
+}
+
+// Fails without a period, like the kernel
+func (pwm *FakePWM) Enable() error {
+	pwm.lock.Lock()
+	defer pwm.lock.Unlock()
+	if err := pwm.injectedFailure("Enable"); err != nil {
+		return err
+	}
+	if pwm.period == 0 {
+		return fmt.Errorf("%s: enable without a period: %w", pwm.name, ErrOutOfRange)
+	}
+	pwm.enabled = true
+	pwm.changed("Enable")
+	return nil
+}
+
+func (pwm *FakePWM) Disable() error {
+	pwm.lock.Lock()
+	defer pwm.lock.Unlock()
+	if err := pwm.injectedFailure("Disable"); err != nil {
+		return err
+	}
+	pwm.enabled = false
+	pwm.changed("Disable")
+	return nil
+}
+
+// Inverts the output, active low. Unlike the kernel it does not care whether the output is enabled,
+// as SysfsPWM.SetPolarity disables it around the change.
+func (pwm *FakePWM) SetPolarity(inverted bool) error {
+	pwm.lock.Lock()
+	defer pwm.lock.Unlock()
+	if err := pwm.injectedFailure("SetPolarity"); err != nil {
+		return err
+	}
+	pwm.inverted = inverted
+	pwm.changed("SetPolarity")
+	return nil
+}
+
+// Whether the output is inverted, see SetPolarity
+func (pwm *FakePWM) Inverted() bool {
+	pwm.lock.Lock()
+	defer pwm.lock.Unlock()
+	return pwm.inverted
+}
+
+// Current settings
+func (pwm *FakePWM) Output() (period, duty time.Duration, enabled bool) {
+	pwm.lock.Lock()
+	defer pwm.lock.Unlock()
+	return pwm.period, pwm.duty, pwm.enabled
+}
+
+// Like SysfsPWM.RampTo, the updates are scheduled on the clock of SetClock unless RampWithClock is given
+func (pwm *FakePWM) RampTo(fraction float64, over time.Duration, opts ...RampOption) (done <-chan error) {
+	pwm.lock.Lock()
+	clock := pwm.clock
+	pwm.lock.Unlock()
+	return pwm.ramp.rampTo(pwm, clock, fraction, over, opts)
+}
+
+// Stops a ramp of RampTo
+func (pwm *FakePWM) CancelRamp() {
+	pwm.ramp.cancel()
+}
+
+// Like SysfsPWM.Close, leaves the output running but cancels a ramp
+func (pwm *FakePWM) Close() {
+	pwm.ramp.cancel()
+}
@@ -0,0 +1,177 @@
+package bbhw
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Settings of a FakePWM after a change, recorded after EnableHistory
+type PWMChange struct {
+	Time    time.Time
+	Period  time.Duration
+	Duty    time.Duration
+	Enabled bool
+	// active low, see SetPolarity. DutyFraction and DumpPWMVCD ignore it
+	Inverted bool
+	Op       string // the call making the change, e.g. "SetFrequency"
+	Err      error  // an injected failure of Op, see FakePWM.FailNext. The settings are then unchanged
+}
+
+// Duty / Period of the output, 0 while disabled or without a period
+func (c PWMChange) DutyFraction() float64 {
+	if !c.Enabled || c.Period == 0 {
+		return 0
+	}
+	return float64(c.Duty) / float64(c.Period)
+}
+
+type pwmHistory struct {
+	lock  sync.Mutex
+	ring  fakeRing  // of PWMChange
+	start PWMChange // settings at EnableHistory
+	last  PWMChange
+}
+
+// records c unless it neither changes the settings nor is a failure
+func (h *pwmHistory) record(c PWMChange) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if c.Err == nil {
+		if c.Period == h.last.Period && c.Duty == h.last.Duty && c.Enabled == h.last.Enabled && c.Inverted == h.last.Inverted {
+			return
+		}
+		h.last = c
+	}
+	h.ring.push(c)
+}
+
+// Start recording changes of the settings, keeping the newest capacity ones.
+// Discards what was recorded so far, capacity < 1 stops recording.
+func (pwm *FakePWM) EnableHistory(capacity int) {
+	pwm.lock.Lock()
+	defer pwm.lock.Unlock()
+	h := &pwm.history
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.ring.reset(capacity)
+	h.start = PWMChange{Period: pwm.period, Duty: pwm.duty, Enabled: pwm.enabled, Inverted: pwm.inverted}
+	h.last = h.start
+}
+
+// recorded changes, oldest first
+func (pwm *FakePWM) History() []PWMChange {
+	h := &pwm.history
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	items := h.ring.all()
+	history := make([]PWMChange, len(items))
+	for i, v := range items {
+		history[i] = v.(PWMChange)
+	}
+	return history
+}
+
+// Fails t unless the duty fraction currently output (0 while disabled) is within tolerance of fraction
+func (pwm *FakePWM) AssertDutyNear(t testing.TB, fraction, tolerance float64) {
+	t.Helper()
+	period, duty, enabled := pwm.Output()
+	got := PWMChange{Period: period, Duty: duty, Enabled: enabled}.DutyFraction()
+	if math.Abs(got-fraction) > tolerance {
+		t.Errorf("%s: expected duty %v±%v, got %v (period %v, duty %v, enabled %v)", pwm.name, fraction, tolerance, got, period, duty, enabled)
+	}
+}
+
+// Fails t unless the frequency currently set is within tolerance (in Hz) of hz
+func (pwm *FakePWM) AssertFrequencyNear(t testing.TB, hz, tolerance float64) {
+	t.Helper()
+	got, _ := pwm.GetFrequency()
+	if math.Abs(got-hz) > tolerance {
+		t.Errorf("%s: expected frequency %v±%vHz, got %vHz", pwm.name, hz, tolerance, got)
+	}
+}
+
+// operations of a FakePWM which FailNext and SetFailureRate can make fail
+var fake_pwm_failure_ops_ = map[string]bool{"SetPeriod": true, "SetDutyNanoseconds": true, "SetFrequency": true,
+	"SetDutyFraction": true, "SetPolarity": true, "Enable": true, "Disable": true}
+
+func checkFakePWMFailureOp(op string) {
+	if !fake_pwm_failure_ops_[op] {
+		panic(fmt.Sprintf("FakePWM: can not inject failures into %q, only SetPeriod, SetDutyNanoseconds, SetFrequency, SetDutyFraction, SetPolarity, Enable or Disable", op))
+	}
+}
+
+// The next call of op ("SetPeriod", "SetDutyNanoseconds", "SetFrequency", "SetDutyFraction", "Enable" or "Disable")
+// returns err instead of doing anything, like FakeGPIO.FailNext.
+func (pwm *FakePWM) FailNext(op string, err error) {
+	checkFakePWMFailureOp(op)
+	pwm.failures.failNext(op, err)
+}
+
+// Each call of op fails with err with the given probability (0 stops failing), see SetFailureSeed
+func (pwm *FakePWM) SetFailureRate(op string, probability float64, err error) {
+	checkFakePWMFailureOp(op)
+	pwm.failures.setRate(op, probability, err)
+}
+
+// Makes the failures of SetFailureRate reproducible, without a seed they are seeded from the current time
+func (pwm *FakePWM) SetFailureSeed(seed int64) {
+	pwm.failures.setSeed(seed)
+}
+
+// Writes the duty fraction output over time (see PWMChange.DutyFraction) of the History of pwms as Value Change Dump
+// with real valued signals, like DumpVCD does for FakeGPIOs. Injected failures are left out. All pwms need EnableHistory.
+func DumpPWMVCD(w io.Writer, pwms ...*FakePWM) error {
+	type change struct {
+		t    time.Time
+		id   string
+		duty float64
+	}
+	var changes []change
+	initial := make([]float64, len(pwms))
+	for i, pwm := range pwms {
+		pwm.history.lock.Lock()
+		enabled := pwm.history.ring.items != nil
+		initial[i] = pwm.history.start.DutyFraction()
+		pwm.history.lock.Unlock()
+		if !enabled {
+			return fmt.Errorf("DumpPWMVCD: %s: no history recorded, see EnableHistory", pwm.name)
+		}
+		for _, c := range pwm.History() {
+			if c.Err == nil {
+				changes = append(changes, change{c.Time, vcdIdentifier(i), c.DutyFraction()})
+			}
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].t.Before(changes[j].t) })
+
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "$version go-bbhw FakePWM $end\n$timescale 1ns $end\n$scope module bbhw $end\n")
+	for i, pwm := range pwms {
+		fmt.Fprintf(b, "$var real 64 %s %s $end\n", vcdIdentifier(i), strings.Join(strings.Fields(pwm.name), "_"))
+	}
+	fmt.Fprintf(b, "$upscope $end\n$enddefinitions $end\n#0\n$dumpvars\n")
+	for i := range pwms {
+		fmt.Fprintf(b, "r%v %s\n", initial[i], vcdIdentifier(i))
+	}
+	fmt.Fprintf(b, "$end\n")
+	var t0 time.Time
+	if len(changes) > 0 {
+		t0 = changes[0].t
+	}
+	var last time.Duration // #0 already written
+	for _, c := range changes {
+		if ts := c.t.Sub(t0); ts != last {
+			fmt.Fprintf(b, "#%d\n", ts.Nanoseconds())
+			last = ts
+		}
+		fmt.Fprintf(b, "r%v %s\n", c.duty, c.id)
+	}
+	return b.Flush()
+}
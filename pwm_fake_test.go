@@ -0,0 +1,157 @@
+package bbhw
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_FakePWMLikeSysfs(t *testing.T) {
+	pwm := NewFakeNamedPWM("FAN")
+	if err := pwm.Enable(); !errors.Is(err, ErrOutOfRange) {
+		t.Error("enabled without period:", err)
+	}
+	if err := pwm.SetDutyFraction(0.4); err != nil {
+		t.Fatal(err)
+	}
+	if err := pwm.SetFrequency(25000); err != nil {
+		t.Fatal(err)
+	}
+	if err := pwm.Enable(); err != nil {
+		t.Fatal(err)
+	}
+	pwm.AssertFrequencyNear(t, 25000, 0.1)
+	pwm.AssertDutyNear(t, 0.4, 1e-9)
+	if err := pwm.SetFrequency(1000); err != nil {
+		t.Fatal(err)
+	}
+	pwm.AssertDutyNear(t, 0.4, 1e-9)
+	if err := pwm.SetPeriod(100 * time.Microsecond); err != nil {
+		t.Fatal(err)
+	}
+	if period, duty, _ := pwm.Output(); period != 100*time.Microsecond || duty != 100*time.Microsecond {
+		t.Errorf("period %v duty %v, expected the duty shortened to the period", period, duty)
+	}
+	if err := pwm.SetDutyNanoseconds(100001); !errors.Is(err, ErrOutOfRange) {
+		t.Error("duty longer than period:", err)
+	}
+	var rerr *PWMRangeError
+	if err := pwm.SetFrequency(0); !errors.As(err, &rerr) {
+		t.Error("SetFrequency(0):", err)
+	}
+	if err := pwm.Disable(); err != nil {
+		t.Fatal(err)
+	}
+	pwm.AssertDutyNear(t, 0, 0)
+}
+
+func Test_FakePWMPolarity(t *testing.T) {
+	pwm := NewFakeNamedPWM("GATE")
+	pwm.SetFrequency(1000)
+	pwm.Enable()
+	pwm.EnableHistory(4)
+	if err := pwm.SetPolarity(true); err != nil {
+		t.Fatal(err)
+	}
+	if !pwm.Inverted() {
+		t.Error("not inverted after SetPolarity(true)")
+	}
+	if _, _, enabled := pwm.Output(); !enabled {
+		t.Error("disabled by SetPolarity")
+	}
+	if h := pwm.History(); len(h) != 1 || !h[0].Inverted || h[0].Op != "SetPolarity" {
+		t.Errorf("history %+v", h)
+	}
+	pwm.FailNext("SetPolarity", ErrNotSupported)
+	if err := pwm.SetPolarity(false); !errors.Is(err, ErrNotSupported) || !pwm.Inverted() {
+		t.Error("injected failure:", err)
+	}
+}
+
+func Test_FakePWMHistory(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	pwm := NewFakeNamedPWM("HEATER")
+	pwm.SetClock(clock)
+	pwm.EnableHistory(3)
+	pwm.SetFrequency(1000)
+	clock.Advance(time.Millisecond)
+	pwm.SetDutyFraction(0.5)
+	pwm.SetDutyFraction(0.5) // no change, not recorded
+	pwm.Enable()
+	clock.Advance(time.Millisecond)
+	pwm.SetDutyFraction(0.25)
+	h := pwm.History()
+	if len(h) != 3 || h[0].Op != "SetDutyFraction" || h[1].Op != "Enable" || h[2].Duty != 250*time.Microsecond {
+		t.Fatalf("unexpected history %+v", h)
+	}
+	if d := h[2].Time.Sub(h[0].Time); d != time.Millisecond {
+		t.Errorf("changes %v apart, expected 1ms", d)
+	}
+	if f := h[1].DutyFraction(); f != 0.5 {
+		t.Errorf("DutyFraction() = %v after Enable", f)
+	}
+}
+
+func Test_FakePWMFailures(t *testing.T) {
+	pwm := NewFakeNamedPWM("MOTOR")
+	pwm.EnableHistory(10)
+	boom := errors.New("boom")
+	pwm.FailNext("SetFrequency", boom)
+	if err := pwm.SetFrequency(100); !errors.Is(err, boom) || !strings.Contains(err.Error(), "MOTOR") {
+		t.Error("injected failure:", err)
+	}
+	if f, _ := pwm.GetFrequency(); f != 0 {
+		t.Error("failed SetFrequency changed the frequency to", f)
+	}
+	if err := pwm.SetFrequency(100); err != nil {
+		t.Fatal("only the next call should fail:", err)
+	}
+	pwm.SetFailureSeed(1)
+	pwm.SetFailureRate("Enable", 1, boom)
+	if err := pwm.Enable(); !errors.Is(err, boom) {
+		t.Error("failure rate 1:", err)
+	}
+	pwm.SetFailureRate("Enable", 0, nil)
+	if err := pwm.Enable(); err != nil {
+		t.Error("failure rate 0:", err)
+	}
+	h := pwm.History()
+	if len(h) != 4 || h[0].Err == nil || h[2].Err == nil || h[3].Op != "Enable" {
+		t.Errorf("unexpected history %+v", h)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("FailNext accepted unknown op")
+		}
+	}()
+	pwm.FailNext("Close", boom)
+}
+
+func Test_DumpPWMVCD(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	red, green := NewFakeNamedPWM("RED"), NewFakeNamedPWM("GREEN")
+	var buf bytes.Buffer
+	if err := DumpPWMVCD(&buf, red); err == nil || !strings.Contains(err.Error(), "RED") {
+		t.Errorf("pwm without history should fail, got %v", err)
+	}
+	for _, pwm := range []*FakePWM{red, green} {
+		pwm.SetClock(clock)
+		pwm.SetFrequency(1000)
+		pwm.Enable()
+		pwm.EnableHistory(10)
+	}
+	red.SetDutyFraction(0.5)
+	clock.Advance(time.Microsecond)
+	green.SetDutyFraction(0.25)
+	red.Disable()
+	if err := DumpPWMVCD(&buf, red, green); err != nil {
+		t.Fatal(err)
+	}
+	want := "$var real 64 ! RED $end\n$var real 64 \" GREEN $end\n$upscope $end\n$enddefinitions $end\n" +
+		"#0\n$dumpvars\nr0 !\nr0 \"\n$end\nr0.5 !\n#1000\nr0 !\nr0.25 \"\n"
+	if !strings.HasSuffix(buf.String(), want) {
+		t.Errorf("unexpected VCD:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,313 @@
+package bbhw
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Target of one PWM in PWMGroup.Apply
+type PWMSettings struct {
+	Frequency    float64 // Hz
+	DutyFraction float64 // 0.0 to 1.0
+	Enabled      bool
+}
+
+// rolling back to a channel without a period, which the kernel has no way back to
+var errNoPeriod = errors.New("no period to restore")
+
+// period and duty in nanoseconds as PWMGroup writes them, compared and restored in a rollback
+type pwmGroupState struct {
+	period  uint64
+	duty    uint64
+	enabled bool
+}
+
+// What PWMGroup needs of a PWM on top of the PWM interface: SysfsPWM, FakePWM and SoftPWM
+type pwmGroupMember interface {
+	PWM
+	groupState() (pwmGroupState, error)
+	// goes from from (as returned by groupState) to to, writing only what changes
+	groupApply(from, to pwmGroupState) error
+}
+
+// Changes several PWM channels together, e.g. the two halves of an H-bridge or the colours of an RGB LED,
+// never leaving them in a mixed state: see Apply. Safe for concurrent use, Applies are serialized.
+//
+// The A and B outputs of an eHRPWM module share the period register, the kernel refuses to give them different
+// periods. Apply therefore rejects different frequencies for SysfsPWMs of the same pwmchip, and as their period
+// is written only if it changes, updating the duty cycles of both outputs is just two writes.
+type PWMGroup struct {
+	lock    sync.Mutex
+	members []pwmGroupMember
+	// preallocated for Apply
+	from []pwmGroupState
+	to   []pwmGroupState
+}
+
+// Group of pwms, Apply writes them in this order. The PWMs stay usable on their own and belong to the caller.
+func NewPWMGroup(pwms ...PWM) (*PWMGroup, error) {
+	g := &PWMGroup{
+		members: make([]pwmGroupMember, len(pwms)),
+		from:    make([]pwmGroupState, len(pwms)),
+		to:      make([]pwmGroupState, len(pwms)),
+	}
+	for i, pwm := range pwms {
+		m, ok := pwm.(pwmGroupMember)
+		if !ok {
+			return nil, fmt.Errorf("PWMGroup: %T can not be grouped, only SysfsPWM, FakePWM and SoftPWM", pwm)
+		}
+		for _, other := range g.members[:i] {
+			if other == m {
+				return nil, fmt.Errorf("PWMGroup: %s twice", pwmName(pwm))
+			}
+		}
+		g.members[i] = m
+	}
+	return g, nil
+}
+
+// name of a PWM in errors
+func pwmName(pwm PWM) string {
+	switch p := pwm.(type) {
+	case *SysfsPWM:
+		return pwmClaimName(p.Chip, p.Channel)
+	case *FakePWM:
+		return p.name
+	}
+	return fmt.Sprintf("%T", pwm)
+}
+
+// Returned by Apply if writing one of the PWMs failed
+type PWMGroupError struct {
+	PWM      PWM     // the one which failed
+	Err      error   // its error
+	Rollback []error // errors of restoring the PWMs written before, nil if all were restored
+}
+
+func (e *PWMGroupError) Error() string {
+	msg := fmt.Sprintf("PWMGroup: %s: %v", pwmName(e.PWM), e.Err)
+	if len(e.Rollback) > 0 {
+		msgs := make([]string, len(e.Rollback))
+		for i, err := range e.Rollback {
+			msgs[i] = err.Error()
+		}
+		msg += fmt.Sprintf(", rolling back failed: %s", strings.Join(msgs, "; "))
+	}
+	return msg
+}
+
+// errors.Is and errors.As look at the error of the failed PWM and those of the rollback
+func (e *PWMGroupError) Unwrap() []error {
+	return append([]error{e.Err}, e.Rollback...)
+}
+
+// Sets the PWMs of the group in settings, members missing from it are left alone.
+// Validates all settings and reads the current ones before writing anything, then writes one PWM after the other
+// without allocating. If a write fails, the PWMs written before are set back to what they were (best effort)
+// and a *PWMGroupError reports the failure and any errors of the rollback.
+func (g *PWMGroup) Apply(settings map[PWM]PWMSettings) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	n := 0
+	for i, m := range g.members {
+		s, ok := settings[m]
+		if !ok {
+			continue
+		}
+		n++
+		period, err := periodOfFrequency(s.Frequency)
+		if err == nil {
+			err = checkDutyFraction(s.DutyFraction)
+		}
+		if err != nil {
+			return fmt.Errorf("PWMGroup: %s: %w", pwmName(m), err)
+		}
+		g.to[i] = pwmGroupState{period: period, duty: fractionOf(period, s.DutyFraction), enabled: s.Enabled}
+	}
+	if n != len(settings) {
+		for pwm := range settings {
+			if !g.contains(pwm) {
+				return fmt.Errorf("PWMGroup: %s is no member", pwmName(pwm))
+			}
+		}
+	}
+	for i, m := range g.members {
+		state, err := m.groupState()
+		if err != nil {
+			return fmt.Errorf("PWMGroup: %s: %w", pwmName(m), err)
+		}
+		g.from[i] = state
+		if _, ok := settings[m]; !ok {
+			g.to[i] = state
+		}
+	}
+	if err := g.checkSharedPeriods(); err != nil {
+		return err
+	}
+	for i, m := range g.members {
+		if _, ok := settings[m]; !ok {
+			continue
+		}
+		if err := m.groupApply(g.from[i], g.to[i]); err != nil {
+			return &PWMGroupError{PWM: m, Err: err, Rollback: g.rollback(i)}
+		}
+	}
+	return nil
+}
+
+func (g *PWMGroup) contains(pwm PWM) bool {
+	for _, m := range g.members {
+		if m == pwm {
+			return true
+		}
+	}
+	return false
+}
+
+// SysfsPWMs of one pwmchip, i.e. the outputs of one eHRPWM, have to end up with the same period
+func (g *PWMGroup) checkSharedPeriods() error {
+	for i, m := range g.members {
+		a, ok := m.(*SysfsPWM)
+		if !ok || g.to[i].period == 0 {
+			continue
+		}
+		for j := i + 1; j < len(g.members); j++ {
+			b, ok := g.members[j].(*SysfsPWM)
+			if ok && a.Chip == b.Chip && g.to[j].period != 0 && g.to[i].period != g.to[j].period {
+				return fmt.Errorf("PWMGroup: %s and %s share the period, %v and %v requested: %w", pwmName(a), pwmName(b),
+					time.Duration(g.to[i].period), time.Duration(g.to[j].period), ErrOutOfRange)
+			}
+		}
+	}
+	return nil
+}
+
+// restores the members before failed one in reverse order, returns the errors doing so
+func (g *PWMGroup) rollback(failed int) (errs []error) {
+	for i := failed - 1; i >= 0; i-- {
+		if g.from[i] == g.to[i] {
+			continue
+		}
+		m := g.members[i]
+		if err := m.groupApply(g.to[i], g.from[i]); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", pwmName(m), err))
+		}
+	}
+	// the failed one may be half way, back to where it was is the best guess
+	m := g.members[failed]
+	if state, err := m.groupState(); err == nil && state != g.from[failed] {
+		if err = m.groupApply(state, g.from[failed]); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", pwmName(m), err))
+		}
+	} else if err != nil {
+		errs = append(errs, fmt.Errorf("%s: %w", pwmName(m), err))
+	}
+	return errs
+}
+
+// ---------- pwmGroupMember implementations ----------
+
+func (pwm *SysfsPWM) groupState() (s pwmGroupState, err error) {
+	pwm.lock.Lock()
+	defer pwm.lock.Unlock()
+	if s.period, err = pwm.readNumber(pwm.period_fd, "read period"); err != nil {
+		return s, err
+	}
+	if s.duty, err = pwm.readNumber(pwm.duty_fd, "read duty_cycle"); err != nil {
+		return s, err
+	}
+	s.enabled, err = pwm.readEnabled()
+	return s, err
+}
+
+func (pwm *SysfsPWM) groupApply(from, to pwmGroupState) (err error) {
+	pwm.lock.Lock()
+	defer pwm.lock.Unlock()
+	if from.enabled && !to.enabled {
+		if err = pwm.writeEnable(false); err != nil {
+			return err
+		}
+	}
+	if to.period == 0 {
+		// the kernel has no way back to no period, stay disabled
+		if from.period != 0 {
+			return errNoPeriod
+		}
+		return nil
+	}
+	if to.period != from.period {
+		err = pwm.setPeriodDuty(to.period, to.duty, from.duty)
+	} else if to.duty != from.duty {
+		err = pwm.writeNumber(pwm.duty_fd, to.duty, "set duty_cycle")
+	}
+	if err != nil {
+		return err
+	}
+	pwm.fraction, pwm.fraction_set = float64(to.duty)/float64(to.period), true
+	if to.enabled && !from.enabled {
+		return pwm.writeEnable(true)
+	}
+	return nil
+}
+
+// through the exported methods, so History, FailNext and friends see the writes
+func (pwm *FakePWM) groupState() (pwmGroupState, error) {
+	period, duty, enabled := pwm.Output()
+	return pwmGroupState{period: uint64(period), duty: uint64(duty), enabled: enabled}, nil
+}
+
+func (pwm *FakePWM) groupApply(from, to pwmGroupState) error {
+	if from.enabled && !to.enabled {
+		if err := pwm.Disable(); err != nil {
+			return err
+		}
+	}
+	if to.period == 0 {
+		if from.period != 0 {
+			return errNoPeriod
+		}
+		return nil
+	}
+	if to.period != from.period {
+		if err := pwm.SetPeriod(time.Duration(to.period)); err != nil {
+			return err
+		}
+	}
+	if to.period != from.period || to.duty != from.duty {
+		if err := pwm.SetDutyNanoseconds(to.duty); err != nil {
+			return err
+		}
+	}
+	if to.enabled && !from.enabled {
+		return pwm.Enable()
+	}
+	return nil
+}
+
+func (p *SoftPWM) groupState() (pwmGroupState, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return pwmGroupState{period: uint64(p.period), duty: uint64(p.duty), enabled: p.stop != nil}, nil
+}
+
+func (p *SoftPWM) groupApply(from, to pwmGroupState) error {
+	if from.enabled && !to.enabled {
+		if err := p.Disable(); err != nil {
+			return err
+		}
+	}
+	if to.period == 0 {
+		return nil
+	}
+	p.lock.Lock()
+	p.period, p.duty = time.Duration(to.period), time.Duration(to.duty)
+	p.lock.Unlock()
+	p.notify()
+	if to.enabled && !from.enabled {
+		return p.Enable()
+	}
+	return nil
+}
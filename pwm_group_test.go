@@ -0,0 +1,151 @@
+package bbhw
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// "<pwm> <op>" of the FakePWM changes logged to l
+func fakePWMOps(l *recordingLogger) []string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	var ops []string
+	for _, line := range l.lines {
+		// 7 FakePWM: SetPeriod [pwm A period ...]
+		f := strings.Fields(line)
+		if len(f) > 4 && f[1] == "FakePWM:" && f[3] == "[pwm" {
+			ops = append(ops, f[4]+" "+f[2])
+		}
+	}
+	return ops
+}
+
+func newFakePWMGroup(t *testing.T, names ...string) (*PWMGroup, []*FakePWM, *recordingLogger) {
+	l := new(recordingLogger)
+	pwms := make([]*FakePWM, len(names))
+	members := make([]PWM, len(names))
+	for i, name := range names {
+		pwms[i] = NewFakeNamedPWM(name)
+		pwms[i].SetLogger(l)
+		pwms[i].EnableHistory(100)
+		members[i] = pwms[i]
+	}
+	g, err := NewPWMGroup(members...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g, pwms, l
+}
+
+func Test_PWMGroupApply(t *testing.T) {
+	g, pwms, l := newFakePWMGroup(t, "R", "G", "B")
+	r, green, b := pwms[0], pwms[1], pwms[2]
+	if err := g.Apply(map[PWM]PWMSettings{b: {1000, 0.75, true}, r: {1000, 0.25, true}}); err != nil {
+		t.Fatal(err)
+	}
+	// in the order of the group, the one missing left alone
+	expected := []string{"R SetPeriod", "R SetDutyNanoseconds", "R Enable", "B SetPeriod", "B SetDutyNanoseconds", "B Enable"}
+	if ops := fakePWMOps(l); fmt.Sprint(ops) != fmt.Sprint(expected) {
+		t.Errorf("ops %q, expected %q", ops, expected)
+	}
+	r.AssertDutyNear(t, 0.25, 1e-9)
+	b.AssertDutyNear(t, 0.75, 1e-9)
+	if len(green.History()) != 0 {
+		t.Errorf("G changed: %+v", green.History())
+	}
+	// only what changes is written
+	l.lines = nil
+	if err := g.Apply(map[PWM]PWMSettings{r: {1000, 0.5, true}, b: {1000, 0.75, false}}); err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"R SetDutyNanoseconds", "B Disable"}
+	if ops := fakePWMOps(l); fmt.Sprint(ops) != fmt.Sprint(expected) {
+		t.Errorf("ops %q, expected %q", ops, expected)
+	}
+}
+
+func Test_PWMGroupValidation(t *testing.T) {
+	g, pwms, l := newFakePWMGroup(t, "A", "B")
+	other := NewFakeNamedPWM("C")
+	for name, settings := range map[string]map[PWM]PWMSettings{
+		"frequency 0":  {pwms[0]: {1000, 0.5, true}, pwms[1]: {0, 0.5, true}},
+		"duty 1.5":     {pwms[0]: {1000, 1.5, true}},
+		"not a member": {pwms[0]: {1000, 0.5, true}, other: {1000, 0.5, true}},
+	} {
+		if err := g.Apply(settings); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+	// nothing written if anything is invalid
+	if ops := fakePWMOps(l); len(ops) != 0 {
+		t.Errorf("written despite invalid settings: %q", ops)
+	}
+	if _, err := NewPWMGroup(pwms[0], pwms[0]); err == nil {
+		t.Error("same PWM twice accepted")
+	}
+	if _, err := NewPWMGroup(struct{ PWM }{pwms[0]}); err == nil {
+		t.Error("PWM without group support accepted")
+	}
+}
+
+func Test_PWMGroupRollback(t *testing.T) {
+	g, pwms, l := newFakePWMGroup(t, "LEFT", "RIGHT")
+	left, right := pwms[0], pwms[1]
+	if err := g.Apply(map[PWM]PWMSettings{left: {1000, 0.1, true}, right: {1000, 0.1, true}}); err != nil {
+		t.Fatal(err)
+	}
+	l.lines = nil
+	failure := errors.New("write error")
+	right.FailNext("SetDutyNanoseconds", failure)
+	err := g.Apply(map[PWM]PWMSettings{left: {2000, 0.9, true}, right: {2000, 0.9, true}})
+	var gerr *PWMGroupError
+	if !errors.As(err, &gerr) || gerr.PWM != right || !errors.Is(err, failure) || len(gerr.Rollback) != 0 {
+		t.Fatalf("Apply returned %v", err)
+	}
+	// both back to what they were, RIGHT had its period changed already
+	expected := []string{"LEFT SetPeriod", "LEFT SetDutyNanoseconds", "RIGHT SetPeriod",
+		"LEFT SetPeriod", "LEFT SetDutyNanoseconds", "RIGHT SetPeriod", "RIGHT SetDutyNanoseconds"}
+	if ops := fakePWMOps(l); fmt.Sprint(ops) != fmt.Sprint(expected) {
+		t.Errorf("ops %q, expected %q", ops, expected)
+	}
+	for _, pwm := range pwms {
+		if period, _, enabled := pwm.Output(); period != time.Millisecond || !enabled {
+			t.Errorf("%s: period %v enabled %v after rollback", pwm.name, period, enabled)
+		}
+		pwm.AssertDutyNear(t, 0.1, 1e-9)
+	}
+	// a rollback failing as well is reported
+	left.FailNext("Enable", failure)
+	right.FailNext("Disable", failure)
+	err = g.Apply(map[PWM]PWMSettings{left: {1000, 0.5, false}, right: {1000, 0.5, false}})
+	if !errors.As(err, &gerr) || gerr.PWM != right || len(gerr.Rollback) != 1 || !strings.Contains(err.Error(), "LEFT") {
+		t.Errorf("Apply returned %v", err)
+	}
+}
+
+func Test_PWMGroupSharedPeriod(t *testing.T) {
+	useFakeSysfsPWMTree(t)
+	a, b := NewSysfsPWMOrPanic(0, 0), NewSysfsPWMOrPanic(0, 1)
+	defer a.Close()
+	defer b.Close()
+	g, err := NewPWMGroup(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = g.Apply(map[PWM]PWMSettings{a: {1000, 0.5, true}, b: {2000, 0.5, true}}); !errors.Is(err, ErrOutOfRange) {
+		t.Error("different periods on one pwmchip:", err)
+	}
+	if err = g.Apply(map[PWM]PWMSettings{a: {1000, 0.5, true}, b: {1000, 0.2, true}}); err != nil {
+		t.Fatal(err)
+	}
+	// a setting left alone counts as well
+	if err = g.Apply(map[PWM]PWMSettings{b: {500, 0.2, true}}); !errors.Is(err, ErrOutOfRange) {
+		t.Error("period different from the one of the other channel:", err)
+	}
+	if f, err := b.GetDutyFraction(); err != nil || f != 0.2 {
+		t.Errorf("GetDutyFraction() = %v, %v", f, err)
+	}
+}
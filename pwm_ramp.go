@@ -0,0 +1,155 @@
+package bbhw
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// returned on the done channel of RampTo if the ramp was replaced by another one or cancelled with CancelRamp
+var ErrRampCancelled = errors.New("ramp cancelled")
+
+// Option of RampTo
+type RampOption func(*rampOptions)
+
+type rampOptions struct {
+	easing      func(float64) float64
+	update_rate float64
+	clock       Clock
+}
+
+// how often a ramp updates the duty fraction by default, fine enough for LEDs and motors
+const ramp_update_rate_default_ = 100
+
+// Shapes the ramp: easing maps the elapsed fraction of the duration (0.0 to 1.0) to the fraction of the way
+// from the start to the target duty. Default is linear, see RampEaseInOut.
+func RampWithEasing(easing func(float64) float64) RampOption {
+	return func(o *rampOptions) { o.easing = easing }
+}
+
+// Updates the duty fraction hz times per second, default 100
+func RampWithUpdateRate(hz float64) RampOption {
+	return func(o *rampOptions) { o.update_rate = hz }
+}
+
+// Schedules the updates on c, by default on the clock of a FakePWM or else the default clock
+func RampWithClock(c Clock) RampOption {
+	return func(o *rampOptions) { o.clock = c }
+}
+
+// Starts and ends slowly (smoothstep), for fades which look smoother than linear ones
+func RampEaseInOut(x float64) float64 {
+	return x * x * (3 - 2*x)
+}
+
+// what a ramp sets and starts from, SysfsPWM and FakePWM
+type dutyFractioner interface {
+	SetDutyFraction(fraction float64) error
+	GetDutyFraction() (float64, error)
+}
+
+// The ramp of a PWM in progress, kept by the PWM types so a new RampTo replaces the running one
+type pwmRamp struct {
+	lock    sync.Mutex // guards current
+	current *pwmRampRun
+}
+
+type pwmRampRun struct {
+	cancel chan struct{}
+	exited chan struct{}
+}
+
+// Cancels a running ramp and waits for its goroutine to end. The caller holds lock.
+func (r *pwmRamp) stop() {
+	if r.current == nil {
+		return
+	}
+	close(r.current.cancel)
+	<-r.current.exited
+	r.current = nil
+}
+
+func (r *pwmRamp) cancel() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.stop()
+}
+
+func (r *pwmRamp) rampTo(pwm dutyFractioner, clock Clock, fraction float64, over time.Duration, opts []RampOption) <-chan error {
+	done := make(chan error, 1)
+	o := rampOptions{update_rate: ramp_update_rate_default_, clock: clock}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.clock == nil {
+		o.clock = defaultClock()
+	}
+	interval := time.Duration(float64(time.Second) / o.update_rate)
+	if !(o.update_rate > 0) || interval <= 0 {
+		done <- fmt.Errorf("RampTo: invalid update rate %vHz", o.update_rate)
+		return done
+	}
+	if err := checkDutyFraction(fraction); err != nil {
+		done <- fmt.Errorf("RampTo: %w", err)
+		return done
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.stop()
+	from, err := pwm.GetDutyFraction()
+	if err != nil {
+		done <- err
+		return done
+	}
+	run := &pwmRampRun{cancel: make(chan struct{}), exited: make(chan struct{})}
+	r.current = run
+	go func() {
+		defer close(run.exited)
+		done <- run.ramp(pwm, o.clock, o.easing, interval, from, fraction, over)
+	}()
+	return done
+}
+
+// Updates at multiples of the interval from the start, so slow SetDutyFractions do not stretch the ramp.
+// Ends with exactly the target.
+func (run *pwmRampRun) ramp(pwm dutyFractioner, clock Clock, easing func(float64) float64, interval time.Duration,
+	from, to float64, over time.Duration) error {
+	start := clock.Now()
+	for step := 1; ; step++ {
+		at := time.Duration(step) * interval
+		if at > over {
+			at = over
+		}
+		select {
+		case <-run.cancel:
+			return ErrRampCancelled
+		case <-clock.After(start.Add(at).Sub(clock.Now())):
+		}
+		select {
+		case <-run.cancel:
+			return ErrRampCancelled
+		default:
+		}
+		fraction := to
+		if at < over {
+			progress := float64(at) / float64(over)
+			if easing != nil {
+				progress = easing(progress)
+			}
+			fraction = from + (to-from)*progress
+			// easings overshooting 0..1 are cut off instead of failing the ramp
+			if fraction < 0 {
+				fraction = 0
+			} else if fraction > 1 {
+				fraction = 1
+			}
+		}
+		if err := pwm.SetDutyFraction(fraction); err != nil {
+			return fmt.Errorf("RampTo: %w", err)
+		}
+		if at >= over {
+			return nil
+		}
+	}
+}
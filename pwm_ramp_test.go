@@ -0,0 +1,166 @@
+package bbhw
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+type rampStep struct {
+	at       time.Duration // since the start
+	fraction float64
+}
+
+func expectRampSteps(t *testing.T, pwm *FakePWM, start time.Time, expected ...rampStep) {
+	t.Helper()
+	history := pwm.History()
+	if len(history) != len(expected) {
+		t.Fatalf("%d changes, expected %d: %+v", len(history), len(expected), history)
+	}
+	for i, c := range history {
+		if at := c.Time.Sub(start); at != expected[i].at || math.Abs(c.DutyFraction()-expected[i].fraction) > 1e-6 {
+			t.Errorf("change %d to %v at %v, expected %+v", i, c.DutyFraction(), at, expected[i])
+		}
+	}
+}
+
+func Test_PWMRampLinear(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	pwm := NewFakeNamedPWM("LED")
+	pwm.SetClock(clock)
+	defer pwm.Close()
+	pwm.SetFrequency(1000)
+	pwm.Enable()
+	pwm.EnableHistory(100)
+	start := clock.Now()
+	var done <-chan error
+	afterTimer(t, clock, func() { done = pwm.RampTo(0.5, 50*time.Millisecond, RampWithUpdateRate(100)) })
+	advanceSteps(t, clock, repeatStep(10*time.Millisecond, 5)...)
+	if err := expectPlayResult(t, done); err != nil {
+		t.Fatal(err)
+	}
+	expectRampSteps(t, pwm, start, rampStep{10 * time.Millisecond, 0.1}, rampStep{20 * time.Millisecond, 0.2},
+		rampStep{30 * time.Millisecond, 0.3}, rampStep{40 * time.Millisecond, 0.4}, rampStep{50 * time.Millisecond, 0.5})
+}
+
+func Test_PWMRampEasing(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	pwm := NewFakeNamedPWM("LED")
+	pwm.SetClock(clock)
+	defer pwm.Close()
+	pwm.SetFrequency(1000)
+	pwm.Enable()
+	pwm.EnableHistory(100)
+	pwm.SetDutyFraction(1)
+	pwm.EnableHistory(100)
+	start := clock.Now()
+	var done <-chan error
+	afterTimer(t, clock, func() {
+		done = pwm.RampTo(0, 100*time.Millisecond, RampWithUpdateRate(40), RampWithEasing(RampEaseInOut))
+	})
+	advanceSteps(t, clock, repeatStep(25*time.Millisecond, 4)...)
+	if err := expectPlayResult(t, done); err != nil {
+		t.Fatal(err)
+	}
+	expectRampSteps(t, pwm, start, rampStep{25 * time.Millisecond, 1 - 0.15625}, rampStep{50 * time.Millisecond, 0.5},
+		rampStep{75 * time.Millisecond, 0.15625}, rampStep{100 * time.Millisecond, 0})
+}
+
+func Test_PWMRampReplaced(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	pwm := NewFakeNamedPWM("LED")
+	pwm.SetClock(clock)
+	defer pwm.Close()
+	pwm.SetFrequency(1000)
+	pwm.Enable()
+	pwm.EnableHistory(100)
+	start := clock.Now()
+	var first, second <-chan error
+	afterTimer(t, clock, func() { first = pwm.RampTo(1, 100*time.Millisecond) })
+	for i := 0; i < 3; i++ {
+		afterTimer(t, clock, func() { clock.Advance(10 * time.Millisecond) })
+	}
+	// the new ramp starts from where the first one is
+	afterTimer(t, clock, func() { second = pwm.RampTo(0, 30*time.Millisecond) })
+	if err := expectPlayResult(t, first); !errors.Is(err, ErrRampCancelled) {
+		t.Error("replaced ramp:", err)
+	}
+	advanceSteps(t, clock, repeatStep(10*time.Millisecond, 3)...)
+	if err := expectPlayResult(t, second); err != nil {
+		t.Fatal(err)
+	}
+	expectRampSteps(t, pwm, start, rampStep{10 * time.Millisecond, 0.1}, rampStep{20 * time.Millisecond, 0.2},
+		rampStep{30 * time.Millisecond, 0.3}, rampStep{40 * time.Millisecond, 0.2}, rampStep{50 * time.Millisecond, 0.1},
+		rampStep{60 * time.Millisecond, 0})
+}
+
+func Test_PWMRampCancelAndErrors(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	pwm := NewFakeNamedPWM("LED")
+	pwm.SetClock(clock)
+	defer pwm.Close()
+	pwm.SetFrequency(1000)
+	pwm.Enable()
+	pwm.EnableHistory(100)
+	var done <-chan error
+	afterTimer(t, clock, func() { done = pwm.RampTo(1, time.Second) })
+	for i := 0; i < 2; i++ {
+		afterTimer(t, clock, func() { clock.Advance(10 * time.Millisecond) })
+	}
+	pwm.CancelRamp()
+	if err := expectPlayResult(t, done); !errors.Is(err, ErrRampCancelled) {
+		t.Error("cancelled ramp:", err)
+	}
+	clock.Advance(time.Second)
+	pwm.AssertDutyNear(t, 0.02, 1e-9)
+
+	failure := errors.New("write error")
+	pwm.FailNext("SetDutyFraction", failure)
+	afterTimer(t, clock, func() { done = pwm.RampTo(1, time.Second) })
+	clock.Advance(10 * time.Millisecond)
+	if err := expectPlayResult(t, done); !errors.Is(err, failure) {
+		t.Error("failing update:", err)
+	}
+	if err := <-pwm.RampTo(2, time.Second); !errors.Is(err, ErrOutOfRange) {
+		t.Error("RampTo(2):", err)
+	}
+	if err := <-pwm.RampTo(1, time.Second, RampWithUpdateRate(0)); err == nil {
+		t.Error("no error for update rate 0")
+	}
+	// no duration: set right away
+	if err := <-pwm.RampTo(0.7, 0); err != nil {
+		t.Fatal(err)
+	}
+	pwm.AssertDutyNear(t, 0.7, 1e-9)
+}
+
+func Test_SysfsPWMRamp(t *testing.T) {
+	tree, _ := useFakeSysfsPWMTree(t)
+	pwm, err := NewSysfsPWM(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pwm.Close()
+	if err = pwm.SetFrequency(1000); err != nil {
+		t.Fatal(err)
+	}
+	clock := NewManualClock(time.Unix(1000, 0))
+	var done <-chan error
+	afterTimer(t, clock, func() { done = pwm.RampTo(0.8, 40*time.Millisecond, RampWithClock(clock)) })
+	// writing sysfs files may take longer than Advance waits for the next update to be scheduled
+	for i := 0; i < 2; i++ {
+		afterTimer(t, clock, func() { clock.Advance(10 * time.Millisecond) })
+	}
+	if _, duty, _ := tree.Output(0, 0); duty != 400000 {
+		t.Errorf("duty %dns half way", duty)
+	}
+	afterTimer(t, clock, func() { clock.Advance(10 * time.Millisecond) })
+	clock.Advance(10 * time.Millisecond)
+	if err = expectPlayResult(t, done); err != nil {
+		t.Fatal(err)
+	}
+	if _, duty, _ := tree.Output(0, 0); duty != 800000 {
+		t.Errorf("duty %dns at the end", duty)
+	}
+}
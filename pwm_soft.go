@@ -0,0 +1,248 @@
+package bbhw
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Option of NewSoftPWM
+type SoftPWMOption func(*SoftPWM)
+
+// times the pulses on c
+func SoftPWMWithClock(c Clock) SoftPWMOption {
+	return func(p *SoftPWM) { p.clock = c }
+}
+
+// PWM generated in software by toggling any output GPIO from a goroutine, for pins without PWM hardware.
+// Pulses are scheduled at absolute times, so a late wake-up makes single pulses jitter but the frequency does not drift.
+// Implements PWM, so everything taking a hardware PWM works with it as well, ToLegacyPWM makes it a PWMPin.
+//
+// Realistic limits: the goroutine wakes up with some 10µs to 100µs of jitter (more under load) and every SetState
+// of a SysfsGPIO costs a write syscall of some 10µs, MMappedGPIO and CdevGPIO are way faster. Up to some 100Hz with
+// about 1% duty resolution (LEDs, fans) works on all backends, MMappedGPIO manages 1-2kHz with a coarse duty.
+// Anything faster or jitter sensitive (audio, motor drivers) needs a hardware PWM, see NewBBBPWM.
+type SoftPWM struct {
+	gpio     GPIOControllablePin
+	clock    Clock
+	running  sync.Mutex // held by Enable and Disable, so one goroutine is stopped before the next one starts
+	lock     sync.Mutex // guards everything below
+	period   time.Duration
+	duty     time.Duration
+	polarity bool
+	err      error
+	stop     chan struct{} // nil while disabled
+	done     chan struct{}
+	changed  chan struct{} // wakes the goroutine while it holds a level
+}
+
+// Wraps gpio, which has to be an output. Starts disabled, at 100Hz with duty 0, see Enable.
+func NewSoftPWM(gpio GPIOControllablePin, opts ...SoftPWMOption) (*SoftPWM, error) {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	p := &SoftPWM{gpio: gpio, period: 10 * time.Millisecond, changed: make(chan struct{}, 1)}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.clock == nil {
+		p.clock = defaultClock()
+	}
+	if err := checkOutput(gpio, "SoftPWM"); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Keeps the duty fraction. Takes effect with the next period.
+func (p *SoftPWM) SetFrequency(hz float64) error {
+	period := time.Duration(float64(time.Second) / hz)
+	if !(hz > 0) || math.IsInf(hz, 1) || period <= 0 {
+		return fmt.Errorf("SoftPWM: invalid frequency %vHz", hz)
+	}
+	p.lock.Lock()
+	p.duty = time.Duration(float64(period) * float64(p.duty) / float64(p.period))
+	p.period = period
+	p.lock.Unlock()
+	p.notify()
+	return nil
+}
+
+// Fraction between 0.0 and 1.0 of the period the output is active. 0 and 1 stop toggling and hold the level.
+// Takes effect with the next period. Fractions outside fail with a *PWMRangeError like those of SysfsPWM.
+func (p *SoftPWM) SetDutyFraction(fraction float64) error {
+	if err := checkDutyFraction(fraction); err != nil {
+		return fmt.Errorf("SoftPWM: set duty fraction: %w", err)
+	}
+	p.SetDuty(fraction)
+	return nil
+}
+
+// Like SetDutyFraction, but fractions outside 0.0 to 1.0 are cut off
+func (p *SoftPWM) SetDuty(fraction float64) {
+	if fraction > 1.0 {
+		fraction = 1.0
+	} else if !(fraction > 0.0) {
+		fraction = 0.0
+	}
+	p.lock.Lock()
+	p.duty = time.Duration(float64(p.period) * fraction)
+	p.lock.Unlock()
+	p.notify()
+}
+
+// 1/period
+func (p *SoftPWM) GetFrequency() (float64, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return float64(time.Second) / float64(p.period), nil
+}
+
+func (p *SoftPWM) GetDutyFraction() (float64, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return float64(p.duty) / float64(p.period), nil
+}
+
+// true inverts the output, i.e. the duty is the low time and a disabled SoftPWM holds the output high.
+// Takes effect with the next period, or the next Disable. Never fails.
+func (p *SoftPWM) SetPolarity(inverted bool) error {
+	p.lock.Lock()
+	p.polarity = inverted
+	p.lock.Unlock()
+	p.notify()
+	return nil
+}
+
+// Part of PWMPin: sets period and duty and enables the SoftPWM, like a hardware PWM which always runs.
+// Ignored if duty > period, like by the other PWMPins.
+func (p *SoftPWM) SetPWM(period, duty time.Duration) {
+	if duty > period || period <= 0 {
+		return
+	}
+	p.lock.Lock()
+	p.period, p.duty = period, duty
+	p.lock.Unlock()
+	p.notify()
+	p.Enable()
+}
+
+func (p *SoftPWM) GetPWM() (period, duty time.Duration) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.period, p.duty
+}
+
+// Starts toggling, a period begins right away. Does nothing if already enabled.
+// Never fails, errors of the GPIO stop the SoftPWM later on, see Err.
+func (p *SoftPWM) Enable() error {
+	p.running.Lock()
+	defer p.running.Unlock()
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.stop != nil {
+		select {
+		case <-p.done: // stopped by an error, see Err
+		default:
+			return nil
+		}
+	}
+	p.err = nil
+	p.stop, p.done = make(chan struct{}), make(chan struct{})
+	go p.run(p.stop, p.done)
+	return nil
+}
+
+// Stops toggling and leaves the output inactive (low, unless SetPolarity(true)). Returns once the goroutine ended,
+// with the error of setting the inactive level.
+func (p *SoftPWM) Disable() error {
+	p.running.Lock()
+	defer p.running.Unlock()
+	p.lock.Lock()
+	stop, done, inverted := p.stop, p.done, p.polarity
+	p.stop = nil
+	p.lock.Unlock()
+	if stop == nil {
+		return nil
+	}
+	close(stop)
+	<-done
+	return p.gpio.SetState(inverted)
+}
+
+// Part of PWMPin, same as Disable
+func (p *SoftPWM) DisablePWM() {
+	p.Disable()
+}
+
+// Disables the SoftPWM. The GPIO stays open, it belongs to the caller.
+func (p *SoftPWM) Close() {
+	p.Disable()
+}
+
+// The error of SetState which stopped the SoftPWM, nil while it is running fine
+func (p *SoftPWM) Err() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.err
+}
+
+func (p *SoftPWM) notify() {
+	select {
+	case p.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (p *SoftPWM) run(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	start := p.clock.Now()
+	for {
+		p.lock.Lock()
+		period, duty, inverted := p.period, p.duty, p.polarity
+		p.lock.Unlock()
+		if duty <= 0 || duty >= period {
+			if !p.set(duty > 0 != inverted) {
+				return
+			}
+			select {
+			case <-stop:
+				return
+			case <-p.changed:
+			}
+			start = p.clock.Now()
+			continue
+		}
+		if !p.set(!inverted) || !p.waitUntil(start.Add(duty), stop) || !p.set(inverted) {
+			return
+		}
+		start = start.Add(period)
+		// after missing a whole period start over instead of catching up with a burst of pulses
+		if now := p.clock.Now(); now.Sub(start) > period {
+			start = now
+		}
+		if !p.waitUntil(start, stop) {
+			return
+		}
+	}
+}
+
+func (p *SoftPWM) set(level bool) bool {
+	if err := p.gpio.SetState(level); err != nil {
+		p.lock.Lock()
+		p.err = err
+		p.lock.Unlock()
+		return false
+	}
+	return true
+}
+
+func (p *SoftPWM) waitUntil(t time.Time, stop <-chan struct{}) bool {
+	select {
+	case <-p.clock.After(t.Sub(p.clock.Now())):
+		return true
+	case <-stop:
+		return false
+	}
+}
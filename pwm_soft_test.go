@@ -0,0 +1,207 @@
+package bbhw
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fraction of the time high between the first and the last rising edge of history, and the number of periods
+func measureDuty(history []Transition) (duty float64, periods int) {
+	var first, last, rose time.Time
+	var high time.Duration
+	for _, tr := range history {
+		switch {
+		case tr.State && first.IsZero():
+			first, last, rose = tr.Time, tr.Time, tr.Time
+		case tr.State:
+			last, rose = tr.Time, tr.Time
+			periods++
+		case !first.IsZero():
+			high += tr.Time.Sub(rose)
+		}
+	}
+	if periods == 0 {
+		return 0, 0
+	}
+	return float64(high) / float64(last.Sub(first)), periods
+}
+
+func Test_SoftPWMDuty(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	gpio := NewFakeGPIO(1, OUT)
+	gpio.SetClock(clock)
+	gpio.EnableHistory(1000)
+	defer gpio.Close()
+	p, err := NewSoftPWM(gpio, SoftPWMWithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if err := p.SetFrequency(100); err != nil {
+		t.Fatal(err)
+	}
+	p.SetDuty(0.25)
+	afterTimer(t, clock, func() { p.Enable() })
+	advanceTimerByTimer(t, clock, time.Second)
+	if duty, periods := measureDuty(gpio.History()); duty < 0.24 || duty > 0.26 || periods != 100 {
+		t.Errorf("duty %v over %d periods, expected 0.25 over 100", duty, periods)
+	}
+	// the frequency keeps the duty fraction
+	if err := p.SetFrequency(50); err != nil {
+		t.Fatal(err)
+	}
+	gpio.EnableHistory(1000)
+	advanceTimerByTimer(t, clock, time.Second)
+	if duty, periods := measureDuty(gpio.History()); duty < 0.24 || duty > 0.26 || periods < 49 || periods > 50 {
+		t.Errorf("duty %v over %d periods at 50Hz", duty, periods)
+	}
+	if period, duty := p.GetPWM(); period != 20*time.Millisecond || duty != 5*time.Millisecond {
+		t.Errorf("GetPWM() = %v, %v", period, duty)
+	}
+	if err := p.SetFrequency(0); err == nil {
+		t.Error("0Hz accepted")
+	}
+}
+
+func expectHeld(t *testing.T, gpio *FakeGPIO, clock *ManualClock, level bool) {
+	t.Helper()
+	gpio.EnableHistory(1000)
+	clock.Advance(100 * time.Millisecond)
+	if h := gpio.History(); len(h) != 0 {
+		t.Errorf("toggled while holding %v: %v", level, h)
+	}
+	if GetStateOrPanic(gpio) != level {
+		t.Errorf("holds %v instead of %v", !level, level)
+	}
+}
+
+// waits for the SoftPWM goroutine to switch gpio to the level it holds
+func waitForHeld(t *testing.T, gpio *FakeGPIO, level bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); GetStateOrPanic(gpio) != level; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("not switched to %v", level)
+		}
+	}
+}
+
+func Test_SoftPWMHoldsLevel(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	gpio := NewFakeGPIO(1, OUT)
+	gpio.SetClock(clock)
+	gpio.EnableHistory(1000)
+	defer gpio.Close()
+	p, err := NewSoftPWM(gpio, SoftPWMWithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.SetDuty(0.5)
+	afterTimer(t, clock, func() { p.Enable() })
+	// takes effect with the next period while toggling
+	p.SetDuty(1)
+	advanceSteps(t, clock, 5*time.Millisecond, 5*time.Millisecond)
+	waitForHeld(t, gpio, true)
+	expectHeld(t, gpio, clock, true)
+	// right away while holding a level
+	p.SetDuty(0)
+	waitForHeld(t, gpio, false)
+	expectHeld(t, gpio, clock, false)
+	// toggling again once the duty is in between
+	afterTimer(t, clock, func() { p.SetDuty(0.5) })
+	advanceTimerByTimer(t, clock, 100*time.Millisecond)
+	if _, periods := measureDuty(gpio.History()); periods != 10 {
+		t.Errorf("%d periods after duty 0.5 again", periods)
+	}
+	p.Disable()
+	expectHeld(t, gpio, clock, false)
+}
+
+// counts the SetStates running at the same time, which wait for gate while it is not nil
+type overlapCountingPin struct {
+	GPIOControllablePin
+	gate        chan struct{}
+	active, max int32
+}
+
+func (p *overlapCountingPin) SetState(state bool) error {
+	n := atomic.AddInt32(&p.active, 1)
+	defer atomic.AddInt32(&p.active, -1)
+	for m := atomic.LoadInt32(&p.max); n > m && !atomic.CompareAndSwapInt32(&p.max, m, n); m = atomic.LoadInt32(&p.max) {
+	}
+	if p.gate != nil {
+		<-p.gate
+	}
+	return p.GPIOControllablePin.SetState(state)
+}
+
+func Test_SoftPWMEnableDuringDisable(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	gpio := NewFakeGPIO(1, OUT)
+	gpio.SetClock(clock)
+	defer gpio.Close()
+	pin := &overlapCountingPin{GPIOControllablePin: gpio, gate: make(chan struct{})}
+	p, err := NewSoftPWM(pin, SoftPWMWithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.SetDuty(0.5)
+	// the goroutine hangs in its first SetState while Disable waits for it
+	p.Enable()
+	disabled := make(chan error, 1)
+	go func() { disabled <- p.Disable() }()
+	for stopping := false; !stopping; time.Sleep(time.Millisecond) {
+		p.lock.Lock()
+		stopping = p.stop == nil
+		p.lock.Unlock()
+	}
+	enabled := make(chan struct{})
+	go func() {
+		p.Enable()
+		close(enabled)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(pin.gate)
+	if err := <-disabled; err != nil {
+		t.Fatal(err)
+	}
+	<-enabled
+	// the new goroutine only started once the old one ended and the inactive level was set
+	if max := atomic.LoadInt32(&pin.max); max != 1 {
+		t.Errorf("%d SetStates at once", max)
+	}
+}
+
+func Test_SoftPWMErrors(t *testing.T) {
+	in := NewFakeGPIO(2, IN)
+	defer in.Close()
+	if _, err := NewSoftPWM(in); !errors.Is(err, ErrInvalidDirection) {
+		t.Errorf("SoftPWM on an input: %v", err)
+	}
+	clock := NewManualClock(time.Unix(1000, 0))
+	gpio := NewFakeGPIO(1, OUT)
+	gpio.SetClock(clock)
+	gpio.EnableHistory(1000)
+	defer gpio.Close()
+	p, err := NewSoftPWM(gpio, SoftPWMWithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	gpio.FailNext("SetState", errors.New("gone"))
+	p.SetDuty(0.5)
+	p.Enable()
+	for deadline := time.Now().Add(time.Second); p.Err() == nil; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("SetState error not reported")
+		}
+	}
+	// enabling again restarts it
+	afterTimer(t, clock, func() { p.Enable() })
+	if p.Err() != nil {
+		t.Errorf("Err() = %v after Enable", p.Err())
+	}
+}
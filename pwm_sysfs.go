@@ -9,8 +9,11 @@ import (
 	"time"
 )
 
-//PWM lines
+//PWM lines of the pwm_test driver of 3.8 kernels
 
+// PWM line of the pwm_test driver of 3.8 kernels, returned by NewBBBPWM before it moved to the PWM class.
+//
+// Deprecated: use SysfsPWM, the pwm_test driver only exists in 3.8 kernels.
 type BBPWMPin struct {
 	fd_period   *os.File
 	fd_duty     *os.File
@@ -35,8 +38,11 @@ func findPWMDir(bbb_pin string) (tdir string, err error) {
 	return
 }
 
-// Example: StepperPWM, err = NewBBBPWM("P9_16")
-func NewBBBPWM(bbb_pin string) (pwm *BBPWMPin, err error) {
+// For the pwm_test driver of 3.8 kernels, current kernels need NewBBBPWM.
+// Example: StepperPWM, err = NewBBBLegacyPWM("P9_16")
+//
+// Deprecated: use NewBBBPWM and ToLegacyPWM for code taking a PWMPin, see BBPWMPin.
+func NewBBBLegacyPWM(bbb_pin string) (pwm *BBPWMPin, err error) {
 	var pwm_path string
 	pwm_path, err = findPWMDir(bbb_pin)
 	if err != nil {
@@ -62,10 +68,12 @@ func NewBBBPWM(bbb_pin string) (pwm *BBPWMPin, err error) {
 	return
 }
 
-// Wrapper around NewBBBPWM. Does not return an error but panics instead. Useful to avoid multiple return values.
-func NewBBBPWMOrPanic(bbb_pin string) *BBPWMPin {
+// Wrapper around NewBBBLegacyPWM. Does not return an error but panics instead. Useful to avoid multiple return values.
+//
+// Deprecated: use NewBBBPWMOrPanic, see NewBBBLegacyPWM.
+func NewBBBLegacyPWMOrPanic(bbb_pin string) *BBPWMPin {
 
-	pwm, err := NewBBBPWM(bbb_pin)
+	pwm, err := NewBBBLegacyPWM(bbb_pin)
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,709 @@
+package bbhw
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Uses the /sys/class/pwm/pwmchipN/pwmM/* file-interface of current kernels, the same way SysfsGPIO uses /sys/class/gpio.
+// On the BeagleBone every eHRPWM module is a pwmchip with the two channels A (0) and B (1), eCAPs have one channel.
+// BBPWMPin is the predecessor for the pwm_test driver of 3.8 kernels.
+type SysfsPWM struct {
+	Chip    uint
+	Channel uint
+	logger  Logger
+	// directory of the channel in the pwmchip, see channelName
+	channel_name string
+	// releases the claim of the channel
+	unclaim func()
+	// kept open, period and duty change at a high rate e.g. while ramping. Guarded by lock
+	period_fd *os.File
+	duty_fd   *os.File
+	// duty fraction of SetDutyFraction, kept across SetFrequency. Guarded by lock
+	fraction     float64
+	fraction_set bool
+	ramp         pwmRamp
+	// serializes the ordered writes of period and duty_cycle
+	lock sync.Mutex
+	buf  [24]byte
+}
+
+// base directory of the sysfs pwm interface, changed by tests to point to a fake tree
+var sysfs_pwm_base_ = "/sys/class/pwm"
+
+// Options for NewSysfsPWM
+type PWMOption func(*sysfsPWMOptions) error
+
+type sysfsPWMOptions struct {
+	export_wait time.Duration
+	logger      Logger
+	shared      bool
+	claim_label string
+	attach      bool
+	reset       bool
+	settings    bool
+	period      uint64
+	fraction    float64
+}
+
+// how long NewSysfsPWM waits for udev to make the attribute files of a freshly exported channel writable
+const pwm_export_wait_default_ = time.Second
+
+// After exporting, wait up to timeout (default 1s) for the attribute files to become writable, see WithExportWaitTimeout.
+// 0 does not wait at all.
+func PWMWithExportWaitTimeout(timeout time.Duration) PWMOption {
+	return func(o *sysfsPWMOptions) error {
+		o.export_wait = timeout
+		return nil
+	}
+}
+
+// Log to l instead of the package Logger, including the export
+func PWMWithLogger(l Logger) PWMOption {
+	return func(o *sysfsPWMOptions) error {
+		o.logger = l
+		return nil
+	}
+}
+
+// Allow this channel to be used by several SysfsPWMs of this process, see SetClaimRegistry
+func PWMWithSharedOK() PWMOption {
+	return func(o *sysfsPWMOptions) error {
+		o.shared = true
+		return nil
+	}
+}
+
+// Label reported by ErrAlreadyClaimed if somebody else tries to use the channel.
+// Defaults to file:line of the constructor call.
+func PWMWithClaimLabel(label string) PWMOption {
+	return func(o *sysfsPWMOptions) error {
+		o.claim_label = label
+		return nil
+	}
+}
+
+// Attach to an already exported channel instead of exporting it, fails if the channel is not exported.
+// Nothing is written until the first Set, Enable or Disable, so a channel configured by somebody else keeps running
+// undisturbed, see GetPeriod and friends. Can not be combined with PWMWithResetState or PWMWithSettings.
+func PWMWithAttach() PWMOption {
+	return func(o *sysfsPWMOptions) error {
+		o.attach = true
+		return nil
+	}
+}
+
+// Disable the output and set duty_cycle 0 and normal polarity, whatever a previous user of the channel
+// (e.g. a crashed process) left behind. By default period, duty cycle, polarity and enable are adopted as they are.
+func PWMWithResetState() PWMOption {
+	return func(o *sysfsPWMOptions) error {
+		o.reset = true
+		return nil
+	}
+}
+
+// Set frequency and duty fraction after export (and PWMWithResetState), writing period and duty cycle in
+// an order valid for whatever was set before. An enabled output stays enabled, Enable starts a disabled one.
+func PWMWithSettings(hz, fraction float64) PWMOption {
+	return func(o *sysfsPWMOptions) (err error) {
+		if o.period, err = periodOfFrequency(hz); err != nil {
+			return err
+		}
+		if err = checkDutyFraction(fraction); err != nil {
+			return err
+		}
+		o.settings, o.fraction = true, fraction
+		return nil
+	}
+}
+
+// name of a PWM channel in the claim registry
+func pwmClaimName(chip, channel uint) string {
+	return fmt.Sprintf("pwmchip%d/pwm%d", chip, channel)
+}
+
+// Instantinate a new PWM channel to control through sysfs. Takes the numbers of pwmchipN and its channel pwmM.
+// Exports the channel unless already exported and waits for udev to set the permissions (see PWMWithExportWaitTimeout).
+// Period, duty cycle and enable are left as they are, unless PWMWithResetState or PWMWithSettings is given.
+func NewSysfsPWM(chip, channel uint, opts ...PWMOption) (pwm *SysfsPWM, err error) {
+	o := sysfsPWMOptions{export_wait: pwm_export_wait_default_}
+	for _, opt := range opts {
+		if err = opt(&o); err != nil {
+			return nil, err
+		}
+	}
+	if o.attach && (o.reset || o.settings) {
+		return nil, errors.New("PWMWithAttach does not write, PWMWithResetState and PWMWithSettings do")
+	}
+	unclaim, err := claimPin(pwmClaimName(chip, channel), o.claim_label, o.shared)
+	if err != nil {
+		return nil, err
+	}
+	pwm = &SysfsPWM{Chip: chip, Channel: channel, logger: o.logger, unclaim: unclaim}
+	if err = pwm.setup(&o); err != nil {
+		unclaim()
+		return nil, err
+	}
+	return pwm, nil
+}
+
+// Wrapper around NewSysfsPWM. Does not return an error but panics instead. Useful to avoid multiple return values.
+func NewSysfsPWMOrPanic(chip, channel uint, opts ...PWMOption) *SysfsPWM {
+	pwm, err := NewSysfsPWM(chip, channel, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return pwm
+}
+
+func (pwm *SysfsPWM) setup(o *sysfsPWMOptions) (err error) {
+	if o.attach {
+		if _, err = os.Stat(pwm.sysfsPath("")); err != nil {
+			return pwm.wrapErr("attach", err)
+		}
+	} else if err = pwm.enableExport(); err != nil {
+		return err
+	}
+	if err = pwm.waitForAttributes(o.export_wait); err != nil {
+		return err
+	}
+	if pwm.period_fd, err = os.OpenFile(pwm.sysfsPath("period"), os.O_RDWR|os.O_SYNC, 0666); err != nil {
+		return pwm.wrapErr("open period", err)
+	}
+	if pwm.duty_fd, err = os.OpenFile(pwm.sysfsPath("duty_cycle"), os.O_RDWR|os.O_SYNC, 0666); err != nil {
+		pwm.period_fd.Close()
+		return pwm.wrapErr("open duty_cycle", err)
+	}
+	if err = pwm.normalize(o); err != nil {
+		pwm.period_fd.Close()
+		pwm.duty_fd.Close()
+	}
+	return err
+}
+
+// Applies PWMWithResetState and PWMWithSettings to what the channel was left with
+func (pwm *SysfsPWM) normalize(o *sysfsPWMOptions) error {
+	pwm.lock.Lock()
+	defer pwm.lock.Unlock()
+	period, err := pwm.readNumber(pwm.period_fd, "read period")
+	if err != nil {
+		return err
+	}
+	duty, err := pwm.readNumber(pwm.duty_fd, "read duty_cycle")
+	if err != nil {
+		return err
+	}
+	pwm.log(LOG_DEBUG, "found", "period", period, "duty", duty, "reset", o.reset)
+	if o.reset {
+		enabled, err := pwm.readEnabled()
+		if err != nil {
+			return err
+		}
+		if enabled {
+			if err = pwm.writeEnable(false); err != nil {
+				return err
+			}
+		}
+		if duty != 0 {
+			if err = pwm.writeNumber(pwm.duty_fd, 0, "reset duty_cycle"); err != nil {
+				return err
+			}
+			duty = 0
+		}
+		if err = pwm.setPolarity(false); err != nil && !errors.Is(err, ErrNotSupported) {
+			return err
+		}
+	}
+	if !o.settings {
+		return nil
+	}
+	pwm.fraction, pwm.fraction_set = o.fraction, true
+	return pwm.setPeriodDuty(o.period, fractionOf(o.period, o.fraction), duty)
+}
+
+func (pwm *SysfsPWM) log(level int, msg string, kv ...interface{}) {
+	loggerOr(pwm.logger).Log(level, msg, append([]interface{}{"pwm", pwmClaimName(pwm.Chip, pwm.Channel)}, kv...)...)
+}
+
+// nil if err is nil, otherwise err wrapped in a *PWMError
+func (pwm *SysfsPWM) wrapErr(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PWMError{Chip: pwm.Chip, Channel: pwm.Channel, Op: op, Err: err}
+}
+
+func (pwm *SysfsPWM) chipPath(name string) string {
+	return fmt.Sprintf("%s/pwmchip%d/%s", sysfs_pwm_base_, pwm.Chip, name)
+}
+
+// Name of the directory of the channel: pwmM, or pwm-N:M with the BeagleBoard.org 4.14 and 4.19 kernels.
+// Remembered once the channel is exported, the constructor is done with it before anybody else calls it.
+func (pwm *SysfsPWM) channelName() string {
+	if pwm.channel_name != "" {
+		return pwm.channel_name
+	}
+	for _, name := range []string{fmt.Sprintf("pwm%d", pwm.Channel), fmt.Sprintf("pwm-%d:%d", pwm.Chip, pwm.Channel)} {
+		if _, err := os.Stat(pwm.chipPath(name)); err == nil {
+			pwm.channel_name = name
+			return name
+		}
+	}
+	return fmt.Sprintf("pwm%d", pwm.Channel)
+}
+
+// path of attribute file of this channel, or of the channel directory itself if attr is empty
+func (pwm *SysfsPWM) sysfsPath(attr string) string {
+	if attr == "" {
+		return pwm.chipPath(pwm.channelName())
+	}
+	return pwm.chipPath(pwm.channelName() + "/" + attr)
+}
+
+func (pwm *SysfsPWM) enableExport() error {
+	_, err := os.Stat(pwm.sysfsPath(""))
+	if err == nil {
+		// already exported
+		return nil
+	} else if !os.IsNotExist(err) {
+		return pwm.wrapErr("export", err)
+	}
+	pwm.log(LOG_DEBUG, "exporting")
+	fd, err := os.OpenFile(pwm.chipPath("export"), os.O_WRONLY|os.O_SYNC, 0666)
+	if err != nil {
+		return pwm.wrapErr("export", err)
+	}
+	defer fd.Close()
+	_, err = fmt.Fprintf(fd, "%d\n", pwm.Channel)
+	err = sysfsWritten(fd, err)
+	if errors.Is(err, unix.EBUSY) {
+		// exported by somebody else in the meantime, or under an unexpected name. Waiting for the attributes tells.
+		pwm.log(LOG_DEBUG, "already exported")
+		return nil
+	}
+	return pwm.wrapErr("export", err)
+}
+
+// retries until period and duty_cycle can be opened for writing, or timeout passed
+func (pwm *SysfsPWM) waitForAttributes(timeout time.Duration) error {
+	start := time.Now()
+	retries, err := waitWritable(timeout, pwm.sysfsPath("period"), pwm.sysfsPath("duty_cycle"))
+	if err == nil {
+		if retries > 0 {
+			pwm.log(LOG_DEBUG, "attributes accessible", "retries", retries, "waited", time.Since(start))
+		}
+		return nil
+	}
+	if timeout == 0 {
+		return nil // not waiting, opening them reports the error
+	}
+	return pwm.wrapErr(fmt.Sprintf("wait %v for attributes", timeout), err)
+}
+
+// retries every 10ms until all paths can be opened for writing (see checkWritable), or timeout passed.
+// Attribute files appear and become writable some time after an export or a trigger change, once udev is done.
+func waitWritable(timeout time.Duration, paths ...string) (retries int, err error) {
+	deadline := time.Now().Add(timeout)
+	for ; ; retries++ {
+		err = checkWritable(paths...)
+		if err == nil || !time.Now().Before(deadline) {
+			return retries, err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func checkWritable(paths ...string) error {
+	for _, path := range paths {
+		f, err := os.OpenFile(path, os.O_WRONLY, 0666)
+		if err != nil {
+			return err
+		}
+		f.Close()
+	}
+	return nil
+}
+
+// reads the number in f, the caller holds lock
+func (pwm *SysfsPWM) readNumber(f *os.File, op string) (uint64, error) {
+	n, err := f.ReadAt(pwm.buf[:], 0)
+	if n == 0 && err != nil {
+		return 0, pwm.wrapErr(op, err)
+	}
+	line := pwm.firstLine(n)
+	v, err := strconv.ParseUint(line, 10, 64)
+	if err != nil {
+		return 0, pwm.wrapErr(op, fmt.Errorf("%q: %w", line, ErrInvalidAttribute))
+	}
+	return v, nil
+}
+
+// first line of the n bytes read into buf, without surrounding white space
+func (pwm *SysfsPWM) firstLine(n int) string {
+	line := pwm.buf[:n]
+	for i, c := range line {
+		if c == '\n' {
+			line = line[:i]
+			break
+		}
+	}
+	return strings.TrimSpace(string(line))
+}
+
+// writes v to f, the caller holds lock
+func (pwm *SysfsPWM) writeNumber(f *os.File, v uint64, op string) error {
+	b := append(strconv.AppendUint(pwm.buf[:0], v, 10), '\n')
+	_, err := f.WriteAt(b, 0)
+	return pwm.wrapErr(op, sysfsWritten(f, err))
+}
+
+// The kernel rejects any duty_cycle longer than the period, even for a moment.
+// Writes period first if it does not get shorter than the duty_cycle currently set, otherwise duty first.
+// duty <= period, the caller holds lock.
+func (pwm *SysfsPWM) setPeriodDuty(period, duty, current_duty uint64) error {
+	if period >= current_duty {
+		if err := pwm.writeNumber(pwm.period_fd, period, "set period"); err != nil {
+			return err
+		}
+		if duty == current_duty {
+			return nil
+		}
+		return pwm.writeNumber(pwm.duty_fd, duty, "set duty_cycle")
+	}
+	if err := pwm.writeNumber(pwm.duty_fd, duty, "set duty_cycle"); err != nil {
+		return err
+	}
+	return pwm.writeNumber(pwm.period_fd, period, "set period")
+}
+
+// Keeps the duty cycle in nanoseconds, shortened to period if longer
+func (pwm *SysfsPWM) SetPeriod(period time.Duration) error {
+	if period <= 0 {
+		return pwm.wrapErr("set period", fmt.Errorf("%v: %w", period, ErrOutOfRange))
+	}
+	pwm.lock.Lock()
+	defer pwm.lock.Unlock()
+	duty, err := pwm.readNumber(pwm.duty_fd, "read duty_cycle")
+	if err != nil {
+		return err
+	}
+	p := uint64(period.Nanoseconds())
+	pwm.fraction_set = false
+	if duty > p {
+		return pwm.setPeriodDuty(p, p, duty)
+	}
+	return pwm.setPeriodDuty(p, duty, duty)
+}
+
+// Active time of each period in nanoseconds. Longer than the period fails with ErrOutOfRange, set the period first.
+func (pwm *SysfsPWM) SetDutyNanoseconds(duty uint64) error {
+	pwm.lock.Lock()
+	defer pwm.lock.Unlock()
+	period, err := pwm.readNumber(pwm.period_fd, "read period")
+	if err != nil {
+		return err
+	}
+	if duty > period {
+		return pwm.wrapErr("set duty_cycle", fmt.Errorf("%dns longer than period %dns: %w", duty, period, ErrOutOfRange))
+	}
+	pwm.fraction_set = false
+	return pwm.writeNumber(pwm.duty_fd, duty, "set duty_cycle")
+}
+
+// Period range of the sysfs interface: whole nanoseconds, and 4.x kernels keep the period in an unsigned int
+const (
+	sysfs_pwm_min_period_ = 1
+	sysfs_pwm_max_period_ = math.MaxUint32
+)
+
+// Sets the period to 1/hz, rounded to whole nanoseconds, keeping the duty fraction: the one of SetDutyFraction,
+// or the current one if the duty was last set in nanoseconds. Frequencies without a period between 1ns and 2^32-1ns
+// fail with a *PWMRangeError naming the nearest possible one.
+func (pwm *SysfsPWM) SetFrequency(hz float64) error {
+	period, err := periodOfFrequency(hz)
+	if err != nil {
+		return pwm.wrapErr("set frequency", err)
+	}
+	pwm.lock.Lock()
+	defer pwm.lock.Unlock()
+	current_duty, err := pwm.readNumber(pwm.duty_fd, "read duty_cycle")
+	if err != nil {
+		return err
+	}
+	if !pwm.fraction_set {
+		current_period, err := pwm.readNumber(pwm.period_fd, "read period")
+		if err != nil {
+			return err
+		}
+		pwm.fraction = 0
+		if current_period > 0 {
+			pwm.fraction = float64(current_duty) / float64(current_period)
+		}
+		pwm.fraction_set = true
+	}
+	return pwm.setPeriodDuty(period, fractionOf(period, pwm.fraction), current_duty)
+}
+
+// Fraction between 0.0 and 1.0 of the period the output is active, kept by SetFrequency.
+// Without a period yet it is only remembered and applied by SetFrequency.
+// Fractions outside fail with a *PWMRangeError naming 0 or 1.
+func (pwm *SysfsPWM) SetDutyFraction(fraction float64) error {
+	if err := checkDutyFraction(fraction); err != nil {
+		return pwm.wrapErr("set duty fraction", err)
+	}
+	pwm.lock.Lock()
+	defer pwm.lock.Unlock()
+	period, err := pwm.readNumber(pwm.period_fd, "read period")
+	if err != nil {
+		return err
+	}
+	pwm.fraction, pwm.fraction_set = fraction, true
+	if period == 0 {
+		return nil
+	}
+	return pwm.writeNumber(pwm.duty_fd, fractionOf(period, fraction), "set duty_cycle")
+}
+
+// period in nanoseconds of hz, a *PWMRangeError if not between sysfs_pwm_min_period_ and sysfs_pwm_max_period_
+func periodOfFrequency(hz float64) (uint64, error) {
+	p := math.Round(1e9 / hz)
+	if !(hz > 0) || p < sysfs_pwm_min_period_ || p > sysfs_pwm_max_period_ {
+		nearest := 1e9 / sysfs_pwm_max_period_
+		if hz > 0 && p < sysfs_pwm_min_period_ {
+			nearest = 1e9 / sysfs_pwm_min_period_
+		}
+		return 0, &PWMRangeError{Quantity: "frequency", Requested: hz, Nearest: nearest}
+	}
+	return uint64(p), nil
+}
+
+func checkDutyFraction(fraction float64) error {
+	if fraction >= 0 && fraction <= 1 {
+		return nil
+	}
+	nearest := 0.0
+	if fraction > 1 {
+		nearest = 1
+	}
+	return &PWMRangeError{Quantity: "duty fraction", Requested: fraction, Nearest: nearest}
+}
+
+// duty of fraction of period, rounded to whole nanoseconds
+func fractionOf(period uint64, fraction float64) uint64 {
+	duty := uint64(math.Round(float64(period) * fraction))
+	if duty > period {
+		return period
+	}
+	return duty
+}
+
+// 1/period as read from sysfs, 0 if no period is set
+func (pwm *SysfsPWM) GetFrequency() (float64, error) {
+	pwm.lock.Lock()
+	defer pwm.lock.Unlock()
+	period, err := pwm.readNumber(pwm.period_fd, "read period")
+	if err != nil || period == 0 {
+		return 0, err
+	}
+	return 1e9 / float64(period), nil
+}
+
+// duty_cycle / period as read from sysfs, so it reflects the rounding to nanoseconds. 0 if no period is set
+func (pwm *SysfsPWM) GetDutyFraction() (float64, error) {
+	pwm.lock.Lock()
+	defer pwm.lock.Unlock()
+	period, err := pwm.readNumber(pwm.period_fd, "read period")
+	if err != nil || period == 0 {
+		return 0, err
+	}
+	duty, err := pwm.readNumber(pwm.duty_fd, "read duty_cycle")
+	if err != nil {
+		return 0, err
+	}
+	return float64(duty) / float64(period), nil
+}
+
+// Period as read from sysfs, 0 if none is set yet
+func (pwm *SysfsPWM) GetPeriod() (time.Duration, error) {
+	pwm.lock.Lock()
+	defer pwm.lock.Unlock()
+	period, err := pwm.readNumber(pwm.period_fd, "read period")
+	return time.Duration(period), err
+}
+
+// Active time of each period as read from sysfs
+func (pwm *SysfsPWM) GetDutyNanoseconds() (uint64, error) {
+	pwm.lock.Lock()
+	defer pwm.lock.Unlock()
+	return pwm.readNumber(pwm.duty_fd, "read duty_cycle")
+}
+
+// Whether the output runs, as read from sysfs
+func (pwm *SysfsPWM) GetEnabled() (bool, error) {
+	pwm.lock.Lock()
+	defer pwm.lock.Unlock()
+	return pwm.readEnabled()
+}
+
+// Whether the output is inverted, as read from sysfs. Fails with ErrNotSupported like SetPolarity.
+func (pwm *SysfsPWM) GetPolarity() (inverted bool, err error) {
+	pwm.lock.Lock()
+	defer pwm.lock.Unlock()
+	f, err := pwm.openPolarity(os.O_RDONLY)
+	if err != nil {
+		return false, pwm.wrapErr("read polarity", err)
+	}
+	defer f.Close()
+	return pwm.readPolarity(f)
+}
+
+// Starts the output. The kernel refuses to enable a channel without a period.
+func (pwm *SysfsPWM) Enable() error {
+	return pwm.writeEnable(true)
+}
+
+// Stops the output, which then idles at its inactive level
+func (pwm *SysfsPWM) Disable() error {
+	return pwm.writeEnable(false)
+}
+
+// Inverts the output (active low) or not. Many kernels refuse to change the polarity of an enabled channel,
+// so it is disabled for the change and enabled again afterwards, also if the change failed.
+// Fails with ErrNotSupported if the channel has no polarity attribute.
+func (pwm *SysfsPWM) SetPolarity(inverted bool) error {
+	pwm.lock.Lock()
+	defer pwm.lock.Unlock()
+	return pwm.setPolarity(inverted)
+}
+
+// the caller holds lock
+func (pwm *SysfsPWM) setPolarity(inverted bool) error {
+	polarity := "normal"
+	if inverted {
+		polarity = "inversed"
+	}
+	f, err := pwm.openPolarity(os.O_RDWR | os.O_SYNC)
+	if err != nil {
+		return pwm.wrapErr("set polarity", err)
+	}
+	defer f.Close()
+	current, err := pwm.readPolarity(f)
+	if err != nil {
+		return err
+	}
+	if current == inverted {
+		return nil
+	}
+	enabled, err := pwm.readEnabled()
+	if err != nil {
+		return err
+	}
+	if enabled {
+		if err = pwm.writeEnable(false); err != nil {
+			return err
+		}
+	}
+	pwm.log(LOG_DEBUG, "set polarity", "polarity", polarity, "enabled", enabled)
+	_, err = f.WriteAt([]byte(polarity+"\n"), 0)
+	err = pwm.wrapErr("set polarity", sysfsWritten(f, err))
+	if enabled {
+		if eerr := pwm.writeEnable(true); err == nil {
+			err = eerr
+		}
+	}
+	return err
+}
+
+// ErrNotSupported if the channel exists without a polarity attribute
+func (pwm *SysfsPWM) openPolarity(flag int) (*os.File, error) {
+	f, err := os.OpenFile(pwm.sysfsPath("polarity"), flag, 0666)
+	if os.IsNotExist(err) {
+		if _, serr := os.Stat(pwm.sysfsPath("")); serr == nil {
+			err = ErrNotSupported
+		}
+	}
+	return f, err
+}
+
+// whether f holds "inversed", the caller holds lock
+func (pwm *SysfsPWM) readPolarity(f *os.File) (inverted bool, err error) {
+	n, err := f.ReadAt(pwm.buf[:], 0)
+	if n == 0 && err != nil {
+		return false, pwm.wrapErr("read polarity", err)
+	}
+	switch line := pwm.firstLine(n); line {
+	case "normal":
+		return false, nil
+	case "inversed":
+		return true, nil
+	default:
+		return false, pwm.wrapErr("read polarity", fmt.Errorf("%q: %w", line, ErrInvalidAttribute))
+	}
+}
+
+// the caller holds lock
+func (pwm *SysfsPWM) readEnabled() (bool, error) {
+	f, err := os.Open(pwm.sysfsPath("enable"))
+	if err != nil {
+		return false, pwm.wrapErr("read enable", err)
+	}
+	defer f.Close()
+	v, err := pwm.readNumber(f, "read enable")
+	if err == nil && v > 1 {
+		err = pwm.wrapErr("read enable", fmt.Errorf("%d: %w", v, ErrInvalidAttribute))
+	}
+	return v == 1, err
+}
+
+func (pwm *SysfsPWM) writeEnable(enable bool) error {
+	op := "disable"
+	if enable {
+		op = "enable"
+	}
+	f, err := os.OpenFile(pwm.sysfsPath("enable"), os.O_WRONLY|os.O_SYNC, 0666)
+	if err != nil {
+		return pwm.wrapErr(op, err)
+	}
+	defer f.Close()
+	if enable {
+		_, err = fmt.Fprintln(f, "1")
+	} else {
+		_, err = fmt.Fprintln(f, "0")
+	}
+	return pwm.wrapErr(op, sysfsWritten(f, err))
+}
+
+// Fades the duty fraction from the current one to fraction over the given duration on a goroutine, linearly
+// at 100 updates per second unless changed by RampWithEasing and RampWithUpdateRate. done receives nil once
+// fraction is reached, ErrRampCancelled if another RampTo replaced the ramp (continuing from where this one
+// left off) or CancelRamp stopped it, or the error of a failed update.
+// SetDutyFraction and friends during a ramp are overwritten by its next update.
+func (pwm *SysfsPWM) RampTo(fraction float64, over time.Duration, opts ...RampOption) (done <-chan error) {
+	return pwm.ramp.rampTo(pwm, nil, fraction, over, opts)
+}
+
+// Stops a ramp of RampTo, the duty fraction stays where the ramp left it
+func (pwm *SysfsPWM) CancelRamp() {
+	pwm.ramp.cancel()
+}
+
+// closes the attribute files and releases the claim of the channel (see SetClaimRegistry).
+// does NOT disable or unexport the channel, the output keeps running as last set. A ramp is cancelled.
+func (pwm *SysfsPWM) Close() {
+	pwm.ramp.cancel()
+	if pwm.unclaim != nil {
+		pwm.unclaim()
+	}
+	pwm.lock.Lock()
+	pwm.period_fd.Close()
+	pwm.duty_fd.Close()
+	pwm.lock.Unlock()
+}
@@ -0,0 +1,89 @@
+package bbhw
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Serializable configuration of a SysfsPWM channel, see SysfsPWM.Snapshot and ApplyConfig
+type PWMConfig struct {
+	Chip     uint          `json:"chip"`
+	Channel  uint          `json:"channel"`
+	Period   time.Duration `json:"period_ns"` // 0 if none was set yet
+	Duty     time.Duration `json:"duty_ns"`
+	Enabled  bool          `json:"enabled"`
+	Inverted bool          `json:"inverted,omitempty"` // false as well without polarity support
+}
+
+// Current configuration, read from the attribute files without writing anything, e.g. after PWMWithAttach
+func (pwm *SysfsPWM) Snapshot() (cfg PWMConfig, err error) {
+	pwm.lock.Lock()
+	defer pwm.lock.Unlock()
+	cfg = PWMConfig{Chip: pwm.Chip, Channel: pwm.Channel}
+	period, err := pwm.readNumber(pwm.period_fd, "read period")
+	if err != nil {
+		return cfg, err
+	}
+	duty, err := pwm.readNumber(pwm.duty_fd, "read duty_cycle")
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Period, cfg.Duty = time.Duration(period), time.Duration(duty)
+	if cfg.Enabled, err = pwm.readEnabled(); err != nil {
+		return cfg, err
+	}
+	f, err := pwm.openPolarity(0)
+	if errors.Is(err, ErrNotSupported) {
+		return cfg, nil
+	} else if err != nil {
+		return cfg, pwm.wrapErr("read polarity", err)
+	}
+	defer f.Close()
+	cfg.Inverted, err = pwm.readPolarity(f)
+	return cfg, err
+}
+
+// Re-applies a configuration returned by Snapshot, e.g. after a reboot. Writes only what differs, in an order
+// the kernel accepts: a channel to be disabled is disabled first, one to be enabled only at the end.
+// Applying the same configuration again writes nothing.
+func (pwm *SysfsPWM) ApplyConfig(cfg PWMConfig) error {
+	if cfg.Chip != pwm.Chip || cfg.Channel != pwm.Channel {
+		return fmt.Errorf("config of %s applied to %s", pwmClaimName(cfg.Chip, cfg.Channel), pwmClaimName(pwm.Chip, pwm.Channel))
+	}
+	if cfg.Period < 0 || cfg.Duty < 0 || cfg.Duty > cfg.Period || cfg.Period > sysfs_pwm_max_period_ {
+		return pwm.wrapErr("apply config", fmt.Errorf("period %v duty %v: %w", cfg.Period, cfg.Duty, ErrOutOfRange))
+	}
+	current, err := pwm.Snapshot()
+	if err != nil {
+		return err
+	}
+	pwm.lock.Lock()
+	defer pwm.lock.Unlock()
+	if current.Enabled && !cfg.Enabled {
+		if err = pwm.writeEnable(false); err != nil {
+			return err
+		}
+	}
+	if current.Inverted != cfg.Inverted {
+		if err = pwm.setPolarity(cfg.Inverted); err != nil {
+			return err
+		}
+	}
+	period, duty, current_duty := uint64(cfg.Period), uint64(cfg.Duty), uint64(current.Duty)
+	if period != 0 && (cfg.Period != current.Period || cfg.Duty != current.Duty) {
+		if cfg.Period != current.Period {
+			err = pwm.setPeriodDuty(period, duty, current_duty)
+		} else {
+			err = pwm.writeNumber(pwm.duty_fd, duty, "set duty_cycle")
+		}
+		if err != nil {
+			return err
+		}
+		pwm.fraction_set = false
+	}
+	if cfg.Enabled && !current.Enabled {
+		return pwm.writeEnable(true)
+	}
+	return nil
+}
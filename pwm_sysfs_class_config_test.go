@@ -0,0 +1,143 @@
+package bbhw
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_SysfsPWMAttach(t *testing.T) {
+	tree, _ := useFakeSysfsPWMTree(t)
+	leaveRunningPWM(t)
+	before := len(tree.Writes(0, 0))
+	pwm, err := NewSysfsPWM(0, 0, PWMWithAttach())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pwm.Close()
+	if period, err := pwm.GetPeriod(); period != time.Millisecond || err != nil {
+		t.Errorf("GetPeriod() = %v, %v", period, err)
+	}
+	if duty, err := pwm.GetDutyNanoseconds(); duty != 900000 || err != nil {
+		t.Errorf("GetDutyNanoseconds() = %v, %v", duty, err)
+	}
+	if enabled, err := pwm.GetEnabled(); !enabled || err != nil {
+		t.Errorf("GetEnabled() = %v, %v", enabled, err)
+	}
+	if inverted, err := pwm.GetPolarity(); !inverted || err != nil {
+		t.Errorf("GetPolarity() = %v, %v", inverted, err)
+	}
+	cfg, err := pwm.Snapshot()
+	if expected := (PWMConfig{Chip: 0, Channel: 0, Period: time.Millisecond, Duty: 900 * time.Microsecond, Enabled: true, Inverted: true}); err != nil || cfg != expected {
+		t.Errorf("Snapshot() = %+v, %v", cfg, err)
+	}
+	if writes := tree.Writes(0, 0)[before:]; len(writes) != 0 {
+		t.Errorf("attaching wrote %q", writes)
+	}
+	if _, err = NewSysfsPWM(0, 1, PWMWithAttach()); !errors.Is(err, os.ErrNotExist) {
+		t.Error("attaching to a channel not exported:", err)
+	}
+	if _, err = NewSysfsPWM(0, 1, PWMWithAttach(), PWMWithResetState()); err == nil {
+		t.Error("PWMWithAttach and PWMWithResetState accepted")
+	}
+	if err = tree.RemovePolarity(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pwm.GetPolarity(); !errors.Is(err, ErrNotSupported) {
+		t.Error("GetPolarity() without polarity attribute:", err)
+	}
+	if cfg, err = pwm.Snapshot(); err != nil || cfg.Inverted {
+		t.Errorf("Snapshot() = %+v, %v without polarity attribute", cfg, err)
+	}
+}
+
+// attribute files written by hand, as odd as a kernel or a careless script might leave them
+func Test_SysfsPWMParsing(t *testing.T) {
+	dir := t.TempDir()
+	cdir := filepath.Join(dir, "pwmchip1", "pwm0")
+	os.MkdirAll(cdir, 0755)
+	prev := sysfs_pwm_base_
+	sysfs_pwm_base_ = dir
+	t.Cleanup(func() { sysfs_pwm_base_ = prev })
+	useFreshClaimRegistry(t)
+	write := func(attr, content string) {
+		if err := ioutil.WriteFile(filepath.Join(cdir, attr), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("period", " 20000 \n")
+	write("duty_cycle", "5000")
+	write("enable", "1\n")
+	write("polarity", "inversed\n")
+	pwm, err := NewSysfsPWM(1, 0, PWMWithAttach())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pwm.Close()
+	cfg, err := pwm.Snapshot()
+	if expected := (PWMConfig{Chip: 1, Period: 20 * time.Microsecond, Duty: 5 * time.Microsecond, Enabled: true, Inverted: true}); err != nil || cfg != expected {
+		t.Errorf("Snapshot() = %+v, %v", cfg, err)
+	}
+	for attr, content := range map[string]string{"period": "20us\n", "duty_cycle": "\n", "enable": "2\n", "polarity": "reversed\n"} {
+		write(attr, content)
+		if _, err := pwm.Snapshot(); !errors.Is(err, ErrInvalidAttribute) {
+			t.Errorf("Snapshot() with %s %q: %v", attr, content, err)
+		}
+	}
+}
+
+func Test_SysfsPWMApplyConfig(t *testing.T) {
+	tree, _ := useFakeSysfsPWMTree(t)
+	leaveRunningPWM(t)
+	pwm, err := NewSysfsPWM(0, 0, PWMWithAttach())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pwm.Close()
+	cfg, err := pwm.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"chip":0,"channel":0,"period_ns":1000000,"duty_ns":900000,"enabled":true,"inverted":true}` {
+		t.Errorf("JSON %s", b)
+	}
+	var saved PWMConfig
+	if err = json.Unmarshal(b, &saved); err != nil || saved != cfg {
+		t.Fatalf("unmarshalled %+v, %v", saved, err)
+	}
+	// somebody messes with it
+	pwm.Disable()
+	pwm.SetPolarity(false)
+	pwm.SetFrequency(100)
+	before := len(tree.Writes(0, 0))
+	if err = pwm.ApplyConfig(saved); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"polarity inversed", "duty_cycle 900000", "period 1000000", "enable 1"}
+	if writes := tree.Writes(0, 0)[before:]; fmt.Sprint(writes) != fmt.Sprint(expected) {
+		t.Errorf("writes %q, expected %q", writes, expected)
+	}
+	before = len(tree.Writes(0, 0))
+	if err = pwm.ApplyConfig(saved); err != nil {
+		t.Fatal(err)
+	}
+	if writes := tree.Writes(0, 0)[before:]; len(writes) != 0 {
+		t.Errorf("applying again wrote %q", writes)
+	}
+	saved.Channel = 1
+	if err = pwm.ApplyConfig(saved); err == nil {
+		t.Error("config of another channel applied")
+	}
+	if err = pwm.ApplyConfig(PWMConfig{Period: time.Millisecond, Duty: 2 * time.Millisecond}); !errors.Is(err, ErrOutOfRange) {
+		t.Error("duty longer than period:", err)
+	}
+}
@@ -0,0 +1,357 @@
+package bbhw
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// Emulates the kernel side of /sys/class/pwm in a directory, to integration test SysfsPWM without hardware.
+// From NewFakeSysfsPWMTree until Close all SysfsPWMs of the process use it, a FakeSysfsGPIOTree keeps working alongside.
+// Like the kernel:
+//   - AddChip (AddChipAt) creates pwmchipN with export, unexport and npwm. Writing a channel to export creates pwmM with
+//     period 0, duty_cycle 0, enable 0 and polarity normal, channels beyond npwm fail with ENODEV, exported ones with EBUSY.
+//   - a duty_cycle longer than the period, period 0 and enabling without a period fail with EINVAL.
+//   - changing the polarity of an enabled channel fails with EBUSY, chips without polarity support (see
+//     RemovePolarity) have no polarity attribute.
+//   - attribute files of an unexported channel are stale, writes fail with ENODEV.
+//
+// Errors are only returned for writes through SysfsPWM, anything else writing the files directly goes unnoticed.
+type FakeSysfsPWMTree struct {
+	dir         string
+	chips       map[uint]*fakeSysfsPWMChip
+	closed      bool
+	prev_base   string
+	prev_kernel sysfsKernelBox
+	lock        sync.Mutex
+}
+
+type fakeSysfsPWMChip struct {
+	channels    []*fakeSysfsPWMChannel
+	no_polarity bool
+}
+
+type fakeSysfsPWMChannel struct {
+	exported bool
+	period   uint64
+	duty     uint64
+	enabled  bool
+	inversed bool
+	writes   []string // "attr value" as written through SysfsPWM, kept across unexport
+}
+
+// Points the sysfs pwm code of this package to dir, which gets pwmchips with AddChip
+func NewFakeSysfsPWMTree(dir string) (*FakeSysfsPWMTree, error) {
+	if fi, err := os.Stat(dir); err != nil {
+		return nil, err
+	} else if !fi.IsDir() {
+		return nil, fmt.Errorf("%s is no directory", dir)
+	}
+	tree := &FakeSysfsPWMTree{dir: dir, chips: make(map[uint]*fakeSysfsPWMChip)}
+	tree.prev_base = sysfs_pwm_base_
+	tree.prev_kernel, _ = sysfs_kernel_.Load().(sysfsKernelBox)
+	sysfs_pwm_base_ = dir
+	sysfs_kernel_.Store(sysfsKernelBox{tree})
+	return tree, nil
+}
+
+// Points the sysfs pwm code back to where it was before. The directory is left as it is.
+func (tree *FakeSysfsPWMTree) Close() {
+	tree.lock.Lock()
+	defer tree.lock.Unlock()
+	if tree.closed {
+		return
+	}
+	tree.closed = true
+	sysfs_pwm_base_ = tree.prev_base
+	sysfs_kernel_.Store(tree.prev_kernel)
+}
+
+// Adds pwmchip<chip> with npwm channels, none of them exported
+func (tree *FakeSysfsPWMTree) AddChip(chip, npwm uint) error {
+	return tree.AddChipAt(chip, npwm, "")
+}
+
+// Like AddChip, but pwmchip<chip> is a symlink to <device>/pwm/pwmchip<chip> as in the kernel, so ListPWMChips
+// reports device as its parent device, e.g. .../48302200.pwm for NewBBBPWM. device is created if missing.
+func (tree *FakeSysfsPWMTree) AddChipAt(chip, npwm uint, device string) error {
+	tree.lock.Lock()
+	defer tree.lock.Unlock()
+	if tree.chips[chip] != nil {
+		return fmt.Errorf("FakeSysfsPWMTree already has pwmchip%d", chip)
+	}
+	cdir := tree.chipDir(chip)
+	if device == "" {
+		if err := os.Mkdir(cdir, 0755); err != nil {
+			return err
+		}
+	} else {
+		target := filepath.Join(device, "pwm", filepath.Base(cdir))
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return err
+		}
+		if err := os.Symlink(target, cdir); err != nil {
+			return err
+		}
+	}
+	for name, content := range map[string]string{"export": "", "unexport": "", "npwm": fmt.Sprintf("%d\n", npwm)} {
+		if err := os.WriteFile(filepath.Join(cdir, name), []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	c := &fakeSysfsPWMChip{channels: make([]*fakeSysfsPWMChannel, npwm)}
+	for i := range c.channels {
+		c.channels[i] = new(fakeSysfsPWMChannel)
+	}
+	tree.chips[chip] = c
+	return nil
+}
+
+// Exports channel, as if another process wrote it to export
+func (tree *FakeSysfsPWMTree) Export(chip, channel uint) error {
+	tree.lock.Lock()
+	defer tree.lock.Unlock()
+	return tree.errno(filepath.Join(tree.chipDir(chip), "export"), tree.export(chip, channel))
+}
+
+// Unexports channel, as if another process did
+func (tree *FakeSysfsPWMTree) Unexport(chip, channel uint) error {
+	tree.lock.Lock()
+	defer tree.lock.Unlock()
+	return tree.errno(filepath.Join(tree.chipDir(chip), "unexport"), tree.unexport(chip, channel))
+}
+
+// Makes pwmchip<chip> a chip without polarity support, whose channels lack the polarity attribute
+func (tree *FakeSysfsPWMTree) RemovePolarity(chip uint) error {
+	tree.lock.Lock()
+	defer tree.lock.Unlock()
+	c := tree.chips[chip]
+	if c == nil {
+		return fmt.Errorf("FakeSysfsPWMTree has no pwmchip%d", chip)
+	}
+	c.no_polarity = true
+	for channel, ch := range c.channels {
+		if ch.exported {
+			os.Remove(filepath.Join(tree.channelDir(chip, uint(channel)), "polarity"))
+		}
+	}
+	return nil
+}
+
+// Writes to the attributes of channel through SysfsPWM, oldest first, like "period 1000000" or "enable 1".
+// Including the failed ones.
+func (tree *FakeSysfsPWMTree) Writes(chip, channel uint) []string {
+	tree.lock.Lock()
+	defer tree.lock.Unlock()
+	if ch := tree.channel(chip, channel); ch != nil {
+		return append([]string(nil), ch.writes...)
+	}
+	return nil
+}
+
+// Current output of channel, as the hardware generates it. Zero for unknown channels
+func (tree *FakeSysfsPWMTree) Output(chip, channel uint) (period, duty uint64, enabled bool) {
+	tree.lock.Lock()
+	defer tree.lock.Unlock()
+	if ch := tree.channel(chip, channel); ch != nil {
+		return ch.period, ch.duty, ch.enabled
+	}
+	return 0, 0, false
+}
+
+func (tree *FakeSysfsPWMTree) chipDir(chip uint) string {
+	return filepath.Join(tree.dir, fmt.Sprintf("pwmchip%d", chip))
+}
+
+func (tree *FakeSysfsPWMTree) channelDir(chip, channel uint) string {
+	return filepath.Join(tree.chipDir(chip), fmt.Sprintf("pwm%d", channel))
+}
+
+// nil if the kernel has no such channel
+func (tree *FakeSysfsPWMTree) channel(chip, channel uint) *fakeSysfsPWMChannel {
+	c := tree.chips[chip]
+	if c == nil || channel >= uint(len(c.channels)) {
+		return nil
+	}
+	return c.channels[channel]
+}
+
+func (tree *FakeSysfsPWMTree) export(chip, channel uint) unix.Errno {
+	ch := tree.channel(chip, channel)
+	if ch == nil {
+		return unix.ENODEV
+	}
+	if ch.exported {
+		return unix.EBUSY
+	}
+	if err := os.Mkdir(tree.channelDir(chip, channel), 0755); err != nil && !os.IsExist(err) {
+		return unix.EIO
+	}
+	ch.exported = true
+	if tree.sync(chip, channel) != nil {
+		return unix.EIO
+	}
+	return 0
+}
+
+func (tree *FakeSysfsPWMTree) unexport(chip, channel uint) unix.Errno {
+	ch := tree.channel(chip, channel)
+	if ch == nil || !ch.exported {
+		return unix.EINVAL
+	}
+	os.RemoveAll(tree.channelDir(chip, channel))
+	*ch = fakeSysfsPWMChannel{writes: ch.writes} // the kernel disables a channel on unexport
+	return 0
+}
+
+// as returned by a write to path
+func (tree *FakeSysfsPWMTree) errno(path string, errno unix.Errno) error {
+	if errno == 0 {
+		return nil
+	}
+	return &os.PathError{Op: "write", Path: path, Err: errno}
+}
+
+// rewrites the attribute files of channel from its state, in place so open files see it
+func (tree *FakeSysfsPWMTree) sync(chip, channel uint) error {
+	ch := tree.channel(chip, channel)
+	polarity := "normal"
+	if ch.inversed {
+		polarity = "inversed"
+	}
+	attrs := map[string]string{
+		"period":     fmt.Sprintf("%d\n", ch.period),
+		"duty_cycle": fmt.Sprintf("%d\n", ch.duty),
+		"enable":     fmt.Sprintf("%d\n", boolToUint32(ch.enabled)),
+		"polarity":   polarity + "\n",
+	}
+	if tree.chips[chip].no_polarity {
+		delete(attrs, "polarity")
+	}
+	for attr, content := range attrs {
+		if err := os.WriteFile(filepath.Join(tree.channelDir(chip, channel), attr), []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chip, channel and attribute of path. ok is false if it is no attribute file in the tree,
+// attr is "export" or "unexport" with channel 0 for those of a chip
+func (tree *FakeSysfsPWMTree) attribute(path string) (chip, channel uint, attr string, ok bool) {
+	rel, err := filepath.Rel(tree.dir, path)
+	if err != nil {
+		return 0, 0, "", false
+	}
+	parts := strings.Split(rel, string(filepath.Separator))
+	if len(parts) < 2 || len(parts) > 3 || !strings.HasPrefix(parts[0], "pwmchip") {
+		return 0, 0, "", false
+	}
+	c, err := strconv.ParseUint(strings.TrimPrefix(parts[0], "pwmchip"), 10, 32)
+	if err != nil {
+		return 0, 0, "", false
+	}
+	if len(parts) == 2 {
+		return uint(c), 0, parts[1], parts[1] == "export" || parts[1] == "unexport"
+	}
+	n, err := strconv.ParseUint(strings.TrimPrefix(parts[1], "pwm"), 10, 32)
+	if err != nil || !strings.HasPrefix(parts[1], "pwm") {
+		return 0, 0, "", false
+	}
+	return uint(c), uint(n), parts[2], true
+}
+
+func (tree *FakeSysfsPWMTree) written(f *os.File) error {
+	tree.lock.Lock()
+	defer tree.lock.Unlock()
+	chip, channel, attr, ok := tree.attribute(f.Name())
+	if tree.closed || !ok {
+		if tree.prev_kernel.sysfsKernel != nil {
+			return tree.prev_kernel.written(f)
+		}
+		return nil
+	}
+	buf, _ := os.ReadFile(f.Name())
+	// files are not truncated by SysfsPWM, what was written is the first line
+	token := strings.TrimSpace(strings.SplitN(string(buf), "\n", 2)[0])
+	if attr == "export" || attr == "unexport" {
+		os.Truncate(f.Name(), 0)
+		n, err := strconv.ParseUint(token, 10, 32)
+		if err != nil {
+			return tree.errno(f.Name(), unix.EINVAL)
+		}
+		if attr == "export" {
+			return tree.errno(f.Name(), tree.export(chip, uint(n)))
+		}
+		return tree.errno(f.Name(), tree.unexport(chip, uint(n)))
+	}
+	ch := tree.channel(chip, channel)
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if current, err := os.Stat(f.Name()); ch == nil || !ch.exported || err != nil || !os.SameFile(fi, current) {
+		return tree.errno(f.Name(), unix.ENODEV)
+	}
+	ch.writes = append(ch.writes, attr+" "+token)
+	errno := ch.write(attr, token)
+	if err := tree.sync(chip, channel); err != nil {
+		return err
+	}
+	return tree.errno(f.Name(), errno)
+}
+
+// applies token written to attr, the way the pwm sysfs code and pwm_apply_state do
+func (ch *fakeSysfsPWMChannel) write(attr, token string) unix.Errno {
+	switch attr {
+	case "period", "duty_cycle":
+		v, err := strconv.ParseUint(token, 10, 64)
+		if err != nil {
+			return unix.EINVAL
+		}
+		period, duty := ch.period, ch.duty
+		if attr == "period" {
+			period = v
+		} else {
+			duty = v
+		}
+		if period == 0 || duty > period {
+			return unix.EINVAL
+		}
+		ch.period, ch.duty = period, duty
+	case "enable":
+		v, err := strconv.Atoi(token)
+		if err != nil || v < 0 || v > 1 {
+			return unix.EINVAL
+		}
+		if v == 1 && ch.period == 0 {
+			return unix.EINVAL
+		}
+		ch.enabled = v == 1
+	case "polarity":
+		if token != "normal" && token != "inversed" {
+			return unix.EINVAL
+		}
+		if ch.enabled && ch.inversed != (token == "inversed") {
+			return unix.EBUSY
+		}
+		ch.inversed = token == "inversed"
+	default:
+		return unix.EACCES
+	}
+	return 0
+}
+
+func (tree *FakeSysfsPWMTree) poll(fds []unix.PollFd, timeout int) (int, error) {
+	if tree.prev_kernel.sysfsKernel != nil {
+		return tree.prev_kernel.poll(fds, timeout)
+	}
+	return unix.Poll(fds, timeout)
+}
+
+var _ sysfsKernel = (*FakeSysfsPWMTree)(nil)
@@ -0,0 +1,414 @@
+package bbhw
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// kernel emulating pwm tree with pwmchip0 of 2 channels
+func useFakeSysfsPWMTree(t *testing.T) (*FakeSysfsPWMTree, string) {
+	dir := t.TempDir()
+	tree, err := NewFakeSysfsPWMTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(tree.Close)
+	if err = tree.AddChip(0, 2); err != nil {
+		t.Fatal(err)
+	}
+	useFreshClaimRegistry(t)
+	return tree, dir
+}
+
+func readPWMAttr(t *testing.T, dir string, chip, channel uint, attr string) string {
+	b, err := ioutil.ReadFile(filepath.Join(dir, fmt.Sprintf("pwmchip%d/pwm%d", chip, channel), attr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func Test_SysfsPWMExport(t *testing.T) {
+	tree, dir := useFakeSysfsPWMTree(t)
+	pwm, err := NewSysfsPWM(0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pwm.Close()
+	for attr, value := range map[string]string{"period": "0", "duty_cycle": "0", "enable": "0", "polarity": "normal"} {
+		if got := readPWMAttr(t, dir, 0, 1, attr); got != value {
+			t.Errorf("%s = %q after export, expected %q", attr, got, value)
+		}
+	}
+	if err = tree.Export(0, 1); !errors.Is(err, unix.EBUSY) {
+		t.Errorf("exporting twice: %v", err)
+	}
+	if _, err = NewSysfsPWM(0, 2); !errors.Is(err, unix.ENODEV) {
+		t.Errorf("exporting channel beyond npwm: %v", err)
+	}
+	var perr *PWMError
+	if _, err = NewSysfsPWM(3, 0); !errors.As(err, &perr) || perr.Chip != 3 || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("exporting on missing pwmchip3: %v", err)
+	}
+	// already exported by somebody else
+	if err = tree.Export(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewSysfsPWM(0, 0)
+	if err != nil {
+		t.Fatal("channel exported before:", err)
+	}
+	other.Close()
+}
+
+func Test_SysfsPWMClaims(t *testing.T) {
+	useFakeSysfsPWMTree(t)
+	pwm, err := NewSysfsPWM(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSysfsPWM(0, 0); !errors.Is(err, ErrAlreadyClaimed) {
+		t.Error("second SysfsPWM of the same channel:", err)
+	}
+	pwm.Close()
+	pwm, err = NewSysfsPWM(0, 0)
+	if err != nil {
+		t.Fatal("claim not released by Close:", err)
+	}
+	pwm.Close()
+}
+
+func Test_SysfsPWMPeriodDutyOrder(t *testing.T) {
+	tree, _ := useFakeSysfsPWMTree(t)
+	pwm, err := NewSysfsPWM(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pwm.Close()
+	if err = pwm.Enable(); !errors.Is(err, unix.EINVAL) {
+		t.Error("enabling without period:", err)
+	}
+	if err = pwm.SetDutyNanoseconds(1); !errors.Is(err, ErrOutOfRange) {
+		t.Error("duty without period:", err)
+	}
+	if err = pwm.SetPeriod(time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err = pwm.SetDutyNanoseconds(800000); err != nil {
+		t.Fatal(err)
+	}
+	if err = pwm.Enable(); err != nil {
+		t.Fatal(err)
+	}
+	// shorter than the duty: duty shortened and written first, or the kernel rejects the period
+	if err = pwm.SetPeriod(500 * time.Microsecond); err != nil {
+		t.Fatal(err)
+	}
+	if period, duty, enabled := tree.Output(0, 0); period != 500000 || duty != 500000 || !enabled {
+		t.Errorf("output %d/%d enabled %v after shortening the period", period, duty, enabled)
+	}
+	if err = pwm.SetDutyNanoseconds(100000); err != nil {
+		t.Fatal(err)
+	}
+	// longer: period written first, duty kept
+	if err = pwm.SetPeriod(2 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if period, duty, _ := tree.Output(0, 0); period != 2000000 || duty != 100000 {
+		t.Errorf("output %d/%d after extending the period", period, duty)
+	}
+	if err = pwm.SetDutyNanoseconds(2000001); !errors.Is(err, ErrOutOfRange) {
+		t.Error("duty longer than period:", err)
+	}
+	if err = pwm.SetPeriod(0); !errors.Is(err, ErrOutOfRange) {
+		t.Error("period 0:", err)
+	}
+	if err = pwm.Disable(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, enabled := tree.Output(0, 0); enabled {
+		t.Error("still enabled after Disable")
+	}
+}
+
+func Test_SysfsPWMUnexported(t *testing.T) {
+	tree, _ := useFakeSysfsPWMTree(t)
+	pwm, err := NewSysfsPWM(0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pwm.Close()
+	if err = tree.Unexport(0, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err = pwm.SetPeriod(time.Millisecond); !errors.Is(err, os.ErrNotExist) && !errors.Is(err, unix.ENODEV) {
+		t.Error("SetPeriod after unexport:", err)
+	}
+	if err = pwm.Enable(); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Enable after unexport:", err)
+	}
+}
+
+func Test_SysfsPWMExportWaitTimeout(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "pwmchip2"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "pwmchip2", "export"), nil, 0644)
+	prev := sysfs_pwm_base_
+	sysfs_pwm_base_ = dir
+	t.Cleanup(func() { sysfs_pwm_base_ = prev })
+	useFreshClaimRegistry(t)
+	// like udev, make the attributes appear some time after the export
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		cdir := filepath.Join(dir, "pwmchip2", "pwm1")
+		os.Mkdir(cdir, 0755)
+		ioutil.WriteFile(filepath.Join(cdir, "period"), []byte("0\n"), 0644)
+		ioutil.WriteFile(filepath.Join(cdir, "duty_cycle"), []byte("0\n"), 0644)
+	}()
+	pwm, err := NewSysfsPWM(2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pwm.Close()
+	if _, err := NewSysfsPWM(2, 0, PWMWithExportWaitTimeout(20*time.Millisecond)); err == nil {
+		t.Error("PWMWithExportWaitTimeout did not time out")
+	}
+	if _, err := NewSysfsPWM(2, 0, PWMWithExportWaitTimeout(0)); !errors.Is(err, os.ErrNotExist) {
+		t.Error("without waiting:", err)
+	}
+}
+
+func Test_SysfsPWMFrequencyDutyFraction(t *testing.T) {
+	tree, _ := useFakeSysfsPWMTree(t)
+	pwm, err := NewSysfsPWM(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pwm.Close()
+	// remembered until there is a period
+	if err = pwm.SetDutyFraction(0.4); err != nil {
+		t.Fatal(err)
+	}
+	if err = pwm.SetFrequency(25000); err != nil {
+		t.Fatal(err)
+	}
+	if period, duty, _ := tree.Output(0, 0); period != 40000 || duty != 16000 {
+		t.Errorf("output %d/%d at 25kHz 40%%", period, duty)
+	}
+	// lower and higher again, the fraction is kept and the kernel never sees duty > period
+	for _, hz := range []float64{1000, 100000, 3} {
+		if err = pwm.SetFrequency(hz); err != nil {
+			t.Fatal(hz, err)
+		}
+		f, err := pwm.GetFrequency()
+		if err != nil || math.Abs(f-hz)/hz > 1e-6 {
+			t.Errorf("GetFrequency() = %v, %v after SetFrequency(%v)", f, err, hz)
+		}
+		if d, err := pwm.GetDutyFraction(); err != nil || math.Abs(d-0.4) > 1e-6 {
+			t.Errorf("GetDutyFraction() = %v, %v at %vHz", d, err, hz)
+		}
+	}
+	// nanoseconds set directly make up the fraction kept from then on
+	if err = pwm.SetDutyNanoseconds(100000000); err != nil {
+		t.Fatal(err)
+	}
+	if err = pwm.SetFrequency(10); err != nil {
+		t.Fatal(err)
+	}
+	if period, duty, _ := tree.Output(0, 0); period != 100000000 || duty != 30000000 {
+		t.Errorf("output %d/%d, expected the fraction of SetDutyNanoseconds", period, duty)
+	}
+}
+
+func Test_SysfsPWMRangeErrors(t *testing.T) {
+	useFakeSysfsPWMTree(t)
+	pwm, err := NewSysfsPWM(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pwm.Close()
+	for _, c := range []struct {
+		hz, nearest float64
+	}{{3e9, 1e9}, {math.Inf(1), 1e9}, {0.1, 1e9 / math.MaxUint32}, {0, 1e9 / math.MaxUint32}, {math.NaN(), 1e9 / math.MaxUint32}} {
+		var rerr *PWMRangeError
+		err := pwm.SetFrequency(c.hz)
+		if !errors.As(err, &rerr) || rerr.Nearest != c.nearest || !errors.Is(err, ErrOutOfRange) {
+			t.Errorf("SetFrequency(%v): %v", c.hz, err)
+		}
+	}
+	for fraction, nearest := range map[float64]float64{1.5: 1, -0.1: 0} {
+		var rerr *PWMRangeError
+		if err := pwm.SetDutyFraction(fraction); !errors.As(err, &rerr) || rerr.Nearest != nearest {
+			t.Errorf("SetDutyFraction(%v): %v", fraction, err)
+		}
+	}
+	if f, err := pwm.GetFrequency(); f != 0 || err != nil {
+		t.Errorf("GetFrequency() = %v, %v without a period", f, err)
+	}
+}
+
+func Test_SysfsPWMPolarity(t *testing.T) {
+	tree, dir := useFakeSysfsPWMTree(t)
+	pwm, err := NewSysfsPWM(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pwm.Close()
+	if err = pwm.SetFrequency(1000); err != nil {
+		t.Fatal(err)
+	}
+	// disabled: written right away
+	if err = pwm.SetPolarity(true); err != nil {
+		t.Fatal(err)
+	}
+	if err = pwm.Enable(); err != nil {
+		t.Fatal(err)
+	}
+	// enabled: disabled for the change and enabled again
+	if err = pwm.SetPolarity(false); err != nil {
+		t.Fatal(err)
+	}
+	// unchanged: nothing written
+	if err = pwm.SetPolarity(false); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"period 1000000", "polarity inversed", "enable 1", "enable 0", "polarity normal", "enable 1"}
+	if writes := tree.Writes(0, 0); fmt.Sprint(writes) != fmt.Sprint(expected) {
+		t.Errorf("writes %q, expected %q", writes, expected)
+	}
+	if got := readPWMAttr(t, dir, 0, 0, "polarity"); got != "normal" {
+		t.Errorf("polarity %q", got)
+	}
+	if _, _, enabled := tree.Output(0, 0); !enabled {
+		t.Error("not enabled again after SetPolarity")
+	}
+	if err = tree.RemovePolarity(0); err != nil {
+		t.Fatal(err)
+	}
+	if err = pwm.SetPolarity(true); !errors.Is(err, ErrNotSupported) {
+		t.Error("SetPolarity without polarity attribute:", err)
+	}
+	if _, _, enabled := tree.Output(0, 0); !enabled {
+		t.Error("disabled by unsupported SetPolarity")
+	}
+}
+
+// leaves pwmchip0/pwm0 exported and running at 1kHz 90% inverted, like a crashed process would
+func leaveRunningPWM(t *testing.T) {
+	prev, err := NewSysfsPWM(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer prev.Close()
+	for _, err := range []error{prev.SetFrequency(1000), prev.SetDutyFraction(0.9), prev.SetPolarity(true), prev.Enable()} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func Test_SysfsPWMLeftoverState(t *testing.T) {
+	tree, dir := useFakeSysfsPWMTree(t)
+	leaveRunningPWM(t)
+	// adopted by default
+	pwm, err := NewSysfsPWM(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if period, duty, enabled := tree.Output(0, 0); period != 1000000 || duty != 900000 || !enabled {
+		t.Errorf("output %d/%d enabled %v after adopting", period, duty, enabled)
+	}
+	if err = pwm.SetFrequency(2000); err != nil {
+		t.Fatal(err)
+	}
+	if _, duty, _ := tree.Output(0, 0); duty != 450000 {
+		t.Errorf("duty %d, expected the adopted fraction kept", duty)
+	}
+	pwm.Close()
+
+	// reset: disabled, duty 0 and normal polarity, the period is kept
+	pwm, err = NewSysfsPWM(0, 0, PWMWithResetState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if period, duty, enabled := tree.Output(0, 0); period != 500000 || duty != 0 || enabled {
+		t.Errorf("output %d/%d enabled %v after reset", period, duty, enabled)
+	}
+	if got := readPWMAttr(t, dir, 0, 0, "polarity"); got != "normal" {
+		t.Errorf("polarity %q after reset", got)
+	}
+	pwm.Close()
+}
+
+func Test_SysfsPWMSettingsOrder(t *testing.T) {
+	tree, _ := useFakeSysfsPWMTree(t)
+	leaveRunningPWM(t)
+	before := len(tree.Writes(0, 0))
+	// the shorter period is only accepted after the duty cycle, the output keeps running
+	pwm, err := NewSysfsPWM(0, 0, PWMWithSettings(10000, 0.5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"duty_cycle 50000", "period 100000"}
+	if writes := tree.Writes(0, 0)[before:]; fmt.Sprint(writes) != fmt.Sprint(expected) {
+		t.Errorf("writes %q, expected %q", writes, expected)
+	}
+	if _, _, enabled := tree.Output(0, 0); !enabled {
+		t.Error("disabled by PWMWithSettings")
+	}
+	pwm.Close()
+
+	before = len(tree.Writes(0, 0))
+	pwm, err = NewSysfsPWM(0, 0, PWMWithResetState(), PWMWithSettings(100, 0.25))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"enable 0", "duty_cycle 0", "polarity normal", "period 10000000", "duty_cycle 2500000"}
+	if writes := tree.Writes(0, 0)[before:]; fmt.Sprint(writes) != fmt.Sprint(expected) {
+		t.Errorf("writes %q, expected %q", writes, expected)
+	}
+	if f, err := pwm.GetFrequency(); err != nil || f != 100 {
+		t.Errorf("GetFrequency() = %v, %v", f, err)
+	}
+	pwm.Close()
+
+	if _, err = NewSysfsPWM(0, 0, PWMWithSettings(0, 0.5)); !errors.Is(err, ErrOutOfRange) {
+		t.Error("PWMWithSettings(0, 0.5):", err)
+	}
+	if _, err = NewSysfsPWM(0, 0, PWMWithSettings(100, 2)); !errors.Is(err, ErrOutOfRange) {
+		t.Error("PWMWithSettings(100, 2):", err)
+	}
+}
+
+// another process exports the channel between the check for its directory and the write to export
+type racingExportKernel struct {
+	*FakeSysfsPWMTree
+}
+
+func (k racingExportKernel) written(f *os.File) error {
+	if filepath.Base(f.Name()) == "export" {
+		k.Export(0, 1)
+	}
+	return k.FakeSysfsPWMTree.written(f)
+}
+
+func Test_SysfsPWMExportBusy(t *testing.T) {
+	tree, _ := useFakeSysfsPWMTree(t)
+	prev := sysfs_kernel_.Load()
+	sysfs_kernel_.Store(sysfsKernelBox{racingExportKernel{tree}})
+	t.Cleanup(func() { sysfs_kernel_.Store(prev) })
+	pwm, err := NewSysfsPWM(0, 1)
+	if err != nil {
+		t.Fatal("EBUSY from export:", err)
+	}
+	pwm.Close()
+}
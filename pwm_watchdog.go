@@ -0,0 +1,190 @@
+package bbhw
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// returned by PWMWatchdog.Refresh once the watchdog tripped, until Rearm
+var ErrPWMWatchdogTripped = errors.New("PWM watchdog tripped")
+
+// returned by PWMWatchdog.Refresh and Rearm after Close
+var ErrPWMWatchdogClosed = errors.New("PWM watchdog closed")
+
+// Option of NewPWMWatchdog
+type PWMWatchdogOption func(*PWMWatchdog)
+
+// times the intervals on c
+func PWMWatchdogWithClock(c Clock) PWMWatchdogOption {
+	return func(w *PWMWatchdog) { w.clock = c }
+}
+
+// On a trip sets the duty fraction to fraction instead of disabling the PWM, e.g. a fan keeping its minimum speed.
+// If SetDutyFraction fails the PWM is disabled after all.
+func PWMWatchdogWithSafeDuty(fraction float64) PWMWatchdogOption {
+	return func(w *PWMWatchdog) { w.safeDuty, w.safeDutySet = fraction, true }
+}
+
+// A Refresh after a trip re-arms the watchdog instead of failing with ErrPWMWatchdogTripped
+func PWMWatchdogWithAutoRearm() PWMWatchdogOption {
+	return func(w *PWMWatchdog) { w.autoRearm = true }
+}
+
+// Fail-safe for a PWM driving a heater or motor: unless the control loop calls Refresh at least every interval,
+// a goroutine disables the PWM (or sets PWMWatchdogWithSafeDuty) and calls onTrip. Intervals are measured on the
+// monotonic clock, so setting the wall clock neither trips nor delays it.
+// A tripped watchdog leaves the PWM alone until re-armed by Rearm (or Refresh, see PWMWatchdogWithAutoRearm),
+// the control loop then sets and enables the PWM again.
+type PWMWatchdog struct {
+	pwm         PWM
+	interval    time.Duration
+	onTrip      func(error)
+	clock       Clock
+	safeDuty    float64
+	safeDutySet bool
+	autoRearm   bool
+	stop        chan struct{}
+	rearmed     chan struct{} // wakes the goroutine waiting while tripped
+	lock        sync.Mutex    // guards everything below, held while tripping
+	deadline    time.Time
+	tripped     bool
+	err         error // of the last trip
+	closed      bool
+}
+
+// Watches pwm, armed from now on. onTrip is called on the goroutine of the watchdog with nil if the PWM was
+// made safe, or the error of disabling it if not: then only the application can still cut the power. onTrip may be nil.
+func NewPWMWatchdog(pwm PWM, interval time.Duration, onTrip func(error), opts ...PWMWatchdogOption) (*PWMWatchdog, error) {
+	if pwm == nil {
+		panic("pwm == nil")
+	}
+	w := &PWMWatchdog{pwm: pwm, interval: interval, onTrip: onTrip, stop: make(chan struct{}), rearmed: make(chan struct{}, 1)}
+	for _, opt := range opts {
+		opt(w)
+	}
+	if w.clock == nil {
+		w.clock = defaultClock()
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("PWMWatchdog: invalid interval %v", interval)
+	}
+	if w.safeDutySet {
+		if err := checkDutyFraction(w.safeDuty); err != nil {
+			return nil, fmt.Errorf("PWMWatchdog: safe duty: %w", err)
+		}
+	}
+	w.deadline = w.clock.Now().Add(interval)
+	go w.run()
+	return w, nil
+}
+
+func (w *PWMWatchdog) run() {
+	for {
+		w.lock.Lock()
+		deadline, tripped := w.deadline, w.tripped
+		w.lock.Unlock()
+		var expired <-chan time.Time
+		if !tripped {
+			expired = w.clock.After(deadline.Sub(w.clock.Now()))
+		}
+		select {
+		case <-w.stop:
+			return
+		case <-w.rearmed:
+			continue
+		case <-expired:
+		}
+		w.lock.Lock()
+		if w.closed || w.tripped || w.clock.Now().Before(w.deadline) {
+			// refreshed meanwhile, wait for the new deadline
+			w.lock.Unlock()
+			continue
+		}
+		err := w.trip()
+		w.lock.Unlock()
+		if w.onTrip != nil {
+			w.onTrip(err)
+		}
+	}
+}
+
+// Applies the safe state with lock held, returns nil if the PWM got there
+func (w *PWMWatchdog) trip() error {
+	w.tripped = true
+	w.err = nil
+	if w.safeDutySet {
+		err := w.pwm.SetDutyFraction(w.safeDuty)
+		if err == nil {
+			return nil
+		}
+		loggerOr(nil).Log(LOG_WARN, "PWMWatchdog: setting the safe duty failed, disabling", "error", err)
+	}
+	if err := w.pwm.Disable(); err != nil {
+		w.err = fmt.Errorf("PWMWatchdog: disabling: %w", err)
+		loggerOr(nil).Log(LOG_ERROR, "PWMWatchdog: PWM not in its safe state", "error", err)
+	}
+	return w.err
+}
+
+// Starts the interval anew. Fails with ErrPWMWatchdogTripped once tripped, unless PWMWatchdogWithAutoRearm.
+func (w *PWMWatchdog) Refresh() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return ErrPWMWatchdogClosed
+	}
+	if w.tripped && !w.autoRearm {
+		return ErrPWMWatchdogTripped
+	}
+	w.rearm()
+	return nil
+}
+
+// Arms a tripped watchdog again, the interval starts now. The PWM is left as the trip left it.
+func (w *PWMWatchdog) Rearm() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return ErrPWMWatchdogClosed
+	}
+	w.rearm()
+	return nil
+}
+
+// with lock held
+func (w *PWMWatchdog) rearm() {
+	w.deadline = w.clock.Now().Add(w.interval)
+	if w.tripped {
+		w.tripped = false
+		select {
+		case w.rearmed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Whether the watchdog tripped and was not re-armed since
+func (w *PWMWatchdog) Tripped() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.tripped
+}
+
+// The error of disabling the PWM on the last trip, nil if it was made safe or did not trip
+func (w *PWMWatchdog) Err() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.err
+}
+
+// Stops watching, the PWM belongs to the caller and is left as it is
+func (w *PWMWatchdog) Close() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if !w.closed {
+		w.closed = true
+		close(w.stop)
+	}
+}
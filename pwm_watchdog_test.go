@@ -0,0 +1,176 @@
+package bbhw
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func expectTrip(t *testing.T, trips chan error) error {
+	t.Helper()
+	select {
+	case err := <-trips:
+		return err
+	case <-time.After(time.Second):
+		t.Fatal("watchdog did not trip")
+	}
+	return nil
+}
+
+func Test_PWMWatchdogTrip(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	pwm := NewFakeNamedPWM("HEATER")
+	pwm.SetClock(clock)
+	defer pwm.Close()
+	pwm.SetFrequency(1000)
+	pwm.SetDutyFraction(0.5)
+	pwm.Enable()
+	trips := make(chan error, 4)
+	var w *PWMWatchdog
+	afterTimer(t, clock, func() {
+		var err error
+		if w, err = NewPWMWatchdog(pwm, 100*time.Millisecond, func(err error) { trips <- err }, PWMWatchdogWithClock(clock)); err != nil {
+			t.Fatal(err)
+		}
+	})
+	defer w.Close()
+	clock.Advance(60 * time.Millisecond)
+	if err := w.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	// the first deadline passes, the watchdog waits for the refreshed one
+	afterTimer(t, clock, func() { clock.Advance(60 * time.Millisecond) })
+	if _, _, enabled := pwm.Output(); !enabled || w.Tripped() || len(trips) != 0 {
+		t.Fatal("tripped although refreshed")
+	}
+	clock.Advance(60 * time.Millisecond)
+	if err := expectTrip(t, trips); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, enabled := pwm.Output(); enabled || !w.Tripped() {
+		t.Error("PWM still enabled after the trip")
+	}
+	if err := w.Refresh(); !errors.Is(err, ErrPWMWatchdogTripped) {
+		t.Errorf("Refresh after the trip: %v", err)
+	}
+	afterTimer(t, clock, func() { w.Rearm() })
+	pwm.Enable()
+	clock.Advance(100 * time.Millisecond)
+	if err := expectTrip(t, trips); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, enabled := pwm.Output(); enabled {
+		t.Error("PWM still enabled after the second trip")
+	}
+}
+
+func Test_PWMWatchdogSafeDuty(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	pwm := NewFakeNamedPWM("HEATER")
+	pwm.SetClock(clock)
+	defer pwm.Close()
+	pwm.SetFrequency(1000)
+	pwm.SetDutyFraction(0.5)
+	pwm.Enable()
+	trips := make(chan error, 4)
+	var w *PWMWatchdog
+	afterTimer(t, clock, func() {
+		var err error
+		if w, err = NewPWMWatchdog(pwm, 100*time.Millisecond, func(err error) { trips <- err }, PWMWatchdogWithSafeDuty(0.1), PWMWatchdogWithClock(clock)); err != nil {
+			t.Fatal(err)
+		}
+	})
+	defer w.Close()
+	clock.Advance(100 * time.Millisecond)
+	if err := expectTrip(t, trips); err != nil {
+		t.Fatal(err)
+	}
+	pwm.AssertDutyNear(t, 0.1, 1e-9)
+	if _, _, enabled := pwm.Output(); !enabled {
+		t.Error("disabled although a safe duty is set")
+	}
+	// a failing SetDutyFraction escalates to Disable
+	failure := errors.New("write error")
+	pwm.FailNext("SetDutyFraction", failure)
+	afterTimer(t, clock, func() { w.Rearm() })
+	clock.Advance(100 * time.Millisecond)
+	if err := expectTrip(t, trips); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, enabled := pwm.Output(); enabled {
+		t.Error("not disabled after SetDutyFraction failed")
+	}
+	// and a failing Disable is reported
+	pwm.Enable()
+	pwm.FailNext("SetDutyFraction", failure)
+	pwm.FailNext("Disable", failure)
+	afterTimer(t, clock, func() { w.Rearm() })
+	clock.Advance(100 * time.Millisecond)
+	if err := expectTrip(t, trips); !errors.Is(err, failure) || !errors.Is(w.Err(), failure) {
+		t.Errorf("trip with a failing Disable: %v, Err() %v", err, w.Err())
+	}
+}
+
+func Test_PWMWatchdogAutoRearm(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	pwm := NewFakeNamedPWM("HEATER")
+	pwm.SetClock(clock)
+	defer pwm.Close()
+	pwm.SetFrequency(1000)
+	pwm.SetDutyFraction(0.5)
+	pwm.Enable()
+	trips := make(chan error, 4)
+	var w *PWMWatchdog
+	afterTimer(t, clock, func() {
+		var err error
+		if w, err = NewPWMWatchdog(pwm, 100*time.Millisecond, func(err error) { trips <- err }, PWMWatchdogWithAutoRearm(), PWMWatchdogWithClock(clock)); err != nil {
+			t.Fatal(err)
+		}
+	})
+	defer w.Close()
+	clock.Advance(100 * time.Millisecond)
+	if err := expectTrip(t, trips); err != nil {
+		t.Fatal(err)
+	}
+	afterTimer(t, clock, func() {
+		if err := w.Refresh(); err != nil {
+			t.Error("Refresh after the trip:", err)
+		}
+	})
+	if w.Tripped() {
+		t.Error("not re-armed by Refresh")
+	}
+	// the PWM is left alone until the control loop enables it again
+	if _, _, enabled := pwm.Output(); enabled {
+		t.Error("enabled by re-arming")
+	}
+	clock.Advance(99 * time.Millisecond)
+	if len(trips) != 0 {
+		t.Fatal("tripped before the interval passed")
+	}
+	clock.Advance(time.Millisecond)
+	expectTrip(t, trips)
+}
+
+func Test_PWMWatchdogErrors(t *testing.T) {
+	pwm := NewFakeNamedPWM("HEATER")
+	defer pwm.Close()
+	if _, err := NewPWMWatchdog(pwm, 0, nil); err == nil {
+		t.Error("interval 0 accepted")
+	}
+	if _, err := NewPWMWatchdog(pwm, time.Second, nil, PWMWatchdogWithSafeDuty(1.5)); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("safe duty 1.5: %v", err)
+	}
+	w, err := NewPWMWatchdog(pwm, time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	w.Close()
+	if err := w.Refresh(); !errors.Is(err, ErrPWMWatchdogClosed) {
+		t.Errorf("Refresh after Close: %v", err)
+	}
+	if err := w.Rearm(); !errors.Is(err, ErrPWMWatchdogClosed) {
+		t.Errorf("Rearm after Close: %v", err)
+	}
+}
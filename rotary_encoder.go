@@ -0,0 +1,361 @@
+package bbhw
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Decoding of a RotaryEncoder, see EncoderWithMode
+type EncoderMode int
+
+const (
+	ENCODER_FULL_STEP EncoderMode = iota // one step per full quadrature cycle, e.g. an EC11 with as many detents as pulses
+	ENCODER_HALF_STEP                    // one step per half cycle, for encoders with a detent at both A = B = low and high
+)
+
+func (m EncoderMode) String() string {
+	switch m {
+	case ENCODER_FULL_STEP:
+		return "full step"
+	case ENCODER_HALF_STEP:
+		return "half step"
+	default:
+		return fmt.Sprintf("EncoderMode(%d)", int(m))
+	}
+}
+
+// Step of a RotaryEncoder
+type EncoderStep struct {
+	Delta    int // +1 if A leads B, -1 if B leads A
+	Position int // after the step, see Reset
+	Time     time.Time
+}
+
+// Option of NewRotaryEncoder
+type EncoderOption func(*RotaryEncoder)
+
+// default is ENCODER_FULL_STEP
+func EncoderWithMode(mode EncoderMode) EncoderOption {
+	return func(e *RotaryEncoder) { e.mode = mode }
+}
+
+// polls A and B with s instead of using edge callbacks. Pins without edge support (e.g. mmapped) are polled
+// by a Sampler shared by the RotaryEncoders without this option, see EncoderWithSampleInterval.
+func EncoderWithSampler(s *Sampler) EncoderOption {
+	return func(e *RotaryEncoder) { e.sampler = s }
+}
+
+// interval of the shared Sampler polling pins without edge support, default 1ms (fast enough for encoders
+// turned by hand). RotaryEncoders with the same interval and clock share one Sampler.
+func EncoderWithSampleInterval(d time.Duration) EncoderOption {
+	return func(e *RotaryEncoder) { e.interval = d }
+}
+
+// times the steps and the shared Sampler on c
+func EncoderWithClock(c Clock) EncoderOption {
+	return func(e *RotaryEncoder) { e.clock = c }
+}
+
+// steps queued on Steps before the oldest ones are dropped
+const encoder_queue_ = 64
+
+type encoderSamplerKey struct {
+	interval time.Duration
+	clock    Clock
+}
+
+type encoderSampler struct {
+	sampler *Sampler
+	users   int
+}
+
+// Samplers of the RotaryEncoders on pins without edge support and without EncoderWithSampler,
+// started for the first one and stopped once the last one is closed
+var encoder_samplers_ = struct {
+	lock     sync.Mutex
+	samplers map[encoderSamplerKey]*encoderSampler
+}{samplers: make(map[encoderSamplerKey]*encoderSampler)}
+
+func acquireEncoderSampler(key encoderSamplerKey) (*Sampler, error) {
+	encoder_samplers_.lock.Lock()
+	defer encoder_samplers_.lock.Unlock()
+	shared := encoder_samplers_.samplers[key]
+	if shared == nil {
+		s, err := NewSampler(key.interval, SamplerWithClock(key.clock))
+		if err != nil {
+			return nil, err
+		}
+		shared = &encoderSampler{sampler: s}
+		encoder_samplers_.samplers[key] = shared
+	}
+	shared.users++
+	return shared.sampler, nil
+}
+
+func releaseEncoderSampler(key encoderSamplerKey) {
+	encoder_samplers_.lock.Lock()
+	defer encoder_samplers_.lock.Unlock()
+	shared := encoder_samplers_.samplers[key]
+	if shared.users--; shared.users == 0 {
+		shared.sampler.Stop()
+		delete(encoder_samplers_.samplers, key)
+	}
+}
+
+// Quarter steps of the quadrature states A<<1|B, indexed by old<<2|new.
+// +1 for 00 -> 10 -> 11 -> 01 -> 00 (A leads), -1 the other way, 0 for no change and invalid jumps (both changed)
+var encoder_quarters_ = [16]int{0, -1, 1, 0, 1, 0, 0, -1, -1, 0, 0, 1, 0, 1, -1, 0}
+
+// Quadrature decoder of a rotary encoder like the EC11 on two inputs.
+// Invalid transitions (both contacts changing at once) and bouncing contacts only cancel out quarter steps,
+// a step is only counted once the encoder went through all states to the next detent.
+type RotaryEncoder struct {
+	a, b     GPIOControllablePin
+	mode     EncoderMode
+	sampler  *Sampler
+	interval time.Duration
+	clock    Clock
+	shared   bool       // sampler is the shared one of interval and clock
+	edges    []EdgeGPIO // watched by callbacks instead of the sampler
+	state    int        // A<<1|B
+	rest     int        // state at the detents for ENCODER_FULL_STEP
+	quarters int        // since the last detent
+	position int
+	lock     sync.Mutex // guards position
+	steps    chan EncoderStep
+	stop     chan struct{}
+	done     chan struct{} // closed by the watching goroutine
+	closing  sync.Once
+	seen     uint64 // changes of A or B processed, for tests
+}
+
+// Watches a and b with edge callbacks (setting their edges to BOTH) if both are EdgeGPIOs, otherwise polls them,
+// see EncoderWithSampler and EncoderWithSampleInterval.
+// The detent of ENCODER_FULL_STEP is the state at construction if A = B, otherwise both high.
+func NewRotaryEncoder(a, b GPIOControllablePin, opts ...EncoderOption) (*RotaryEncoder, error) {
+	if a == nil || b == nil {
+		panic("gpio == nil")
+	}
+	e := &RotaryEncoder{a: a, b: b, interval: time.Millisecond, steps: make(chan EncoderStep, encoder_queue_),
+		stop: make(chan struct{}), done: make(chan struct{})}
+	for _, opt := range opts {
+		opt(e)
+	}
+	if e.mode != ENCODER_FULL_STEP && e.mode != ENCODER_HALF_STEP {
+		return nil, fmt.Errorf("RotaryEncoder: invalid %v", e.mode)
+	}
+	if e.clock == nil {
+		e.clock = defaultClock()
+	}
+	levela, err := a.GetState()
+	if err != nil {
+		return nil, err
+	}
+	levelb, err := b.GetState()
+	if err != nil {
+		return nil, err
+	}
+	e.state = int(boolToUint32(levela))<<1 | int(boolToUint32(levelb))
+	e.rest = 3
+	if e.state == 0 {
+		e.rest = 0
+	}
+	edgea, oka := a.(EdgeGPIO)
+	edgeb, okb := b.(EdgeGPIO)
+	if e.sampler == nil && oka && okb {
+		if err = e.watchEdges(edgea, edgeb); err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+	if e.sampler == nil {
+		if e.sampler, err = acquireEncoderSampler(e.sharedKey()); err != nil {
+			return nil, fmt.Errorf("RotaryEncoder: %w", err)
+		}
+		e.shared = true
+	}
+	if err = e.watchSampled(); err != nil {
+		if e.shared {
+			releaseEncoderSampler(e.sharedKey())
+		}
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *RotaryEncoder) sharedKey() encoderSamplerKey {
+	return encoderSamplerKey{e.interval, e.clock}
+}
+
+func (e *RotaryEncoder) watchEdges(a, b EdgeGPIO) error {
+	chans := [2]chan bool{make(chan bool, encoder_queue_), make(chan bool, encoder_queue_)}
+	e.edges = []EdgeGPIO{a, b}
+	for i, gpio := range e.edges {
+		err := gpio.SetEdge(BOTH)
+		if err == nil {
+			err = gpio.SetEdgeCallback(&chans[i], -1)
+		}
+		if err != nil {
+			for _, gpio := range e.edges {
+				gpio.SetEdge(NONE)
+			}
+			return err
+		}
+	}
+	go func() {
+		defer close(e.done)
+		defer func() {
+			// keep the edge callbacks from blocking until the gpios are closed
+			for _, c := range chans {
+				go func(c chan bool) {
+					for range c {
+					}
+				}(c)
+			}
+		}()
+		for {
+			select {
+			case <-e.stop:
+				return
+			case level, ok := <-chans[0]:
+				if !ok {
+					return
+				}
+				e.decode(e.state&1|int(boolToUint32(level))<<1, e.clock.Now())
+			case level, ok := <-chans[1]:
+				if !ok {
+					return
+				}
+				e.decode(e.state&2|int(boolToUint32(level)), e.clock.Now())
+			}
+		}
+	}()
+	return nil
+}
+
+func (e *RotaryEncoder) watchSampled() error {
+	eva, err := e.sampler.Register(e.a, encoder_queue_)
+	if err != nil {
+		return err
+	}
+	evb, err := e.sampler.Register(e.b, encoder_queue_)
+	if err != nil {
+		e.sampler.Unregister(e.a)
+		return err
+	}
+	// the Sampler delivers changes of both pins in the same tick before either is read,
+	// so they are decoded as one (invalid) transition instead of two quarter steps in either order
+	apply := func(state int, ev PinTransition, other <-chan PinTransition, bit int) int {
+		state = state&^bit | int(boolToUint32(ev.State))*bit
+		select {
+		case ov, ok := <-other:
+			if ok && ov.Err == nil {
+				state = state&bit | int(boolToUint32(ov.State))*(3^bit)
+			}
+		default:
+		}
+		return state
+	}
+	go func() {
+		defer close(e.done)
+		if e.shared {
+			defer releaseEncoderSampler(e.sharedKey())
+		}
+		defer e.sampler.Unregister(e.b)
+		defer e.sampler.Unregister(e.a)
+		for {
+			select {
+			case <-e.stop:
+				return
+			case ev, ok := <-eva:
+				if !ok {
+					return
+				}
+				if ev.Err == nil {
+					e.decode(apply(e.state, ev, evb, 2), ev.Time)
+				}
+			case ev, ok := <-evb:
+				if !ok {
+					return
+				}
+				if ev.Err == nil {
+					e.decode(apply(e.state, ev, eva, 1), ev.Time)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// runs the state machine for the new state A<<1|B, only called by the watching goroutine
+func (e *RotaryEncoder) decode(state int, now time.Time) {
+	defer atomic.AddUint64(&e.seen, 1)
+	e.quarters += encoder_quarters_[e.state<<2|state]
+	e.state = state
+	threshold := 4
+	if e.mode == ENCODER_HALF_STEP {
+		threshold = 2
+	} else if state != e.rest {
+		return
+	}
+	if state != 0 && state != 3 {
+		return
+	}
+	delta := 0
+	if e.quarters >= threshold {
+		delta = 1
+	} else if e.quarters <= -threshold {
+		delta = -1
+	}
+	e.quarters = 0
+	if delta == 0 {
+		return
+	}
+	e.lock.Lock()
+	e.position += delta
+	step := EncoderStep{Delta: delta, Position: e.position, Time: now}
+	e.lock.Unlock()
+	for {
+		select {
+		case e.steps <- step:
+			return
+		default:
+		}
+		select {
+		case <-e.steps:
+		default:
+		}
+	}
+}
+
+// Steps as they happen. If nobody reads them the oldest ones are dropped, Position stays correct.
+func (e *RotaryEncoder) Steps() <-chan EncoderStep {
+	return e.steps
+}
+
+// sum of all steps since construction or Reset
+func (e *RotaryEncoder) Position() int {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.position
+}
+
+func (e *RotaryEncoder) Reset() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.position = 0
+}
+
+// Stops decoding and waits for it to end, which unregisters A and B from the Sampler or sets their edges to NONE.
+// The gpios stay open. Can be called more than once.
+func (e *RotaryEncoder) Close() {
+	e.closing.Do(func() {
+		close(e.stop)
+		<-e.done
+		for _, gpio := range e.edges {
+			gpio.SetEdge(NONE)
+		}
+	})
+}
@@ -0,0 +1,248 @@
+package bbhw
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// one full step forward from both high: A falls first
+var encoder_forward_ = []int{3, 1, 0, 2, 3}
+
+// waveforms of A and B going through states (A<<1|B), one per millisecond
+func encoderWaveforms(states ...int) (a, b []WaveStep) {
+	for _, s := range states {
+		a = append(a, WaveStep{s&2 != 0, time.Millisecond})
+		b = append(b, WaveStep{s&1 != 0, time.Millisecond})
+	}
+	return
+}
+
+// waits until the goroutine of e decoded n changes
+func waitSeen(t *testing.T, e *RotaryEncoder, n uint64) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); atomic.LoadUint64(&e.seen) != n; time.Sleep(time.Microsecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("encoder decoded %d changes, expected %d", atomic.LoadUint64(&e.seen), n)
+		}
+	}
+}
+
+// plays states on a and b and waits until e decoded every change
+func playEncoder(t *testing.T, clock *ManualClock, e *RotaryEncoder, a, b *FakeGPIO, states ...int) {
+	t.Helper()
+	decoded := func() { waitSeen(t, e, uint64(len(a.History())+len(b.History()))) }
+	wa, wb := encoderWaveforms(states...)
+	var done [2]<-chan struct{}
+	// both waveforms scheduled their second step before the clock moves
+	afterTimer(t, clock, func() { done[0], _ = a.PlayWaveform(wa) })
+	decoded()
+	afterTimer(t, clock, func() { done[1], _ = b.PlayWaveform(wb) })
+	decoded()
+	for i := range states {
+		clock.Advance(time.Millisecond)
+		if i < len(states)-1 {
+			clock.BlockUntil(2) // the next steps of both waveforms
+		}
+		decoded()
+	}
+	for _, d := range done {
+		select {
+		case <-d:
+		case <-time.After(time.Second):
+			t.Fatal("waveform did not finish")
+		}
+	}
+}
+
+func Test_RotaryEncoderFullStep(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	a, b := NewFakeNamedGPIO("A", IN, nil), NewFakeNamedGPIO("B", IN, nil)
+	for _, gpio := range []*FakeGPIO{a, b} {
+		gpio.SetClock(clock)
+		gpio.FakeInput(true)
+		gpio.EnableHistory(1000)
+		defer gpio.Close()
+	}
+	e, err := NewRotaryEncoder(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	var forward []int
+	for i := 0; i < 3; i++ {
+		forward = append(forward, encoder_forward_[1:]...)
+	}
+	playEncoder(t, clock, e, a, b, forward...)
+	if p := e.Position(); p != 3 {
+		t.Errorf("position %d after 3 steps forward", p)
+	}
+	// backward is forward reversed
+	playEncoder(t, clock, e, a, b, 2, 0, 1, 3)
+	if p := e.Position(); p != 2 {
+		t.Errorf("position %d after a step back", p)
+	}
+	for _, want := range []EncoderStep{{1, 1, time.Time{}}, {1, 2, time.Time{}}, {1, 3, time.Time{}}, {-1, 2, time.Time{}}} {
+		select {
+		case step := <-e.Steps():
+			if step.Delta != want.Delta || step.Position != want.Position {
+				t.Errorf("step %+v, expected %+v", step, want)
+			}
+		default:
+			t.Fatalf("missing step %+v", want)
+		}
+	}
+	e.Reset()
+	if p := e.Position(); p != 0 {
+		t.Errorf("position %d after Reset", p)
+	}
+}
+
+func Test_RotaryEncoderGlitches(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	a, b := NewFakeNamedGPIO("A", IN, nil), NewFakeNamedGPIO("B", IN, nil)
+	for _, gpio := range []*FakeGPIO{a, b} {
+		gpio.SetClock(clock)
+		gpio.FakeInput(true)
+		gpio.EnableHistory(1000)
+		defer gpio.Close()
+	}
+	e, err := NewRotaryEncoder(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	// A bouncing at the start, turning half way and back, B bouncing at the end
+	playEncoder(t, clock, e, a, b, 1, 3, 1, 3, 1, 0, 1, 3, 1, 0, 2, 0, 2, 3, 2, 3)
+	if p := e.Position(); p != 1 {
+		t.Errorf("position %d after one glitchy step", p)
+	}
+	// a jump of both contacts is no quarter step in either direction
+	e.decode(0, time.Time{})
+	e.decode(1, time.Time{})
+	e.decode(3, time.Time{})
+	if p := e.Position(); p != 1 {
+		t.Errorf("position %d after invalid transitions", p)
+	}
+}
+
+func Test_RotaryEncoderHalfStep(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	a, b := NewFakeNamedGPIO("A", IN, nil), NewFakeNamedGPIO("B", IN, nil)
+	for _, gpio := range []*FakeGPIO{a, b} {
+		gpio.SetClock(clock)
+		gpio.FakeInput(true)
+		gpio.EnableHistory(1000)
+		defer gpio.Close()
+	}
+	e, err := NewRotaryEncoder(a, b, EncoderWithMode(ENCODER_HALF_STEP))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	playEncoder(t, clock, e, a, b, 1, 0, 2, 3, 2, 0)
+	if p := e.Position(); p != 1 {
+		t.Errorf("position %d after 2 half steps forward and one back", p)
+	}
+}
+
+// sets A and B to each of states and lets the Sampler on clock pick it up
+func sampleEncoder(t *testing.T, clock *ManualClock, e *RotaryEncoder, a, b *FakeGPIO, states ...int) {
+	t.Helper()
+	for _, state := range states {
+		seen := atomic.LoadUint64(&e.seen)
+		a.FakeInput(state&2 != 0)
+		b.FakeInput(state&1 != 0)
+		clock.Advance(time.Millisecond)
+		waitSeen(t, e, seen+1)
+	}
+}
+
+func Test_RotaryEncoderSampler(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	s := NewSamplerOrPanic(time.Millisecond, SamplerWithClock(clock))
+	defer s.Stop()
+	a, b := NewFakeGPIO(1, IN), NewFakeGPIO(2, IN)
+	a.FakeInput(true)
+	b.FakeInput(true)
+	e, err := NewRotaryEncoder(a, b, EncoderWithSampler(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	sampleEncoder(t, clock, e, a, b, append(encoder_forward_[1:], encoder_forward_[1:]...)...)
+	if p := e.Position(); p != 2 {
+		t.Errorf("position %d after 2 sampled steps", p)
+	}
+	step := <-e.Steps()
+	if want := time.Unix(1000, 0).Add(4 * time.Millisecond); step.Delta != 1 || !step.Time.Equal(want) {
+		t.Errorf("step %+v, expected +1 at %v", step, want)
+	}
+}
+
+func Test_RotaryEncoderSharedSampler(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	a, b := NewFakeGPIO(1, IN), NewFakeGPIO(2, IN)
+	a.FakeInput(true)
+	b.FakeInput(true)
+	// without edge support
+	e, err := NewRotaryEncoder(struct{ GPIOControllablePin }{a}, struct{ GPIOControllablePin }{b}, EncoderWithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e2, err := NewRotaryEncoder(struct{ GPIOControllablePin }{NewFakeGPIO(3, IN)}, struct{ GPIOControllablePin }{NewFakeGPIO(4, IN)},
+		EncoderWithClock(clock))
+	if err != nil || e2.sampler != e.sampler {
+		t.Fatalf("not sharing one Sampler: %v", err)
+	}
+	e3, err := NewRotaryEncoder(struct{ GPIOControllablePin }{NewFakeGPIO(5, IN)}, struct{ GPIOControllablePin }{NewFakeGPIO(6, IN)},
+		EncoderWithClock(clock), EncoderWithSampleInterval(10*time.Millisecond))
+	if err != nil || e3.sampler == e.sampler || e3.sampler.GetInterval() != 10*time.Millisecond {
+		t.Fatalf("sharing the Sampler of another interval: %v", err)
+	}
+	if _, err = NewRotaryEncoder(struct{ GPIOControllablePin }{NewFakeGPIO(7, IN)}, struct{ GPIOControllablePin }{NewFakeGPIO(8, IN)},
+		EncoderWithSampleInterval(0)); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("interval 0: %v", err)
+	}
+	sampleEncoder(t, clock, e, a, b, encoder_forward_[1:]...)
+	if step := <-e.Steps(); step.Delta != 1 {
+		t.Errorf("step %+v", step)
+	}
+	e.Close()
+	e2.Close()
+	e3.Close()
+	encoder_samplers_.lock.Lock()
+	defer encoder_samplers_.lock.Unlock()
+	if n := len(encoder_samplers_.samplers); n != 0 {
+		t.Errorf("%d shared Samplers still running after the last encoder was closed", n)
+	}
+}
+
+func Test_RotaryEncoderClose(t *testing.T) {
+	a, b := NewFakeNamedGPIO("A", IN, nil), NewFakeNamedGPIO("B", IN, nil)
+	defer a.Close()
+	defer b.Close()
+	e, err := NewRotaryEncoder(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.Close()
+		}()
+	}
+	wg.Wait()
+	if n := goroutinesCreatedBy("(*RotaryEncoder).watchEdges"); n != 0 {
+		t.Errorf("%d goroutines still decoding after Close", n)
+	}
+	for _, gpio := range []*FakeGPIO{a, b} {
+		if edge, err := gpio.GetEdge(); edge != "none" || err != nil {
+			t.Errorf("%v: edge %q after Close: %v", gpio, edge, err)
+		}
+	}
+}
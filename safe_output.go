@@ -0,0 +1,148 @@
+package bbhw
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// returned by SafeOutput.SetState after Close, ReleaseAllSafeOutputs or repeated failures put it in its safe state for good
+var ErrSafeOutputReleased = errors.New("SafeOutput released to its safe level")
+
+// Option of NewSafeOutput
+type SafeOutputOption func(*SafeOutput)
+
+// SetState failures in a row after which the safe level is applied for good, default 3
+func SafeOutputWithMaxFailures(n int) SafeOutputOption {
+	return func(o *SafeOutput) { o.maxFailures = n }
+}
+
+// process-wide list of the SafeOutputs not released yet, for ReleaseAllSafeOutputs
+var safe_outputs_ = struct {
+	lock    sync.Mutex
+	outputs map[*SafeOutput]struct{}
+}{outputs: make(map[*SafeOutput]struct{})}
+
+// Output driving a relay, solenoid or heater which has to fall back to its safe level (usually off):
+// on Close, on ReleaseAllSafeOutputs (e.g. from a signal handler or at the end of main) and after
+// repeated SetState failures. Once released it stays at the safe level, the GPIO belongs to the caller.
+type SafeOutput struct {
+	gpio        GPIOControllablePin
+	safe        bool
+	maxFailures int
+	lock        sync.Mutex // guards everything below
+	energized   bool
+	failures    int // in a row
+	released    bool
+}
+
+// Drives gpio (an output) to safe right away
+func NewSafeOutput(gpio GPIOControllablePin, safe bool, opts ...SafeOutputOption) (*SafeOutput, error) {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	o := &SafeOutput{gpio: gpio, safe: safe, maxFailures: 3}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.maxFailures < 1 {
+		return nil, fmt.Errorf("SafeOutput: %d failures allowed", o.maxFailures)
+	}
+	if err := checkOutput(gpio, "SafeOutput"); err != nil {
+		return nil, err
+	}
+	if err := gpio.SetState(safe); err != nil {
+		return nil, fmt.Errorf("SafeOutput: applying the safe level: %w", err)
+	}
+	safe_outputs_.lock.Lock()
+	safe_outputs_.outputs[o] = struct{}{}
+	safe_outputs_.lock.Unlock()
+	return o, nil
+}
+
+// Drives the output to state. Failing SafeOutputWithMaxFailures times in a row applies the safe level
+// and releases the SafeOutput.
+func (o *SafeOutput) SetState(state bool) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.released {
+		return ErrSafeOutputReleased
+	}
+	if err := o.gpio.SetState(state); err != nil {
+		if o.failures++; o.failures < o.maxFailures {
+			return err
+		}
+		if serr := o.release(); serr != nil {
+			return fmt.Errorf("SafeOutput: %d failures, applying the safe level failed too (%v): %w", o.failures, serr, err)
+		}
+		return fmt.Errorf("SafeOutput: %d failures, released: %w", o.failures, err)
+	}
+	o.failures = 0
+	o.energized = state != o.safe
+	return nil
+}
+
+// Drives the output away from (true) or to (false) its safe level
+func (o *SafeOutput) Energize(on bool) error {
+	return o.SetState(on != o.safe)
+}
+
+// Whether the output is driven away from its safe level, as far as known: a failed SetState leaves it unchanged.
+func (o *SafeOutput) Energized() bool {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.energized
+}
+
+// Applies the safe level and releases the SafeOutput, SetState fails from now on. Safe to call several times.
+// A failure to apply the safe level is logged, see ReleaseAllSafeOutputs for getting it.
+func (o *SafeOutput) Close() {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.released {
+		return
+	}
+	if err := o.release(); err != nil {
+		loggerOr(nil).Log(LOG_ERROR, "SafeOutput: applying the safe level failed", "error", err)
+	}
+}
+
+func (o *SafeOutput) release() error {
+	o.released = true
+	safe_outputs_.lock.Lock()
+	delete(safe_outputs_.outputs, o)
+	safe_outputs_.lock.Unlock()
+	err := o.gpio.SetState(o.safe)
+	if err == nil {
+		o.energized = false
+	}
+	return err
+}
+
+// Applies the safe level of all SafeOutputs not closed yet and releases them.
+// Returns the first error of a GPIO that could not be put into its safe level.
+func ReleaseAllSafeOutputs() error {
+	safe_outputs_.lock.Lock()
+	outputs := make([]*SafeOutput, 0, len(safe_outputs_.outputs))
+	for o := range safe_outputs_.outputs {
+		outputs = append(outputs, o)
+	}
+	safe_outputs_.lock.Unlock()
+	var first error
+	failed := 0
+	for _, o := range outputs {
+		o.lock.Lock()
+		if !o.released {
+			if err := o.release(); err != nil {
+				if failed++; first == nil {
+					first = err
+				}
+			}
+		}
+		o.lock.Unlock()
+	}
+	if first != nil {
+		return fmt.Errorf("SafeOutput: %d of %d not at their safe level: %w", failed, len(outputs), first)
+	}
+	return nil
+}
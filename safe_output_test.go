@@ -0,0 +1,131 @@
+package bbhw
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func Test_SafeOutputClose(t *testing.T) {
+	gpio := NewFakeNamedGPIO("RELAY", OUT, nil)
+	defer gpio.Close()
+	o, err := NewSafeOutput(gpio, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+	if GetStateOrPanic(gpio) != true || o.Energized() {
+		t.Fatal("not at the safe level after construction")
+	}
+	if err := o.Energize(true); err != nil || GetStateOrPanic(gpio) || !o.Energized() {
+		t.Fatalf("Energize(true): %v", err)
+	}
+	o.Close()
+	if !GetStateOrPanic(gpio) || o.Energized() {
+		t.Error("not at the safe level after Close")
+	}
+	if err := o.SetState(false); !errors.Is(err, ErrSafeOutputReleased) || !GetStateOrPanic(gpio) {
+		t.Errorf("SetState after Close: %v", err)
+	}
+	o.Close()
+}
+
+func Test_SafeOutputRepeatedFailures(t *testing.T) {
+	gpio := NewFakeNamedGPIO("RELAY", OUT, nil)
+	defer gpio.Close()
+	o, err := NewSafeOutput(gpio, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+	if err := o.SetState(true); err != nil {
+		t.Fatal(err)
+	}
+	failure := errors.New("gone")
+	for i := 0; i < 3; i++ {
+		gpio.FailNext("SetState", failure)
+	}
+	// a single failure leaves it energized
+	if err := o.SetState(true); !errors.Is(err, failure) || !o.Energized() {
+		t.Fatalf("first failure: %v", err)
+	}
+	if err := o.SetState(true); !errors.Is(err, failure) {
+		t.Fatalf("second failure: %v", err)
+	}
+	if err := o.SetState(true); !errors.Is(err, failure) || GetStateOrPanic(gpio) || o.Energized() {
+		t.Fatalf("third failure: %v, pin %v", err, GetStateOrPanic(gpio))
+	}
+	if err := o.SetState(true); !errors.Is(err, ErrSafeOutputReleased) {
+		t.Errorf("SetState after the failures: %v", err)
+	}
+}
+
+// the safe level failing as well, with a failure in between reset by a success
+func Test_SafeOutputSafeLevelFailing(t *testing.T) {
+	gpio := NewFakeNamedGPIO("RELAY", OUT, nil)
+	defer gpio.Close()
+	o, err := NewSafeOutput(gpio, false, SafeOutputWithMaxFailures(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+	failure := errors.New("gone")
+	gpio.FailNext("SetState", failure)
+	o.Energize(true)
+	o.Energize(true)
+	for i := 0; i < 3; i++ {
+		gpio.FailNext("SetState", failure)
+	}
+	if err := o.Energize(false); err == nil {
+		t.Fatal("failure not returned")
+	}
+	if err := o.Energize(false); !errors.Is(err, failure) || !GetStateOrPanic(gpio) || !o.Energized() {
+		t.Errorf("safe level not applicable: %v, pin %v, energized %v", err, GetStateOrPanic(gpio), o.Energized())
+	}
+}
+
+func Test_ReleaseAllSafeOutputs(t *testing.T) {
+	var outputs [3]*SafeOutput
+	var gpios [3]*FakeGPIO
+	// a heater, an active low relay board and a valve
+	for i, safe := range []bool{false, true, false} {
+		gpios[i] = NewFakeNamedGPIO(fmt.Sprintf("OUT%d", i), OUT, nil)
+		defer gpios[i].Close()
+		var err error
+		if outputs[i], err = NewSafeOutput(gpios[i], safe); err != nil {
+			t.Fatal(err)
+		}
+		defer outputs[i].Close()
+	}
+	heater, relay, valve := outputs[0], outputs[1], outputs[2]
+	heaterGPIO, relayGPIO, valveGPIO := gpios[0], gpios[1], gpios[2]
+	for _, o := range []*SafeOutput{heater, relay, valve} {
+		if err := o.Energize(true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	valve.Close()
+	valveGPIO.SetState(true)
+	failure := errors.New("gone")
+	heaterGPIO.FailNext("SetState", failure)
+	if err := ReleaseAllSafeOutputs(); !errors.Is(err, failure) {
+		t.Errorf("ReleaseAllSafeOutputs() = %v", err)
+	}
+	if !GetStateOrPanic(relayGPIO) || relay.Energized() || !heater.Energized() {
+		t.Error("not released to the safe levels")
+	}
+	if !GetStateOrPanic(valveGPIO) {
+		t.Error("closed SafeOutput released again")
+	}
+	if err := heater.SetState(false); !errors.Is(err, ErrSafeOutputReleased) {
+		t.Errorf("SetState after ReleaseAllSafeOutputs: %v", err)
+	}
+	if err := ReleaseAllSafeOutputs(); err != nil {
+		t.Errorf("second ReleaseAllSafeOutputs() = %v", err)
+	}
+	in := NewFakeGPIO(9, IN)
+	t.Cleanup(in.Close)
+	if _, err := NewSafeOutput(in, false); !errors.Is(err, ErrInvalidDirection) {
+		t.Errorf("input accepted: %v", err)
+	}
+}
@@ -0,0 +1,240 @@
+package bbhw
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// returned on the done channel of Sequencer.Play if the pattern was stopped or replaced before it ended
+var ErrSequencerStopped = errors.New("pattern stopped")
+
+// One step of a Sequencer pattern: State is held for Dur
+type PatternStep struct {
+	State bool
+	Dur   time.Duration
+}
+
+// What a Sequencer does with a Play while another one is playing, see SequencerWithOverlap
+type SequencerOverlap int
+
+const (
+	SEQUENCER_REPLACE SequencerOverlap = iota // stop the playing and the queued patterns, play the new one right away
+	SEQUENCER_QUEUE                           // play it after the ones before
+)
+
+// Option of NewSequencer
+type SequencerOption func(*Sequencer)
+
+// default is SEQUENCER_REPLACE
+func SequencerWithOverlap(overlap SequencerOverlap) SequencerOption {
+	return func(s *Sequencer) { s.overlap = overlap }
+}
+
+// level of the output while no pattern plays, default low
+func SequencerWithIdle(state bool) SequencerOption {
+	return func(s *Sequencer) { s.idle = state }
+}
+
+// schedules the steps on c
+func SequencerWithClock(c Clock) SequencerOption {
+	return func(s *Sequencer) { s.clock = c }
+}
+
+type sequencerPlay struct {
+	pattern []PatternStep
+	n       int
+	done    chan error
+	cancel  chan struct{}
+}
+
+// Plays timed on/off patterns on an output, e.g. blink codes or buzzer beeps, on one goroutine.
+// Steps are scheduled from the start of a Play, so a late SetState does not delay the following steps
+// and long patterns do not drift.
+type Sequencer struct {
+	gpio    GPIOControllablePin
+	pattern []PatternStep
+	overlap SequencerOverlap
+	idle    bool
+	clock   Clock
+	wake    chan struct{}
+	stop    chan struct{}
+	lock    sync.Mutex // guards queue and current
+	queue   []*sequencerPlay
+	current *sequencerPlay
+}
+
+// pattern is what Play plays, PlayPattern plays others. gpio has to be an output, it is driven to the idle level.
+func NewSequencer(gpio GPIOControllablePin, pattern []PatternStep, opts ...SequencerOption) (*Sequencer, error) {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	s := &Sequencer{gpio: gpio, wake: make(chan struct{}, 1), stop: make(chan struct{})}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.clock == nil {
+		s.clock = defaultClock()
+	}
+	if s.overlap != SEQUENCER_REPLACE && s.overlap != SEQUENCER_QUEUE {
+		return nil, fmt.Errorf("Sequencer: invalid overlap %d", int(s.overlap))
+	}
+	if err := checkPattern(pattern); err != nil {
+		return nil, err
+	}
+	s.pattern = append([]PatternStep(nil), pattern...)
+	if err := checkOutput(gpio, "Sequencer"); err != nil {
+		return nil, err
+	}
+	if err := gpio.SetState(s.idle); err != nil {
+		return nil, err
+	}
+	go s.run()
+	return s, nil
+}
+
+func checkPattern(pattern []PatternStep) error {
+	var total time.Duration
+	for i, step := range pattern {
+		if step.Dur < 0 {
+			return fmt.Errorf("Sequencer: step %d with negative duration %v", i, step.Dur)
+		}
+		total += step.Dur
+	}
+	if total <= 0 {
+		return errors.New("Sequencer: pattern without duration")
+	}
+	return nil
+}
+
+// Plays the pattern given to NewSequencer n times, 0 for forever (until Stop or a replacing Play).
+// done receives nil once it ended, ErrSequencerStopped or the error of a failed SetState.
+func (s *Sequencer) Play(n int) (done <-chan error) {
+	return s.PlayPattern(s.pattern, n)
+}
+
+// Plays pattern n times like Play
+func (s *Sequencer) PlayPattern(pattern []PatternStep, n int) (done <-chan error) {
+	p := &sequencerPlay{pattern: append([]PatternStep(nil), pattern...), n: n, done: make(chan error, 1), cancel: make(chan struct{})}
+	if n < 0 {
+		p.done <- fmt.Errorf("Sequencer: playing %d times", n)
+		return p.done
+	}
+	if err := checkPattern(pattern); err != nil {
+		p.done <- err
+		return p.done
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	select {
+	case <-s.stop:
+		p.done <- errors.New("Sequencer closed")
+		return p.done
+	default:
+	}
+	if s.overlap == SEQUENCER_REPLACE {
+		s.cancelAll()
+	}
+	s.queue = append(s.queue, p)
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return p.done
+}
+
+// Stops the playing pattern and the queued ones, then idles
+func (s *Sequencer) Stop() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.cancelAll()
+}
+
+// whether a pattern is playing or queued
+func (s *Sequencer) Playing() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.current != nil || len(s.queue) > 0
+}
+
+// Stops and ends the goroutine, the output stays at the idle level. The GPIO belongs to the caller.
+func (s *Sequencer) Close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	select {
+	case <-s.stop:
+		return
+	default:
+	}
+	s.cancelAll()
+	close(s.stop)
+}
+
+// with lock held
+func (s *Sequencer) cancelAll() {
+	if s.current != nil {
+		close(s.current.cancel)
+		s.current = nil
+	}
+	for _, p := range s.queue {
+		p.done <- ErrSequencerStopped
+	}
+	s.queue = nil
+}
+
+func (s *Sequencer) run() {
+	for {
+		s.lock.Lock()
+		var p *sequencerPlay
+		if len(s.queue) > 0 {
+			p, s.queue = s.queue[0], s.queue[1:]
+			s.current = p
+		}
+		s.lock.Unlock()
+		if p == nil {
+			select {
+			case <-s.stop:
+				return
+			case <-s.wake:
+			}
+			continue
+		}
+		err := s.play(p)
+		s.lock.Lock()
+		if s.current == p {
+			s.current = nil
+		}
+		idle := len(s.queue) == 0
+		s.lock.Unlock()
+		if idle {
+			if ierr := s.gpio.SetState(s.idle); err == nil && ierr != nil {
+				err = fmt.Errorf("Sequencer idle: %w", ierr)
+			}
+		}
+		p.done <- err
+	}
+}
+
+func (s *Sequencer) play(p *sequencerPlay) error {
+	next := s.clock.Now()
+	for i := 0; p.n == 0 || i < p.n; i++ {
+		for _, step := range p.pattern {
+			select {
+			case <-p.cancel:
+				return ErrSequencerStopped
+			default:
+			}
+			if err := s.gpio.SetState(step.State); err != nil {
+				return fmt.Errorf("Sequencer: %w", err)
+			}
+			next = next.Add(step.Dur)
+			select {
+			case <-p.cancel:
+				return ErrSequencerStopped
+			case <-s.clock.After(next.Sub(s.clock.Now())):
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package bbhw
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// starts playing and waits for the goroutine to wait on the clock
+func startPlay(t *testing.T, clock *ManualClock, play func() <-chan error) (done <-chan error) {
+	t.Helper()
+	afterTimer(t, clock, func() { done = play() })
+	return done
+}
+
+func expectPlayResult(t *testing.T, done <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(time.Second):
+		t.Fatal("pattern did not end")
+		return nil
+	}
+}
+
+type patternTransition struct {
+	at    time.Duration // since the start
+	state bool
+}
+
+func expectTransitions(t *testing.T, gpio *FakeGPIO, start time.Time, expected ...patternTransition) {
+	t.Helper()
+	history := gpio.History()
+	if len(history) != len(expected) {
+		t.Fatalf("%d transitions, expected %d: %+v", len(history), len(expected), history)
+	}
+	for i, tr := range history {
+		if at := tr.Requested.Sub(start); at != expected[i].at || tr.State != expected[i].state {
+			t.Errorf("transition %d to %v at %v, expected %+v", i, tr.State, at, expected[i])
+		}
+	}
+}
+
+// a long and a short flash, then a pause
+var test_pattern_ = []PatternStep{{true, 100 * time.Millisecond}, {false, 50 * time.Millisecond}, {true, 10 * time.Millisecond}, {false, 340 * time.Millisecond}}
+
+func Test_SequencerPatternTimes(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	gpio := NewFakeNamedGPIO("LED", OUT, nil)
+	gpio.SetClock(clock)
+	defer gpio.Close()
+	s, err := NewSequencer(gpio, test_pattern_, SequencerWithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	gpio.EnableHistory(1000)
+	start := clock.Now()
+	done := startPlay(t, clock, func() <-chan error { return s.Play(3) })
+	if !s.Playing() {
+		t.Error("not playing")
+	}
+	var steps []time.Duration
+	for i := 0; i < 3; i++ {
+		for _, step := range test_pattern_ {
+			steps = append(steps, step.Dur)
+		}
+	}
+	advanceSteps(t, clock, steps...)
+	if err := expectPlayResult(t, done); err != nil {
+		t.Fatal(err)
+	}
+	var expected []patternTransition
+	for i := time.Duration(0); i < 3; i++ {
+		expected = append(expected, patternTransition{i * 500 * time.Millisecond, true}, patternTransition{i*500*time.Millisecond + 100*time.Millisecond, false},
+			patternTransition{i*500*time.Millisecond + 150*time.Millisecond, true}, patternTransition{i*500*time.Millisecond + 160*time.Millisecond, false})
+	}
+	expectTransitions(t, gpio, start, expected...)
+	if s.Playing() {
+		t.Error("still playing")
+	}
+}
+
+func Test_SequencerNoDrift(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	gpio := NewFakeNamedGPIO("LED", OUT, nil)
+	gpio.SetClock(clock)
+	defer gpio.Close()
+	s, err := NewSequencer(gpio, []PatternStep{{true, 10 * time.Millisecond}, {false, 10 * time.Millisecond}}, SequencerWithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	gpio.EnableHistory(1000)
+	// every SetState takes 3ms, the steps still start every 10ms
+	gpio.SetOperationLatency(3 * time.Millisecond)
+	start := clock.Now()
+	done := startPlay(t, clock, func() <-chan error { return s.Play(50) })
+	advanceWhile(t, clock, func() bool { return len(done) == 0 }) // up to the SetState of the idle level
+	if err := expectPlayResult(t, done); err != nil {
+		t.Fatal(err)
+	}
+	var expected []patternTransition
+	for i := time.Duration(0); i < 100; i++ {
+		expected = append(expected, patternTransition{i * 10 * time.Millisecond, i%2 == 0})
+	}
+	expectTransitions(t, gpio, start, expected...)
+}
+
+func Test_SequencerStopAndReplace(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	gpio := NewFakeNamedGPIO("LED", OUT, nil)
+	gpio.SetClock(clock)
+	defer gpio.Close()
+	s, err := NewSequencer(gpio, test_pattern_, SequencerWithClock(clock), SequencerWithIdle(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	gpio.EnableHistory(1000)
+	forever := startPlay(t, clock, func() <-chan error { return s.Play(0) })
+	advanceTimerByTimer(t, clock, 10*time.Second)
+	if !s.Playing() || len(gpio.History()) != 80 {
+		t.Fatalf("%d transitions in 10s of playing forever", len(gpio.History()))
+	}
+	advanceTimerByTimer(t, clock, 120*time.Millisecond)
+	// replaced in the low phase, the new pattern starts right away
+	start := clock.Now()
+	beep := startPlay(t, clock, func() <-chan error { return s.PlayPattern([]PatternStep{{false, 30 * time.Millisecond}}, 2) })
+	if err := expectPlayResult(t, forever); !errors.Is(err, ErrSequencerStopped) {
+		t.Errorf("replaced pattern ended with %v", err)
+	}
+	advanceSteps(t, clock, 30*time.Millisecond, 30*time.Millisecond)
+	if err := expectPlayResult(t, beep); err != nil {
+		t.Fatal(err)
+	}
+	if history := gpio.History(); len(history) != 82 || !history[81].State || history[81].Requested.Sub(start) != 60*time.Millisecond {
+		t.Errorf("not idle after the beep: %+v", history[79:])
+	}
+	done := startPlay(t, clock, func() <-chan error { return s.Play(0) })
+	advanceTimerByTimer(t, clock, time.Second)
+	s.Stop()
+	if err := expectPlayResult(t, done); !errors.Is(err, ErrSequencerStopped) || !GetStateOrPanic(gpio) || s.Playing() {
+		t.Errorf("after Stop: %v", err)
+	}
+}
+
+func Test_SequencerQueue(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	gpio := NewFakeNamedGPIO("LED", OUT, nil)
+	gpio.SetClock(clock)
+	defer gpio.Close()
+	s, err := NewSequencer(gpio, test_pattern_, SequencerWithClock(clock), SequencerWithOverlap(SEQUENCER_QUEUE))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	gpio.EnableHistory(1000)
+	start := clock.Now()
+	first := startPlay(t, clock, func() <-chan error { return s.Play(1) })
+	clock.Advance(20 * time.Millisecond)
+	second := s.PlayPattern([]PatternStep{{true, 5 * time.Millisecond}, {false, 5 * time.Millisecond}}, 1)
+	advanceSteps(t, clock, 80*time.Millisecond, 50*time.Millisecond, 10*time.Millisecond, 340*time.Millisecond,
+		5*time.Millisecond, 5*time.Millisecond)
+	if err := expectPlayResult(t, first); err != nil {
+		t.Fatal(err)
+	}
+	if err := expectPlayResult(t, second); err != nil {
+		t.Fatal(err)
+	}
+	expectTransitions(t, gpio, start, patternTransition{0, true}, patternTransition{100 * time.Millisecond, false},
+		patternTransition{150 * time.Millisecond, true}, patternTransition{160 * time.Millisecond, false},
+		patternTransition{500 * time.Millisecond, true}, patternTransition{505 * time.Millisecond, false})
+}
+
+func Test_SequencerErrors(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	gpio := NewFakeNamedGPIO("LED", OUT, nil)
+	gpio.SetClock(clock)
+	defer gpio.Close()
+	s, err := NewSequencer(gpio, test_pattern_, SequencerWithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	gpio.EnableHistory(1000)
+	failure := errors.New("gone")
+	gpio.FailNext("SetState", failure)
+	if err := expectPlayResult(t, s.Play(1)); !errors.Is(err, failure) {
+		t.Errorf("failed SetState: %v", err)
+	}
+	for _, pattern := range [][]PatternStep{nil, {{true, 0}}, {{true, -time.Millisecond}, {false, time.Second}}} {
+		if err := expectPlayResult(t, s.PlayPattern(pattern, 1)); err == nil {
+			t.Errorf("pattern %v accepted", pattern)
+		}
+	}
+	if err := expectPlayResult(t, s.Play(-1)); err == nil {
+		t.Error("playing -1 times accepted")
+	}
+	done := startPlay(t, clock, func() <-chan error { return s.Play(0) })
+	s.Close()
+	if err := expectPlayResult(t, done); !errors.Is(err, ErrSequencerStopped) {
+		t.Errorf("after Close: %v", err)
+	}
+	if err := expectPlayResult(t, s.Play(1)); err == nil {
+		t.Error("Play after Close accepted")
+	}
+	if _, err := NewSequencer(gpio, nil); err == nil {
+		t.Error("empty pattern accepted")
+	}
+}
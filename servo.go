@@ -0,0 +1,110 @@
+package bbhw
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Returned by Servo with ServoWithStrictRange for pulse widths or angles outside of the calibration,
+// and by HD44780 for cursor positions outside of the display
+var ErrOutOfRange = errors.New("out of range")
+
+// period of the usual 50Hz servo signal
+const servo_period_ = 20 * time.Millisecond
+
+// Option of NewServo
+type ServoOption func(*Servo)
+
+// pulse widths at the ends of the travel, default 1000µs and 2000µs. Many servos go further, see their datasheet.
+func ServoWithPulseRange(min, max time.Duration) ServoOption {
+	return func(s *Servo) { s.min, s.max = min, max }
+}
+
+// angle the travel from the min to the max pulse covers, default 180 degrees
+func ServoWithTravel(degrees float64) ServoOption {
+	return func(s *Servo) { s.travel = degrees }
+}
+
+// pulse widths and angles out of range fail with ErrOutOfRange instead of being clamped
+func ServoWithStrictRange() ServoOption {
+	return func(s *Servo) { s.strict = true }
+}
+
+// Hobby servo on a PWM (hardware or SoftPWM) with a 50Hz signal of calibrated pulse widths.
+type Servo struct {
+	pwm    PWMPin
+	min    time.Duration
+	max    time.Duration
+	travel float64
+	strict bool
+	lock   sync.Mutex // guards pulse
+	pulse  time.Duration
+}
+
+// Does not move the servo until the first SetPulseWidth or SetAngle.
+func NewServo(pwm PWMPin, opts ...ServoOption) (*Servo, error) {
+	if pwm == nil {
+		panic("pwm == nil")
+	}
+	s := &Servo{pwm: pwm, min: 1000 * time.Microsecond, max: 2000 * time.Microsecond, travel: 180}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.min <= 0 || s.max <= s.min || s.max >= servo_period_ {
+		return nil, fmt.Errorf("Servo: invalid pulse range %v to %v", s.min, s.max)
+	}
+	if !(s.travel > 0) || math.IsInf(s.travel, 1) {
+		return nil, fmt.Errorf("Servo: invalid travel of %v degrees", s.travel)
+	}
+	return s, nil
+}
+
+// Starts sending pulses of width d every 20ms (again, after Detach). d outside the pulse range is clamped,
+// unless ServoWithStrictRange.
+func (s *Servo) SetPulseWidth(d time.Duration) error {
+	if d < s.min || d > s.max {
+		if s.strict {
+			return fmt.Errorf("Servo: pulse width %v not within %v to %v: %w", d, s.min, s.max, ErrOutOfRange)
+		}
+		if d < s.min {
+			d = s.min
+		} else {
+			d = s.max
+		}
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.pwm.SetPWM(servo_period_, d)
+	s.pulse = d
+	return nil
+}
+
+// Moves to deg between 0 (min pulse) and the travel (max pulse), see SetPulseWidth
+func (s *Servo) SetAngle(deg float64) error {
+	if math.IsNaN(deg) {
+		return fmt.Errorf("Servo: angle NaN: %w", ErrOutOfRange)
+	}
+	if s.strict && (deg < 0 || deg > s.travel) {
+		return fmt.Errorf("Servo: angle %v not within 0 to %v: %w", deg, s.travel, ErrOutOfRange)
+	}
+	deg = math.Max(0, math.Min(s.travel, deg))
+	return s.SetPulseWidth(s.min + time.Duration(float64(s.max-s.min)*deg/s.travel))
+}
+
+// Width of the pulses sent, 0 before the first SetPulseWidth and after Detach
+func (s *Servo) PulseWidth() time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.pulse
+}
+
+// Stops the pulses entirely, most servos go limp instead of holding their position
+func (s *Servo) Detach() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.pwm.DisablePWM()
+	s.pulse = 0
+}
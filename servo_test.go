@@ -0,0 +1,78 @@
+package bbhw
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func Test_ServoAngles(t *testing.T) {
+	pwm := NewFakePWMOrPanic("P9_14")
+	s, err := NewServo(pwm, ServoWithPulseRange(500*time.Microsecond, 2500*time.Microsecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deg, want := range map[float64]time.Duration{0: 500 * time.Microsecond, 45: 1000 * time.Microsecond,
+		90: 1500 * time.Microsecond, 180: 2500 * time.Microsecond, -10: 500 * time.Microsecond, 200: 2500 * time.Microsecond} {
+		if err = s.SetAngle(deg); err != nil {
+			t.Fatal(err)
+		}
+		if period, duty := pwm.GetPWM(); period != 20*time.Millisecond || duty != want {
+			t.Errorf("SetAngle(%v) sends %v every %v, expected %v", deg, duty, period, want)
+		}
+	}
+	if err = s.SetPulseWidth(3 * time.Millisecond); err != nil || s.PulseWidth() != 2500*time.Microsecond {
+		t.Errorf("SetPulseWidth(3ms) sends %v, %v", s.PulseWidth(), err)
+	}
+	s.Detach()
+	if _, duty := pwm.GetPWM(); duty != 0 || s.PulseWidth() != 0 {
+		t.Errorf("pulses of %v after Detach", duty)
+	}
+}
+
+func Test_ServoStrictRange(t *testing.T) {
+	pwm := NewFakePWMOrPanic("P9_14")
+	s, err := NewServo(pwm, ServoWithStrictRange(), ServoWithTravel(90))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.SetAngle(30); err != nil || s.PulseWidth() != 1333333*time.Nanosecond {
+		t.Errorf("SetAngle(30) sends %v, %v", s.PulseWidth(), err)
+	}
+	for _, err = range []error{s.SetAngle(91), s.SetAngle(-1), s.SetPulseWidth(900 * time.Microsecond)} {
+		if !errors.Is(err, ErrOutOfRange) {
+			t.Errorf("out of range accepted: %v", err)
+		}
+	}
+	if s.PulseWidth() != 1333333*time.Nanosecond {
+		t.Errorf("pulse changed to %v by requests out of range", s.PulseWidth())
+	}
+	if _, err = NewServo(pwm, ServoWithPulseRange(2*time.Millisecond, time.Millisecond)); err == nil {
+		t.Error("inverted pulse range accepted")
+	}
+}
+
+func Test_ServoOnSoftPWM(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	gpio := NewFakeGPIO(1, OUT)
+	gpio.SetClock(clock)
+	gpio.EnableHistory(1000)
+	defer gpio.Close()
+	p, err := NewSoftPWM(gpio, SoftPWMWithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	s, err := NewServo(ToLegacyPWM(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	afterTimer(t, clock, func() { s.SetAngle(90) })
+	advanceTimerByTimer(t, clock, 100*time.Millisecond)
+	h := gpio.History()
+	if len(h) < 2 || gpio.TimeBetween(0, 1) != 1500*time.Microsecond {
+		t.Errorf("pulses %v", h)
+	}
+	s.Detach()
+	expectHeld(t, gpio, clock, false)
+}
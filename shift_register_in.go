@@ -0,0 +1,107 @@
+package bbhw
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Option of NewShiftRegisterIn
+type ShiftRegisterInOption func(*ShiftRegisterIn)
+
+// level of the clock between bits, default low
+func ShiftInWithClockIdle(level bool) ShiftRegisterInOption {
+	return func(r *ShiftRegisterIn) { r.idle = level }
+}
+
+// Edge of the clock data is read at, i.e. right before the GPIO makes it. Default RISING, right for the 74HC165
+// which shifts on rising edges and shows the first bit right after the load. Devices which shift on falling edges need FALLING.
+func ShiftInWithSampleEdge(edge Edge) ShiftRegisterInOption {
+	return func(r *ShiftRegisterIn) { r.sample = edge }
+}
+
+// Input expander of one or several chained 74HC165 (or compatible) parallel-in shift registers:
+// load (/PL, pulsed low to latch the inputs) and clock are outputs, data (Q7 of the first register) an input.
+type ShiftRegisterIn struct {
+	load, clock, data GPIOControllablePin
+	idle              bool
+	sample            Edge
+	lock              sync.Mutex // serializes reads
+}
+
+// Sets load high and clock to idle.
+func NewShiftRegisterIn(load, clock, data GPIOControllablePin, opts ...ShiftRegisterInOption) (*ShiftRegisterIn, error) {
+	if load == nil || clock == nil || data == nil {
+		panic("gpio == nil")
+	}
+	r := &ShiftRegisterIn{load: load, clock: clock, data: data, sample: RISING}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.sample != RISING && r.sample != FALLING {
+		return nil, fmt.Errorf("ShiftRegisterIn: sample edge %v is neither rising nor falling", r.sample)
+	}
+	for _, pin := range []GPIOControllablePin{load, clock} {
+		if err := checkOutput(pin, "ShiftRegisterIn"); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.clock.SetState(r.idle); err != nil {
+		return nil, err
+	}
+	return r, r.load.SetState(true)
+}
+
+// Reads the 8 inputs of a single register, D7 (shifted out first) is the MSB
+func (r *ShiftRegisterIn) ReadByte() (byte, error) {
+	bits, err := r.Read(8)
+	if err != nil {
+		return 0, err
+	}
+	var b byte
+	for _, bit := range bits {
+		b <<= 1
+		if bit {
+			b |= 1
+		}
+	}
+	return b, nil
+}
+
+// Latches all inputs and shifts out n bits, in the order they are read: for 74HC165 D7 to D0 of the register
+// connected to the data GPIO, then D7 to D0 of the next one in the chain.
+func (r *ShiftRegisterIn) Read(n int) ([]bool, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("ShiftRegisterIn: reading %d bits", n)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if err := r.load.SetState(false); err != nil {
+		return nil, fmt.Errorf("ShiftRegisterIn load: %w", err)
+	}
+	if err := r.load.SetState(true); err != nil {
+		return nil, fmt.Errorf("ShiftRegisterIn load: %w", err)
+	}
+	// the level the clock gets at each edge, and whether the data is read right before
+	active := !r.idle
+	sampleFirst := (r.sample == RISING) == active
+	bits := make([]bool, n)
+	for i := range bits {
+		var err error
+		if sampleFirst {
+			bits[i], err = r.data.GetState()
+		}
+		if err == nil {
+			err = r.clock.SetState(active)
+		}
+		if err == nil && !sampleFirst {
+			bits[i], err = r.data.GetState()
+		}
+		if err == nil {
+			err = r.clock.SetState(r.idle)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ShiftRegisterIn bit %d: %w", i, err)
+		}
+	}
+	return bits, nil
+}
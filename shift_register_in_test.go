@@ -0,0 +1,109 @@
+package bbhw
+
+import (
+	"errors"
+	"testing"
+)
+
+// model of a chain of 74HC165 on FakeGPIOs connected to the pins of a ShiftRegisterIn.
+// inputs are D7 to D0 of the first register, then of the next one; shifts on clock edges to shiftLevel.
+type fake165 struct {
+	inputs []bool
+	reg    []bool // reg[0] is on Q7 of the first register
+	q7     *FakeGPIO
+}
+
+func newFake165(t *testing.T, inputs []bool, shiftLevel bool) (chip *fake165, load, clock, data *FakeGPIO) {
+	chip = &fake165{inputs: inputs}
+	load, clock, data = NewFakeNamedGPIO("PL", OUT, nil), NewFakeNamedGPIO("CLK", OUT, nil), NewFakeNamedGPIO("Q7", IN, nil)
+	pl, clk := NewFakeNamedGPIO("PL_chip", IN, nil), NewFakeNamedGPIO("CLK_chip", IN, nil)
+	chip.q7 = NewFakeNamedGPIO("Q7_chip", OUT, nil)
+	load.ConnectTo(pl)
+	clock.ConnectTo(clk)
+	chip.q7.ConnectTo(data)
+	for _, gpio := range []*FakeGPIO{load, clock, data, pl, clk, chip.q7} {
+		t.Cleanup(gpio.Close)
+	}
+	pl.OnChange(func(high bool) {
+		if !high {
+			chip.reg = append([]bool(nil), chip.inputs...)
+			chip.q7.SetState(chip.reg[0])
+		}
+	})
+	clk.OnChange(func(level bool) {
+		// the load overrides the clock, the serial input of the last register is tied low
+		if level == shiftLevel && GetStateOrPanic(pl) && len(chip.reg) > 0 {
+			chip.reg = append(chip.reg[1:], false)
+			chip.q7.SetState(chip.reg[0])
+		}
+	})
+	return
+}
+
+func Test_ShiftRegisterInReadByte(t *testing.T) {
+	// D7 to D0
+	chip, load, clock, data := newFake165(t, []bool{true, false, true, true, false, false, true, false}, true)
+	r, err := NewShiftRegisterIn(load, clock, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if b, err := r.ReadByte(); err != nil || b != 0xb2 {
+			t.Errorf("ReadByte() = %#x, %v", b, err)
+		}
+	}
+	chip.inputs[7] = true
+	if b, _ := r.ReadByte(); b != 0xb3 {
+		t.Errorf("ReadByte() = %#x after D0 went high", b)
+	}
+}
+
+func Test_ShiftRegisterInChain(t *testing.T) {
+	inputs := make([]bool, 20)
+	for i := range inputs {
+		inputs[i] = i%4 == 1 || i == 19
+	}
+	for _, c := range []struct {
+		idle, shiftLevel bool
+		sample           Edge
+	}{
+		{false, true, RISING},   // 74HC165
+		{true, true, RISING},    // idling high, sampling before the shifting rising edge
+		{false, false, FALLING}, // a device shifting on falling edges
+		{true, false, FALLING},
+	} {
+		_, load, clock, data := newFake165(t, inputs, c.shiftLevel)
+		r, err := NewShiftRegisterIn(load, clock, data, ShiftInWithClockIdle(c.idle), ShiftInWithSampleEdge(c.sample))
+		if err != nil {
+			t.Fatal(err)
+		}
+		bits, err := r.Read(len(inputs))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range inputs {
+			if bits[i] != inputs[i] {
+				t.Errorf("%+v: read %v, expected %v", c, bits, inputs)
+				break
+			}
+		}
+		if GetStateOrPanic(clock) != c.idle || !GetStateOrPanic(load) {
+			t.Errorf("%+v: clock or load not idle", c)
+		}
+	}
+}
+
+func Test_ShiftRegisterInErrors(t *testing.T) {
+	_, load, clock, data := newFake165(t, make([]bool, 8), true)
+	if _, err := NewShiftRegisterIn(load, clock, data, ShiftInWithSampleEdge(BOTH)); err == nil {
+		t.Error("sample edge BOTH accepted")
+	}
+	if _, err := NewShiftRegisterIn(data, clock, load); !errors.Is(err, ErrInvalidDirection) {
+		t.Errorf("input as load: %v", err)
+	}
+	r, _ := NewShiftRegisterIn(load, clock, data)
+	data.FailNext("GetState", errors.New("gone"))
+	if _, err := r.ReadByte(); err == nil {
+		t.Error("GetState error not returned")
+	}
+}
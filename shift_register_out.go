@@ -0,0 +1,145 @@
+package bbhw
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Order bits are shifted out or in, see ShiftOutWithBitOrder
+type BitOrder int
+
+const (
+	MSB_FIRST BitOrder = iota // output Qn gets bit n, the usual wiring
+	LSB_FIRST                 // mirrored, for registers wired the other way round
+)
+
+func (o BitOrder) String() string {
+	switch o {
+	case MSB_FIRST:
+		return "MSB first"
+	case LSB_FIRST:
+		return "LSB first"
+	default:
+		return fmt.Sprintf("BitOrder(%d)", int(o))
+	}
+}
+
+// Option of NewShiftRegisterOut
+type ShiftRegisterOutOption func(*ShiftRegisterOut)
+
+// default is MSB_FIRST
+func ShiftOutWithBitOrder(order BitOrder) ShiftRegisterOutOption {
+	return func(r *ShiftRegisterOut) { r.order = order }
+}
+
+// clock idles high and shifts on falling edges of the GPIO, e.g. behind an inverting level shifter
+func ShiftOutWithInvertedClock() ShiftRegisterOutOption {
+	return func(r *ShiftRegisterOut) { r.idle = true }
+}
+
+// /OE of the register(s), driven low to enable the outputs. They are disabled until the first Write, see SetOutputEnable
+func ShiftOutWithOutputEnable(oe GPIOControllablePin) ShiftRegisterOutOption {
+	return func(r *ShiftRegisterOut) { r.oe = oe }
+}
+
+// Output expander of one or several chained 74HC595 (or compatible) shift registers on three output GPIOs:
+// serial data (SER), shift clock (SRCLK) and latch (RCLK). Each bit costs three SetStates,
+// so chains on MMappedGPIOs clock at MHz rates, on SysfsGPIOs at a few kHz.
+type ShiftRegisterOut struct {
+	data, clock, latch GPIOControllablePin
+	oe                 GPIOControllablePin
+	order              BitOrder
+	idle               bool       // level of clock between bits
+	lock               sync.Mutex // serializes writes
+	written            bool       // outputs enabled by the first Write
+}
+
+// data, clock and latch (and the output enable pin) have to be outputs. Sets clock and latch to idle.
+func NewShiftRegisterOut(data, clock, latch GPIOControllablePin, opts ...ShiftRegisterOutOption) (*ShiftRegisterOut, error) {
+	if data == nil || clock == nil || latch == nil {
+		panic("gpio == nil")
+	}
+	r := &ShiftRegisterOut{data: data, clock: clock, latch: latch}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.order != MSB_FIRST && r.order != LSB_FIRST {
+		return nil, fmt.Errorf("ShiftRegisterOut: invalid %v", r.order)
+	}
+	pins := []GPIOControllablePin{data, clock, latch}
+	if r.oe != nil {
+		pins = append(pins, r.oe)
+	}
+	for _, pin := range pins {
+		if err := checkOutput(pin, "ShiftRegisterOut"); err != nil {
+			return nil, err
+		}
+	}
+	if r.oe != nil {
+		if err := r.oe.SetState(true); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.clock.SetState(r.idle); err != nil {
+		return nil, err
+	}
+	return r, r.latch.SetState(false)
+}
+
+// Same as Write of the 8 bits of b, b&1 on output Q0 of a single register
+func (r *ShiftRegisterOut) WriteByte(b byte) error {
+	var bits [8]bool
+	for i := range bits {
+		bits[i] = b&(1<<i) != 0
+	}
+	return r.Write(bits[:])
+}
+
+// Shifts out bits and latches them at once. bits[i] ends up on output i of the chain, i.e. bits[0:8] on Q0 to Q7
+// of the register connected to the data GPIO, bits[8:16] on the next one (with LSB_FIRST mirrored, bits[0] on the last output).
+func (r *ShiftRegisterOut) Write(bits []bool) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for i := range bits {
+		bit := bits[i]
+		if r.order == MSB_FIRST {
+			bit = bits[len(bits)-1-i]
+		}
+		if err := r.data.SetState(bit); err != nil {
+			return fmt.Errorf("ShiftRegisterOut data: %w", err)
+		}
+		if err := r.pulse(r.clock, !r.idle); err != nil {
+			return fmt.Errorf("ShiftRegisterOut clock: %w", err)
+		}
+	}
+	if err := r.pulse(r.latch, true); err != nil {
+		return fmt.Errorf("ShiftRegisterOut latch: %w", err)
+	}
+	if r.oe != nil && !r.written {
+		if err := r.oe.SetState(false); err != nil {
+			return fmt.Errorf("ShiftRegisterOut output enable: %w", err)
+		}
+	}
+	r.written = true
+	return nil
+}
+
+// sets gpio to active and back
+func (r *ShiftRegisterOut) pulse(gpio GPIOControllablePin, active bool) error {
+	if err := gpio.SetState(active); err != nil {
+		return err
+	}
+	return gpio.SetState(!active)
+}
+
+// Switches the outputs on or off (tri-state) without changing what is latched.
+// Fails without ShiftOutWithOutputEnable.
+func (r *ShiftRegisterOut) SetOutputEnable(enabled bool) error {
+	if r.oe == nil {
+		return fmt.Errorf("ShiftRegisterOut without output enable pin")
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.written = true
+	return r.oe.SetState(!enabled)
+}
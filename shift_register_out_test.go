@@ -0,0 +1,123 @@
+package bbhw
+
+import "testing"
+
+// model of a chain of 74HC595 on FakeGPIO inputs connected to the pins of a ShiftRegisterOut
+type fake595 struct {
+	ser, srclk, rclk, oe *FakeGPIO
+	shift, outputs       []bool // index 0 is Q0 of the first register
+}
+
+func newFake595(t *testing.T, length int, invertedClock bool) (chip *fake595, data, clock, latch, oe *FakeGPIO) {
+	chip = &fake595{shift: make([]bool, length)}
+	pins := make([]*FakeGPIO, 4)
+	for i, name := range []string{"SER", "SRCLK", "RCLK", "OE"} {
+		pins[i] = NewFakeNamedGPIO(name, OUT, nil)
+		in := NewFakeNamedGPIO(name+"_chip", IN, nil)
+		pins[i].ConnectTo(in)
+		t.Cleanup(pins[i].Close)
+		t.Cleanup(in.Close)
+		switch name {
+		case "SER":
+			chip.ser = in
+		case "SRCLK":
+			chip.srclk = in
+		case "RCLK":
+			chip.rclk = in
+		case "OE":
+			chip.oe = in
+		}
+	}
+	chip.srclk.OnChange(func(high bool) {
+		if high != invertedClock {
+			// Q0 takes SER, every other stage its predecessor
+			copy(chip.shift[1:], chip.shift)
+			chip.shift[0] = GetStateOrPanic(chip.ser)
+		}
+	})
+	chip.rclk.OnChange(func(high bool) {
+		if high {
+			chip.outputs = append([]bool(nil), chip.shift...)
+		}
+	})
+	return chip, pins[0], pins[1], pins[2], pins[3]
+}
+
+func (chip *fake595) String() string {
+	s := ""
+	for _, q := range chip.outputs {
+		if q {
+			s += "1"
+		} else {
+			s += "0"
+		}
+	}
+	return s
+}
+
+func Test_ShiftRegisterOutWriteByte(t *testing.T) {
+	for _, order := range []BitOrder{MSB_FIRST, LSB_FIRST} {
+		chip, data, clock, latch, _ := newFake595(t, 8, false)
+		r, err := NewShiftRegisterOut(data, clock, latch, ShiftOutWithBitOrder(order))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = r.WriteByte(0x35); err != nil {
+			t.Fatal(err)
+		}
+		// Q0 first
+		want := map[BitOrder]string{MSB_FIRST: "10101100", LSB_FIRST: "00110101"}[order]
+		if chip.String() != want {
+			t.Errorf("%v: outputs %s, expected %s", order, chip, want)
+		}
+	}
+}
+
+func Test_ShiftRegisterOutChain(t *testing.T) {
+	chip, data, clock, latch, oe := newFake595(t, 24, true)
+	r, err := NewShiftRegisterOut(data, clock, latch, ShiftOutWithInvertedClock(), ShiftOutWithOutputEnable(oe))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !GetStateOrPanic(chip.oe) {
+		t.Error("outputs enabled before the first Write")
+	}
+	bits := make([]bool, 24)
+	for i := range bits {
+		bits[i] = i%3 == 0 || i == 23
+	}
+	for i := 0; i < 2; i++ {
+		if err = r.Write(bits); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := chip.String(), "100100100100100100100101"; got != want {
+			t.Errorf("outputs %s, expected %s", got, want)
+		}
+	}
+	if GetStateOrPanic(chip.oe) {
+		t.Error("outputs disabled after Write")
+	}
+	if err = r.SetOutputEnable(false); err != nil || !GetStateOrPanic(chip.oe) {
+		t.Errorf("SetOutputEnable(false): %v", err)
+	}
+	if err = r.Write(bits); err != nil || !GetStateOrPanic(chip.oe) {
+		t.Errorf("Write enabled the outputs again: %v", err)
+	}
+	if GetStateOrPanic(clock) != true || GetStateOrPanic(latch) != false {
+		t.Error("clock and latch not idle")
+	}
+}
+
+func Test_ShiftRegisterOutNeedsOutputs(t *testing.T) {
+	in := NewFakeGPIO(1, IN)
+	defer in.Close()
+	out := NewFakeGPIO(2, OUT)
+	defer out.Close()
+	if _, err := NewShiftRegisterOut(out, in, out); err == nil {
+		t.Error("input as clock accepted")
+	}
+	r, _ := NewShiftRegisterOut(out, out, out)
+	if err := r.SetOutputEnable(true); err == nil {
+		t.Error("SetOutputEnable without pin")
+	}
+}
@@ -0,0 +1,69 @@
+package bbhw
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Configuration and state of a pin at one point in time, e.g. for monitoring dumps. See GPIO.Snapshot
+type PinSnapshot struct {
+	Number      uint      `json:"number"`         // GPIO number, line offset for cdev
+	Chip        string    `json:"chip,omitempty"` // gpiochip of a cdev line
+	Name        string    `json:"name,omitempty"` // name of a FakeGPIO
+	Backend     string    `json:"backend"`
+	Direction   Direction `json:"direction"` // IN, OUT or -1 if unknown
+	Edge        string    `json:"edge,omitempty"`
+	ActiveLow   bool      `json:"active_low"`
+	Inverted    bool      `json:"logical_invert,omitempty"` // see SetLogicalInvert
+	State       bool      `json:"state"`
+	LastChange  time.Time `json:"last_change"`            // last observed change of State, zero if not tracked (mmapped, hybrid)
+	ConnectedTo []string  `json:"connected_to,omitempty"` // names of the pins a FakeGPIO is connected to
+	Error       string    `json:"error,omitempty"`        // first error reading the snapshot, fields after it may be missing
+}
+
+// Writes Direction as "in" or "out" and leaves out an unknown LastChange
+func (s PinSnapshot) MarshalJSON() ([]byte, error) {
+	type plain PinSnapshot
+	v := struct {
+		plain
+		Direction  string     `json:"direction,omitempty"`
+		LastChange *time.Time `json:"last_change,omitempty"`
+	}{plain: plain(s)}
+	switch s.Direction {
+	case IN:
+		v.Direction = "in"
+	case OUT:
+		v.Direction = "out"
+	}
+	if !s.LastChange.IsZero() {
+		v.LastChange = &s.LastChange
+	}
+	return json.Marshal(v)
+}
+
+func (s *PinSnapshot) setError(err error) {
+	if err != nil && s.Error == "" {
+		s.Error = err.Error()
+	}
+}
+
+// Snapshot of every pin, in the same order
+func SnapshotAll(gpios []GPIO) []PinSnapshot {
+	snapshots := make([]PinSnapshot, len(gpios))
+	for i, gpio := range gpios {
+		snapshots[i] = gpio.Snapshot()
+	}
+	return snapshots
+}
+
+// remembers when a state was last seen changing, for PinSnapshot.LastChange. Callers do the locking.
+type lastChange struct {
+	state bool
+	time  time.Time // zero until the first observation
+}
+
+func (c *lastChange) observe(state bool) {
+	if c.time.IsZero() || state != c.state {
+		c.state, c.time = state, time.Now()
+	}
+}
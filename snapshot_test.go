@@ -0,0 +1,75 @@
+package bbhw
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_FakeGPIOSnapshot(t *testing.T) {
+	out := NewFakeNamedGPIO("led", OUT, nil)
+	in := NewFakeNamedGPIO("sense", IN, nil)
+	out.ConnectTo(in)
+	before := time.Now()
+	out.SetState(true)
+	s := out.Snapshot()
+	if s.Name != "led" || s.Backend != BACKEND_FAKE || s.Direction != OUT || !s.State || len(s.ConnectedTo) != 1 || s.ConnectedTo[0] != "sense" {
+		t.Errorf("unexpected snapshot %+v", s)
+	}
+	if s.LastChange.Before(before) {
+		t.Error("LastChange not updated by SetState:", s.LastChange)
+	}
+	if s := in.Snapshot(); !s.State || s.LastChange.Before(before) {
+		t.Errorf("connected input did not follow: %+v", s)
+	}
+	changed := s.LastChange
+	out.SetState(true)
+	if out.Snapshot().LastChange != changed {
+		t.Error("setting the same state changed LastChange")
+	}
+}
+
+func Test_PinSnapshotJSON(t *testing.T) {
+	buf, err := json.Marshal(PinSnapshot{Number: 44, Backend: BACKEND_SYSFS, Direction: OUT, State: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if js := string(buf); !strings.Contains(js, `"direction":"out"`) || strings.Contains(js, "last_change") || !strings.Contains(js, `"number":44`) {
+		t.Error("unexpected JSON:", js)
+	}
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	buf, _ = json.Marshal(PinSnapshot{Direction: IN, LastChange: ts})
+	if js := string(buf); !strings.Contains(js, `"direction":"in"`) || !strings.Contains(js, `"last_change":"2020-01-02T03:04:05Z"`) {
+		t.Error("unexpected JSON:", js)
+	}
+}
+
+func Test_SnapshotAll(t *testing.T) {
+	useFakeSysfsGPIOTree(t, 44)
+	sysfs, err := NewSysfsGPIOWithOptions(44, WithAttach(), WithDirection(OUT), WithActiveLow(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sysfs.Close()
+	chip := NewFakeCdevChip(4)
+	cdev, err := chip.NewGPIO(2, IN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cdev.Close()
+	chip.InjectEdge(2, true)
+	snapshots := SnapshotAll([]GPIO{sysfs, cdev, NewFakeGPIO(3, IN)})
+	if len(snapshots) != 3 {
+		t.Fatal("expected 3 snapshots, got", len(snapshots))
+	}
+	if s := snapshots[0]; s.Number != 44 || s.Backend != BACKEND_SYSFS || s.Direction != OUT || !s.ActiveLow || s.Edge != "none" || s.Error != "" {
+		t.Errorf("sysfs snapshot %+v", s)
+	}
+	if s := snapshots[1]; s.Number != 2 || s.Chip != chip.name() || s.Backend != BACKEND_CDEV || s.Direction != IN || !s.State || s.LastChange.IsZero() {
+		t.Errorf("cdev snapshot %+v", s)
+	}
+	if s := snapshots[2]; s.Name != "FakeGPIO(3)" || s.Direction != IN {
+		t.Errorf("fake snapshot %+v", s)
+	}
+}
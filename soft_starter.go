@@ -0,0 +1,271 @@
+package bbhw
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// returned by SoftStarter.Start and Stop if a Stop or Fault took over before they were done
+var ErrSoftStarterInterrupted = errors.New("soft start interrupted")
+
+// Option of NewSoftStarter
+type SoftStarterOption func(*SoftStarter)
+
+// Waits d between driving the enable high and ramping up, e.g. for a motor driver to wake up. Default 0.
+func SoftStarterWithEnableDelay(d time.Duration) SoftStarterOption {
+	return func(s *SoftStarter) { s.enableDelay = d }
+}
+
+// Waits d between ramping down to duty 0 and dropping the enable, e.g. for a motor to come to a halt. Default 0.
+func SoftStarterWithDisableDelay(d time.Duration) SoftStarterOption {
+	return func(s *SoftStarter) { s.disableDelay = d }
+}
+
+// Durations of the ramp from 0 to the target of Start and of the ramp down of Stop, default 1s each
+func SoftStarterWithRamps(up, down time.Duration) SoftStarterOption {
+	return func(s *SoftStarter) { s.rampUp, s.rampDown = up, down }
+}
+
+// times the delays and ramps on c
+func SoftStarterWithClock(c Clock) SoftStarterOption {
+	return func(s *SoftStarter) { s.clock = c }
+}
+
+// Logs the transitions to l instead of the package Logger, see SetLogger
+func SoftStarterWithLogger(l Logger) SoftStarterOption {
+	return func(s *SoftStarter) { s.logger = l }
+}
+
+// Brings up and shuts down a motor driver with an enable input and a PWM input in order:
+// Start sets the PWM to duty 0, enables it, drives the enable high, waits and ramps up to the target.
+// Stop ramps down to 0, waits, drops the enable and disables the PWM. Fault drops the enable right away,
+// interrupting a ramp, and so does any error of the GPIO or the PWM. Each transition is logged at LOG_INFO,
+// faults at LOG_WARN or LOG_ERROR. The PWM has to have its frequency set already.
+type SoftStarter struct {
+	gpio         GPIOControllablePin
+	pwm          PWM
+	enableDelay  time.Duration
+	disableDelay time.Duration
+	rampUp       time.Duration
+	rampDown     time.Duration
+	clock        Clock
+	logger       Logger
+	ramp         pwmRamp
+	op           sync.Mutex // serializes Start and Stop
+	lock         sync.Mutex // guards everything below, held while writing the GPIO or PWM
+	running      bool       // enable high
+	duty         float64
+	interrupt    chan struct{} // closed and replaced by Stop and Fault taking over
+}
+
+// enable (an output) is driven low and pwm disabled right away
+func NewSoftStarter(enable GPIOControllablePin, pwm PWM, opts ...SoftStarterOption) (*SoftStarter, error) {
+	if enable == nil || pwm == nil {
+		panic("enable == nil or pwm == nil")
+	}
+	s := &SoftStarter{gpio: enable, pwm: pwm, rampUp: time.Second, rampDown: time.Second, interrupt: make(chan struct{})}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.clock == nil {
+		s.clock = defaultClock()
+	}
+	if s.enableDelay < 0 || s.disableDelay < 0 || s.rampUp < 0 || s.rampDown < 0 {
+		return nil, errors.New("SoftStarter: negative delay or ramp")
+	}
+	if err := checkOutput(enable, "SoftStarter"); err != nil {
+		return nil, err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.safe(); err != nil {
+		return nil, fmt.Errorf("SoftStarter: %w", err)
+	}
+	return s, nil
+}
+
+func (s *SoftStarter) log(level int, msg string, kv ...interface{}) {
+	loggerOr(s.logger).Log(level, "SoftStarter: "+msg, kv...)
+}
+
+// Brings the driver up and ramps to the target duty fraction, returns once it is reached.
+// If running already, ramps from the current duty to target.
+func (s *SoftStarter) Start(target float64) error {
+	if err := checkDutyFraction(target); err != nil {
+		return fmt.Errorf("SoftStarter: %w", err)
+	}
+	s.op.Lock()
+	defer s.op.Unlock()
+	s.lock.Lock()
+	interrupt, running := s.interrupt, s.running
+	if !running {
+		s.log(LOG_INFO, "starting", "target", target)
+		err := s.pwm.SetDutyFraction(0)
+		if err == nil {
+			err = s.pwm.Enable()
+		}
+		if err == nil {
+			err = s.gpio.SetState(true)
+		}
+		if err != nil {
+			err = s.fail(err)
+			s.lock.Unlock()
+			return err
+		}
+		s.running, s.duty = true, 0
+		s.log(LOG_INFO, "enable high")
+	}
+	s.lock.Unlock()
+	if !running {
+		select {
+		case <-interrupt:
+			return ErrSoftStarterInterrupted
+		case <-s.clock.After(s.enableDelay):
+		}
+	}
+	if err := s.rampTo(interrupt, target, s.rampUp); err != nil {
+		return err
+	}
+	s.log(LOG_INFO, "running", "duty", target)
+	return nil
+}
+
+// Ramps down, drops the enable and disables the PWM. Takes over from a Start still ramping up.
+func (s *SoftStarter) Stop() error {
+	s.lock.Lock()
+	interrupt := s.preempt()
+	s.lock.Unlock()
+	s.ramp.cancel()
+	s.op.Lock()
+	defer s.op.Unlock()
+	s.lock.Lock()
+	running := s.running
+	s.lock.Unlock()
+	if !running {
+		return nil
+	}
+	s.log(LOG_INFO, "stopping")
+	if err := s.rampTo(interrupt, 0, s.rampDown); err != nil {
+		return err
+	}
+	select {
+	case <-interrupt:
+		return ErrSoftStarterInterrupted
+	case <-s.clock.After(s.disableDelay):
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.interrupt != interrupt {
+		return ErrSoftStarterInterrupted
+	}
+	if err := s.safe(); err != nil {
+		return s.fail(err)
+	}
+	s.log(LOG_INFO, "stopped")
+	return nil
+}
+
+// Drops the enable immediately, then sets the PWM to duty 0 and disables it, interrupting a Start or Stop.
+// Returns the error of any of these, after trying all of them.
+func (s *SoftStarter) Fault() error {
+	s.lock.Lock()
+	s.preempt()
+	s.log(LOG_WARN, "fault, dropping enable")
+	err := s.safe()
+	if err != nil {
+		s.log(LOG_ERROR, "not in the safe state", "err", err)
+		err = fmt.Errorf("SoftStarter: %w", err)
+	}
+	s.lock.Unlock()
+	s.ramp.cancel()
+	return err
+}
+
+// Whether the enable is high, i.e. from Start until Stop or Fault
+func (s *SoftStarter) Running() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.running
+}
+
+// interrupts whatever waits on or ramps with the current interrupt and returns the new one, with lock held
+func (s *SoftStarter) preempt() chan struct{} {
+	close(s.interrupt)
+	s.interrupt = make(chan struct{})
+	return s.interrupt
+}
+
+// enable low, duty 0 and PWM disabled, trying all of them. With lock held.
+func (s *SoftStarter) safe() error {
+	err := s.gpio.SetState(false)
+	if err == nil {
+		s.running = false
+		s.log(LOG_INFO, "enable low")
+	}
+	if derr := s.pwm.SetDutyFraction(0); err == nil {
+		err = derr
+	}
+	if derr := s.pwm.Disable(); err == nil {
+		err = derr
+	}
+	if err == nil {
+		s.duty = 0
+		s.log(LOG_INFO, "PWM disabled")
+	}
+	return err
+}
+
+// the fault path for a failed write of Start or Stop, with lock held
+func (s *SoftStarter) fail(err error) error {
+	s.preempt()
+	s.log(LOG_ERROR, "failed, dropping enable", "err", err)
+	if serr := s.safe(); serr != nil {
+		s.log(LOG_ERROR, "not in the safe state", "err", serr)
+		return fmt.Errorf("SoftStarter: %w, the safe state failed too: %v", err, serr)
+	}
+	return fmt.Errorf("SoftStarter: %w", err)
+}
+
+func (s *SoftStarter) rampTo(interrupt chan struct{}, target float64, over time.Duration) error {
+	s.log(LOG_INFO, "ramping", "to", target, "over", over)
+	err := <-s.ramp.rampTo(softStarterDuty{s, interrupt}, s.clock, target, over, nil)
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, ErrRampCancelled) || errors.Is(err, ErrSoftStarterInterrupted) {
+		return ErrSoftStarterInterrupted
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.interrupt != interrupt {
+		return ErrSoftStarterInterrupted
+	}
+	return s.fail(err)
+}
+
+// What the ramps of a SoftStarter set: its PWM, unless a Stop or Fault took over
+type softStarterDuty struct {
+	s         *SoftStarter
+	interrupt chan struct{}
+}
+
+func (d softStarterDuty) SetDutyFraction(fraction float64) error {
+	d.s.lock.Lock()
+	defer d.s.lock.Unlock()
+	if d.s.interrupt != d.interrupt {
+		return ErrSoftStarterInterrupted
+	}
+	if err := d.s.pwm.SetDutyFraction(fraction); err != nil {
+		return err
+	}
+	d.s.duty = fraction
+	return nil
+}
+
+func (d softStarterDuty) GetDutyFraction() (float64, error) {
+	d.s.lock.Lock()
+	defer d.s.lock.Unlock()
+	return d.s.duty, nil
+}
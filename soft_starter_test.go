@@ -0,0 +1,216 @@
+package bbhw
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the log lines of the SoftStarter, the FakeGPIO and the FakePWM in order, shortened to e.g. "EN true",
+// "MOTOR Enable" and "enable high". Repeated lines (ramp steps) are listed once.
+func softStarterSteps(logger *recordingLogger) []string {
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+	var steps []string
+	for _, line := range logger.lines {
+		var step string
+		if i := strings.Index(line, "FakeGPIO: set to virtual electrical state >"); i >= 0 {
+			step = "EN " + strings.SplitN(line[i+len("FakeGPIO: set to virtual electrical state >"):], "<", 2)[0]
+		} else if i := strings.Index(line, "FakePWM: "); i >= 0 {
+			step = "MOTOR " + strings.SplitN(line[i+len("FakePWM: "):], " ", 2)[0]
+		} else if i := strings.Index(line, "SoftStarter: "); i >= 0 {
+			step = strings.SplitN(line[i+len("SoftStarter: "):], " [", 2)[0]
+		} else {
+			continue
+		}
+		if len(steps) == 0 || steps[len(steps)-1] != step {
+			steps = append(steps, step)
+		}
+	}
+	return steps
+}
+
+func expectSoftStarterSteps(t *testing.T, logger *recordingLogger, expected ...string) {
+	t.Helper()
+	if steps := softStarterSteps(logger); strings.Join(steps, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("steps\n  %s\nexpected\n  %s", strings.Join(steps, "\n  "), strings.Join(expected, "\n  "))
+	}
+}
+
+// runs fn on a goroutine, waiting for it to wait on the clock
+func goSoftStarter(t *testing.T, clock *ManualClock, fn func() error) <-chan error {
+	t.Helper()
+	done := make(chan error, 1)
+	afterTimer(t, clock, func() { go func() { done <- fn() }() })
+	return done
+}
+
+func Test_SoftStarterStartStop(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	logger := new(recordingLogger)
+	gpio := NewFakeNamedGPIO("EN", OUT, nil)
+	gpio.SetClock(clock)
+	gpio.SetLogger(logger)
+	defer gpio.Close()
+	pwm := NewFakeNamedPWM("MOTOR")
+	pwm.SetClock(clock)
+	pwm.SetLogger(logger)
+	defer pwm.Close()
+	pwm.SetFrequency(20000)
+	s, err := NewSoftStarter(gpio, pwm, SoftStarterWithEnableDelay(20*time.Millisecond), SoftStarterWithDisableDelay(10*time.Millisecond),
+		SoftStarterWithRamps(50*time.Millisecond, 30*time.Millisecond), SoftStarterWithClock(clock), SoftStarterWithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only what follows the construction
+	logger.lock.Lock()
+	logger.lines = nil
+	logger.lock.Unlock()
+	gpio.EnableHistory(100)
+	pwm.EnableHistory(100)
+	start := clock.Now()
+	started := goSoftStarter(t, clock, func() error { return s.Start(0.8) })
+	afterTimer(t, clock, func() { clock.Advance(20 * time.Millisecond) })
+	clock.Advance(50 * time.Millisecond)
+	if err := expectPlayResult(t, started); err != nil {
+		t.Fatal(err)
+	}
+	pwm.AssertDutyNear(t, 0.8, 1e-9)
+	if !s.Running() || !GetStateOrPanic(gpio) {
+		t.Fatal("not running")
+	}
+	// the ramp starts after the enable delay and ends 50ms later
+	history := pwm.History()
+	if at := history[len(history)-1].Time.Sub(start); at != 70*time.Millisecond {
+		t.Errorf("ramp up done after %v", at)
+	}
+	stopped := goSoftStarter(t, clock, s.Stop)
+	afterTimer(t, clock, func() { clock.Advance(30 * time.Millisecond) })
+	clock.Advance(10 * time.Millisecond)
+	if err := expectPlayResult(t, stopped); err != nil {
+		t.Fatal(err)
+	}
+	if gh := gpio.History(); len(gh) != 2 || gh[1].State || gh[1].Requested.Sub(start) != 110*time.Millisecond {
+		t.Errorf("enable history %+v", gh)
+	}
+	if _, _, enabled := pwm.Output(); enabled || s.Running() {
+		t.Error("PWM enabled after Stop")
+	}
+	expectSoftStarterSteps(t, logger,
+		"starting", "MOTOR SetDutyFraction", "MOTOR Enable", "EN true", "enable high",
+		"ramping", "MOTOR SetDutyFraction", "running",
+		"stopping", "ramping", "MOTOR SetDutyFraction",
+		"EN false", "enable low", "MOTOR SetDutyFraction", "MOTOR Disable", "PWM disabled", "stopped")
+	if err := s.Stop(); err != nil {
+		t.Error("Stop while stopped:", err)
+	}
+}
+
+func Test_SoftStarterFaultDuringRamp(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	logger := new(recordingLogger)
+	gpio := NewFakeNamedGPIO("EN", OUT, nil)
+	gpio.SetClock(clock)
+	gpio.SetLogger(logger)
+	defer gpio.Close()
+	pwm := NewFakeNamedPWM("MOTOR")
+	pwm.SetClock(clock)
+	pwm.SetLogger(logger)
+	defer pwm.Close()
+	pwm.SetFrequency(20000)
+	s, err := NewSoftStarter(gpio, pwm, SoftStarterWithEnableDelay(20*time.Millisecond), SoftStarterWithDisableDelay(10*time.Millisecond),
+		SoftStarterWithRamps(50*time.Millisecond, 30*time.Millisecond), SoftStarterWithClock(clock), SoftStarterWithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only what follows the construction
+	logger.lock.Lock()
+	logger.lines = nil
+	logger.lock.Unlock()
+	gpio.EnableHistory(100)
+	pwm.EnableHistory(100)
+	started := goSoftStarter(t, clock, func() error { return s.Start(1) })
+	afterTimer(t, clock, func() { clock.Advance(20 * time.Millisecond) })
+	afterTimer(t, clock, func() { clock.Advance(10 * time.Millisecond) })
+	afterTimer(t, clock, func() { clock.Advance(10 * time.Millisecond) })
+	pwm.AssertDutyNear(t, 0.4, 1e-9)
+	if err := s.Fault(); err != nil {
+		t.Fatal(err)
+	}
+	if err := expectPlayResult(t, started); !errors.Is(err, ErrSoftStarterInterrupted) {
+		t.Errorf("Start interrupted by Fault: %v", err)
+	}
+	clock.Advance(time.Second)
+	if _, _, enabled := pwm.Output(); enabled || GetStateOrPanic(gpio) || s.Running() {
+		t.Error("not in the safe state after Fault")
+	}
+	expectSoftStarterSteps(t, logger,
+		"starting", "MOTOR SetDutyFraction", "MOTOR Enable", "EN true", "enable high",
+		"ramping", "MOTOR SetDutyFraction",
+		"fault, dropping enable", "EN false", "enable low", "MOTOR SetDutyFraction", "MOTOR Disable", "PWM disabled")
+
+	// Stop takes over from a Start in its enable delay
+	started = goSoftStarter(t, clock, func() error { return s.Start(1) })
+	stopped := goSoftStarter(t, clock, s.Stop)
+	if err := expectPlayResult(t, started); !errors.Is(err, ErrSoftStarterInterrupted) {
+		t.Errorf("Start interrupted by Stop: %v", err)
+	}
+	afterTimer(t, clock, func() { clock.Advance(30 * time.Millisecond) })
+	clock.Advance(10 * time.Millisecond)
+	if err := expectPlayResult(t, stopped); err != nil || GetStateOrPanic(gpio) {
+		t.Errorf("Stop: %v", err)
+	}
+}
+
+func Test_SoftStarterErrors(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	logger := new(recordingLogger)
+	gpio := NewFakeNamedGPIO("EN", OUT, nil)
+	gpio.SetClock(clock)
+	gpio.SetLogger(logger)
+	defer gpio.Close()
+	pwm := NewFakeNamedPWM("MOTOR")
+	pwm.SetClock(clock)
+	pwm.SetLogger(logger)
+	defer pwm.Close()
+	pwm.SetFrequency(20000)
+	s, err := NewSoftStarter(gpio, pwm, SoftStarterWithEnableDelay(20*time.Millisecond), SoftStarterWithDisableDelay(10*time.Millisecond),
+		SoftStarterWithRamps(50*time.Millisecond, 30*time.Millisecond), SoftStarterWithClock(clock), SoftStarterWithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gpio.EnableHistory(100)
+	pwm.EnableHistory(100)
+	failure := errors.New("write error")
+	// a failing ramp step drops the enable
+	started := goSoftStarter(t, clock, func() error { return s.Start(0.5) })
+	afterTimer(t, clock, func() { clock.Advance(20 * time.Millisecond) })
+	pwm.FailNext("SetDutyFraction", failure)
+	clock.Advance(10 * time.Millisecond)
+	if err := expectPlayResult(t, started); !errors.Is(err, failure) {
+		t.Errorf("failing ramp: %v", err)
+	}
+	if _, _, enabled := pwm.Output(); enabled || GetStateOrPanic(gpio) {
+		t.Error("not in the safe state after the failure")
+	}
+	// the enable failing leaves the PWM disabled
+	gpio.FailNext("SetState", failure)
+	if err := s.Start(0.5); !errors.Is(err, failure) || s.Running() {
+		t.Errorf("failing enable: %v", err)
+	}
+	if _, _, enabled := pwm.Output(); enabled {
+		t.Error("PWM enabled after the failing enable")
+	}
+	if err := s.Start(1.5); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("Start(1.5): %v", err)
+	}
+	if _, err := NewSoftStarter(gpio, pwm, SoftStarterWithRamps(-time.Second, 0)); err == nil {
+		t.Error("negative ramp accepted")
+	}
+	in := NewFakeNamedGPIO("IN", IN, nil)
+	defer in.Close()
+	if _, err := NewSoftStarter(in, pwm); !errors.Is(err, ErrInvalidDirection) {
+		t.Errorf("input as enable: %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+package bbhw
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Clock polarity (bit 1) and phase (bit 0) of a SPI bus, as usual numbered 0 to 3
+type SPIMode int
+
+const (
+	SPI_MODE0 SPIMode = iota // clock idles low, data sampled on the rising edge
+	SPI_MODE1                // clock idles low, data sampled on the falling edge
+	SPI_MODE2                // clock idles high, data sampled on the falling edge
+	SPI_MODE3                // clock idles high, data sampled on the rising edge
+)
+
+// Option of NewBitbangSPI
+type BitbangSPIOption func(*BitbangSPI)
+
+// default is SPI_MODE0
+func SPIWithMode(mode SPIMode) BitbangSPIOption {
+	return func(s *BitbangSPI) { s.mode = mode }
+}
+
+// default is MSB_FIRST, the bit 7 of each byte is sent first
+func SPIWithBitOrder(order BitOrder) BitbangSPIOption {
+	return func(s *BitbangSPI) { s.order = order }
+}
+
+// Waits d after every clock edge, to slow the bus down for long wires or slow devices. Best effort:
+// the pause is at least d, but may be a lot longer. Default is no delay, as fast as the GPIOs toggle.
+func SPIWithClockDelay(d time.Duration) BitbangSPIOption {
+	return func(s *BitbangSPI) { s.delay = d }
+}
+
+// SPI master on GPIOs, for boards whose hardware SPI pins are taken.
+// Several devices can share the bus, each with its own chip select (active low).
+type BitbangSPI struct {
+	sclk, mosi, miso GPIOControllablePin
+	cs               []GPIOControllablePin
+	mode             SPIMode
+	order            BitOrder
+	delay            time.Duration
+	lock             sync.Mutex // one transfer at a time
+}
+
+// sclk, mosi and the chip selects have to be outputs, miso an input. Either mosi (read-only devices like the MAX31855)
+// or miso (write-only devices like shift registers or displays) may be nil. Without any chip select the only device
+// is always selected. Deselects all devices, then sets the clock to idle.
+func NewBitbangSPI(sclk, mosi, miso GPIOControllablePin, cs []GPIOControllablePin, opts ...BitbangSPIOption) (*BitbangSPI, error) {
+	if sclk == nil || (mosi == nil && miso == nil) {
+		panic("gpio == nil")
+	}
+	s := &BitbangSPI{sclk: sclk, mosi: mosi, miso: miso, cs: cs}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.mode < SPI_MODE0 || s.mode > SPI_MODE3 {
+		return nil, fmt.Errorf("BitbangSPI: invalid mode %d", int(s.mode))
+	}
+	if s.order != MSB_FIRST && s.order != LSB_FIRST {
+		return nil, fmt.Errorf("BitbangSPI: invalid %v", s.order)
+	}
+	outputs := append([]GPIOControllablePin{sclk}, cs...)
+	if mosi != nil {
+		outputs = append(outputs, mosi)
+	}
+	for _, pin := range outputs {
+		if pin == nil {
+			panic("gpio == nil")
+		}
+		if err := checkOutput(pin, "BitbangSPI"); err != nil {
+			return nil, err
+		}
+	}
+	for _, pin := range cs {
+		if err := pin.SetState(true); err != nil {
+			return nil, err
+		}
+	}
+	return s, sclk.SetState(s.idle())
+}
+
+func (s *BitbangSPI) idle() bool { return s.mode&2 != 0 }
+
+// Same as TransferDevice(0, tx)
+func (s *BitbangSPI) Transfer(tx []byte) (rx []byte, err error) {
+	return s.TransferDevice(0, tx)
+}
+
+// Selects the device with the chip select cs[device] of NewBitbangSPI, sends tx while receiving as many bytes,
+// then deselects it. Without MOSI tx only gives the number of bytes to receive, without MISO rx is all zeros.
+func (s *BitbangSPI) TransferDevice(device int, tx []byte) (rx []byte, err error) {
+	if device < 0 || (device > 0 && device >= len(s.cs)) {
+		return nil, fmt.Errorf("BitbangSPI: no device %d, chip selects for %d", device, len(s.cs))
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var cs GPIOControllablePin
+	if len(s.cs) > 0 {
+		cs = s.cs[device]
+		if err = cs.SetState(false); err != nil {
+			return nil, fmt.Errorf("BitbangSPI chip select: %w", err)
+		}
+		s.pause()
+	}
+	rx = make([]byte, len(tx))
+	for i, b := range tx {
+		if rx[i], err = s.transferByte(b); err != nil {
+			break
+		}
+	}
+	if cs != nil {
+		if cserr := cs.SetState(true); err == nil && cserr != nil {
+			err = fmt.Errorf("BitbangSPI chip select: %w", cserr)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rx, nil
+}
+
+func (s *BitbangSPI) transferByte(tx byte) (rx byte, err error) {
+	idle := s.idle()
+	cpha := s.mode&1 != 0
+	for i := 0; i < 8; i++ {
+		bit := uint(7 - i)
+		if s.order == LSB_FIRST {
+			bit = uint(i)
+		}
+		out := tx&(1<<bit) != 0
+		var in bool
+		// CPHA 0: data out before the leading edge, sampled on it; CPHA 1: out on the leading edge, sampled on the trailing one
+		if !cpha {
+			err = s.setMOSI(out)
+		}
+		if err == nil {
+			err = s.edge(!idle)
+		}
+		if err == nil && cpha {
+			err = s.setMOSI(out)
+		}
+		if err == nil && !cpha {
+			in, err = s.getMISO()
+		}
+		if err == nil {
+			err = s.edge(idle)
+		}
+		if err == nil && cpha {
+			in, err = s.getMISO()
+		}
+		if err != nil {
+			return 0, err
+		}
+		if in {
+			rx |= 1 << bit
+		}
+	}
+	return rx, nil
+}
+
+func (s *BitbangSPI) edge(level bool) error {
+	if err := s.sclk.SetState(level); err != nil {
+		return fmt.Errorf("BitbangSPI SCLK: %w", err)
+	}
+	s.pause()
+	return nil
+}
+
+func (s *BitbangSPI) setMOSI(level bool) error {
+	if s.mosi == nil {
+		return nil
+	}
+	if err := s.mosi.SetState(level); err != nil {
+		return fmt.Errorf("BitbangSPI MOSI: %w", err)
+	}
+	return nil
+}
+
+func (s *BitbangSPI) getMISO() (bool, error) {
+	if s.miso == nil {
+		return false, nil
+	}
+	level, err := s.miso.GetState()
+	if err != nil {
+		return false, fmt.Errorf("BitbangSPI MISO: %w", err)
+	}
+	return level, nil
+}
+
+func (s *BitbangSPI) pause() {
+	if s.delay > 0 {
+		time.Sleep(s.delay)
+	}
+}
@@ -0,0 +1,167 @@
+package bbhw
+
+import (
+	"bytes"
+	"testing"
+)
+
+// model of a SPI device on FakeGPIOs, answering with reply and recording what it received
+type fakeSPIDevice struct {
+	mode       SPIMode
+	order      BitOrder
+	reply, got []byte
+	out, in    int // bits shifted out and in since the chip select
+	mosi, miso *FakeGPIO
+}
+
+func (d *fakeSPIDevice) mask(bit int) byte {
+	if d.order == LSB_FIRST {
+		return 1 << uint(bit%8)
+	}
+	return 1 << uint(7-bit%8)
+}
+
+func (d *fakeSPIDevice) shiftOut() {
+	var b byte
+	if d.out/8 < len(d.reply) {
+		b = d.reply[d.out/8]
+	}
+	d.miso.SetState(b&d.mask(d.out) != 0)
+	d.out++
+}
+
+func (d *fakeSPIDevice) shiftIn() {
+	if d.in%8 == 0 {
+		d.got = append(d.got, 0)
+	}
+	if GetStateOrPanic(d.mosi) {
+		d.got[len(d.got)-1] |= d.mask(d.in)
+	}
+	d.in++
+}
+
+type fakeSPIBus struct {
+	sclk, mosi, miso *FakeGPIO
+	cs               []GPIOControllablePin
+	devices          []*fakeSPIDevice
+}
+
+// n devices sharing SCLK, MOSI and MISO (which only the selected device drives)
+func newFakeSPIBus(t *testing.T, mode SPIMode, order BitOrder, n int) *fakeSPIBus {
+	bus := &fakeSPIBus{sclk: NewFakeNamedGPIO("SCLK", OUT, nil), mosi: NewFakeNamedGPIO("MOSI", OUT, nil), miso: NewFakeNamedGPIO("MISO", IN, nil)}
+	misonet := NewFakeNet("MISO")
+	misonet.SetPull(PULLDOWN)
+	misonet.Attach(bus.miso)
+	var sclks, mosis []*FakeGPIO
+	cleanup := []*FakeGPIO{bus.sclk, bus.mosi, bus.miso}
+	for i := 0; i < n; i++ {
+		d := &fakeSPIDevice{mode: mode, order: order, mosi: NewFakeNamedGPIO("MOSI_dev", IN, nil), miso: NewFakeNamedGPIO("MISO_dev", IN, nil)}
+		misonet.Attach(d.miso)
+		cs, cspin, sclk := NewFakeNamedGPIO("CS", OUT, nil), NewFakeNamedGPIO("CS_dev", IN, nil), NewFakeNamedGPIO("SCLK_dev", IN, nil)
+		cs.ConnectTo(cspin)
+		bus.cs = append(bus.cs, cs)
+		bus.devices = append(bus.devices, d)
+		sclks, mosis = append(sclks, sclk), append(mosis, d.mosi)
+		cleanup = append(cleanup, d.mosi, d.miso, cs, cspin, sclk)
+		idle := mode&2 != 0
+		cpha := mode&1 != 0
+		cspin.OnChange(func(high bool) {
+			if high {
+				d.miso.SetDirection(IN)
+				return
+			}
+			d.out, d.in = 0, 0
+			d.miso.SetDirection(OUT)
+			if !cpha {
+				d.shiftOut()
+			}
+		})
+		sclk.OnChange(func(level bool) {
+			if GetStateOrPanic(cspin) {
+				return
+			}
+			// CPHA 0 samples on the leading edge and shifts out on the trailing one, CPHA 1 the other way round
+			if leading := level != idle; leading != cpha {
+				d.shiftIn()
+			} else {
+				d.shiftOut()
+			}
+		})
+	}
+	bus.sclk.ConnectTo(sclks...)
+	bus.mosi.ConnectTo(mosis...)
+	for _, gpio := range cleanup {
+		t.Cleanup(gpio.Close)
+	}
+	return bus
+}
+
+func Test_BitbangSPIModes(t *testing.T) {
+	tx := []byte{0x81, 0x3c, 0x00, 0xf5}
+	for _, order := range []BitOrder{MSB_FIRST, LSB_FIRST} {
+		for mode := SPI_MODE0; mode <= SPI_MODE3; mode++ {
+			bus := newFakeSPIBus(t, mode, order, 1)
+			bus.devices[0].reply = []byte{0xde, 0xad, 0xbe, 0xef}
+			spi, err := NewBitbangSPI(bus.sclk, bus.mosi, bus.miso, bus.cs, SPIWithMode(mode), SPIWithBitOrder(order))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rx, err := spi.Transfer(tx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(rx, bus.devices[0].reply) || !bytes.Equal(bus.devices[0].got, tx) {
+				t.Errorf("mode %d %v: received %x, device got %x", mode, order, rx, bus.devices[0].got)
+			}
+			if GetStateOrPanic(bus.sclk) != (mode&2 != 0) || !GetStateOrPanic(bus.cs[0]) {
+				t.Errorf("mode %d: clock or chip select not idle", mode)
+			}
+		}
+	}
+}
+
+func Test_BitbangSPISeveralDevices(t *testing.T) {
+	bus := newFakeSPIBus(t, SPI_MODE0, MSB_FIRST, 2)
+	bus.devices[0].reply = []byte{0x11, 0x22}
+	bus.devices[1].reply = []byte{0x33, 0x44}
+	spi, err := NewBitbangSPI(bus.sclk, bus.mosi, bus.miso, bus.cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for device, want := range [][]byte{{0x11, 0x22}, {0x33, 0x44}} {
+		if rx, err := spi.TransferDevice(device, []byte{byte(device), 0xff}); err != nil || !bytes.Equal(rx, want) {
+			t.Errorf("device %d answered %x, %v", device, rx, err)
+		}
+	}
+	if !bytes.Equal(bus.devices[1].got, []byte{1, 0xff}) {
+		t.Errorf("device 1 got %x", bus.devices[1].got)
+	}
+	if _, err = spi.TransferDevice(2, []byte{0}); err == nil {
+		t.Error("transfer to a device without chip select")
+	}
+}
+
+func Test_BitbangSPIReadOnlyWriteOnly(t *testing.T) {
+	// like a MAX31855, which only talks
+	bus := newFakeSPIBus(t, SPI_MODE0, MSB_FIRST, 1)
+	bus.devices[0].reply = []byte{0x01, 0x90, 0x1c, 0xa0}
+	spi, err := NewBitbangSPI(bus.sclk, nil, bus.miso, bus.cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rx, err := spi.Transfer(make([]byte, 4)); err != nil || !bytes.Equal(rx, bus.devices[0].reply) {
+		t.Errorf("read %x, %v", rx, err)
+	}
+
+	bus = newFakeSPIBus(t, SPI_MODE3, MSB_FIRST, 1)
+	spi, err = NewBitbangSPI(bus.sclk, bus.mosi, nil, bus.cs, SPIWithMode(SPI_MODE3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rx, err := spi.Transfer([]byte{0xa5, 0x5a}); err != nil || !bytes.Equal(rx, []byte{0, 0}) || !bytes.Equal(bus.devices[0].got, []byte{0xa5, 0x5a}) {
+		t.Errorf("write: rx %x, device got %x, %v", rx, bus.devices[0].got, err)
+	}
+	if _, err = NewBitbangSPI(bus.sclk, bus.mosi, nil, nil, SPIWithMode(4)); err == nil {
+		t.Error("mode 4 accepted")
+	}
+}
@@ -0,0 +1,310 @@
+package bbhw
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Ends a move of StepDirMotor if a step pulse was due longer than StepperWithTolerance ago,
+// i.e. the GPIO (or the machine) is too slow for the rate. The pulses until then were given, Position counts them.
+var ErrStepperLate = errors.New("step pulses late")
+
+// Ends a move of StepDirMotor which Stop decelerated before its end
+var ErrStepperStopped = errors.New("move stopped")
+
+// Option of NewStepDirMotor
+type StepDirMotorOption func(*StepDirMotor)
+
+// /EN of the driver, driven low to enable it (A4988, DRV8825, TMC2208). Disabled until the first MoveSteps, see Disable
+func StepperWithEnable(en GPIOControllablePin) StepDirMotorOption {
+	return func(m *StepDirMotor) { m.enable = en }
+}
+
+// how long the step pulse is high, and DIR stable before the first one. Default 2µs, the DRV8825 needs 1.9µs.
+func StepperWithPulseWidth(d time.Duration) StepDirMotorOption {
+	return func(m *StepDirMotor) { m.pulse = d }
+}
+
+// how late a step pulse may be before the move fails with ErrStepperLate, default 1ms
+func StepperWithTolerance(d time.Duration) StepDirMotorOption {
+	return func(m *StepDirMotor) { m.tolerance = d }
+}
+
+// DIR low for positive steps, for motors wired the other way round
+func StepperWithInvertedDirection() StepDirMotorOption {
+	return func(m *StepDirMotor) { m.inverted = true }
+}
+
+// times the step pulses on c
+func StepperWithClock(c Clock) StepDirMotorOption {
+	return func(m *StepDirMotor) { m.clock = c }
+}
+
+// Stepper motor behind a step/direction driver (A4988, DRV8825, TMC2208, ...) on two output GPIOs.
+// Moves ramp up and down with a constant acceleration (trapezoidal profile), pulses are scheduled at absolute times
+// from a goroutine. MMappedGPIOs manage several kHz, SysfsGPIOs a few hundred Hz, beyond ErrStepperLate ends the move.
+type StepDirMotor struct {
+	position  int64 // atomic, first for the 64 bit alignment on ARM
+	step, dir GPIOControllablePin
+	enable    GPIOControllablePin
+	pulse     time.Duration
+	tolerance time.Duration
+	inverted  bool
+	clock     Clock
+	lock      sync.Mutex    // guards everything below
+	stop      chan struct{} // nil while not moving
+	done      chan struct{}
+	enabled   bool
+}
+
+// step, dir and the enable pin have to be outputs. Sets step low.
+func NewStepDirMotor(step, dir GPIOControllablePin, opts ...StepDirMotorOption) (*StepDirMotor, error) {
+	if step == nil || dir == nil {
+		panic("gpio == nil")
+	}
+	m := &StepDirMotor{step: step, dir: dir, pulse: 2 * time.Microsecond, tolerance: time.Millisecond}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.clock == nil {
+		m.clock = defaultClock()
+	}
+	pins := []GPIOControllablePin{step, dir}
+	if m.enable != nil {
+		pins = append(pins, m.enable)
+	}
+	for _, pin := range pins {
+		if err := checkOutput(pin, "StepDirMotor"); err != nil {
+			return nil, err
+		}
+	}
+	if m.enable != nil {
+		if err := m.enable.SetState(true); err != nil {
+			return nil, err
+		}
+	}
+	return m, step.SetState(false)
+}
+
+// Starts a move of n steps (negative ones backwards), accelerating by accel steps/s² up to maxRate steps/s and
+// decelerating to arrive at rest. accel 0 steps at maxRate right away. done receives nil at the end of the move,
+// ErrStepperStopped after Stop or the error which ended it, then closes. Fails if the motor is still moving.
+func (m *StepDirMotor) MoveSteps(n int, maxRate, accel float64) (done <-chan error) {
+	result := make(chan error, 1)
+	finish := func(err error) <-chan error {
+		result <- err
+		close(result)
+		return result
+	}
+	if !(maxRate > 0) || math.IsInf(maxRate, 1) || !(accel >= 0) || math.IsInf(accel, 1) {
+		return finish(fmt.Errorf("StepDirMotor: invalid rate %v steps/s or acceleration %v steps/s²", maxRate, accel))
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.stop != nil {
+		select {
+		case <-m.done:
+		default:
+			return finish(errors.New("StepDirMotor: still moving"))
+		}
+	}
+	if n == 0 {
+		return finish(nil)
+	}
+	if m.enable != nil && !m.enabled {
+		if err := m.enable.SetState(false); err != nil {
+			return finish(fmt.Errorf("StepDirMotor enable: %w", err))
+		}
+		m.enabled = true
+	}
+	direction := 1
+	if n < 0 {
+		direction, n = -1, -n
+	}
+	if err := m.dir.SetState(direction > 0 != m.inverted); err != nil {
+		return finish(fmt.Errorf("StepDirMotor DIR: %w", err))
+	}
+	m.stop, m.done = make(chan struct{}), make(chan struct{})
+	go m.run(stepRamp{steps: n, rate: maxRate, accel: accel}, direction, m.stop, m.done, result)
+	return result
+}
+
+// Decelerates the running move (with its acceleration) to rest as soon as possible, its done then receives
+// ErrStepperStopped. Does not wait for the motor to stand still.
+func (m *StepDirMotor) Stop() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.stop == nil {
+		return
+	}
+	select {
+	case <-m.stop:
+	default:
+		close(m.stop)
+	}
+}
+
+// Whether a move is running
+func (m *StepDirMotor) Moving() bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.stop == nil {
+		return false
+	}
+	select {
+	case <-m.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Steps taken since NewStepDirMotor (or SetPosition), negative ones backwards
+func (m *StepDirMotor) Position() int {
+	return int(atomic.LoadInt64(&m.position))
+}
+
+// Redefines the current position, e.g. after homing
+func (m *StepDirMotor) SetPosition(position int) {
+	atomic.StoreInt64(&m.position, int64(position))
+}
+
+// Disables the driver, so the motor turns freely and stops drawing current. The next MoveSteps enables it again.
+// Does nothing without StepperWithEnable.
+func (m *StepDirMotor) Disable() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.enable == nil || !m.enabled {
+		return nil
+	}
+	m.enabled = false
+	return m.enable.SetState(true)
+}
+
+// Stops the running move, waits for the motor to stand still and disables the driver. The GPIOs stay open.
+func (m *StepDirMotor) Close() {
+	m.Stop()
+	m.lock.Lock()
+	done := m.done
+	m.lock.Unlock()
+	if done != nil {
+		<-done
+	}
+	m.Disable()
+}
+
+func (m *StepDirMotor) run(ramp stepRamp, direction int, stop <-chan struct{}, done chan<- struct{}, result chan<- error) {
+	defer close(done)
+	defer close(result)
+	// DIR setup time before the first pulse
+	m.clock.Sleep(m.pulse)
+	start := m.clock.Now()
+	stopped := false
+	for i := 0; i < ramp.steps; i++ {
+		if !stopped && !m.waitUntil(start.Add(ramp.delay(i)), stop) {
+			stopped = true
+			if ramp.steps = ramp.stopAt(i); i >= ramp.steps {
+				break
+			}
+		}
+		due := start.Add(ramp.delay(i))
+		if stopped {
+			m.waitUntil(due, nil)
+		}
+		if late := m.clock.Now().Sub(due); late > m.tolerance {
+			result <- fmt.Errorf("StepDirMotor: step %d of %d %v late: %w", i+1, ramp.steps, late, ErrStepperLate)
+			return
+		}
+		if err := m.step.SetState(true); err != nil {
+			result <- fmt.Errorf("StepDirMotor STEP: %w", err)
+			return
+		}
+		m.clock.Sleep(m.pulse)
+		if err := m.step.SetState(false); err != nil {
+			result <- fmt.Errorf("StepDirMotor STEP: %w", err)
+			return
+		}
+		atomic.AddInt64(&m.position, int64(direction))
+	}
+	if stopped {
+		result <- ErrStepperStopped
+		return
+	}
+	result <- nil
+}
+
+// false if stop closed first
+func (m *StepDirMotor) waitUntil(t time.Time, stop <-chan struct{}) bool {
+	select {
+	case <-m.clock.After(t.Sub(m.clock.Now())):
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+// trapezoidal motion profile of a move over steps from rest to rest, pulse i is at position i+0.5
+type stepRamp struct {
+	steps       int
+	rate, accel float64 // steps/s, steps/s²; accel 0 has no ramps
+}
+
+// position where the acceleration ends, and the peak rate
+func (r stepRamp) peak() (s, rate float64) {
+	if r.accel == 0 {
+		return 0, r.rate
+	}
+	s = r.rate * r.rate / (2 * r.accel)
+	if 2*s <= float64(r.steps) {
+		return s, r.rate
+	}
+	// no time to reach the rate, a triangular profile
+	s = float64(r.steps) / 2
+	return s, math.Sqrt(2 * r.accel * s)
+}
+
+// seconds from the start until position s is reached
+func (r stepRamp) at(s float64) float64 {
+	sa, rate := r.peak()
+	n := float64(r.steps)
+	switch {
+	case r.accel == 0:
+		return s / rate
+	case s <= sa:
+		return math.Sqrt(2 * s / r.accel)
+	case s <= n-sa:
+		return rate/r.accel + (s-sa)/rate
+	default:
+		total := 2*rate/r.accel + (n-2*sa)/rate
+		return total - math.Sqrt(2*(n-s)/r.accel)
+	}
+}
+
+// time of pulse i after the first one
+func (r stepRamp) delay(i int) time.Duration {
+	return time.Duration((r.at(float64(i)+0.5) - r.at(0.5)) * float64(time.Second))
+}
+
+// number of steps of a ramp decelerating as soon as possible when stopped before pulse i, the pulses up to i keep their times
+func (r stepRamp) stopAt(i int) int {
+	if r.accel == 0 || i == 0 {
+		return i
+	}
+	s := float64(i) + 0.5
+	sa, rate := r.peak()
+	var stopped int
+	if s <= sa {
+		// keep accelerating up to pulse i, then decelerate as long
+		stopped = 2*i + 1
+	} else {
+		stopped = int(math.Ceil(s + rate*rate/(2*r.accel)))
+	}
+	if stopped > r.steps {
+		return r.steps
+	}
+	return stopped
+}
@@ -0,0 +1,207 @@
+package bbhw
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// counts the rising edges of STEP on the driver side, up or down by DIR
+type fakeStepDriver struct {
+	position int
+	reversed int // direction changes between steps
+	forward  bool
+}
+
+// the STEP and DIR outputs for a motor, connected to a fakeStepDriver. STEP keeps a history of 10000 changes.
+func newFakeStepDriver(t *testing.T, clock Clock) (driver *fakeStepDriver, step, dir *FakeGPIO) {
+	step, dir = NewFakeNamedGPIO("STEP", OUT, nil), NewFakeNamedGPIO("DIR", OUT, nil)
+	stepIn, dirIn := NewFakeNamedGPIO("STEP_drv", IN, nil), NewFakeNamedGPIO("DIR_drv", IN, nil)
+	step.ConnectTo(stepIn)
+	dir.ConnectTo(dirIn)
+	for _, gpio := range []*FakeGPIO{step, dir, stepIn, dirIn} {
+		gpio.SetClock(clock)
+		t.Cleanup(gpio.Close)
+	}
+	step.EnableHistory(10000)
+	driver = &fakeStepDriver{forward: true}
+	stepIn.OnChange(func(high bool) {
+		if !high {
+			return
+		}
+		if forward := GetStateOrPanic(dirIn); forward != driver.forward {
+			driver.forward = forward
+			driver.reversed++
+		}
+		if driver.forward {
+			driver.position++
+		} else {
+			driver.position--
+		}
+	})
+	return driver, step, dir
+}
+
+// starts a move and waits for its goroutine to wait on the clock
+func startMove(t *testing.T, m *StepDirMotor, clock *ManualClock, n int, rate, accel float64) (done <-chan error) {
+	t.Helper()
+	afterTimer(t, clock, func() { done = m.MoveSteps(n, rate, accel) })
+	return done
+}
+
+func expectMoveResult(t *testing.T, done <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(time.Second):
+		t.Fatal("move did not end")
+		return nil
+	}
+}
+
+// intervals between the rising edges of history
+func stepIntervals(history []Transition) (intervals []time.Duration) {
+	var last time.Time
+	for _, tr := range history {
+		if !tr.State {
+			continue
+		}
+		if !last.IsZero() {
+			intervals = append(intervals, tr.Time.Sub(last))
+		}
+		last = tr.Time
+	}
+	return intervals
+}
+
+func Test_StepDirMotorRamp(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	driver, step, dir := newFakeStepDriver(t, clock)
+	m, err := NewStepDirMotor(step, dir, StepperWithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	// 50 steps accelerating to 1000 steps/s, 100 cruising, 50 decelerating
+	done := startMove(t, m, clock, 200, 1000, 10000)
+	advanceWhile(t, clock, m.Moving)
+	if err := expectMoveResult(t, done); err != nil {
+		t.Fatal(err)
+	}
+	if driver.position != 200 || m.Position() != 200 {
+		t.Fatalf("driver at %d, Position() %d, expected 200", driver.position, m.Position())
+	}
+	intervals := stepIntervals(step.History())
+	for i := 1; i < 50; i++ {
+		if intervals[i] > intervals[i-1] || intervals[198-i] > intervals[199-i] {
+			t.Fatalf("not accelerating or decelerating at step %d: %v", i, intervals)
+		}
+	}
+	for i := 50; i < 149; i++ {
+		if d := intervals[i] - time.Millisecond; d < -time.Microsecond || d > time.Microsecond {
+			t.Fatalf("interval %d is %v while cruising at 1000 steps/s", i, intervals[i])
+		}
+	}
+	if d := intervals[0] - intervals[198]; intervals[0] < 3*time.Millisecond || d < -time.Microsecond || d > time.Microsecond {
+		t.Errorf("first and last interval %v, %v", intervals[0], intervals[198])
+	}
+	// backwards without ramp
+	done = startMove(t, m, clock, -50, 500, 0)
+	advanceWhile(t, clock, m.Moving)
+	if err := expectMoveResult(t, done); err != nil || driver.position != 150 || m.Position() != 150 || driver.reversed != 1 {
+		t.Errorf("after 50 steps back: driver at %d, reversed %d times, Position() %d, %v", driver.position, driver.reversed, m.Position(), err)
+	}
+}
+
+func Test_StepDirMotorStop(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	driver, step, dir := newFakeStepDriver(t, clock)
+	m, err := NewStepDirMotor(step, dir, StepperWithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	done := startMove(t, m, clock, 1000, 1000, 10000)
+	advanceTimerByTimer(t, clock, 200*time.Millisecond)
+	if !m.Moving() {
+		t.Fatal("not moving")
+	}
+	reached := m.Position()
+	m.Stop()
+	advanceWhile(t, clock, m.Moving)
+	if err := expectMoveResult(t, done); !errors.Is(err, ErrStepperStopped) {
+		t.Fatalf("stopped move ended with %v", err)
+	}
+	// cruising when stopped, 50 steps to decelerate
+	if m.Position() != driver.position || m.Position() < reached+49 || m.Position() > reached+51 {
+		t.Errorf("stopped at %d (driver %d) after %d", m.Position(), driver.position, reached)
+	}
+	intervals := stepIntervals(step.History())
+	for i := len(intervals) - 48; i < len(intervals); i++ {
+		if intervals[i] <= intervals[i-1] {
+			t.Fatalf("not decelerating after Stop: %v", intervals[len(intervals)-50:])
+		}
+	}
+	// stopped while accelerating it decelerates as long
+	start := m.Position()
+	done = startMove(t, m, clock, 1000, 1000, 10000)
+	advanceTimerByTimer(t, clock, 50*time.Millisecond)
+	accelerated := m.Position() - start
+	m.Stop()
+	advanceWhile(t, clock, m.Moving)
+	if err := expectMoveResult(t, done); !errors.Is(err, ErrStepperStopped) || m.Position()-start > 2*accelerated+1 {
+		t.Errorf("%d steps after %d accelerating, %v", m.Position()-start, accelerated, err)
+	}
+}
+
+func Test_StepDirMotorLate(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	driver, step, dir := newFakeStepDriver(t, clock)
+	m, err := NewStepDirMotor(step, dir, StepperWithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	// each SetState of STEP takes 300µs, steps are due every 200µs
+	step.SetOperationLatency(300 * time.Microsecond)
+	done := startMove(t, m, clock, 100, 5000, 0)
+	advanceWhile(t, clock, m.Moving)
+	if err := expectMoveResult(t, done); !errors.Is(err, ErrStepperLate) {
+		t.Fatalf("move too fast for the GPIO: %v", err)
+	}
+	if m.Position() == 0 || m.Position() >= 10 || driver.position != m.Position() {
+		t.Errorf("late after %d steps, driver at %d", m.Position(), driver.position)
+	}
+}
+
+func Test_StepDirMotorEnable(t *testing.T) {
+	en := NewFakeNamedGPIO("EN", OUT, nil)
+	t.Cleanup(en.Close)
+	clock := NewManualClock(time.Unix(1000, 0))
+	_, step, dir := newFakeStepDriver(t, clock)
+	m, err := NewStepDirMotor(step, dir, StepperWithClock(clock), StepperWithEnable(en))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if !GetStateOrPanic(en) {
+		t.Fatal("driver enabled before the first move")
+	}
+	done := startMove(t, m, clock, 10, 1000, 0)
+	if GetStateOrPanic(en) {
+		t.Error("driver disabled while moving")
+	}
+	if err := expectMoveResult(t, m.MoveSteps(10, 1000, 0)); err == nil {
+		t.Error("second move while moving accepted")
+	}
+	advanceWhile(t, clock, m.Moving)
+	expectMoveResult(t, done)
+	if err := expectMoveResult(t, m.MoveSteps(10, 0, 0)); err == nil {
+		t.Error("rate 0 accepted")
+	}
+	m.Close()
+	if !GetStateOrPanic(en) {
+		t.Error("driver enabled after Close")
+	}
+}
@@ -0,0 +1,176 @@
+package bbhw
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Edges of a pulse arrived in an order not making up a pulse, or some of them got lost
+var ErrEdgeOrder = errors.New("edges out of order")
+
+// Option of NewUltrasonic
+type UltrasonicOption func(*Ultrasonic)
+
+// times the trigger pulse, timeouts and MeasureMedian on c
+func UltrasonicWithClock(c Clock) UltrasonicOption {
+	return func(u *Ultrasonic) { u.clock = c }
+}
+
+// air temperature for the speed of sound, default 20°C. Each 10°C off are almost 2% of the distance.
+func UltrasonicWithTemperature(celsius float64) UltrasonicOption {
+	return func(u *Ultrasonic) { u.celsius = celsius }
+}
+
+const (
+	ultrasonic_trigger_ = 10 * time.Microsecond
+	// the datasheet of the HC-SR04 asks for 60ms between measurements, so echoes of the last one faded
+	ultrasonic_cycle_ = 60 * time.Millisecond
+)
+
+// Ultrasonic distance sensor HC-SR04 (and compatibles like the US-100 in HC-SR04 mode):
+// a 10µs pulse on trigger sends a burst, echo stays high as long as its echo is under way.
+// The echo of a 5V sensor needs a level shifter or voltage divider to 3.3V.
+// Like DHTSensor the width is measured from edge timestamps, 1µs being 0.17mm.
+type Ultrasonic struct {
+	trigger GPIOControllablePin
+	echo    EdgeEventGPIO
+	clock   Clock
+	events  chan EdgeEvent
+	lock    sync.Mutex // one measurement at a time, guards celsius
+	celsius float64
+}
+
+// trigger has to be an output, it is driven low. Switches echo to input and watches both edges from now on,
+// it needs to be exclusive to the sensor.
+func NewUltrasonic(trigger GPIOControllablePin, echo EdgeEventGPIO, opts ...UltrasonicOption) (*Ultrasonic, error) {
+	if trigger == nil || echo == nil {
+		panic("gpio == nil")
+	}
+	u := &Ultrasonic{trigger: trigger, echo: echo, celsius: 20, events: make(chan EdgeEvent, 16)}
+	for _, opt := range opts {
+		opt(u)
+	}
+	if u.clock == nil {
+		u.clock = defaultClock()
+	}
+	if err := checkOutput(trigger, "Ultrasonic"); err != nil {
+		return nil, err
+	}
+	if err := trigger.SetState(false); err != nil {
+		return nil, err
+	}
+	if err := echo.SetDirection(IN); err != nil {
+		return nil, err
+	}
+	if err := echo.SetEdge(BOTH); err != nil {
+		return nil, err
+	}
+	if err := echo.SetEdgeEventCallback(u.events, -1); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// Changes the air temperature for the speed of sound, e.g. to the one of a DHTSensor
+func (u *Ultrasonic) SetTemperature(celsius float64) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.celsius = celsius
+}
+
+// speed of sound in dry air in m/s
+func speedOfSound(celsius float64) float64 {
+	return 331.3 + 0.606*celsius
+}
+
+// Triggers the sensor and returns the distance of its echo. Fails with ErrTimeout if the echo did not
+// end within timeout (about 6ms per meter, a HC-SR04 without echo stays high for up to 200ms),
+// with ErrEdgeOrder if the edges seen do not make up the echo pulse.
+func (u *Ultrasonic) MeasureDistance(timeout time.Duration) (meters float64, err error) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	start := u.clock.Now()
+	if err = u.trigger.SetState(true); err == nil {
+		u.clock.Sleep(ultrasonic_trigger_)
+		err = u.trigger.SetState(false)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("Ultrasonic trigger: %w", err)
+	}
+	deadline := u.clock.After(timeout)
+	var rose EdgeEvent
+	rising := false
+	for {
+		select {
+		case ev, ok := <-u.events:
+			if !ok {
+				return 0, errors.New("Ultrasonic: echo GPIO closed")
+			}
+			if ev.Time.Before(start) {
+				continue // from before the trigger, e.g. the end of a late echo
+			}
+			if ev.Missed > 0 {
+				return 0, fmt.Errorf("Ultrasonic: %d echo edges missed: %w", ev.Missed, ErrEdgeOrder)
+			}
+			if ev.Edge == RISING {
+				if rising {
+					return 0, fmt.Errorf("Ultrasonic: echo rose twice: %w", ErrEdgeOrder)
+				}
+				rose, rising = ev, true
+				continue
+			}
+			if !rising {
+				return 0, fmt.Errorf("Ultrasonic: echo fell before it rose: %w", ErrEdgeOrder)
+			}
+			width := ev.at() - rose.at()
+			if width <= 0 {
+				return 0, fmt.Errorf("Ultrasonic: echo width %v: %w", width, ErrEdgeOrder)
+			}
+			return width.Seconds() * speedOfSound(u.celsius) / 2, nil
+		case <-deadline:
+			if rising {
+				return 0, fmt.Errorf("Ultrasonic: echo longer than %v: %w", timeout, ErrTimeout)
+			}
+			return 0, fmt.Errorf("Ultrasonic: no echo within %v: %w", timeout, ErrTimeout)
+		}
+	}
+}
+
+// Median distance of n measurements 60ms apart, ignoring failed ones unless all of them failed.
+// A single stray echo, e.g. off a wall at the side, does not change it.
+func (u *Ultrasonic) MeasureMedian(n int, timeout time.Duration) (meters float64, err error) {
+	if n < 1 {
+		return 0, fmt.Errorf("Ultrasonic: median of %d measurements", n)
+	}
+	var distances []float64
+	for i := 0; i < n; i++ {
+		start := u.clock.Now()
+		d, merr := u.MeasureDistance(timeout)
+		if merr != nil {
+			err = merr
+		} else {
+			distances = append(distances, d)
+		}
+		if i+1 < n {
+			if wait := start.Add(ultrasonic_cycle_).Sub(u.clock.Now()); wait > 0 {
+				u.clock.Sleep(wait)
+			}
+		}
+	}
+	if len(distances) == 0 {
+		return 0, fmt.Errorf("Ultrasonic: all %d measurements failed, last: %w", n, err)
+	}
+	return median(distances), nil
+}
+
+// sorts values
+func median(values []float64) float64 {
+	sort.Float64s(values)
+	if n := len(values); n%2 == 0 {
+		return (values[n/2-1] + values[n/2]) / 2
+	}
+	return values[len(values)/2]
+}
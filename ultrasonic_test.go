@@ -0,0 +1,179 @@
+package bbhw
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// HC-SR04 on fake pins: answer is called at the falling edge of the trigger pulse
+func newFakeHCSR04(t *testing.T, clock Clock, answer func(echo *FakeGPIO)) (trigger, echo *FakeGPIO) {
+	trigger = NewFakeNamedGPIO("TRIG", OUT, nil)
+	trigIn := NewFakeNamedGPIO("TRIG_dev", IN, nil)
+	echo = NewFakeNamedGPIO("ECHO", IN, nil)
+	trigger.ConnectTo(trigIn)
+	for _, gpio := range []*FakeGPIO{trigger, trigIn, echo} {
+		gpio.SetClock(clock)
+		t.Cleanup(gpio.Close)
+	}
+	trigIn.OnChange(func(high bool) {
+		if !high {
+			answer(echo)
+		}
+	})
+	return trigger, echo
+}
+
+type ultrasonicResult struct {
+	meters float64
+	err    error
+}
+
+// measures on a goroutine, returning once the measurement and the echo waveform each wait on the clock
+func startMeasurement(t *testing.T, u *Ultrasonic, clock *ManualClock, timeout time.Duration, timers int) <-chan ultrasonicResult {
+	t.Helper()
+	created := clock.Created()
+	result := make(chan ultrasonicResult, 1)
+	go func() {
+		var r ultrasonicResult
+		r.meters, r.err = u.MeasureDistance(timeout)
+		result <- r
+	}()
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Microsecond) {
+		if clock.Created()-created >= timers {
+			return result
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("measurement not started")
+		}
+	}
+}
+
+func expectMeasurement(t *testing.T, result <-chan ultrasonicResult) ultrasonicResult {
+	t.Helper()
+	select {
+	case r := <-result:
+		return r
+	case <-time.After(time.Second):
+		t.Fatal("measurement did not end")
+		return ultrasonicResult{}
+	}
+}
+
+func Test_UltrasonicEchoWidths(t *testing.T) {
+	var width time.Duration
+	clock := NewManualClock(time.Unix(1000, 0))
+	trigger, echo := newFakeHCSR04(t, clock, func(echo *FakeGPIO) {
+		echo.PlayWaveform([]WaveStep{{true, width}, {false, 0}})
+	})
+	u, err := NewUltrasonic(trigger, echo, UltrasonicWithClock(skipClock{clock}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		width   time.Duration
+		celsius float64
+		meters  float64
+	}{
+		{5800 * time.Microsecond, 20, 0.0058 * 343.42 / 2},
+		{5800 * time.Microsecond, 0, 0.0058 * 331.3 / 2},
+		{150 * time.Microsecond, 20, 0.00015 * 343.42 / 2},
+		{23 * time.Millisecond, 35, 0.023 * 352.51 / 2},
+	} {
+		width = c.width
+		u.SetTemperature(c.celsius)
+		result := startMeasurement(t, u, clock, 30*time.Millisecond, 2)
+		// the echo ends before the timeout on its own clock step
+		clock.Advance(c.width)
+		if r := expectMeasurement(t, result); r.err != nil || math.Abs(r.meters-c.meters) > 1e-9 {
+			t.Errorf("echo of %v at %v°C: %vm, %v, expected %vm", c.width, c.celsius, r.meters, r.err, c.meters)
+		}
+		clock.Advance(time.Second)
+	}
+}
+
+func Test_UltrasonicErrors(t *testing.T) {
+	var steps []WaveStep
+	var played <-chan struct{}
+	clock := NewManualClock(time.Unix(1000, 0))
+	trigger, echo := newFakeHCSR04(t, clock, func(echo *FakeGPIO) {
+		if steps != nil {
+			played, _ = echo.PlayWaveform(steps)
+		}
+	})
+	u, err := NewUltrasonic(trigger, echo, UltrasonicWithClock(skipClock{clock}), UltrasonicWithTemperature(25))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// nobody answering
+	result := startMeasurement(t, u, clock, 30*time.Millisecond, 1)
+	clock.Advance(30 * time.Millisecond)
+	if r := expectMeasurement(t, result); !errors.Is(r.err, ErrTimeout) {
+		t.Errorf("without echo: %v", r.err)
+	}
+	// an echo longer than the timeout
+	steps = []WaveStep{{true, 50 * time.Millisecond}, {false, 0}}
+	result = startMeasurement(t, u, clock, 30*time.Millisecond, 2)
+	clock.Advance(30 * time.Millisecond)
+	if r := expectMeasurement(t, result); !errors.Is(r.err, ErrTimeout) {
+		t.Errorf("echo too long: %v", r.err)
+	}
+	clock.Advance(time.Second)
+	<-played
+	// still high from something else when triggered, only the falling edge arrives
+	echo.FakeInput(true)
+	clock.Advance(time.Millisecond)
+	steps = []WaveStep{{false, 0}}
+	result = startMeasurement(t, u, clock, 30*time.Millisecond, 1)
+	if r := expectMeasurement(t, result); !errors.Is(r.err, ErrEdgeOrder) {
+		t.Errorf("only a falling edge: %v", r.err)
+	}
+	clock.Advance(time.Second)
+}
+
+func Test_UltrasonicMedian(t *testing.T) {
+	var clock *ManualClock
+	pulse := func(width time.Duration) func(*FakeGPIO) {
+		return func(echo *FakeGPIO) {
+			echo.FakeInput(true)
+			clock.Advance(width)
+			echo.FakeInput(false)
+		}
+	}
+	answers := []func(*FakeGPIO){
+		pulse(2900 * time.Microsecond),
+		pulse(2910 * time.Microsecond),
+		// a stray echo, and the line high again afterwards so only a falling edge follows
+		func(echo *FakeGPIO) { pulse(800 * time.Microsecond)(echo); echo.FakeInput(true) },
+		func(echo *FakeGPIO) { echo.FakeInput(false) },
+		pulse(2905 * time.Microsecond),
+	}
+	clock = NewManualClock(time.Unix(1000, 0))
+	trigger, echo := newFakeHCSR04(t, clock, func(echo *FakeGPIO) {
+		answers[0](echo)
+		answers = answers[1:]
+	})
+	u, err := NewUltrasonic(trigger, echo, UltrasonicWithClock(skipClock{clock}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := clock.Now()
+	meters, err := u.MeasureMedian(5, 30*time.Millisecond)
+	if expected := 0.0029025 * 343.42 / 2; err != nil || math.Abs(meters-expected) > 1e-9 {
+		t.Errorf("median %vm, %v, expected %vm", meters, err, expected)
+	}
+	if elapsed := clock.Now().Sub(start); elapsed < 4*ultrasonic_cycle_ || elapsed > 5*ultrasonic_cycle_ {
+		t.Errorf("5 measurements took %v", elapsed)
+	}
+	fall := func(echo *FakeGPIO) { echo.FakeInput(false); echo.FakeInput(true) }
+	answers = []func(*FakeGPIO){fall, fall}
+	echo.FakeInput(true)
+	clock.Advance(time.Millisecond)
+	if _, err := u.MeasureMedian(2, 30*time.Millisecond); !errors.Is(err, ErrEdgeOrder) {
+		t.Errorf("all failed: %v", err)
+	}
+	if _, err := u.MeasureMedian(0, 30*time.Millisecond); err == nil {
+		t.Error("median of 0 measurements")
+	}
+}
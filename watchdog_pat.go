@@ -0,0 +1,138 @@
+package bbhw
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// returned by WatchdogPat.Pet once patting stopped, after Close or a failed SetState
+var ErrWatchdogStopped = errors.New("watchdog patting stopped")
+
+// Option of NewWatchdogPat
+type WatchdogOption func(*WatchdogPat)
+
+// times the pats on c
+func WatchdogWithClock(c Clock) WatchdogOption {
+	return func(w *WatchdogPat) { w.clock = c }
+}
+
+// Pats an external watchdog chip (e.g. a TPS3823 or MAX6369) by toggling an output every interval from a goroutine.
+// If a SetState fails patting stops and onFailure is called with the error (once, on the goroutine patting),
+// so the application can try to recover, or shut down in order, before the watchdog resets the board.
+type WatchdogPat struct {
+	gpio      GPIOControllablePin
+	interval  time.Duration
+	onFailure func(error)
+	clock     Clock
+	stop      chan struct{}
+	lock      sync.Mutex // guards everything below
+	level     bool
+	paused    bool
+	err       error // of the failed SetState
+	stopped   bool
+}
+
+// Drives gpio (an output) low and toggles it every interval from now on.
+// interval has to be well below the timeout of the watchdog, e.g. 200ms for 500ms. onFailure may be nil.
+func NewWatchdogPat(gpio GPIOControllablePin, interval time.Duration, onFailure func(error), opts ...WatchdogOption) (*WatchdogPat, error) {
+	if gpio == nil {
+		panic("gpio == nil")
+	}
+	w := &WatchdogPat{gpio: gpio, interval: interval, onFailure: onFailure, stop: make(chan struct{})}
+	for _, opt := range opts {
+		opt(w)
+	}
+	if w.clock == nil {
+		w.clock = defaultClock()
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("WatchdogPat: invalid interval %v", interval)
+	}
+	if err := checkOutput(gpio, "WatchdogPat"); err != nil {
+		return nil, err
+	}
+	if err := gpio.SetState(false); err != nil {
+		return nil, err
+	}
+	go w.run()
+	return w, nil
+}
+
+func (w *WatchdogPat) run() {
+	next := w.clock.Now()
+	for {
+		next = next.Add(w.interval)
+		select {
+		case <-w.stop:
+			return
+		case <-w.clock.After(next.Sub(w.clock.Now())):
+		}
+		w.lock.Lock()
+		paused := w.paused
+		w.lock.Unlock()
+		if !paused {
+			w.Pet()
+		}
+	}
+}
+
+// Toggles the output now, paused or not. A failure stops patting and calls onFailure, like on the goroutine.
+func (w *WatchdogPat) Pet() error {
+	w.lock.Lock()
+	if w.stopped {
+		w.lock.Unlock()
+		return ErrWatchdogStopped
+	}
+	err := w.gpio.SetState(!w.level)
+	if err == nil {
+		w.level = !w.level
+		w.lock.Unlock()
+		return nil
+	}
+	err = fmt.Errorf("WatchdogPat: %w", err)
+	w.err = err
+	w.halt()
+	w.lock.Unlock()
+	if w.onFailure != nil {
+		w.onFailure(err)
+	}
+	return err
+}
+
+// Stops toggling on the goroutine, e.g. to Pet from the main loop only: a hanging main loop then resets the board
+func (w *WatchdogPat) Pause() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.paused = true
+}
+
+// Toggles on the goroutine again, keeping to the intervals since construction
+func (w *WatchdogPat) Resume() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.paused = false
+}
+
+// The failure which stopped patting, nil while patting or after Close
+func (w *WatchdogPat) Err() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.err
+}
+
+// Stops patting, the watchdog resets the board unless somebody else pats it. The GPIO belongs to the caller.
+func (w *WatchdogPat) Close() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.halt()
+}
+
+// with lock held
+func (w *WatchdogPat) halt() {
+	if !w.stopped {
+		w.stopped = true
+		close(w.stop)
+	}
+}
@@ -0,0 +1,151 @@
+package bbhw
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// advances d in steps of the interval, waiting for the goroutine to wait on the clock again after each
+func advancePats(t *testing.T, clock *ManualClock, interval, d time.Duration) {
+	t.Helper()
+	for ; d > 0; d -= interval {
+		afterTimer(t, clock, func() { clock.Advance(interval) })
+	}
+}
+
+func Test_WatchdogPatInterval(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	gpio := NewFakeNamedGPIO("WDI", OUT, nil)
+	gpio.SetClock(clock)
+	defer gpio.Close()
+	gpio.EnableHistory(1000)
+	var w *WatchdogPat
+	afterTimer(t, clock, func() {
+		var err error
+		if w, err = NewWatchdogPat(gpio, 200*time.Millisecond, nil, WatchdogWithClock(clock)); err != nil {
+			t.Fatal(err)
+		}
+	})
+	defer w.Close()
+	start := clock.Now()
+	advancePats(t, clock, 200*time.Millisecond, 2*time.Second)
+	history := gpio.History()
+	if len(history) != 10 {
+		t.Fatalf("%d pats in 2s: %+v", len(history), history)
+	}
+	for i, tr := range history {
+		if at := tr.Requested.Sub(start); at != time.Duration(i+1)*200*time.Millisecond || tr.State != (i%2 == 0) {
+			t.Errorf("pat %d to %v at %v", i, tr.State, at)
+		}
+	}
+	if w.Err() != nil {
+		t.Error(w.Err())
+	}
+}
+
+func Test_WatchdogPatPause(t *testing.T) {
+	clock := NewManualClock(time.Unix(1000, 0))
+	gpio := NewFakeNamedGPIO("WDI", OUT, nil)
+	gpio.SetClock(clock)
+	defer gpio.Close()
+	gpio.EnableHistory(1000)
+	var w *WatchdogPat
+	afterTimer(t, clock, func() {
+		var err error
+		if w, err = NewWatchdogPat(gpio, 200*time.Millisecond, nil, WatchdogWithClock(clock)); err != nil {
+			t.Fatal(err)
+		}
+	})
+	defer w.Close()
+	w.Pause()
+	advancePats(t, clock, 200*time.Millisecond, time.Second)
+	if len(gpio.History()) != 0 {
+		t.Fatalf("patted while paused: %+v", gpio.History())
+	}
+	if err := w.Pet(); err != nil || !GetStateOrPanic(gpio) {
+		t.Fatalf("Pet: %v", err)
+	}
+	if err := w.Pet(); err != nil || GetStateOrPanic(gpio) {
+		t.Fatalf("second Pet: %v", err)
+	}
+	w.Resume()
+	advancePats(t, clock, 200*time.Millisecond, 400*time.Millisecond)
+	if history := gpio.History(); len(history) != 4 || !history[2].State || history[3].State {
+		t.Errorf("not patting after Resume: %+v", history)
+	}
+	w.Close()
+	if err := w.Pet(); !errors.Is(err, ErrWatchdogStopped) {
+		t.Errorf("Pet after Close: %v", err)
+	}
+}
+
+func Test_WatchdogPatFailure(t *testing.T) {
+	failed := make(chan error, 2)
+	clock := NewManualClock(time.Unix(1000, 0))
+	gpio := NewFakeNamedGPIO("WDI", OUT, nil)
+	gpio.SetClock(clock)
+	defer gpio.Close()
+	gpio.EnableHistory(1000)
+	var w *WatchdogPat
+	afterTimer(t, clock, func() {
+		var err error
+		if w, err = NewWatchdogPat(gpio, 200*time.Millisecond, func(err error) { failed <- err }, WatchdogWithClock(clock)); err != nil {
+			t.Fatal(err)
+		}
+	})
+	defer w.Close()
+	advancePats(t, clock, 200*time.Millisecond, 400*time.Millisecond)
+	failure := errors.New("gone")
+	gpio.FailNext("SetState", failure)
+	clock.Advance(200 * time.Millisecond)
+	select {
+	case err := <-failed:
+		if !errors.Is(err, failure) {
+			t.Errorf("callback got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("callback not called")
+	}
+	if !errors.Is(w.Err(), failure) {
+		t.Errorf("Err() = %v", w.Err())
+	}
+	clock.Advance(time.Second)
+	// the history shows the failed SetState as well
+	if len(gpio.History()) != 3 {
+		t.Errorf("patting after the failure: %+v", gpio.History())
+	}
+	if err := w.Pet(); !errors.Is(err, ErrWatchdogStopped) || len(failed) != 0 {
+		t.Errorf("Pet after the failure: %v", err)
+	}
+}
+
+// a failing Pet stops the goroutine as well
+func Test_WatchdogPatFailingPet(t *testing.T) {
+	failed := make(chan error, 2)
+	failure := errors.New("gone")
+	clock := NewManualClock(time.Unix(1000, 0))
+	gpio := NewFakeNamedGPIO("WDI", OUT, nil)
+	gpio.SetClock(clock)
+	defer gpio.Close()
+	gpio.EnableHistory(1000)
+	var w *WatchdogPat
+	afterTimer(t, clock, func() {
+		var err error
+		if w, err = NewWatchdogPat(gpio, 200*time.Millisecond, func(err error) { failed <- err }, WatchdogWithClock(clock)); err != nil {
+			t.Fatal(err)
+		}
+	})
+	defer w.Close()
+	gpio.FailNext("SetState", failure)
+	if err := w.Pet(); !errors.Is(err, failure) || !errors.Is(<-failed, failure) {
+		t.Errorf("failing Pet: %v", err)
+	}
+	clock.Advance(time.Second)
+	if len(gpio.History()) != 1 {
+		t.Errorf("patting after the failed Pet: %+v", gpio.History())
+	}
+	if _, err := NewWatchdogPat(gpio, 0, nil); err == nil {
+		t.Error("interval 0 accepted")
+	}
+}